@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package atrules interprets specific at-rules, such as @keyframes and
+@font-face, from the rules grouped by the parser package.
+
+	rules, _ := parser.ParseStylesheet(toks)
+	for _, r := range rules {
+		if tokenizer.IdentEquals(r.AtKeyword, "keyframes") {
+			k, errs := atrules.ParseKeyframes(r)
+			...
+		}
+	}
+
+Like a browser, the parsers skip the parts of a rule that are invalid, such
+as an unknown descriptor, and go on with the rest.  Each part skipped is
+reported as an error, after any errors from the parser itself.  A rule that
+is invalid as a whole gives a nil result.
+
+Parse picks the parser for a rule by its name.  Handlers for other at-rules,
+such as those of a framework, can be added with RegisterAtRule; rules with
+none are kept as an Unknown, with the component values of the prelude and
+the raw block.
+*/
+package atrules
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// reservedIdents are the keywords that a name defined by a rule can never
+// be: the CSS-wide keywords and default.
+var reservedIdents = map[string]bool{
+	"initial": true, "inherit": true, "unset": true, "revert": true, "revert-layer": true,
+	"default": true,
+}
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("atrules: "+format, args...)
+}
+
+func render(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	tokenizer.RenderTokens(&buf, toks)
+	return buf.String()
+}
+
+// checkRule reports an error unless r is an at-rule with one of the given
+// names and, if block is set, a block.
+func checkRule(r parser.Rule, block bool, names ...string) error {
+	for _, name := range names {
+		if tokenizer.IdentEquals(r.AtKeyword, name) {
+			if block && r.Block == nil {
+				return errorf("@%s has no block", r.AtKeyword)
+			}
+			return nil
+		}
+	}
+	return errorf("expected @%s, got %q", names[0], "@"+r.AtKeyword)
+}
+
+// blockContents parses the block of r as declarations, adding the parse
+// errors to errs.  Nested rules are not allowed in the at-rules here, and
+// are reported as errors too.
+func blockContents(r parser.Rule, errs *[]error) []parser.Declaration {
+	decls, rules, perrs := parser.ParseBlockContents(r.Block)
+	for _, e := range perrs {
+		*errs = append(*errs, e)
+	}
+	for _, nested := range rules {
+		*errs = append(*errs, errorf("unexpected rule %q in @%s", ruleHead(nested), r.AtKeyword))
+	}
+	return decls
+}
+
+// ruleHead returns the at-keyword and prelude of r, for error messages.
+func ruleHead(r parser.Rule) string {
+	s := render(r.Prelude)
+	if r.AtKeyword != "" {
+		s = "@" + r.AtKeyword + " " + s
+	}
+	return strings.TrimSpace(s)
+}
+
+// writeBlock writes decls as a {} block.
+func writeBlock(buf *bytes.Buffer, decls []parser.Declaration) {
+	buf.WriteByte('{')
+	for _, d := range decls {
+		buf.WriteByte(' ')
+		if tokenizer.IsValidCustomPropertyName(d.Name) {
+			buf.WriteString(d.Name)
+		} else {
+			buf.WriteString(tokenizer.SerializeIdentifier(d.Name))
+		}
+		buf.WriteString(": ")
+		tokenizer.RenderTokens(buf, d.Value)
+		if d.Important {
+			buf.WriteString(" !important")
+		}
+		buf.WriteByte(';')
+	}
+	buf.WriteString(" }")
+}
+
+// function returns the lower-cased name and the arguments of cv, if it is a
+// function.
+func function(cv []tokenizer.Token) (name string, args []tokenizer.Token, ok bool) {
+	if len(cv) < 2 || cv[0].Type != tokenizer.TokenFunction {
+		return "", nil, false
+	}
+	return strings.ToLower(cv[0].Value), cv[1 : len(cv)-1], true
+}
+
+// writeRule writes r as it was written, apart from the whitespace around
+// the prelude.
+func writeRule(buf *bytes.Buffer, r parser.Rule) {
+	head := ruleHead(r)
+	buf.WriteString(head)
+	if r.Block == nil {
+		buf.WriteByte(';')
+		return
+	}
+	if head != "" {
+		buf.WriteByte(' ')
+	}
+	buf.WriteByte('{')
+	tokenizer.RenderTokens(buf, r.Block)
+	buf.WriteByte('}')
+}
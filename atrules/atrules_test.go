@@ -0,0 +1,495 @@
+// Copyright 2018 Kane York.
+
+package atrules
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// rule returns the first rule of src.
+func rule(t *testing.T, src string) parser.Rule {
+	toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+	rules, errs := parser.ParseStylesheet(toks)
+	if len(rules) == 0 || len(errs) != 0 {
+		t.Fatalf("%s: got %d rules, %v", src, len(rules), errs)
+	}
+	return rules[0]
+}
+
+func errorList(errs []error) string {
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestParseKeyframes(t *testing.T) {
+	k, errs := ParseKeyframes(rule(t, `@keyframes Slide {
+		from { left: 0 }
+		50%, 75.5% { left: 10px; top: 1px !important }
+		TO { left: 20px }
+		150% { left: 0 }
+		entry 10%, exit 90% { opacity: 1 }
+		@media print { }
+	}`))
+	if k == nil {
+		t.Fatal(errs)
+	}
+	want := `@keyframes Slide { 0% { left: 0; } 50%, 75.5% { left: 10px; } 100% { left: 20px; } ` +
+		`entry 10%, exit 90% { opacity: 1; } }`
+	if got := k.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	wantErrs := "atrules: !important is ignored in keyframes, on \"top\"\n" +
+		"atrules: keyframe selector \"150%\" is out of range\n" +
+		"atrules: unexpected rule \"@media print\" in @keyframes"
+	if got := errorList(errs); got != wantErrs {
+		t.Errorf("got errors:\n%s\nwant:\n%s", got, wantErrs)
+	}
+
+	k, errs = ParseKeyframes(rule(t, `@-webkit-keyframes "none" { to { a: b } }`))
+	if k == nil || k.Name != "none" || len(errs) != 0 {
+		t.Errorf("got %v, %v", k, errs)
+	} else if got := k.String(); got != `@keyframes "none" { 100% { a: b; } }` {
+		t.Errorf("got %s", got)
+	}
+
+	for _, src := range []string{`@keyframes none {}`, `@keyframes a b {}`, `@keyframes {}`, `@keyframes a;`, `@media a {}`} {
+		if k, _ := ParseKeyframes(rule(t, src)); k != nil {
+			t.Errorf("%s: expected nil, got %v", src, k)
+		}
+	}
+}
+
+func TestParseFontFace(t *testing.T) {
+	f, errs := ParseFontFace(rule(t, `@font-face {
+		font-family: "Open Sans";
+		src: local(Open Sans Regular), url(a.woff2) format("woff2") tech(Variations, color-colrv1),
+			url("b.woff") format(woff), bogus(x), local(serif);
+		unicode-range: U+0025-00FF, u+4??;
+		font-display: Swap;
+		font-weight: 100 900;
+		font-display: sometimes;
+	}`))
+	if f == nil {
+		t.Fatal(errs)
+	}
+	if f.Family != "Open Sans" || f.Display != "swap" || len(f.Other) != 1 || f.Other[0].Name != "font-weight" {
+		t.Errorf("got %+v", f)
+	}
+	wantSrc := []FontSource{
+		{Local: "Open Sans Regular"},
+		{URL: "a.woff2", Format: "woff2", Tech: []string{"variations", "color-colrv1"}},
+		{URL: "b.woff", Format: "woff"},
+	}
+	if len(f.Src) != len(wantSrc) {
+		t.Fatalf("got src %+v", f.Src)
+	}
+	for i, s := range f.Src {
+		w := wantSrc[i]
+		if s.URL != w.URL || s.Local != w.Local || s.Format != w.Format || strings.Join(s.Tech, ",") != strings.Join(w.Tech, ",") {
+			t.Errorf("src %d: got %+v, want %+v", i, s, w)
+		}
+	}
+	if len(f.UnicodeRange) != 2 || f.UnicodeRange[1] != (UnicodeRange{0x400, 0x4FF}) || !f.UnicodeRange[0].Contains('a') {
+		t.Errorf("got unicode-range %v", f.UnicodeRange)
+	}
+	wantErrs := "atrules: bad src entry \"bogus(x)\"\n" +
+		"atrules: bad local() font name \"serif\"\n" +
+		"atrules: bad font-display \"sometimes\""
+	if got := errorList(errs); got != wantErrs {
+		t.Errorf("got errors:\n%s\nwant:\n%s", got, wantErrs)
+	}
+
+	for _, src := range []string{
+		`@font-face { font-family: a; }`,
+		`@font-face { font-family: a, b; src: url(a) }`,
+		`@font-face { font-family: a; src: bogus(x) }`,
+	} {
+		if f, _ := ParseFontFace(rule(t, src)); f != nil {
+			t.Errorf("%s: expected nil, got %+v", src, f)
+		}
+	}
+}
+
+func TestParseProperty(t *testing.T) {
+	p, errs := ParseProperty(rule(t, `@property --gap {
+		syntax: "<length> | auto";
+		inherits: FALSE;
+		initial-value: 1in;
+		bogus: 1;
+	}`))
+	if p == nil || p.Name != "--gap" || p.Inherits || p.Syntax.String() != "<length> | auto" || render(p.InitialValue) != "1in" {
+		t.Fatalf("got %+v, %v", p, errs)
+	}
+	if got := errorList(errs); got != `atrules: unknown descriptor "bogus" in @property` {
+		t.Errorf("got errors %s", got)
+	}
+
+	p, _ = ParseProperty(rule(t, `@property --any { syntax: "*"; inherits: true }`))
+	if p == nil || !p.Inherits || !p.Syntax.Universal || p.InitialValue != nil {
+		t.Errorf("got %+v", p)
+	}
+
+	tests := []struct{ src, err string }{
+		{`@property gap { syntax: "*"; inherits: true }`, `atrules: bad custom property name "gap" in @property`},
+		{`@property --x { syntax: "*" }`, `atrules: @property --x needs a syntax and inherits`},
+		{`@property --x { syntax: "<length>"; inherits: true }`, `atrules: @property --x needs an initial-value`},
+		{`@property --x { syntax: "<length>"; inherits: true; initial-value: red }`,
+			`atrules: initial-value "red" does not match syntax "<length>"`},
+		{`@property --x { syntax: "<length>"; inherits: true; initial-value: 2em }`,
+			`atrules: initial-value "2em" depends on the element`},
+	}
+	for _, tt := range tests {
+		p, errs := ParseProperty(rule(t, tt.src))
+		if p != nil || errorList(errs) != tt.err {
+			t.Errorf("%s: got %+v, errors:\n%s\nwant:\n%s", tt.src, p, errorList(errs), tt.err)
+		}
+	}
+}
+
+func TestParseCounterStyle(t *testing.T) {
+	c, errs := ParseCounterStyle(rule(t, `@counter-style thumbs {
+		system: FIXED 3;
+		symbols: "👍" x url(a.png);
+		range: 1 5, infinite -1, 10 infinite;
+		pad: 3 "0";
+		fallback: lower-roman;
+		suffix: " ";
+		additive-symbols: 5 V, 10 X;
+		range: 5 1;
+		symbols: a #b;
+		fallback: none;
+	}`))
+	if c == nil {
+		t.Fatal(errs)
+	}
+	if c.Name != "thumbs" || c.System != "fixed" || c.FirstSymbol != 3 || len(c.Symbols) != 3 ||
+		c.Fallback != "lower-roman" || len(c.Other) != 1 || c.AdditiveSymbols != nil {
+		t.Errorf("got %+v", c)
+	}
+	wantRange := []CounterRange{{1, 5}, {math.MinInt64, -1}, {10, math.MaxInt64}}
+	if len(c.Range) != 3 || c.Range[0] != wantRange[0] || c.Range[1] != wantRange[1] || c.Range[2] != wantRange[2] {
+		t.Errorf("got range %v", c.Range)
+	}
+	if c.Pad == nil || c.Pad.Width != 3 || render(c.Pad.Symbol) != `"0"` {
+		t.Errorf("got pad %+v", c.Pad)
+	}
+	wantErrs := "atrules: additive symbols must be in descending order of weight\n" +
+		"atrules: range \"5 1\" is backwards\n" +
+		"atrules: bad symbol \"#b\"\n" +
+		"atrules: bad fallback \"none\""
+	if got := errorList(errs); got != wantErrs {
+		t.Errorf("got errors:\n%s\nwant:\n%s", got, wantErrs)
+	}
+
+	c, _ = ParseCounterStyle(rule(t, `@counter-style roman { system: additive; additive-symbols: 10 X, 5 V, 1 I; range: auto }`))
+	if c == nil || len(c.AdditiveSymbols) != 3 || c.AdditiveSymbols[1].Weight != 5 || c.Range != nil {
+		t.Errorf("got %+v", c)
+	}
+	c, _ = ParseCounterStyle(rule(t, `@counter-style x { system: extends decimal; suffix: ")" }`))
+	if c == nil || c.Extends != "decimal" {
+		t.Errorf("got %+v", c)
+	}
+
+	tests := []struct{ src, err string }{
+		{`@counter-style Decimal { symbols: a }`, `atrules: bad counter style name "Decimal"`},
+		{`@counter-style x { system: alphabetic; symbols: a }`,
+			`atrules: @counter-style x does not have enough symbols for the alphabetic system`},
+		{`@counter-style x { }`, `atrules: @counter-style x does not have enough symbols for the symbolic system`},
+		{`@counter-style x { system: extends decimal; symbols: a }`,
+			`atrules: @counter-style x extends another style and cannot give symbols`},
+	}
+	for _, tt := range tests {
+		c, errs := ParseCounterStyle(rule(t, tt.src))
+		if c != nil || errorList(errs) != tt.err {
+			t.Errorf("%s: got %+v, errors:\n%s\nwant:\n%s", tt.src, c, errorList(errs), tt.err)
+		}
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	p, errs := ParsePage(rule(t, `@page toc:First, :left:blank {
+		margin: 1in;
+		@top-center { content: "Title" }
+		@bottom-right-corner { content: counter(page); @top-left {} }
+		@top-middle { }
+		@top-left x { }
+		size: a4;
+	}`))
+	if p == nil {
+		t.Fatal(errs)
+	}
+	if len(p.Selectors) != 2 || p.Selectors[0].Name != "toc" || strings.Join(p.Selectors[0].PseudoClasses, ",") != "first" ||
+		p.Selectors[1].Name != "" || strings.Join(p.Selectors[1].PseudoClasses, ",") != "left,blank" {
+		t.Errorf("got selectors %+v", p.Selectors)
+	}
+	if len(p.Declarations) != 2 || p.Declarations[1].Name != "size" {
+		t.Errorf("got declarations %+v", p.Declarations)
+	}
+	if len(p.Margins) != 2 || p.Margins[0].Name != "top-center" || p.Margins[1].Name != "bottom-right-corner" ||
+		len(p.Margins[1].Declarations) != 1 {
+		t.Errorf("got margins %+v", p.Margins)
+	}
+	wantErrs := "atrules: unexpected rule \"@top-left\" in @bottom-right-corner\n" +
+		"atrules: unexpected rule \"@top-middle\" in @page\n" +
+		"atrules: unexpected rule \"@top-left x\" in @page"
+	if got := errorList(errs); got != wantErrs {
+		t.Errorf("got errors:\n%s\nwant:\n%s", got, wantErrs)
+	}
+
+	if p, _ := ParsePage(rule(t, `@page { margin: 0 }`)); p == nil || p.Selectors != nil {
+		t.Errorf("got %+v", p)
+	}
+	for _, src := range []string{`@page toc :first {}`, `@page :middle {}`, `@page a, {}`, `@page a b {}`} {
+		if p, _ := ParsePage(rule(t, src)); p != nil {
+			t.Errorf("%s: expected nil, got %+v", src, p)
+		}
+	}
+}
+
+func TestParseLayer(t *testing.T) {
+	l, errs := ParseLayer(rule(t, `@layer base, theme.Dark;`))
+	if l == nil || len(errs) != 0 || l.Block || len(l.Names) != 2 || strings.Join(l.Names[1], "/") != "theme/Dark" {
+		t.Errorf("got %+v, %v", l, errs)
+	} else if got := l.String(); got != "@layer base, theme.Dark;" {
+		t.Errorf("got %s", got)
+	}
+
+	l, errs = ParseLayer(rule(t, `@layer   a.b { p { color: red } @media print { p{} } }`))
+	if l == nil || len(errs) != 0 || !l.Block || len(l.Rules) != 2 {
+		t.Errorf("got %+v, %v", l, errs)
+	} else if got := l.String(); got != "@layer a.b { p { color: red } @media print { p{} } }" {
+		t.Errorf("got %s", got)
+	}
+
+	l, _ = ParseLayer(rule(t, `@layer {}`))
+	if l == nil || l.Names != nil || l.Rules == nil {
+		t.Errorf("got %+v", l)
+	} else if got := l.String(); got != "@layer { }" {
+		t.Errorf("got %s", got)
+	}
+
+	for _, src := range []string{`@layer;`, `@layer a, b {}`, `@layer a .b;`, `@layer a.1;`, `@layer initial;`, `@layer a.;`} {
+		if l, _ := ParseLayer(rule(t, src)); l != nil {
+			t.Errorf("%s: expected nil, got %+v", src, l)
+		}
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{`@import "a.css";`, `@import "a.css";`},
+		{`@import url(a.css) layer;`, `@import "a.css" layer;`},
+		{`@import url("a.css") layer(x.y) supports(display: grid) screen and (min-width: 1px), print ;`,
+			`@import "a.css" layer(x.y) supports(display: grid) screen and (min-width: 1px), print;`},
+		{`@import 'a.css' LAYER print;`, `@import "a.css" layer print;`},
+	}
+	for _, tt := range tests {
+		imp, errs := ParseImport(rule(t, tt.src))
+		if imp == nil {
+			t.Errorf("%s: %v", tt.src, errs)
+		} else if got := imp.String(); got != tt.want {
+			t.Errorf("%s: got %s", tt.src, got)
+		}
+	}
+	for _, src := range []string{`@import;`, `@import a;`, `@import "a" layer(1);`, `@import "a" {}`} {
+		if imp, _ := ParseImport(rule(t, src)); imp != nil {
+			t.Errorf("%s: expected nil, got %+v", src, imp)
+		}
+	}
+}
+
+func TestLayerOrder(t *testing.T) {
+	toks, _ := tokenizer.TokenizeAll([]byte(`
+		@import "x.css" layer(vendor);
+		@layer reset, base;
+		@layer base.fonts { p {} }
+		@media screen { @layer theme { @layer dark; } }
+		@layer { @layer inner; }
+		@layer reset { }
+	`), nil)
+	rules, _ := parser.ParseStylesheet(toks)
+	want := "vendor reset base base.fonts theme theme.dark"
+	if got := strings.Join(LayerOrder(rules), " "); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	tests := []struct{ src, prefix, url string }{
+		{`@namespace "http://www.w3.org/1999/xhtml";`, "", "http://www.w3.org/1999/xhtml"},
+		{`@namespace svg url(http://www.w3.org/2000/svg);`, "svg", "http://www.w3.org/2000/svg"},
+		{`@namespace X url("x");`, "X", "x"},
+	}
+	for _, tt := range tests {
+		ns, errs := ParseNamespace(rule(t, tt.src))
+		if ns == nil {
+			t.Errorf("%s: %v", tt.src, errs)
+		} else if ns.Prefix != tt.prefix || ns.URL != tt.url {
+			t.Errorf("%s: got %+v", tt.src, ns)
+		}
+	}
+	for _, src := range []string{`@namespace;`, `@namespace a;`, `@namespace a b "c";`, `@namespace "a" {}`, `@namespace url(a b);`} {
+		if ns, _ := ParseNamespace(rule(t, src)); ns != nil {
+			t.Errorf("%s: expected nil, got %+v", src, ns)
+		}
+	}
+
+	toks, _ := tokenizer.TokenizeAll([]byte(`
+		@charset "utf-8";
+		@import "x.css";
+		@namespace "a";
+		@layer base;
+		@namespace p "b";
+		@namespace p "c";
+		a {}
+		@namespace q "d";
+	`), nil)
+	rules, _ := parser.ParseStylesheet(toks)
+	got := Namespaces(rules)
+	if len(got) != 2 || got[""] != "a" || got["p"] != "c" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	s, errs := ParseScope(rule(t, `@scope (.card, #main > .x) to (.content) { color: red; img { border: 0 } }`))
+	if s == nil {
+		t.Fatal(errs)
+	}
+	if renderAll(s.Start) != ".card|#main > .x" || renderAll(s.End) != ".content" ||
+		len(s.Declarations) != 1 || len(s.Rules) != 1 || len(errs) != 0 {
+		t.Errorf("got %+v, %v", s, errs)
+	}
+
+	s, _ = ParseScope(rule(t, `@scope to (a) { }`))
+	if s == nil || s.Start != nil || renderAll(s.End) != "a" {
+		t.Errorf("got %+v", s)
+	}
+	s, _ = ParseScope(rule(t, `@scope { }`))
+	if s == nil || s.Start != nil || s.End != nil {
+		t.Errorf("got %+v", s)
+	}
+
+	for _, src := range []string{`@scope () {}`, `@scope (a,) {}`, `@scope (a) to {}`, `@scope (a) from (b) {}`, `@scope .a {}`, `@scope (a);`} {
+		if s, _ := ParseScope(rule(t, src)); s != nil {
+			t.Errorf("%s: expected nil, got %+v", src, s)
+		}
+	}
+}
+
+func renderAll(cvs [][]tokenizer.Token) string {
+	var parts []string
+	for _, cv := range cvs {
+		parts = append(parts, render(cv))
+	}
+	return strings.Join(parts, "|")
+}
+
+func TestContainer(t *testing.T) {
+	st := ContainerState{
+		Names:  []string{"card", "main"},
+		Width:  400,
+		Height: 300,
+		Style:  map[string]string{"--theme": " dark ", "display": "grid", "--empty": ""},
+	}
+	tests := []struct {
+		prelude string
+		want    bool
+	}{
+		{"(width > 300px)", true},
+		{"(width>=400px)", true},
+		{"(width > 400px)", false},
+		{"(min-width: 25em)", true},
+		{"(max-width: 5in)", true},
+		{"(300px < width <= 400px)", true},
+		{"(300px < width < 400px)", false},
+		{"(400px > width)", false},
+		{"(inline-size = 400px)", true},
+		{"(width)", true},
+		{"(orientation: landscape)", true},
+		{"(orientation: portrait)", false},
+		{"(aspect-ratio > 1)", true},
+		{"(aspect-ratio: 4/3)", true},
+		{"card (width > 1px)", true},
+		{"sidebar (width > 1px)", false},
+		{"sidebar (width > 1px), main (height < 1000px)", true},
+		{"main", true},
+		{"not (width > 500px)", true},
+		{"(width > 1px) and (height > 1px) and (height < 200px)", false},
+		{"(width < 1px) or (height < 1px) or ((height > 200px) and (width > 200px))", true},
+		{"style(--theme: dark)", true},
+		{"style(--theme:light)", false},
+		{"style(--theme)", true},
+		{"style(--empty)", false},
+		{"style(display: Grid)", false},
+		{"style((display: grid) and (not (--theme: light)))", true},
+		{"(width > 10vw)", false},
+		{"not (width > 10vw)", false},
+		{"(width > 10vw) or (width > 1px)", true},
+		{"(bogus: 1)", false},
+		{"not (bogus: 1)", false},
+		{"foo(1)", false},
+	}
+	for _, tt := range tests {
+		c, errs := ParseContainer(rule(t, "@container "+tt.prelude+" { p { color: red } }"))
+		if c == nil {
+			t.Errorf("%s: %v", tt.prelude, errs)
+			continue
+		}
+		if got := c.Matches(st); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.prelude, got, tt.want)
+		}
+	}
+
+	c, _ := ParseContainer(rule(t, "@container card (300px <= width < 500px) { }"))
+	q := c.Conditions[0].Query
+	if c.Conditions[0].Name != "card" || q.Feature != "width" || len(q.Comparisons) != 2 ||
+		q.Comparisons[0].Op != ">=" || renderAll(q.Comparisons[0].Value) != "300px" || q.Comparisons[1].Op != "<" {
+		t.Errorf("got %+v", q)
+	}
+
+	for _, src := range []string{
+		"@container { }",
+		"@container none (width) { }",
+		"@container (width) and (height) or (width) { }",
+		"@container (width) and { }",
+		"@container not (width) (height) { }",
+		"@container card width { }",
+	} {
+		if c, _ := ParseContainer(rule(t, src)); c != nil {
+			t.Errorf("%s: expected nil, got %+v", src, c)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, errs := Parse(rule(t, "@FONT-FACE { font-family: x; src: url(x.woff) }"))
+	if _, ok := v.(*FontFace); !ok || len(errs) != 0 {
+		t.Errorf("got %#v, %v", v, errs)
+	}
+	if v, _ := Parse(rule(t, "@keyframes none { }")); v != nil {
+		t.Errorf("expected nil, got %#v", v)
+	}
+
+	v, _ = Parse(rule(t, "@tailwind  base utilities(x y) ;"))
+	u, ok := v.(*Unknown)
+	if !ok || len(u.Prelude) != 2 || render(u.Prelude[1]) != "utilities(x y)" || u.String() != "@tailwind base utilities(x y);" {
+		t.Fatalf("got %#v", v)
+	}
+
+	RegisterAtRule("Tailwind", func(r parser.Rule) (interface{}, []error) {
+		return render(r.Prelude), nil
+	})
+	defer RegisterAtRule("tailwind", nil)
+	if v, _ := Parse(rule(t, "@tailwind base;")); v != "base" {
+		t.Errorf("got %#v", v)
+	}
+}
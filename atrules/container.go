@@ -0,0 +1,564 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Container is a @container rule.
+type Container struct {
+	// Conditions holds the comma-separated conditions, any one of which
+	// must hold for the rules to apply.
+	Conditions []ContainerCondition
+
+	Declarations []parser.Declaration
+	Rules        []parser.Rule
+}
+
+// ContainerCondition is a container name, a query, or both.
+type ContainerCondition struct {
+	// Name is the container name, or "" for any container.
+	Name string
+	// Query is the query the container must match, or nil if the condition
+	// only gives a name.
+	Query *ContainerQuery
+}
+
+// ContainerQuery is a node of a container query.
+type ContainerQuery struct {
+	// Op is "and", "or", or "not", whose operands are in Args; "size" for
+	// a size feature; "style" for a style feature; or "unknown" for
+	// something the grammar allows but does not define, such as an unknown
+	// feature or function, which is always unknown.
+	Op   string
+	Args []*ContainerQuery
+
+	// Feature is the name of a size feature, in lower case and without a
+	// min- or max- prefix.  A feature without comparisons is tested on its
+	// own, as in (width), and is true if it is not zero.
+	Feature     string
+	Comparisons []SizeComparison
+
+	// Property is the property of a style feature, and Value its value
+	// without whitespace and comments, or nil to test that the property is
+	// set, as in style(--theme).
+	Property string
+	Value    []tokenizer.Token
+
+	// Tokens holds the tokens of an unknown query.
+	Tokens []tokenizer.Token
+}
+
+// SizeComparison compares a size feature with a value: the feature is on
+// the left of the operator, which is one of <, <=, >, >=, or =.  Value
+// holds the component values of the value, which is more than one for a
+// ratio such as 16/9.
+type SizeComparison struct {
+	Op    string
+	Value [][]tokenizer.Token
+}
+
+// ContainerState describes a query container, for evaluating container
+// queries.
+type ContainerState struct {
+	// Names holds the container's names, from the container-name property.
+	Names []string
+	// Width and Height are the size of the content box in CSS pixels.
+	Width, Height float64
+	// Vertical is set if the container's writing mode is vertical, so its
+	// inline size is its height.
+	Vertical bool
+	// FontSize and RootFontSize are the sizes, in pixels, of the em and
+	// rem units.  They default to 16.
+	FontSize, RootFontSize float64
+	// Style holds the computed values of properties, as CSS source, for
+	// style queries.  Standard property names are in lower case.
+	Style map[string]string
+}
+
+var sizeFeatures = map[string]bool{
+	"width": true, "height": true, "inline-size": true, "block-size": true,
+	"aspect-ratio": true, "orientation": true,
+}
+
+// containerNameReserved are the keywords that cannot be a container name,
+// besides the CSS-wide keywords.
+var containerNameReserved = map[string]bool{
+	"none": true, "and": true, "or": true, "not": true,
+}
+
+// ParseContainer parses a @container rule.
+func ParseContainer(r parser.Rule) (*Container, []error) {
+	if err := checkRule(r, true, "container"); err != nil {
+		return nil, []error{err}
+	}
+	c := &Container{}
+	for _, part := range parser.SplitCommas(r.Prelude) {
+		cond, err := parseContainerCondition(parser.ComponentValues(part))
+		if err != nil {
+			return nil, []error{err}
+		}
+		c.Conditions = append(c.Conditions, cond)
+	}
+	if c.Conditions == nil {
+		return nil, []error{errorf("@container needs a condition")}
+	}
+
+	decls, rules, perrs := parser.ParseBlockContents(r.Block)
+	var errs []error
+	for _, e := range perrs {
+		errs = append(errs, e)
+	}
+	c.Declarations, c.Rules = decls, rules
+	return c, errs
+}
+
+func parseContainerCondition(cvs [][]tokenizer.Token) (ContainerCondition, error) {
+	var cond ContainerCondition
+	if len(cvs) > 0 && cvs[0][0].Type == tokenizer.TokenIdent {
+		name := strings.ToLower(cvs[0][0].Value)
+		if name != "not" {
+			if containerNameReserved[name] || reservedIdents[name] {
+				return cond, errorf("bad container name %q", cvs[0][0].Value)
+			}
+			cond.Name = cvs[0][0].Value
+			cvs = cvs[1:]
+			if len(cvs) == 0 {
+				return cond, nil
+			}
+		}
+	}
+	q, err := parseQuery(cvs, queryInParens)
+	if err != nil {
+		return cond, err
+	}
+	cond.Query = q
+	return cond, nil
+}
+
+// parseQuery parses a condition of not, and, and or over the operands
+// read by inParens.  Mixing and with or needs parentheses.
+func parseQuery(cvs [][]tokenizer.Token, inParens func([]tokenizer.Token) (*ContainerQuery, error)) (*ContainerQuery, error) {
+	if len(cvs) == 0 {
+		return nil, errorf("empty container query")
+	}
+	if cvs[0][0].MatchesIdent("not") {
+		if len(cvs) != 2 {
+			return nil, errorf("'not' takes one condition")
+		}
+		q, err := inParens(cvs[1])
+		if err != nil {
+			return nil, err
+		}
+		return &ContainerQuery{Op: "not", Args: []*ContainerQuery{q}}, nil
+	}
+	first, err := inParens(cvs[0])
+	if err != nil || len(cvs) == 1 {
+		return first, err
+	}
+	q := &ContainerQuery{Args: []*ContainerQuery{first}}
+	for i := 1; i < len(cvs); i += 2 {
+		op := strings.ToLower(cvs[i][0].Value)
+		if cvs[i][0].Type != tokenizer.TokenIdent || op != "and" && op != "or" || q.Op != "" && op != q.Op {
+			return nil, errorf("expected 'and' or 'or' in container query, got %q", render(cvs[i]))
+		}
+		if i+1 == len(cvs) {
+			return nil, errorf("expected a condition after %q", op)
+		}
+		arg, err := inParens(cvs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		q.Op, q.Args = op, append(q.Args, arg)
+	}
+	return q, nil
+}
+
+// queryInParens parses a parenthesized query or size feature, or a
+// style() function.  Anything else in parentheses, or any other function,
+// is an unknown query.
+func queryInParens(cv []tokenizer.Token) (*ContainerQuery, error) {
+	switch {
+	case cv[0].Type == tokenizer.TokenOpenParen:
+		inner := blockInner(cv)
+		if q, err := parseQuery(parser.ComponentValues(inner), queryInParens); err == nil {
+			return q, nil
+		}
+		if q, ok := parseSizeFeature(inner); ok {
+			return q, nil
+		}
+	case cv[0].Type == tokenizer.TokenFunction && tokenizer.IdentEquals(cv[0].Value, "style"):
+		_, args, _ := function(cv)
+		if q, err := parseStyleQuery(args); err == nil {
+			return q, nil
+		}
+	case cv[0].Type != tokenizer.TokenFunction:
+		return nil, errorf("expected a condition in parentheses, got %q", render(cv))
+	}
+	return &ContainerQuery{Op: "unknown", Tokens: cv}, nil
+}
+
+// blockInner returns the contents of the () block cv.
+func blockInner(cv []tokenizer.Token) []tokenizer.Token {
+	inner := cv[1:]
+	if n := len(inner); n > 0 && inner[n-1].Type == tokenizer.TokenCloseParen {
+		inner = inner[:n-1]
+	}
+	return inner
+}
+
+// parseStyleQuery parses the arguments of style(): a single style feature,
+// or a condition over style features in parentheses.
+func parseStyleQuery(args []tokenizer.Token) (*ContainerQuery, error) {
+	cvs := parser.ComponentValues(args)
+	if len(cvs) > 0 && (cvs[0][0].Type == tokenizer.TokenOpenParen || cvs[0][0].MatchesIdent("not")) {
+		return parseQuery(cvs, styleInParens)
+	}
+	return parseStyleFeature(args)
+}
+
+func styleInParens(cv []tokenizer.Token) (*ContainerQuery, error) {
+	if cv[0].Type != tokenizer.TokenOpenParen {
+		return nil, errorf("expected a style condition in parentheses, got %q", render(cv))
+	}
+	return parseStyleQuery(blockInner(cv))
+}
+
+// parseStyleFeature parses a declaration, or a property name on its own.
+func parseStyleFeature(toks []tokenizer.Token) (*ContainerQuery, error) {
+	if name, ok := customPropertyName(toks); ok {
+		return &ContainerQuery{Op: "style", Property: name}, nil
+	}
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 1 && cvs[0][0].Type == tokenizer.TokenIdent {
+		return &ContainerQuery{Op: "style", Property: strings.ToLower(cvs[0][0].Value)}, nil
+	}
+	d, err := parser.ParseDeclaration(toks)
+	if err != nil {
+		return nil, err
+	}
+	q := &ContainerQuery{Op: "style", Property: d.Name, Value: significant(d.Value)}
+	if !strings.HasPrefix(d.Name, "--") {
+		q.Property = strings.ToLower(d.Name)
+	}
+	return q, nil
+}
+
+// significant returns toks without whitespace and comments.
+func significant(toks []tokenizer.Token) []tokenizer.Token {
+	out := []tokenizer.Token{}
+	for _, t := range toks {
+		if !tokenizer.IsTrivia(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// sizeTerm is an operator or a value in a size feature.
+type sizeTerm struct {
+	op    string
+	value [][]tokenizer.Token
+}
+
+// parseSizeFeature parses a size feature in one of the forms (width),
+// (min-width: 10px), (width > 10px), (10px < width), and
+// (10px < width <= 20px).
+func parseSizeFeature(toks []tokenizer.Token) (*ContainerQuery, bool) {
+	cvs := parser.ComponentValues(toks)
+	var terms []sizeTerm
+	for i := 0; i < len(cvs); i++ {
+		t := cvs[i][0]
+		switch {
+		case t.Type == tokenizer.TokenColon:
+			terms = append(terms, sizeTerm{op: ":"})
+		case t.Type == tokenizer.TokenDelim && (t.Value == "<" || t.Value == ">" || t.Value == "="):
+			op := t.Value
+			// "<=" and ">=" are two tokens, which must be adjacent
+			if op != "=" && i+1 < len(cvs) && cvs[i+1][0].Type == tokenizer.TokenDelim && cvs[i+1][0].Value == "=" &&
+				cap(cvs[i])-cap(cvs[i+1]) == 1 {
+				op += "="
+				i++
+			}
+			terms = append(terms, sizeTerm{op: op})
+		case i+2 < len(cvs) && cvs[i+1][0].Type == tokenizer.TokenDelim && cvs[i+1][0].Value == "/":
+			terms = append(terms, sizeTerm{value: cvs[i : i+3]})
+			i += 2
+		default:
+			terms = append(terms, sizeTerm{value: cvs[i : i+1]})
+		}
+	}
+
+	// feature returns the name of the feature in term, with its prefix
+	featureName := func(term sizeTerm) string {
+		if len(term.value) != 1 || term.value[0][0].Type != tokenizer.TokenIdent {
+			return ""
+		}
+		return strings.ToLower(term.value[0][0].Value)
+	}
+	q := &ContainerQuery{Op: "size"}
+	switch len(terms) {
+	case 1:
+		q.Feature = featureName(terms[0])
+	case 3:
+		name, op := featureName(terms[0]), terms[1].op
+		if op == ":" {
+			switch {
+			case strings.HasPrefix(name, "min-"):
+				name, op = name[4:], ">="
+			case strings.HasPrefix(name, "max-"):
+				name, op = name[4:], "<="
+			default:
+				op = "="
+			}
+			if op != "=" && name == "orientation" {
+				return nil, false
+			}
+		} else if other := featureName(terms[2]); sizeFeatures[other] {
+			name, op = other, flipComparison(op)
+			terms[0], terms[2] = terms[2], terms[0]
+		}
+		if terms[2].value == nil || op == "" {
+			return nil, false
+		}
+		q.Feature = name
+		q.Comparisons = []SizeComparison{{op, terms[2].value}}
+	case 5:
+		op1, op2 := terms[1].op, terms[3].op
+		if op1 == "" || op2 == "" || op1[0] != op2[0] || op1[0] != '<' && op1[0] != '>' || terms[0].value == nil || terms[4].value == nil {
+			return nil, false
+		}
+		q.Feature = featureName(terms[2])
+		q.Comparisons = []SizeComparison{{flipComparison(op1), terms[0].value}, {op2, terms[4].value}}
+	}
+	if !sizeFeatures[q.Feature] || q.Feature == "orientation" && len(q.Comparisons) == 1 && q.Comparisons[0].Op != "=" {
+		return nil, false
+	}
+	return q, true
+}
+
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// truth is the result of a query in three-valued logic.
+type truth int
+
+const (
+	isFalse truth = iota
+	isTrue
+	isUnknown
+)
+
+// Matches reports whether the container described by st meets one of the
+// conditions of c.  The caller picks the container: for a named condition,
+// the nearest ancestor with that name; otherwise, the nearest query
+// container.
+func (c *Container) Matches(st ContainerState) bool {
+	for _, cond := range c.Conditions {
+		if cond.Matches(st) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether st has the condition's name, if it gives one, and
+// matches its query.
+func (cond ContainerCondition) Matches(st ContainerState) bool {
+	if cond.Name != "" {
+		found := false
+		for _, n := range st.Names {
+			found = found || n == cond.Name
+		}
+		if !found {
+			return false
+		}
+	}
+	return cond.Query == nil || cond.Query.Matches(st)
+}
+
+// Matches reports whether st matches q.  A query whose result is unknown,
+// such as one using an unknown feature, does not match.
+func (q *ContainerQuery) Matches(st ContainerState) bool {
+	return q.eval(&st) == isTrue
+}
+
+func (q *ContainerQuery) eval(st *ContainerState) truth {
+	switch q.Op {
+	case "not":
+		switch q.Args[0].eval(st) {
+		case isTrue:
+			return isFalse
+		case isFalse:
+			return isTrue
+		}
+		return isUnknown
+	case "and", "or":
+		// decisive decides the result if any operand has it
+		decisive, result := isFalse, isTrue
+		if q.Op == "or" {
+			decisive, result = isTrue, isFalse
+		}
+		for _, arg := range q.Args {
+			switch arg.eval(st) {
+			case decisive:
+				return decisive
+			case isUnknown:
+				result = isUnknown
+			}
+		}
+		return result
+	case "size":
+		return q.evalSize(st)
+	case "style":
+		v, ok := st.Style[q.Property]
+		if !ok {
+			return isFalse
+		}
+		toks, _ := tokenizer.TokenizeAll([]byte(v), nil)
+		toks = significant(toks)
+		if q.Value == nil {
+			return toTruth(len(toks) != 0)
+		}
+		return toTruth(tokenizer.TokensEqual(toks, q.Value))
+	}
+	return isUnknown
+}
+
+func toTruth(b bool) truth {
+	if b {
+		return isTrue
+	}
+	return isFalse
+}
+
+func (q *ContainerQuery) evalSize(st *ContainerState) truth {
+	inline, block := st.Width, st.Height
+	if st.Vertical {
+		inline, block = block, inline
+	}
+	var have float64
+	switch q.Feature {
+	case "width":
+		have = st.Width
+	case "height":
+		have = st.Height
+	case "inline-size":
+		have = inline
+	case "block-size":
+		have = block
+	case "aspect-ratio":
+		if st.Height == 0 {
+			return isUnknown
+		}
+		have = st.Width / st.Height
+	case "orientation":
+		orientation := "landscape"
+		if st.Height >= st.Width {
+			orientation = "portrait"
+		}
+		if q.Comparisons == nil {
+			return isTrue
+		}
+		return toTruth(len(q.Comparisons[0].Value) == 1 && q.Comparisons[0].Value[0][0].MatchesIdent(orientation))
+	}
+	if q.Comparisons == nil {
+		return toTruth(have != 0)
+	}
+	for _, c := range q.Comparisons {
+		var want float64
+		var ok bool
+		if q.Feature == "aspect-ratio" {
+			want, ok = ratio(c.Value)
+		} else if len(c.Value) == 1 {
+			want, ok = st.pixels(c.Value[0][0])
+		}
+		if !ok {
+			return isUnknown
+		}
+		var r bool
+		switch c.Op {
+		case "<":
+			r = have < want
+		case "<=":
+			r = have <= want
+		case ">":
+			r = have > want
+		case ">=":
+			r = have >= want
+		case "=":
+			r = have == want
+		}
+		if !r {
+			return isFalse
+		}
+	}
+	return isTrue
+}
+
+// ratio returns the value of a number or a ratio such as 16/9.
+func ratio(cvs [][]tokenizer.Token) (float64, bool) {
+	a, ok := cvs[0][0].Float()
+	if !ok || cvs[0][0].Type != tokenizer.TokenNumber {
+		return 0, false
+	}
+	if len(cvs) == 1 {
+		return a, true
+	}
+	b, ok := cvs[2][0].Float()
+	if !ok || cvs[2][0].Type != tokenizer.TokenNumber || b == 0 {
+		return 0, false
+	}
+	return a / b, true
+}
+
+var pixelsPer = map[string]float64{
+	"px": 1, "in": 96, "cm": 96 / 2.54, "mm": 96 / 25.4, "q": 96 / 101.6, "pt": 96.0 / 72, "pc": 16,
+}
+
+// pixels returns the length t in pixels.  Only absolute lengths and the em
+// and rem units can be converted.
+func (st *ContainerState) pixels(t tokenizer.Token) (float64, bool) {
+	f, ok := t.Float()
+	if !ok {
+		return 0, false
+	}
+	switch t.Type {
+	case tokenizer.TokenNumber:
+		return 0, f == 0
+	case tokenizer.TokenDimension:
+	default:
+		return 0, false
+	}
+	u := strings.ToLower(t.Extra.(*tokenizer.TokenExtraNumeric).Dimension)
+	switch u {
+	case "em":
+		return f * orDefault(st.FontSize, 16), true
+	case "rem":
+		return f * orDefault(st.RootFontSize, 16), true
+	}
+	scale, ok := pixelsPer[u]
+	return f * scale, ok
+}
+
+func orDefault(f, def float64) float64 {
+	if f == 0 {
+		return def
+	}
+	return f
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"math"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// CounterStyle is a @counter-style rule.  The descriptors that are not
+// given are left empty; their defaults depend on the system, and for
+// extends come from the extended style.
+type CounterStyle struct {
+	Name string
+	// System is the counter system in lower case, such as "cyclic" or
+	// "extends", or "" if it is not given, which means symbolic.
+	System string
+	// FirstSymbol is the first symbol value of the fixed system.
+	FirstSymbol int64
+	// Extends is the name of the counter style the extends system extends.
+	Extends string
+
+	// Symbols holds the symbols, each a string, an identifier, or an image.
+	Symbols         [][]tokenizer.Token
+	AdditiveSymbols []AdditiveSymbol
+	// Range holds the ranges the style applies to, or nil for auto.
+	Range []CounterRange
+	// Pad is set if the pad descriptor is given.
+	Pad *CounterPad
+	// Fallback is the name of the fallback counter style, or "".
+	Fallback string
+
+	// Other holds the other descriptors, such as prefix and suffix, as
+	// written.
+	Other []parser.Declaration
+}
+
+// AdditiveSymbol is a symbol of an additive counter style, with the value
+// it stands for.
+type AdditiveSymbol struct {
+	Weight int64
+	Symbol []tokenizer.Token
+}
+
+// CounterRange is a range of counter values, inclusive at both ends.
+// Infinite bounds are math.MinInt64 and math.MaxInt64.
+type CounterRange struct {
+	Min, Max int64
+}
+
+// CounterPad is the pad descriptor: representations shorter than Width
+// symbols are padded with Symbol.
+type CounterPad struct {
+	Width  int64
+	Symbol []tokenizer.Token
+}
+
+// counterStyleReserved are the names a @counter-style rule cannot define,
+// besides the CSS-wide keywords.
+var counterStyleReserved = map[string]bool{
+	"none": true, "decimal": true, "disc": true, "square": true, "circle": true,
+	"disclosure-open": true, "disclosure-closed": true,
+}
+
+var counterSystems = map[string]bool{
+	"cyclic": true, "numeric": true, "alphabetic": true, "symbolic": true,
+	"additive": true, "fixed": true, "extends": true,
+}
+
+// ParseCounterStyle parses a @counter-style rule.  Invalid descriptors are
+// skipped.  The rule is invalid if it defines a reserved name, or does not
+// have the symbols its system needs.
+func ParseCounterStyle(r parser.Rule) (*CounterStyle, []error) {
+	if err := checkRule(r, true, "counter-style"); err != nil {
+		return nil, []error{err}
+	}
+	prelude := parser.ComponentValues(r.Prelude)
+	if len(prelude) != 1 || !isCounterStyleName(prelude[0]) || counterStyleReserved[strings.ToLower(prelude[0][0].Value)] {
+		return nil, []error{errorf("bad counter style name %q", render(r.Prelude))}
+	}
+	c := &CounterStyle{Name: prelude[0][0].Value}
+	var errs []error
+	for _, d := range blockContents(r, &errs) {
+		var err error
+		cvs := parser.ComponentValues(d.Value)
+		switch strings.ToLower(d.Name) {
+		case "system":
+			err = c.parseSystem(d.Value)
+		case "symbols":
+			for _, cv := range cvs {
+				if !isSymbol(cv) {
+					err = errorf("bad symbol %q", render(cv))
+				}
+			}
+			if len(cvs) == 0 {
+				err = errorf("empty symbols")
+			}
+			if err == nil {
+				c.Symbols = cvs
+			}
+		case "additive-symbols":
+			var syms []AdditiveSymbol
+			syms, err = parseAdditiveSymbols(d.Value)
+			if err == nil {
+				c.AdditiveSymbols = syms
+			}
+		case "range":
+			var ranges []CounterRange
+			ranges, err = parseCounterRanges(d.Value)
+			if err == nil {
+				c.Range = ranges
+			}
+		case "pad":
+			var pad AdditiveSymbol
+			pad, err = parseWeightedSymbol(cvs)
+			if err == nil {
+				c.Pad = &CounterPad{pad.Weight, pad.Symbol}
+			} else {
+				err = errorf("bad pad %q", render(d.Value))
+			}
+		case "fallback":
+			if len(cvs) != 1 || !isCounterStyleName(cvs[0]) {
+				err = errorf("bad fallback %q", render(d.Value))
+			} else {
+				c.Fallback = cvs[0][0].Value
+			}
+		default:
+			c.Other = append(c.Other, d)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// the symbols each system needs
+	system := c.System
+	if system == "" {
+		system = "symbolic"
+	}
+	var bad bool
+	switch system {
+	case "cyclic", "fixed", "symbolic":
+		bad = len(c.Symbols) < 1
+	case "alphabetic", "numeric":
+		bad = len(c.Symbols) < 2
+	case "additive":
+		bad = len(c.AdditiveSymbols) < 1
+	case "extends":
+		if c.Symbols != nil || c.AdditiveSymbols != nil {
+			return nil, append(errs, errorf("@counter-style %s extends another style and cannot give symbols", c.Name))
+		}
+	}
+	if bad {
+		return nil, append(errs, errorf("@counter-style %s does not have enough symbols for the %s system", c.Name, system))
+	}
+	return c, errs
+}
+
+func (c *CounterStyle) parseSystem(toks []tokenizer.Token) error {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 0 || cvs[0][0].Type != tokenizer.TokenIdent || !counterSystems[strings.ToLower(cvs[0][0].Value)] {
+		return errorf("bad system %q", render(toks))
+	}
+	system := strings.ToLower(cvs[0][0].Value)
+	var first int64
+	var extends string
+	if system == "fixed" {
+		first = 1
+	}
+	switch {
+	case len(cvs) == 1 && system != "extends":
+	case len(cvs) == 2 && system == "fixed" && cvs[1][0].Type == tokenizer.TokenNumber:
+		var ok bool
+		if first, ok = cvs[1][0].Int(); !ok {
+			return errorf("bad system %q", render(toks))
+		}
+	case len(cvs) == 2 && system == "extends" && isCounterStyleName(cvs[1]):
+		extends = cvs[1][0].Value
+	default:
+		return errorf("bad system %q", render(toks))
+	}
+	c.System, c.FirstSymbol, c.Extends = system, first, extends
+	return nil
+}
+
+// isCounterStyleName reports whether cv is a <counter-style-name>: an
+// identifier other than none and the CSS-wide keywords.
+func isCounterStyleName(cv []tokenizer.Token) bool {
+	if len(cv) != 1 || cv[0].Type != tokenizer.TokenIdent {
+		return false
+	}
+	name := strings.ToLower(cv[0].Value)
+	return name != "none" && !reservedIdents[name]
+}
+
+// isSymbol reports whether cv is a <symbol>: a string, an identifier, or an
+// image.
+func isSymbol(cv []tokenizer.Token) bool {
+	switch cv[0].Type {
+	case tokenizer.TokenString, tokenizer.TokenIdent, tokenizer.TokenURI:
+		return len(cv) == 1
+	}
+	name, _, ok := function(cv)
+	return ok && (name == "url" || name == "image-set" || name == "image" || strings.HasSuffix(name, "-gradient"))
+}
+
+// parseWeightedSymbol parses a non-negative integer and a symbol, in either
+// order.
+func parseWeightedSymbol(cvs [][]tokenizer.Token) (AdditiveSymbol, error) {
+	var s AdditiveSymbol
+	if len(cvs) != 2 {
+		return s, errorf("expected an integer and a symbol")
+	}
+	if cvs[0][0].Type != tokenizer.TokenNumber {
+		cvs = [][]tokenizer.Token{cvs[1], cvs[0]}
+	}
+	w, ok := cvs[0][0].Int()
+	if cvs[0][0].Type != tokenizer.TokenNumber || !ok || w < 0 || !isSymbol(cvs[1]) {
+		return s, errorf("expected an integer and a symbol")
+	}
+	return AdditiveSymbol{w, cvs[1]}, nil
+}
+
+func parseAdditiveSymbols(toks []tokenizer.Token) ([]AdditiveSymbol, error) {
+	var syms []AdditiveSymbol
+	for _, part := range parser.SplitCommas(toks) {
+		s, err := parseWeightedSymbol(parser.ComponentValues(part))
+		if err != nil {
+			return nil, errorf("bad additive symbol %q", render(part))
+		}
+		if n := len(syms); n > 0 && s.Weight >= syms[n-1].Weight {
+			return nil, errorf("additive symbols must be in descending order of weight")
+		}
+		syms = append(syms, s)
+	}
+	if syms == nil {
+		return nil, errorf("empty additive-symbols")
+	}
+	return syms, nil
+}
+
+func parseCounterRanges(toks []tokenizer.Token) ([]CounterRange, error) {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 1 && cvs[0][0].MatchesIdent("auto") {
+		return nil, nil
+	}
+	var ranges []CounterRange
+	for _, part := range parser.SplitCommas(toks) {
+		cvs := parser.ComponentValues(part)
+		if len(cvs) != 2 {
+			return nil, errorf("bad range %q", render(part))
+		}
+		var bounds [2]int64
+		for i, cv := range cvs {
+			t := cv[0]
+			var ok bool
+			switch {
+			case t.MatchesIdent("infinite") && i == 0:
+				bounds[i], ok = math.MinInt64, true
+			case t.MatchesIdent("infinite"):
+				bounds[i], ok = math.MaxInt64, true
+			case t.Type == tokenizer.TokenNumber:
+				bounds[i], ok = t.Int()
+			}
+			if !ok || len(cv) != 1 {
+				return nil, errorf("bad range %q", render(part))
+			}
+		}
+		if bounds[0] > bounds[1] {
+			return nil, errorf("range %q is backwards", render(part))
+		}
+		ranges = append(ranges, CounterRange{bounds[0], bounds[1]})
+	}
+	if ranges == nil {
+		return nil, errorf("empty range")
+	}
+	return ranges, nil
+}
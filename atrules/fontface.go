@@ -0,0 +1,195 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// FontFace is a @font-face rule.
+type FontFace struct {
+	// Family is the name the font is declared under.
+	Family string
+	Src    []FontSource
+	// UnicodeRange holds the ranges of characters the font is used for.  It
+	// is empty if the rule does not restrict them.
+	UnicodeRange []UnicodeRange
+	// Display is the font-display keyword in lower case, or "" if it is not
+	// given.
+	Display string
+	// Other holds the other descriptors, such as font-weight, as written.
+	Other []parser.Declaration
+}
+
+// FontSource is one entry of the src descriptor of a @font-face rule.
+// Exactly one of URL and Local is set.
+type FontSource struct {
+	// URL is the URL of a font file given with url().
+	URL string
+	// Local is the full name of a font installed on the system, given with
+	// local().
+	Local string
+	// Format is the font format given with format(), such as "woff2", in
+	// lower case.
+	Format string
+	// Tech holds the font technologies given with tech(), such as
+	// "variations", in lower case.
+	Tech []string
+}
+
+// UnicodeRange is a range of code points, inclusive at both ends.
+type UnicodeRange struct {
+	Start, End rune
+}
+
+// Contains reports whether r is within u.
+func (u UnicodeRange) Contains(r rune) bool {
+	return u.Start <= r && r <= u.End
+}
+
+var fontDisplays = map[string]bool{
+	"auto": true, "block": true, "swap": true, "fallback": true, "optional": true,
+}
+
+// ParseFontFace parses a @font-face rule.  A rule without a valid
+// font-family and src is invalid.
+func ParseFontFace(r parser.Rule) (*FontFace, []error) {
+	if err := checkRule(r, true, "font-face"); err != nil {
+		return nil, []error{err}
+	}
+	f := &FontFace{}
+	var errs []error
+	for _, d := range blockContents(r, &errs) {
+		var err error
+		switch strings.ToLower(d.Name) {
+		case "font-family":
+			var fams []values.FontFamily
+			fams, err = values.ParseFontFamily(d.Value)
+			if err == nil && (len(fams) != 1 || fams[0].IsGeneric()) {
+				err = errorf("font-family in @font-face must be a single font name, got %q", render(d.Value))
+			}
+			if err == nil {
+				f.Family = fams[0].Name
+			}
+		case "src":
+			var src []FontSource
+			src, err = parseFontSources(d.Value, &errs)
+			if err == nil {
+				f.Src = src
+			}
+		case "unicode-range":
+			var ranges []UnicodeRange
+			ranges, err = parseUnicodeRanges(d.Value)
+			if err == nil {
+				f.UnicodeRange = ranges
+			}
+		case "font-display":
+			kw := parser.ComponentValues(d.Value)
+			if len(kw) != 1 || kw[0][0].Type != tokenizer.TokenIdent || !fontDisplays[strings.ToLower(kw[0][0].Value)] {
+				err = errorf("bad font-display %q", render(d.Value))
+			} else {
+				f.Display = strings.ToLower(kw[0][0].Value)
+			}
+		default:
+			f.Other = append(f.Other, d)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f.Family == "" || f.Src == nil {
+		return nil, append(errs, errorf("@font-face needs a font-family and a src"))
+	}
+	return f, errs
+}
+
+// parseFontSources parses the src descriptor.  Entries that are invalid or
+// use unknown functions are skipped, with an error each; the descriptor is
+// invalid only if no entry is left.
+func parseFontSources(toks []tokenizer.Token, errs *[]error) ([]FontSource, error) {
+	var src []FontSource
+	for _, part := range parser.SplitCommas(toks) {
+		s, err := parseFontSource(parser.ComponentValues(part))
+		if err != nil {
+			*errs = append(*errs, err)
+			continue
+		}
+		src = append(src, s)
+	}
+	if len(src) == 0 {
+		return nil, errorf("src has no usable entries")
+	}
+	return src, nil
+}
+
+func parseFontSource(cvs [][]tokenizer.Token) (FontSource, error) {
+	var s FontSource
+	if len(cvs) == 0 {
+		return s, errorf("empty src entry")
+	}
+	name, args, _ := function(cvs[0])
+	switch {
+	case cvs[0][0].Type == tokenizer.TokenURI:
+		s.URL = cvs[0][0].Value
+	case name == "url" && len(args) == 1 && args[0].Type == tokenizer.TokenString:
+		s.URL = args[0].Value
+	case name == "local":
+		fams, err := values.ParseFontFamily(args)
+		if err != nil || len(fams) != 1 || fams[0].IsGeneric() {
+			return s, errorf("bad local() font name %q", render(args))
+		}
+		s.Local = fams[0].Name
+		if len(cvs) > 1 {
+			return s, errorf("unexpected %q after local()", render(cvs[1]))
+		}
+		return s, nil
+	default:
+		return s, errorf("bad src entry %q", render(cvs[0]))
+	}
+	for _, cv := range cvs[1:] {
+		name, args, _ := function(cv)
+		items := parser.ComponentValues(args)
+		switch {
+		case name == "format" && s.Format == "" && s.Tech == nil:
+			if len(items) != 1 || items[0][0].Type != tokenizer.TokenString && items[0][0].Type != tokenizer.TokenIdent {
+				return s, errorf("bad format() %q", render(cv))
+			}
+			s.Format = strings.ToLower(items[0][0].Value)
+		case name == "tech" && s.Tech == nil:
+			for _, item := range parser.SplitCommas(args) {
+				if len(item) != 1 || item[0].Type != tokenizer.TokenIdent {
+					return s, errorf("bad tech() %q", render(cv))
+				}
+				s.Tech = append(s.Tech, strings.ToLower(item[0].Value))
+			}
+			if s.Tech == nil {
+				return s, errorf("empty tech()")
+			}
+		default:
+			return s, errorf("unexpected %q in src entry", render(cv))
+		}
+	}
+	return s, nil
+}
+
+func parseUnicodeRanges(toks []tokenizer.Token) ([]UnicodeRange, error) {
+	var ranges []UnicodeRange
+	for _, part := range parser.SplitCommas(toks) {
+		if len(part) != 1 || part[0].Type != tokenizer.TokenUnicodeRange {
+			return nil, errorf("bad unicode-range %q", render(part))
+		}
+		e, ok := part[0].Extra.(*tokenizer.TokenExtraUnicodeRange)
+		if !ok || e.Start > e.End || e.End > 0x10FFFF {
+			return nil, errorf("bad unicode-range %q", render(part))
+		}
+		ranges = append(ranges, UnicodeRange{e.Start, e.End})
+	}
+	if ranges == nil {
+		return nil, errorf("empty unicode-range")
+	}
+	return ranges, nil
+}
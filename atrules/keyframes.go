@@ -0,0 +1,147 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Keyframes is a @keyframes rule.
+type Keyframes struct {
+	// Name is the animation name, given as an identifier or a string.
+	Name   string
+	Frames []Keyframe
+}
+
+// Keyframe is one block of a @keyframes rule, with the declarations that
+// apply at each of its selectors.
+type Keyframe struct {
+	Selectors    []KeyframeSelector
+	Declarations []parser.Declaration
+}
+
+// KeyframeSelector is a position in an animation.
+type KeyframeSelector struct {
+	// Range is the name of a timeline range, such as entry, for a
+	// scroll-driven animation, or "".
+	Range string
+	// Percent is the position from 0 to 100; from is 0 and to is 100.
+	Percent float64
+}
+
+// isAnimationName reports whether name can be an unquoted animation name.
+func isAnimationName(name string) bool {
+	name = strings.ToLower(name)
+	return name != "none" && !reservedIdents[name]
+}
+
+// ParseKeyframes parses a @keyframes or @-webkit-keyframes rule.  Keyframes
+// with an invalid selector are skipped, as are !important declarations,
+// which are ignored in keyframes.
+func ParseKeyframes(r parser.Rule) (*Keyframes, []error) {
+	if err := checkRule(r, true, "keyframes", "-webkit-keyframes"); err != nil {
+		return nil, []error{err}
+	}
+	k := &Keyframes{}
+	name := r.Prelude
+	switch {
+	case len(name) == 1 && name[0].Type == tokenizer.TokenString:
+		k.Name = name[0].Value
+	case len(name) == 1 && name[0].Type == tokenizer.TokenIdent && isAnimationName(name[0].Value):
+		k.Name = name[0].Value
+	default:
+		return nil, []error{errorf("bad animation name %q", render(name))}
+	}
+
+	rules, perrs := parser.ParseRuleList(r.Block)
+	var errs []error
+	for _, e := range perrs {
+		errs = append(errs, e)
+	}
+	for _, fr := range rules {
+		if fr.AtKeyword != "" {
+			errs = append(errs, errorf("unexpected rule %q in @keyframes", ruleHead(fr)))
+			continue
+		}
+		sels, err := parseKeyframeSelectors(fr.Prelude)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f := Keyframe{Selectors: sels}
+		for _, d := range blockContents(fr, &errs) {
+			if d.Important {
+				errs = append(errs, errorf("!important is ignored in keyframes, on %q", d.Name))
+				continue
+			}
+			f.Declarations = append(f.Declarations, d)
+		}
+		k.Frames = append(k.Frames, f)
+	}
+	return k, errs
+}
+
+func parseKeyframeSelectors(prelude []tokenizer.Token) ([]KeyframeSelector, error) {
+	var sels []KeyframeSelector
+	for _, part := range parser.SplitCommas(prelude) {
+		cvs := parser.ComponentValues(part)
+		var s KeyframeSelector
+		if len(cvs) == 2 && cvs[0][0].Type == tokenizer.TokenIdent {
+			s.Range = strings.ToLower(cvs[0][0].Value)
+			cvs = cvs[1:]
+		}
+		if len(cvs) != 1 || len(cvs[0]) != 1 {
+			return nil, errorf("bad keyframe selector %q", render(part))
+		}
+		t := cvs[0][0]
+		switch {
+		case s.Range == "" && t.MatchesIdent("from"):
+			s.Percent = 0
+		case s.Range == "" && t.MatchesIdent("to"):
+			s.Percent = 100
+		case t.Type == tokenizer.TokenPercentage:
+			s.Percent, _ = t.Float()
+			if s.Percent < 0 || s.Percent > 100 {
+				return nil, errorf("keyframe selector %q is out of range", render(part))
+			}
+		default:
+			return nil, errorf("bad keyframe selector %q", render(part))
+		}
+		sels = append(sels, s)
+	}
+	return sels, nil
+}
+
+// String returns k as CSS source.
+func (k *Keyframes) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("@keyframes ")
+	if tokenizer.IsValidIdentifier(k.Name) && isAnimationName(k.Name) {
+		buf.WriteString(k.Name)
+	} else {
+		buf.WriteString(tokenizer.SerializeString(k.Name))
+	}
+	buf.WriteString(" {")
+	for _, f := range k.Frames {
+		buf.WriteByte(' ')
+		for i, s := range f.Selectors {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if s.Range != "" {
+				buf.WriteString(s.Range)
+				buf.WriteByte(' ')
+			}
+			p := tokenizer.NewPercentage(s.Percent)
+			buf.WriteString(p.Render())
+		}
+		buf.WriteByte(' ')
+		writeBlock(&buf, f.Declarations)
+	}
+	buf.WriteString(" }")
+	return buf.String()
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Layer is a @layer rule: either a statement declaring the order of
+// layers, such as "@layer base, theme.dark;", or a block of rules in a
+// layer.
+type Layer struct {
+	// Names holds the layer names, each split at its dots.  A block has one
+	// name, or none for an anonymous layer.
+	Names [][]string
+	// Rules are the rules in the block, or nil for a statement.
+	Rules []parser.Rule
+	// Block is set for a @layer rule with a block.
+	Block bool
+}
+
+// Import is an @import rule.
+type Import struct {
+	URL string
+	// Layer is set if the import is into a cascade layer.  LayerName is
+	// the name of the layer split at its dots, or nil for an anonymous
+	// layer.
+	Layer     bool
+	LayerName []string
+	// Supports holds the condition of supports(), or nil.
+	Supports []tokenizer.Token
+	// Media holds the media query list, or nil.
+	Media []tokenizer.Token
+}
+
+// ParseLayer parses a @layer rule.
+func ParseLayer(r parser.Rule) (*Layer, []error) {
+	if err := checkRule(r, false, "layer"); err != nil {
+		return nil, []error{err}
+	}
+	l := &Layer{Block: r.Block != nil}
+	for _, part := range parser.SplitCommas(r.Prelude) {
+		name, ok := parseLayerName(part)
+		if !ok {
+			return nil, []error{errorf("bad layer name %q", render(part))}
+		}
+		l.Names = append(l.Names, name)
+	}
+	if l.Block && len(l.Names) > 1 {
+		return nil, []error{errorf("@layer with a block takes one name, got %q", render(r.Prelude))}
+	}
+	if !l.Block && len(l.Names) == 0 {
+		return nil, []error{errorf("@layer without a block needs a name")}
+	}
+	var errs []error
+	if l.Block {
+		var perrs []*parser.Error
+		l.Rules, perrs = parser.ParseRuleList(r.Block)
+		for _, e := range perrs {
+			errs = append(errs, e)
+		}
+		if l.Rules == nil {
+			l.Rules = []parser.Rule{}
+		}
+	}
+	return l, errs
+}
+
+// parseLayerName parses a layer name, identifiers separated by dots with
+// no whitespace between them.
+func parseLayerName(toks []tokenizer.Token) ([]string, bool) {
+	var name []string
+	for i, t := range toks {
+		switch {
+		case i%2 == 0 && t.Type == tokenizer.TokenIdent && !reservedIdents[strings.ToLower(t.Value)]:
+			name = append(name, t.Value)
+		case i%2 == 1 && t.Type == tokenizer.TokenDelim && t.Value == ".":
+		default:
+			return nil, false
+		}
+	}
+	return name, len(toks)%2 == 1
+}
+
+// ParseImport parses an @import rule.
+func ParseImport(r parser.Rule) (*Import, []error) {
+	if err := checkRule(r, false, "import"); err != nil {
+		return nil, []error{err}
+	}
+	if r.Block != nil {
+		return nil, []error{errorf("@import cannot have a block")}
+	}
+	cvs := parser.ComponentValues(r.Prelude)
+	imp := &Import{}
+	if len(cvs) > 0 {
+		name, args, _ := function(cvs[0])
+		switch {
+		case cvs[0][0].Type == tokenizer.TokenString || cvs[0][0].Type == tokenizer.TokenURI:
+			imp.URL = cvs[0][0].Value
+		case name == "url" && len(args) == 1 && args[0].Type == tokenizer.TokenString:
+			imp.URL = args[0].Value
+		default:
+			cvs = nil
+		}
+	}
+	if cvs == nil {
+		return nil, []error{errorf("@import needs a URL, got %q", render(r.Prelude))}
+	}
+	cvs = cvs[1:]
+	if len(cvs) > 0 {
+		if cvs[0][0].MatchesIdent("layer") {
+			imp.Layer = true
+			cvs = cvs[1:]
+		} else if name, args, _ := function(cvs[0]); name == "layer" {
+			n, ok := parseLayerName(args)
+			if !ok {
+				return nil, []error{errorf("bad layer name %q in @import", render(args))}
+			}
+			imp.Layer, imp.LayerName = true, n
+			cvs = cvs[1:]
+		}
+	}
+	if len(cvs) > 0 {
+		if name, args, _ := function(cvs[0]); name == "supports" {
+			imp.Supports = args
+			cvs = cvs[1:]
+		}
+	}
+	if len(cvs) > 0 {
+		// the rest of the prelude, as written
+		first := &cvs[0][0]
+		for i := range r.Prelude {
+			if &r.Prelude[i] == first {
+				imp.Media = r.Prelude[i:]
+				break
+			}
+		}
+		for n := len(imp.Media); tokenizer.IsTrivia(imp.Media[n-1]); n-- {
+			imp.Media = imp.Media[:n-1]
+		}
+	}
+	return imp, nil
+}
+
+// LayerOrder returns the names of the cascade layers declared by rules, in
+// the order they are first declared, which is the order of precedence from
+// lowest to highest.  Names are joined with dots, and nested layers are
+// named with their full path, such as "base.reset".  Anonymous layers, and
+// the layers inside them, cannot be named and are left out.
+func LayerOrder(rules []parser.Rule) []string {
+	var order []string
+	seen := make(map[string]bool)
+	var walk func(rules []parser.Rule, prefix string)
+	add := func(prefix string, name []string) string {
+		full := prefix + strings.Join(name, ".")
+		if !seen[full] {
+			seen[full] = true
+			order = append(order, full)
+		}
+		return full
+	}
+	walk = func(rules []parser.Rule, prefix string) {
+		for _, r := range rules {
+			switch {
+			case tokenizer.IdentEquals(r.AtKeyword, "layer"):
+				l, _ := ParseLayer(r)
+				if l == nil {
+					continue
+				}
+				if !l.Block {
+					for _, name := range l.Names {
+						add(prefix, name)
+					}
+					continue
+				}
+				if len(l.Names) == 1 {
+					walk(l.Rules, add(prefix, l.Names[0])+".")
+				}
+			case tokenizer.IdentEquals(r.AtKeyword, "import"):
+				if imp, _ := ParseImport(r); imp != nil && imp.LayerName != nil {
+					add(prefix, imp.LayerName)
+				}
+			case r.Block != nil && (tokenizer.IdentEquals(r.AtKeyword, "media") || tokenizer.IdentEquals(r.AtKeyword, "supports")):
+				nested, _ := parser.ParseRuleList(r.Block)
+				walk(nested, prefix)
+			}
+		}
+	}
+	walk(rules, "")
+	return order
+}
+
+// String returns l as CSS source.
+func (l *Layer) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("@layer")
+	for i, name := range l.Names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte(' ')
+		writeLayerName(&buf, name)
+	}
+	if !l.Block {
+		buf.WriteByte(';')
+		return buf.String()
+	}
+	buf.WriteString(" {")
+	for _, r := range l.Rules {
+		buf.WriteByte(' ')
+		writeRule(&buf, r)
+	}
+	buf.WriteString(" }")
+	return buf.String()
+}
+
+// String returns imp as CSS source.
+func (imp *Import) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("@import ")
+	buf.WriteString(tokenizer.SerializeString(imp.URL))
+	if imp.Layer && imp.LayerName == nil {
+		buf.WriteString(" layer")
+	} else if imp.Layer {
+		buf.WriteString(" layer(")
+		writeLayerName(&buf, imp.LayerName)
+		buf.WriteByte(')')
+	}
+	if imp.Supports != nil {
+		buf.WriteString(" supports(")
+		tokenizer.RenderTokens(&buf, imp.Supports)
+		buf.WriteByte(')')
+	}
+	if imp.Media != nil {
+		buf.WriteByte(' ')
+		tokenizer.RenderTokens(&buf, imp.Media)
+	}
+	buf.WriteByte(';')
+	return buf.String()
+}
+
+func writeLayerName(buf *bytes.Buffer, name []string) {
+	for i, part := range name {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(tokenizer.SerializeIdentifier(part))
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Namespace is a @namespace rule.
+type Namespace struct {
+	// Prefix is the namespace prefix declared, or "" for the default
+	// namespace.  Prefixes are case-sensitive.
+	Prefix string
+	URL    string
+}
+
+// ParseNamespace parses a @namespace rule.
+func ParseNamespace(r parser.Rule) (*Namespace, []error) {
+	if err := checkRule(r, false, "namespace"); err != nil {
+		return nil, []error{err}
+	}
+	if r.Block != nil {
+		return nil, []error{errorf("@namespace cannot have a block")}
+	}
+	cvs := parser.ComponentValues(r.Prelude)
+	ns := &Namespace{}
+	if len(cvs) == 2 && cvs[0][0].Type == tokenizer.TokenIdent {
+		ns.Prefix = cvs[0][0].Value
+		cvs = cvs[1:]
+	}
+	if len(cvs) == 1 {
+		name, args, _ := function(cvs[0])
+		switch {
+		case cvs[0][0].Type == tokenizer.TokenString || cvs[0][0].Type == tokenizer.TokenURI:
+			ns.URL = cvs[0][0].Value
+			return ns, nil
+		case name == "url" && len(args) == 1 && args[0].Type == tokenizer.TokenString:
+			ns.URL = args[0].Value
+			return ns, nil
+		}
+	}
+	return nil, []error{errorf("bad @namespace %q", render(r.Prelude))}
+}
+
+// Namespaces returns the namespaces declared by the @namespace rules in
+// rules, the top-level rules of a stylesheet, keyed by prefix, with the
+// default namespace under "".  As in a browser, @namespace rules only count
+// before the first rule other than @charset, @import, and @layer
+// statements, and a later one for a prefix replaces an earlier one.
+func Namespaces(rules []parser.Rule) map[string]string {
+	namespaces := make(map[string]string)
+	for _, r := range rules {
+		switch {
+		case tokenizer.IdentEquals(r.AtKeyword, "namespace"):
+			if ns, _ := ParseNamespace(r); ns != nil {
+				namespaces[ns.Prefix] = ns.URL
+			}
+		case tokenizer.IdentEquals(r.AtKeyword, "charset"), tokenizer.IdentEquals(r.AtKeyword, "import"),
+			tokenizer.IdentEquals(r.AtKeyword, "layer") && r.Block == nil:
+		default:
+			return namespaces
+		}
+	}
+	return namespaces
+}
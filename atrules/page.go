@@ -0,0 +1,101 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Page is a @page rule.
+type Page struct {
+	// Selectors holds the page selectors, or is empty if the rule applies
+	// to all pages.
+	Selectors    []PageSelector
+	Declarations []parser.Declaration
+	// Margins holds the margin rules, such as @top-center, in order.
+	Margins []PageMargin
+}
+
+// PageSelector is a page selector, such as toc:first.
+type PageSelector struct {
+	// Name is the page type name, or "".
+	Name string
+	// PseudoClasses holds the page pseudo-classes, such as "first", in
+	// lower case.
+	PseudoClasses []string
+}
+
+// PageMargin is a margin rule in a @page rule.
+type PageMargin struct {
+	// Name is the margin box name in lower case, such as "top-center".
+	Name         string
+	Declarations []parser.Declaration
+}
+
+var pagePseudoClasses = map[string]bool{
+	"first": true, "left": true, "right": true, "blank": true,
+}
+
+var pageMargins = map[string]bool{
+	"top-left-corner": true, "top-left": true, "top-center": true, "top-right": true, "top-right-corner": true,
+	"bottom-left-corner": true, "bottom-left": true, "bottom-center": true, "bottom-right": true, "bottom-right-corner": true,
+	"left-top": true, "left-middle": true, "left-bottom": true,
+	"right-top": true, "right-middle": true, "right-bottom": true,
+}
+
+// ParsePage parses a @page rule.  A rule with an invalid selector is
+// invalid as a whole; unknown rules inside it are skipped.
+func ParsePage(r parser.Rule) (*Page, []error) {
+	if err := checkRule(r, true, "page"); err != nil {
+		return nil, []error{err}
+	}
+	p := &Page{}
+	for _, part := range parser.SplitCommas(r.Prelude) {
+		s, ok := parsePageSelector(part)
+		if !ok {
+			return nil, []error{errorf("bad page selector %q", render(part))}
+		}
+		p.Selectors = append(p.Selectors, s)
+	}
+
+	decls, rules, perrs := parser.ParseBlockContents(r.Block)
+	var errs []error
+	for _, e := range perrs {
+		errs = append(errs, e)
+	}
+	p.Declarations = decls
+	for _, m := range rules {
+		name := strings.ToLower(m.AtKeyword)
+		if !pageMargins[name] || len(parser.ComponentValues(m.Prelude)) != 0 || m.Block == nil {
+			errs = append(errs, errorf("unexpected rule %q in @page", ruleHead(m)))
+			continue
+		}
+		p.Margins = append(p.Margins, PageMargin{Name: name, Declarations: blockContents(m, &errs)})
+	}
+	return p, errs
+}
+
+// parsePageSelector parses a page name followed by pseudo-classes, with no
+// whitespace between them.
+func parsePageSelector(toks []tokenizer.Token) (PageSelector, bool) {
+	var s PageSelector
+	if len(toks) > 0 && toks[0].Type == tokenizer.TokenIdent {
+		s.Name = toks[0].Value
+		toks = toks[1:]
+	}
+	for len(toks) > 0 {
+		if len(toks) < 2 || toks[0].Type != tokenizer.TokenColon || toks[1].Type != tokenizer.TokenIdent {
+			return s, false
+		}
+		pc := strings.ToLower(toks[1].Value)
+		if !pagePseudoClasses[pc] {
+			return s, false
+		}
+		s.PseudoClasses = append(s.PseudoClasses, pc)
+		toks = toks[2:]
+	}
+	return s, s.Name != "" || s.PseudoClasses != nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// Property is a @property rule, which registers a custom property.
+type Property struct {
+	// Name is the custom property name, such as "--my-color".
+	Name     string
+	Syntax   *values.Syntax
+	Inherits bool
+	// InitialValue is the value of the initial-value descriptor, or nil if
+	// it is not given, which is only allowed for the syntax "*".
+	InitialValue []tokenizer.Token
+}
+
+// absoluteLengths are the length units that do not depend on the element
+// or the viewport.
+var absoluteLengths = map[string]bool{
+	"px": true, "cm": true, "mm": true, "q": true, "in": true, "pt": true, "pc": true,
+}
+
+// ParseProperty parses a @property rule.  As the specification requires,
+// the rule is invalid unless it has a valid syntax and inherits, and an
+// initial-value that matches the syntax and does not depend on the
+// element, such as 10px but not 1em.
+func ParseProperty(r parser.Rule) (*Property, []error) {
+	if err := checkRule(r, true, "property"); err != nil {
+		return nil, []error{err}
+	}
+	name, ok := customPropertyName(r.Prelude)
+	if !ok {
+		return nil, []error{errorf("bad custom property name %q in @property", render(r.Prelude))}
+	}
+	p := &Property{Name: name}
+	var errs []error
+	var haveInherits bool
+	for _, d := range blockContents(r, &errs) {
+		cvs := parser.ComponentValues(d.Value)
+		switch strings.ToLower(d.Name) {
+		case "syntax":
+			if len(cvs) != 1 || cvs[0][0].Type != tokenizer.TokenString {
+				errs = append(errs, errorf("syntax must be a string, got %q", render(d.Value)))
+				continue
+			}
+			syn, err := values.ParseSyntax(cvs[0][0].Value)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p.Syntax = syn
+		case "inherits":
+			if len(cvs) == 1 && cvs[0][0].MatchesIdent("true") {
+				p.Inherits, haveInherits = true, true
+			} else if len(cvs) == 1 && cvs[0][0].MatchesIdent("false") {
+				p.Inherits, haveInherits = false, true
+			} else {
+				errs = append(errs, errorf("inherits must be true or false, got %q", render(d.Value)))
+			}
+		case "initial-value":
+			p.InitialValue = d.Value
+		default:
+			errs = append(errs, errorf("unknown descriptor %q in @property", d.Name))
+		}
+	}
+	switch {
+	case p.Syntax == nil || !haveInherits:
+		errs = append(errs, errorf("@property %s needs a syntax and inherits", name))
+	case p.InitialValue == nil && !p.Syntax.Universal:
+		errs = append(errs, errorf("@property %s needs an initial-value", name))
+	case p.InitialValue != nil && !p.Syntax.Matches(p.InitialValue):
+		errs = append(errs, errorf("initial-value %q does not match syntax %q", render(p.InitialValue), p.Syntax.String()))
+	case p.InitialValue != nil && !p.Syntax.Universal && !independent(p.InitialValue):
+		errs = append(errs, errorf("initial-value %q depends on the element", render(p.InitialValue)))
+	default:
+		return p, errs
+	}
+	return nil, errs
+}
+
+// customPropertyName returns the custom property name that is the whole
+// of prelude.  The tokenizer reads a name like --x as a '-' delimiter and
+// the identifier -x, so both forms are accepted.
+func customPropertyName(prelude []tokenizer.Token) (string, bool) {
+	var toks []tokenizer.Token
+	for _, t := range prelude {
+		if !tokenizer.IsTrivia(t) {
+			toks = append(toks, t)
+		}
+	}
+	var name string
+	switch {
+	case len(toks) == 1 && toks[0].Type == tokenizer.TokenIdent:
+		name = toks[0].Value
+	case len(toks) == 2 && toks[0].Type == tokenizer.TokenDelim && toks[0].Value == "-" &&
+		toks[1].Type == tokenizer.TokenIdent && strings.HasPrefix(toks[1].Value, "-"):
+		name = "-" + toks[1].Value
+	}
+	return name, len(name) > 2 && strings.HasPrefix(name, "--")
+}
+
+// independent reports whether toks is computationally independent: it
+// uses no relative lengths and no var().
+func independent(toks []tokenizer.Token) bool {
+	for _, t := range toks {
+		switch t.Type {
+		case tokenizer.TokenFunction:
+			if tokenizer.IdentEquals(t.Value, "var") {
+				return false
+			}
+		case tokenizer.TokenDimension:
+			u := t.Extra.(*tokenizer.TokenExtraNumeric).Dimension
+			if tokenizer.ClassifyUnit(u).IsLength() && !absoluteLengths[strings.ToLower(u)] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Handler parses an at-rule, giving a value of its own type, or nil if the
+// rule is invalid as a whole, along with the errors for the parts skipped.
+type Handler func(r parser.Rule) (interface{}, []error)
+
+// Unknown is an at-rule with no handler.
+type Unknown struct {
+	// Rule is the rule as parsed, with its prelude and raw block.
+	Rule parser.Rule
+	// Prelude holds the component values of the prelude, so that it can be
+	// looked at without parsing it again.
+	Prelude [][]tokenizer.Token
+}
+
+// String returns the rule as it was written, apart from the whitespace
+// around the prelude.
+func (u *Unknown) String() string {
+	var buf bytes.Buffer
+	writeRule(&buf, u.Rule)
+	return buf.String()
+}
+
+// handlers holds the Handler for each at-rule name, in lower case.  The
+// Parse functions return typed nil pointers for invalid rules, which are
+// turned into nil interfaces here.
+var (
+	handlerMu sync.RWMutex
+	handlers  = map[string]Handler{
+		"container": func(r parser.Rule) (interface{}, []error) {
+			c, errs := ParseContainer(r)
+			if c == nil {
+				return nil, errs
+			}
+			return c, errs
+		},
+		"counter-style": func(r parser.Rule) (interface{}, []error) {
+			c, errs := ParseCounterStyle(r)
+			if c == nil {
+				return nil, errs
+			}
+			return c, errs
+		},
+		"font-face": func(r parser.Rule) (interface{}, []error) {
+			f, errs := ParseFontFace(r)
+			if f == nil {
+				return nil, errs
+			}
+			return f, errs
+		},
+		"keyframes":         parseKeyframes,
+		"-webkit-keyframes": parseKeyframes,
+		"layer": func(r parser.Rule) (interface{}, []error) {
+			l, errs := ParseLayer(r)
+			if l == nil {
+				return nil, errs
+			}
+			return l, errs
+		},
+		"import": func(r parser.Rule) (interface{}, []error) {
+			imp, errs := ParseImport(r)
+			if imp == nil {
+				return nil, errs
+			}
+			return imp, errs
+		},
+		"namespace": func(r parser.Rule) (interface{}, []error) {
+			ns, errs := ParseNamespace(r)
+			if ns == nil {
+				return nil, errs
+			}
+			return ns, errs
+		},
+		"page": func(r parser.Rule) (interface{}, []error) {
+			p, errs := ParsePage(r)
+			if p == nil {
+				return nil, errs
+			}
+			return p, errs
+		},
+		"property": func(r parser.Rule) (interface{}, []error) {
+			p, errs := ParseProperty(r)
+			if p == nil {
+				return nil, errs
+			}
+			return p, errs
+		},
+		"scope": func(r parser.Rule) (interface{}, []error) {
+			s, errs := ParseScope(r)
+			if s == nil {
+				return nil, errs
+			}
+			return s, errs
+		},
+	}
+)
+
+func parseKeyframes(r parser.Rule) (interface{}, []error) {
+	k, errs := ParseKeyframes(r)
+	if k == nil {
+		return nil, errs
+	}
+	return k, errs
+}
+
+// RegisterAtRule sets the handler for the named at-rule, replacing any
+// built-in one, so that rules such as those of a framework can be parsed
+// by Parse.  A nil handler makes the rule unknown again.
+func RegisterAtRule(name string, h Handler) {
+	handlerMu.Lock()
+	defer handlerMu.Unlock()
+	if h == nil {
+		delete(handlers, strings.ToLower(name))
+		return
+	}
+	handlers[strings.ToLower(name)] = h
+}
+
+// Parse parses the at-rule r with the handler for its name, which is one of
+// the Parse functions of this package, such as ParseFontFace, unless
+// another was registered with RegisterAtRule.  A rule with no handler gives
+// an *Unknown.
+func Parse(r parser.Rule) (interface{}, []error) {
+	if r.AtKeyword == "" {
+		return nil, []error{errorf("expected an at-rule, got %q", ruleHead(r))}
+	}
+	handlerMu.RLock()
+	h := handlers[strings.ToLower(r.AtKeyword)]
+	handlerMu.RUnlock()
+	if h == nil {
+		return &Unknown{Rule: r, Prelude: parser.ComponentValues(r.Prelude)}, nil
+	}
+	return h(r)
+}
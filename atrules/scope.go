@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package atrules
+
+import (
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Scope is a @scope rule, such as "@scope (.card) to (.content) { ... }".
+// Selectors are kept as tokens, which the selector package can parse.
+type Scope struct {
+	// Start holds the selectors of the scoping roots, or nil if the rule
+	// gives none, which makes the parent of the <style> element the root.
+	Start [][]tokenizer.Token
+	// End holds the selectors of the scoping limits, or nil.
+	End [][]tokenizer.Token
+
+	// Declarations are the declarations directly in the block, which apply
+	// to the scoping roots.
+	Declarations []parser.Declaration
+	Rules        []parser.Rule
+}
+
+// ParseScope parses a @scope rule.
+func ParseScope(r parser.Rule) (*Scope, []error) {
+	if err := checkRule(r, true, "scope"); err != nil {
+		return nil, []error{err}
+	}
+	s := &Scope{}
+	cvs := parser.ComponentValues(r.Prelude)
+	var ok bool
+	if len(cvs) > 0 && cvs[0][0].Type == tokenizer.TokenOpenParen {
+		if s.Start, ok = scopeSelectors(cvs[0]); !ok {
+			return nil, []error{errorf("bad scope start %q", render(cvs[0]))}
+		}
+		cvs = cvs[1:]
+	}
+	if len(cvs) == 2 && cvs[0][0].MatchesIdent("to") && cvs[1][0].Type == tokenizer.TokenOpenParen {
+		if s.End, ok = scopeSelectors(cvs[1]); !ok {
+			return nil, []error{errorf("bad scope end %q", render(cvs[1]))}
+		}
+		cvs = nil
+	}
+	if len(cvs) != 0 {
+		return nil, []error{errorf("bad @scope prelude %q", render(r.Prelude))}
+	}
+
+	decls, rules, perrs := parser.ParseBlockContents(r.Block)
+	var errs []error
+	for _, e := range perrs {
+		errs = append(errs, e)
+	}
+	s.Declarations, s.Rules = decls, rules
+	return s, errs
+}
+
+// scopeSelectors returns the selector list in the () block cv.
+func scopeSelectors(cv []tokenizer.Token) ([][]tokenizer.Token, bool) {
+	inner := cv[1:]
+	if n := len(inner); n > 0 && inner[n-1].Type == tokenizer.TokenCloseParen {
+		inner = inner[:n-1]
+	}
+	sels := parser.SplitCommas(inner)
+	for _, sel := range sels {
+		if len(sel) == 0 {
+			return nil, false
+		}
+	}
+	return sels, sels != nil
+}
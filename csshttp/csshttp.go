@@ -0,0 +1,190 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package csshttp provides net/http middleware that rewrites CSS responses on
+the fly using token transforms from the tokenizer package.
+
+	rewriteURLs := func(t tokenizer.Token) []tokenizer.Token {
+		if t.Type == tokenizer.TokenURI {
+			t.Value = cdnPrefix + t.Value
+		}
+		return []tokenizer.Token{t}
+	}
+	http.Handle("/static/", csshttp.Handler(fileServer, rewriteURLs))
+
+Only successful (200) responses with a Content-Type of text/css are
+rewritten; everything else passes through untouched.  CSS responses are
+buffered so that Content-Length can be set correctly for the rewritten body.
+Bodies compressed with gzip are decompressed, rewritten, and compressed
+again.
+
+The upstream validators describe the original body, not the rewritten one,
+so a rewritten response's ETag is made weak and its Last-Modified and
+Accept-Ranges headers are removed.  For the same reason, the Range and
+If-Range headers are removed from requests, so that h sends whole bodies,
+which can be rewritten, rather than parts of them.  HEAD responses get the same treatment,
+and lose their Content-Length, as the length of the rewritten body is not
+known without rewriting it.
+*/
+package csshttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Handler returns a handler that runs text/css responses from h through the
+// given token transforms.  Each token produced by one transform is passed
+// to the next, in order.  A transform returning nil drops the token.
+func Handler(h http.Handler, transforms ...func(tokenizer.Token) []tokenizer.Token) http.Handler {
+	fn := chain(transforms)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cw := &cssWriter{ResponseWriter: w, head: req.Method == "HEAD"}
+		h.ServeHTTP(cw, withoutRange(req))
+		cw.finish(fn)
+	})
+}
+
+// withoutRange returns req, or a copy of it without the headers asking
+// for part of the body.
+func withoutRange(req *http.Request) *http.Request {
+	if req.Header.Get("Range") == "" && req.Header.Get("If-Range") == "" {
+		return req
+	}
+	r := *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		if k != "Range" && k != "If-Range" {
+			r.Header[k] = v
+		}
+	}
+	return &r
+}
+
+func chain(transforms []func(tokenizer.Token) []tokenizer.Token) func(tokenizer.Token) []tokenizer.Token {
+	return func(t tokenizer.Token) []tokenizer.Token {
+		toks := []tokenizer.Token{t}
+		for _, fn := range transforms {
+			var next []tokenizer.Token
+			for _, t := range toks {
+				next = append(next, fn(t)...)
+			}
+			toks = next
+		}
+		return toks
+	}
+}
+
+// Rewrite runs the CSS in body through the transforms and returns the result.
+func Rewrite(body []byte, transforms ...func(tokenizer.Token) []tokenizer.Token) ([]byte, error) {
+	return ioutil.ReadAll(tokenizer.NewTransformReader(bytes.NewReader(body), chain(transforms)))
+}
+
+// cssWriter holds back text/css responses until the wrapped handler is done.
+type cssWriter struct {
+	http.ResponseWriter
+	head        bool // responding to a HEAD request
+	wroteHeader bool
+	status      int
+	css         bool
+	buf         bytes.Buffer
+}
+
+func isCSS(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mt == "text/css"
+}
+
+func (w *cssWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	if code == http.StatusOK && isCSS(w.Header().Get("Content-Type")) {
+		switch w.Header().Get("Content-Encoding") {
+		case "", "identity", "gzip":
+			w.dropValidators()
+			if w.head {
+				w.Header().Del("Content-Length")
+				break
+			}
+			w.css = true
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// dropValidators weakens or removes the headers that describe the exact
+// bytes of the original body.
+func (w *cssWriter) dropValidators() {
+	h := w.Header()
+	h.Del("Last-Modified")
+	h.Del("Accept-Ranges")
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+func (w *cssWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.css {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cssWriter) finish(fn func(tokenizer.Token) []tokenizer.Token) {
+	if !w.css {
+		return
+	}
+	out, err := w.rewrite(fn)
+	if err != nil {
+		// send the original response if it could not be rewritten
+		out = w.buf.Bytes()
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(out)
+}
+
+func (w *cssWriter) rewrite(fn func(tokenizer.Token) []tokenizer.Token) ([]byte, error) {
+	gzipped := w.Header().Get("Content-Encoding") == "gzip"
+
+	var in io.Reader = bytes.NewReader(w.buf.Bytes())
+	if gzipped {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		in = zr
+	}
+
+	var out bytes.Buffer
+	var dst io.Writer = &out
+	var zw *gzip.Writer
+	if gzipped {
+		zw = gzip.NewWriter(&out)
+		dst = zw
+	}
+	if _, err := io.Copy(dst, tokenizer.NewTransformReader(in, fn)); err != nil {
+		return nil, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
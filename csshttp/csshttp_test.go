@@ -0,0 +1,194 @@
+// Copyright 2018 Kane York.
+
+package csshttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func prefixURLs(t tokenizer.Token) []tokenizer.Token {
+	if t.Type == tokenizer.TokenURI {
+		t.Value = "/cdn/" + t.Value
+	}
+	return []tokenizer.Token{t}
+}
+
+func dropComments(t tokenizer.Token) []tokenizer.Token {
+	if t.Type == tokenizer.TokenComment {
+		return nil
+	}
+	return []tokenizer.Token{t}
+}
+
+const (
+	input  = "/* header */a{background:url(x.png)}"
+	output = `a{background:url("/cdn/x.png")}`
+)
+
+func serve(h http.Handler) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "/style.css", nil)
+	if err != nil {
+		panic(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(input)))
+		w.Write([]byte(input[:10]))
+		w.Write([]byte(input[10:]))
+	}), dropComments, prefixURLs)
+
+	rec := serve(h)
+	if got := rec.Body.String(); got != output {
+		t.Errorf("got %q, want %q", got, output)
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(output)) {
+		t.Errorf("Content-Length %s, want %d", got, len(output))
+	}
+}
+
+func TestHandlerGzip(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(input))
+		zw.Close()
+	}), dropComments, prefixURLs)
+
+	rec := serve(h)
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != output {
+		t.Errorf("got %q, want %q", got, output)
+	}
+}
+
+func TestHandlerPassThrough(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		status      int
+	}{
+		{"text/html", http.StatusOK},
+		{"text/css", http.StatusNotFound},
+		{"", http.StatusOK},
+	} {
+		h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.contentType != "" {
+				w.Header().Set("Content-Type", tc.contentType)
+			}
+			w.WriteHeader(tc.status)
+			w.Write([]byte(input))
+		}), dropComments)
+
+		rec := serve(h)
+		if rec.Code != tc.status || !bytes.Equal(rec.Body.Bytes(), []byte(input)) {
+			t.Errorf("%q %d: got %d %q", tc.contentType, tc.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRewriteIdentity(t *testing.T) {
+	identity := func(t tokenizer.Token) []tokenizer.Token { return []tokenizer.Token{t} }
+	for _, src := range []string{
+		`:root{--brand:#f00}a{color:var(--brand)}`,
+		`.card{--card-spacer-y:1rem;padding:var(--card-spacer-y) var(--card-spacer-x, 0)}`,
+		`@media (prefers-color-scheme:dark){:root{--bg:#000}}`,
+	} {
+		got, err := Rewrite([]byte(src), identity)
+		if err != nil || string(got) != src {
+			t.Errorf("Rewrite(%q) = %q, %v", src, got, err)
+		}
+	}
+}
+
+func TestHandlerValidators(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("Content-Length", strconv.Itoa(len(input)))
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Write([]byte(input))
+	}), prefixURLs)
+
+	for _, method := range []string{"GET", "HEAD"} {
+		req, err := http.NewRequest(method, "/style.css", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		hdr := rec.Header()
+		if got := hdr.Get("ETag"); got != `W/"abc"` {
+			t.Errorf("%s: ETag %q, want a weak ETag", method, got)
+		}
+		if got := hdr.Get("Last-Modified"); got != "" {
+			t.Errorf("%s: Last-Modified %q was kept", method, got)
+		}
+		if got := hdr.Get("Accept-Ranges"); got != "" {
+			t.Errorf("%s: Accept-Ranges %q was kept", method, got)
+		}
+		wantLength := ""
+		if method == "GET" {
+			out, _ := Rewrite([]byte(input), prefixURLs)
+			wantLength = strconv.Itoa(len(out))
+		}
+		if got := hdr.Get("Content-Length"); got != wantLength {
+			t.Errorf("%s: Content-Length %q, want %q", method, got, wantLength)
+		}
+	}
+}
+
+func TestHandlerRange(t *testing.T) {
+	modified := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("ETag", `"abc"`)
+		http.ServeContent(w, r, "style.css", modified, strings.NewReader(input))
+	}), prefixURLs)
+	want, _ := Rewrite([]byte(input), prefixURLs)
+
+	for _, ifRange := range []string{"", `"abc"`} {
+		req, err := http.NewRequest("GET", "/style.css", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=0-9")
+		if ifRange != "" {
+			req.Header.Set("If-Range", ifRange)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != string(want) {
+			t.Errorf("If-Range %q: got %d %q, want the whole rewritten body", ifRange, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Range"); got != "" {
+			t.Errorf("If-Range %q: Content-Range %q was sent", ifRange, got)
+		}
+		if req.Header.Get("Range") == "" {
+			t.Errorf("the caller's request was changed")
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package highlight classifies the tokens of a stylesheet for syntax
+highlighting.
+
+Classification uses a little parser context, so that an identifier is marked
+as a property name, a selector, or a value depending on where it appears:
+
+	for _, span := range highlight.Classify(src) {
+		fmt.Printf("%s: %q\n", span.Class, src[span.Start:span.End])
+	}
+
+WriteHTML wraps the classified spans in <span> elements for display in a web
+page.
+*/
+package highlight
+
+import (
+	"html"
+	"io"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Class is a highlighting class.
+type Class int
+
+const (
+	// Whitespace, and tokens that do not need highlighting.
+	None Class = iota
+	Comment
+	// Selectors of style rules.
+	Selector
+	// At-rule names, including the '@'.
+	AtRule
+	// Property names in declarations, including custom properties.
+	Property
+	// Keywords and other identifiers in declaration values and at-rule
+	// preludes.
+	Value
+	String
+	// Numbers, percentages, and dimensions.
+	Number
+	// Function names, including the '('.
+	Function
+	URL
+	// The "!important" annotation.
+	Important
+	// Braces, colons, semicolons, commas, parentheses, and other delimiters.
+	Punctuation
+	// Bad strings, bad urls, and bad escapes.
+	Error
+)
+
+var classNames = [...]string{
+	None:        "none",
+	Comment:     "comment",
+	Selector:    "selector",
+	AtRule:      "at-rule",
+	Property:    "property",
+	Value:       "value",
+	String:      "string",
+	Number:      "number",
+	Function:    "function",
+	URL:         "url",
+	Important:   "important",
+	Punctuation: "punctuation",
+	Error:       "error",
+}
+
+var classScopes = [...]string{
+	None:        "",
+	Comment:     "comment.block.css",
+	Selector:    "entity.name.selector.css",
+	AtRule:      "keyword.control.at-rule.css",
+	Property:    "support.type.property-name.css",
+	Value:       "support.constant.property-value.css",
+	String:      "string.quoted.double.css",
+	Number:      "constant.numeric.css",
+	Function:    "support.function.css",
+	URL:         "string.unquoted.url.css",
+	Important:   "keyword.other.important.css",
+	Punctuation: "punctuation.css",
+	Error:       "invalid.illegal.css",
+}
+
+// String returns a short lowercase name for the class, such as "property".
+func (c Class) String() string {
+	if c < 0 || int(c) >= len(classNames) {
+		return "unknown"
+	}
+	return classNames[c]
+}
+
+// Scope returns a TextMate-style scope name for the class, such as
+// "support.type.property-name.css".  None has an empty scope.
+func (c Class) Scope() string {
+	if c < 0 || int(c) >= len(classScopes) {
+		return ""
+	}
+	return classScopes[c]
+}
+
+// Span is a classified range of bytes in the source.
+type Span struct {
+	Start, End int
+	Class      Class
+}
+
+// At-rules whose blocks contain rules rather than declarations.
+var ruleListAtRules = []string{
+	"media",
+	"supports",
+	"document",
+	"-moz-document",
+	"layer",
+	"container",
+	"scope",
+	"starting-style",
+}
+
+func isRuleListAtRule(name string) bool {
+	for _, r := range ruleListAtRules {
+		if tokenizer.IdentEquals(name, r) {
+			return true
+		}
+	}
+	return false
+}
+
+type blockKind int
+
+const (
+	ruleList blockKind = iota
+	declarationList
+	// parentheses, brackets, and function arguments
+	simpleBlock
+)
+
+// Classify returns a span for every token of src that is not whitespace, in
+// order.  src is tokenized following CSS Syntax Level 4, so that custom
+// property names are single tokens.
+func Classify(src []byte) []Span {
+	doc := tokenizer.NewDocumentLevel(src, tokenizer.SyntaxLevel4)
+	return classify(doc.Tokens(), doc.Offsets(), len(src), ruleList)
+}
+
+// ClassifyDeclarations is like Classify, but treats src as the contents of a
+// style attribute: a list of declarations rather than a stylesheet.
+func ClassifyDeclarations(src []byte) []Span {
+	doc := tokenizer.NewDocumentLevel(src, tokenizer.SyntaxLevel4)
+	return classify(doc.Tokens(), doc.Offsets(), len(src), declarationList)
+}
+
+func classify(toks []tokenizer.Token, offsets []int, end int, top blockKind) []Span {
+	spans := make([]Span, 0, len(toks))
+	stack := []blockKind{top}
+
+	// what the tokens at the current position are part of
+	const (
+		ctxStart = iota // start of a rule or declaration
+		ctxSelector
+		ctxPrelude
+		ctxProperty
+		ctxValue
+	)
+	ctx := ctxStart
+	atRuleBlock := declarationList
+	important := false
+
+	for i, t := range toks {
+		tokEnd := end
+		if i+1 < len(offsets) {
+			tokEnd = offsets[i+1]
+		}
+		if t.Type == tokenizer.TokenS {
+			continue
+		}
+		if t.Type == tokenizer.TokenComment {
+			spans = append(spans, Span{offsets[i], tokEnd, Comment})
+			continue
+		}
+		top := stack[len(stack)-1]
+
+		if ctx == ctxStart {
+			switch {
+			case t.Type == tokenizer.TokenAtKeyword:
+				ctx = ctxPrelude
+				atRuleBlock = declarationList
+				if isRuleListAtRule(t.Value) {
+					atRuleBlock = ruleList
+				}
+			case t.Type == tokenizer.TokenSemicolon || t.Type == tokenizer.TokenCloseBrace:
+				// empty statement or end of block
+			case top == ruleList:
+				ctx = ctxSelector
+			case top == declarationList:
+				if startsNestedRule(toks[i:]) {
+					ctx = ctxSelector
+				} else {
+					ctx = ctxProperty
+				}
+			}
+		}
+
+		class := Punctuation
+		switch t.Type {
+		case tokenizer.TokenAtKeyword:
+			class = AtRule
+		case tokenizer.TokenIdent:
+			switch {
+			case important:
+				class = Important
+				important = false
+			case ctx == ctxSelector:
+				class = Selector
+			case ctx == ctxProperty:
+				class = Property
+			default:
+				class = Value
+			}
+		case tokenizer.TokenHash:
+			class = Value
+			if ctx == ctxSelector {
+				class = Selector
+			}
+		case tokenizer.TokenString:
+			class = String
+		case tokenizer.TokenNumber, tokenizer.TokenPercentage, tokenizer.TokenDimension,
+			tokenizer.TokenUnicodeRange:
+			class = Number
+		case tokenizer.TokenFunction:
+			class = Function
+			if ctx == ctxSelector {
+				class = Selector
+			}
+			stack = append(stack, simpleBlock)
+		case tokenizer.TokenURI:
+			class = URL
+		case tokenizer.TokenBadString, tokenizer.TokenBadURI, tokenizer.TokenBadEscape:
+			class = Error
+		case tokenizer.TokenDelim:
+			switch {
+			case ctx == ctxSelector && t.Value != ">" && t.Value != "+" && t.Value != "~":
+				// '.', '*', '&', and the like are part of the selector
+				class = Selector
+			case ctx == ctxValue && t.Value == "!" && nextIsImportant(toks[i+1:]):
+				class = Important
+				important = true
+			}
+		case tokenizer.TokenColon:
+			if ctx == ctxProperty && top == declarationList {
+				ctx = ctxValue
+			} else if ctx == ctxSelector {
+				class = Selector
+			}
+		case tokenizer.TokenOpenParen, tokenizer.TokenOpenBracket:
+			stack = append(stack, simpleBlock)
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket:
+			if top == simpleBlock {
+				stack = stack[:len(stack)-1]
+			}
+		case tokenizer.TokenOpenBrace:
+			switch {
+			case top == simpleBlock || ctx == ctxValue:
+				stack = append(stack, simpleBlock)
+			case ctx == ctxPrelude:
+				stack = append(stack, atRuleBlock)
+				ctx = ctxStart
+			default:
+				stack = append(stack, declarationList)
+				ctx = ctxStart
+			}
+		case tokenizer.TokenCloseBrace:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			if stack[len(stack)-1] != simpleBlock {
+				ctx = ctxStart
+			}
+		case tokenizer.TokenSemicolon:
+			if top != simpleBlock {
+				ctx = ctxStart
+			}
+		}
+
+		spans = append(spans, Span{offsets[i], tokEnd, class})
+	}
+	return spans
+}
+
+// startsNestedRule reports whether toks, at the start of an item in a
+// declaration list, is a nested style rule rather than a declaration: that
+// is, whether a '{' comes before the next ';' or '}'.
+func startsNestedRule(toks []tokenizer.Token) bool {
+	depth := 0
+	for _, t := range toks {
+		switch t.Type {
+		case tokenizer.TokenFunction, tokenizer.TokenOpenParen, tokenizer.TokenOpenBracket:
+			depth++
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket:
+			if depth > 0 {
+				depth--
+			}
+		case tokenizer.TokenOpenBrace:
+			if depth == 0 {
+				return true
+			}
+		case tokenizer.TokenSemicolon, tokenizer.TokenCloseBrace:
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// nextIsImportant reports whether the next significant token is the ident
+// "important".
+func nextIsImportant(toks []tokenizer.Token) bool {
+	for _, t := range toks {
+		switch t.Type {
+		case tokenizer.TokenS, tokenizer.TokenComment:
+			continue
+		}
+		return t.MatchesIdent("important")
+	}
+	return false
+}
+
+// WriteHTML writes src to w as HTML, with each classified span wrapped in a
+// <span class="css-CLASS"> element, where CLASS is the String of the span's
+// Class.  Whitespace and other unclassified text is escaped but not wrapped.
+func WriteHTML(w io.Writer, src []byte) error {
+	return writeHTML(w, src, Classify(src))
+}
+
+func writeHTML(w io.Writer, src []byte, spans []Span) error {
+	var err error
+	write := func(s string) {
+		if err == nil {
+			_, err = io.WriteString(w, s)
+		}
+	}
+	pos := 0
+	for _, sp := range spans {
+		write(html.EscapeString(string(src[pos:sp.Start])))
+		if sp.Class == None {
+			write(html.EscapeString(string(src[sp.Start:sp.End])))
+		} else {
+			write(`<span class="css-`)
+			write(sp.Class.String())
+			write(`">`)
+			write(html.EscapeString(string(src[sp.Start:sp.End])))
+			write("</span>")
+		}
+		pos = sp.End
+	}
+	write(html.EscapeString(string(src[pos:])))
+	return err
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Kane York.
+
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func describe(src string, spans []Span) string {
+	var parts []string
+	for _, sp := range spans {
+		parts = append(parts, fmt.Sprintf("%s:%s", sp.Class, src[sp.Start:sp.End]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{
+			`a.b, #c > d:hover { color: red !important; margin: 0 auto }`,
+			`selector:a selector:. selector:b punctuation:, selector:#c punctuation:> selector:d selector:: selector:hover ` +
+				`punctuation:{ property:color punctuation:: value:red important:! important:important punctuation:; ` +
+				`property:margin punctuation:: number:0 value:auto punctuation:}`,
+		},
+		{
+			`@media (min-width: 10px) { a { b: url(x) } }`,
+			`at-rule:@media punctuation:( value:min-width punctuation:: number:10px punctuation:) punctuation:{ ` +
+				`selector:a punctuation:{ property:b punctuation:: url:url(x) punctuation:} punctuation:}`,
+		},
+		{
+			`@MEDIA print { a { b: c } }`,
+			`at-rule:@MEDIA value:print punctuation:{ selector:a punctuation:{ property:b punctuation:: value:c punctuation:} punctuation:}`,
+		},
+		{
+			`@font-face { font-family: "X"; src: local(X) }`,
+			`at-rule:@font-face punctuation:{ property:font-family punctuation:: string:"X" punctuation:; ` +
+				`property:src punctuation:: function:local( value:X punctuation:) punctuation:}`,
+		},
+		{
+			`a { --x: calc(1px + 2%); &:hover { b: c } :not(.d) e { f: g } }`,
+			`selector:a punctuation:{ property:--x punctuation:: function:calc( number:1px punctuation:+ number:2% punctuation:) punctuation:; ` +
+				`selector:& selector:: selector:hover punctuation:{ property:b punctuation:: value:c punctuation:} ` +
+				`selector:: selector:not( selector:. selector:d punctuation:) selector:e punctuation:{ property:f punctuation:: value:g punctuation:} punctuation:}`,
+		},
+		{
+			"/* c */ a { b: \"x\n }",
+			`comment:/* c */ selector:a punctuation:{ property:b punctuation:: error:"x punctuation:}`,
+		},
+	} {
+		got := describe(tc.src, Classify([]byte(tc.src)))
+		if got != tc.want {
+			t.Errorf("Classify(%q):\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+	}
+
+	src := `color: blue; --a: 1`
+	got := describe(src, ClassifyDeclarations([]byte(src)))
+	want := `property:color punctuation:: value:blue punctuation:; property:--a punctuation:: number:1`
+	if got != want {
+		t.Errorf("ClassifyDeclarations(%q):\ngot  %s\nwant %s", src, got, want)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, []byte(`a > b { content: "<" }`)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<span class="css-selector">a</span> <span class="css-punctuation">&gt;</span> ` +
+		`<span class="css-selector">b</span> <span class="css-punctuation">{</span> ` +
+		`<span class="css-property">content</span><span class="css-punctuation">:</span> ` +
+		`<span class="css-string">&#34;&lt;&#34;</span> <span class="css-punctuation">}</span>`
+	if buf.String() != want {
+		t.Errorf("WriteHTML:\ngot  %s\nwant %s", buf.String(), want)
+	}
+	if Property.Scope() != "support.type.property-name.css" || None.Scope() != "" {
+		t.Errorf("Scope is wrong")
+	}
+}
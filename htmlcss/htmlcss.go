@@ -0,0 +1,125 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package htmlcss finds the CSS embedded in an HTML document and tokenizes it.
+
+Both <style> elements and style="" attributes are returned, along with the
+node they were found on, so that tools such as email CSS inliners can work
+on the CSS and then write it back into the document.
+
+	doc, err := html.Parse(r)
+	if err != nil {
+		return err
+	}
+	for _, src := range htmlcss.Extract(doc) {
+		// src.Node, src.Kind, src.Tokens...
+	}
+
+Element wraps an element of the document as a selector.Node, so that the
+rules found can be matched against it.
+*/
+package htmlcss
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Kind tells how the CSS in a Source should be parsed.
+type Kind int
+
+const (
+	// Stylesheet is the contents of a <style> element, to be parsed as a
+	// list of rules.
+	Stylesheet Kind = iota
+	// DeclarationList is the value of a style="" attribute, to be parsed as
+	// a list of declarations.
+	DeclarationList
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Stylesheet:
+		return "stylesheet"
+	case DeclarationList:
+		return "declaration list"
+	}
+	return "unknown"
+}
+
+// Source is a piece of CSS found in an HTML document.
+type Source struct {
+	Kind Kind
+	// The <style> element, or the element with the style attribute.
+	Node *html.Node
+	// Index of the style attribute in Node.Attr.  Only valid for
+	// DeclarationList.
+	AttrIndex int
+	// The CSS text.
+	Text string
+
+	Tokens      []tokenizer.Token
+	Diagnostics []tokenizer.Diagnostic
+}
+
+// Parse parses an HTML document from r and extracts its CSS.
+func Parse(r io.Reader) (*html.Node, []Source, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, Extract(doc), nil
+}
+
+// Extract walks the tree rooted at n and returns all of the CSS found in it,
+// in document order.
+func Extract(n *html.Node) []Source {
+	var srcs []Source
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Namespace == "" && a.Key == "style" {
+					srcs = append(srcs, newSource(DeclarationList, n, i, a.Val))
+				}
+			}
+			if n.DataAtom == atom.Style {
+				srcs = append(srcs, newSource(Stylesheet, n, -1, textContent(n)))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return srcs
+}
+
+func newSource(kind Kind, n *html.Node, attr int, text string) Source {
+	toks, diags := tokenizer.TokenizeAll([]byte(text), nil)
+	return Source{
+		Kind:        kind,
+		Node:        n,
+		AttrIndex:   attr,
+		Text:        text,
+		Tokens:      toks,
+		Diagnostics: diags,
+	}
+}
+
+// textContent returns the concatenated text children of n.  The HTML parser
+// treats the contents of <style> as raw text, so there is normally only one.
+func textContent(n *html.Node) string {
+	var buf bytes.Buffer
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			buf.WriteString(c.Data)
+		}
+	}
+	return buf.String()
+}
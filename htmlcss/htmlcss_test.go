@@ -0,0 +1,93 @@
+// Copyright 2018 Kane York.
+
+package htmlcss
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+const doc = `<!DOCTYPE html>
+<html><head>
+<style>p { color: red }</style>
+</head><body>
+<p style="margin: 0; content: 'x">text</p>
+<svg><style>circle { fill: blue }</style></svg>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	_, srcs, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind  Kind
+		tag   string
+		text  string
+		diags int
+	}{
+		{Stylesheet, "style", "p { color: red }", 0},
+		{DeclarationList, "p", "margin: 0; content: 'x", 0},
+		{Stylesheet, "style", "circle { fill: blue }", 0},
+	}
+	if len(srcs) != len(want) {
+		t.Fatalf("got %d sources, want %d", len(srcs), len(want))
+	}
+	for i, w := range want {
+		s := srcs[i]
+		if s.Kind != w.kind || s.Node.Data != w.tag || s.Text != w.text || len(s.Diagnostics) != w.diags {
+			t.Errorf("source %d: got %v <%s> %q %v", i, s.Kind, s.Node.Data, s.Text, s.Diagnostics)
+		}
+		if s.Kind == DeclarationList && s.Node.Attr[s.AttrIndex].Key != "style" {
+			t.Errorf("source %d: AttrIndex %d does not point at the style attribute", i, s.AttrIndex)
+		}
+		if len(s.Tokens) == 0 || s.Tokens[0].Type != tokenizer.TokenIdent {
+			t.Errorf("source %d: unexpected tokens %v", i, s.Tokens)
+		}
+	}
+}
+
+func TestElement(t *testing.T) {
+	root, _, err := Parse(strings.NewReader(`<html><body><p class=a>x</p> text <!-- c --><p id=b>y</p>` +
+		`<svg><a xlink:href="#c"><rect/></a></svg></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := func(src string) selector.List {
+		toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+		l, err := selector.ParseWithNamespaces(toks, map[string]string{
+			"svg": "http://www.w3.org/2000/svg", "xlink": "http://www.w3.org/1999/xlink", "html": selector.HTMLNamespace,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	var m selector.Matcher
+	doc := Element(root.FirstChild)
+	for _, tc := range []struct {
+		src  string
+		want int
+	}{
+		{`:root`, 0},
+		{`html:root > body > p`, 2},
+		{`p.a + p#b`, 1},
+		{`p:first-child, p:last-of-type`, 2},
+		{`svg|a[xlink|href="#c"] > svg|rect:only-child`, 1},
+		{`[href]`, 0},
+		{`[*|href]`, 1},
+		{`html|a`, 0},
+		{`html|p`, 2},
+		{`body :not(svg|*)`, 2},
+	} {
+		if got := len(m.QueryAll(doc, sel(tc.src))); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.src, got, tc.want)
+		}
+	}
+	if !m.Match(sel(`:root`), doc) || Element(root) != nil {
+		t.Errorf("the <html> element should be the root")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package htmlcss
+
+import (
+	"golang.org/x/net/html"
+
+	"github.com/riking/cssparse/selector"
+)
+
+// namespaceURLs are the namespace URLs for the short names that the HTML
+// parser gives elements and attributes in html.Node.Namespace.
+var namespaceURLs = map[string]string{
+	"":      selector.HTMLNamespace,
+	"svg":   "http://www.w3.org/2000/svg",
+	"math":  "http://www.w3.org/1998/Math/MathML",
+	"xlink": "http://www.w3.org/1999/xlink",
+	"xml":   "http://www.w3.org/XML/1998/namespace",
+	"xmlns": "http://www.w3.org/2000/xmlns/",
+}
+
+// Element returns the element n as a selector.NamespacedNode, for matching
+// selectors against the document.  Only elements count as its relatives,
+// so the <html> element has no parent and matches :root.
+func Element(n *html.Node) selector.Node {
+	if n == nil || n.Type != html.ElementNode {
+		return nil
+	}
+	return element{n}
+}
+
+type element struct {
+	n *html.Node
+}
+
+func (e element) TagName() string { return e.n.Data }
+
+func (e element) Attr(name string) (string, bool) {
+	return e.AttrNS("", name)
+}
+
+func (e element) Namespace() string { return namespaceURLs[e.n.Namespace] }
+
+func (e element) AttrNS(namespace, name string) (string, bool) {
+	for _, a := range e.n.Attr {
+		if a.Key != name {
+			continue
+		}
+		if namespace == "*" || a.Namespace == "" && namespace == "" ||
+			a.Namespace != "" && namespaceURLs[a.Namespace] == namespace {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func (e element) Parent() selector.Node { return Element(e.n.Parent) }
+
+func (e element) PrevSibling() selector.Node {
+	for c := e.n.PrevSibling; c != nil; c = c.PrevSibling {
+		if c.Type == html.ElementNode {
+			return element{c}
+		}
+	}
+	return nil
+}
+
+func (e element) NextSibling() selector.Node {
+	return nextElement(e.n.NextSibling)
+}
+
+func (e element) FirstChild() selector.Node {
+	return nextElement(e.n.FirstChild)
+}
+
+// nextElement returns the first element among c and its later siblings.
+func nextElement(c *html.Node) selector.Node {
+	for ; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			return element{c}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package inliner moves the CSS of an HTML document into the style attributes
+of the elements it applies to, as HTML email needs, since many mail clients
+ignore <style> elements.
+
+	doc, err := html.Parse(r)
+	if err != nil {
+		return err
+	}
+	errs := inliner.Inline(doc, nil, inliner.Options{KeepMediaQueries: true})
+	err = html.Render(w, doc)
+
+The style rules are matched against each element with selector.Matcher,
+and the declarations that win the cascade for it, as stylesheet.Cascade
+picks them from the rules that match and its own style attribute, are
+written back into that attribute.  So specificity, cascade layers, and
+!important are honored.  An !important declaration stays important, so
+that it still wins over the rules left in <style>.
+
+What cannot be inlined is left in a <style> element: the selectors using
+pseudo-elements, or pseudo-classes that depend on the user such as :hover,
+style rules with nested rules, and the at-rules other than @layer and
+@charset, such as @font-face.  The @media rules are kept too if
+Options.KeepMediaQueries is set, and dropped otherwise.
+*/
+package inliner
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/riking/cssparse/atrules"
+	"github.com/riking/cssparse/htmlcss"
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/stylesheet"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// Options says what Inline does with the rules it cannot inline.
+type Options struct {
+	// KeepMediaQueries keeps the @media rules in the <style> element left
+	// in the document, for the mail clients that support them.  Otherwise
+	// they are dropped.
+	KeepMediaQueries bool
+}
+
+// knownPseudoClasses are the pseudo-classes that selector.Matcher decides
+// from the document alone.
+var knownPseudoClasses = map[string]bool{
+	"is": true, "where": true, "not": true, "has": true, "root": true, "scope": true,
+	"first-child": true, "last-child": true, "only-child": true,
+	"first-of-type": true, "last-of-type": true, "only-of-type": true,
+	"nth-child": true, "nth-last-child": true, "nth-of-type": true, "nth-last-of-type": true,
+}
+
+// hidden are the elements that are not displayed, which are left alone
+// along with their children.
+var hidden = map[atom.Atom]bool{
+	atom.Head: true, atom.Style: true, atom.Script: true, atom.Template: true,
+}
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("inliner: "+format, args...)
+}
+
+func render(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	tokenizer.RenderTokens(&buf, toks)
+	return buf.String()
+}
+
+// Inline inlines sheets, followed by the <style> elements of doc, into the
+// style attributes of the elements of doc, and replaces the <style>
+// elements with one holding the rules that are left, if there are any.
+// <style> elements with a media attribute, and those inside <svg>, are
+// left alone.
+//
+// The errors are those from parsing the <style> elements, and for the
+// style rules whose selectors cannot be parsed, which are dropped as a
+// browser would drop them.
+func Inline(doc *html.Node, sheets []*stylesheet.Stylesheet, opts Options) []error {
+	c := &collector{opts: opts, seen: make(map[string]bool)}
+	kept := &stylesheet.Stylesheet{}
+	for _, s := range sheets {
+		kept.Rules = append(kept.Rules, c.collect(s.Rules, s.Namespaces(), "")...)
+	}
+	var styles []*html.Node
+	for _, src := range htmlcss.Extract(doc) {
+		if src.Kind != htmlcss.Stylesheet || src.Node.Namespace != "" || hasAttr(src.Node, "media") {
+			continue
+		}
+		s, errs := stylesheet.Parse(src.Tokens)
+		c.errs = append(c.errs, errs...)
+		kept.Rules = append(kept.Rules, c.collect(s.Rules, s.Namespaces(), "")...)
+		styles = append(styles, src.Node)
+	}
+
+	var m selector.Matcher
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if hidden[n.DataAtom] {
+				return
+			}
+			c.inline(&m, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	var keep *html.Node
+	if len(kept.Rules) > 0 {
+		keep = &html.Node{Type: html.ElementNode, DataAtom: atom.Style, Data: "style"}
+		keep.AppendChild(&html.Node{Type: html.TextNode, Data: kept.String()})
+		switch head := find(doc, atom.Head); {
+		case len(styles) > 0:
+			styles[0].Parent.InsertBefore(keep, styles[0])
+		case head != nil:
+			head.AppendChild(keep)
+		default:
+			doc.InsertBefore(keep, doc.FirstChild)
+		}
+	}
+	for _, n := range styles {
+		n.Parent.RemoveChild(n)
+	}
+	return c.errs
+}
+
+// rule is a style rule to inline.
+type rule struct {
+	selectors    selector.List
+	declarations []parser.Declaration
+	layer        string
+}
+
+// collector gathers the rules to inline from stylesheets.
+type collector struct {
+	opts   Options
+	rules  []rule
+	layers []string
+	seen   map[string]bool
+	anon   int
+	errs   []error
+}
+
+// collect adds the style rules in rules that can be inlined, in the named
+// cascade layer, and returns the rules to keep in <style>.
+func (c *collector) collect(rules []*stylesheet.Rule, namespaces map[string]string, layer string) []*stylesheet.Rule {
+	var kept []*stylesheet.Rule
+	for _, r := range rules {
+		switch {
+		case r.AtKeyword == "" && len(r.Rules) > 0:
+			kept = append(kept, r)
+		case r.AtKeyword == "":
+			l, err := selector.ParseWithNamespaces(r.Prelude, namespaces)
+			if err != nil {
+				c.errs = append(c.errs, errorf("dropped %q: %v", render(r.Prelude), err))
+				continue
+			}
+			var inline, rest selector.List
+			for _, sel := range l {
+				if inlinable(sel) {
+					inline = append(inline, sel)
+				} else {
+					rest = append(rest, sel)
+				}
+			}
+			if len(inline) > 0 {
+				c.rules = append(c.rules, rule{inline, r.Declarations, layer})
+			}
+			if len(rest) > 0 {
+				k := r.Clone()
+				k.Prelude, _ = tokenizer.TokenizeAll([]byte(rest.String()), nil)
+				kept = append(kept, k)
+			}
+		case tokenizer.IdentEquals(r.AtKeyword, "layer"):
+			pr := parser.Rule{AtKeyword: r.AtKeyword, Prelude: r.Prelude}
+			if r.Block {
+				pr.Block = []tokenizer.Token{}
+			}
+			l, _ := atrules.ParseLayer(pr)
+			switch {
+			case l == nil:
+			case !l.Block:
+				for _, name := range l.Names {
+					c.addLayer(layer, name)
+				}
+			default:
+				var full string
+				if len(l.Names) == 1 {
+					full = c.addLayer(layer, l.Names[0])
+				} else {
+					// no name can have a space in it
+					c.anon++
+					full = c.addLayer(layer, []string{" " + strconv.Itoa(c.anon)})
+				}
+				if nested := c.collect(r.Rules, namespaces, full); len(nested) > 0 {
+					k := *r
+					k.Rules = nested
+					kept = append(kept, &k)
+				}
+			}
+		case tokenizer.IdentEquals(r.AtKeyword, "charset"):
+		case tokenizer.IdentEquals(r.AtKeyword, "media"):
+			if c.opts.KeepMediaQueries {
+				kept = append(kept, r)
+			}
+		default:
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// addLayer adds the layer named name inside the layer parent to the order
+// of layers, if it is not there yet, and returns its full name.
+func (c *collector) addLayer(parent string, name []string) string {
+	full := strings.Join(name, ".")
+	if parent != "" {
+		full = parent + "." + full
+	}
+	if !c.seen[full] {
+		c.seen[full] = true
+		c.layers = append(c.layers, full)
+	}
+	return full
+}
+
+// inlinable reports whether sel can be matched against the document
+// alone, without pseudo-elements or pseudo-classes such as :hover.
+func inlinable(sel *selector.Complex) bool {
+	for _, cp := range sel.Compounds {
+		for _, s := range cp.Simples {
+			switch {
+			case s.Kind == selector.PseudoElement:
+				return false
+			case s.Kind == selector.PseudoClass && !knownPseudoClasses[s.Name]:
+				return false
+			}
+			for _, arg := range s.Args {
+				if !inlinable(arg) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// inline sets the style attribute of n to the declarations that win the
+// cascade for it, if any rules match it.
+func (c *collector) inline(m *selector.Matcher, n *html.Node) {
+	el := htmlcss.Element(n)
+	e := stylesheet.Element{Layers: c.layers}
+	for i, r := range c.rules {
+		var spec [3]int
+		matched := false
+		for _, sel := range r.selectors {
+			if m.MatchComplex(sel, el) {
+				if s := sel.Specificity(); !matched || less(spec, s) {
+					spec = s
+				}
+				matched = true
+			}
+		}
+		if matched {
+			e.Matches = append(e.Matches, stylesheet.Match{Declarations: r.declarations, Specificity: spec, Layer: r.layer, Order: i})
+		}
+	}
+	if len(e.Matches) == 0 {
+		return
+	}
+	style := -1
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == "style" {
+			style = i
+			toks, _ := tokenizer.TokenizeAll([]byte(a.Val), nil)
+			e.Inline, _, _ = parser.ParseBlockContents(toks)
+		}
+	}
+	decls := winners(e)
+	if len(decls) == 0 {
+		return
+	}
+	value := stylesheet.SerializeDeclarations(decls, stylesheet.SerializeOptions{})
+	if style < 0 {
+		n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: value})
+	} else {
+		n.Attr[style].Val = value
+	}
+}
+
+// winners returns the declarations that win the cascade for e, in the
+// order of the rules they come from, followed by those of the style
+// attribute.  A shorthand is kept whole if every longhand it sets wins with
+// the value it gives.
+func winners(e stylesheet.Element) []parser.Declaration {
+	won := stylesheet.Cascade(e)
+	done := make(map[string]bool)
+	var out []parser.Declaration
+	add := func(decls []parser.Declaration) {
+		for _, d := range decls {
+			longhands, err := values.ExpandShorthand(d)
+			if err != nil {
+				longhands = []parser.Declaration{d}
+			}
+			// the longhands that win with the value d gives them
+			var wins []parser.Declaration
+			for _, l := range longhands {
+				key := propertyKey(l.Name)
+				if w, ok := won[key]; ok && !done[key] && w.Important == l.Important && tokenizer.TokensEqual(w.Value, l.Value) {
+					wins = append(wins, w)
+					done[key] = true
+				}
+			}
+			if len(longhands) > 1 && len(wins) == len(longhands) {
+				out = append(out, d)
+			} else {
+				out = append(out, wins...)
+			}
+		}
+	}
+	for _, m := range e.Matches {
+		add(m.Declarations)
+	}
+	add(e.Inline)
+	return out
+}
+
+// propertyKey returns the key of a property in the map Cascade returns.
+func propertyKey(name string) string {
+	if strings.HasPrefix(name, "--") {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+func less(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the first element under n with the tag a, or nil.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
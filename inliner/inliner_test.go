@@ -0,0 +1,86 @@
+// Copyright 2018 Kane York.
+
+package inliner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"github.com/riking/cssparse/stylesheet"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func inline(t *testing.T, src string, sheets []*stylesheet.Stylesheet, opts Options) (string, []error) {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := Inline(doc, sheets, opts)
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), errs
+}
+
+func TestInline(t *testing.T) {
+	src := `<html><head><title>t</title><style>
+@charset "utf-8";
+@layer base, theme;
+p { color: red; margin: 0 }
+.x { color: blue !important }
+#y { color: green; padding: 1px 2px }
+@layer theme { p { font-weight: bold } }
+@layer base { p { font-weight: normal; text-align: left } }
+p:hover, em { color: pink }
+a::before { content: "a" }
+@media (max-width: 600px) { p { color: black !important } }
+@font-face { font-family: F; src: url(f.woff) }
+b! { color: red }
+</style><style media="print">p { color: black }</style></head>` +
+		`<body><p class=x id=y style="color: gray; padding-left: 3px; --V: { a }">a</p><p>b <em>c</em></p><div>d</div></body></html>`
+	got, errs := inline(t, src, nil, Options{KeepMediaQueries: true})
+	if len(errs) != 1 {
+		t.Errorf("got %v", errs)
+	}
+	want := `<html><head><title>t</title><style>p:hover { color: pink; }
+a::before { content: "a"; }
+@media (max-width: 600px) { p { color: black !important; } }
+@font-face { font-family: F; src: url("f.woff"); }
+</style><style media="print">p { color: black }</style></head>` +
+		`<body><p class="x" id="y" style="margin: 0; color: blue !important; padding-top: 1px; padding-right: 2px; ` +
+		`padding-bottom: 1px; font-weight: bold; text-align: left; padding-left: 3px; --V: { a }">a</p>` +
+		`<p style="color: red; margin: 0; font-weight: bold; text-align: left">b <em style="color: pink">c</em></p>` +
+		`<div>d</div></body></html>`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got, _ = inline(t, src, nil, Options{})
+	if strings.Contains(got, "@media") {
+		t.Errorf("@media kept:\n%s", got)
+	}
+}
+
+func TestInlineSheets(t *testing.T) {
+	toks, _ := tokenizer.TokenizeAll([]byte(`td { padding: 0 } a:hover { color: red }`), nil)
+	sheet, _ := stylesheet.Parse(toks)
+	got, errs := inline(t, `<table><tr><td style="padding: 1px">x</td><td>y</td></tr></table>`, []*stylesheet.Stylesheet{sheet}, Options{})
+	if len(errs) != 0 {
+		t.Errorf("got %v", errs)
+	}
+	want := `<html><head><style>a:hover { color: red; }
+</style></head><body><table><tbody><tr><td style="padding: 1px">x</td><td style="padding: 0">y</td></tr></tbody></table></body></html>`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got, _ = inline(t, `<p>x</p><style>p { color: red }</style>`, nil, Options{})
+	want = `<html><head></head><body><p style="color: red">x</p></body></html>`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
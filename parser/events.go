@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package parser
+
+import "github.com/riking/cssparse/tokenizer"
+
+// Handler is the functions ParseEvents calls as it parses, any of which
+// may be nil.  The tokens they are given are slices of the parsed tokens,
+// and the indexes are those in the parsed slice, as in ParseStylesheet.
+type Handler struct {
+	// OnRuleStart is called at each qualified rule, such as a style rule,
+	// before the contents of its block.
+	OnRuleStart func(prelude []tokenizer.Token, index int)
+	// OnAtRule is called at each at-rule, before the contents of its block
+	// if it has one.
+	OnAtRule func(name string, prelude []tokenizer.Token, block bool, index int)
+	// OnBlockEnd is called after the contents of the block of each rule,
+	// so that OnRuleStart and OnAtRule can be matched with it to track the
+	// enclosing rules.
+	OnBlockEnd func()
+	// OnDeclaration is called at each declaration, in the order of the
+	// declarations and rules of the block.
+	OnDeclaration func(d Declaration)
+	// OnError is called at each error, as it is found.
+	OnError func(e *Error)
+}
+
+// ParseEvents parses toks as a stylesheet, as ParseStylesheet does, and
+// calls the functions of h for each rule, declaration, and error instead
+// of returning them, so nothing but the rule being parsed is kept, for
+// scanning stylesheets too big to hold as a tree.  The block of each rule
+// is parsed as ParseBlockContents parses it, so a declaration in the block
+// of an at-rule such as @media is reported as one, as in CSS Nesting.
+func ParseEvents(toks []tokenizer.Token, h *Handler) {
+	p := newParser(toks)
+	p.onError = h.error(0)
+	p.consumeRules(true, func(r Rule) { h.rule(r, 0) })
+}
+
+func (h *Handler) error(base int) func(e *Error) {
+	return func(e *Error) {
+		if h.OnError != nil {
+			e.Index += base
+			h.OnError(e)
+		}
+	}
+}
+
+// rule calls the functions of h for r and its block, whose indexes are
+// offset by base.
+func (h *Handler) rule(r Rule, base int) {
+	if r.AtKeyword != "" {
+		if h.OnAtRule != nil {
+			h.OnAtRule(r.AtKeyword, r.Prelude, r.Block != nil, r.Index+base)
+		}
+	} else if h.OnRuleStart != nil {
+		h.OnRuleStart(r.Prelude, r.Index+base)
+	}
+	if r.Block == nil {
+		return
+	}
+	base += r.BlockIndex
+	// an unclosed block was reported by the parser of the enclosing one
+	p := &parser{toks: r.Block, reportedEOF: true, onError: h.error(base)}
+	p.consumeBlockContents(func(d Declaration) {
+		if h.OnDeclaration != nil {
+			d.Index += base
+			h.OnDeclaration(d)
+		}
+	}, func(r Rule) { h.rule(r, base) })
+	if h.OnBlockEnd != nil {
+		h.OnBlockEnd()
+	}
+}
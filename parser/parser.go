@@ -0,0 +1,461 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package parser groups the tokens of a stylesheet into rules and
+declarations, following the parsing algorithms of section 5 of the CSS
+Syntax specification, including its error recovery.  A malformed
+declaration or rule is skipped up to the next semicolon or the end of the
+enclosing block, with brackets balanced, and parsing carries on after it, so
+that one mistake does not take the rest of the stylesheet with it.  Each
+error is reported along with the tokens that were skipped.
+
+	toks, _ := tokenizer.TokenizeAll(src, nil)
+	rules, errs := parser.ParseStylesheet(toks)
+	for _, r := range rules {
+		decls, nested, errs := parser.ParseBlockContents(r.Block)
+		...
+	}
+
+The parser only groups tokens.  Preludes, blocks, and declaration values are
+left as slices of the input for the caller to interpret, so that nothing is
+lost when they are rendered again.  Comments are treated as whitespace.
+
+ParseEvents parses a stylesheet and the blocks of its rules without building
+them into slices, calling a function for each rule, declaration, and error
+instead.
+*/
+package parser
+
+import "github.com/riking/cssparse/tokenizer"
+
+// Rule is an at-rule or a qualified rule, such as a style rule.
+type Rule struct {
+	// AtKeyword is the name of an at-rule, without the '@'.  It is empty
+	// for a qualified rule.
+	AtKeyword string
+	// Prelude is the part of the rule before its block, or before the
+	// semicolon ending an at-rule without a block, with whitespace and
+	// comments at either end removed.
+	Prelude []tokenizer.Token
+	// Block is the contents of the rule's {} block, not including the
+	// braces.  It is nil if the rule has no block.
+	Block []tokenizer.Token
+	// Index is the index in the parsed slice of the rule's first token,
+	// and BlockIndex the index of the first token of Block.
+	Index, BlockIndex int
+}
+
+// Declaration is a property declaration, such as "color: red !important".
+type Declaration struct {
+	// Name is the property name as written, without case folding.  The
+	// Level 3 tokenizer reads a custom property name such as "--x" as a '-'
+	// delim and an identifier; the two are joined back together here.
+	Name string
+	// Value is the tokens after the colon, with whitespace and comments at
+	// either end and the !important annotation removed.
+	Value     []tokenizer.Token
+	Important bool
+	// Index is the index in the parsed slice of the property name.
+	Index int
+}
+
+// Error is a parse error.  The parser recovers from every error; Skipped
+// holds the tokens that were thrown away to do so, if any.
+type Error struct {
+	Message string
+	// Index is the index in the parsed slice of the first skipped token, or
+	// of the token where the error was found if none were skipped.
+	Index   int
+	Skipped []tokenizer.Token
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ParseStylesheet parses toks as a stylesheet.  CDO and CDC tokens at the
+// top level are ignored.  The input ends at the first TokenEOF or
+// TokenError, if there is one.
+func ParseStylesheet(toks []tokenizer.Token) ([]Rule, []*Error) {
+	p := newParser(toks)
+	var rules []Rule
+	p.consumeRules(true, func(r Rule) { rules = append(rules, r) })
+	return rules, p.errs
+}
+
+// ParseRuleList parses toks as the contents of a block that holds rules,
+// such as that of @media.
+func ParseRuleList(toks []tokenizer.Token) ([]Rule, []*Error) {
+	p := newParser(toks)
+	var rules []Rule
+	p.consumeRules(false, func(r Rule) { rules = append(rules, r) })
+	return rules, p.errs
+}
+
+// ParseBlockContents parses toks as the contents of a block that holds
+// declarations, such as that of a style rule or @font-face, or the value of
+// an HTML style attribute.  As in CSS Nesting, the block may also hold
+// at-rules and nested style rules; anything that starts with an identifier
+// and a colon is a declaration, unless its value contains a {} block.  The
+// Index fields of the results give their order in the block.
+func ParseBlockContents(toks []tokenizer.Token) ([]Declaration, []Rule, []*Error) {
+	p := newParser(toks)
+	var decls []Declaration
+	var rules []Rule
+	p.consumeBlockContents(func(d Declaration) { decls = append(decls, d) }, func(r Rule) { rules = append(rules, r) })
+	return decls, rules, p.errs
+}
+
+// ParseDeclaration parses all of toks as a single declaration, such as the
+// condition in "@supports (display: grid)".
+func ParseDeclaration(toks []tokenizer.Token) (Declaration, error) {
+	p := newParser(toks)
+	i := p.skipTrivia(0)
+	if i == len(p.toks) || (p.toks[i].Type != tokenizer.TokenIdent && !isSplitCustomProperty(p.toks[i:])) {
+		return Declaration{}, &Error{Message: "expected a property name", Index: i}
+	}
+	d, ok := p.declaration(i, len(p.toks))
+	if !ok {
+		return Declaration{}, &Error{Message: "expected a ':' after the property name", Index: i}
+	}
+	return d, nil
+}
+
+type parser struct {
+	toks []tokenizer.Token
+	errs []*Error
+	// onError, if set, is called with each error instead of adding it to
+	// errs.
+	onError func(e *Error)
+	// whether an unclosed block at the end of input was reported; blocks
+	// can be skipped more than once while backtracking
+	reportedEOF bool
+}
+
+func newParser(toks []tokenizer.Token) *parser {
+	for i, t := range toks {
+		if t.Type == tokenizer.TokenEOF || t.Type == tokenizer.TokenError {
+			toks = toks[:i]
+			break
+		}
+	}
+	return &parser{toks: toks}
+}
+
+// error records e.
+func (p *parser) error(e *Error) {
+	if p.onError != nil {
+		p.onError(e)
+		return
+	}
+	p.errs = append(p.errs, e)
+}
+
+// skip records an error for the tokens [start, end) being thrown away.
+func (p *parser) skip(start, end int, msg string) {
+	e := &Error{Message: msg, Index: start}
+	if end > start {
+		e.Skipped = p.toks[start:end]
+	}
+	p.error(e)
+}
+
+func (p *parser) skipTrivia(i int) int {
+	for i < len(p.toks) && tokenizer.IsTrivia(p.toks[i]) {
+		i++
+	}
+	return i
+}
+
+// closer returns the token type that ends the block or function started by
+// tt, if it starts one.
+func closer(tt tokenizer.TokenType) (tokenizer.TokenType, bool) {
+	switch tt {
+	case tokenizer.TokenOpenBrace:
+		return tokenizer.TokenCloseBrace, true
+	case tokenizer.TokenOpenBracket:
+		return tokenizer.TokenCloseBracket, true
+	case tokenizer.TokenOpenParen, tokenizer.TokenFunction:
+		return tokenizer.TokenCloseParen, true
+	}
+	return 0, false
+}
+
+// skipValue returns the index just past the component value starting at i:
+// a single token, or a block or function with everything nested in it.
+// Inside a block, only the matching bracket closes it; other closing
+// brackets are ordinary tokens.  closed is false if the input ends first.
+func (p *parser) skipValue(i int) (end int, closed bool) {
+	c, ok := closer(p.toks[i].Type)
+	if !ok {
+		return i + 1, true
+	}
+	// the closing brackets still expected, innermost last
+	stack := []tokenizer.TokenType{c}
+	for j := i + 1; j < len(p.toks); j++ {
+		tt := p.toks[j].Type
+		if tt == stack[len(stack)-1] {
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return j + 1, true
+			}
+		} else if c, ok := closer(tt); ok {
+			stack = append(stack, c)
+		}
+	}
+	if !p.reportedEOF {
+		p.reportedEOF = true
+		p.error(&Error{Message: "unclosed block at end of input", Index: i})
+	}
+	return len(p.toks), false
+}
+
+// block returns the contents of the {} block from open to end.
+func (p *parser) block(open, end int, closed bool) []tokenizer.Token {
+	if closed {
+		end--
+	}
+	return p.toks[open+1 : end]
+}
+
+func trim(toks []tokenizer.Token) []tokenizer.Token {
+	for len(toks) > 0 && tokenizer.IsTrivia(toks[0]) {
+		toks = toks[1:]
+	}
+	for len(toks) > 0 && tokenizer.IsTrivia(toks[len(toks)-1]) {
+		toks = toks[:len(toks)-1]
+	}
+	return toks
+}
+
+// consumeRules is "consume a list of rules", calling rule with each rule.
+func (p *parser) consumeRules(top bool, rule func(r Rule)) {
+	i := 0
+	for i < len(p.toks) {
+		t := p.toks[i]
+		switch {
+		case tokenizer.IsTrivia(t):
+			i++
+		case top && (t.Type == tokenizer.TokenCDO || t.Type == tokenizer.TokenCDC):
+			i++
+		case t.Type == tokenizer.TokenAtKeyword:
+			var r Rule
+			r, i = p.consumeAtRule(i)
+			rule(r)
+		default:
+			var r Rule
+			var ok bool
+			r, i, ok = p.consumeQualifiedRule(i, false)
+			if ok {
+				rule(r)
+			}
+		}
+	}
+}
+
+// consumeAtRule is "consume an at-rule", starting at the at-keyword.
+func (p *parser) consumeAtRule(i int) (Rule, int) {
+	r := Rule{AtKeyword: p.toks[i].Value, Index: i}
+	start := i + 1
+	j := start
+	for j < len(p.toks) {
+		switch p.toks[j].Type {
+		case tokenizer.TokenSemicolon:
+			r.Prelude = trim(p.toks[start:j])
+			return r, j + 1
+		case tokenizer.TokenOpenBrace:
+			end, closed := p.skipValue(j)
+			r.Prelude = trim(p.toks[start:j])
+			r.Block, r.BlockIndex = p.block(j, end, closed), j+1
+			return r, end
+		}
+		j, _ = p.skipValue(j)
+	}
+	// The rule is kept, as the spec says, but the missing ';' is worth
+	// pointing out.
+	p.error(&Error{Message: "at-rule not terminated before end of input", Index: i})
+	r.Prelude = trim(p.toks[start:])
+	return r, j
+}
+
+// consumeQualifiedRule is "consume a qualified rule".  In a block of
+// declarations (nested), a semicolon before the block means the tokens were
+// a bad declaration instead.  ok is false if no rule was found, in which
+// case the tokens up to the returned index were skipped.
+func (p *parser) consumeQualifiedRule(i int, nested bool) (r Rule, next int, ok bool) {
+	j := i
+	for j < len(p.toks) {
+		switch p.toks[j].Type {
+		case tokenizer.TokenOpenBrace:
+			end, closed := p.skipValue(j)
+			r = Rule{
+				Prelude:    trim(p.toks[i:j]),
+				Block:      p.block(j, end, closed),
+				Index:      i,
+				BlockIndex: j + 1,
+			}
+			return r, end, true
+		case tokenizer.TokenSemicolon:
+			if nested {
+				p.skip(i, j+1, "invalid declaration")
+				return Rule{}, j + 1, false
+			}
+		}
+		j, _ = p.skipValue(j)
+	}
+	if nested {
+		p.skip(i, j, "invalid declaration")
+	} else {
+		p.skip(i, j, "rule has no block")
+	}
+	return Rule{}, j, false
+}
+
+// consumeBlockContents is "consume a block's contents", calling decl and
+// rule with each declaration and rule.
+func (p *parser) consumeBlockContents(decl func(d Declaration), rule func(r Rule)) {
+	i := 0
+	for i < len(p.toks) {
+		t := p.toks[i]
+		switch {
+		case tokenizer.IsTrivia(t) || t.Type == tokenizer.TokenSemicolon:
+			i++
+			continue
+		case t.Type == tokenizer.TokenAtKeyword:
+			var r Rule
+			r, i = p.consumeAtRule(i)
+			rule(r)
+			continue
+		case t.Type == tokenizer.TokenIdent || isSplitCustomProperty(p.toks[i:]):
+			end := i
+			for end < len(p.toks) && p.toks[end].Type != tokenizer.TokenSemicolon {
+				end, _ = p.skipValue(end)
+			}
+			if d, ok := p.declaration(i, end); ok {
+				decl(d)
+				i = end
+				continue
+			}
+		}
+		r, next, ok := p.consumeQualifiedRule(i, true)
+		if ok {
+			rule(r)
+		}
+		i = next
+	}
+}
+
+// declaration interprets the tokens [i, end) as a declaration, if they are
+// one: a name, a colon, and a value.  A value with a {} block in it makes
+// the tokens the start of a nested rule instead, such as "a:hover {}",
+// unless the name is a custom property or the block is the whole value.
+func (p *parser) declaration(i, end int) (Declaration, bool) {
+	d := Declaration{Name: p.toks[i].Value, Index: i}
+	next := i + 1
+	if isSplitCustomProperty(p.toks[i:end]) {
+		d.Name = "-" + p.toks[i+1].Value
+		next++
+	}
+	colon := p.skipTrivia(next)
+	if colon >= end || p.toks[colon].Type != tokenizer.TokenColon {
+		return d, false
+	}
+	value := trim(p.toks[colon+1 : end])
+	if !isCustomProperty(d.Name) && hasBlock(value) && !isWholeBlock(value) {
+		return d, false
+	}
+	if n := len(value); n >= 2 {
+		bang := n - 2
+		for bang > 0 && tokenizer.IsTrivia(value[bang]) {
+			bang--
+		}
+		if value[n-1].MatchesIdent("important") && value[bang].Type == tokenizer.TokenDelim && value[bang].Value == "!" {
+			d.Important = true
+			value = trim(value[:bang])
+		}
+	}
+	d.Value = value
+	return d, true
+}
+
+// isSplitCustomProperty reports whether toks starts with a custom property
+// name as the Level 3 tokenizer reads it: a '-' delim and an identifier
+// starting with '-'.
+func isSplitCustomProperty(toks []tokenizer.Token) bool {
+	return len(toks) >= 2 && toks[0].Type == tokenizer.TokenDelim && toks[0].Value == "-" &&
+		toks[1].Type == tokenizer.TokenIdent && toks[1].Value[0] == '-'
+}
+
+func isCustomProperty(name string) bool {
+	return len(name) > 2 && name[0] == '-' && name[1] == '-'
+}
+
+// hasBlock reports whether there is a {} block at the top level of toks.
+func hasBlock(toks []tokenizer.Token) bool {
+	depth := 0
+	for _, t := range toks {
+		switch t.Type {
+		case tokenizer.TokenFunction, tokenizer.TokenOpenParen, tokenizer.TokenOpenBracket:
+			depth++
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket:
+			if depth > 0 {
+				depth--
+			}
+		case tokenizer.TokenOpenBrace:
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWholeBlock reports whether toks is a single {} block.
+func isWholeBlock(toks []tokenizer.Token) bool {
+	if len(toks) == 0 || toks[0].Type != tokenizer.TokenOpenBrace {
+		return false
+	}
+	p := parser{toks: toks, reportedEOF: true}
+	end, _ := p.skipValue(0)
+	return end == len(toks)
+}
+
+// ComponentValues splits toks into component values, as in "parse a list of
+// component values": single tokens, and blocks and functions together with
+// everything in them, including the closing token.  Whitespace and comments
+// between component values are dropped.  An unclosed block or function runs
+// to the end of toks.
+func ComponentValues(toks []tokenizer.Token) [][]tokenizer.Token {
+	p := parser{toks: toks, reportedEOF: true}
+	var out [][]tokenizer.Token
+	for i := p.skipTrivia(0); i < len(toks); i = p.skipTrivia(i) {
+		end, _ := p.skipValue(i)
+		out = append(out, toks[i:end])
+		i = end
+	}
+	return out
+}
+
+// SplitCommas splits toks at the commas that are not inside a block or
+// function, as in "parse a comma-separated list of component values".  The
+// parts are trimmed of whitespace and comments.  Empty input gives no parts,
+// but a trailing comma gives an empty last part.
+func SplitCommas(toks []tokenizer.Token) [][]tokenizer.Token {
+	if len(trim(toks)) == 0 {
+		return nil
+	}
+	p := parser{toks: toks, reportedEOF: true}
+	var out [][]tokenizer.Token
+	start := 0
+	for i := 0; i < len(toks); {
+		if toks[i].Type == tokenizer.TokenComma {
+			out = append(out, trim(toks[start:i]))
+			i++
+			start = i
+			continue
+		}
+		i, _ = p.skipValue(i)
+	}
+	return append(out, trim(toks[start:]))
+}
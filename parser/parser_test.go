@@ -0,0 +1,273 @@
+// Copyright 2018 Kane York.
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func tokenize(src string) []tokenizer.Token {
+	toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+	return toks
+}
+
+func render(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	tokenizer.RenderTokens(&buf, toks)
+	return buf.String()
+}
+
+// describe summarizes rules, declarations, and errors on one line each.
+func describe(decls []Declaration, rules []Rule, errs []*Error) string {
+	var lines []string
+	for _, d := range decls {
+		s := fmt.Sprintf("%d decl %s=%s", d.Index, d.Name, render(d.Value))
+		if d.Important {
+			s += " !"
+		}
+		lines = append(lines, s)
+	}
+	for _, r := range rules {
+		s := fmt.Sprintf("%d rule", r.Index)
+		if r.AtKeyword != "" {
+			s += " @" + r.AtKeyword
+		}
+		s += " [" + render(r.Prelude) + "]"
+		if r.Block != nil {
+			s += " {" + render(r.Block) + "}"
+		}
+		lines = append(lines, s)
+	}
+	for _, e := range errs {
+		lines = append(lines, fmt.Sprintf("%d error %s [%s]", e.Index, e.Message, render(e.Skipped)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseStylesheet(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{
+			`a { b: c } @import "x"; @media print { d {} }`,
+			"0 rule [a] { b: c }\n" +
+				"11 rule @import [\"x\"]\n" +
+				"16 rule @media [print] { d {} }",
+		},
+		{
+			`<!-- a {} -->`,
+			"2 rule [a] {}",
+		},
+		// A semicolon does not end a qualified rule at the top level; the
+		// whole thing is one bad selector.
+		{
+			`a; b {} c {}`,
+			"0 rule [a; b] {}\n" +
+				"8 rule [c] {}",
+		},
+		// Brackets are balanced when looking for the block.
+		{
+			`a[x="{"] { } b {}`,
+			"0 rule [a[x=\"{\"]] { }\n" +
+				"11 rule [b] {}",
+		},
+		{
+			`a {} b`,
+			"0 rule [a] {}\n" +
+				"5 error rule has no block [b]",
+		},
+		{
+			`a { b: (c }`,
+			"0 rule [a] { b: (c }}\n" +
+				"2 error unclosed block at end of input []",
+		},
+		{
+			`@import "x"`,
+			"0 rule @import [\"x\"]\n" +
+				"0 error at-rule not terminated before end of input []",
+		},
+		// A close brace only ends the block it matches.
+		{
+			`a { b: [ } ] } c {}`,
+			"0 rule [a] { b: [ } ] }\n" +
+				"15 rule [c] {}",
+		},
+	} {
+		rules, errs := ParseStylesheet(tokenize(tc.src))
+		if got := describe(nil, rules, errs); got != tc.want {
+			t.Errorf("%q:\ngot:\n%s\nwant:\n%s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestParseBlockContents(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{
+			`color: red; margin : 0 auto !IMPORTANT ;; --x: { a: b }`,
+			"0 decl color=red\n" +
+				"6 decl margin=0 auto !\n" +
+				"20 decl --x={ a: b }",
+		},
+		// Recovery skips to the next semicolon, keeping brackets balanced.
+		{
+			`color red; width: 1px; 5px: x; height: calc(1px; 2px); top: 0`,
+			"5 decl width=1px\n" +
+				"17 decl height=calc(1px; 2px)\n" +
+				"28 decl top=0\n" +
+				"0 error invalid declaration [color red;]\n" +
+				"11 error invalid declaration [5px: x;]",
+		},
+		// Nesting: a value with a block in it is a rule.
+		{
+			`color: red; a:hover { color: blue } & > b { } @media print { c: d }`,
+			"0 decl color=red\n" +
+				"6 rule [a:hover] { color: blue }\n" +
+				"19 rule [& > b] { }\n" +
+				"29 rule @media [print] { c: d }",
+		},
+		{
+			`a: b !important`,
+			"0 decl a=b !",
+		},
+		{
+			`a: ! important x`,
+			"0 decl a=! important x",
+		},
+		{
+			`a:`,
+			"0 decl a=",
+		},
+		{
+			`a { b: c`,
+			"0 rule [a] { b: c}\n" +
+				"2 error unclosed block at end of input []",
+		},
+	} {
+		decls, rules, errs := ParseBlockContents(tokenize(tc.src))
+		if got := describe(decls, rules, errs); got != tc.want {
+			t.Errorf("%q:\ngot:\n%s\nwant:\n%s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestParseRuleList(t *testing.T) {
+	rules, errs := ParseStylesheet(tokenize(`@media screen { <!-- a { b: c } @page { margin: 0 } }`))
+	if len(rules) != 1 || len(errs) != 0 {
+		t.Fatalf("got %d rules, %v", len(rules), errs)
+	}
+	inner, errs := ParseRuleList(rules[0].Block)
+	got := describe(nil, inner, errs)
+	// CDO is only skipped at the top level.
+	want := "1 rule [<!-- a] { b: c }\n" +
+		"14 rule @page [] { margin: 0 }"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if b := inner[1].BlockIndex; rules[0].Block[b-1].Type != tokenizer.TokenOpenBrace {
+		t.Errorf("BlockIndex %d does not follow a '{'", b)
+	}
+}
+
+func TestParseDeclaration(t *testing.T) {
+	d, err := ParseDeclaration(tokenize(` display : grid ; x `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "display" || render(d.Value) != "grid ; x" {
+		t.Errorf("got %s: %q", d.Name, render(d.Value))
+	}
+	for _, src := range []string{``, `1px`, `a b`} {
+		if _, err := ParseDeclaration(tokenize(src)); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}
+
+func TestStopsAtEOF(t *testing.T) {
+	toks := append(tokenize(`a {}`), tokenizer.Token{Type: tokenizer.TokenEOF}, tokenizer.NewIdent("b"))
+	rules, errs := ParseStylesheet(toks)
+	if len(rules) != 1 || len(errs) != 0 {
+		t.Errorf("got %d rules, %v", len(rules), errs)
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	toks := tokenize(`@import "x"; a { b: c; 5px; d { e: f } } @media print { g: h; i { j: k !important } } l { m: n`)
+	var events []string
+	ParseEvents(toks, &Handler{
+		OnRuleStart: func(prelude []tokenizer.Token, index int) {
+			events = append(events, fmt.Sprintf("%d rule [%s]", index, render(prelude)))
+		},
+		OnAtRule: func(name string, prelude []tokenizer.Token, block bool, index int) {
+			events = append(events, fmt.Sprintf("%d @%s [%s] %v", index, name, render(prelude), block))
+		},
+		OnBlockEnd: func() { events = append(events, "end") },
+		OnDeclaration: func(d Declaration) {
+			events = append(events, fmt.Sprintf("%d decl %s=%s %v", d.Index, d.Name, render(d.Value), d.Important))
+		},
+		OnError: func(e *Error) {
+			events = append(events, fmt.Sprintf("%d error %s [%s]", e.Index, e.Message, render(e.Skipped)))
+		},
+	})
+	want := []string{
+		`0 @import ["x"] false`,
+		"5 rule [a]",
+		"9 decl b=c false",
+		"15 error invalid declaration [5px;]",
+		"18 rule [d]",
+		"22 decl e=f false",
+		"end",
+		"end",
+		"31 @media [print] true",
+		"37 decl g=h false",
+		"43 rule [i]",
+		"47 decl j=k true",
+		"end",
+		"end",
+		"61 error unclosed block at end of input []",
+		"59 rule [l]",
+		"63 decl m=n false",
+		"end",
+	}
+	if got := strings.Join(events, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+	for _, ev := range events {
+		if ev == "end" {
+			continue
+		}
+		// Every index is that of the first token of what was reported.
+		var i int
+		fmt.Sscan(ev, &i)
+		if tokenizer.IsTrivia(toks[i]) {
+			t.Errorf("%s: index of whitespace", ev)
+		}
+	}
+}
+
+func TestComponentValues(t *testing.T) {
+	var got []string
+	for _, cv := range ComponentValues(tokenize(` a /**/ f(b, (c)) [d] {e`)) {
+		got = append(got, render(cv))
+	}
+	if s := strings.Join(got, "|"); s != "a|f(b, (c))|[d]|{e" {
+		t.Errorf("got %q", s)
+	}
+	got = nil
+	for _, part := range SplitCommas(tokenize(`a, f(b, c) d ,[e,f],`)) {
+		got = append(got, render(part))
+	}
+	if s := strings.Join(got, "|"); s != "a|f(b, c) d|[e,f]|" {
+		t.Errorf("got %q", s)
+	}
+	if parts := SplitCommas(tokenize(` `)); parts != nil {
+		t.Errorf("got %q for empty input", parts)
+	}
+}
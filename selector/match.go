@@ -0,0 +1,370 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package selector
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Node is an element of a document.  Methods that return a Node must
+// return a nil interface, not a nil pointer, when there is no such element.
+// Nodes are compared with ==, so an implementation should use pointers or
+// other values that are equal only for the same element.
+type Node interface {
+	// TagName returns the element's name, such as "div".
+	TagName() string
+	// Attr returns the value of the named attribute, given in lowercase,
+	// and whether the element has it.
+	Attr(name string) (string, bool)
+	// Parent returns the parent element, or nil for the root.
+	Parent() Node
+	// PrevSibling and NextSibling return the element siblings next to the
+	// element, skipping any text and comments, or nil if there are none.
+	PrevSibling() Node
+	NextSibling() Node
+	// FirstChild returns the first child element, or nil if there are
+	// none.
+	FirstChild() Node
+}
+
+// HTMLNamespace is the namespace of HTML elements, which a Node that is not
+// a NamespacedNode is taken to be in.
+const HTMLNamespace = "http://www.w3.org/1999/xhtml"
+
+// NamespacedNode is a Node that knows the namespaces of the element and its
+// attributes, such as an element of an XML document or an SVG element in
+// HTML.  The elements of a plain Node are in HTMLNamespace and their
+// attributes in no namespace.
+type NamespacedNode interface {
+	Node
+	// Namespace returns the namespace URL of the element.
+	Namespace() string
+	// AttrNS is Attr for an attribute in the given namespace, "" for none
+	// or "*" for any.
+	AttrNS(namespace, name string) (string, bool)
+}
+
+// Matcher matches selectors against nodes.  The zero Matcher is ready to
+// use.
+//
+// A Matcher knows the structural pseudo-classes, such as :nth-child(), and
+// the logical ones, :is(), :where(), :not(), and :has().  Others, such as
+// :hover, are decided by PseudoClass.  Pseudo-elements are ignored, so
+// that "a::before" matches the elements whose ::before it styles.
+//
+// Attribute values are compared case-sensitively, apart from those of the
+// HTML attributes that a browser compares case-insensitively, such as
+// type and lang, unless a selector's 'i' or 's' flag says otherwise.
+type Matcher struct {
+	// Scope is the element that :scope and & match.  If it is nil, they
+	// match the root.
+	Scope Node
+	// PseudoClass, if set, reports whether n matches the named pseudo-class
+	// that the Matcher does not know, given the arguments of a functional
+	// one.  Without it, such pseudo-classes never match.
+	PseudoClass func(n Node, name string, args []tokenizer.Token) bool
+}
+
+// Match reports whether n matches any selector in l.
+func (m *Matcher) Match(l List, n Node) bool {
+	for _, c := range l {
+		if m.MatchComplex(c, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchComplex reports whether n matches c.  A relative selector is
+// matched as if it were not relative.
+func (m *Matcher) MatchComplex(c *Complex, n Node) bool {
+	return m.matchFrom(c.Compounds, len(c.Compounds)-1, n, nil)
+}
+
+// QueryAll returns the descendants of root that match l, in document order.
+func (m *Matcher) QueryAll(root Node, l List) []Node {
+	var out []Node
+	descendants(root, func(n Node) bool {
+		if m.Match(l, n) {
+			out = append(out, n)
+		}
+		return true
+	})
+	return out
+}
+
+// Query returns the first descendant of root that matches l, or nil.
+func (m *Matcher) Query(root Node, l List) Node {
+	var found Node
+	descendants(root, func(n Node) bool {
+		if m.Match(l, n) {
+			found = n
+		}
+		return found == nil
+	})
+	return found
+}
+
+// descendants calls fn for each descendant of n in document order, until
+// it returns false.
+func descendants(n Node, fn func(Node) bool) bool {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if !fn(c) || !descendants(c, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFrom reports whether n matches cs[i], and the elements related to
+// it by the combinators match the compound selectors before it.  For a
+// relative selector, anchor is the element the first combinator relates
+// to.
+func (m *Matcher) matchFrom(cs []*Compound, i int, n Node, anchor Node) bool {
+	if !m.matchCompound(cs[i], n) {
+		return false
+	}
+	if i == 0 {
+		return anchor == nil || related(cs[0].Combinator, n, func(o Node) bool { return o == anchor })
+	}
+	return related(cs[i].Combinator, n, func(o Node) bool { return m.matchFrom(cs, i-1, o, anchor) })
+}
+
+// related reports whether an element related to n by the combinator, such
+// as one of its ancestors for the descendant combinator, satisfies ok.
+func related(c Combinator, n Node, ok func(Node) bool) bool {
+	switch c {
+	case Descendant:
+		for p := n.Parent(); p != nil; p = p.Parent() {
+			if ok(p) {
+				return true
+			}
+		}
+	case Child:
+		p := n.Parent()
+		return p != nil && ok(p)
+	case NextSibling:
+		s := n.PrevSibling()
+		return s != nil && ok(s)
+	case SubsequentSibling:
+		for s := n.PrevSibling(); s != nil; s = s.PrevSibling() {
+			if ok(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchCompound(cp *Compound, n Node) bool {
+	if cp.Type != "" && cp.Type != "*" && !tokenizer.IdentEquals(cp.Type, n.TagName()) {
+		return false
+	}
+	if cp.Namespace != nil && cp.Namespace.Prefix != "*" && cp.Namespace.URL != namespaceOf(n) {
+		return false
+	}
+	for _, s := range cp.Simples {
+		if s.Kind == PseudoElement {
+			break
+		}
+		if !m.matchSimple(s, n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Matcher) matchSimple(s *Simple, n Node) bool {
+	switch s.Kind {
+	case ID:
+		id, _ := n.Attr("id")
+		return id == s.Name
+	case Class:
+		class, _ := n.Attr("class")
+		for _, c := range fieldsASCII(class) {
+			if c == s.Name {
+				return true
+			}
+		}
+		return false
+	case Attribute:
+		return matchAttribute(s, n)
+	case Nesting:
+		return m.isScope(n)
+	}
+
+	switch s.Name {
+	case "is", "where":
+		return m.Match(s.Args, n)
+	case "not":
+		return !m.Match(s.Args, n)
+	case "has":
+		return m.has(s.Args, n)
+	case "root":
+		return n.Parent() == nil
+	case "scope":
+		return m.isScope(n)
+	case "first-child", "last-child", "only-child", "first-of-type", "last-of-type", "only-of-type":
+		if strings.HasPrefix(s.Name, "only-") {
+			name := s.Name[len("only-"):]
+			return m.nth(&Simple{Name: "nth-" + name, B: 1}, n) && m.nth(&Simple{Name: "nth-last-" + name, B: 1}, n)
+		}
+		if strings.HasPrefix(s.Name, "first-") {
+			return m.nth(&Simple{Name: "nth-" + s.Name[len("first-"):], B: 1}, n)
+		}
+		return m.nth(&Simple{Name: "nth-last-" + s.Name[len("last-"):], B: 1}, n)
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		return m.nth(s, n)
+	}
+	if m.PseudoClass == nil {
+		return false
+	}
+	return m.PseudoClass(n, s.Name, s.Raw)
+}
+
+func (m *Matcher) isScope(n Node) bool {
+	if m.Scope == nil {
+		return n.Parent() == nil
+	}
+	return n == m.Scope
+}
+
+// nth reports whether n matches one of the :nth-* pseudo-classes.
+func (m *Matcher) nth(s *Simple, n Node) bool {
+	ofType := strings.HasSuffix(s.Name, "-of-type")
+	counts := func(o Node) bool {
+		switch {
+		case ofType:
+			return tokenizer.IdentEquals(o.TagName(), n.TagName())
+		case s.Args != nil:
+			return m.Match(s.Args, o)
+		}
+		return true
+	}
+	if !counts(n) {
+		return false
+	}
+	step := Node.PrevSibling
+	if strings.HasPrefix(s.Name, "nth-last-") {
+		step = Node.NextSibling
+	}
+	index := 1
+	for o := step(n); o != nil; o = step(o) {
+		if counts(o) {
+			index++
+		}
+	}
+	if s.A == 0 {
+		return index == s.B
+	}
+	k := index - s.B
+	return k%s.A == 0 && k/s.A >= 0
+}
+
+// has reports whether any element anchored at n matches one of the
+// relative selectors in l.
+func (m *Matcher) has(l List, n Node) bool {
+	found := false
+	check := func(o Node) bool {
+		for _, c := range l {
+			if m.matchFrom(c.Compounds, len(c.Compounds)-1, o, n) {
+				found = true
+				return false
+			}
+		}
+		return true
+	}
+	if !descendants(n, check) {
+		return true
+	}
+	// the following siblings, for the sibling combinators
+	for s := n.NextSibling(); s != nil && !found; s = s.NextSibling() {
+		if check(s) {
+			descendants(s, check)
+		}
+	}
+	return found
+}
+
+// caseInsensitiveAttrs are the attributes of HTML elements whose values
+// are compared ASCII case-insensitively unless the selector has the 's'
+// flag, as listed in the HTML standard.
+var caseInsensitiveAttrs = map[string]bool{
+	"accept": true, "accept-charset": true, "align": true, "alink": true,
+	"axis": true, "bgcolor": true, "charset": true, "checked": true,
+	"clear": true, "codetype": true, "color": true, "compact": true,
+	"declare": true, "defer": true, "dir": true, "direction": true,
+	"disabled": true, "enctype": true, "face": true, "frame": true,
+	"hreflang": true, "http-equiv": true, "lang": true, "language": true,
+	"link": true, "media": true, "method": true, "multiple": true,
+	"nohref": true, "noresize": true, "noshade": true, "nowrap": true,
+	"readonly": true, "rel": true, "rev": true, "rules": true,
+	"scope": true, "scrolling": true, "selected": true, "shape": true,
+	"target": true, "text": true, "type": true, "valign": true,
+	"valuetype": true, "vlink": true,
+}
+
+func namespaceOf(n Node) string {
+	if nn, ok := n.(NamespacedNode); ok {
+		return nn.Namespace()
+	}
+	return HTMLNamespace
+}
+
+func matchAttribute(s *Simple, n Node) bool {
+	var v string
+	var ok bool
+	switch nn, isNS := n.(NamespacedNode); {
+	case s.Namespace == nil:
+		v, ok = n.Attr(s.Name)
+	case isNS:
+		namespace := s.Namespace.URL
+		if s.Namespace.Prefix == "*" {
+			namespace = "*"
+		}
+		v, ok = nn.AttrNS(namespace, s.Name)
+	case s.Namespace.Prefix == "*" || s.Namespace.URL == "":
+		v, ok = n.Attr(s.Name)
+	}
+	if !ok {
+		return false
+	}
+	want := s.Value
+	if s.Modifier == 'i' || s.Modifier == 0 && caseInsensitiveAttrs[s.Name] &&
+		(s.Namespace == nil || s.Namespace.URL == "") && namespaceOf(n) == HTMLNamespace {
+		v, want = tokenizer.ToLowerASCII(v), tokenizer.ToLowerASCII(want)
+	}
+	switch s.Op {
+	case "":
+		return true
+	case "=":
+		return v == want
+	case "~=":
+		for _, f := range fieldsASCII(v) {
+			if f == want {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return v == want || strings.HasPrefix(v, want+"-")
+	case "^=":
+		return want != "" && strings.HasPrefix(v, want)
+	case "$=":
+		return want != "" && strings.HasSuffix(v, want)
+	case "*=":
+		return want != "" && strings.Contains(v, want)
+	}
+	return false
+}
+
+// fieldsASCII splits s at runs of ASCII whitespace, as HTML splits class
+// names and CSS splits the words that ~= matches.  Other space characters,
+// such as U+00A0, are part of the words.
+func fieldsASCII(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\f' || r == '\r'
+	})
+}
@@ -0,0 +1,748 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package selector parses CSS selectors, following Selectors Level 4, and
+matches them against a document through the Node interface, so that it can
+be used with any DOM implementation.
+
+	rules, _ := parser.ParseStylesheet(toks)
+	sel, err := selector.Parse(rules[0].Prelude)
+	if err != nil {
+		// the rule is invalid, and a browser would drop it
+	}
+	var m selector.Matcher
+	for _, n := range m.QueryAll(root, sel) {
+		...
+	}
+
+Namespace prefixes, such as "svg|rect", are resolved by ParseWithNamespaces
+against the @namespace rules of the stylesheet.  The column combinator is
+not supported, and gives an error.
+*/
+package selector
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// List is a selector list, such as "a, .b > c".
+type List []*Complex
+
+// Complex is a complex selector: compound selectors joined by combinators.
+type Complex struct {
+	Compounds []*Compound
+}
+
+// Combinator is the relation between an element and the one matched by the
+// compound selector before it.
+type Combinator byte
+
+// The combinators, by the character that writes them.
+const (
+	Descendant        Combinator = ' '
+	Child             Combinator = '>'
+	NextSibling       Combinator = '+'
+	SubsequentSibling Combinator = '~'
+)
+
+// Namespace is the namespace of a type or attribute selector.
+type Namespace struct {
+	// Prefix is the prefix written before the '|', such as "svg", or "*"
+	// for any namespace.  It is empty both for "|a", which is in no
+	// namespace, and for the default namespace, which applies when no
+	// prefix is written; URL is empty only for the first.
+	Prefix string
+	// URL is the namespace URL that Prefix stands for.
+	URL string
+}
+
+// Compound is a compound selector, such as "a.b:hover".
+type Compound struct {
+	// Combinator is the combinator before the compound selector.  It is
+	// zero for the first one, unless the selector is relative, as in
+	// ":has(> a)".
+	Combinator Combinator
+	// Namespace is the namespace the element must be in, or nil for any.
+	Namespace *Namespace
+	// Type is the lowercased type selector, "*" for the universal
+	// selector, or "" if there is neither.
+	Type string
+	// Simples are the other simple selectors, in order.
+	Simples []*Simple
+}
+
+// Kind is the kind of a simple selector.
+type Kind int
+
+// The kinds of simple selectors, apart from type selectors.
+const (
+	ID Kind = iota
+	Class
+	Attribute
+	PseudoClass
+	PseudoElement
+	// Nesting is the & of CSS Nesting.
+	Nesting
+)
+
+// Simple is a simple selector other than a type selector, or a
+// pseudo-element.
+type Simple struct {
+	Kind Kind
+	// Name is the ID, class name, attribute name, or pseudo-class or
+	// pseudo-element name.  Attribute and pseudo names are lowercased.
+	Name string
+	// Namespace is the namespace of an attribute, or nil for an attribute
+	// in no namespace.
+	Namespace *Namespace
+
+	// Op is the operator of an attribute selector, such as "^=", or "" for
+	// one that only tests the attribute is present.  Value is the value it
+	// is compared with, and Modifier is 'i' or 's' if the comparison is
+	// made case-insensitive or case-sensitive, or zero.
+	Op       string
+	Value    string
+	Modifier byte
+
+	// Args holds the selector argument of :is(), :where(), :not(), and
+	// :has(), and the "of" selector of :nth-child() and :nth-last-child().
+	Args List
+	// A and B are the An+B of the :nth-* pseudo-classes.
+	A, B int
+	// Func is set for a functional pseudo-class or pseudo-element.  Raw
+	// holds the arguments of those that are not parsed, such as :lang().
+	Func bool
+	Raw  []tokenizer.Token
+}
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("selector: "+format, args...)
+}
+
+func render(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	tokenizer.RenderTokens(&buf, toks)
+	return buf.String()
+}
+
+// legacyPseudoElements are the pseudo-elements that may be written with a
+// single colon.
+var legacyPseudoElements = map[string]bool{
+	"before": true, "after": true, "first-line": true, "first-letter": true,
+}
+
+// Parse parses toks, such as the prelude of a style rule, as a selector
+// list.  As in a browser, the whole list is invalid if any of its
+// selectors is.
+func Parse(toks []tokenizer.Token) (List, error) {
+	return ParseWithNamespaces(toks, nil)
+}
+
+// ParseWithNamespaces is Parse for a stylesheet with @namespace rules.
+// namespaces maps each declared prefix to its namespace URL, with the
+// default namespace, if any, under "".  A prefix that is not declared is an
+// error.
+//
+// If there is a default namespace, every compound selector without a
+// prefix, including one without a type selector such as ".a", only matches
+// elements in it.  Attribute selectors without a prefix are not affected.
+func ParseWithNamespaces(toks []tokenizer.Token, namespaces map[string]string) (List, error) {
+	return parseList(toks, namespaces, false, false)
+}
+
+// ParseRelative parses toks as a relative selector list, such as the
+// selector of a rule nested in another with CSS Nesting, where a selector
+// may start with a combinator, as in "> a".  The first compound selector of
+// each selector has its combinator, which is a descendant combinator if
+// none is written.
+func ParseRelative(toks []tokenizer.Token, namespaces map[string]string) (List, error) {
+	return parseList(toks, namespaces, true, false)
+}
+
+// Normalize returns the selector list toks in canonical form, for telling
+// whether selectors written differently are the same: as String writes it,
+// with single spaces around combinators and after commas and no comments,
+// type selectors, attribute names, and pseudo-class and pseudo-element
+// names lowercased, pseudo-elements written with two colons, and attribute
+// values quoted, keeping their case.  Class names and IDs keep their case
+// too, as they are case-sensitive.
+func Normalize(toks []tokenizer.Token, namespaces map[string]string) (string, error) {
+	l, err := ParseWithNamespaces(toks, namespaces)
+	if err != nil {
+		return "", err
+	}
+	return l.String(), nil
+}
+
+// parseList parses a selector list.  A forgiving list drops the selectors
+// that are invalid instead, as :is() and :where() do.
+func parseList(toks []tokenizer.Token, namespaces map[string]string, relative, forgiving bool) (List, error) {
+	parts := parser.SplitCommas(toks)
+	if len(parts) == 0 && !forgiving {
+		return nil, errorf("empty selector")
+	}
+	l := List{}
+	for _, part := range parts {
+		c, err := parseComplex(part, namespaces, relative)
+		if err != nil {
+			if forgiving {
+				continue
+			}
+			return nil, err
+		}
+		l = append(l, c)
+	}
+	return l, nil
+}
+
+type selParser struct {
+	toks       []tokenizer.Token
+	i          int
+	namespaces map[string]string
+}
+
+func (p *selParser) skipTrivia() bool {
+	skipped := false
+	for p.i < len(p.toks) && tokenizer.IsTrivia(p.toks[p.i]) {
+		p.i++
+		skipped = true
+	}
+	return skipped
+}
+
+func (p *selParser) delim(c string) bool {
+	return p.i < len(p.toks) && p.toks[p.i].Type == tokenizer.TokenDelim && p.toks[p.i].Value == c
+}
+
+func parseComplex(toks []tokenizer.Token, namespaces map[string]string, relative bool) (*Complex, error) {
+	p := &selParser{toks: toks, namespaces: namespaces}
+	c := &Complex{}
+	for {
+		space := p.skipTrivia()
+		if p.i == len(toks) {
+			break
+		}
+		var comb Combinator
+		if t := toks[p.i]; t.Type == tokenizer.TokenDelim && (t.Value == ">" || t.Value == "+" || t.Value == "~") {
+			comb = Combinator(t.Value[0])
+			if len(c.Compounds) == 0 && !relative {
+				return nil, errorf("selector %q starts with a combinator", render(toks))
+			}
+			p.i++
+			p.skipTrivia()
+		} else if space && len(c.Compounds) > 0 {
+			comb = Descendant
+		} else if relative && len(c.Compounds) == 0 {
+			comb = Descendant
+		}
+		if p.i == len(toks) {
+			return nil, errorf("selector %q ends with a combinator", render(toks))
+		}
+		cp, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		cp.Combinator = comb
+		c.Compounds = append(c.Compounds, cp)
+	}
+	if len(c.Compounds) == 0 {
+		return nil, errorf("empty selector")
+	}
+	return c, nil
+}
+
+// compound parses a compound selector, up to the next whitespace or
+// combinator.
+func (p *selParser) compound() (*Compound, error) {
+	cp := &Compound{}
+	ns, n, err := p.namespacePrefix(p.toks[p.i:])
+	if err != nil {
+		return nil, err
+	}
+	p.i += n
+	if def, ok := p.namespaces[""]; ok && ns == nil {
+		ns = &Namespace{URL: def}
+	}
+	cp.Namespace = ns
+	switch {
+	case p.i < len(p.toks) && p.toks[p.i].Type == tokenizer.TokenIdent:
+		cp.Type = tokenizer.ToLowerASCII(p.toks[p.i].Value)
+		p.i++
+	case p.delim("*"):
+		cp.Type = "*"
+		p.i++
+	case n > 0:
+		return nil, errorf("expected a name after '|'")
+	}
+	for p.i < len(p.toks) {
+		t := p.toks[p.i]
+		if tokenizer.IsTrivia(t) || p.delim(">") || p.delim("+") || p.delim("~") {
+			break
+		}
+		s, err := p.simple()
+		if err != nil {
+			return nil, err
+		}
+		cp.Simples = append(cp.Simples, s)
+	}
+	if cp.Type == "" && len(cp.Simples) == 0 {
+		return nil, errorf("unexpected %q in selector", render(p.toks[p.i:p.i+1]))
+	}
+	return cp, nil
+}
+
+// simple parses a simple selector other than a type selector.
+func (p *selParser) simple() (*Simple, error) {
+	t := p.toks[p.i]
+	switch {
+	case t.Type == tokenizer.TokenHash:
+		if e, ok := t.Extra.(*tokenizer.TokenExtraHash); !ok || !e.IsIdentifier {
+			return nil, errorf("bad ID selector %q", "#"+t.Value)
+		}
+		p.i++
+		return &Simple{Kind: ID, Name: t.Value}, nil
+	case p.delim("."):
+		p.i++
+		if p.i == len(p.toks) || p.toks[p.i].Type != tokenizer.TokenIdent {
+			return nil, errorf("expected a class name after '.'")
+		}
+		p.i++
+		return &Simple{Kind: Class, Name: p.toks[p.i-1].Value}, nil
+	case p.delim("&"):
+		p.i++
+		return &Simple{Kind: Nesting}, nil
+	case t.Type == tokenizer.TokenOpenBracket:
+		cv := parser.ComponentValues(p.toks[p.i:])[0]
+		p.i += len(cv)
+		if cv[len(cv)-1].Type != tokenizer.TokenCloseBracket {
+			return nil, errorf("unclosed attribute selector")
+		}
+		return p.parseAttribute(cv[1 : len(cv)-1])
+	case t.Type == tokenizer.TokenColon:
+		p.i++
+		kind := PseudoClass
+		if p.i < len(p.toks) && p.toks[p.i].Type == tokenizer.TokenColon {
+			kind = PseudoElement
+			p.i++
+		}
+		if p.i == len(p.toks) {
+			return nil, errorf("expected a name after ':'")
+		}
+		t = p.toks[p.i]
+		s := &Simple{Kind: kind, Name: tokenizer.ToLowerASCII(t.Value)}
+		switch t.Type {
+		case tokenizer.TokenIdent:
+			p.i++
+			if legacyPseudoElements[s.Name] {
+				s.Kind = PseudoElement
+			}
+			return s, nil
+		case tokenizer.TokenFunction:
+			cv := parser.ComponentValues(p.toks[p.i:])[0]
+			p.i += len(cv)
+			if cv[len(cv)-1].Type != tokenizer.TokenCloseParen {
+				return nil, errorf("unclosed :%s()", s.Name)
+			}
+			s.Func = true
+			if err := s.parseArgs(cv[1:len(cv)-1], p.namespaces); err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+		return nil, errorf("expected a name after ':', got %q", render(p.toks[p.i:p.i+1]))
+	}
+	return nil, errorf("unexpected %q in selector", render(p.toks[p.i:p.i+1]))
+}
+
+// namespacePrefix parses the namespace prefix at the start of toks, such as
+// "svg|" or "*|", if there is one, and returns the number of tokens it
+// takes.
+func (p *selParser) namespacePrefix(toks []tokenizer.Token) (*Namespace, int, error) {
+	isDelim := func(i int, c string) bool {
+		return i < len(toks) && toks[i].Type == tokenizer.TokenDelim && toks[i].Value == c
+	}
+	switch {
+	case isDelim(0, "|"):
+		return &Namespace{}, 1, nil
+	case isDelim(0, "*") && isDelim(1, "|"):
+		return &Namespace{Prefix: "*"}, 2, nil
+	case len(toks) > 0 && toks[0].Type == tokenizer.TokenIdent && isDelim(1, "|"):
+		prefix := toks[0].Value
+		url, ok := p.namespaces[prefix]
+		if !ok || prefix == "" {
+			return nil, 0, errorf("undeclared namespace prefix %q", prefix)
+		}
+		return &Namespace{Prefix: prefix, URL: url}, 2, nil
+	}
+	return nil, 0, nil
+}
+
+func (p *selParser) parseAttribute(toks []tokenizer.Token) (*Simple, error) {
+	var sig []tokenizer.Token
+	for _, t := range toks {
+		if !tokenizer.IsTrivia(t) {
+			sig = append(sig, t)
+		}
+	}
+	bad := errorf("bad attribute selector %q", "["+render(toks)+"]")
+	ns, n, err := p.namespacePrefix(sig)
+	if err != nil {
+		return nil, err
+	}
+	sig = sig[n:]
+	if len(sig) == 0 || sig[0].Type != tokenizer.TokenIdent {
+		return nil, bad
+	}
+	s := &Simple{Kind: Attribute, Name: tokenizer.ToLowerASCII(sig[0].Value), Namespace: ns}
+	if len(sig) == 1 {
+		return s, nil
+	}
+	switch op := sig[1]; op.Type {
+	case tokenizer.TokenIncludes, tokenizer.TokenDashMatch, tokenizer.TokenPrefixMatch,
+		tokenizer.TokenSuffixMatch, tokenizer.TokenSubstringMatch:
+		s.Op = op.Value
+	case tokenizer.TokenDelim:
+		if op.Value != "=" {
+			return nil, bad
+		}
+		s.Op = "="
+	default:
+		return nil, bad
+	}
+	if len(sig) < 3 || (sig[2].Type != tokenizer.TokenIdent && sig[2].Type != tokenizer.TokenString) {
+		return nil, bad
+	}
+	s.Value = sig[2].Value
+	switch {
+	case len(sig) == 3:
+	case len(sig) == 4 && (sig[3].MatchesIdent("i") || sig[3].MatchesIdent("s")):
+		s.Modifier = tokenizer.ToLowerASCII(sig[3].Value)[0]
+	default:
+		return nil, bad
+	}
+	return s, nil
+}
+
+// parseArgs parses the arguments of a functional pseudo-class.
+func (s *Simple) parseArgs(args []tokenizer.Token, namespaces map[string]string) error {
+	var err error
+	switch {
+	case s.Kind != PseudoClass:
+		s.Raw = args
+	case s.Name == "is" || s.Name == "where":
+		s.Args, err = parseList(args, namespaces, false, true)
+	case s.Name == "not":
+		s.Args, err = parseList(args, namespaces, false, false)
+	case s.Name == "has":
+		s.Args, err = parseList(args, namespaces, true, false)
+	case s.Name == "nth-child" || s.Name == "nth-last-child":
+		anb := args
+		for i, t := range args {
+			if t.MatchesIdent("of") {
+				anb = args[:i]
+				if s.Args, err = parseList(args[i+1:], namespaces, false, false); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		s.A, s.B, err = parseAnB(anb)
+	case s.Name == "nth-of-type" || s.Name == "nth-last-of-type":
+		s.A, s.B, err = parseAnB(args)
+	default:
+		s.Raw = args
+	}
+	return err
+}
+
+// parseAnB parses the An+B microsyntax, such as "2n+1" or "odd".
+func parseAnB(toks []tokenizer.Token) (a, b int, err error) {
+	// each token is rendered alone, as "2n" and "+1" would be kept apart
+	var s string
+	for _, t := range toks {
+		if !tokenizer.IsTrivia(t) {
+			s += tokenizer.ToLowerASCII(render([]tokenizer.Token{t}))
+		}
+	}
+	bad := errorf("bad An+B %q", render(toks))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	case "":
+		return 0, 0, bad
+	}
+	n := strings.IndexByte(s, 'n')
+	if n < 0 {
+		b, err = strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, bad
+		}
+		return 0, b, nil
+	}
+	switch as := s[:n]; as {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(as); err != nil {
+			return 0, 0, bad
+		}
+	}
+	if bs := s[n+1:]; bs != "" {
+		if bs[0] != '+' && bs[0] != '-' {
+			return 0, 0, bad
+		}
+		if b, err = strconv.Atoi(bs); err != nil {
+			return 0, 0, bad
+		}
+	}
+	return a, b, nil
+}
+
+// Specificity returns the specificity of c, as (ids, classes, types).  The
+// & selector counts for nothing, as the rule it refers to is not known.
+func (c *Complex) Specificity() [3]int {
+	var spec [3]int
+	for _, cp := range c.Compounds {
+		if cp.Type != "" && cp.Type != "*" {
+			spec[2]++
+		}
+		for _, s := range cp.Simples {
+			add := s.specificity()
+			for i := range spec {
+				spec[i] += add[i]
+			}
+		}
+	}
+	return spec
+}
+
+// Specificity returns the highest specificity of the selectors in l, which
+// is that of :is(l).
+func (l List) Specificity() [3]int {
+	var max [3]int
+	for _, c := range l {
+		if spec := c.Specificity(); less(max, spec) {
+			max = spec
+		}
+	}
+	return max
+}
+
+func less(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func (s *Simple) specificity() [3]int {
+	switch s.Kind {
+	case ID:
+		return [3]int{1, 0, 0}
+	case Class, Attribute:
+		return [3]int{0, 1, 0}
+	case PseudoElement:
+		return [3]int{0, 0, 1}
+	case Nesting:
+		return [3]int{}
+	}
+	switch s.Name {
+	case "where":
+		return [3]int{}
+	case "is", "not", "has":
+		return s.Args.Specificity()
+	case "nth-child", "nth-last-child":
+		spec := s.Args.Specificity()
+		spec[1]++
+		return spec
+	}
+	return [3]int{0, 1, 0}
+}
+
+// String returns l as CSS source.
+func (l List) String() string {
+	var buf bytes.Buffer
+	l.writeTo(&buf)
+	return buf.String()
+}
+
+func (l List) writeTo(buf *bytes.Buffer) {
+	for i, c := range l {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		c.writeTo(buf)
+	}
+}
+
+// String returns c as CSS source.
+func (c *Complex) String() string {
+	var buf bytes.Buffer
+	c.writeTo(&buf)
+	return buf.String()
+}
+
+func (c *Complex) writeTo(buf *bytes.Buffer) {
+	for i, cp := range c.Compounds {
+		switch {
+		case cp.Combinator == Descendant && i > 0:
+			buf.WriteByte(' ')
+		case cp.Combinator != 0 && cp.Combinator != Descendant:
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteByte(byte(cp.Combinator))
+			buf.WriteByte(' ')
+		}
+		cp.writeTo(buf)
+	}
+}
+
+// String returns cp as CSS source, without its combinator.
+func (cp *Compound) String() string {
+	var buf bytes.Buffer
+	cp.writeTo(&buf)
+	return buf.String()
+}
+
+func (cp *Compound) writeTo(buf *bytes.Buffer) {
+	if cp.Namespace != nil {
+		cp.Namespace.writeTo(buf)
+	}
+	switch cp.Type {
+	case "":
+	case "*":
+		buf.WriteByte('*')
+	default:
+		buf.WriteString(tokenizer.SerializeIdentifier(cp.Type))
+	}
+	for _, s := range cp.Simples {
+		s.writeTo(buf)
+	}
+}
+
+// String returns s as CSS source.
+func (s *Simple) String() string {
+	var buf bytes.Buffer
+	s.writeTo(&buf)
+	return buf.String()
+}
+
+func (s *Simple) writeTo(buf *bytes.Buffer) {
+	switch s.Kind {
+	case ID:
+		buf.WriteByte('#')
+		buf.WriteString(tokenizer.SerializeIdentifier(s.Name))
+		return
+	case Class:
+		buf.WriteByte('.')
+		buf.WriteString(tokenizer.SerializeIdentifier(s.Name))
+		return
+	case Nesting:
+		buf.WriteByte('&')
+		return
+	case Attribute:
+		buf.WriteByte('[')
+		if s.Namespace != nil {
+			s.Namespace.writeTo(buf)
+		}
+		buf.WriteString(tokenizer.SerializeIdentifier(s.Name))
+		if s.Op != "" {
+			buf.WriteString(s.Op)
+			buf.WriteString(tokenizer.SerializeString(s.Value))
+		}
+		if s.Modifier != 0 {
+			buf.WriteByte(' ')
+			buf.WriteByte(s.Modifier)
+		}
+		buf.WriteByte(']')
+		return
+	case PseudoElement:
+		buf.WriteByte(':')
+	}
+	buf.WriteByte(':')
+	buf.WriteString(tokenizer.SerializeIdentifier(s.Name))
+	if !s.Func {
+		return
+	}
+	buf.WriteByte('(')
+	switch {
+	case s.Raw != nil:
+		tokenizer.RenderTokens(buf, collapseTrivia(s.Raw))
+	case strings.HasPrefix(s.Name, "nth-"):
+		buf.WriteString(anb(s.A, s.B))
+		if s.Args != nil {
+			buf.WriteString(" of ")
+			s.Args.writeTo(buf)
+		}
+	default:
+		s.Args.writeTo(buf)
+	}
+	buf.WriteByte(')')
+}
+
+// collapseTrivia returns toks without comments, and with each run of
+// whitespace made a single space, or removed at either end.
+func collapseTrivia(toks []tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	space := false
+	for _, t := range toks {
+		if tokenizer.IsTrivia(t) {
+			space = space || t.Type == tokenizer.TokenS && len(out) > 0
+			continue
+		}
+		if space {
+			out = append(out, tokenizer.Token{Type: tokenizer.TokenS, Value: " "})
+			space = false
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// writeTo writes the prefix of ns and its '|', or nothing for the default
+// namespace.
+func (ns *Namespace) writeTo(buf *bytes.Buffer) {
+	switch {
+	case ns.Prefix == "*":
+		buf.WriteByte('*')
+	case ns.Prefix != "":
+		buf.WriteString(tokenizer.SerializeIdentifier(ns.Prefix))
+	case ns.URL != "":
+		return
+	}
+	buf.WriteByte('|')
+}
+
+func anb(a, b int) string {
+	var s string
+	switch a {
+	case 0:
+		return strconv.Itoa(b)
+	case 1:
+		s = "n"
+	case -1:
+		s = "-n"
+	default:
+		s = strconv.Itoa(a) + "n"
+	}
+	switch {
+	case b > 0:
+		s += "+" + strconv.Itoa(b)
+	case b < 0:
+		s += strconv.Itoa(b)
+	}
+	return s
+}
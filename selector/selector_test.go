@@ -0,0 +1,451 @@
+// Copyright 2018 Kane York.
+
+package selector
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func parse(t *testing.T, src string) List {
+	toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+	l, err := Parse(toks)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return l
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+		spec      [3]int
+	}{
+		{`a`, `a`, [3]int{0, 0, 1}},
+		{`DIV.a#b[c]`, `div.a#b[c]`, [3]int{1, 2, 1}},
+		{`a  >b+ c ~d e`, `a > b + c ~ d e`, [3]int{0, 0, 5}},
+		{`[Href ^= 'http' i]`, `[href^="http" i]`, [3]int{0, 1, 0}},
+		{`[a|=b]`, `[a|="b"]`, [3]int{0, 1, 0}},
+		{`*:not(.a, #b)`, `*:not(.a, #b)`, [3]int{1, 0, 0}},
+		{`:where(#a) :is(a, .b, 1x)`, `:where(#a) :is(a, .b)`, [3]int{0, 1, 0}},
+		{`li:nth-child( 2n + 1 of .x )`, `li:nth-child(2n+1 of .x)`, [3]int{0, 2, 1}},
+		{`li:NTH-LAST-OF-TYPE(odd):nth-child(-n+3)`, `li:nth-last-of-type(2n+1):nth-child(-n+3)`, [3]int{0, 2, 1}},
+		{`a:has(> img, + p)`, `a:has(> img, + p)`, [3]int{0, 0, 2}},
+		{`a:before::after::part(x):hover`, `a::before::after::part(x):hover`, [3]int{0, 1, 4}},
+		{`:lang(en) & .a`, `:lang(en) & .a`, [3]int{0, 2, 0}},
+		{`.\31 x`, `.\31 x`, [3]int{0, 1, 0}},
+		{"D\u0130V:HOVER", "d\u0130v:hover", [3]int{0, 1, 1}},
+	} {
+		l := parse(t, tc.src)
+		if got := l.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+		if got := l.Specificity(); got != tc.spec {
+			t.Errorf("%s: specificity %v, want %v", tc.src, got, tc.spec)
+		}
+	}
+
+	for _, src := range []string{
+		``,
+		`a,`,
+		`> a`,
+		`a >`,
+		`#1a`,
+		`a.`,
+		`ns|a`,
+		`[a=]`,
+		`[a=b c]`,
+		`a:not()`,
+		`:nth-child(2x)`,
+		`a:`,
+		`a b!`,
+	} {
+		toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+		if l, err := Parse(toks); err == nil {
+			t.Errorf("%s: expected an error, got %s", src, l)
+		}
+	}
+}
+
+// node is a Node for tests.
+type node struct {
+	tag      string
+	attrs    map[string]string
+	parent   *node
+	children []*node
+	index    int
+}
+
+// tree builds a tree from an outline such as "html(body(p.a p#b))".
+func tree(src string) *node {
+	root, _ := treeFrom(src)
+	return root
+}
+
+func treeFrom(src string) (*node, string) {
+	end := strings.IndexAny(src, "( )")
+	if end < 0 {
+		end = len(src)
+	}
+	n := &node{attrs: map[string]string{}}
+	name := src[:end]
+	src = src[end:]
+	for _, part := range strings.Split(strings.Replace(name, "#", ".#", -1), ".") {
+		switch {
+		case n.tag == "":
+			n.tag = part
+		case strings.HasPrefix(part, "#"):
+			n.attrs["id"] = part[1:]
+		default:
+			n.attrs["class"] += " " + part
+		}
+	}
+	if strings.HasPrefix(src, "(") {
+		src = src[1:]
+		for !strings.HasPrefix(src, ")") {
+			var c *node
+			c, src = treeFrom(strings.TrimLeft(src, " "))
+			c.parent, c.index = n, len(n.children)
+			n.children = append(n.children, c)
+			src = strings.TrimLeft(src, " ")
+		}
+		src = src[1:]
+	}
+	return n, src
+}
+
+func (n *node) TagName() string { return n.tag }
+
+func (n *node) Attr(name string) (string, bool) {
+	v, ok := n.attrs[name]
+	return v, ok
+}
+
+func (n *node) Parent() Node {
+	if n.parent == nil {
+		return nil
+	}
+	return n.parent
+}
+
+func (n *node) sibling(i int) Node {
+	if n.parent == nil || i < 0 || i >= len(n.parent.children) {
+		return nil
+	}
+	return n.parent.children[i]
+}
+
+func (n *node) PrevSibling() Node { return n.sibling(n.index - 1) }
+func (n *node) NextSibling() Node { return n.sibling(n.index + 1) }
+
+func (n *node) FirstChild() Node {
+	if len(n.children) == 0 {
+		return nil
+	}
+	return n.children[0]
+}
+
+func (n *node) String() string {
+	s := n.tag
+	if id := n.attrs["id"]; id != "" {
+		s += "#" + id
+	}
+	return s
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct{ a, b string }{
+		{`A:HOVER,  .X>B`, `a:hover, .X > b`},
+		{`a:BEFORE`, `a::before`},
+		{`[Href = 'Foo' I]`, `[href="Foo" i]`},
+		{`:lang( EN /* x */ )`, `:lang(EN)`},
+		{`a /* x */ b`, `a b`},
+	} {
+		for _, src := range []string{tc.a, tc.b} {
+			toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+			got, err := Normalize(toks, nil)
+			if err != nil || got != tc.b {
+				t.Errorf("%s: got %q, %v, want %q", src, got, err, tc.b)
+			}
+		}
+	}
+	toks, _ := tokenizer.TokenizeAll([]byte(`[a='B'], .C, #D`), nil)
+	if got, _ := Normalize(toks, nil); got != `[a="B"], .C, #D` {
+		t.Errorf("got %q", got)
+	}
+	toks, _ = tokenizer.TokenizeAll([]byte(`ns|a`), nil)
+	if _, err := Normalize(toks, nil); err == nil {
+		t.Error("no error for an undeclared prefix")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	doc := tree("html(body#body(div#d1.a.b(p#p1 p#p2.x img#i1) div#d2(span#s1(img#i2)) p#p3 ul#u(li#l1 li#l2 li#l3.x li#l4)))")
+	m := &Matcher{PseudoClass: func(n Node, name string, args []tokenizer.Token) bool {
+		return name == "hover" && n.(*node).attrs["id"] == "p1"
+	}}
+	for _, tc := range []struct{ sel, want string }{
+		{`p`, `p#p1 p#p2 p#p3`},
+		{`.a.b > p`, `p#p1 p#p2`},
+		{`body img`, `img#i1 img#i2`},
+		{`div + p`, `p#p3`},
+		{`#p1 ~ *`, `p#p2 img#i1`},
+		{`[id^=l]:not(:first-child, .x)`, `li#l2 li#l4`},
+		{`li:nth-child(2n+1)`, `li#l1 li#l3`},
+		{`li:nth-last-child(-n+2)`, `li#l3 li#l4`},
+		{`li:nth-child(2 of .x, #l4)`, `li#l4`},
+		{`p:last-of-type, span:only-child`, `p#p2 span#s1 p#p3`},
+		{`div:has(> p.x)`, `div#d1`},
+		{`div:has(img)`, `div#d1 div#d2`},
+		{`div:has(+ p)`, `div#d2`},
+		{`:has(~ ul) :is(img, p:hover)`, `p#p1 img#i1 img#i2`},
+		{`:root > body, :scope`, `body#body`},
+		{`p::before`, `p#p1 p#p2 p#p3`},
+		{`[class~=b i]`, `div#d1`},
+	} {
+		var got []string
+		for _, n := range m.QueryAll(doc, parse(t, tc.sel)) {
+			got = append(got, n.(*node).String())
+		}
+		if s := strings.Join(got, " "); s != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.sel, s, tc.want)
+		}
+	}
+	if n := m.Query(doc, parse(t, `li`)); n == nil || n.(*node).attrs["id"] != "l1" {
+		t.Errorf("Query: got %v", n)
+	}
+	// only ASCII is case-folded, and only ASCII whitespace splits words
+	odd := tree("html(div(p p p))")
+	ps := odd.children[0].children
+	ps[0].attrs["class"] = "a\u00a0b"
+	ps[1].attrs["class"] = "\ta\nb\f"
+	ps[1].attrs["title"] = "\u212A"
+	ps[2].attrs["title"] = "x\u00a0k"
+	for _, tc := range []struct{ sel, want string }{
+		{`.a`, `1`},
+		{`.b, [class~="b"]`, `1`},
+		{`[title="k" i]`, ``},
+		{`[title~="k" i]`, ``},
+		{"[title=\"\u212A\" i]", `1`},
+		{"D\u0130V p", ``},
+	} {
+		var got []string
+		for _, n := range m.QueryAll(odd, parse(t, tc.sel)) {
+			got = append(got, strconv.Itoa(n.(*node).index))
+		}
+		if s := strings.Join(got, " "); s != tc.want {
+			t.Errorf("%q:\ngot  %s\nwant %s", tc.sel, s, tc.want)
+		}
+	}
+
+	m.Scope = doc.children[0].children[1]
+	if n := m.Query(doc, parse(t, `:scope > span`)); n == nil || n.(*node).attrs["id"] != "s1" {
+		t.Errorf("Query with scope: got %v", n)
+	}
+}
+
+func TestMatchSelectorArguments(t *testing.T) {
+	doc := tree("html(body#body(div#d1.a.b(p#p1 p#p2.x img#i1) div#d2(span#s1(img#i2)) p#p3 ul#u(li#l1 li#l2 li#l3.x li#l4)))")
+	var m Matcher
+	for _, tc := range []struct{ sel, want string }{
+		{`div:has(> span img)`, `div#d2`},
+		{`div:has(> span > img, > img)`, `div#d1 div#d2`},
+		{`body:has(> div + div > span)`, `body#body`},
+		{`p:has(~ img)`, `p#p1 p#p2`},
+		{`:has(+ p ~ ul)`, `div#d2`},
+		{`div:has(:is(p.x, span > img))`, `div#d1 div#d2`},
+		{`p:not(div p)`, `p#p3`},
+		{`li:not(:nth-child(odd of .x, #l4))`, `li#l1 li#l2 li#l4`},
+		{`li:nth-last-child(1 of .x)`, `li#l3`},
+		{`:nth-child(2 of :has(img))`, `div#d2`},
+		{`:is(div > p, ul > li).x`, `p#p2 li#l3`},
+		{`:where(body > div) img`, `img#i1 img#i2`},
+		{`:is(div p) ~ img`, `img#i1`},
+		{`:not(:is(html, body, div, p, span, ul), li)`, `img#i1 img#i2`},
+	} {
+		var got []string
+		for _, n := range m.QueryAll(doc, parse(t, tc.sel)) {
+			got = append(got, n.(*node).String())
+		}
+		if s := strings.Join(got, " "); s != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.sel, s, tc.want)
+		}
+	}
+}
+
+// nsNode is a NamespacedNode for tests, with attributes keyed by
+// "namespace name".
+type nsNode struct {
+	*node
+	ns      string
+	attrsNS map[string]string
+}
+
+func (n *nsNode) Namespace() string { return n.ns }
+
+func (n *nsNode) AttrNS(namespace, name string) (string, bool) {
+	for k, v := range n.attrsNS {
+		if i := strings.LastIndex(k, " "); k[i+1:] == name && (namespace == "*" || k[:i] == namespace) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func TestNamespaces(t *testing.T) {
+	const svg, xlink = "http://www.w3.org/2000/svg", "http://www.w3.org/1999/xlink"
+	namespaces := map[string]string{"svg": svg, "xlink": xlink}
+	withDefault := map[string]string{"": svg, "svg": svg, "xlink": xlink}
+	for _, tc := range []struct {
+		src, want  string
+		namespaces map[string]string
+	}{
+		{`svg|rect`, `svg|rect`, namespaces},
+		{`*|a`, `*|a`, namespaces},
+		{`|a`, `|a`, namespaces},
+		{`svg|*.a`, `svg|*.a`, namespaces},
+		{`[xlink|href]`, `[xlink|href]`, namespaces},
+		{`[*|href = x]`, `[*|href="x"]`, namespaces},
+		{`[|href]`, `[|href]`, namespaces},
+		{`rect:not(svg|a)`, `rect:not(svg|a)`, namespaces},
+		{`rect`, `rect`, withDefault},
+	} {
+		toks, _ := tokenizer.TokenizeAll([]byte(tc.src), nil)
+		l, err := ParseWithNamespaces(toks, tc.namespaces)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		if got := l.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+	}
+
+	for _, src := range []string{`html|a`, `svg|`, `[html|a]`, `svg|[a]`} {
+		toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+		if l, err := ParseWithNamespaces(toks, namespaces); err == nil {
+			t.Errorf("%s: expected an error, got %s", src, l)
+		}
+	}
+
+	rect := &nsNode{node: tree("rect"), ns: svg, attrsNS: map[string]string{xlink + " href": "#a", " width": "10"}}
+	html := tree("a")
+	html.attrs["href"] = "#b"
+	for _, tc := range []struct {
+		src        string
+		namespaces map[string]string
+		n          Node
+		want       bool
+	}{
+		{`svg|rect`, namespaces, rect, true},
+		{`svg|a`, namespaces, html, false},
+		{`*|a`, namespaces, html, true},
+		{`|rect`, namespaces, rect, false},
+		{`rect`, namespaces, rect, true},
+		{`rect`, withDefault, rect, true},
+		{`.x`, withDefault, html, false},
+		{`*|*`, withDefault, html, true},
+		{`[xlink|href="#a"]`, namespaces, rect, true},
+		{`[href]`, namespaces, rect, false},
+		{`[*|href]`, namespaces, rect, true},
+		{`[|width]`, namespaces, rect, true},
+		{`[xlink|href]`, namespaces, html, false},
+		{`[*|href="#b"]`, namespaces, html, true},
+		{`[|href]`, namespaces, html, true},
+	} {
+		toks, _ := tokenizer.TokenizeAll([]byte(tc.src), nil)
+		l, err := ParseWithNamespaces(toks, tc.namespaces)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		var m Matcher
+		if got := m.Match(l, tc.n); got != tc.want {
+			t.Errorf("%s on %s: got %v, want %v", tc.src, tc.n, got, tc.want)
+		}
+	}
+}
+
+// TestMatchAttribute checks attribute selectors against the examples of
+// the Selectors spec.
+func TestMatchAttribute(t *testing.T) {
+	const example = "http://www.example.com"
+	namespaces := map[string]string{"foo": example}
+	for _, tc := range []struct {
+		src   string
+		attrs map[string]string
+		want  bool
+	}{
+		{`h1[title]`, map[string]string{"title": ""}, true},
+		{`h1[title]`, map[string]string{"titles": "x"}, false},
+		{`span[class="example"]`, map[string]string{"class": "example"}, true},
+		{`span[class="example"]`, map[string]string{"class": "example x"}, false},
+		{`span[hello="Cleveland"][goodbye="Columbus"]`, map[string]string{"hello": "Cleveland", "goodbye": "Columbus"}, true},
+		{`span[hello="Cleveland"][goodbye="Columbus"]`, map[string]string{"hello": "Cleveland", "goodbye": "columbus"}, false},
+		{`a[rel~="copyright"]`, map[string]string{"rel": "nofollow\tcopyright"}, true},
+		{`a[rel~="copyright"]`, map[string]string{"rel": "copyrights"}, false},
+		{`a[rel~="copyright"]`, map[string]string{"rel": "nofollow\u00a0copyright"}, false},
+		{`a[rel~="a b"]`, map[string]string{"rel": "a b"}, false},
+		{`a[rel~=""]`, map[string]string{"rel": ""}, false},
+		{`a[hreflang=fr]`, map[string]string{"hreflang": "fr"}, true},
+		{`a[hreflang|="en"]`, map[string]string{"hreflang": "en"}, true},
+		{`a[hreflang|="en"]`, map[string]string{"hreflang": "en-US"}, true},
+		{`a[hreflang|="en"]`, map[string]string{"hreflang": "english"}, false},
+		{`object[type^="image/"]`, map[string]string{"type": "image/png"}, true},
+		{`object[type^=""]`, map[string]string{"type": "image/png"}, false},
+		{`a[href$=".html"]`, map[string]string{"href": "/a.html"}, true},
+		{`a[href$=".html"]`, map[string]string{"href": "/a.HTML"}, false},
+		{`p[title*="hello"]`, map[string]string{"title": "oh, hello!"}, true},
+		{`p[title*="hello"]`, map[string]string{"title": "Hello"}, false},
+		{`[frame=hsides i]`, map[string]string{"frame": "HSIDES"}, true},
+		{`[data-x=a i]`, map[string]string{"data-x": "A"}, true},
+		{`[data-x^=a I]`, map[string]string{"data-x": "Ab"}, true},
+		{`[data-x=k i]`, map[string]string{"data-x": "\u212a"}, false},
+		{`input[type="a"]`, map[string]string{"type": "A"}, true},
+		{`input[type="a" s]`, map[string]string{"type": "A"}, false},
+		{`input[type="a" s]`, map[string]string{"type": "a"}, true},
+		{`input[data-type="a"]`, map[string]string{"data-type": "A"}, false},
+		{`[foo|att=val]`, map[string]string{"att": "val"}, false},
+		{`[*|att]`, map[string]string{"att": "val"}, true},
+		{`[|att]`, map[string]string{"att": "val"}, true},
+		{`[att]`, map[string]string{"att": "val"}, true},
+	} {
+		toks, _ := tokenizer.TokenizeAll([]byte(tc.src), nil)
+		l, err := ParseWithNamespaces(toks, namespaces)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		n := &node{tag: l[0].Compounds[0].Type, attrs: tc.attrs}
+		var m Matcher
+		if got := m.Match(l, n); got != tc.want {
+			t.Errorf("%s on %v: got %v, want %v", tc.src, tc.attrs, got, tc.want)
+		}
+	}
+
+	// [foo|att=val] matches only the attribute in the foo namespace, and
+	// [att] only the one in no namespace
+	el := &nsNode{node: tree("x"), ns: HTMLNamespace, attrsNS: map[string]string{example + " att": "val", "other att": "x"}}
+	for _, tc := range []struct {
+		src  string
+		want bool
+	}{
+		{`[foo|att=val]`, true},
+		{`[*|att]`, true},
+		{`[|att]`, false},
+		{`[att]`, false},
+	} {
+		toks, _ := tokenizer.TokenizeAll([]byte(tc.src), nil)
+		l, err := ParseWithNamespaces(toks, namespaces)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.src, err)
+		}
+		var m Matcher
+		if got := m.Match(l, el); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package sourcemap reads version 3 source maps, so that positions in a
+generated stylesheet (from Sass, Less, PostCSS, and so on) can be traced back
+to the files the author edited.
+
+	m, err := sourcemap.Parse(mapJSON)
+	...
+	_, diags := tokenizer.TokenizeAll(css, nil)
+	for _, d := range diags {
+		if pos, ok := m.LookupOffset(css, d.Err.Loc); ok {
+			fmt.Printf("%s:%d:%d: %v\n", pos.Source, pos.Line+1, pos.Column+1, d)
+		}
+	}
+
+Lines and columns are zero-based, and columns are counted in UTF-16 code
+units, as in the source map format itself.
+*/
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Map is a parsed source map.
+type Map struct {
+	// File is the name of the generated file, if the map gives one.
+	File string
+	// Sources are the original files, with the map's sourceRoot applied.
+	Sources []string
+	// SourcesContent holds the text of each source, if the map includes it.
+	// Missing entries are empty.
+	SourcesContent []string
+	// Names are the original identifiers referred to by mappings.
+	Names []string
+
+	// mappings for each generated line, sorted by column
+	lines [][]mapping
+}
+
+type mapping struct {
+	genCol  int
+	source  int // -1 if the segment maps to nothing
+	line    int
+	col     int
+	nameIdx int // -1 if none
+}
+
+// Position is a location in an original source file.
+type Position struct {
+	Source string
+	Line   int
+	Column int
+	// Name is the original identifier at the position, if the map gives one.
+	Name string
+}
+
+type rawMap struct {
+	Version        int        `json:"version"`
+	File           string     `json:"file"`
+	SourceRoot     string     `json:"sourceRoot"`
+	Sources        []string   `json:"sources"`
+	SourcesContent []*string  `json:"sourcesContent"`
+	Names          []string   `json:"names"`
+	Mappings       string     `json:"mappings"`
+	Sections       []struct{} `json:"sections"`
+}
+
+// Parse parses the JSON of a version 3 source map.  Index maps (maps with
+// "sections") are not supported.
+func Parse(data []byte) (*Map, error) {
+	// maps served over HTTP may start with this to prevent XSSI
+	if len(data) > 3 && string(data[:3]) == ")]}" {
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			data = data[i+1:]
+		}
+	}
+	var raw rawMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("sourcemap: unsupported version %d", raw.Version)
+	}
+	if raw.Sections != nil {
+		return nil, errors.New("sourcemap: index maps are not supported")
+	}
+	m := &Map{
+		File:           raw.File,
+		Sources:        make([]string, len(raw.Sources)),
+		SourcesContent: make([]string, len(raw.Sources)),
+		Names:          raw.Names,
+	}
+	root := raw.SourceRoot
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	for i, s := range raw.Sources {
+		m.Sources[i] = root + s
+		if i < len(raw.SourcesContent) && raw.SourcesContent[i] != nil {
+			m.SourcesContent[i] = *raw.SourcesContent[i]
+		}
+	}
+	if err := m.parseMappings(raw.Mappings); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Map) parseMappings(s string) error {
+	var source, line, col, nameIdx int
+	for _, lineStr := range strings.Split(s, ";") {
+		var segs []mapping
+		genCol := 0
+		for _, seg := range strings.Split(lineStr, ",") {
+			if seg == "" {
+				continue
+			}
+			var fields [5]int
+			n := 0
+			for seg != "" {
+				if n == len(fields) {
+					return errors.New("sourcemap: too many fields in mapping segment")
+				}
+				v, rest, err := decodeVLQ(seg)
+				if err != nil {
+					return err
+				}
+				fields[n] = v
+				n++
+				seg = rest
+			}
+			if n != 1 && n != 4 && n != 5 {
+				return fmt.Errorf("sourcemap: mapping segment has %d fields", n)
+			}
+			genCol += fields[0]
+			mp := mapping{genCol: genCol, source: -1, nameIdx: -1}
+			if n >= 4 {
+				source += fields[1]
+				line += fields[2]
+				col += fields[3]
+				if source < 0 || source >= len(m.Sources) {
+					return fmt.Errorf("sourcemap: source index %d out of range", source)
+				}
+				mp.source, mp.line, mp.col = source, line, col
+			}
+			if n == 5 {
+				nameIdx += fields[4]
+				if nameIdx < 0 || nameIdx >= len(m.Names) {
+					return fmt.Errorf("sourcemap: name index %d out of range", nameIdx)
+				}
+				mp.nameIdx = nameIdx
+			}
+			segs = append(segs, mp)
+		}
+		sort.Stable(byGenCol(segs))
+		m.lines = append(m.lines, segs)
+	}
+	return nil
+}
+
+type byGenCol []mapping
+
+func (b byGenCol) Len() int           { return len(b) }
+func (b byGenCol) Less(i, j int) bool { return b[i].genCol < b[j].genCol }
+func (b byGenCol) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decodeVLQ decodes one base64 VLQ value from the start of s.
+func decodeVLQ(s string) (v int, rest string, err error) {
+	var u uint
+	shift := uint(0)
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base64Digits, s[i])
+		if d == -1 {
+			return 0, "", fmt.Errorf("sourcemap: invalid character %q in mappings", s[i])
+		}
+		if shift > 25 {
+			// values are limited to 32 bits in practice; stop well before
+			// overflowing a 32-bit int
+			return 0, "", errors.New("sourcemap: mapping value out of range")
+		}
+		u |= uint(d&31) << shift
+		shift += 5
+		if d&32 == 0 {
+			v = int(u >> 1)
+			if u&1 != 0 {
+				v = -v
+			}
+			return v, s[i+1:], nil
+		}
+	}
+	return 0, "", errors.New("sourcemap: truncated mapping value")
+}
+
+// Lookup returns the original position of the given line and column of the
+// generated file.  The mapping that starts at or most closely before the
+// column on the same line is used.  ok is false if there is none, or if that
+// part of the line is not mapped to any source.
+func (m *Map) Lookup(line, col int) (pos Position, ok bool) {
+	if line < 0 || line >= len(m.lines) {
+		return Position{}, false
+	}
+	segs := m.lines[line]
+	i := sort.Search(len(segs), func(i int) bool { return segs[i].genCol > col })
+	if i == 0 {
+		return Position{}, false
+	}
+	mp := segs[i-1]
+	if mp.source == -1 {
+		return Position{}, false
+	}
+	pos = Position{
+		Source: m.Sources[mp.source],
+		Line:   mp.line,
+		Column: mp.col,
+	}
+	if mp.nameIdx != -1 {
+		pos.Name = m.Names[mp.nameIdx]
+	}
+	return pos, true
+}
+
+// LookupOffset is like Lookup, but takes a byte offset in the generated
+// stylesheet src, such as the Loc of a tokenizer.ParseError.
+func (m *Map) LookupOffset(src []byte, off int) (Position, bool) {
+	return m.Lookup(tokenizer.OffsetToUTF16Position(src, off))
+}
+
+// FindURL returns the URL given by the last sourceMappingURL comment in the
+// stylesheet src, or "" if there is none.
+func FindURL(src []byte) string {
+	toks, _ := tokenizer.TokenizeAll(src, nil)
+	for i := len(toks) - 1; i >= 0; i-- {
+		if toks[i].CommentKind() == tokenizer.CommentSourceMap {
+			v := strings.TrimSpace(toks[i].Value[1:])
+			v = strings.TrimPrefix(v, "sourceMappingURL=")
+			if j := strings.IndexAny(v, " \t\n"); j != -1 {
+				v = v[:j]
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+// DecodeDataURL returns the contents of a base64 "data:" URL, which is how
+// inline source maps are embedded in a stylesheet.
+func DecodeDataURL(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return nil, errors.New("sourcemap: not a data URL")
+	}
+	comma := strings.IndexByte(url, ',')
+	if comma == -1 {
+		return nil, errors.New("sourcemap: malformed data URL")
+	}
+	if !strings.HasSuffix(url[:comma], ";base64") {
+		return nil, errors.New("sourcemap: only base64 data URLs are supported")
+	}
+	return base64.StdEncoding.DecodeString(url[comma+1:])
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Kane York.
+
+package sourcemap
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// A hand-written map for testCSS, as if it had been compiled from:
+//
+//	a.scss                 b.scss
+//	$c: red;               .b { x: y }
+//	.a {
+//	  color: $c;
+//	}
+const testCSS = ".a {\n  color: red; }\n\n.b {\n  x: y; }\n\n/*# sourceMappingURL=out.css.map */\n"
+
+const testMap = `)]}'
+{
+	"version": 3,
+	"file": "out.css",
+	"sourceRoot": "src",
+	"sources": ["a.scss", "b.scss"],
+	"sourcesContent": ["$c: red;\n.a {\n  color: $c;\n}\n", null],
+	"names": ["color"],
+	"mappings": "AACA,EAAG;EACDA,KAAK,EAAE,GAAG;;ACFZ,EAAE;EAAE,CAAC,EAAE"
+}`
+
+func TestLookup(t *testing.T) {
+	m, err := Parse([]byte(testMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.File != "out.css" || len(m.Sources) != 2 || m.Sources[1] != "src/b.scss" {
+		t.Errorf("bad header: %+v", m)
+	}
+	if m.SourcesContent[0] == "" || m.SourcesContent[1] != "" {
+		t.Errorf("bad sourcesContent: %q", m.SourcesContent)
+	}
+
+	for _, tc := range []struct {
+		line, col int
+		want      Position
+		ok        bool
+	}{
+		{0, 0, Position{"src/a.scss", 1, 0, ""}, true},
+		{0, 1, Position{"src/a.scss", 1, 0, ""}, true},
+		{0, 2, Position{"src/a.scss", 1, 3, ""}, true},
+		{1, 0, Position{}, false},
+		{1, 2, Position{"src/a.scss", 2, 2, "color"}, true},
+		{1, 7, Position{"src/a.scss", 2, 7, ""}, true},
+		{1, 9, Position{"src/a.scss", 2, 9, ""}, true},
+		{1, 50, Position{"src/a.scss", 2, 12, ""}, true},
+		{2, 0, Position{}, false},
+		{3, 0, Position{"src/b.scss", 0, 0, ""}, true},
+		{4, 5, Position{"src/b.scss", 0, 7, ""}, true},
+		{9, 0, Position{}, false},
+		{-1, 0, Position{}, false},
+	} {
+		got, ok := m.Lookup(tc.line, tc.col)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Lookup(%d, %d) = %+v, %v; want %+v, %v", tc.line, tc.col, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	// the "color" on line 1
+	if got, ok := m.LookupOffset([]byte(testCSS), 7); !ok || got.Name != "color" {
+		t.Errorf("LookupOffset: got %+v, %v", got, ok)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		`{"version": 2, "mappings": ""}`,
+		`{"version": 3, "sections": []}`,
+		`{"version": 3, "sources": [], "mappings": "AAAA"}`,
+		`{"version": 3, "sources": ["a"], "mappings": "AA"}`,
+		`{"version": 3, "sources": ["a"], "mappings": "AAAg"}`,
+		`{"version": 3, "sources": ["a"], "mappings": "AA!A"}`,
+		`{"version": 3, "sources": ["a"], "mappings": "AAAAC"}`,
+		`{"version": 3, "sources": ["a"], "mappings": "//////A"}`,
+		`not json`,
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("Parse(%s): no error", src)
+		}
+	}
+}
+
+func TestDecodeVLQ(t *testing.T) {
+	var got []int
+	s := "AAgBCD/////H"
+	for s != "" {
+		v, rest, err := decodeVLQ(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+		s = rest
+	}
+	want := []int{0, 0, 16, 1, -1, -(1<<27 - 1)}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestFindURL(t *testing.T) {
+	if got := FindURL([]byte(testCSS)); got != "out.css.map" {
+		t.Errorf("FindURL: got %q", got)
+	}
+	if got := FindURL([]byte("a{}/* sourceMappingURL=x */")); got != "" {
+		t.Errorf("FindURL: got %q for an ordinary comment", got)
+	}
+
+	url := "data:application/json;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte(testMap))
+	data, err := DecodeDataURL(url)
+	if err != nil || string(data) != testMap {
+		t.Errorf("DecodeDataURL: %q, %v", data, err)
+	}
+	if _, err := DecodeDataURL("data:application/json,{}"); err == nil {
+		t.Errorf("DecodeDataURL: no error for a non-base64 URL")
+	}
+}
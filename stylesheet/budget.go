@@ -0,0 +1,65 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strconv"
+
+	"github.com/riking/cssparse/parser"
+)
+
+// Budget is the limits CheckBudget holds a stylesheet to, for failing a
+// CI build that makes it too big.  A zero limit is no limit.  It has tags
+// for encoding/json, so a budget can be kept in a configuration file.
+//
+// There is no limit on the size of a stylesheet after minification, as
+// this package has no minifier; that is the only budget that needs one.
+type Budget struct {
+	// MaxSelectors is the number of selectors allowed, counting each
+	// selector of a list, as Statistics does.  Internet Explorer 9 and
+	// older ignore the rules after the first 4095 selectors.
+	MaxSelectors int `json:"maxSelectors,omitempty"`
+	// MaxDeclarations is the number of declarations allowed, and MaxRules
+	// the number of style rules, nested ones included.
+	MaxDeclarations int `json:"maxDeclarations,omitempty"`
+	MaxRules        int `json:"maxRules,omitempty"`
+}
+
+// CheckBudget reports each limit of b that s goes over.  Each error is a
+// *parser.Error with the Index of the rule that first goes over the limit,
+// whose message gives the count, the limit, and that rule, such as
+// "stylesheet: 4100 selectors, over the budget of 4095 from the rule
+// .nav a, .nav b".
+func CheckBudget(s *Stylesheet, b *Budget) []error {
+	var errs []error
+	var selectors, declarations, rules int
+	var overSelectors, overDeclarations, overRules *Rule
+	walk(s.Rules, func(r *Rule) {
+		if r.AtKeyword == "" {
+			selectors += len(parser.SplitCommas(r.Prelude))
+			rules++
+		}
+		declarations += len(r.Declarations)
+		if b.MaxSelectors > 0 && selectors > b.MaxSelectors && overSelectors == nil {
+			overSelectors = r
+		}
+		if b.MaxDeclarations > 0 && declarations > b.MaxDeclarations && overDeclarations == nil {
+			overDeclarations = r
+		}
+		if b.MaxRules > 0 && rules > b.MaxRules && overRules == nil {
+			overRules = r
+		}
+	})
+	report := func(over *Rule, n, max int, what string) {
+		if over == nil {
+			return
+		}
+		msg := "stylesheet: " + strconv.Itoa(n) + " " + what + ", over the budget of " + strconv.Itoa(max) +
+			" from the rule " + normalizedHead(over)
+		errs = append(errs, &parser.Error{Message: msg, Index: over.Index})
+	}
+	report(overSelectors, selectors, b.MaxSelectors, "selectors")
+	report(overDeclarations, declarations, b.MaxDeclarations, "declarations")
+	report(overRules, rules, b.MaxRules, "style rules")
+	return errs
+}
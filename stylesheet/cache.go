@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Cache holds parsed stylesheets by the SHA-256 hash of their source, for
+// servers that parse the same stylesheets again and again, such as those
+// of the templates they render.  It is safe for use by many goroutines at
+// once, and each source is parsed only once: a Parse of a source that
+// another goroutine is parsing waits for it.  The zero Cache is empty and
+// ready to use.
+//
+// The stylesheets in the cache are never given out, so no pass can change
+// them; Parse returns a Clone, which shares the tokens of the cached one.
+// A Cache keeps every stylesheet it has parsed, so it should only be given
+// sources from a fixed set, such as the files of a site.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*cacheEntry
+}
+
+// cacheEntry is a source in a Cache, whose done is closed once it is
+// parsed.
+type cacheEntry struct {
+	done  chan struct{}
+	sheet *Stylesheet
+	errs  []error
+}
+
+// Parse returns src parsed, with the errors of tokenizing and parsing it,
+// as Parse does after tokenizer.TokenizeAll, from the cache if src was
+// parsed before.
+func (c *Cache) Parse(src []byte) (*Stylesheet, []error) {
+	key := sha256.Sum256(src)
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[[sha256.Size]byte]*cacheEntry)
+	}
+	e, ok := c.entries[key]
+	if !ok {
+		e = &cacheEntry{done: make(chan struct{})}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-e.done
+	} else {
+		toks, diags := tokenizer.TokenizeAll(src, nil)
+		for _, d := range diags {
+			e.errs = append(e.errs, d)
+		}
+		sheet, errs := Parse(toks)
+		e.sheet, e.errs = sheet, append(e.errs, errs...)
+		close(e.done)
+	}
+	return e.sheet.Clone(), append([]error(nil), e.errs...)
+}
+
+// Len returns the number of sources in c.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// lengthUnits are the units of lengths, which may be left off a zero.
+var lengthUnits = map[string]bool{
+	"px": true, "em": true, "rem": true, "ex": true, "ch": true, "vw": true, "vh": true,
+	"vmin": true, "vmax": true, "cm": true, "mm": true, "q": true, "in": true, "pt": true, "pc": true,
+}
+
+// unitZeroProperties are the properties where a zero length and the
+// number zero mean different things, as in "flex: 1 1 0px", where a
+// number would be the flex shrink factor.
+var unitZeroProperties = map[string]bool{"flex": true, "line-height": true}
+
+// Canonicalize rewrites the declarations of s throughout in one form, so
+// that equal values are written the same way:
+//
+//   - Property names are lowercased, other than custom properties.
+//   - Hex colors and units are lowercased.
+//   - Zero lengths lose their units, such as "0px" to "0", other than in
+//     functions such as calc(), where the unit is needed, and in the
+//     properties where a number means something else, such as flex.
+//   - The quotes of url() and of font family names are dropped where the
+//     value means the same without them.
+//   - Whitespace is collapsed, and comments removed, as Diff does.
+//
+// The values of custom properties are only collapsed, as they may be used
+// anywhere.  A url() without quotes is given as a tokenizer.TokenRaw,
+// since a tokenizer.TokenURI is always rendered quoted, so Canonicalize is
+// best run after the passes that look at values.  The rules that a
+// directive disables "canonicalize" for are left as they are.
+func Canonicalize(s *Stylesheet) {
+	walk(s.Rules, func(r *Rule) {
+		if r.Disabled("canonicalize") {
+			return
+		}
+		decls := make([]parser.Declaration, len(r.Declarations))
+		for i, d := range r.Declarations {
+			if strings.HasPrefix(d.Name, "--") {
+				d.Value = collapseSpace(d.Value)
+			} else {
+				d.Name = strings.ToLower(d.Name)
+				d.Value = canonicalValue(d.Name, normalize(d.Value))
+			}
+			decls[i] = d
+		}
+		r.Declarations = decls
+	})
+}
+
+// canonicalValue returns the canonical form of the normalized value toks
+// of the property name.
+func canonicalValue(name string, toks []tokenizer.Token) []tokenizer.Token {
+	_, base := unprefix(name)
+	return mapValues(toks, func(cv []tokenizer.Token) []tokenizer.Token {
+		t := cv[0]
+		switch {
+		case len(cv) > 1 || t.Type == tokenizer.TokenURI:
+			return canonicalFunction(cv)
+		case t.Type == tokenizer.TokenDimension && isZero(t) && lengthUnits[strings.ToLower(t.Extra.(*tokenizer.TokenExtraNumeric).Dimension)] && !unitZeroProperties[base]:
+			return []tokenizer.Token{tokenizer.NewNumber(0)}
+		case t.Type == tokenizer.TokenString && (base == "font-family" || base == "font"):
+			return canonicalFamily(t)
+		}
+		return []tokenizer.Token{canonicalToken(t)}
+	})
+}
+
+// mapValues returns toks with each of its component values replaced by
+// what fn returns for it, keeping the whitespace between them.
+func mapValues(toks []tokenizer.Token, fn func(cv []tokenizer.Token) []tokenizer.Token) []tokenizer.Token {
+	out := make([]tokenizer.Token, 0, len(toks))
+	pos := 0
+	for _, cv := range parser.ComponentValues(toks) {
+		for ; toks[pos].Type == tokenizer.TokenS || toks[pos].Type == tokenizer.TokenComment; pos++ {
+			out = append(out, toks[pos])
+		}
+		out = append(out, fn(cv)...)
+		pos += len(cv)
+	}
+	return append(out, toks[pos:]...)
+}
+
+// canonicalFunction returns the url() or the function or block cv with
+// the hex colors and units in it lowercased, and the url()s in it
+// unquoted.  The units of zeros are kept.
+func canonicalFunction(cv []tokenizer.Token) []tokenizer.Token {
+	switch {
+	case cv[0].Type == tokenizer.TokenURI:
+		return []tokenizer.Token{canonicalURL(cv[0].Value)}
+	case len(cv) == 3 && tokenizer.IdentEquals(cv[0].Value, "url") && cv[1].Type == tokenizer.TokenString:
+		return []tokenizer.Token{canonicalURL(cv[1].Value)}
+	case len(cv) == 1:
+		return []tokenizer.Token{canonicalToken(cv[0])}
+	}
+	out := append([]tokenizer.Token{cv[0]}, mapValues(cv[1:len(cv)-1], canonicalFunction)...)
+	return append(out, cv[len(cv)-1])
+}
+
+// canonicalToken returns t with the letters of a hex color or unit
+// lowercased.
+func canonicalToken(t tokenizer.Token) tokenizer.Token {
+	switch t.Type {
+	case tokenizer.TokenHash:
+		if _, _, _, _, ok := t.HexColor(); ok && t.Value != strings.ToLower(t.Value) {
+			return tokenizer.NewHash(strings.ToLower(t.Value))
+		}
+	case tokenizer.TokenDimension:
+		e := *t.Extra.(*tokenizer.TokenExtraNumeric)
+		if unit := strings.ToLower(e.Dimension); unit != e.Dimension {
+			e.Dimension = unit
+			t.Extra = &e
+		}
+	}
+	return t
+}
+
+func isZero(t tokenizer.Token) bool {
+	f, ok := t.Float()
+	return ok && f == 0
+}
+
+// canonicalURL returns url() for the URL u, without quotes if it can be
+// written so.
+func canonicalURL(u string) tokenizer.Token {
+	if u == "" || strings.IndexFunc(u, func(c rune) bool {
+		return c <= ' ' || c == 0x7f || strings.ContainsRune("\"'()\\", c)
+	}) >= 0 {
+		return tokenizer.NewURL(u)
+	}
+	return tokenizer.NewRaw("url(" + u + ")")
+}
+
+// canonicalFamily returns the quoted font family name t as identifiers,
+// if it can be written so.
+func canonicalFamily(t tokenizer.Token) []tokenizer.Token {
+	if values.FamilyNeedsQuotes(t.Value) {
+		return []tokenizer.Token{t}
+	}
+	var out []tokenizer.Token
+	for i, word := range strings.Split(t.Value, " ") {
+		if i > 0 {
+			out = append(out, space)
+		}
+		out = append(out, tokenizer.NewIdent(word))
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/values"
+)
+
+// Match is a style rule that matches an element.  This package has no
+// selector matching; the caller finds the rules that match, and their
+// specificities.
+type Match struct {
+	Declarations []parser.Declaration
+	// Specificity is that of the most specific selector of the rule that
+	// matches the element, as (ids, classes, types).
+	Specificity [3]int
+	// Layer is the full name of the cascade layer the rule is in, such as
+	// "base.reset", or "" if it is not in one.
+	Layer string
+	// Order is the position of the rule in document order, counting across
+	// all the stylesheets.
+	Order int
+}
+
+// Element is what Cascade needs to know about an element.
+type Element struct {
+	// Matches are the style rules that match the element.
+	Matches []Match
+	// Inline holds the declarations of the element's style attribute.
+	Inline []parser.Declaration
+	// Layers are the cascade layers in order of precedence, from lowest to
+	// highest, as atrules.LayerOrder gives them.  A layer that is not
+	// listed comes after those that are.
+	Layers []string
+}
+
+// cascadeKey is where a declaration stands in the cascade.
+type cascadeKey struct {
+	important   bool
+	inline      bool
+	layer       int
+	specificity [3]int
+	order       int
+	index       int
+}
+
+// beats reports whether a declaration at k wins over one at o.
+func (k cascadeKey) beats(o cascadeKey) bool {
+	switch {
+	case k.important != o.important:
+		return k.important
+	case k.inline != o.inline:
+		return k.inline
+	case k.layer != o.layer:
+		// the order of layers is reversed for !important declarations
+		return (k.layer > o.layer) != k.important
+	case k.specificity != o.specificity:
+		for i := range k.specificity {
+			if k.specificity[i] != o.specificity[i] {
+				return k.specificity[i] > o.specificity[i]
+			}
+		}
+	case k.order != o.order:
+		return k.order > o.order
+	}
+	return k.index > o.index
+}
+
+// Cascade returns the declaration that wins the cascade for each property
+// of e, keyed by the lowercased property name.  Only author styles are
+// considered.  Declarations win by importance, then by being in the style
+// attribute, then by cascade layer, specificity, and order of appearance.
+//
+// Shorthands are expanded with values.ExpandShorthand, so that a shorthand
+// and its longhands compete; the declarations returned for longhands may
+// be parts of a shorthand.  A shorthand that cannot be expanded, such as
+// one using var(), competes only with itself.
+func Cascade(e Element) map[string]parser.Declaration {
+	layers := make(map[string]int)
+	for i, name := range e.Layers {
+		layers[name] = i
+	}
+	unlayered := len(e.Layers) + 1
+
+	won := make(map[string]parser.Declaration)
+	keys := make(map[string]cascadeKey)
+	add := func(decls []parser.Declaration, k cascadeKey) {
+		for i, d := range decls {
+			k.important, k.index = d.Important, i
+			longhands, err := values.ExpandShorthand(d)
+			if err != nil {
+				longhands = []parser.Declaration{d}
+			}
+			for _, l := range longhands {
+				name := strings.ToLower(l.Name)
+				if strings.HasPrefix(l.Name, "--") {
+					// custom property names are case-sensitive
+					name = l.Name
+				}
+				if prev, ok := keys[name]; !ok || k.beats(prev) {
+					won[name], keys[name] = l, k
+				}
+			}
+		}
+	}
+	for _, m := range e.Matches {
+		layer, ok := layers[m.Layer]
+		switch {
+		case m.Layer == "":
+			layer = unlayered
+		case !ok:
+			layer = len(e.Layers)
+		}
+		add(m.Declarations, cascadeKey{layer: layer, specificity: m.Specificity, order: m.Order})
+	}
+	add(e.Inline, cascadeKey{inline: true})
+	return won
+}
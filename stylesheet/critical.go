@@ -0,0 +1,162 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// definitionRules are the at-rules that Critical keeps whole, as what uses
+// them is not worth tracking.
+var definitionRules = map[string]bool{
+	"property": true, "counter-style": true, "namespace": true, "font-feature-values": true,
+}
+
+// MatchesAny returns a function for Critical that reports whether a
+// selector matches any of nodes, such as the elements above the fold.
+func MatchesAny(m *selector.Matcher, nodes []selector.Node) func(c *selector.Complex) bool {
+	return func(c *selector.Complex) bool {
+		for _, n := range nodes {
+			if m.MatchComplex(c, n) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Critical returns a new stylesheet with only the parts of s that are
+// needed to style the elements matching selectors, for inlining into a
+// page as its critical CSS.  s is not changed.
+//
+// A style rule is kept, with only its matching selectors, if any of them
+// match.  Its nested rules are kept whole.  The at-rules grouping the rules
+// kept, such as @media, are kept with them, as are @layer statements,
+// which set the order of layers.  The @font-face rules for the font
+// families the rules kept use, and the @keyframes rules for their
+// animations, are kept too, as are the rules defining things such as
+// custom properties.  Anything else, such as @import, is left out, but a
+// rule with a keep directive is always kept whole.
+//
+// Rules whose selectors cannot be parsed are left out, and reported as
+// errors.
+func Critical(s *Stylesheet, matches func(c *selector.Complex) bool) (*Stylesheet, []error) {
+	var errs []error
+	out := &Stylesheet{Rules: criticalRules(s.Rules, s.Namespaces(), matches, &errs)}
+	out.Rules = pruneDefinitions(out.Rules, fontFamilies(out), animationNames(out))
+	return out, errs
+}
+
+// criticalRules returns copies of the rules that Critical keeps, with all
+// of the @font-face and @keyframes rules, for pruneDefinitions to remove
+// the ones not used.
+func criticalRules(rules []*Rule, namespaces map[string]string, matches func(*selector.Complex) bool, errs *[]error) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		kw := strings.ToLower(r.AtKeyword)
+		_, base := unprefix(kw)
+		switch {
+		case r.HasDirective("keep"):
+			out = append(out, r.Clone())
+		case r.AtKeyword == "":
+			l, err := selector.ParseWithNamespaces(r.Prelude, namespaces)
+			if err != nil {
+				*errs = append(*errs, errorf("cannot match %q: %v", render(r.Prelude), err))
+				continue
+			}
+			var kept selector.List
+			for _, c := range l {
+				if matches(c) {
+					kept = append(kept, c)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			c := r.Clone()
+			if len(kept) < len(l) {
+				c.Prelude = tokenize(kept.String())
+			}
+			out = append(out, c)
+		case kw == "layer" && !r.Block, definitionRules[kw], base == "keyframes", base == "font-face":
+			out = append(out, r.Clone())
+		case groupingRules[kw] || kw == "scope":
+			nested := criticalRules(r.Rules, namespaces, matches, errs)
+			if len(nested) == 0 && len(r.Declarations) == 0 {
+				continue
+			}
+			c := &Rule{AtKeyword: r.AtKeyword, Prelude: r.Prelude, Block: true, Rules: nested}
+			c.Declarations = append(c.Declarations, r.Declarations...)
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// pruneDefinitions removes the @font-face rules for families not in
+// families and the @keyframes rules not in keyframes, along with the
+// grouping rules that are left empty.
+func pruneDefinitions(rules []*Rule, families, keyframes map[string]bool) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		_, base := unprefix(r.AtKeyword)
+		switch {
+		case r.HasDirective("keep"):
+		case base == "keyframes" && !keyframes[keyframesName(r)]:
+			continue
+		case base == "font-face" && !usesFamily(r, families):
+			continue
+		case r.AtKeyword != "" && len(r.Rules) > 0:
+			r.Rules = pruneDefinitions(r.Rules, families, keyframes)
+			if len(r.Rules) == 0 && len(r.Declarations) == 0 {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// fontFamilies returns the lowercased font family names used by the
+// font-family and font properties in s, and by custom properties that may
+// be used in them.
+func fontFamilies(s *Stylesheet) map[string]bool {
+	names := make(map[string]bool)
+	walk(s.Rules, func(r *Rule) {
+		if _, base := unprefix(r.AtKeyword); base == "font-face" {
+			return
+		}
+		for _, d := range r.Declarations {
+			var families []values.FontFamily
+			switch {
+			case tokenizer.IdentEquals(d.Name, "font-family") || strings.HasPrefix(d.Name, "--"):
+				families, _ = values.ParseFontFamily(d.Value)
+			case tokenizer.IdentEquals(d.Name, "font"):
+				if f, err := values.ParseFont(d.Value); err == nil {
+					families = f.Families
+				}
+			}
+			for _, f := range families {
+				names[strings.ToLower(f.Name)] = true
+			}
+		}
+	})
+	return names
+}
+
+// usesFamily reports whether the @font-face rule r is for one of the
+// families.
+func usesFamily(r *Rule, families map[string]bool) bool {
+	for _, d := range r.Declarations {
+		if !tokenizer.IdentEquals(d.Name, "font-family") {
+			continue
+		}
+		fs, err := values.ParseFontFamily(d.Value)
+		return err == nil && len(fs) == 1 && families[strings.ToLower(fs[0].Name)]
+	}
+	return false
+}
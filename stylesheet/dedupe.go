@@ -0,0 +1,152 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Dedupe removes the repeated parts of s throughout, without changing what
+// it does:
+//
+//   - A declaration is removed if a later one in the same block sets the
+//     same property with a value of the same types, such as "1px" and
+//     "2px", and is no less important.  Earlier declarations with other
+//     types, such as "100px" before "50vw", or other keywords, are kept, as
+//     they are fallbacks for browsers that do not support the later ones.
+//   - Adjacent style rules with the same selectors are merged.
+//   - Adjacent style rules with the same declarations are merged into one
+//     with a selector list, if their selectors can be parsed and use no
+//     vendor-prefixed pseudo-classes or pseudo-elements, any of which
+//     would make a browser drop the whole list.
+//
+// Only adjacent rules are merged, as moving a rule past others can change
+// which of them wins.  A rule with nested rules is not merged with a later
+// one, as that would move the declarations of the later rule before the
+// nested rules.  The rules that a directive disables "dedupe" for are left
+// as they are.
+func Dedupe(s *Stylesheet) {
+	s.Rules = dedupeRules(s.Rules, s.Namespaces())
+}
+
+func dedupeRules(rules []*Rule, namespaces map[string]string) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		r.Rules = dedupeRules(r.Rules, namespaces)
+		if r.Disabled("dedupe") {
+			out = append(out, r)
+			continue
+		}
+		r.Declarations = dedupeDeclarations(r.Declarations)
+		if len(out) == 0 {
+			out = append(out, r)
+			continue
+		}
+		prev := out[len(out)-1]
+		if !isStyleRule(prev) || !isStyleRule(r) || len(prev.Rules) > 0 || prev.Disabled("dedupe") {
+			out = append(out, r)
+			continue
+		}
+		switch {
+		case normalizedHead(prev) == normalizedHead(r):
+			prev.Declarations = dedupeDeclarations(append(prev.Declarations, r.Declarations...))
+			prev.Rules = r.Rules
+		case len(r.Rules) == 0 && sameDeclarations(prev.Declarations, r.Declarations) &&
+			mergeable(prev.Prelude, namespaces) && mergeable(r.Prelude, namespaces):
+			prelude := append([]tokenizer.Token(nil), prev.Prelude...)
+			prelude = append(prelude, tokenizer.Token{Type: tokenizer.TokenComma, Value: ","}, space)
+			prev.Prelude = append(prelude, r.Prelude...)
+		default:
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func isStyleRule(r *Rule) bool {
+	return r.AtKeyword == "" && r.Block
+}
+
+// dedupeDeclarations removes the declarations that a later one with a
+// value of the same types overrides.
+func dedupeDeclarations(decls []parser.Declaration) []parser.Declaration {
+	var out []parser.Declaration
+	for i, d := range decls {
+		if !overriddenLater(d, decls[i+1:]) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func overriddenLater(d parser.Declaration, later []parser.Declaration) bool {
+	key := propertyKey(d.Name)
+	for _, l := range later {
+		if propertyKey(l.Name) == key && (l.Important || !d.Important) && valueTypes(l.Value) == valueTypes(d.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueTypes returns the types of the tokens of a value, with the
+// keywords, function names, and units that a browser may not support, so
+// that values with the same types are supported alike.
+func valueTypes(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	for _, t := range normalize(toks) {
+		buf.WriteString(t.Type.String())
+		switch t.Type {
+		case tokenizer.TokenIdent, tokenizer.TokenFunction, tokenizer.TokenDelim:
+			buf.WriteString(strings.ToLower(t.Value))
+		case tokenizer.TokenDimension:
+			buf.WriteString(strings.ToLower(t.Extra.(*tokenizer.TokenExtraNumeric).Dimension))
+		}
+		buf.WriteByte(' ')
+	}
+	return buf.String()
+}
+
+// sameDeclarations reports whether a and b set the same properties to the
+// same values, in the same order.
+func sameDeclarations(a, b []parser.Declaration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if propertyKey(a[i].Name) != propertyKey(b[i].Name) || normalizedValue(a[i]) != normalizedValue(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeable reports whether a selector can be put in a list with others.
+func mergeable(prelude []tokenizer.Token, namespaces map[string]string) bool {
+	l, err := selector.ParseWithNamespaces(prelude, namespaces)
+	if err != nil {
+		return false
+	}
+	return !hasPrefixedPseudo(l)
+}
+
+func hasPrefixedPseudo(l selector.List) bool {
+	for _, c := range l {
+		for _, cp := range c.Compounds {
+			for _, s := range cp.Simples {
+				if (s.Kind == selector.PseudoClass || s.Kind == selector.PseudoElement) && strings.HasPrefix(s.Name, "-") {
+					return true
+				}
+				if hasPrefixedPseudo(s.Args) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed
+)
+
+var changeKindNames = [...]string{Added: "added", Removed: "removed", Changed: "changed"}
+
+func (k ChangeKind) String() string {
+	return changeKindNames[k]
+}
+
+// MarshalText returns the name of k, such as "added", so that it is a
+// string in JSON.
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Change is a rule or declaration that was added, removed, or changed
+// between two stylesheets.  It has tags for encoding/json, so a list of
+// changes can be written as a JSON report.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	// Rules holds the heads of the rules enclosing the change, outermost
+	// first, ending with the rule added, removed, or holding the
+	// declaration.
+	Rules []string `json:"rules"`
+	// Property is the name of the declaration, or empty if a whole rule was
+	// added or removed.
+	Property string `json:"property,omitempty"`
+	// Old and New are the values of the declaration, with "!important" if
+	// it is, or the whole rule if it was removed or added.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// String returns c as a line of a report, such as
+// "changed @media print / a: color: red -> blue".
+func (c Change) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(c.Kind.String())
+	buf.WriteByte(' ')
+	if c.Property == "" {
+		for _, head := range c.Rules[:len(c.Rules)-1] {
+			buf.WriteString(head)
+			buf.WriteString(" / ")
+		}
+		if c.Kind == Removed {
+			buf.WriteString(c.Old)
+		} else {
+			buf.WriteString(c.New)
+		}
+		return buf.String()
+	}
+	buf.WriteString(strings.Join(c.Rules, " / "))
+	buf.WriteString(": ")
+	buf.WriteString(c.Property)
+	buf.WriteString(": ")
+	switch c.Kind {
+	case Added:
+		buf.WriteString(c.New)
+	case Removed:
+		buf.WriteString(c.Old)
+	case Changed:
+		buf.WriteString(c.Old)
+		buf.WriteString(" -> ")
+		buf.WriteString(c.New)
+	}
+	return buf.String()
+}
+
+// Report returns changes as text, one to a line.
+func Report(changes []Change) string {
+	var buf bytes.Buffer
+	for _, c := range changes {
+		buf.WriteString(c.String())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// Diff returns the rules and declarations that differ between a and b, for
+// reviewing the changes to generated CSS.  Formatting is ignored:
+// comments, whitespace that does not change the meaning, and the quotes
+// and escapes of strings.
+//
+// Rules are paired by their at-keywords and preludes, and declarations by
+// their property names, in the order they appear in each block.  So a rule
+// whose selector changed shows as removed and added, and rules or
+// declarations that were only moved do not show at all.  The removed and
+// changed parts of a block come first, in the order of a, followed by the
+// added ones, in the order of b.
+func Diff(a, b *Stylesheet) []Change {
+	var changes []Change
+	diffRules(a.Rules, b.Rules, nil, &changes)
+	return changes
+}
+
+func diffRules(a, b []*Rule, path []string, changes *[]Change) {
+	paired := pair(len(a), len(b), func(i int) string { return ruleKey(a[i]) }, func(j int) string { return ruleKey(b[j]) })
+	matched := make([]bool, len(b))
+	for i, r := range a {
+		head := normalizedHead(r)
+		at := append(path[:len(path):len(path)], head)
+		j := paired[i]
+		if j < 0 {
+			*changes = append(*changes, Change{Kind: Removed, Rules: at, Old: normalizedRule(r)})
+			continue
+		}
+		matched[j] = true
+		diffDeclarations(r.Declarations, b[j].Declarations, at, changes)
+		diffRules(r.Rules, b[j].Rules, at, changes)
+	}
+	for j, r := range b {
+		if !matched[j] {
+			at := append(path[:len(path):len(path)], normalizedHead(r))
+			*changes = append(*changes, Change{Kind: Added, Rules: at, New: normalizedRule(r)})
+		}
+	}
+}
+
+func diffDeclarations(a, b []parser.Declaration, path []string, changes *[]Change) {
+	paired := pair(len(a), len(b), func(i int) string { return propertyKey(a[i].Name) }, func(j int) string { return propertyKey(b[j].Name) })
+	matched := make([]bool, len(b))
+	for i, d := range a {
+		j := paired[i]
+		if j < 0 {
+			*changes = append(*changes, Change{Kind: Removed, Rules: path, Property: d.Name, Old: normalizedValue(d)})
+			continue
+		}
+		matched[j] = true
+		if before, after := normalizedValue(d), normalizedValue(b[j]); before != after {
+			*changes = append(*changes, Change{Kind: Changed, Rules: path, Property: b[j].Name, Old: before, New: after})
+		}
+	}
+	for j, d := range b {
+		if !matched[j] {
+			*changes = append(*changes, Change{Kind: Added, Rules: path, Property: d.Name, New: normalizedValue(d)})
+		}
+	}
+}
+
+// pair pairs the items of two lists by key, the nth of a key in one list
+// with the nth in the other, and returns the index in b paired with each
+// item in a, or -1.
+func pair(na, nb int, keyA, keyB func(int) string) []int {
+	found := make(map[string][]int)
+	for j := 0; j < nb; j++ {
+		k := keyB(j)
+		found[k] = append(found[k], j)
+	}
+	paired := make([]int, na)
+	for i := range paired {
+		k := keyA(i)
+		if js := found[k]; len(js) > 0 {
+			paired[i] = js[0]
+			found[k] = js[1:]
+		} else {
+			paired[i] = -1
+		}
+	}
+	return paired
+}
+
+func ruleKey(r *Rule) string {
+	if !r.Block {
+		return normalizedHead(r) + ";"
+	}
+	return normalizedHead(r)
+}
+
+func propertyKey(name string) string {
+	if strings.HasPrefix(name, "--") {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+func normalizedHead(r *Rule) string {
+	return (&Rule{AtKeyword: strings.ToLower(r.AtKeyword), Prelude: normalizePrelude(r)}).head()
+}
+
+func normalizedValue(d parser.Declaration) string {
+	v := render(normalize(d.Value))
+	if d.Important {
+		v += " !important"
+	}
+	return v
+}
+
+// normalizedRule returns r as CSS source, formatted as by normalize.
+func normalizedRule(r *Rule) string {
+	var buf bytes.Buffer
+	writeRule(&buf, normalizeRule(r))
+	return buf.String()
+}
+
+func normalizeRule(r *Rule) *Rule {
+	n := &Rule{AtKeyword: strings.ToLower(r.AtKeyword), Prelude: normalizePrelude(r), Block: r.Block}
+	for _, d := range r.Declarations {
+		d.Value = normalize(d.Value)
+		n.Declarations = append(n.Declarations, d)
+	}
+	for _, nested := range r.Rules {
+		n.Rules = append(n.Rules, normalizeRule(nested))
+	}
+	return n
+}
+
+// normalize returns toks without comments, and with each run of whitespace
+// made a single space, or removed at either end, next to a comma, and
+// inside the parentheses of a block or function.
+func normalize(toks []tokenizer.Token) []tokenizer.Token {
+	return normalizeSpace(toks, func(prev, next tokenizer.Token) bool { return false })
+}
+
+// normalizePrelude is normalize for the prelude of r.  A selector is
+// written in the canonical form of selector.Normalize, so that "A:HOVER"
+// and "a:hover" are the same, but one that cannot be parsed, such as one
+// with a namespace prefix or a relative one nested in a rule, only has the
+// whitespace next to its combinators removed too.  In an at-rule prelude,
+// that next to the colons is removed, as in "(width : 1px)".
+func normalizePrelude(r *Rule) []tokenizer.Token {
+	isDelim := func(t tokenizer.Token, chars string) bool {
+		return t.Type == tokenizer.TokenDelim && len(t.Value) == 1 && strings.Contains(chars, t.Value)
+	}
+	if r.AtKeyword == "" {
+		if sel, err := selector.Normalize(r.Prelude, nil); err == nil {
+			return tokenize(sel)
+		}
+		return normalizeSpace(r.Prelude, func(prev, next tokenizer.Token) bool {
+			return isDelim(prev, ">+~") || isDelim(next, ">+~") || prev.Type == tokenizer.TokenColon
+		})
+	}
+	return normalizeSpace(r.Prelude, func(prev, next tokenizer.Token) bool {
+		return prev.Type == tokenizer.TokenColon || next.Type == tokenizer.TokenColon
+	})
+}
+
+// normalizeSpace removes comments from toks, and makes each run of
+// whitespace a single space, unless it is at either end or next to a
+// comma or parenthesis, or drop reports it is not needed between prev and
+// next.
+func normalizeSpace(toks []tokenizer.Token, drop func(prev, next tokenizer.Token) bool) []tokenizer.Token {
+	var out []tokenizer.Token
+	space := false
+	for _, t := range toks {
+		switch t.Type {
+		case tokenizer.TokenComment:
+			continue
+		case tokenizer.TokenS:
+			space = true
+			continue
+		}
+		if space && len(out) > 0 {
+			prev := out[len(out)-1]
+			switch {
+			case t.Type == tokenizer.TokenComma, prev.Type == tokenizer.TokenComma:
+			case prev.Type == tokenizer.TokenOpenParen, prev.Type == tokenizer.TokenFunction, t.Type == tokenizer.TokenCloseParen:
+			case drop(prev, t):
+			default:
+				out = append(out, tokenizer.Token{Type: tokenizer.TokenS, Value: " "})
+			}
+		}
+		space = false
+		out = append(out, t)
+	}
+	return out
+}
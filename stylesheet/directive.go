@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// directivePrefix starts the comments that are directives.
+const directivePrefix = "cssparse-"
+
+// Directive is a comment such as /* cssparse-keep */ or
+// /* cssparse-disable-next-rule dedupe */, which tells the passes here, and
+// other tools, how to treat the rule it is attached to.
+//
+// Parse attaches each directive to the rule that comes right after it, or,
+// if it is at the start of a block and a declaration or the end of the
+// block comes next, to the rule the block belongs to.  Other directives,
+// such as those between declarations, are not attached.
+type Directive struct {
+	// Name is the first word of the comment without "cssparse-", such as
+	// "keep".
+	Name string
+	// Args are the other words of the comment, split at whitespace and
+	// commas.
+	Args []string
+}
+
+// ParseDirective returns the directive in the comment t, if it is one.
+func ParseDirective(t tokenizer.Token) (Directive, bool) {
+	if t.Type != tokenizer.TokenComment {
+		return Directive{}, false
+	}
+	words := strings.FieldsFunc(t.Value, func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	})
+	if len(words) == 0 || !strings.HasPrefix(words[0], directivePrefix) || len(words[0]) == len(directivePrefix) {
+		return Directive{}, false
+	}
+	return Directive{Name: words[0][len(directivePrefix):], Args: words[1:]}, true
+}
+
+// HasDirective reports whether r has a directive with the given name.
+func (r *Rule) HasDirective(name string) bool {
+	for _, d := range r.Directives {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Disabled reports whether r has a disable-next-rule directive that names
+// pass, or that names nothing, which disables every pass.  The passes here
+// that check it are named by their functions, in lowercase: "dedupe",
+// "mergemedia", "canonicalize", and "fliprtl".  A rule with a keep
+// directive is never removed by Purge or Critical, nor are the @keyframes
+// rules with one.
+func (r *Rule) Disabled(pass string) bool {
+	for _, d := range r.Directives {
+		if d.Name != "disable-next-rule" {
+			continue
+		}
+		if len(d.Args) == 0 {
+			return true
+		}
+		for _, arg := range d.Args {
+			if strings.EqualFold(arg, pass) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// directivesBefore returns the directives in the comments right before
+// toks[i].
+func directivesBefore(toks []tokenizer.Token, i int) []Directive {
+	start := i
+	for start > 0 && (toks[start-1].Type == tokenizer.TokenS || toks[start-1].Type == tokenizer.TokenComment) {
+		start--
+	}
+	return directivesIn(toks[start:i])
+}
+
+// leadingDirectives returns the directives in the comments at the start
+// of the block toks, unless they come before the first of rules, as they
+// are that rule's.
+func leadingDirectives(toks []tokenizer.Token, first *Rule, base int) []Directive {
+	end := 0
+	for end < len(toks) && (toks[end].Type == tokenizer.TokenS || toks[end].Type == tokenizer.TokenComment) {
+		end++
+	}
+	if first != nil && first.Index == base+end {
+		return nil
+	}
+	return directivesIn(toks[:end])
+}
+
+func directivesIn(toks []tokenizer.Token) []Directive {
+	var out []Directive
+	for _, t := range toks {
+		if d, ok := ParseDirective(t); ok {
+			out = append(out, d)
+		}
+	}
+	return out
+}
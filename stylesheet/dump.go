@@ -0,0 +1,92 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Dump writes s to w as an indented tree of its rules, declarations, and
+// tokens, with their indexes, as go/ast.Print does for Go, for debugging a
+// pass and for golden files in tests.  The output depends only on s, so it
+// is the same on every run.  A token is written as its type and quoted
+// value, with the unit of a dimension and the type of a hash, such as
+//
+//	DIMENSION "10" px
+//
+// and the whitespace and comments inside preludes and values are kept.
+func (s *Stylesheet) Dump(w io.Writer) error {
+	d := &dumper{w: w}
+	d.printf(0, "Stylesheet")
+	for _, r := range s.Rules {
+		d.rule(1, r)
+	}
+	return d.err
+}
+
+// dumper writes a tree for Dump, keeping the first error.
+type dumper struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dumper) printf(depth int, format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, strings.Repeat("  ", depth)+format+"\n", args...)
+}
+
+func (d *dumper) rule(depth int, r *Rule) {
+	kind := "QualifiedRule"
+	if r.AtKeyword != "" {
+		kind = fmt.Sprintf("AtRule name=%q", r.AtKeyword)
+	}
+	if r.Block {
+		kind += " block"
+	}
+	d.printf(depth, "%s index=%d", kind, r.Index)
+	for _, dir := range r.Directives {
+		d.printf(depth+1, "Directive name=%q args=%q", dir.Name, dir.Args)
+	}
+	d.tokens(depth+1, "Prelude", r.Prelude)
+	for _, decl := range r.Declarations {
+		d.declaration(depth+1, decl)
+	}
+	for _, nested := range r.Rules {
+		d.rule(depth+1, nested)
+	}
+}
+
+func (d *dumper) declaration(depth int, decl parser.Declaration) {
+	important := ""
+	if decl.Important {
+		important = " important"
+	}
+	d.printf(depth, "Declaration name=%q index=%d%s", decl.Name, decl.Index, important)
+	d.tokens(depth+1, "Value", decl.Value)
+}
+
+func (d *dumper) tokens(depth int, name string, toks []tokenizer.Token) {
+	if len(toks) == 0 {
+		return
+	}
+	d.printf(depth, "%s", name)
+	for _, t := range toks {
+		extra := ""
+		switch e := t.Extra.(type) {
+		case *tokenizer.TokenExtraNumeric:
+			if e != nil && e.Dimension != "" {
+				extra = " " + e.Dimension
+			}
+		case *tokenizer.TokenExtraHash:
+			extra = " " + e.String()
+		}
+		d.printf(depth+1, "%s %q%s", t.Type, t.Value, extra)
+	}
+}
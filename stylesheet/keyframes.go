@@ -0,0 +1,114 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// KeyframesUsage links the animations of a stylesheet to its @keyframes
+// rules, for linters and for removing the keyframes that are not used.
+type KeyframesUsage struct {
+	// Defined holds the @keyframes rules for each name, prefixed ones such
+	// as @-webkit-keyframes included.
+	Defined map[string][]Found
+	// Used holds the animation and animation-name declarations, prefixed
+	// or not, that name each keyframes.
+	Used map[string][]Found
+	// Undefined are the names used with no @keyframes rule, and Unused the
+	// names of the @keyframes rules that nothing uses, in sorted order.
+	//
+	// A name that may be used through var(), as it is an identifier or
+	// string in the value of a custom property, or of an animation that
+	// cannot be expanded until var() is substituted, is not Unused.
+	Undefined []string
+	Unused    []string
+}
+
+// AnalyzeKeyframes returns the usage of the @keyframes rules of s.  The
+// names in animation declarations are found by expanding them with
+// values.ExpandShorthand.
+func AnalyzeKeyframes(s *Stylesheet) *KeyframesUsage {
+	u := &KeyframesUsage{Defined: map[string][]Found{}, Used: map[string][]Found{}}
+	maybe := make(map[string]bool)
+	find(s.Rules, nil, nil, func(r *Rule, parents []*Rule) {
+		if _, base := unprefix(strings.ToLower(r.AtKeyword)); base == "keyframes" {
+			if name := keyframesName(r); name != "" {
+				u.Defined[name] = append(u.Defined[name], Found{Rule: r, Parents: parents})
+			}
+		}
+		for i := range r.Declarations {
+			d := &r.Declarations[i]
+			if strings.HasPrefix(d.Name, "--") {
+				addNames(d.Value, maybe)
+				continue
+			}
+			_, base := unprefix(strings.ToLower(d.Name))
+			if base != "animation" && base != "animation-name" {
+				continue
+			}
+			longhands, err := values.ExpandShorthand(parser.Declaration{Name: base, Value: d.Value})
+			if err != nil {
+				addNames(d.Value, maybe)
+				continue
+			}
+			for _, l := range longhands {
+				if l.Name != "animation-name" {
+					continue
+				}
+				for _, part := range parser.SplitCommas(l.Value) {
+					if len(part) != 1 || part[0].Type != tokenizer.TokenIdent && part[0].Type != tokenizer.TokenString ||
+						part[0].Type == tokenizer.TokenIdent && tokenizer.IdentEquals(part[0].Value, "none") {
+						continue
+					}
+					name := part[0].Value
+					u.Used[name] = append(u.Used[name], Found{Rule: r, Parents: parents, Declaration: d})
+				}
+			}
+		}
+	})
+	for name := range u.Used {
+		if len(u.Defined[name]) == 0 {
+			u.Undefined = append(u.Undefined, name)
+		}
+	}
+	for name := range u.Defined {
+		if len(u.Used[name]) == 0 && !maybe[name] {
+			u.Unused = append(u.Unused, name)
+		}
+	}
+	sort.Strings(u.Undefined)
+	sort.Strings(u.Unused)
+	return u
+}
+
+// addNames adds the identifiers and strings in toks to names.
+func addNames(toks []tokenizer.Token, names map[string]bool) {
+	for _, t := range toks {
+		if t.Type == tokenizer.TokenIdent || t.Type == tokenizer.TokenString {
+			names[t.Value] = true
+		}
+	}
+}
+
+// animationNames returns the names of the @keyframes rules of s that are
+// used, or may be.
+func animationNames(s *Stylesheet) map[string]bool {
+	u := AnalyzeKeyframes(s)
+	unused := make(map[string]bool)
+	for _, name := range u.Unused {
+		unused[name] = true
+	}
+	names := make(map[string]bool)
+	for name := range u.Defined {
+		if !unused[name] {
+			names[name] = true
+		}
+	}
+	return names
+}
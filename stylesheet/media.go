@@ -0,0 +1,137 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// MergeMedia merges the @media rules with the same media queries, compared
+// as Diff compares them, throughout s.  The rules of a later @media rule
+// are moved into the earlier one, or those of the earlier one into the
+// later, whichever can be done without changing the cascade: the rules
+// moved, and the rules they are moved past, must not set any of the same
+// properties, nor hold any of the same kind of at-rule, such as two
+// @font-face rules.  Rules holding @layer are never moved, as the order in
+// which layers first appear is their order in the cascade.
+//
+// The check is by property only, not by which elements the selectors
+// match, so some @media rules that could be merged are not.  The rules of
+// each merged block are then deduplicated as Dedupe does, since rules from
+// the two blocks may now be adjacent.  The @media rules that a directive
+// disables "mergemedia" for are not merged.
+func MergeMedia(s *Stylesheet) {
+	s.Rules = mergeMedia(s.Rules, s.Namespaces())
+}
+
+func mergeMedia(rules []*Rule, namespaces map[string]string) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		r.Rules = mergeMedia(r.Rules, namespaces)
+		i := lastSameMedia(out, r)
+		if i < 0 {
+			out = append(out, r)
+			continue
+		}
+		prev, between := out[i], cascadeKeys(out[i+1:], nil)
+		switch {
+		case !between.conflicts(cascadeKeys(nil, r)):
+			out[i] = mergedMedia(prev, r, namespaces)
+		case !between.conflicts(cascadeKeys(nil, prev)):
+			out = append(out[:i], out[i+1:]...)
+			out = append(out, mergedMedia(prev, r, namespaces))
+		default:
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// lastSameMedia returns the index of the last @media rule in rules with
+// the same media queries as r, or -1 if there is none or r is not @media.
+func lastSameMedia(rules []*Rule, r *Rule) int {
+	if !isMedia(r) {
+		return -1
+	}
+	for i := len(rules) - 1; i >= 0; i-- {
+		if isMedia(rules[i]) && normalizedHead(rules[i]) == normalizedHead(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isMedia(r *Rule) bool {
+	return tokenizer.IdentEquals(r.AtKeyword, "media") && r.Block && !r.Disabled("mergemedia")
+}
+
+// mergedMedia returns a copy of a with the contents of b after its own.
+func mergedMedia(a, b *Rule, namespaces map[string]string) *Rule {
+	m := *a
+	m.Declarations = append(a.Declarations[:len(a.Declarations):len(a.Declarations)], b.Declarations...)
+	m.Rules = dedupeRules(append(a.Rules[:len(a.Rules):len(a.Rules)], b.Rules...), namespaces)
+	return &m
+}
+
+// keySet holds the properties that rules set, with the longhands of
+// shorthands and the property families such as "border", and the kinds of
+// at-rules they hold, as "@" and the name and prelude, so that two sets
+// share a key if the order of their rules may matter.
+type keySet map[string]bool
+
+// cascadeKeys returns the keys of rules, and of the contents of r if it is
+// not nil.
+func cascadeKeys(rules []*Rule, r *Rule) keySet {
+	keys := make(keySet)
+	if r != nil {
+		keys.addDeclarations(r.Declarations)
+		rules = append(rules[:len(rules):len(rules)], r.Rules...)
+	}
+	walk(rules, func(r *Rule) {
+		kw := strings.ToLower(r.AtKeyword)
+		switch {
+		case kw == "layer":
+			keys["@layer"] = true
+		case kw == "" || groupingRules[kw] || kw == "scope":
+			keys.addDeclarations(r.Declarations)
+		default:
+			// the declarations of @font-face and the like are not
+			// properties of elements
+			keys["@"+normalizedHead(r)] = true
+		}
+	})
+	return keys
+}
+
+func (k keySet) addDeclarations(decls []parser.Declaration) {
+	for _, d := range decls {
+		name := propertyKey(d.Name)
+		k[name] = true
+		if strings.HasPrefix(name, "--") {
+			continue
+		}
+		_, base := unprefix(name)
+		k[strings.SplitN(base, "-", 2)[0]] = true
+		longhands, _ := values.ExpandShorthand(parser.Declaration{Name: base, Value: tokenize("initial")})
+		for _, l := range longhands {
+			k[l.Name] = true
+			k[strings.SplitN(l.Name, "-", 2)[0]] = true
+		}
+	}
+}
+
+func (k keySet) conflicts(other keySet) bool {
+	if k["all"] && len(other) > 0 || other["all"] && len(k) > 0 {
+		return true
+	}
+	for key := range other {
+		if k[key] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// RangeForm is the form MediaRanges writes media features in.
+type RangeForm int
+
+const (
+	// LegacyRanges writes range features with min- and max- prefixes, as
+	// in (min-width: 600px), for browsers without the range syntax.
+	LegacyRanges RangeForm = iota
+	// RangeSyntax writes the features with min- and max- prefixes in the
+	// range syntax of Media Queries Level 4, as in (width >= 600px).
+	RangeSyntax
+)
+
+// rangeFeatures are the media features that take min- and max- prefixes.
+var rangeFeatures = map[string]bool{
+	"width": true, "height": true, "device-width": true, "device-height": true,
+	"aspect-ratio": true, "device-aspect-ratio": true, "resolution": true,
+	"color": true, "color-index": true, "monochrome": true,
+}
+
+// MediaRanges rewrites the media features of the @media rules of s
+// throughout in form.
+//
+// To LegacyRanges, (width >= 600px) becomes (min-width: 600px), and
+// (600px <= width <= 900px) becomes (min-width: 600px) and
+// (max-width: 900px), unless it is in a not or an or condition, where
+// that would change what it means.  Strict comparisons such as
+// (width > 600px) have no legacy form, and are left as they are.  To
+// RangeSyntax, (min-width: 600px) becomes (width >= 600px).
+func MediaRanges(s *Stylesheet, form RangeForm) {
+	walk(s.Rules, func(r *Rule) {
+		if tokenizer.IdentEquals(r.AtKeyword, "media") {
+			r.Prelude = rewriteRanges(r.Prelude, form, true)
+		}
+	})
+}
+
+// rewriteRanges returns the media query list or condition toks with its
+// features rewritten.  Features may only be split in two at the top level
+// of a query.
+func rewriteRanges(toks []tokenizer.Token, form RangeForm, top bool) []tokenizer.Token {
+	cvs := parser.ComponentValues(toks)
+	i := -1
+	return mapValues(toks, func(cv []tokenizer.Token) []tokenizer.Token {
+		i++
+		if cv[0].Type != tokenizer.TokenOpenParen || len(cv) < 2 {
+			return cv
+		}
+		inner := cv[1 : len(cv)-1]
+		name, comparisons, ok := parseFeature(inner)
+		if !ok {
+			out := append([]tokenizer.Token{cv[0]}, rewriteRanges(inner, form, false)...)
+			return append(out, cv[len(cv)-1])
+		}
+		split := top && !isKeyword(cvs, i-1, "not") && !isKeyword(cvs, i-1, "or") && !isKeyword(cvs, i+1, "or")
+		if rewritten := writeFeature(name, comparisons, form, split); rewritten != "" {
+			return tokenize(rewritten)
+		}
+		return cv
+	})
+}
+
+func isKeyword(cvs [][]tokenizer.Token, i int, kw string) bool {
+	return i >= 0 && i < len(cvs) && cvs[i][0].Type == tokenizer.TokenIdent && tokenizer.IdentEquals(cvs[i][0].Value, kw)
+}
+
+// comparison compares a feature, on the left, with value.  op is one of
+// <, <=, >, >=, or =, or ":" for a feature in the min-/max- form, whose
+// name keeps its prefix.
+type comparison struct {
+	op    string
+	value [][]tokenizer.Token
+}
+
+// parseFeature parses the inside of a media feature in one of the forms
+// name: value, name op value, value op name, and value op name op value.
+func parseFeature(toks []tokenizer.Token) (string, []comparison, bool) {
+	cvs := parser.ComponentValues(toks)
+	var terms []comparison
+	for i := 0; i < len(cvs); i++ {
+		t := cvs[i][0]
+		switch {
+		case t.Type == tokenizer.TokenColon:
+			terms = append(terms, comparison{op: ":"})
+		case t.Type == tokenizer.TokenDelim && (t.Value == "<" || t.Value == ">" || t.Value == "="):
+			op := t.Value
+			// "<=" and ">=" are two tokens, which must be adjacent
+			if op != "=" && i+1 < len(cvs) && cvs[i+1][0].Type == tokenizer.TokenDelim && cvs[i+1][0].Value == "=" &&
+				cap(cvs[i])-cap(cvs[i+1]) == 1 {
+				op += "="
+				i++
+			}
+			terms = append(terms, comparison{op: op})
+		case i+2 < len(cvs) && cvs[i+1][0].Type == tokenizer.TokenDelim && cvs[i+1][0].Value == "/":
+			terms = append(terms, comparison{value: cvs[i : i+3]})
+			i += 2
+		default:
+			terms = append(terms, comparison{value: cvs[i : i+1]})
+		}
+	}
+	name := func(term comparison) string {
+		if len(term.value) != 1 || term.value[0][0].Type != tokenizer.TokenIdent {
+			return ""
+		}
+		return strings.ToLower(term.value[0][0].Value)
+	}
+	switch {
+	case len(terms) == 3 && terms[1].op == ":" && terms[2].value != nil && name(terms[0]) != "":
+		return name(terms[0]), []comparison{{":", terms[2].value}}, true
+	case len(terms) == 3 && terms[1].op != "" && terms[1].op != ":" && terms[0].value != nil && terms[2].value != nil:
+		if n := name(terms[0]); rangeFeatures[n] {
+			return n, []comparison{{terms[1].op, terms[2].value}}, true
+		}
+		if n := name(terms[2]); rangeFeatures[n] {
+			return n, []comparison{{flipComparison(terms[1].op), terms[0].value}}, true
+		}
+	case len(terms) == 5 && terms[0].value != nil && terms[4].value != nil && rangeFeatures[name(terms[2])]:
+		op1, op2 := terms[1].op, terms[3].op
+		if op1 != "" && op2 != "" && op1 != ":" && op2 != ":" && op1[0] == op2[0] && op1[0] != '=' {
+			return name(terms[2]), []comparison{{flipComparison(op1), terms[0].value}, {op2, terms[4].value}}, true
+		}
+	}
+	return "", nil, false
+}
+
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// writeFeature returns the feature name with comparisons written in form,
+// as CSS source, or "" if it is left as it is.  A feature with two
+// comparisons is only written as two if split is set.
+func writeFeature(name string, comparisons []comparison, form RangeForm, split bool) string {
+	if form == RangeSyntax {
+		c := comparisons[0]
+		if len(comparisons) != 1 || c.op != ":" {
+			return ""
+		}
+		switch {
+		case strings.HasPrefix(name, "min-") && rangeFeatures[name[4:]]:
+			return "(" + name[4:] + " >= " + render(joinSpaced(c.value)) + ")"
+		case strings.HasPrefix(name, "max-") && rangeFeatures[name[4:]]:
+			return "(" + name[4:] + " <= " + render(joinSpaced(c.value)) + ")"
+		}
+		return ""
+	}
+	if len(comparisons) == 2 && !split {
+		return ""
+	}
+	var parts []string
+	for _, c := range comparisons {
+		var prefix string
+		switch c.op {
+		case ">=":
+			prefix = "min-"
+		case "<=":
+			prefix = "max-"
+		case "=":
+		default:
+			return ""
+		}
+		parts = append(parts, "("+prefix+name+": "+render(joinSpaced(c.value))+")")
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Conflict is a property that two of the stylesheets given to Merge set to
+// different values for the same selectors, in the same at-rules.  The
+// value of the later stylesheet wins, which the earlier one may not
+// expect.  It has tags for encoding/json, as Change does.
+type Conflict struct {
+	// Rules holds the heads of the rules enclosing the declarations,
+	// outermost first, ending with the style rule, as in Change.
+	Rules    []string `json:"rules"`
+	Property string   `json:"property"`
+	// Old and New are the values of the declarations, with "!important"
+	// if they are, and OldSheet and NewSheet the indexes of the
+	// stylesheets in the arguments to Merge.
+	Old      string `json:"old"`
+	New      string `json:"new"`
+	OldSheet int    `json:"oldSheet"`
+	NewSheet int    `json:"newSheet"`
+}
+
+// String returns c as a line of a report, such as
+// "@media print / a: color: red (0) -> blue (2)".
+func (c Conflict) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(c.Rules, " / "))
+	buf.WriteString(": ")
+	buf.WriteString(c.Property)
+	buf.WriteString(": ")
+	buf.WriteString(c.Old)
+	buf.WriteString(" (" + strconv.Itoa(c.OldSheet) + ") -> ")
+	buf.WriteString(c.New)
+	buf.WriteString(" (" + strconv.Itoa(c.NewSheet) + ")")
+	return buf.String()
+}
+
+// Merge concatenates sheets into one stylesheet, in cascade order, for
+// bundling many stylesheets into one.  The rules are Clones of those of
+// sheets, which are not changed.
+//
+// The @import and @namespace rules of the later stylesheets, which
+// browsers would ignore after the rules of the earlier ones, are moved up
+// as FixOrder moves them, so the rules they import come before the rules
+// of every stylesheet, and the @charset rules of the later stylesheets
+// are removed.
+//
+// The conflicts are the properties set to different values for the same
+// selectors by two of the stylesheets, compared as Diff compares them, in
+// the order they are found.  Declarations in the same stylesheet, which
+// may be meant as fallbacks, are not conflicts, nor are a shorthand and
+// one of its longhands, or rules with different selectors that match the
+// same elements.
+func Merge(sheets ...*Stylesheet) (*Stylesheet, []Conflict) {
+	merged := &Stylesheet{}
+	set := make(map[string]setting)
+	var conflicts []Conflict
+	for i, s := range sheets {
+		last := make(map[string]setting)
+		var keys []string
+		settings(s.Rules, nil, i, last, &keys)
+		for _, k := range keys {
+			prev, ok := set[k]
+			next := last[k]
+			if ok && prev.value != next.value {
+				conflicts = append(conflicts, Conflict{Rules: next.rules, Property: next.property,
+					Old: prev.value, New: next.value, OldSheet: prev.sheet, NewSheet: i})
+			}
+			set[k] = next
+		}
+		for _, r := range s.Rules {
+			merged.Rules = append(merged.Rules, r.Clone())
+		}
+	}
+	merged.Rules = fixOrder(merged.Rules)
+	return merged, conflicts
+}
+
+// setting is the value a stylesheet sets a property to in a style rule.
+type setting struct {
+	rules           []string
+	property, value string
+	sheet           int
+}
+
+// settings records in set the last value each property is set to in the
+// style rules of rules, of the stylesheet sheet, keyed by the heads of the
+// rules enclosing it and the property, and adds the keys to keys in the
+// order they are first set.
+func settings(rules []*Rule, path []string, sheet int, set map[string]setting, keys *[]string) {
+	for _, r := range rules {
+		at := append(path[:len(path):len(path)], normalizedHead(r))
+		if r.AtKeyword == "" {
+			for _, d := range r.Declarations {
+				key := strings.Join(at, "\x00") + "\x00" + propertyKey(d.Name)
+				if _, ok := set[key]; !ok {
+					*keys = append(*keys, key)
+				}
+				set[key] = setting{at, d.Name, normalizedValue(d), sheet}
+			}
+		}
+		settings(r.Rules, at, sheet, set, keys)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/selector"
+)
+
+// FlattenNesting rewrites the rules nested in style rules throughout s,
+// as CSS Nesting writes them, into flat rules, for browsers without
+// nesting.  Each nested style rule gets a selector with the & in it
+// replaced by the selector of the rule it is nested in, and a selector
+// with no & is taken to start with one, as in "& > a".
+//
+// Where the rule it is nested in has a single selector, the & at the start
+// of a selector is replaced by that selector itself, so "&.x > a" in ".p .q"
+// becomes ".p .q.x > a".  Otherwise it is replaced by :is() of the
+// selectors, as in ":is(.p, .q) > a" or ".x :is(.p .q)", which has the
+// same specificity and matches the same elements.  A selector with a
+// pseudo-element cannot go in :is(), so a rule nested in one that needs it
+// is left in it.
+//
+// Grouping rules such as @media nested in a style rule are moved out of
+// it, with the declarations in them put in a rule with its selector.
+// Rules whose selectors cannot be parsed are left as they are, nested
+// rules and all, as are the rules nested in them, and reported as errors.
+func FlattenNesting(s *Stylesheet) []error {
+	var errs []error
+	s.Rules, _ = flattenRules(s.Rules, nil, s.Namespaces(), &errs)
+	return errs
+}
+
+// flattenRules returns rules flattened, for rules nested in a style rule
+// with the selector parent, or at the top level or in a grouping rule
+// there if parent is nil.  The nested style rules that cannot be flattened
+// are returned as stuck, to be left in the rule they are nested in.
+func flattenRules(rules []*Rule, parent selector.List, namespaces map[string]string, errs *[]error) (out, stuck []*Rule) {
+	for _, r := range rules {
+		kw := strings.ToLower(r.AtKeyword)
+		switch {
+		case kw == "" && r.Block:
+			var l selector.List
+			var err error
+			if parent == nil {
+				l, err = selector.ParseWithNamespaces(r.Prelude, namespaces)
+			} else {
+				l, err = selector.ParseRelative(r.Prelude, namespaces)
+			}
+			if err == nil && parent != nil {
+				l, err = resolveNesting(l, parent)
+			}
+			if err != nil {
+				*errs = append(*errs, errorf("cannot flatten %q: %v", render(r.Prelude), err))
+				if parent != nil {
+					stuck = append(stuck, r)
+				} else {
+					out = append(out, r)
+				}
+				continue
+			}
+			flat := *r
+			if parent != nil {
+				flat.Prelude = tokenize(l.String())
+			}
+			var nested []*Rule
+			nested, flat.Rules = flattenRules(r.Rules, l, namespaces, errs)
+			if len(r.Declarations) > 0 || len(flat.Rules) > 0 || len(nested) == 0 {
+				out = append(out, &flat)
+			}
+			out = append(out, nested...)
+		case groupingRules[kw] && r.Block && parent != nil:
+			g := *r
+			nested, inner := flattenRules(r.Rules, parent, namespaces, errs)
+			g.Declarations, g.Rules = nil, nil
+			if len(r.Declarations) > 0 || len(inner) > 0 {
+				g.Rules = append(g.Rules, &Rule{Prelude: tokenize(parent.String()), Block: true, Declarations: r.Declarations, Rules: inner, Index: r.Index})
+			}
+			g.Rules = append(g.Rules, nested...)
+			out = append(out, &g)
+		case groupingRules[kw] && r.Block:
+			r.Rules, _ = flattenRules(r.Rules, nil, namespaces, errs)
+			out = append(out, r)
+		default:
+			out = append(out, r)
+		}
+	}
+	return out, stuck
+}
+
+// resolveNesting returns the nested selectors l with their & replaced by
+// parent.
+func resolveNesting(l, parent selector.List) (selector.List, error) {
+	out := make(selector.List, len(l))
+	for i, c := range l {
+		compounds := append([]*selector.Compound(nil), c.Compounds...)
+		if countNesting(c) == 0 {
+			amp := &selector.Compound{Simples: []*selector.Simple{{Kind: selector.Nesting}}}
+			compounds = append([]*selector.Compound{amp}, compounds...)
+		} else {
+			first := *compounds[0]
+			first.Combinator = 0
+			compounds[0] = &first
+		}
+		c = &selector.Complex{Compounds: compounds}
+		switch merged := mergeLeading(c, parent); {
+		case merged != nil:
+			out[i] = merged
+		case hasPseudoElement(parent):
+			return nil, errorf("%s cannot be put in :is()", parent)
+		default:
+			out[i] = replaceNesting(c, parent)
+		}
+	}
+	return out, nil
+}
+
+func hasPseudoElement(l selector.List) bool {
+	for _, c := range l {
+		for _, cp := range c.Compounds {
+			for _, s := range cp.Simples {
+				if s.Kind == selector.PseudoElement {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// mergeLeading returns c with its & replaced by the single selector of
+// parent, if the & is the only one and is in its first compound selector,
+// or nil otherwise.
+func mergeLeading(c *selector.Complex, parent selector.List) *selector.Complex {
+	if len(parent) != 1 || countNesting(c) != 1 {
+		return nil
+	}
+	first := c.Compounds[0]
+	amp := -1
+	for i, s := range first.Simples {
+		if s.Kind == selector.Nesting {
+			amp = i
+		}
+	}
+	if amp < 0 {
+		return nil
+	}
+	p := parent[0].Compounds
+	last := *p[len(p)-1]
+	if first.Type != "" {
+		if last.Type != "" {
+			return nil
+		}
+		last.Type, last.Namespace = first.Type, first.Namespace
+	}
+	last.Simples = append(append(append([]*selector.Simple(nil), last.Simples...), first.Simples[:amp]...), first.Simples[amp+1:]...)
+	compounds := append(append([]*selector.Compound(nil), p[:len(p)-1]...), &last)
+	return &selector.Complex{Compounds: append(compounds, c.Compounds[1:]...)}
+}
+
+// countNesting returns the number of & in c, in the arguments of
+// pseudo-classes too.
+func countNesting(c *selector.Complex) int {
+	n := 0
+	for _, cp := range c.Compounds {
+		for _, s := range cp.Simples {
+			if s.Kind == selector.Nesting {
+				n++
+			}
+			for _, arg := range s.Args {
+				n += countNesting(arg)
+			}
+		}
+	}
+	return n
+}
+
+// replaceNesting returns a copy of c with each & replaced by :is(parent).
+func replaceNesting(c *selector.Complex, parent selector.List) *selector.Complex {
+	out := &selector.Complex{}
+	for _, cp := range c.Compounds {
+		copied := *cp
+		copied.Simples = nil
+		for _, s := range cp.Simples {
+			switch {
+			case s.Kind == selector.Nesting:
+				s = &selector.Simple{Kind: selector.PseudoClass, Name: "is", Func: true, Args: parent}
+			case len(s.Args) > 0:
+				args := make(selector.List, len(s.Args))
+				for i, arg := range s.Args {
+					args[i] = replaceNesting(arg, parent)
+				}
+				copied := *s
+				copied.Args = args
+				s = &copied
+			}
+			copied.Simples = append(copied.Simples, s)
+		}
+		out.Compounds = append(out.Compounds, &copied)
+	}
+	return out
+}
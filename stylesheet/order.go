@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// CheckOrder reports the top-level @charset, @import, and @namespace rules
+// of s that are out of the order CSS requires, which browsers ignore: an
+// @charset rule that is not the first rule, an @import rule after any rule
+// other than @charset, @import, and @layer statements, and an @namespace
+// rule after any rule other than those and @namespace.  Each error is a
+// *parser.Error with the Index of the rule.
+func CheckOrder(s *Stylesheet) []error {
+	var errs []error
+	report := func(r *Rule, why string) {
+		errs = append(errs, &parser.Error{Message: "stylesheet: " + r.head() + " " + why + ", and is ignored", Index: r.Index})
+	}
+	for i, r := range s.Rules {
+		if i > 0 && isStatement(r, "charset") {
+			report(r, "is not the first rule")
+		}
+	}
+	kept := withoutLateCharsets(s.Rules)
+	for _, r := range kept[orderedPrefix(kept):] {
+		switch {
+		case isStatement(r, "import"):
+			report(r, "comes after rules other than @charset, @import, and @layer statements")
+		case isStatement(r, "namespace"):
+			report(r, "comes after rules other than @charset, @import, @namespace, and @layer statements")
+		}
+	}
+	return errs
+}
+
+// FixOrder puts the top-level rules of s in the order CheckOrder checks.
+// The @import and @namespace rules that come too late are moved up to the
+// end of those at the start, so the rules they import come before the
+// other rules, and the @charset rules after the first rule are removed,
+// as the encoding of a stylesheet is only given at its start.  The rules
+// in the right order are left as they are, and @layer statements are not
+// moved, as that could change the order of the layers.
+func FixOrder(s *Stylesheet) {
+	s.Rules = fixOrder(s.Rules)
+}
+
+// isStatement reports whether r is an at-rule named kw without a block,
+// such as @import.
+func isStatement(r *Rule, kw string) bool {
+	return !r.Block && tokenizer.IdentEquals(r.AtKeyword, kw)
+}
+
+// orderedPrefix returns the number of top-level rules at the start of rules
+// that are @charset, @import, @namespace, and @layer statements in the
+// order CSS requires, ignoring @charset rules after the first rule.
+func orderedPrefix(rules []*Rule) int {
+	namespaced := false
+	for i, r := range rules {
+		switch {
+		case isStatement(r, "charset"):
+		case isStatement(r, "layer"):
+		case isStatement(r, "import") && !namespaced:
+		case isStatement(r, "namespace"):
+			namespaced = true
+		default:
+			return i
+		}
+	}
+	return len(rules)
+}
+
+// withoutLateCharsets returns rules without the @charset rules after the
+// first rule.
+func withoutLateCharsets(rules []*Rule) []*Rule {
+	var out []*Rule
+	for i, r := range rules {
+		if i == 0 || !isStatement(r, "charset") {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// fixOrder returns the top-level rules in the order FixOrder puts them.
+func fixOrder(rules []*Rule) []*Rule {
+	kept := withoutLateCharsets(rules)
+	n := orderedPrefix(kept)
+	firstNamespace := n
+	for i := n - 1; i >= 0; i-- {
+		if isStatement(kept[i], "namespace") {
+			firstNamespace = i
+		}
+	}
+	var imports, namespaces, rest []*Rule
+	for _, r := range kept[n:] {
+		switch {
+		case isStatement(r, "import"):
+			imports = append(imports, r)
+		case isStatement(r, "namespace"):
+			namespaces = append(namespaces, r)
+		default:
+			rest = append(rest, r)
+		}
+	}
+	out := append([]*Rule(nil), kept[:firstNamespace]...)
+	out = append(out, imports...)
+	out = append(out, kept[firstNamespace:n]...)
+	out = append(out, namespaces...)
+	return append(out, rest...)
+}
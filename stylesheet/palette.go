@@ -0,0 +1,183 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// Palette is the colors of a stylesheet, for auditing them against those
+// of a design system.  It has tags for encoding/json, so it can be
+// written as a JSON report.
+type Palette struct {
+	// Colors are the distinct colors used, by their values, from the most
+	// used.
+	Colors []PaletteColor `json:"colors"`
+	// Groups are the colors, by Hex, that are near duplicates of one
+	// another, each group in the order of Colors.  Two colors are near
+	// duplicates if they differ by no more than the threshold, or are both
+	// near duplicates of a third.
+	Groups [][]string `json:"groups"`
+	// Contrasts are the contrast ratios of the text and background colors
+	// set in the same style rule, in the order of the rules.
+	Contrasts []Contrast `json:"contrasts"`
+}
+
+// PaletteColor is a color of a Palette.
+type PaletteColor struct {
+	// Hex is the color as values.Color.Hex writes it, such as "#ff0000".
+	Hex string `json:"hex"`
+	// Written are the ways the color is written, lowercased and formatted
+	// as Diff formats values, such as "red" and "#f00", in sorted order.
+	Written []string `json:"written"`
+	// Count is the number of times the color is used.
+	Count int `json:"count"`
+}
+
+// Contrast is the WCAG contrast ratio of the color and background-color a
+// style rule sets.
+type Contrast struct {
+	// Rules holds the heads of the rules enclosing the style rule,
+	// outermost first, ending with the style rule, as in Change.
+	Rules      []string `json:"rules"`
+	Color      string   `json:"color"`
+	Background string   `json:"background"`
+	// Ratio is the contrast ratio, from 1 to 21, rounded to two decimal
+	// places.  WCAG asks for at least 4.5 for normal text.
+	Ratio float64 `json:"ratio"`
+}
+
+// AnalyzePalette returns the palette of s, with the colors that differ by
+// no more than threshold, as values.DeltaE measures it, grouped as near
+// duplicates.  A threshold of 0.02 groups the colors that look the same.
+//
+// Only colors that values.ParseColor can parse are included, so those
+// using var() and system colors such as Canvas are left out.  The
+// background of a style rule is the last background-color it sets, or the
+// color of the last background shorthand without an image.
+func AnalyzePalette(s *Stylesheet, threshold float64) *Palette {
+	p := &Palette{Colors: []PaletteColor{}, Groups: [][]string{}, Contrasts: []Contrast{}}
+	byHex := make(map[string]*PaletteColor)
+	written := make(map[string]set)
+	parsed := make(map[string]values.Color)
+	find(s.Rules, nil, nil, func(r *Rule, parents []*Rule) {
+		var fg, bg []tokenizer.Token
+		for _, d := range r.Declarations {
+			eachColor(d, func(cv []tokenizer.Token) {
+				c, err := values.ParseColor(cv)
+				if err != nil {
+					return
+				}
+				hex := c.Hex()
+				if byHex[hex] == nil {
+					byHex[hex] = &PaletteColor{Hex: hex}
+					written[hex] = newSet()
+					parsed[hex] = c
+				}
+				byHex[hex].Count++
+				written[hex].add(strings.ToLower(render(normalize(cv))))
+			})
+			switch propertyKey(d.Name) {
+			case "color":
+				fg = d.Value
+			case "background-color":
+				bg = d.Value
+			case "background":
+				if color, ok := backgroundColor(d); ok {
+					bg = color
+				}
+			}
+		}
+		if r.AtKeyword != "" || fg == nil || bg == nil {
+			return
+		}
+		fc, err1 := values.ParseColor(fg)
+		bc, err2 := values.ParseColor(bg)
+		if err1 != nil || err2 != nil {
+			return
+		}
+		var path []string
+		for _, parent := range parents {
+			path = append(path, normalizedHead(parent))
+		}
+		ratio := math.Floor(values.ContrastRatio(fc, bc)*100+.5) / 100
+		p.Contrasts = append(p.Contrasts, Contrast{Rules: append(path, normalizedHead(r)), Color: fc.Hex(), Background: bc.Hex(), Ratio: ratio})
+	})
+	for hex, c := range byHex {
+		c.Written = written[hex].sorted()
+		p.Colors = append(p.Colors, *c)
+	}
+	sort.Sort(byUse(p.Colors))
+
+	group := make([]int, len(p.Colors))
+	for i := range group {
+		group[i] = i
+	}
+	for i := range p.Colors {
+		for j := 0; j < i; j++ {
+			if values.DeltaE(parsed[p.Colors[i].Hex], parsed[p.Colors[j].Hex]) <= threshold {
+				joinGroups(group, group[i], group[j])
+			}
+		}
+	}
+	members := make(map[int][]string)
+	var order []int
+	for i, c := range p.Colors {
+		g := group[i]
+		if members[g] == nil {
+			order = append(order, g)
+		}
+		members[g] = append(members[g], c.Hex)
+	}
+	for _, g := range order {
+		if len(members[g]) > 1 {
+			p.Groups = append(p.Groups, members[g])
+		}
+	}
+	return p
+}
+
+// backgroundColor returns the color of the background shorthand d, if it
+// sets no image, which would be behind the text instead.
+func backgroundColor(d parser.Declaration) ([]tokenizer.Token, bool) {
+	longhands, err := values.ExpandShorthand(d)
+	if err != nil {
+		return nil, false
+	}
+	var color []tokenizer.Token
+	for _, l := range longhands {
+		switch {
+		case l.Name == "background-color":
+			color = l.Value
+		case l.Name == "background-image" && !tokenizer.IdentEquals(render(l.Value), "none"):
+			return nil, false
+		}
+	}
+	return color, color != nil
+}
+
+// joinGroups puts the colors in group a into group b.
+func joinGroups(group []int, a, b int) {
+	for i, g := range group {
+		if g == a {
+			group[i] = b
+		}
+	}
+}
+
+type byUse []PaletteColor
+
+func (b byUse) Len() int      { return len(b) }
+func (b byUse) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byUse) Less(i, j int) bool {
+	if b[i].Count != b[j].Count {
+		return b[i].Count > b[j].Count
+	}
+	return b[i].Hex < b[j].Hex
+}
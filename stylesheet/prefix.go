@@ -0,0 +1,385 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// PrefixTable lists the names that have vendor-prefixed forms, each with
+// the prefixes, such as "-webkit-", that AddPrefixes writes for it.  Names
+// are unprefixed and lowercase.
+type PrefixTable struct {
+	// Properties are property names, such as user-select.
+	Properties map[string][]string
+	// AtRules are at-rule names, such as keyframes.
+	AtRules map[string][]string
+	// Values are the keywords, such as sticky, and function names, such as
+	// linear-gradient, used in declaration values.
+	Values map[string][]string
+}
+
+// DefaultPrefixes lists the prefixed forms that are still needed by some
+// browsers in use, or are common in older stylesheets.
+var DefaultPrefixes = PrefixTable{
+	Properties: map[string][]string{
+		"appearance":           {"-webkit-", "-moz-"},
+		"backdrop-filter":      {"-webkit-"},
+		"background-clip":      {"-webkit-"},
+		"box-decoration-break": {"-webkit-"},
+		"clip-path":            {"-webkit-"},
+		"hyphens":              {"-webkit-"},
+		"mask-image":           {"-webkit-"},
+		"print-color-adjust":   {"-webkit-"},
+		"tab-size":             {"-moz-"},
+		"text-size-adjust":     {"-webkit-"},
+		"user-select":          {"-webkit-", "-moz-"},
+	},
+	AtRules: map[string][]string{
+		"keyframes": {"-webkit-"},
+	},
+	Values: map[string][]string{
+		"image-set":                 {"-webkit-"},
+		"linear-gradient":           {"-webkit-"},
+		"repeating-linear-gradient": {"-webkit-"},
+		"sticky":                    {"-webkit-"},
+	},
+}
+
+// PrefixMode is what Prefix does with the names in a PrefixTable.
+type PrefixMode int
+
+const (
+	// StripPrefixes removes the declarations and at-rules that use a
+	// prefixed form of a name in the table, with any vendor prefix, for
+	// stylesheets that also have the unprefixed forms.
+	StripPrefixes PrefixMode = iota
+	// NormalizePrefixes rewrites the prefixed forms to the unprefixed
+	// ones.  A rewritten declaration that is overridden by a later one of
+	// the same property, or a rewritten at-rule that repeats another, is
+	// removed.
+	NormalizePrefixes
+	// AddPrefixes writes the prefixed forms listed in the table before
+	// each unprefixed declaration and at-rule, unless they are already in
+	// the same block.
+	AddPrefixes
+)
+
+var vendorPrefixes = []string{"-webkit-", "-moz-", "-ms-", "-o-"}
+
+// unprefix splits name, lowercased, into its vendor prefix, if it has
+// one, and the rest.
+func unprefix(name string) (prefix, base string) {
+	name = strings.ToLower(name)
+	for _, p := range vendorPrefixes {
+		if strings.HasPrefix(name, p) && len(name) > len(p) {
+			return p, name[len(p):]
+		}
+	}
+	return "", name
+}
+
+// Prefix strips, normalizes, or adds the vendor prefixes of the properties,
+// at-rules, and values listed in table, throughout s.
+//
+// The legacy prefixed linear gradients measure their direction the other
+// way around, from the side the gradient starts at, so "left" is "to
+// right" and an angle a is 90deg - a.  Their directions are converted as
+// the prefix is removed or added.  A gradient whose direction cannot be,
+// such as one with an angle in turns, is left as it is.
+func Prefix(s *Stylesheet, table PrefixTable, mode PrefixMode) {
+	s.Rules = prefixRules(s.Rules, table, mode)
+}
+
+func prefixRules(rules []*Rule, table PrefixTable, mode PrefixMode) []*Rule {
+	for _, r := range rules {
+		r.Declarations = prefixDeclarations(r.Declarations, table, mode)
+		r.Rules = prefixRules(r.Rules, table, mode)
+	}
+	var out []*Rule
+	for _, r := range rules {
+		prefix, base := unprefix(r.AtKeyword)
+		prefixes, listed := table.AtRules[base]
+		switch {
+		case !listed || r.AtKeyword == "":
+		case mode == StripPrefixes && prefix != "":
+			continue
+		case mode == NormalizePrefixes && prefix != "":
+			if hasRule(rules, base, r.Prelude) {
+				continue
+			}
+			r.AtKeyword = base
+		case mode == AddPrefixes && prefix == "":
+			for _, p := range prefixes {
+				if !hasRule(rules, p+base, r.Prelude) {
+					c := r.Clone()
+					c.AtKeyword = p + r.AtKeyword
+					out = append(out, c)
+				}
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// hasRule reports whether rules has an at-rule with the given name and
+// prelude.
+func hasRule(rules []*Rule, name string, prelude []tokenizer.Token) bool {
+	for _, r := range rules {
+		if tokenizer.IdentEquals(r.AtKeyword, name) && render(r.Prelude) == render(prelude) {
+			return true
+		}
+	}
+	return false
+}
+
+func prefixDeclarations(decls []parser.Declaration, table PrefixTable, mode PrefixMode) []parser.Declaration {
+	var out []parser.Declaration
+	for i, d := range decls {
+		prefix, base := unprefix(d.Name)
+		prefixes, listed := table.Properties[base]
+		switch mode {
+		case StripPrefixes:
+			if listed && prefix != "" || hasPrefixedValue(d.Value, table) {
+				continue
+			}
+		case NormalizePrefixes:
+			if listed && prefix != "" {
+				d.Name = base
+			}
+			value, changed, ok := rewriteNames(d.Value, func(name string) string {
+				if p, b := unprefix(name); p != "" && table.Values[b] != nil {
+					return b
+				}
+				return name
+			})
+			if ok && changed {
+				d.Value = value
+			}
+			if d.Name != decls[i].Name || changed && ok {
+				if overridden(d, decls[i+1:], table) {
+					continue
+				}
+			}
+		case AddPrefixes:
+			if prefix != "" {
+				break
+			}
+			for _, p := range prefixes {
+				if !hasDeclaration(decls, p+d.Name, nil) {
+					pd := d
+					pd.Name = p + d.Name
+					out = append(out, pd)
+				}
+			}
+			for _, p := range valuePrefixes(d.Value, table) {
+				p := p
+				value, _, ok := rewriteNames(d.Value, func(name string) string {
+					if vp, b := unprefix(name); vp == "" && hasString(table.Values[b], p) {
+						return p + name
+					}
+					return name
+				})
+				if ok && !hasDeclaration(decls, d.Name, value) {
+					pd := d
+					pd.Value = value
+					out = append(out, pd)
+				}
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// overridden reports whether d is overridden by one of the later
+// declarations, once they are normalized too.
+func overridden(d parser.Declaration, later []parser.Declaration, table PrefixTable) bool {
+	for _, e := range later {
+		name := e.Name
+		if p, base := unprefix(name); p != "" && table.Properties[base] != nil {
+			name = base
+		}
+		if tokenizer.IdentEquals(name, d.Name) && (e.Important || !d.Important) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDeclaration reports whether decls has a declaration of the named
+// property, with the given value if it is not nil.
+func hasDeclaration(decls []parser.Declaration, name string, value []tokenizer.Token) bool {
+	for _, d := range decls {
+		if tokenizer.IdentEquals(d.Name, name) && (value == nil || render(d.Value) == render(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isName reports whether t is an identifier or function, whose name a
+// PrefixTable may list.
+func isName(t tokenizer.Token) bool {
+	return t.Type == tokenizer.TokenIdent || t.Type == tokenizer.TokenFunction
+}
+
+func hasPrefixedValue(toks []tokenizer.Token, table PrefixTable) bool {
+	for _, t := range toks {
+		if p, base := unprefix(t.Value); isName(t) && p != "" && table.Values[base] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// valuePrefixes returns the prefixes the table lists for the unprefixed
+// names in toks, in the order they are first listed.
+func valuePrefixes(toks []tokenizer.Token, table PrefixTable) []string {
+	var out []string
+	for _, t := range toks {
+		if p, base := unprefix(t.Value); isName(t) && p == "" {
+			for _, vp := range table.Values[base] {
+				if !hasString(out, vp) {
+					out = append(out, vp)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// rewriteNames returns toks with each identifier and function name replaced
+// by rename(name).  Linear gradients have their direction converted as
+// their prefix is added or removed; ok is false if one cannot be.
+func rewriteNames(toks []tokenizer.Token, rename func(name string) string) (out []tokenizer.Token, changed, ok bool) {
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if !isName(t) {
+			out = append(out, t)
+			continue
+		}
+		name := rename(t.Value)
+		if name == t.Value {
+			out = append(out, t)
+			continue
+		}
+		changed = true
+		if t.Type == tokenizer.TokenIdent {
+			out = append(out, tokenizer.NewIdent(name))
+			continue
+		}
+		out = append(out, tokenizer.NewFunction(name))
+		prefix, base := unprefix(name)
+		if base != "linear-gradient" && base != "repeating-linear-gradient" {
+			continue
+		}
+		end := closeParen(toks, i+1)
+		args, converted := convertDirection(toks[i+1:end], prefix != "")
+		if !converted {
+			return nil, false, false
+		}
+		out = append(out, args...)
+		i = end - 1
+	}
+	return out, changed, true
+}
+
+// closeParen returns the index of the parenthesis closing the function or
+// block whose contents start at toks[i], or len(toks) if it is not closed.
+func closeParen(toks []tokenizer.Token, i int) int {
+	depth := 0
+	for ; i < len(toks); i++ {
+		switch toks[i].Type {
+		case tokenizer.TokenFunction, tokenizer.TokenOpenParen:
+			depth++
+		case tokenizer.TokenCloseParen:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return len(toks)
+}
+
+var oppositeSides = map[string]string{
+	"left": "right", "right": "left", "top": "bottom", "bottom": "top",
+}
+
+// convertDirection converts the direction at the start of the arguments of
+// a linear gradient to the legacy form, or from it.
+func convertDirection(args []tokenizer.Token, legacy bool) ([]tokenizer.Token, bool) {
+	parts := parser.SplitCommas(args)
+	if len(parts) == 0 {
+		return args, true
+	}
+	start := cap(args) - cap(parts[0])
+	rest := args[start+len(parts[0]):]
+	cvs := parser.ComponentValues(parts[0])
+
+	var dir []tokenizer.Token
+	switch {
+	case len(cvs) == 1 && cvs[0][0].Type == tokenizer.TokenDimension:
+		e := cvs[0][0].Extra.(*tokenizer.TokenExtraNumeric)
+		f, ok := cvs[0][0].Float()
+		if !ok || strings.ToLower(e.Dimension) != "deg" {
+			return nil, false
+		}
+		dir = append(dir, tokenizer.NewDimension(90-f, "deg"))
+	case legacy && len(cvs) > 0 && cvs[0][0].MatchesIdent("to"):
+		sides, ok := opposites(cvs[1:])
+		if !ok {
+			return nil, false
+		}
+		dir = sides
+	case !legacy && len(cvs) > 0 && len(cvs[0]) == 1 && oppositeSides[strings.ToLower(cvs[0][0].Value)] != "":
+		sides, ok := opposites(cvs)
+		if !ok {
+			return nil, false
+		}
+		dir = append([]tokenizer.Token{tokenizer.NewIdent("to"), space}, sides...)
+	default:
+		// no direction, which is top to bottom in either form
+		return args, true
+	}
+	out := append(append([]tokenizer.Token(nil), args[:start]...), dir...)
+	return append(out, rest...), true
+}
+
+var space = tokenizer.Token{Type: tokenizer.TokenS, Value: " "}
+
+// opposites returns the sides opposite to the one or two in cvs.
+func opposites(cvs [][]tokenizer.Token) ([]tokenizer.Token, bool) {
+	if len(cvs) == 0 || len(cvs) > 2 {
+		return nil, false
+	}
+	var out []tokenizer.Token
+	for i, cv := range cvs {
+		if len(cv) != 1 || cv[0].Type != tokenizer.TokenIdent {
+			return nil, false
+		}
+		side := oppositeSides[strings.ToLower(cv[0].Value)]
+		if side == "" {
+			return nil, false
+		}
+		if i > 0 {
+			out = append(out, space)
+		}
+		out = append(out, tokenizer.NewIdent(side))
+	}
+	return out, true
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// KnownNames lists the names that are used in the documents a stylesheet
+// is for.  A nil map allows any name of that kind.
+type KnownNames struct {
+	// Tags holds lowercased element names.
+	Tags    map[string]bool
+	Classes map[string]bool
+	IDs     map[string]bool
+}
+
+// Used reports whether cp uses only known names, which is a function that
+// can be given to Purge.
+func (k KnownNames) Used(cp *selector.Compound) bool {
+	if k.Tags != nil && cp.Type != "" && cp.Type != "*" && !k.Tags[cp.Type] {
+		return false
+	}
+	for _, s := range cp.Simples {
+		switch {
+		case s.Kind == selector.Class && k.Classes != nil && !k.Classes[s.Name]:
+			return false
+		case s.Kind == selector.ID && k.IDs != nil && !k.IDs[s.Name]:
+			return false
+		}
+	}
+	return true
+}
+
+// Purge removes the style rules of s that cannot match anything, for
+// shrinking a stylesheet to what a set of documents uses.  used reports
+// whether a compound selector could match an element; the selectors in
+// :is(), :where(), and :has() are checked too, but those in :not() are
+// not, as it matches the elements they do not.  From a rule with some
+// selectors that can match, only the others are removed.
+//
+// Grouping rules such as @media are kept if anything is left in them.
+// The @keyframes rules that are no longer named by an animation, or by a
+// custom property that may be used in one, are removed.  Rules whose
+// selectors cannot be parsed are kept, and reported as errors.  A rule
+// with a keep directive is kept whole.
+func Purge(s *Stylesheet, used func(cp *selector.Compound) bool) []error {
+	var errs []error
+	s.Rules = purgeRules(s.Rules, s.Namespaces(), used, &errs)
+	s.Rules = purgeKeyframes(s.Rules, animationNames(s))
+	return errs
+}
+
+func purgeRules(rules []*Rule, namespaces map[string]string, used func(*selector.Compound) bool, errs *[]error) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		switch {
+		case r.HasDirective("keep"):
+		case r.AtKeyword == "":
+			l, err := selector.ParseWithNamespaces(r.Prelude, namespaces)
+			if err != nil {
+				*errs = append(*errs, errorf("cannot purge %q: %v", render(r.Prelude), err))
+				break
+			}
+			var kept selector.List
+			for _, c := range l {
+				if canMatch(c, used) {
+					kept = append(kept, c)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			if len(kept) < len(l) {
+				r.Prelude = tokenize(kept.String())
+			}
+			r.Rules = purgeRules(r.Rules, namespaces, used, errs)
+		case groupingRules[strings.ToLower(r.AtKeyword)] || tokenizer.IdentEquals(r.AtKeyword, "scope"):
+			before := len(r.Rules)
+			r.Rules = purgeRules(r.Rules, namespaces, used, errs)
+			// an empty @layer still sets the order of layers
+			if before > 0 && len(r.Rules) == 0 && len(r.Declarations) == 0 && !tokenizer.IdentEquals(r.AtKeyword, "layer") {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// canMatch reports whether every compound selector of c is used.
+func canMatch(c *selector.Complex, used func(*selector.Compound) bool) bool {
+	for _, cp := range c.Compounds {
+		if !used(cp) {
+			return false
+		}
+		for _, s := range cp.Simples {
+			if s.Kind != selector.PseudoClass || s.Args == nil || s.Name == "not" {
+				continue
+			}
+			matched := false
+			for _, arg := range s.Args {
+				if canMatch(arg, used) {
+					matched = true
+					break
+				}
+			}
+			if !matched && len(s.Args) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// purgeKeyframes removes the @keyframes rules whose names are not in
+// names.
+func purgeKeyframes(rules []*Rule, names map[string]bool) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		if _, base := unprefix(r.AtKeyword); base == "keyframes" {
+			if name := keyframesName(r); name != "" && !names[name] && !r.HasDirective("keep") {
+				continue
+			}
+		}
+		r.Rules = purgeKeyframes(r.Rules, names)
+		out = append(out, r)
+	}
+	return out
+}
+
+// keyframesName returns the name of a @keyframes rule, or "" if it has no
+// valid name.
+func keyframesName(r *Rule) string {
+	if len(r.Prelude) != 1 || (r.Prelude[0].Type != tokenizer.TokenIdent && r.Prelude[0].Type != tokenizer.TokenString) {
+		return ""
+	}
+	return r.Prelude[0].Value
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// RuleFilter reports whether FindRules or FindDeclarations should look at
+// the rule r, given the rules enclosing it, outermost first.
+type RuleFilter func(r *Rule, parents []*Rule) bool
+
+// Found is a rule found by FindRules, or one holding a declaration found
+// by FindDeclarations.
+type Found struct {
+	Rule *Rule
+	// Parents are the rules enclosing Rule, outermost first.
+	Parents []*Rule
+	// Declaration points to the declaration found in Rule.Declarations, so
+	// that it can be changed in place.  It is nil for FindRules.
+	Declaration *parser.Declaration
+}
+
+// FindRules returns the rules of s, nested ones included, that every
+// filter accepts, in the order they appear.  Their Index, and that of
+// their declarations, give their positions.
+func (s *Stylesheet) FindRules(filters ...RuleFilter) []Found {
+	var found []Found
+	find(s.Rules, nil, filters, func(r *Rule, parents []*Rule) {
+		found = append(found, Found{Rule: r, Parents: parents})
+	})
+	return found
+}
+
+// FindDeclarations returns the declarations of property, compared as
+// Cascade compares them, in the rules of s that every filter accepts, in
+// the order they appear.
+func (s *Stylesheet) FindDeclarations(property string, filters ...RuleFilter) []Found {
+	key := propertyKey(property)
+	var found []Found
+	find(s.Rules, nil, filters, func(r *Rule, parents []*Rule) {
+		for i := range r.Declarations {
+			if propertyKey(r.Declarations[i].Name) == key {
+				found = append(found, Found{Rule: r, Parents: parents, Declaration: &r.Declarations[i]})
+			}
+		}
+	})
+	return found
+}
+
+func find(rules []*Rule, parents []*Rule, filters []RuleFilter, fn func(r *Rule, parents []*Rule)) {
+	for _, r := range rules {
+		ok := true
+		for _, f := range filters {
+			if !f(r, parents) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			fn(r, parents)
+		}
+		find(r.Rules, append(parents[:len(parents):len(parents)], r), filters, fn)
+	}
+}
+
+// WithSelectorContaining accepts the style rules with a selector
+// containing sel.  If sel is a compound selector, such as ".btn" or
+// "a.btn:hover", a selector contains it if one of its compound selectors
+// has all of the simple selectors of sel, so ".btn" is found in
+// "div > a.btn.big" but not in ".btn-primary".  Otherwise, the text of the
+// selector, with its whitespace and comments normalized, must contain
+// that of sel.
+func WithSelectorContaining(sel string) RuleFilter {
+	toks := tokenize(sel)
+	want, err := selector.Parse(toks)
+	if err != nil || len(want) != 1 || len(want[0].Compounds) != 1 {
+		text := render(normalizePrelude(&Rule{Prelude: toks}))
+		return func(r *Rule, parents []*Rule) bool {
+			return r.AtKeyword == "" && strings.Contains(render(normalizePrelude(r)), text)
+		}
+	}
+	return func(r *Rule, parents []*Rule) bool {
+		if r.AtKeyword != "" {
+			return false
+		}
+		l, err := selector.Parse(r.Prelude)
+		return err == nil && containsCompound(l, want[0].Compounds[0])
+	}
+}
+
+func containsCompound(l selector.List, want *selector.Compound) bool {
+	for _, c := range l {
+		for _, cp := range c.Compounds {
+			if hasSimples(cp, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasSimples reports whether cp has the type and all of the simple
+// selectors of want.
+func hasSimples(cp, want *selector.Compound) bool {
+	if want.Type != "" && want.Type != cp.Type {
+		return false
+	}
+	for _, w := range want.Simples {
+		found := false
+		for _, s := range cp.Simples {
+			if s.String() == w.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// WithAtRule accepts the at-rules with the given name, such as "media".
+func WithAtRule(name string) RuleFilter {
+	return func(r *Rule, parents []*Rule) bool {
+		return tokenizer.IdentEquals(r.AtKeyword, name)
+	}
+}
+
+// Inside accepts the rules nested in a rule that filter accepts, such as
+// Inside(WithAtRule("media")).
+func Inside(filter RuleFilter) RuleFilter {
+	return func(r *Rule, parents []*Rule) bool {
+		for i, p := range parents {
+			if filter(p, parents[:i]) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// RenameOptions gives the functions RenameSelectors renames names with.
+// A nil function leaves that kind of name as it is.
+type RenameOptions struct {
+	Class     func(name string) string
+	ID        func(name string) string
+	Keyframes func(name string) string
+}
+
+// Renames maps the names that RenameSelectors found to their new names.
+type Renames struct {
+	Classes   map[string]string
+	IDs       map[string]string
+	Keyframes map[string]string
+}
+
+// RenameSelectors renames the classes and IDs in the selectors of s, and
+// the @keyframes rules and the animations that use them, as for CSS
+// Modules.  Each function is called once for each name, and the new names
+// are returned, so that they can be given to the elements that use them.
+//
+// Selectors are rewritten token by token, so everything else in them is
+// kept as it was written, even in selectors that are not valid.
+func RenameSelectors(s *Stylesheet, opts RenameOptions) *Renames {
+	rn := &Renames{
+		Classes: make(map[string]string),
+		IDs:     make(map[string]string),
+	}
+	if opts.Class != nil || opts.ID != nil {
+		renameRules(s.Rules, opts, rn)
+	}
+	if opts.Keyframes != nil {
+		rn.Keyframes = renameKeyframes(s, opts.Keyframes)
+	} else {
+		rn.Keyframes = make(map[string]string)
+	}
+	return rn
+}
+
+func renameRules(rules []*Rule, opts RenameOptions, rn *Renames) {
+	for _, r := range rules {
+		if _, base := unprefix(r.AtKeyword); base == "keyframes" {
+			// the preludes in the block are keyframe selectors
+			continue
+		}
+		if r.AtKeyword == "" || tokenizer.IdentEquals(r.AtKeyword, "scope") {
+			r.Prelude = renameSelector(r.Prelude, opts, rn)
+		}
+		renameRules(r.Rules, opts, rn)
+	}
+}
+
+// renameSelector returns the tokens of a selector with its classes and IDs
+// renamed.
+func renameSelector(toks []tokenizer.Token, opts RenameOptions, rn *Renames) []tokenizer.Token {
+	var out []tokenizer.Token
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case opts.Class != nil && t.Type == tokenizer.TokenDelim && t.Value == "." &&
+			i+1 < len(toks) && toks[i+1].Type == tokenizer.TokenIdent:
+			out = append(out, t, tokenizer.NewIdent(rename(toks[i+1].Value, opts.Class, rn.Classes)))
+			i++
+			continue
+		case opts.ID != nil && t.Type == tokenizer.TokenHash:
+			if e, ok := t.Extra.(*tokenizer.TokenExtraHash); ok && e.IsIdentifier {
+				t = tokenizer.NewHash(rename(t.Value, opts.ID, rn.IDs))
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// rename returns the new name for name, calling fn only the first time it
+// is seen.
+func rename(name string, fn func(string) string, names map[string]string) string {
+	if renamed, ok := names[name]; ok {
+		return renamed
+	}
+	renamed := fn(name)
+	names[name] = renamed
+	return renamed
+}
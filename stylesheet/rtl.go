@@ -0,0 +1,229 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// sideShorthands are the shorthands with a value for each side, in the
+// order top, right, bottom, left.
+var sideShorthands = map[string]bool{
+	"margin": true, "padding": true, "inset": true, "border-width": true, "border-style": true,
+	"border-color": true, "scroll-margin": true, "scroll-padding": true,
+}
+
+// sideKeywordProperties are the properties whose left and right keywords
+// are flipped.
+var sideKeywordProperties = map[string]bool{
+	"float": true, "clear": true, "text-align": true, "text-align-last": true,
+}
+
+// flippedKeywords are the keywords flipped in the properties that take them.
+var flippedKeywords = map[string]string{
+	"left": "right", "right": "left", "ltr": "rtl", "rtl": "ltr",
+	"e-resize": "w-resize", "w-resize": "e-resize", "ne-resize": "nw-resize", "nw-resize": "ne-resize",
+	"se-resize": "sw-resize", "sw-resize": "se-resize",
+}
+
+// FlipRTL flips s throughout from left-to-right to right-to-left, for
+// making the right-to-left version of a stylesheet:
+//
+//   - Properties for one side, such as margin-left, left, and
+//     border-top-left-radius, are swapped with those for the other.
+//   - The left and right keywords of float, clear, and text-align, the
+//     direction, and the cursors such as e-resize are swapped.
+//   - The values for the right and left sides are swapped in shorthands
+//     such as margin and padding, so "1px 2px 3px 4px" becomes
+//     "1px 4px 3px 2px", and the corners in border-radius.
+//   - The horizontal positions of background-position and
+//     background-position-x are flipped: keywords are swapped, percentages
+//     become 100% less the percentage, and lengths are made offsets from
+//     the right.
+//
+// Values using var() are not flipped, as their parts are not known until
+// it is substituted, nor are the positions in the background shorthand.
+// The rules that a directive disables "fliprtl" for are left as they are,
+// but not the rules nested in them.
+func FlipRTL(s *Stylesheet) {
+	walk(s.Rules, func(r *Rule) {
+		if r.Disabled("fliprtl") {
+			return
+		}
+		decls := make([]parser.Declaration, len(r.Declarations))
+		for i, d := range r.Declarations {
+			if !strings.HasPrefix(d.Name, "--") && !hasVar(d.Value) {
+				d.Name, d.Value = flipDeclaration(d.Name, d.Value)
+			}
+			decls[i] = d
+		}
+		r.Declarations = decls
+	})
+}
+
+func hasVar(toks []tokenizer.Token) bool {
+	for _, t := range toks {
+		if t.Type == tokenizer.TokenFunction && tokenizer.IdentEquals(t.Value, "var") {
+			return true
+		}
+	}
+	return false
+}
+
+// flipDeclaration returns the name and value of the declaration flipped.
+func flipDeclaration(name string, value []tokenizer.Token) (string, []tokenizer.Token) {
+	prefix, base := unprefix(name)
+	parts := strings.Split(base, "-")
+	flipped := false
+	for i, p := range parts {
+		if p == "left" || p == "right" {
+			parts[i] = flippedKeywords[p]
+			flipped = true
+		}
+	}
+	if flipped {
+		name = prefix + strings.Join(parts, "-")
+	}
+	switch {
+	case sideShorthands[base]:
+		return name, flipSides(value)
+	case base == "border-radius":
+		return name, flipCorners(value)
+	case base == "background-position" || base == "background-position-x":
+		return name, flipPositions(value)
+	case sideKeywordProperties[base]:
+		return name, flipKeywords(value, "left", "right")
+	case base == "direction":
+		return name, flipKeywords(value, "ltr", "rtl")
+	case base == "cursor":
+		return name, flipKeywords(value, "e-resize", "w-resize", "ne-resize", "nw-resize", "se-resize", "sw-resize")
+	}
+	return name, value
+}
+
+// flipKeywords returns toks with those of keywords in it flipped.
+func flipKeywords(toks []tokenizer.Token, keywords ...string) []tokenizer.Token {
+	out := make([]tokenizer.Token, len(toks))
+	for i, t := range toks {
+		out[i] = t
+		if t.Type != tokenizer.TokenIdent {
+			continue
+		}
+		for _, kw := range keywords {
+			if tokenizer.IdentEquals(t.Value, kw) {
+				out[i] = tokenizer.NewIdent(flippedKeywords[kw])
+			}
+		}
+	}
+	return out
+}
+
+// flipSides swaps the right and left values of a four-value shorthand.
+// With fewer values, the right and left sides are the same.
+func flipSides(toks []tokenizer.Token) []tokenizer.Token {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) != 4 {
+		return toks
+	}
+	return joinSpaced([][]tokenizer.Token{cvs[0], cvs[3], cvs[2], cvs[1]})
+}
+
+// flipCorners swaps the left and right corners of border-radius, on each
+// side of its slash.
+func flipCorners(toks []tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	for i, half := range splitSlash(toks) {
+		cvs := parser.ComponentValues(half)
+		switch len(cvs) {
+		case 2:
+			cvs = [][]tokenizer.Token{cvs[1], cvs[0]}
+		case 3:
+			cvs = [][]tokenizer.Token{cvs[1], cvs[0], cvs[1], cvs[2]}
+		case 4:
+			cvs = [][]tokenizer.Token{cvs[1], cvs[0], cvs[3], cvs[2]}
+		}
+		if i > 0 {
+			out = append(out, space, tokenizer.NewDelim('/'), space)
+		}
+		out = append(out, joinSpaced(cvs)...)
+	}
+	return out
+}
+
+// splitSlash splits toks at its top-level '/' delimiters.
+func splitSlash(toks []tokenizer.Token) [][]tokenizer.Token {
+	var out [][]tokenizer.Token
+	var part []tokenizer.Token
+	for _, cv := range parser.ComponentValues(toks) {
+		if len(cv) == 1 && cv[0].Type == tokenizer.TokenDelim && cv[0].Value == "/" {
+			out = append(out, part)
+			part = nil
+			continue
+		}
+		part = append(part, cv...)
+		part = append(part, space)
+	}
+	return append(out, part)
+}
+
+// flipPositions flips the horizontal part of each position in a
+// comma-separated list.
+func flipPositions(toks []tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	for i, layer := range parser.SplitCommas(toks) {
+		if i > 0 {
+			out = append(out, tokenizer.Token{Type: tokenizer.TokenComma, Value: ","}, space)
+		}
+		out = append(out, flipPosition(parser.ComponentValues(layer))...)
+	}
+	return out
+}
+
+func flipPosition(cvs [][]tokenizer.Token) []tokenizer.Token {
+	for _, cv := range cvs {
+		if cv[0].Type == tokenizer.TokenIdent && (tokenizer.IdentEquals(cv[0].Value, "left") || tokenizer.IdentEquals(cv[0].Value, "right")) {
+			// the offsets after the keywords are from the flipped side
+			var out [][]tokenizer.Token
+			for _, cv := range cvs {
+				out = append(out, flipKeywords(cv, "left", "right"))
+			}
+			return joinSpaced(out)
+		}
+	}
+	if len(cvs) == 0 || len(cvs) > 2 || cvs[0][0].Type == tokenizer.TokenIdent {
+		// a keyword is center, or the vertical part of two keywords
+		return joinSpaced(cvs)
+	}
+	x := cvs[0][0]
+	switch {
+	case len(cvs[0]) > 1:
+	case x.Type == tokenizer.TokenPercentage:
+		f, _ := x.Float()
+		cvs[0] = []tokenizer.Token{tokenizer.NewPercentage(100 - f)}
+	case x.Type == tokenizer.TokenDimension || x.Type == tokenizer.TokenNumber:
+		right := []tokenizer.Token{tokenizer.NewIdent("right"), space, x}
+		if len(cvs) == 1 {
+			return joinSpaced([][]tokenizer.Token{right, {tokenizer.NewIdent("center")}})
+		}
+		if cvs[1][0].Type == tokenizer.TokenIdent {
+			return joinSpaced([][]tokenizer.Token{right, cvs[1]})
+		}
+		return joinSpaced([][]tokenizer.Token{right, {tokenizer.NewIdent("top")}, cvs[1]})
+	}
+	return joinSpaced(cvs)
+}
+
+// joinSpaced joins cvs with spaces between them.
+func joinSpaced(cvs [][]tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	for i, cv := range cvs {
+		if i > 0 {
+			out = append(out, space)
+		}
+		out = append(out, cv...)
+	}
+	return out
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Policy is what Sanitize keeps of a stylesheet from users, such as a
+// theme on a platform that hosts many.  It is plain data, with tags for
+// encoding/json, so that a policy for each tenant can be stored as JSON.
+type Policy struct {
+	// Properties are the properties that may be set, by lowercased name,
+	// and CustomProperties is set if custom properties may be too.  The
+	// same names are allowed as the descriptors of at-rules such as
+	// @font-face.
+	Properties       []string `json:"properties"`
+	CustomProperties bool     `json:"customProperties,omitempty"`
+	// AtRules are the at-rules that may be used, such as "media", by
+	// lowercased name without the '@'.
+	AtRules []string `json:"atRules,omitempty"`
+	// Clamps limit the numbers in the values of properties.
+	Clamps []Clamp `json:"clamps,omitempty"`
+	// Positions are the values the position property may have, such as
+	// "static" and "relative", or empty for any.
+	Positions []string `json:"positions,omitempty"`
+	// URLHosts are the hosts that URLs, as in url() and @import, may be
+	// on, such as "cdn.example.com", or "*.example.com" for those under
+	// it.  RelativeURLs is set if URLs without a host may be used.
+	URLHosts     []string `json:"urlHosts,omitempty"`
+	RelativeURLs bool     `json:"relativeURLs,omitempty"`
+}
+
+// Clamp limits the numbers with a unit in the values of a property and of
+// its longhands, so "margin" limits margin-left too.
+type Clamp struct {
+	Property string `json:"property"`
+	// Unit is the lowercased unit of the numbers, such as "px", "%", or
+	// "" for numbers without one.
+	Unit string `json:"unit"`
+	// Min and Max are the least and greatest numbers allowed, or nil for
+	// no limit.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Sanitize removes from s throughout the declarations and at-rules that p
+// does not allow, and brings the numbers of the properties p clamps into
+// their limits.  It returns what it removed and changed, as errors.
+//
+// In a property with clamps, a number with a unit that none of them
+// limits, such as "1em" where "px" is limited, removes its declaration,
+// unless it is zero, as does any function, such as calc() or var(), since
+// its number cannot be known.  A declaration using a URL on a host that is
+// not allowed, or one that cannot be checked, such as src(var(--x)) or a
+// bad url(), is removed, as are @import rules of such URLs.
+func Sanitize(s *Stylesheet, p *Policy) []error {
+	var errs []error
+	s.Rules = sanitizeRules(s.Rules, p, &errs)
+	return errs
+}
+
+func sanitizeRules(rules []*Rule, p *Policy, errs *[]error) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		kw := strings.ToLower(r.AtKeyword)
+		if kw != "" && !contains(p.AtRules, kw) {
+			*errs = append(*errs, errorf("removed %s: at-rule not allowed", r.head()))
+			continue
+		}
+		if kw == "import" {
+			if urls, ok := urlsIn(r.Prelude, true); !ok || !p.allowsURLs(urls) {
+				*errs = append(*errs, errorf("removed %s: URL not allowed", r.head()))
+				continue
+			}
+		}
+		var decls []parser.Declaration
+		for _, d := range r.Declarations {
+			if d, ok := p.sanitizeDeclaration(d, errs); ok {
+				decls = append(decls, d)
+			}
+		}
+		r.Declarations = decls
+		r.Rules = sanitizeRules(r.Rules, p, errs)
+		out = append(out, r)
+	}
+	return out
+}
+
+// sanitizeDeclaration returns d with its numbers clamped, and reports
+// whether it is allowed.
+func (p *Policy) sanitizeDeclaration(d parser.Declaration, errs *[]error) (parser.Declaration, bool) {
+	name := propertyKey(d.Name)
+	remove := func(why string) (parser.Declaration, bool) {
+		*errs = append(*errs, errorf("removed %s: %s: %s", d.Name, render(normalize(d.Value)), why))
+		return d, false
+	}
+	switch {
+	case strings.HasPrefix(name, "--") && !p.CustomProperties:
+		return remove("custom properties not allowed")
+	case !strings.HasPrefix(name, "--") && !contains(p.Properties, name):
+		return remove("property not allowed")
+	case name == "position" && len(p.Positions) > 0:
+		if t := onlyToken(d.Value); t == nil || t.Type != tokenizer.TokenIdent || !contains(p.Positions, strings.ToLower(t.Value)) {
+			return remove("position not allowed")
+		}
+	}
+	if urls, ok := urlsIn(d.Value, false); !ok || !p.allowsURLs(urls) {
+		return remove("URL not allowed")
+	}
+	var clamps []Clamp
+	for _, c := range p.Clamps {
+		if name == c.Property || strings.HasPrefix(name, c.Property+"-") {
+			clamps = append(clamps, c)
+		}
+	}
+	if len(clamps) == 0 {
+		return d, true
+	}
+	value := make([]tokenizer.Token, len(d.Value))
+	for i, t := range d.Value {
+		value[i] = t
+		f, ok := t.Float()
+		switch {
+		case t.Type == tokenizer.TokenFunction || t.Type == tokenizer.TokenOpenParen || t.Type == tokenizer.TokenOpenBracket:
+			return remove("value cannot be checked")
+		case !ok:
+			continue
+		}
+		var unit string
+		switch t.Type {
+		case tokenizer.TokenPercentage:
+			unit = "%"
+		case tokenizer.TokenDimension:
+			unit = strings.ToLower(t.Extra.(*tokenizer.TokenExtraNumeric).Dimension)
+		}
+		c, found := findClamp(clamps, unit)
+		switch {
+		case !found && f == 0:
+		case !found:
+			return remove("unit not allowed")
+		case c.Min != nil && f < *c.Min:
+			value[i] = numberLike(t, *c.Min, unit)
+		case c.Max != nil && f > *c.Max:
+			value[i] = numberLike(t, *c.Max, unit)
+		}
+	}
+	if before, after := render(d.Value), render(value); before != after {
+		*errs = append(*errs, errorf("clamped %s: %s to %s", d.Name, before, after))
+	}
+	d.Value = value
+	return d, true
+}
+
+func findClamp(clamps []Clamp, unit string) (Clamp, bool) {
+	for _, c := range clamps {
+		if c.Unit == unit {
+			return c, true
+		}
+	}
+	return Clamp{}, false
+}
+
+// numberLike returns a token of the type of t with the number f.
+func numberLike(t tokenizer.Token, f float64, unit string) tokenizer.Token {
+	switch t.Type {
+	case tokenizer.TokenPercentage:
+		return tokenizer.NewPercentage(f)
+	case tokenizer.TokenDimension:
+		return tokenizer.NewDimension(f, unit)
+	}
+	return tokenizer.NewNumber(f)
+}
+
+// onlyToken returns the one token of toks that is not whitespace or a
+// comment, or nil if there is not exactly one.
+func onlyToken(toks []tokenizer.Token) *tokenizer.Token {
+	var only *tokenizer.Token
+	for i := range toks {
+		if tokenizer.IsTrivia(toks[i]) {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = &toks[i]
+	}
+	return only
+}
+
+// urlsIn returns the URLs in toks: those of url() tokens, url() and src()
+// functions, and the strings in image(), image-set(), and cross-fade(), and
+// at the top level if top is set, as in @import.  It reports false if there
+// is a URL that is not a string, such as src(var(--x)), or a bad url() or
+// string token.
+func urlsIn(toks []tokenizer.Token, top bool) ([]string, bool) {
+	var urls []string
+	ok := true
+	var visit func(toks []tokenizer.Token, strs bool)
+	visit = func(toks []tokenizer.Token, strs bool) {
+		for _, cv := range parser.ComponentValues(toks) {
+			t := cv[0]
+			switch {
+			case t.Type.StopToken():
+				ok = false
+			case t.Type == tokenizer.TokenURI, t.Type == tokenizer.TokenString && strs:
+				urls = append(urls, t.Value)
+			case t.Type == tokenizer.TokenFunction && (tokenizer.IdentEquals(t.Value, "url") || tokenizer.IdentEquals(t.Value, "src")):
+				if arg := onlyToken(cv[1 : len(cv)-1]); arg != nil && arg.Type == tokenizer.TokenString {
+					urls = append(urls, arg.Value)
+				} else {
+					ok = false
+				}
+			case t.Type == tokenizer.TokenFunction && len(cv) > 1:
+				_, base := unprefix(strings.ToLower(t.Value))
+				visit(cv[1:len(cv)-1], base == "image" || base == "image-set" || base == "cross-fade")
+			case len(cv) > 1:
+				visit(cv[1:len(cv)-1], false)
+			}
+		}
+	}
+	visit(toks, top)
+	return urls, ok
+}
+
+// allowsURLs reports whether p allows each of urls.
+func (p *Policy) allowsURLs(urls []string) bool {
+	for _, raw := range urls {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return false
+		}
+		if u.Scheme == "" && u.Host == "" && u.Opaque == "" {
+			if !p.RelativeURLs {
+				return false
+			}
+			continue
+		}
+		if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+			return false
+		}
+		host := strings.ToLower(u.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		allowed := false
+		for _, h := range p.URLHosts {
+			h = strings.ToLower(h)
+			if host == h || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// groupingRules are the at-rules whose blocks hold style rules that apply
+// as if they were outside the block.
+var groupingRules = map[string]bool{
+	"media": true, "supports": true, "layer": true, "container": true,
+	"document": true, "-moz-document": true, "starting-style": true,
+}
+
+// ScopeSelectors rewrites the style rules of s to apply only inside the
+// elements matched by scope, such as ".widget", for sandboxing third-party
+// CSS.  Each selector gets scope and a descendant combinator in front of
+// it.
+//
+// The compound selectors at the start of a selector that stand for the
+// document, html, body, and :root, alone or in :is() or :where(), are
+// replaced by scope instead.  Their other simple selectors are kept, so
+// "body.dark a" becomes ".widget.dark a".  The scoping roots of @scope
+// rules are rewritten in the same way, and an @scope rule without one is
+// given scope as its root.  Nested style rules are relative to their
+// parents, and are left alone.
+//
+// If keyframes is not nil, @keyframes rules are renamed by it, along with
+// the animations that use them, so that they do not clash with those of
+// the page.
+//
+// A rule whose selector cannot be parsed, and so cannot be scoped, is
+// removed, and reported as an error.
+func ScopeSelectors(s *Stylesheet, scope *selector.Complex, keyframes func(name string) string) []error {
+	var errs []error
+	s.Rules = scopeRules(s.Rules, s.Namespaces(), scope, &errs)
+	if keyframes != nil {
+		renameKeyframes(s, keyframes)
+	}
+	return errs
+}
+
+func scopeRules(rules []*Rule, namespaces map[string]string, scope *selector.Complex, errs *[]error) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		switch {
+		case r.AtKeyword == "":
+			l, err := selector.ParseWithNamespaces(r.Prelude, namespaces)
+			if err != nil {
+				*errs = append(*errs, errorf("cannot scope %q: %v", render(r.Prelude), err))
+				continue
+			}
+			r.Prelude = scopeList(l, scope)
+		case groupingRules[strings.ToLower(r.AtKeyword)]:
+			r.Rules = scopeRules(r.Rules, namespaces, scope, errs)
+		case tokenizer.IdentEquals(r.AtKeyword, "scope"):
+			if !scopeRoot(r, namespaces, scope, errs) {
+				continue
+			}
+			// the rules inside are relative to the root, but are checked
+			// for the selectors that cannot be parsed all the same
+			r.Rules = parsableRules(r.Rules, namespaces, errs)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// scopeRoot rewrites the scoping root of the @scope rule r, and reports
+// whether it could.
+func scopeRoot(r *Rule, namespaces map[string]string, scope *selector.Complex, errs *[]error) bool {
+	cvs := parser.ComponentValues(r.Prelude)
+	var root, rest []tokenizer.Token
+	if len(cvs) > 0 && cvs[0][0].Type == tokenizer.TokenOpenParen {
+		l, err := selector.ParseWithNamespaces(cvs[0][1:len(cvs[0])-1], namespaces)
+		if err != nil {
+			*errs = append(*errs, errorf("cannot scope %q: %v", render(r.Prelude), err))
+			return false
+		}
+		root = scopeList(l, scope)
+		start := 0
+		for start < len(r.Prelude) && tokenizer.IsTrivia(r.Prelude[start]) {
+			start++
+		}
+		rest = r.Prelude[start+len(cvs[0]):]
+	} else {
+		// the root would be the parent of the <style> element
+		root = tokenize(scope.String())
+		if len(r.Prelude) > 0 {
+			rest = append([]tokenizer.Token{space}, r.Prelude...)
+		}
+	}
+	prelude := []tokenizer.Token{{Type: tokenizer.TokenOpenParen, Value: "("}}
+	prelude = append(prelude, root...)
+	prelude = append(prelude, tokenizer.Token{Type: tokenizer.TokenCloseParen, Value: ")"})
+	r.Prelude = append(prelude, rest...)
+	return true
+}
+
+// parsableRules removes the style rules in rules, and in the grouping
+// rules among them, whose selectors cannot be parsed.
+func parsableRules(rules []*Rule, namespaces map[string]string, errs *[]error) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		switch {
+		case r.AtKeyword == "":
+			if _, err := selector.ParseWithNamespaces(r.Prelude, namespaces); err != nil {
+				*errs = append(*errs, errorf("cannot scope %q: %v", render(r.Prelude), err))
+				continue
+			}
+		case groupingRules[strings.ToLower(r.AtKeyword)] || tokenizer.IdentEquals(r.AtKeyword, "scope"):
+			r.Rules = parsableRules(r.Rules, namespaces, errs)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// scopeList returns the tokens of l with each selector scoped.
+func scopeList(l selector.List, scope *selector.Complex) []tokenizer.Token {
+	for i, c := range l {
+		l[i] = scopeComplex(c, scope)
+	}
+	return tokenize(l.String())
+}
+
+func tokenize(s string) []tokenizer.Token {
+	toks, _ := tokenizer.TokenizeAll([]byte(s), nil)
+	return toks
+}
+
+func scopeComplex(c *selector.Complex, scope *selector.Complex) *selector.Complex {
+	cs := c.Compounds
+	var extra []*selector.Simple
+	n := 0
+	for ; n < len(cs); n++ {
+		if n > 0 && cs[n].Combinator != selector.Descendant && cs[n].Combinator != selector.Child {
+			break
+		}
+		more, ok := documentCompound(cs[n])
+		if !ok {
+			break
+		}
+		extra = append(extra, more...)
+	}
+
+	out := append([]*selector.Compound(nil), scope.Compounds...)
+	last := *out[len(out)-1]
+	last.Simples = append(append([]*selector.Simple(nil), last.Simples...), extra...)
+	out[len(out)-1] = &last
+	if n < len(cs) {
+		first := *cs[n]
+		if n == 0 {
+			first.Combinator = selector.Descendant
+		}
+		out = append(out, &first)
+		out = append(out, cs[n+1:]...)
+	}
+	return &selector.Complex{Compounds: out}
+}
+
+// documentCompound reports whether cp stands for the document, and
+// returns its other simple selectors.
+func documentCompound(cp *selector.Compound) (extra []*selector.Simple, ok bool) {
+	switch cp.Type {
+	case "html", "body":
+		ok = true
+	case "", "*":
+	default:
+		return nil, false
+	}
+	for _, s := range cp.Simples {
+		switch {
+		case s.Kind != selector.PseudoClass:
+		case s.Name == "root":
+			ok = true
+			continue
+		case (s.Name == "is" || s.Name == "where") && isDocument(s.Args):
+			ok = true
+			continue
+		}
+		extra = append(extra, s)
+	}
+	return extra, ok
+}
+
+// isDocument reports whether every selector in l stands for the document.
+func isDocument(l selector.List) bool {
+	for _, c := range l {
+		if len(c.Compounds) != 1 {
+			return false
+		}
+		if extra, ok := documentCompound(c.Compounds[0]); !ok || len(extra) > 0 {
+			return false
+		}
+	}
+	return len(l) > 0
+}
+
+// renameKeyframes renames each @keyframes rule in s by fn, along with the
+// uses of its name in the animation and animation-name properties, and
+// returns the new name of each.
+func renameKeyframes(s *Stylesheet, fn func(name string) string) map[string]string {
+	names := make(map[string]string)
+	walk(s.Rules, func(r *Rule) {
+		if _, base := unprefix(r.AtKeyword); base != "keyframes" {
+			return
+		}
+		cvs := parser.ComponentValues(r.Prelude)
+		if len(cvs) != 1 || (cvs[0][0].Type != tokenizer.TokenIdent && cvs[0][0].Type != tokenizer.TokenString) {
+			return
+		}
+		name := cvs[0][0].Value
+		if renamed := rename(name, fn, names); renamed != name {
+			r.Prelude = []tokenizer.Token{renameToken(cvs[0][0], renamed)}
+		}
+	})
+	if len(names) == 0 {
+		return names
+	}
+	walk(s.Rules, func(r *Rule) {
+		for i, d := range r.Declarations {
+			if _, base := unprefix(d.Name); base != "animation" && base != "animation-name" {
+				continue
+			}
+			var value []tokenizer.Token
+			for _, t := range d.Value {
+				if renamed, ok := names[t.Value]; ok && renamed != t.Value && (t.Type == tokenizer.TokenIdent || t.Type == tokenizer.TokenString) {
+					t = renameToken(t, renamed)
+				}
+				value = append(value, t)
+			}
+			r.Declarations[i].Value = value
+		}
+	})
+	return names
+}
+
+// renameToken returns an identifier or string like t, with the value
+// name.
+func renameToken(t tokenizer.Token, name string) tokenizer.Token {
+	if t.Type == tokenizer.TokenString {
+		return tokenizer.NewString(name)
+	}
+	return tokenizer.NewIdent(name)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"bytes"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// SerializeOptions says how SerializeDeclarations writes declarations.
+type SerializeOptions struct {
+	// Indent, if not empty, makes SerializeDeclarations write a block, with
+	// each declaration on a line of its own starting with Indent.
+	// Otherwise they are written on a single line, for a style attribute.
+	Indent string
+}
+
+// SerializeDeclarations returns decls as CSS source, such as the winners
+// of Cascade, for a style attribute or the block of a rule.
+//
+// Names and strings are escaped as needed, and "!important" is kept.
+// Comments are dropped, and so is whitespace that does not change the
+// meaning of a value, except in custom properties, whose values are kept
+// as written apart from their comments, with each run of whitespace made a
+// single space.  On a single line, the declarations are separated by "; ",
+// and nothing in them breaks the line; the result only needs the escaping
+// of any HTML attribute value, which html.Render does.
+func SerializeDeclarations(decls []parser.Declaration, opts SerializeOptions) string {
+	var buf bytes.Buffer
+	for i, d := range decls {
+		if tokenizer.IsValidCustomPropertyName(d.Name) {
+			d.Value = collapseSpace(d.Value)
+		} else {
+			d.Value = normalize(d.Value)
+		}
+		if opts.Indent != "" {
+			buf.WriteString(opts.Indent)
+			writeDeclaration(&buf, d)
+			buf.WriteByte('\n')
+			continue
+		}
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		writeDeclaration(&buf, d)
+	}
+	if opts.Indent == "" && buf.Len() > 0 {
+		// no trailing semicolon
+		buf.Truncate(buf.Len() - 1)
+	}
+	return buf.String()
+}
+
+// collapseSpace returns toks without comments, and with each run of
+// whitespace made a single space.
+func collapseSpace(toks []tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	for _, t := range toks {
+		switch {
+		case t.Type == tokenizer.TokenComment:
+		case t.Type == tokenizer.TokenS:
+			if len(out) == 0 || out[len(out)-1].Type != tokenizer.TokenS {
+				out = append(out, space)
+			}
+		default:
+			out = append(out, t)
+		}
+	}
+	return out
+}
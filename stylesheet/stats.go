@@ -0,0 +1,227 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// Stats is a summary of a stylesheet, the data behind a CSS statistics
+// dashboard.  It has tags for encoding/json, so it can be written as a
+// JSON report.
+type Stats struct {
+	// Rules is the number of style rules, nested ones included, and
+	// AtRules the number of each kind of at-rule, by lowercased name.
+	Rules   int            `json:"rules"`
+	AtRules map[string]int `json:"atRules"`
+	// Selectors is the number of selectors in the style rules, counting
+	// each selector of a list.
+	Selectors int `json:"selectors"`
+	// Declarations is the number of declarations, Important the number of
+	// those that are !important, and Properties the number for each
+	// property, by lowercased name.
+	Declarations int            `json:"declarations"`
+	Important    int            `json:"important"`
+	Properties   map[string]int `json:"properties"`
+	// Specificity is the number of selectors with each specificity, from
+	// the lowest.  Selectors that cannot be parsed are left out.
+	Specificity []SpecificityCount `json:"specificity"`
+	// Colors, Fonts, and ZIndexes are the distinct colors, font families,
+	// and z-index values used, as written apart from the case of colors.
+	Colors   []string `json:"colors"`
+	Fonts    []string `json:"fonts"`
+	ZIndexes []string `json:"zIndexes"`
+	// Breakpoints are the distinct widths that @media rules test, such as
+	// "768px", by unit and from the smallest.
+	Breakpoints []string `json:"breakpoints"`
+}
+
+// SpecificityCount is the number of selectors with a specificity.
+type SpecificityCount struct {
+	Specificity [3]int `json:"specificity"`
+	Count       int    `json:"count"`
+}
+
+// colorProperties are the properties other than those named "*color" that
+// take color keywords.  In other properties, a keyword such as red may be
+// a name instead, as in animation-name.
+var colorProperties = map[string]bool{
+	"background": true, "outline": true, "box-shadow": true, "text-shadow": true,
+	"fill": true, "stroke": true, "text-decoration": true, "column-rule": true,
+}
+
+// Statistics returns the statistics of s.
+func Statistics(s *Stylesheet) *Stats {
+	st := &Stats{AtRules: map[string]int{}, Properties: map[string]int{}}
+	namespaces := s.Namespaces()
+	specificities := make(map[[3]int]int)
+	colors, fonts, zIndexes, breakpoints := newSet(), newSet(), newSet(), newSet()
+	walk(s.Rules, func(r *Rule) {
+		kw := strings.ToLower(r.AtKeyword)
+		switch {
+		case kw == "":
+			st.Rules++
+			if l, err := selector.ParseWithNamespaces(r.Prelude, namespaces); err == nil {
+				for _, c := range l {
+					specificities[c.Specificity()]++
+				}
+			}
+			st.Selectors += len(parser.SplitCommas(r.Prelude))
+		default:
+			st.AtRules[kw]++
+			if kw == "media" {
+				mediaWidths(r.Prelude, breakpoints)
+			}
+		}
+		for _, d := range r.Declarations {
+			name := propertyKey(d.Name)
+			st.Declarations++
+			st.Properties[name]++
+			if d.Important {
+				st.Important++
+			}
+			eachColor(d, func(cv []tokenizer.Token) {
+				colors.add(strings.ToLower(render(normalize(cv))))
+			})
+			switch name {
+			case "font-family":
+				families, _ := values.ParseFontFamily(d.Value)
+				for _, f := range families {
+					fonts.add(f.Name)
+				}
+			case "font":
+				if font, err := values.ParseFont(d.Value); err == nil {
+					for _, f := range font.Families {
+						fonts.add(f.Name)
+					}
+				}
+			case "z-index":
+				zIndexes.add(render(normalize(d.Value)))
+			}
+		}
+	})
+	for spec, n := range specificities {
+		st.Specificity = append(st.Specificity, SpecificityCount{spec, n})
+	}
+	sort.Sort(bySpecificity(st.Specificity))
+	st.Colors, st.Fonts = colors.sorted(), fonts.sorted()
+	st.ZIndexes, st.Breakpoints = zIndexes.sortedByNumber(), breakpoints.sortedByNumber()
+	return st
+}
+
+// eachColor calls fn for each color in the value of d, and in the
+// functions in it, such as gradients.  Color keywords are only counted in
+// the properties that take them, such as color and border.
+func eachColor(d parser.Declaration, fn func(cv []tokenizer.Token)) {
+	name := propertyKey(d.Name)
+	keywords := strings.HasSuffix(name, "color") || colorProperties[name] || strings.HasPrefix(name, "border")
+	var find func(toks []tokenizer.Token)
+	find = func(toks []tokenizer.Token) {
+		for _, cv := range parser.ComponentValues(toks) {
+			switch {
+			case cv[0].Type == tokenizer.TokenIdent && !keywords:
+			case values.IsColor(cv):
+				fn(cv)
+			case cv[0].Type == tokenizer.TokenFunction && len(cv) > 1:
+				find(cv[1 : len(cv)-1])
+			}
+		}
+	}
+	find(d.Value)
+}
+
+// mediaWidths adds the lengths compared with the width features of a
+// media query list, such as (min-width: 768px) or (400px <= width), to set.
+func mediaWidths(toks []tokenizer.Token, widths set) {
+	for _, cv := range parser.ComponentValues(toks) {
+		if len(cv) < 2 || (cv[0].Type != tokenizer.TokenOpenParen && cv[0].Type != tokenizer.TokenFunction) {
+			continue
+		}
+		inner := cv[1 : len(cv)-1]
+		isWidth := false
+		for _, t := range inner {
+			if t.Type == tokenizer.TokenIdent && strings.HasSuffix(strings.ToLower(t.Value), "width") {
+				isWidth = true
+			}
+		}
+		for _, t := range inner {
+			if isWidth && (t.Type == tokenizer.TokenDimension || t.Type == tokenizer.TokenNumber) {
+				widths.add(strings.ToLower(render([]tokenizer.Token{t})))
+			}
+		}
+		mediaWidths(inner, widths)
+	}
+}
+
+type set map[string]bool
+
+func newSet() set { return make(set) }
+
+func (s set) add(v string) { s[v] = true }
+
+func (s set) sorted() []string {
+	out := []string{}
+	for v := range s {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sortedByNumber returns the values of s grouped by unit, such as "px",
+// and in the order of their numbers within each group, with the values
+// that are not numbers, such as auto, last.
+func (s set) sortedByNumber() []string {
+	out := s.sorted()
+	sort.Stable(byNumber(out))
+	return out
+}
+
+type byNumber []string
+
+func (b byNumber) Len() int      { return len(b) }
+func (b byNumber) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byNumber) Less(i, j int) bool {
+	ni, ui, iok := splitNumber(b[i])
+	nj, uj, jok := splitNumber(b[j])
+	switch {
+	case iok != jok:
+		return iok
+	case !iok:
+		return false
+	case ui != uj:
+		return ui < uj
+	}
+	return ni < nj
+}
+
+// splitNumber splits a number such as "12px" into its value and unit.
+func splitNumber(s string) (float64, string, bool) {
+	end := len(strings.TrimRight(s, "abcdefghijklmnopqrstuvwxyz%"))
+	n, err := strconv.ParseFloat(s[:end], 64)
+	return n, s[end:], err == nil
+}
+
+type bySpecificity []SpecificityCount
+
+func (b bySpecificity) Len() int      { return len(b) }
+func (b bySpecificity) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b bySpecificity) Less(i, j int) bool {
+	return lessSpecificity(b[i].Specificity, b[j].Specificity)
+}
+
+func lessSpecificity(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
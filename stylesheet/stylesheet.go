@@ -0,0 +1,250 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package stylesheet holds a parsed stylesheet as a tree of rules, for passes
+that rewrite it as a whole, such as adding or removing vendor prefixes.
+
+	toks, _ := tokenizer.TokenizeAll(src, nil)
+	s, errs := stylesheet.Parse(toks)
+	stylesheet.Prefix(s, stylesheet.DefaultPrefixes, stylesheet.AddPrefixes)
+	out := s.String()
+
+Every block is parsed with parser.ParseBlockContents, so the rules of a
+block such as that of @media are found the same way as nested style rules.
+Preludes and declaration values are kept as tokens, as the parser leaves
+them; the passes here only look inside them as far as they need to.
+
+Cascade picks the declarations that apply to an element, given the rules
+that match it, and SerializeDeclarations writes them out, such as for a
+style attribute.  Diff compares two stylesheets rule by rule, ignoring their
+formatting, and Dedupe removes the declarations and rules that repeat
+others.  MergeMedia merges the @media rules with the same queries where
+the cascade allows, and Canonicalize writes equal values the same way.
+FlipRTL makes the right-to-left version of a stylesheet, and MediaRanges
+rewrites media features between the range syntax and min-/max- prefixes.
+FlattenNesting compiles CSS Nesting down to flat rules, and PruneTargets
+removes what the browsers targeted do not support.  Statistics summarizes a
+stylesheet, as for a report, and FindRules and FindDeclarations look up the
+parts of it to change.  AnalyzeKeyframes finds the animations naming
+@keyframes rules that do not exist, and the @keyframes rules no animation
+uses.  Merge bundles stylesheets into one, reporting the properties they
+set differently for the same selectors, and AnalyzeUsage reports the values
+each property is set to under each @media, @container, @layer, and
+@supports.  AnalyzePalette finds the colors used, the near duplicates among
+them, and the contrast of the text and background colors of each rule.
+Sanitize keeps only what a Policy allows of a stylesheet from users.
+CheckOrder reports the @charset, @import, and @namespace rules out of the
+order CSS requires, and FixOrder moves them into it.  CheckBudget reports
+the limits on the number of selectors, declarations, and rules that a
+stylesheet goes over.  Dump writes a stylesheet as a tree, for debugging.
+
+Comments starting with "cssparse-", such as one holding cssparse-keep, are
+directives, which Parse attaches to the rules after them, for the passes
+and other tools to honor; see Directive.
+
+The passes change the stylesheet they are given.  To keep a parsed
+stylesheet, such as one in a cache, run them on a Clone of it instead.  A
+clone shares the tokens of preludes and values with the original; passes
+that change a prelude or value give the rule a new slice of tokens, and
+never change those of the old one, so any number of clones of a stylesheet
+can be changed at once, from different goroutines, while the stylesheet
+itself is only read.  Cache keeps stylesheets this way, parsing each source once.
+*/
+package stylesheet
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/riking/cssparse/atrules"
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Stylesheet is a parsed stylesheet.
+type Stylesheet struct {
+	Rules []*Rule
+}
+
+// Rule is an at-rule or a qualified rule, with its block parsed.
+type Rule struct {
+	// AtKeyword is the name of an at-rule, without the '@'.  It is empty
+	// for a qualified rule.
+	AtKeyword string
+	// Prelude is the part of the rule before its block, with whitespace
+	// and comments at either end removed.
+	Prelude []tokenizer.Token
+	// Block is set if the rule has a {} block, which holds Declarations
+	// and Rules.
+	Block        bool
+	Declarations []parser.Declaration
+	Rules        []*Rule
+	// Index is the index in the parsed tokens of the first token of the
+	// rule, as is the Index of each of its Declarations, for finding where
+	// they are in the source with tokenizer.Document.  The rules and
+	// declarations that passes add have the Index of those they were made
+	// from, or zero.
+	Index int
+	// Directives are the directive comments attached to the rule, in the
+	// order they appear.
+	Directives []Directive
+}
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("stylesheet: "+format, args...)
+}
+
+func render(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	tokenizer.RenderTokens(&buf, toks)
+	return buf.String()
+}
+
+// Parse parses toks as a stylesheet, with the blocks of its rules parsed
+// in turn.  The Index of each error is that in toks.
+func Parse(toks []tokenizer.Token) (*Stylesheet, []error) {
+	rules, perrs := parser.ParseStylesheet(toks)
+	var errs []error
+	for _, e := range perrs {
+		errs = append(errs, e)
+	}
+	return &Stylesheet{Rules: convert(rules, toks, 0, &errs)}, errs
+}
+
+// Namespaces returns the namespace prefixes declared by the @namespace rules
+// of s, for selector.ParseWithNamespaces.  The passes that parse selectors
+// resolve them with it.
+func (s *Stylesheet) Namespaces() map[string]string {
+	rules := make([]parser.Rule, len(s.Rules))
+	for i, r := range s.Rules {
+		rules[i] = parser.Rule{AtKeyword: r.AtKeyword, Prelude: r.Prelude}
+		if r.Block {
+			rules[i].Block = []tokenizer.Token{}
+		}
+	}
+	return atrules.Namespaces(rules)
+}
+
+// convert returns rules, parsed from toks, a slice starting at index base
+// of the parsed tokens, as Rules.
+func convert(rules []parser.Rule, toks []tokenizer.Token, base int, errs *[]error) []*Rule {
+	out := make([]*Rule, len(rules))
+	for i, r := range rules {
+		out[i] = &Rule{AtKeyword: r.AtKeyword, Prelude: r.Prelude, Block: r.Block != nil, Index: base + r.Index}
+		out[i].Directives = directivesBefore(toks, r.Index)
+		if r.Block == nil {
+			continue
+		}
+		decls, nested, perrs := parser.ParseBlockContents(r.Block)
+		for _, e := range perrs {
+			moved := *e
+			moved.Index += base + r.BlockIndex
+			*errs = append(*errs, &moved)
+		}
+		for j := range decls {
+			decls[j].Index += base + r.BlockIndex
+		}
+		out[i].Declarations = decls
+		out[i].Rules = convert(nested, r.Block, base+r.BlockIndex, errs)
+		var first *Rule
+		if len(out[i].Rules) > 0 {
+			first = out[i].Rules[0]
+		}
+		out[i].Directives = append(out[i].Directives, leadingDirectives(r.Block, first, base+r.BlockIndex)...)
+	}
+	return out
+}
+
+// String returns s as CSS source, one top-level rule to a line.  The
+// declarations of a block are written before its nested rules.
+func (s *Stylesheet) String() string {
+	var buf bytes.Buffer
+	for _, r := range s.Rules {
+		writeRule(&buf, r)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// String returns r as CSS source.
+func (r *Rule) String() string {
+	var buf bytes.Buffer
+	writeRule(&buf, r)
+	return buf.String()
+}
+
+// head returns the at-keyword and prelude of r.
+func (r *Rule) head() string {
+	s := render(r.Prelude)
+	if r.AtKeyword == "" {
+		return s
+	}
+	kw := render([]tokenizer.Token{tokenizer.NewAtKeyword(r.AtKeyword)})
+	if s == "" {
+		return kw
+	}
+	return kw + " " + s
+}
+
+func writeRule(buf *bytes.Buffer, r *Rule) {
+	buf.WriteString(r.head())
+	if !r.Block {
+		buf.WriteByte(';')
+		return
+	}
+	buf.WriteString(" {")
+	for _, d := range r.Declarations {
+		buf.WriteByte(' ')
+		writeDeclaration(buf, d)
+	}
+	for _, nested := range r.Rules {
+		buf.WriteByte(' ')
+		writeRule(buf, nested)
+	}
+	buf.WriteString(" }")
+}
+
+func writeDeclaration(buf *bytes.Buffer, d parser.Declaration) {
+	if tokenizer.IsValidCustomPropertyName(d.Name) {
+		buf.WriteString(d.Name)
+	} else {
+		buf.WriteString(tokenizer.SerializeIdentifier(d.Name))
+	}
+	buf.WriteString(": ")
+	tokenizer.RenderTokens(buf, d.Value)
+	if d.Important {
+		buf.WriteString(" !important")
+	}
+	buf.WriteByte(';')
+}
+
+// Clone returns a copy of s that can be changed without changing s.
+func (s *Stylesheet) Clone() *Stylesheet {
+	c := &Stylesheet{Rules: make([]*Rule, len(s.Rules))}
+	for i, r := range s.Rules {
+		c.Rules[i] = r.Clone()
+	}
+	return c
+}
+
+// Clone returns a copy of r and the rules in its block that shares no
+// slices with it, apart from the tokens of preludes and declaration
+// values, which are never changed in place.
+func (r *Rule) Clone() *Rule {
+	c := *r
+	c.Declarations = append([]parser.Declaration(nil), r.Declarations...)
+	c.Directives = append([]Directive(nil), r.Directives...)
+	c.Rules = nil
+	for _, nested := range r.Rules {
+		c.Rules = append(c.Rules, nested.Clone())
+	}
+	return &c
+}
+
+// walk calls fn for each rule in rules and in their blocks, parents first.
+func walk(rules []*Rule, fn func(r *Rule)) {
+	for _, r := range rules {
+		fn(r)
+		walk(r.Rules, fn)
+	}
+}
@@ -0,0 +1,974 @@
+// Copyright 2018 Kane York.
+
+package stylesheet
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func parse(t *testing.T, src string) *Stylesheet {
+	toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+	s, errs := Parse(toks)
+	if len(errs) != 0 {
+		t.Fatalf("%s: %v", src, errs)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	src := `@import "a.css"; a { color: red; &:hover { color: blue } } @media print { a { x: y !important } }`
+	s := parse(t, src)
+	want := "@import \"a.css\";\n" +
+		"a { color: red; &:hover { color: blue; } }\n" +
+		"@media print { a { x: y !important; } }\n"
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+
+	// errors in nested blocks are placed in the whole input
+	toks, _ := tokenizer.TokenizeAll([]byte(`a { b { 1px; } }`), nil)
+	_, errs := Parse(toks)
+	if len(errs) != 1 {
+		t.Fatalf("got %v", errs)
+	}
+	if i := errs[0].(*parser.Error).Index; toks[i].Value != "1" {
+		t.Errorf("error at %d, %v", i, toks[i])
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		mode      PrefixMode
+		src, want string
+	}{
+		{StripPrefixes,
+			`a { -webkit-user-select: none; -moz-user-select: none; user-select: none; -webkit-transition: x; ` +
+				`background: -webkit-linear-gradient(left, red, blue); background: linear-gradient(to right, red, blue) } ` +
+				`@-webkit-keyframes k { from { color: red } } @keyframes k { from { color: red } }`,
+			`a { user-select: none; -webkit-transition: x; background: linear-gradient(to right, red, blue); } ` +
+				`@keyframes k { from { color: red; } }`},
+		{NormalizePrefixes,
+			`a { -webkit-user-select: none; user-select: text; -moz-appearance: none; position: -webkit-sticky; ` +
+				`background: -webkit-linear-gradient(left top, red, blue); background-image: -webkit-linear-gradient(45deg, red, blue); ` +
+				`color: -webkit-linear-gradient(1turn, red, blue) } ` +
+				`@-webkit-keyframes k { from { color: red } } @keyframes k { from { color: red } } @-webkit-keyframes j {}`,
+			`a { user-select: text; appearance: none; position: sticky; background: linear-gradient(to right bottom, red, blue); ` +
+				`background-image: linear-gradient(45deg, red, blue); color: -webkit-linear-gradient(1turn, red, blue); } ` +
+				`@keyframes k { from { color: red; } } @keyframes j { }`},
+		{AddPrefixes,
+			`a { user-select: none; -webkit-appearance: none; appearance: none; position: sticky; ` +
+				`background: linear-gradient(to right, red, blue) } @keyframes k { from { color: red } }`,
+			`a { -webkit-user-select: none; -moz-user-select: none; user-select: none; -webkit-appearance: none; ` +
+				`-moz-appearance: none; appearance: none; position: -webkit-sticky; position: sticky; ` +
+				`background: -webkit-linear-gradient(left, red, blue); background: linear-gradient(to right, red, blue); } ` +
+				`@-webkit-keyframes k { from { color: red; } } @keyframes k { from { color: red; } }`},
+	}
+	for _, tt := range tests {
+		s := parse(t, tt.src)
+		Prefix(s, DefaultPrefixes, tt.mode)
+		got := strings.Replace(strings.TrimSpace(s.String()), "\n", " ", -1)
+		if got != tt.want {
+			t.Errorf("mode %d: %s\ngot  %s\nwant %s", tt.mode, tt.src, got, tt.want)
+		}
+	}
+}
+
+// declarations returns the declarations of the block src.
+func declarations(src string) []parser.Declaration {
+	toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+	decls, _, _ := parser.ParseBlockContents(toks)
+	return decls
+}
+
+func TestCascade(t *testing.T) {
+	e := Element{
+		Matches: []Match{
+			{Declarations: declarations("color: red; margin: 1px; padding-top: 1px !important"), Specificity: [3]int{0, 1, 0}, Order: 0},
+			{Declarations: declarations("color: blue; margin-left: 2px"), Specificity: [3]int{0, 0, 1}, Order: 1},
+			{Declarations: declarations("color: green; width: 1px; width: 2px"), Specificity: [3]int{1, 0, 0}, Layer: "base", Order: 2},
+			{Declarations: declarations("padding-top: 3px !important; height: 1px"), Layer: "base", Order: 3},
+			{Declarations: declarations("height: 2px; --X: a"), Layer: "theme", Order: 4},
+			{Declarations: declarations("height: 3px; --x: b"), Layer: "base", Order: 5},
+		},
+		Inline: declarations("margin-top: 5px; width: 3px !important"),
+		Layers: []string{"base", "theme"},
+	}
+	want := map[string]string{
+		"color":         "red",
+		"margin-top":    "5px",
+		"margin-right":  "1px",
+		"margin-bottom": "1px",
+		"margin-left":   "1px",
+		"padding-top":   "3px !important",
+		"width":         "3px !important",
+		"height":        "2px",
+		"--X":           "a",
+		"--x":           "b",
+	}
+	got := Cascade(e)
+	for name, v := range want {
+		d, ok := got[name]
+		s := render(d.Value)
+		if d.Important {
+			s += " !important"
+		}
+		if !ok || s != v {
+			t.Errorf("%s: got %q, want %q", name, s, v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d properties, want %d", len(got), len(want))
+	}
+}
+
+func TestScopeSelectors(t *testing.T) {
+	src := `a, .b > c { x: y } html, body.dark :is(p, q), :root > .c, :where(html, :root) .d, :is(:root, .e) f { x: y } ` +
+		`@media print { a { b { x: y } } } @scope (body .card) to (.end) { img { x: y } } @scope { p { x: y } } ` +
+		`@keyframes spin { from { x: y } } @-webkit-keyframes spin { } @keyframes "fade" { } ` +
+		`.g { animation: spin 1s, fade 2s; -webkit-animation-name: spin; } a:nth-child(2x) { x: y }`
+	s := parse(t, src)
+	toks, _ := tokenizer.TokenizeAll([]byte(`.widget[data-x]`), nil)
+	scope, _ := selector.Parse(toks)
+	errs := ScopeSelectors(s, scope[0], func(name string) string { return name + "-w" })
+	if len(errs) != 1 {
+		t.Errorf("got %v", errs)
+	}
+	want := `.widget[data-x] a, .widget[data-x] .b > c { x: y; }
+.widget[data-x], .widget[data-x].dark :is(p, q), .widget[data-x] > .c, .widget[data-x] .d, .widget[data-x] :is(:root, .e) f { x: y; }
+@media print { .widget[data-x] a { b { x: y; } } }
+@scope (.widget[data-x] .card) to (.end) { img { x: y; } }
+@scope (.widget[data-x]) { p { x: y; } }
+@keyframes spin-w { from { x: y; } }
+@-webkit-keyframes spin-w { }
+@keyframes "fade-w" { }
+.widget[data-x] .g { animation: spin-w 1s, fade-w 2s; -webkit-animation-name: spin-w; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+
+	// a selector that cannot be scoped must not be left to apply to the
+	// whole page
+	src = `svg|rect { x: y } [xlink|href] { x: y } a || b { x: y } .ok { x: y } ` +
+		`@media print { svg|a { x: y } } @scope to (.end) { p { x: y } a || b { x: y } } ` +
+		`@scope (svg|a) { p { x: y } } @scope /* root */ (.a)/**/to (.b) { p { x: y } }`
+	s = parse(t, src)
+	errs = ScopeSelectors(s, scope[0], nil)
+	if len(errs) != 6 {
+		t.Errorf("got %v", errs)
+	}
+	want = `.widget[data-x] .ok { x: y; }
+@media print { }
+@scope (.widget[data-x]) to (.end) { p { x: y; } }
+@scope (.widget[data-x] .a)/**/to (.b) { p { x: y; } }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	walk(s.Rules, func(r *Rule) {
+		if r.AtKeyword == "" && !strings.HasPrefix(render(r.Prelude), ".widget[data-x] ") && !tokenizer.IdentEquals(r.Prelude[0].Value, "p") {
+			t.Errorf("unscoped rule %s", r)
+		}
+	})
+
+	// declared prefixes can be scoped
+	s = parse(t, `@namespace svg url(http://www.w3.org/2000/svg); svg|rect, [svg|x] { x: y } @scope (svg|g) { p { x: y } }`)
+	if errs = ScopeSelectors(s, scope[0], nil); len(errs) != 0 {
+		t.Errorf("got %v", errs)
+	}
+	want = `@namespace svg url("http://www.w3.org/2000/svg");
+.widget[data-x] svg|rect, .widget[data-x] [svg|x] { x: y; }
+@scope (.widget[data-x] svg|g) { p { x: y; } }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestRenameSelectors(t *testing.T) {
+	src := `.a, #b .a:not(.c) { x: y } @media print { .c > [class="a"] { .a & { x: y } } } ` +
+		`@scope (.a) { .d { x: y } } @keyframes k { from { x: y } } .e { animation: k 1s }`
+	s := parse(t, src)
+	calls := 0
+	rn := RenameSelectors(s, RenameOptions{
+		Class: func(name string) string {
+			calls++
+			if name == "d" {
+				return name
+			}
+			return "m_" + name
+		},
+		ID:        func(name string) string { return "id_" + name },
+		Keyframes: func(name string) string { return name + "_1" },
+	})
+	want := `.m_a, #id_b .m_a:not(.m_c) { x: y; }
+@media print { .m_c > [class="a"] { .m_a & { x: y; } } }
+@scope (.m_a) { .d { x: y; } }
+@keyframes k_1 { from { x: y; } }
+.m_e { animation: k_1 1s; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if calls != 4 || rn.Classes["a"] != "m_a" || rn.Classes["d"] != "d" || rn.IDs["b"] != "id_b" ||
+		rn.Keyframes["k"] != "k_1" || len(rn.Classes) != 4 {
+		t.Errorf("got %d calls, %+v", calls, rn)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	src := `a, .gone, div#main > .x { animation: spin 1s; .y & { x: y } } .gone { x: y } ` +
+		`:is(.gone, .x) p:not(.gone) { x: y } :where(.gone) { x: y } div:has(.gone) { x: y } ` +
+		`@media print { .gone { x: y } } @media screen { } @layer base { .gone { x: y } } ` +
+		`@keyframes spin { } @-webkit-keyframes spin { } @keyframes unused { } @keyframes "var" { } ` +
+		`:root { --a: "var" } span::before { x: y } a:nth-child(2x) { x: y }`
+	s := parse(t, src)
+	names := KnownNames{
+		Tags:    map[string]bool{"a": true, "div": true, "p": true},
+		Classes: map[string]bool{"x": true, "y": true},
+	}
+	errs := Purge(s, names.Used)
+	if len(errs) != 1 {
+		t.Errorf("got %v", errs)
+	}
+	want := `a, div#main > .x { animation: spin 1s; .y & { x: y; } }
+:is(.gone, .x) p:not(.gone) { x: y; }
+@media screen { }
+@layer base { }
+@keyframes spin { }
+@-webkit-keyframes spin { }
+@keyframes "var" { }
+:root { --a: "var"; }
+a:nth-child(2x) { x: y; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestCritical(t *testing.T) {
+	src := `@charset "utf-8"; @import "a.css"; @layer base, theme; ` +
+		`@font-face { font-family: "Inter"; src: url(a.woff2) } @font-face { font-family: Unused; src: url(b.woff2) } ` +
+		`h1, .footer { font: bold 2em/1 "Inter", sans-serif; animation: fade 1s; .x & { x: y } } .footer { x: y } ` +
+		`@media (min-width: 1px) { h1 { x: y } .footer { x: y } @font-face { font-family: Other } } @media print { .footer { x: y } } ` +
+		`@keyframes fade { } @keyframes spin { } @property --a { syntax: "*" } a:nth-child(2x) { x: y }`
+	s := parse(t, src)
+	before := s.String()
+	out, errs := Critical(s, func(c *selector.Complex) bool {
+		return c.String() == "h1"
+	})
+	if len(errs) != 1 {
+		t.Errorf("got %v", errs)
+	}
+	want := `@layer base, theme;
+@font-face { font-family: "Inter"; src: url("a.woff2"); }
+h1 { font: bold 2em/1 "Inter", sans-serif; animation: fade 1s; .x & { x: y; } }
+@media (min-width: 1px) { h1 { x: y; } }
+@keyframes fade { }
+@property --a { syntax: "*"; }
+`
+	if got := out.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if s.String() != before {
+		t.Errorf("stylesheet was changed:\n%s", s)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := parse(t, `a,b { color: red; margin: 0 } /* x */ @media print { .x { display: none } } .gone { x: y } @import 'a.css';`)
+	b := parse(t, `a, b{color:red;margin:0 auto;padding:0} @MEDIA print{.x{display:none !important}} .new{x:y} @import "a.css";`)
+	want := `changed a, b: margin: 0 -> 0 auto
+added a, b: padding: 0
+changed @media print / .x: display: none -> none !important
+removed .gone { x: y; }
+added .new { x: y; }
+`
+	changes := Diff(a, b)
+	if got := Report(changes); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	data, err := json.Marshal(changes[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `[{"kind":"changed","rules":["a, b"],"property":"margin","old":"0","new":"0 auto"}]`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if changes := Diff(a, a); len(changes) != 0 {
+		t.Errorf("got %v", changes)
+	}
+
+	// formatting alone is not a change
+	a = parse(t, `a > b, c + d ~ e, :is( f ) { x: rgb( 1 2 3 ) } a :hover { x: y } @media ( width : 1px ) { }`)
+	b = parse(t, `A>b,c+d~e,:IS(f){x:rgb(1 2 3)} a :hover { x: y } @media (width:1px) { }`)
+	if changes := Diff(a, b); len(changes) != 0 {
+		t.Errorf("got\n%s", Report(changes))
+	}
+	b = parse(t, `a > b, c + d ~ e, :is(f) { x: rgb(1 2 3) } a:hover { x: y } @media (width: 1px) { }`)
+	if got, want := Report(Diff(a, b)), "removed a :hover { x: y; }\nadded a:hover { x: y; }\n"; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	src := `a { color: red; margin: 1px; margin: 2px; width: 100px; width: 50vw; color: red; ` +
+		`display: -webkit-box; display: flex; top: 1px !important; top: 2px } ` +
+		`A { color : blue } b { x: y } .c { x: y } .d::-moz-selection { x: y } .e { x: y } ` +
+		`@media print { p { x: y; x: y } P/**/ { z: 1 } } .f { & .g { x: y } } .f { x: y } .h { x: y }`
+	s := parse(t, src)
+	Dedupe(s)
+	want := `a { margin: 2px; width: 100px; width: 50vw; color: red; display: -webkit-box; display: flex; top: 1px !important; top: 2px; color: blue; }
+b, .c { x: y; }
+.d::-moz-selection { x: y; }
+.e { x: y; }
+@media print { p { x: y; z: 1; } }
+.f { & .g { x: y; } }
+.f, .h { x: y; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestMergeMedia(t *testing.T) {
+	s, _ := Parse(tokenize(`@media (min-width: 1px) { a { color: red } }
+a { color: blue }
+@media (min-width:1px) { b { margin: 0 } }
+@media x { p { margin-left: 1px } }
+p { margin: 0 }
+@media x { p { margin-top: 2px } }
+@media y { p { font-size: 1px } }
+p { color: red }
+@media y { p { color: blue } }
+@media z { @font-face { font-family: F } }
+@font-face { font-family: G }
+@media z { i { color: red } }
+@media z { @font-face { font-family: H } }`))
+	MergeMedia(s)
+	want := `@media (min-width: 1px) { a { color: red; } b { margin: 0; } }
+a { color: blue; }
+@media x { p { margin-left: 1px; } }
+p { margin: 0; }
+@media x { p { margin-top: 2px; } }
+p { color: red; }
+@media y { p { font-size: 1px; color: blue; } }
+@media z { @font-face { font-family: F; } i { color: red; } }
+@font-face { font-family: G; }
+@media z { @font-face { font-family: H; } }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	s, _ := Parse(tokenize(`a {
+  COLOR: #ABCDEF;
+  Margin: 0PX  1EM /* x */ 0.0px;
+  width: calc(0px + 10PX);
+  flex: 1 1 0px;
+  background: URL("a.png") , url( "b c.png" ), url(d.png);
+  font-family: "Helvetica Neue", "serif", 'a  b', "1x";
+  --Var: 0px  #ABC;
+}`))
+	Canonicalize(s)
+	want := `a { color: #abcdef; margin: 0 1em 0; width: calc(0px + 10px); flex: 1 1 0px; ` +
+		`background: url(a.png),url("b c.png"),url(d.png); font-family: Helvetica Neue,"serif","a  b","1x"; --Var: 0px #ABC; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	s, errs := Parse(tokenize(`/* cssparse-keep */ .unused { color: red }
+/* license */
+/* cssparse-disable-next-rule dedupe, mergemedia */
+a { color: red; color: blue }
+a { margin: 0 }
+@media print {
+  /* cssparse-keep */
+  /* cssparse-x a b */
+  color: red;
+  /* cssparse-keep */ b { color: red }
+}
+p { /* cssparse-keep */ }
+/* cssparse- not a directive */ /* cssparse-keep */
+@keyframes spin { to { color: red } }`))
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	var got []string
+	walk(s.Rules, func(r *Rule) {
+		for _, d := range r.Directives {
+			got = append(got, render(r.Prelude)+" "+d.Name+" "+strings.Join(d.Args, "/"))
+		}
+	})
+	want := ".unused keep |a disable-next-rule dedupe/mergemedia|print keep |print x a/b|b keep |p keep |spin keep "
+	if strings.Join(got, "|") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(got, "|"), want)
+	}
+	if !s.Rules[1].Disabled("Dedupe") || s.Rules[1].Disabled("canonicalize") || s.Rules[2].Disabled("dedupe") {
+		t.Error("Disabled")
+	}
+
+	c := s.Clone()
+	Dedupe(c)
+	Purge(c, KnownNames{Classes: map[string]bool{}}.Used)
+	want = `.unused { color: red; }
+a { color: red; color: blue; }
+a { margin: 0; }
+@media print { color: red; b { color: red; } }
+p { }
+@keyframes spin { to { color: red; } }
+`
+	if got := c.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFlipRTL(t *testing.T) {
+	s, _ := Parse(tokenize(`a {
+  margin-left: 1px; -webkit-padding-right: 2px; left: 0; border-top-left-radius: 3px;
+  margin: 1px 2px 3px 4px; padding: 1px 2px; float: LEFT; direction: ltr; cursor: ne-resize;
+  border-radius: 1px 2px 3px / 4px 5px 6px 7px;
+  background-position: 25% 0, left 10px top, 10px, 10px 20px, 0 bottom, center;
+  margin: var(--m) 1px 2px 3px; --x: left;
+}
+/* cssparse-disable-next-rule fliprtl */
+b { float: left }`))
+	FlipRTL(s)
+	want := `a { margin-right: 1px; -webkit-padding-left: 2px; right: 0; border-top-right-radius: 3px; ` +
+		`margin: 1px 4px 3px 2px; padding: 1px 2px; float: right; direction: rtl; cursor: nw-resize; ` +
+		`border-radius: 2px 1px 2px 3px / 5px 4px 7px 6px; ` +
+		`background-position: 75% 0, right 10px top, right 10px center, right 10px top 20px, right 0 bottom, center; ` +
+		`margin: var(--m) 1px 2px 3px; --x: left; }
+b { float: left; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMediaRanges(t *testing.T) {
+	src := `@media (width >= 600px) { a { color: red } }
+@media screen and (600px <= width <= 900px), (400px < width) { a { color: red } }
+@media not (1px <= width <= 2px) { a { color: red } }
+@media ((width <= 100px) or (HEIGHT = 1px)) and (16/9 <= aspect-ratio) { a { color: red } }
+@media (min-width: 600px) and (max-resolution: 2dppx), (orientation: portrait) { a { color: red } }`
+	tests := []struct {
+		form RangeForm
+		want string
+	}{
+		{LegacyRanges, `@media (min-width: 600px)
+@media screen and (min-width: 600px) and (max-width: 900px), (400px < width)
+@media not (1px <= width <= 2px)
+@media ((max-width: 100px) or (height: 1px)) and (min-aspect-ratio: 16 / 9)
+@media (min-width: 600px) and (max-resolution: 2dppx), (orientation: portrait)
+`},
+		{RangeSyntax, `@media (width >= 600px)
+@media screen and (600px <= width <= 900px), (400px < width)
+@media not (1px <= width <= 2px)
+@media ((width <= 100px) or (HEIGHT = 1px)) and (16/9 <= aspect-ratio)
+@media (width >= 600px) and (resolution <= 2dppx), (orientation: portrait)
+`},
+	}
+	for _, tt := range tests {
+		s, _ := Parse(tokenize(src))
+		MediaRanges(s, tt.form)
+		var got string
+		for _, r := range s.Rules {
+			got += r.head() + "\n"
+		}
+		if got != tt.want {
+			t.Errorf("%d: got\n%s\nwant\n%s", tt.form, got, tt.want)
+		}
+	}
+}
+
+func TestFlattenNesting(t *testing.T) {
+	s, _ := Parse(tokenize(`.p .q {
+  color: red;
+  &.x > a { color: blue }
+  > b, + c { margin: 0 }
+  .x & { color: green }
+  div& { color: black }
+  :not(&) { color: white }
+  @media print {
+    color: gray;
+    & i { color: pink }
+  }
+}
+.a, .b { & .c { d & { color: red } } }
+a::before { &:hover { color: red } .x & { color: red } }`))
+	errs := FlattenNesting(s)
+	if len(errs) != 1 {
+		t.Errorf("got %v", errs)
+	}
+	want := `.p .q { color: red; }
+.p .q.x > a { color: blue; }
+.p .q > b, .p .q + c { margin: 0; }
+.x :is(.p .q) { color: green; }
+.p div.q { color: black; }
+:not(:is(.p .q)) { color: white; }
+@media print { .p .q { color: gray; } .p .q i { color: pink; } }
+d :is(:is(.a, .b) .c) { color: red; }
+a::before { .x & { color: red; } }
+a::before:hover { color: red; }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPruneTargets(t *testing.T) {
+	targets, err := ParseTargets([]string{"no backdrop-filter", "no display: grid", "no color-mix()", "no :has", "No ::Backdrop", "no @container", "no -ms-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTargets([]string{"no display: round"}); err == nil {
+		t.Error("no error for a keyword display does not take")
+	}
+	if _, err := ParseTargets([]string{"has"}); err == nil {
+		t.Error("no error for a flag without no")
+	}
+	s, _ := Parse(tokenize(`a {
+  background: rgba(0, 0, 0, .5); backdrop-filter: blur(1px); display: block; display: grid;
+  color: red; color: color-mix(in srgb, red, blue); -ms-flex: 1; --x: color-mix(a);
+}
+a:has(b), c { color: red }
+:is(a, b)::backdrop { color: red }
+@container (width > 1px) { a { color: red } }
+@-ms-viewport { width: device-width }
+@supports (backdrop-filter: blur(1px)) { a { color: red } }
+@supports not (backdrop-filter: blur(1px)) { a { opacity: 1 } }
+@supports (display: flex) and (not selector(:has(a))) { b { color: red } }
+@supports (display: flex) or selector(:has(a)) { i { color: red } }`))
+	PruneTargets(s, targets)
+	want := `a { background: rgba(0, 0, 0, .5); display: block; color: red; --x: color-mix(a); }
+a { opacity: 1; }
+@supports (display: flex) and (not selector(:has(a))) { b { color: red; } }
+@supports (display: flex) or selector(:has(a)) { i { color: red; } }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := parse(t, `@charset "utf-8"; @import "base.css"; @namespace svg url(http://www.w3.org/2000/svg);
+a { color: red; margin: 0 } @media print { a { color: black } }`)
+	b := parse(t, `@charset "utf-8"; @layer reset; @import "b.css"; @namespace math url(http://www.w3.org/1998/Math/MathML);
+A { color: blue; color: red; padding: 0 } @media print { a { color: black } } b { color: green }`)
+	c := parse(t, `b { color: green; margin: 1px } @media print { a { color: gray !important } }`)
+	merged, conflicts := Merge(a, b, c)
+	want := `@charset "utf-8";
+@import "base.css";
+@import "b.css";
+@namespace svg url("http://www.w3.org/2000/svg");
+@namespace math url("http://www.w3.org/1998/Math/MathML");
+a { color: red; margin: 0; }
+@media print { a { color: black; } }
+@layer reset;
+A { color: blue; color: red; padding: 0; }
+@media print { a { color: black; } }
+b { color: green; }
+b { color: green; margin: 1px; }
+@media print { a { color: gray !important; } }
+`
+	if got := merged.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	var got []string
+	for _, c := range conflicts {
+		got = append(got, c.String())
+	}
+	if want := "@media print / a: color: black (1) -> gray !important (2)"; strings.Join(got, "|") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(got, "|"), want)
+	}
+	if len(a.Rules) != 5 {
+		t.Error("Merge changed its arguments")
+	}
+
+	_, conflicts = Merge(parse(t, `.x { top: 0 }`), parse(t, `.x { top: 1px }`))
+	if len(conflicts) != 1 || conflicts[0].String() != ".x: top: 0 (0) -> 1px (1)" {
+		t.Errorf("got %v", conflicts)
+	}
+}
+
+func TestAnalyzeUsage(t *testing.T) {
+	s := parse(t, `a { margin: 0 } b { margin: 0; color: red }
+@media (min-width:768px) { a { margin: 1px } @supports (display: grid) { b { margin: 1px } } }
+@layer base { @container card (min-width: 1px) { a { margin: 1px !important } } }
+@layer { a { margin: 0 } }
+@media print { @keyframes k { to { margin: 2px } } @font-face { font-family: x } }`)
+	usage := AnalyzeUsage(s)
+	if len(usage) != 2 {
+		t.Errorf("got %v", usage)
+	}
+	data, err := json.Marshal(usage["margin"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"value":"0","count":2},{"value":"1px","media":["(min-width:768px)"],"count":1},` +
+		`{"value":"1px","media":["(min-width:768px)"],"supports":["(display:grid)"],"count":1},` +
+		`{"value":"1px !important","container":["card (min-width:1px)"],"layer":["base"],"count":1},` +
+		`{"value":"0","layer":[""],"count":1}]`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+}
+
+func TestAnalyzePalette(t *testing.T) {
+	s := parse(t, `a { color: #333; background: WHITE } .b { color: #777; background-color: #fff }
+.c { color: red; background: url(x.png) red } .d { border: 1px solid #343434; color: var(--x); background: #fff }
+@media print { .e { color: RGB(51, 51, 51); background: rgb(0 0 0 / 0%) } }
+.f { animation-name: red; box-shadow: 0 0 1px hsl(0 100% 50%) }`)
+	p := AnalyzePalette(s, .02)
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"colors":[{"hex":"#ff0000","written":["hsl(0 100% 50%)","red"],"count":3},` +
+		`{"hex":"#ffffff","written":["#fff","white"],"count":3},` +
+		`{"hex":"#333333","written":["#333","rgb(51,51,51)"],"count":2},` +
+		`{"hex":"#00000000","written":["rgb(0 0 0 / 0%)"],"count":1},` +
+		`{"hex":"#343434","written":["#343434"],"count":1},{"hex":"#777777","written":["#777"],"count":1}],` +
+		`"groups":[["#333333","#343434"]],` +
+		`"contrasts":[{"rules":["a"],"color":"#333333","background":"#ffffff","ratio":12.63},` +
+		`{"rules":[".b"],"color":"#777777","background":"#ffffff","ratio":4.48},` +
+		`{"rules":["@media print",".e"],"color":"#333333","background":"#00000000","ratio":12.63}]}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	var p Policy
+	err := json.Unmarshal([]byte(`{
+  "properties": ["color", "background", "margin", "z-index", "position", "top", "width"],
+  "atRules": ["media", "import"],
+  "clamps": [
+    {"property": "z-index", "unit": "", "max": 1000},
+    {"property": "margin", "unit": "px", "min": -10},
+    {"property": "top", "unit": "px", "min": 0, "max": 100}
+  ],
+  "positions": ["static", "relative"],
+  "urlHosts": ["*.example.com"]
+}`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := parse(t, `@import url(https://cdn.example.com/a.css); @import "https://evil.test/b.css";
+a { color: red; background: "x"; z-index: 99999; margin: -20px 0 5px; margin: 1em; behavior: url(x.htc); --x: 1 }
+b { position: fixed; top: -5px; width: calc(100% - 1px); background: url("//img.example.com:8080/x.png") }
+c { background: url(javascript:alert(1)); background: url(x.png); background: src(var(--u)); background: url(var(--u)); top: calc(1px) }
+@media print { d { position: Relative; margin: 0 0 0 -5PX } }
+@font-face { font-family: x }`)
+	errs := Sanitize(s, &p)
+	want := `@import url("https://cdn.example.com/a.css");
+a { color: red; background: "x"; z-index: 1000; margin: -10px 0 5px; }
+b { top: 0px; width: calc(100% - 1px); background: url("//img.example.com:8080/x.png"); }
+c { }
+@media print { d { position: Relative; margin: 0 0 0 -5PX; } }
+`
+	if got := s.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if len(errs) != 14 {
+		t.Errorf("got %d errors, want 14:\n%v", len(errs), errs)
+	}
+	if _, err := json.Marshal(&p); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	s := parse(t, `@layer a; @import "a.css"; @namespace svg url(x); @import "b.css"; @charset "utf-8";
+a { color: red } @import "c.css"; @layer b; @namespace math url(y);`)
+	var got []string
+	for _, err := range CheckOrder(s) {
+		got = append(got, strconv.Itoa(err.(*parser.Error).Index)+" "+err.Error())
+	}
+	want := []string{
+		`22 stylesheet: @charset "utf-8" is not the first rule, and is ignored`,
+		`17 stylesheet: @import "b.css" comes after rules other than @charset, @import, and @layer statements, and is ignored`,
+		`38 stylesheet: @import "c.css" comes after rules other than @charset, @import, and @layer statements, and is ignored`,
+		`48 stylesheet: @namespace math url("y") comes after rules other than @charset, @import, @namespace, and @layer statements, and is ignored`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	FixOrder(s)
+	if got, want := s.String(), `@layer a;
+@import "a.css";
+@import "b.css";
+@import "c.css";
+@namespace svg url("x");
+@namespace math url("y");
+a { color: red; }
+@layer b;
+`; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if errs := CheckOrder(s); len(errs) != 0 {
+		t.Errorf("fixed stylesheet: %v", errs)
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	s := parse(t, `a, b { color: red } @media print { c, d { color: red; margin: 0 } } e { color: red }`)
+	var got []string
+	for _, err := range CheckBudget(s, &Budget{MaxSelectors: 3, MaxDeclarations: 3}) {
+		got = append(got, strconv.Itoa(err.(*parser.Error).Index)+" "+err.Error())
+	}
+	want := []string{
+		"20 stylesheet: 5 selectors, over the budget of 3 from the rule c, d",
+		"42 stylesheet: 4 declarations, over the budget of 3 from the rule e",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if errs := CheckBudget(s, &Budget{MaxSelectors: 5, MaxRules: 3}); len(errs) != 0 {
+		t.Errorf("within budget: %v", errs)
+	}
+}
+
+func TestDump(t *testing.T) {
+	s := parse(t, `@media print { #a { margin: 1px 2px !important } }`)
+	var buf bytes.Buffer
+	if err := s.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), `Stylesheet
+  AtRule name="media" block index=0
+    Prelude
+      IDENT "print"
+    QualifiedRule block index=6
+      Prelude
+        HASH "a" id
+      Declaration name="margin" index=10 important
+        Value
+          DIMENSION "1" px
+          S " "
+          DIMENSION "2" px
+`; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var c Cache
+	src := []byte(`a { display: flex } b { color: red; }`)
+	want := parse(t, string(src)).String()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, errs := c.Parse(src)
+			if len(errs) != 0 {
+				t.Errorf("errors: %v", errs)
+			}
+			Prefix(s, DefaultPrefixes, AddPrefixes)
+		}()
+	}
+	wg.Wait()
+	if s, _ := c.Parse(src); s.String() != want {
+		t.Errorf("cached stylesheet changed:\n%s", s)
+	}
+	if _, errs := c.Parse([]byte(`a { color: red; } }`)); len(errs) != 1 {
+		t.Errorf("got errors %v, want 1", errs)
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	src := `a { display: flex; animation: spin 1s; } a { color: red; } @media print { .b { transition: color 1s; } } ` +
+		`@keyframes spin { from { x: y } }`
+	s := parse(t, src)
+	want := s.String()
+	toks, _ := tokenizer.TokenizeAll([]byte(`.w`), nil)
+	scope, _ := selector.Parse(toks)
+	passes := []func(c *Stylesheet){
+		func(c *Stylesheet) { Prefix(c, DefaultPrefixes, AddPrefixes) },
+		func(c *Stylesheet) { ScopeSelectors(c, scope[0], func(name string) string { return name + "-w" }) },
+		func(c *Stylesheet) { Dedupe(c) },
+		func(c *Stylesheet) {
+			RenameSelectors(c, RenameOptions{Class: func(name string) string { return name + "-x" }})
+		},
+	}
+	results := make([]string, len(passes))
+	var wg sync.WaitGroup
+	for i, pass := range passes {
+		wg.Add(1)
+		go func(i int, pass func(*Stylesheet)) {
+			defer wg.Done()
+			c := s.Clone()
+			pass(c)
+			results[i] = c.String()
+		}(i, pass)
+	}
+	wg.Wait()
+	if got := s.String(); got != want {
+		t.Errorf("original changed:\n%s", got)
+	}
+	for i, pass := range passes {
+		c := parse(t, src)
+		pass(c)
+		if results[i] != c.String() {
+			t.Errorf("pass %d on a clone:\n%swant\n%s", i, results[i], c)
+		}
+		if results[i] == want {
+			t.Errorf("pass %d did nothing", i)
+		}
+	}
+
+	r := s.Rules[0].Clone()
+	r.Declarations[0].Value = tokenize("grid")
+	r.Rules = append(r.Rules, &Rule{Prelude: tokenize("b"), Block: true})
+	if got := s.String(); got != want {
+		t.Errorf("original changed:\n%s", got)
+	}
+}
+
+func TestSerializeDeclarations(t *testing.T) {
+	s := parse(t, "x { COLOR : red /* c */ ; margin:0  auto\n\t1px; font-family: \"A\\\"B\", 'C\\a D'; "+
+		"--Raw: { a:b }  /* c */\n x ; width: calc( 1px + 2% ) !IMPORTANT; \\31 a: b; --e:; }")
+	decls := s.Rules[0].Declarations
+	want := `COLOR: red; margin: 0 auto 1px; font-family: "A\"B","C\0A D"; --Raw: { a:b } x; ` +
+		`width: calc(1px + 2%) !important; \31 a: b; --e: `
+	if got := SerializeDeclarations(decls, SerializeOptions{}); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	want = "  COLOR: red;\n  margin: 0 auto 1px;\n  font-family: \"A\\\"B\",\"C\\0A D\";\n  --Raw: { a:b } x;\n" +
+		"  width: calc(1px + 2%) !important;\n  \\31 a: b;\n  --e: ;\n"
+	if got := SerializeDeclarations(decls, SerializeOptions{Indent: "  "}); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if got := SerializeDeclarations(nil, SerializeOptions{}); got != "" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	s := parse(t, `a, .b > c { color: #FFF; background: linear-gradient(red, rgb(0 0 0)); z-index: 10 }
+		#d { COLOR: Red !important; font: bold 12px/1 "Open Sans", serif; animation-name: red; z-index: auto }
+		@media screen and (min-width: 768px) { .e:hover { z-index: 2; font-family: Arial, serif } }
+		@media (400px <= width <= 60em), print and (max-width: 1200px) { .f { border: 1px solid blue } }
+		@font-face { font-family: X; src: url(x.woff) }
+		a:nth-child(2x) { x: y }`)
+	st := Statistics(s)
+	b, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"rules":5,"atRules":{"font-face":1,"media":2},"selectors":6,` +
+		`"declarations":13,"important":1,"properties":{"animation-name":1,"background":1,"border":1,"color":2,` +
+		`"font":1,"font-family":2,"src":1,"x":1,"z-index":3},` +
+		`"specificity":[{"specificity":[0,0,1],"count":1},{"specificity":[0,1,0],"count":1},{"specificity":[0,1,1],"count":1},` +
+		`{"specificity":[0,2,0],"count":1},{"specificity":[1,0,0],"count":1}],` +
+		`"colors":["#fff","blue","red","rgb(0 0 0)"],"fonts":["Arial","Open Sans","X","serif"],` +
+		`"zIndexes":["2","10","auto"],"breakpoints":["60em","400px","768px","1200px"]}`
+	if got := string(b); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestFind(t *testing.T) {
+	doc := tokenizer.NewDocument([]byte(`.btn { color: red }
+a.btn:hover, .btn-primary { COLOR: blue; margin: 0 }
+@media print {
+  div > .btn.big { color: black }
+  .x { --color: 1 }
+}`))
+	s, errs := Parse(doc.Tokens())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	position := func(i int) string {
+		line, col := doc.Position(doc.Offsets()[i])
+		return strconv.Itoa(line) + ":" + strconv.Itoa(col)
+	}
+	var got []string
+	for _, f := range s.FindRules(WithSelectorContaining(".btn")) {
+		got = append(got, position(f.Rule.Index)+" "+render(f.Rule.Prelude))
+	}
+	want := "0:0 .btn|1:0 a.btn:hover, .btn-primary|3:2 div > .btn.big"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(got, "|"), want)
+	}
+
+	got = nil
+	for _, f := range s.FindRules(WithSelectorContaining("div>.btn"), Inside(WithAtRule("media"))) {
+		got = append(got, position(f.Rule.Index)+" "+f.Parents[0].AtKeyword)
+	}
+	if want := "3:2 media"; strings.Join(got, "|") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(got, "|"), want)
+	}
+
+	got = nil
+	for _, f := range s.FindDeclarations("color") {
+		got = append(got, position(f.Declaration.Index)+" "+f.Declaration.Name)
+	}
+	if want := "0:7 color|1:28 COLOR|3:19 color"; strings.Join(got, "|") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(got, "|"), want)
+	}
+
+	found := s.FindDeclarations("color", Inside(WithAtRule("media")))
+	if len(found) != 1 {
+		t.Fatalf("got %d declarations", len(found))
+	}
+	found[0].Declaration.Value = tokenize("white")
+	if got := s.Rules[2].String(); got != `@media print { div > .btn.big { color: white; } .x { --color: 1; } }` {
+		t.Errorf("got %s", got)
+	}
+	if got := s.FindRules(WithAtRule("MEDIA")); len(got) != 1 || got[0].Rule != s.Rules[2] {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestAnalyzeKeyframes(t *testing.T) {
+	s, _ := Parse(tokenize(`@keyframes spin { to { color: red } }
+@-webkit-keyframes spin { to { color: red } }
+@keyframes fade { to { opacity: 0 } }
+@keyframes "pulse" { to { opacity: 1 } }
+@media print { @keyframes ease { to { opacity: 1 } } }
+@keyframes later { to { opacity: 1 } }
+a { animation: spin 1s ease-in, 2s "pulse" }
+b { -webkit-animation-name: spin, missing, none }
+c { animation: 1s infinite gone }
+d { --anim: later; animation: var(--x) }`))
+	u := AnalyzeKeyframes(s)
+	if got := strings.Join(u.Undefined, ","); got != "gone,missing" {
+		t.Errorf("Undefined: got %s", got)
+	}
+	if got := strings.Join(u.Unused, ","); got != "ease,fade" {
+		t.Errorf("Unused: got %s", got)
+	}
+	if got := len(u.Defined["spin"]); got != 2 {
+		t.Errorf("got %d spin rules", got)
+	}
+	if got := u.Defined["ease"]; len(got) != 1 || got[0].Parents[0].AtKeyword != "media" {
+		t.Errorf("got %v", got)
+	}
+	var used []string
+	for _, f := range u.Used["spin"] {
+		used = append(used, f.Declaration.Name)
+	}
+	if got := strings.Join(used, ","); got != "animation,-webkit-animation-name" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/selector"
+	"github.com/riking/cssparse/tokenizer"
+	"github.com/riking/cssparse/values"
+)
+
+// Targets lists the features that the browsers a stylesheet is for do not
+// support.  Names are lowercase.
+type Targets struct {
+	// Properties are property names, such as backdrop-filter, and
+	// Keywords the keywords of some properties, such as grid for display.
+	Properties map[string]bool
+	Keywords   map[string]map[string]bool
+	// Functions are the names of functions used in values, such as
+	// color-mix.
+	Functions map[string]bool
+	// PseudoClasses and PseudoElements are names such as has and backdrop,
+	// without colons.
+	PseudoClasses  map[string]bool
+	PseudoElements map[string]bool
+	// AtRules are at-rule names, such as container, without the '@'.
+	AtRules map[string]bool
+	// Prefixes are vendor prefixes, such as "-ms-", none of whose
+	// properties, at-rules, functions, or pseudo-classes and
+	// pseudo-elements are supported.
+	Prefixes map[string]bool
+}
+
+// ParseTargets returns the Targets for feature flags, each "no" and a
+// feature: "no backdrop-filter" for a property, "no display: grid" for a
+// keyword of one, "no color-mix()" for a function, "no :has" and
+// "no ::backdrop" for a pseudo-class and a pseudo-element, "no @container"
+// for an at-rule, and "no -ms-" for a vendor prefix.  A keyword must be a
+// value of its property, if the property is in the values package's
+// registry.
+func ParseTargets(flags []string) (Targets, error) {
+	t := Targets{
+		Properties: map[string]bool{}, Keywords: map[string]map[string]bool{}, Functions: map[string]bool{},
+		PseudoClasses: map[string]bool{}, PseudoElements: map[string]bool{}, AtRules: map[string]bool{}, Prefixes: map[string]bool{},
+	}
+	for _, flag := range flags {
+		fields := strings.Fields(strings.ToLower(flag))
+		if len(fields) < 2 || fields[0] != "no" {
+			return t, errorf("feature flag %q does not start with \"no\"", flag)
+		}
+		feature := strings.Join(fields[1:], " ")
+		switch {
+		case len(fields) == 3 && strings.HasSuffix(fields[1], ":"):
+			property, keyword := strings.TrimSuffix(fields[1], ":"), fields[2]
+			if g := values.PropertyGrammar(property); g != nil && !g.Match(tokenize(keyword)) {
+				return t, errorf("feature flag %q: %s is not a value of %s", flag, keyword, property)
+			}
+			if t.Keywords[property] == nil {
+				t.Keywords[property] = map[string]bool{}
+			}
+			t.Keywords[property][keyword] = true
+		case len(fields) != 2:
+			return t, errorf("feature flag %q has too many words", flag)
+		case strings.HasPrefix(feature, "::"):
+			t.PseudoElements[feature[2:]] = true
+		case strings.HasPrefix(feature, ":"):
+			t.PseudoClasses[feature[1:]] = true
+		case strings.HasPrefix(feature, "@"):
+			t.AtRules[feature[1:]] = true
+		case strings.HasSuffix(feature, "()"):
+			t.Functions[strings.TrimSuffix(feature, "()")] = true
+		case strings.HasPrefix(feature, "-") && strings.HasSuffix(feature, "-") && len(feature) > 2:
+			t.Prefixes[feature] = true
+		default:
+			t.Properties[feature] = true
+		}
+	}
+	return t, nil
+}
+
+// lacks reports whether a name in names, lowercased, or its vendor prefix
+// is not supported.
+func (t Targets) lacks(names map[string]bool, name string) bool {
+	name = strings.ToLower(name)
+	prefix, _ := unprefix(name)
+	return names[name] || prefix != "" && t.Prefixes[prefix]
+}
+
+// PruneTargets removes the parts of s throughout that rely on features
+// that targets do not support, as the browsers would ignore them:
+//
+//   - Declarations of properties, or with keywords or functions, that are
+//     not supported, which leaves the earlier declarations of the same
+//     property in the block as the fallbacks.
+//   - Style rules with a selector using a pseudo-class or pseudo-element
+//     that is not supported, since a browser drops the whole rule for it.
+//   - At-rules that are not supported.
+//   - @supports rules whose conditions are false for the targets.  Those
+//     whose conditions are true for any browser without the features, as
+//     in @supports not (backdrop-filter: none), are replaced by their
+//     contents.
+//
+// Rules whose selectors cannot be parsed are kept, and reported as errors.
+func PruneTargets(s *Stylesheet, targets Targets) []error {
+	var errs []error
+	s.Rules = pruneTargetRules(s.Rules, targets, s.Namespaces(), &errs)
+	return errs
+}
+
+func pruneTargetRules(rules []*Rule, t Targets, namespaces map[string]string, errs *[]error) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		switch {
+		case r.AtKeyword == "":
+			l, err := selector.ParseWithNamespaces(r.Prelude, namespaces)
+			if err != nil {
+				*errs = append(*errs, errorf("cannot prune %q: %v", render(r.Prelude), err))
+			} else if !t.supportsSelectors(l) {
+				continue
+			}
+		case t.lacks(t.AtRules, r.AtKeyword):
+			continue
+		case tokenizer.IdentEquals(r.AtKeyword, "supports"):
+			cond := t.supportsCondition(r.Prelude, namespaces)
+			if cond == isFalse {
+				continue
+			}
+			// declarations, in a @supports nested in a style rule, are left
+			// in it
+			if cond == isTrue && len(r.Declarations) == 0 {
+				out = append(out, pruneTargetRules(r.Rules, t, namespaces, errs)...)
+				continue
+			}
+		}
+		var decls []parser.Declaration
+		for _, d := range r.Declarations {
+			if t.supportsDeclaration(d.Name, d.Value) {
+				decls = append(decls, d)
+			}
+		}
+		r.Declarations = decls
+		r.Rules = pruneTargetRules(r.Rules, t, namespaces, errs)
+		out = append(out, r)
+	}
+	return out
+}
+
+// supportsDeclaration reports whether the targets support a declaration.
+func (t Targets) supportsDeclaration(name string, value []tokenizer.Token) bool {
+	if strings.HasPrefix(name, "--") {
+		return true
+	}
+	if t.lacks(t.Properties, name) {
+		return false
+	}
+	keywords := t.Keywords[strings.ToLower(name)]
+	for _, tok := range value {
+		switch {
+		case tok.Type == tokenizer.TokenFunction && t.lacks(t.Functions, tok.Value):
+			return false
+		case tok.Type == tokenizer.TokenIdent && (keywords[strings.ToLower(tok.Value)] || t.lacks(nil, tok.Value)):
+			return false
+		}
+	}
+	return true
+}
+
+// supportsSelectors reports whether the targets support every selector
+// of l.
+func (t Targets) supportsSelectors(l selector.List) bool {
+	for _, c := range l {
+		for _, cp := range c.Compounds {
+			for _, s := range cp.Simples {
+				switch {
+				case s.Kind == selector.PseudoClass && t.lacks(t.PseudoClasses, s.Name):
+					return false
+				case s.Kind == selector.PseudoElement && t.lacks(t.PseudoElements, s.Name):
+					return false
+				case !t.supportsSelectors(s.Args):
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// supportsCondition returns the value of the condition of an @supports
+// rule for the targets: false if it tests for a feature they do not
+// support, and unknown if it may be either.
+func (t Targets) supportsCondition(toks []tokenizer.Token, namespaces map[string]string) truth {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 0 {
+		return isUnknown
+	}
+	if cvs[0][0].Type == tokenizer.TokenIdent && tokenizer.IdentEquals(cvs[0][0].Value, "not") && len(cvs) == 2 {
+		return t.supportsInParens(cvs[1], namespaces).not()
+	}
+	result := t.supportsInParens(cvs[0], namespaces)
+	for i := 1; i+1 < len(cvs); i += 2 {
+		op, next := cvs[i][0], t.supportsInParens(cvs[i+1], namespaces)
+		switch {
+		case op.Type == tokenizer.TokenIdent && tokenizer.IdentEquals(op.Value, "and"):
+			result = result.and(next)
+		case op.Type == tokenizer.TokenIdent && tokenizer.IdentEquals(op.Value, "or"):
+			result = result.or(next)
+		default:
+			return isUnknown
+		}
+	}
+	if len(cvs)%2 == 0 {
+		return isUnknown
+	}
+	return result
+}
+
+// supportsInParens returns the value of a parenthesized condition, a
+// declaration such as (display: grid), or a selector() function.
+func (t Targets) supportsInParens(cv []tokenizer.Token, namespaces map[string]string) truth {
+	if len(cv) < 2 {
+		return isUnknown
+	}
+	inner := cv[1 : len(cv)-1]
+	switch {
+	case cv[0].Type == tokenizer.TokenFunction && tokenizer.IdentEquals(cv[0].Value, "selector"):
+		l, err := selector.ParseWithNamespaces(inner, namespaces)
+		if err == nil && !t.supportsSelectors(l) {
+			return isFalse
+		}
+		return isUnknown
+	case cv[0].Type != tokenizer.TokenOpenParen:
+		return isUnknown
+	}
+	if first := parser.ComponentValues(inner); len(first) > 0 && (first[0][0].Type == tokenizer.TokenOpenParen ||
+		first[0][0].Type == tokenizer.TokenFunction || first[0][0].MatchesIdent("not")) {
+		return t.supportsCondition(inner, namespaces)
+	}
+	decls, _, _ := parser.ParseBlockContents(inner)
+	if len(decls) == 1 && !t.supportsDeclaration(decls[0].Name, decls[0].Value) {
+		return isFalse
+	}
+	return isUnknown
+}
+
+// truth is the value of an @supports condition for a set of browsers, in
+// three-valued logic.
+type truth int
+
+const (
+	isUnknown truth = iota
+	isFalse
+	isTrue
+)
+
+func (a truth) not() truth {
+	switch a {
+	case isFalse:
+		return isTrue
+	case isTrue:
+		return isFalse
+	}
+	return isUnknown
+}
+
+func (a truth) and(b truth) truth {
+	switch {
+	case a == isFalse || b == isFalse:
+		return isFalse
+	case a == isTrue && b == isTrue:
+		return isTrue
+	}
+	return isUnknown
+}
+
+func (a truth) or(b truth) truth {
+	return a.not().and(b.not()).not()
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package stylesheet
+
+import (
+	"strings"
+)
+
+// Usage is a value a property is set to, in the at-rules that decide
+// whether and where it applies, for auditing the overrides a stylesheet
+// makes at each breakpoint.  It has tags for encoding/json, so the usage
+// of a stylesheet can be written as a JSON report.
+type Usage struct {
+	// Value is the value, formatted as Diff formats it, with "!important"
+	// if it is.
+	Value string `json:"value"`
+	// Media, Container, Layer, and Supports are the preludes of the
+	// @media, @container, @layer, and @supports rules enclosing the
+	// declarations, outermost first, formatted as Diff formats them, such
+	// as "(min-width:768px)".  An anonymous layer is "".
+	Media     []string `json:"media,omitempty"`
+	Container []string `json:"container,omitempty"`
+	Layer     []string `json:"layer,omitempty"`
+	Supports  []string `json:"supports,omitempty"`
+	// Count is the number of declarations setting the value in those
+	// at-rules.
+	Count int `json:"count"`
+}
+
+// AnalyzeUsage returns the values each property is set to in the style
+// rules of s, by lowercased property name, with each value once for each
+// set of at-rules it is set in, in the order they first appear.  Other
+// at-rules, such as @scope, are not part of the usage, and the declarations
+// of keyframes and of rules such as @font-face are left out.
+func AnalyzeUsage(s *Stylesheet) map[string][]Usage {
+	usage := make(map[string][]Usage)
+	find(s.Rules, nil, nil, func(r *Rule, parents []*Rule) {
+		if r.AtKeyword != "" {
+			return
+		}
+		var context Usage
+		for _, p := range parents {
+			prelude := render(normalizePrelude(p))
+			kw := strings.ToLower(p.AtKeyword)
+			if _, base := unprefix(kw); base == "keyframes" {
+				return
+			}
+			switch kw {
+			case "media":
+				context.Media = append(context.Media, prelude)
+			case "container":
+				context.Container = append(context.Container, prelude)
+			case "layer":
+				context.Layer = append(context.Layer, prelude)
+			case "supports":
+				context.Supports = append(context.Supports, prelude)
+			}
+		}
+		for _, d := range r.Declarations {
+			name := propertyKey(d.Name)
+			u := context
+			u.Value = normalizedValue(d)
+			if i := findUsage(usage[name], u); i >= 0 {
+				usage[name][i].Count++
+				continue
+			}
+			u.Count = 1
+			usage[name] = append(usage[name], u)
+		}
+	})
+	return usage
+}
+
+// findUsage returns the index in usages of that with the value and
+// at-rules of u, or -1.
+func findUsage(usages []Usage, u Usage) int {
+	for i, v := range usages {
+		if v.Value == u.Value && sameStrings(v.Media, u.Media) && sameStrings(v.Container, u.Container) &&
+			sameStrings(v.Layer, u.Layer) && sameStrings(v.Supports, u.Supports) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
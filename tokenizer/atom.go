@@ -0,0 +1,128 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "strings"
+
+// Token values that show up over and over again in real stylesheets.  The
+// tokenizer returns the string from this table instead of allocating a new
+// copy of the value.
+var atoms = make(map[string]string)
+
+var atomList = []string{
+	// units
+	"px", "em", "rem", "ex", "ch", "vw", "vh", "vmin", "vmax", "fr",
+	"deg", "rad", "turn", "s", "ms", "dpi", "dppx", "x",
+	// numbers
+	"0", "1", "2", "3", "4", "5", "10", "50", "100", ".5", "-1", "0.5",
+	// properties
+	"color", "background", "background-color", "background-image",
+	"background-position", "background-repeat", "background-size",
+	"border", "border-color", "border-radius", "border-style", "border-width",
+	"border-top", "border-bottom", "border-left", "border-right",
+	"bottom", "box-shadow", "box-sizing", "content", "cursor", "display",
+	"flex", "flex-direction", "flex-wrap", "flex-grow", "flex-shrink",
+	"float", "font", "font-family", "font-size", "font-style", "font-weight",
+	"height", "justify-content", "align-items", "left", "letter-spacing",
+	"line-height", "list-style", "margin", "margin-top", "margin-bottom",
+	"margin-left", "margin-right", "max-height", "max-width", "min-height",
+	"min-width", "opacity", "outline", "overflow", "padding", "padding-top",
+	"padding-bottom", "padding-left", "padding-right", "pointer-events",
+	"position", "right", "text-align", "text-decoration", "text-transform",
+	"top", "transform", "transition", "vertical-align", "visibility",
+	"white-space", "width", "z-index",
+	// values
+	"absolute", "auto", "block", "bold", "both", "center", "currentColor",
+	"ease", "ease-in-out", "fixed", "hidden", "important", "inherit",
+	"initial", "inline", "inline-block", "inline-flex", "middle", "none",
+	"normal", "nowrap", "pointer", "relative", "solid", "static", "sticky",
+	"transparent", "unset", "var",
+	// functions
+	"calc", "rgb", "rgba", "hsl", "hsla", "url", "translate", "rotate",
+	"scale",
+	// at-rules
+	"media", "import", "font-face", "keyframes", "supports", "charset",
+}
+
+// Runs of whitespace made of a few newlines followed by only spaces or only
+// tabs, which covers the indentation of nearly every stylesheet, are sliced
+// out of these strings instead of being allocated.
+const maxAtomNewlines = 4
+
+var (
+	newlinesSpaces = strings.Repeat("\n", maxAtomNewlines) + strings.Repeat(" ", 64)
+	newlinesTabs   = strings.Repeat("\n", maxAtomNewlines) + strings.Repeat("\t", 16)
+)
+
+// whitespaceAtom returns the whitespace b as a string without allocating,
+// if it is a run that can be sliced out of newlinesSpaces or newlinesTabs.
+func whitespaceAtom(b []byte) (string, bool) {
+	nl := 0
+	for nl < len(b) && b[nl] == '\n' {
+		nl++
+	}
+	if nl > maxAtomNewlines {
+		return "", false
+	}
+	indent := b[nl:]
+	src := newlinesSpaces
+	if len(indent) > 0 && indent[0] == '\t' {
+		src = newlinesTabs
+	}
+	if len(indent) > len(src)-maxAtomNewlines {
+		return "", false
+	}
+	for _, c := range indent {
+		if c != src[maxAtomNewlines] {
+			return "", false
+		}
+	}
+	return src[maxAtomNewlines-nl : maxAtomNewlines+len(indent)], true
+}
+
+// Names longer than this are not put in a nameCache.
+const maxCachedName = 32
+
+// nameCache remembers names recently returned by a Tokenizer.  It is
+// direct-mapped: each name has a single slot, chosen by its hash, where it
+// replaces whatever name was there before.  This keeps the cache a fixed
+// size no matter what the input is, while names repeated close together,
+// such as the class names and custom properties of a framework, are found.
+type nameCache [256]string
+
+// lookup returns the cached string equal to b, or caches a new one.
+func (c *nameCache) lookup(b []byte) string {
+	// FNV-1a
+	h := uint32(2166136261)
+	for _, by := range b {
+		h ^= uint32(by)
+		h *= 16777619
+	}
+	slot := &c[h%uint32(len(c))]
+	// nb: the compiler does not allocate for this comparison
+	if *slot != string(b) {
+		*slot = string(b)
+	}
+	return *slot
+}
+
+// Single-byte delim values, indexed by the byte.
+var delimStrings [128]string
+
+func init() {
+	for _, s := range atomList {
+		atoms[s] = s
+	}
+	for i := range delimStrings {
+		delimStrings[i] = string(rune(i))
+	}
+}
+
+// delimString returns the Value of a TokenDelim for the given byte without
+// allocating.
+func delimString(ch byte) string {
+	if ch < 128 {
+		return delimStrings[ch]
+	}
+	return string(rune(ch))
+}
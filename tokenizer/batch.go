@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+// Diagnostic is a tokenization error reported by TokenizeAll.
+type Diagnostic struct {
+	// Index of the offending token in the returned slice.
+	Index int
+	// Description of the error.  Err.Loc is the byte offset of the token in
+	// the input.
+	Err *ParseError
+}
+
+// Error implements error.
+func (d Diagnostic) Error() string {
+	return d.Err.Error()
+}
+
+// TokenizeAll tokenizes the entirety of src in one call.  The tokens are
+// appended to dst[:0], which is grown as needed, and the resulting slice is
+// returned; callers processing many stylesheets can pass the previous result
+// back in to reuse its storage.  The final TokenEOF is not included.
+//
+// Tokenization errors (bad escapes, strings, and urls) are kept in the token
+// stream and are also reported in the returned Diagnostic list.
+func TokenizeAll(src []byte, dst []Token) ([]Token, []Diagnostic) {
+	var diags []Diagnostic
+	toks := dst[:0]
+	z := newTokenizerBytes(src)
+	for {
+		start := z.srcOffset()
+		t := z.Next()
+		if t.Type == TokenEOF {
+			break
+		}
+		if t.Type.StopToken() {
+			pe := diagnosticError(t, start, z.srcOffset())
+			diags = append(diags, Diagnostic{Index: len(toks), Err: pe})
+			if t.Type == TokenError {
+				// reading from memory cannot fail, but don't loop forever
+				break
+			}
+		}
+		toks = append(toks, t)
+	}
+	return toks, diags
+}
+
+// diagnosticError returns the ParseError describing an error token that
+// spans the given offsets.
+func diagnosticError(t Token, start, end int) *ParseError {
+	pe := tokenParseError(t)
+	if pe == nil {
+		pe = &ParseError{Type: t.Type}
+		if t.Type == TokenBadEscape {
+			pe.Code = errBadEscape.Code
+			pe.Message = errBadEscape.Message
+		} else {
+			pe.Message = t.Extra.String()
+		}
+	}
+	pe.Loc = start
+	pe.End = end
+	pe.Token = t
+	return pe
+}
+
+// tokenParseError returns the ParseError carried by an error token, if any.
+func tokenParseError(t Token) *ParseError {
+	if e, ok := t.Extra.(*TokenExtraError); ok && e != nil {
+		return e.ParseError()
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Kane York.
+
+package tokenizer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// bootstrap.css is Bootstrap v5.3.3, MIT licensed, see the header comment in
+// the file.
+func loadBootstrap(tb testing.TB) []byte {
+	b, err := ioutil.ReadFile("testdata/bootstrap.css")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// utilityCSS generates a stylesheet shaped like the output of a utility-first
+// framework such as Tailwind: thousands of small rules with escaped class
+// names and short declaration blocks.
+func utilityCSS() []byte {
+	var buf bytes.Buffer
+	variants := []string{"", "hover\\:", "focus\\:", "sm\\:", "md\\:", "lg\\:"}
+	for _, v := range variants {
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&buf, ".%sm-%d{margin:%.2frem}\n", v, i, float64(i)*0.25)
+			fmt.Fprintf(&buf, ".%sw-%d\\/12{width:%d.333333%%}\n", v, i, i)
+			fmt.Fprintf(&buf, ".%stext-gray-%d{color:#%02x%02x%02x;--tw-text-opacity:1}\n", v, i, i, i*2%256, i*3%256)
+			fmt.Fprintf(&buf, ".%sbg-url-%d{background-image:url(\"img/bg-%d.png\")}\n", v, i, i)
+		}
+	}
+	return buf.Bytes()
+}
+
+func countTokens(input []byte) int {
+	var n int
+	tz := NewTokenizer(bytes.NewReader(input))
+	for {
+		t := tz.Next()
+		if t.Type == TokenEOF || t.Type == TokenError {
+			return n
+		}
+		n++
+	}
+}
+
+func benchmarkTokenize(b *testing.B, input []byte) {
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		countTokens(input)
+	}
+}
+
+func benchmarkRender(b *testing.B, input []byte) {
+	var tokens []Token
+	tz := NewTokenizer(bytes.NewReader(input))
+	for {
+		t := tz.Next()
+		if t.Type == TokenEOF || t.Type == TokenError {
+			break
+		}
+		tokens = append(tokens, t)
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(input) * 2)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		var wr TokenRenderer
+		for _, t := range tokens {
+			wr.WriteTokenTo(&buf, t)
+		}
+	}
+}
+
+func benchmarkAppend(b *testing.B, input []byte) {
+	tokens, _ := TokenizeAll(input, nil)
+	buf := make([]byte, 0, len(input)*2)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = buf[:0]
+		for _, t := range tokens {
+			buf = t.AppendTo(buf)
+		}
+	}
+}
+
+func BenchmarkTokenizeBootstrap(b *testing.B) { benchmarkTokenize(b, loadBootstrap(b)) }
+func BenchmarkTokenizeUtility(b *testing.B)   { benchmarkTokenize(b, utilityCSS()) }
+func BenchmarkRenderBootstrap(b *testing.B)   { benchmarkRender(b, loadBootstrap(b)) }
+func BenchmarkRenderUtility(b *testing.B)     { benchmarkRender(b, utilityCSS()) }
+func BenchmarkAppendBootstrap(b *testing.B)   { benchmarkAppend(b, loadBootstrap(b)) }
+func BenchmarkAppendUtility(b *testing.B)     { benchmarkAppend(b, utilityCSS()) }
+
+// TestAllocsPerToken keeps the amortized allocation rate of the tokenizer
+// under control.
+func TestAllocsPerToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping allocation test in short mode")
+	}
+	for _, tc := range []struct {
+		name  string
+		input []byte
+	}{
+		{"bootstrap", loadBootstrap(t)},
+		{"utility", utilityCSS()},
+	} {
+		ntok := countTokens(tc.input)
+		allocs := testing.AllocsPerRun(5, func() {
+			countTokens(tc.input)
+		})
+		perToken := allocs / float64(ntok)
+		t.Logf("%s: %d tokens, %.3f allocs/token", tc.name, ntok, perToken)
+		if perToken >= 2 {
+			t.Errorf("%s: %.3f allocs/token, want < 2", tc.name, perToken)
+		}
+	}
+}
+
+// TestPlainTokenAllocs checks that identifiers, delims, and whitespace do not
+// allocate: once the tokenizer is set up and each distinct name has been
+// seen, tokenizing more of them costs nothing.
+func TestPlainTokenAllocs(t *testing.T) {
+	const unit = "foo  bar\n  baz > qux\n\t\tcolor + .a-b\n\n"
+	allocs := func(n int) float64 {
+		input := []byte(strings.Repeat(unit, n))
+		return testing.AllocsPerRun(5, func() {
+			countTokens(input)
+		})
+	}
+	one, many := allocs(1), allocs(1000)
+	if many > one {
+		t.Errorf("%v allocs for 1 copy of the input, %v for 1000 copies", one, many)
+	}
+}
+
+func TestAppendToAllocs(t *testing.T) {
+	tokens, _ := TokenizeAll(utilityCSS(), nil)
+	buf := make([]byte, 0, 1<<20)
+	allocs := testing.AllocsPerRun(5, func() {
+		buf = buf[:0]
+		for _, t := range tokens {
+			buf = t.AppendTo(buf)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("AppendTo: %v allocs, want 0", allocs)
+	}
+}
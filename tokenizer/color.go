@@ -0,0 +1,40 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+// HexColor interprets a TokenHash as a CSS hex color.  The 3 and 4 digit
+// forms are expanded by repeating each digit, and a is 255 for the 3 and 6
+// digit forms, which have no alpha channel.
+//
+// ok is false if t is not a TokenHash, or its value is not 3, 4, 6, or 8 hex
+// digits.
+func (t *Token) HexColor() (r, g, b, a uint8, ok bool) {
+	if t.Type != TokenHash {
+		return 0, 0, 0, 0, false
+	}
+	s := t.Value
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return 0, 0, 0, 0, false
+		}
+	}
+	switch len(s) {
+	case 3, 4:
+		r, g, b, a = hexValue(s[0])*0x11, hexValue(s[1])*0x11, hexValue(s[2])*0x11, 0xff
+		if len(s) == 4 {
+			a = hexValue(s[3]) * 0x11
+		}
+	case 6, 8:
+		r, g, b, a = hexByte(s[0:2]), hexByte(s[2:4]), hexByte(s[4:6]), 0xff
+		if len(s) == 8 {
+			a = hexByte(s[6:8])
+		}
+	default:
+		return 0, 0, 0, 0, false
+	}
+	return r, g, b, a, true
+}
+
+func hexByte(s string) uint8 {
+	return hexValue(s[0])<<4 | hexValue(s[1])
+}
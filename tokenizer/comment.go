@@ -0,0 +1,41 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "strings"
+
+// CommentKind classifies a TokenComment.  The kinds are bit flags, so that a
+// set of kinds can be given to TokenRenderer.DropComments.
+type CommentKind uint8
+
+const (
+	// A comment with no special meaning.
+	CommentOrdinary CommentKind = 1 << iota
+	// A "bang" comment starting with '!', conventionally used for license
+	// headers that minifiers must keep, such as /*! normalize.css v8 */.
+	CommentLicense
+	// A source map pointer, such as /*# sourceMappingURL=a.css.map */.  The
+	// older form starting with '@' is also recognized.
+	CommentSourceMap
+
+	// All comments.
+	CommentAll = CommentOrdinary | CommentLicense | CommentSourceMap
+)
+
+// CommentKind returns the kind of a TokenComment, or 0 for other token types.
+func (t *Token) CommentKind() CommentKind {
+	if t.Type != TokenComment {
+		return 0
+	}
+	v := t.Value
+	if strings.HasPrefix(v, "!") {
+		return CommentLicense
+	}
+	if len(v) > 1 && (v[0] == '#' || v[0] == '@') {
+		rest := strings.TrimLeft(v[1:], " \t\n")
+		if rest != v[1:] && strings.HasPrefix(rest, "sourceMappingURL=") {
+			return CommentSourceMap
+		}
+	}
+	return CommentOrdinary
+}
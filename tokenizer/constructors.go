@@ -0,0 +1,126 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constructors for tokens that carry a value.  They fill in the Extra field
+// the token type needs, so that the tokens render correctly and compare
+// equal to the tokens the tokenizer produces for the same source.  Values
+// are the unescaped text; escaping is done when the token is rendered.
+//
+// The constructors panic if given a value that no token of the type could
+// have, such as an empty identifier or an infinite number.
+
+// NewIdent returns a TokenIdent.
+func NewIdent(v string) Token {
+	mustNotBeEmpty("NewIdent", v)
+	return Token{Type: TokenIdent, Value: v}
+}
+
+// NewFunction returns a TokenFunction for a function named v.  The opening
+// parenthesis is implied.
+func NewFunction(v string) Token {
+	mustNotBeEmpty("NewFunction", v)
+	return Token{Type: TokenFunction, Value: v}
+}
+
+// NewAtKeyword returns a TokenAtKeyword for the at-rule named v, without the
+// '@'.
+func NewAtKeyword(v string) Token {
+	mustNotBeEmpty("NewAtKeyword", v)
+	return Token{Type: TokenAtKeyword, Value: v}
+}
+
+// NewHash returns a TokenHash for v, without the '#'.  The type flag is set
+// to "id" if the rendered hash would be read as one.
+func NewHash(v string) Token {
+	mustNotBeEmpty("NewHash", v)
+	return Token{Type: TokenHash, Value: v, Extra: &TokenExtraHash{IsIdentifier: hashIsIdentifier(v)}}
+}
+
+// NewString returns a TokenString.
+func NewString(v string) Token {
+	return Token{Type: TokenString, Value: v}
+}
+
+// NewURL returns a TokenURI.
+func NewURL(v string) Token {
+	return Token{Type: TokenURI, Value: v}
+}
+
+// NewDelim returns a TokenDelim for the character r.
+func NewDelim(r rune) Token {
+	if !utf8.ValidRune(r) {
+		panic("tokenizer: NewDelim: invalid rune")
+	}
+	return Token{Type: TokenDelim, Value: string(r)}
+}
+
+// NewNumber returns a TokenNumber with the value f.
+func NewNumber(f float64) Token {
+	return newNumeric("NewNumber", TokenNumber, f)
+}
+
+// NewPercentage returns a TokenPercentage for f percent, so NewPercentage(50)
+// is "50%".
+func NewPercentage(f float64) Token {
+	return newNumeric("NewPercentage", TokenPercentage, f)
+}
+
+// NewDimension returns a TokenDimension with the value num and the given
+// unit.
+func NewDimension(num float64, unit string) Token {
+	mustNotBeEmpty("NewDimension", unit)
+	t := newNumeric("NewDimension", TokenDimension, num)
+	t.Extra.(*TokenExtraNumeric).Dimension = unit
+	return t
+}
+
+// NewRaw returns a TokenRaw, which renders as v without any escaping.
+func NewRaw(v string) Token {
+	return Token{Type: TokenRaw, Value: v}
+}
+
+func newNumeric(fn string, tt TokenType, f float64) Token {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		panic("tokenizer: " + fn + ": number is not finite")
+	}
+	// Avoid exponents except for numbers that would otherwise be very long,
+	// as JavaScript does.
+	var repr string
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		repr = strconv.FormatFloat(f, 'g', -1, 64)
+	} else {
+		repr = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	e := &TokenExtraNumeric{}
+	e.setForm(repr)
+	e.NonInteger = e.Exponent || strings.IndexByte(repr, '.') != -1
+	return Token{Type: tt, Value: repr, Extra: e}
+}
+
+// hashIsIdentifier reports whether a hash with the name v, rendered as an
+// unrestricted hash, would be read back with the "id" type flag.  Characters
+// that are not name characters are escaped when rendered, and an escape
+// starts an identifier.
+func hashIsIdentifier(v string) bool {
+	if v[0] == '-' {
+		v = v[1:]
+		if v == "" || v[0] == '-' {
+			return false
+		}
+	}
+	return v[0] < '0' || v[0] > '9'
+}
+
+func mustNotBeEmpty(fn, v string) {
+	if v == "" {
+		panic("tokenizer: " + fn + ": empty value")
+	}
+}
@@ -9,7 +9,11 @@ package tokenizer
 //
 // package crlf
 
-import "golang.org/x/text/transform"
+import (
+	"bytes"
+
+	"golang.org/x/text/transform"
+)
 
 // Normalize takes CRLF, CR, or LF line endings in src, and converts them
 // to LF in dst.
@@ -17,12 +21,48 @@ import "golang.org/x/text/transform"
 // cssparse: Also replace null bytes with U+FFFD REPLACEMENT CHARACTER.
 type normalize struct {
 	prev byte
+
+	// number of bytes written to dst so far
+	out int64
+	// pending offset corrections, in order of output position
+	fixups []offsetFixup
+	// sum of the deltas of the fixups already applied
+	delta int64
+	// number of bytes read from src so far
+	in int64
+	// input offsets of the NUL bytes replaced so far
+	nuls []int64
+}
+
+// offsetFixup records that output offsets at or after 'at' are 'delta' bytes
+// away from the corresponding input offsets.
+type offsetFixup struct {
+	at    int64
+	delta int64
 }
 
 const replacementCharacter = "\uFFFD"
 
 func (n *normalize) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
 	for nDst < len(dst) && nSrc < len(src) {
+		if n.prev != '\r' {
+			// copy runs of bytes that need no changes in one go
+			run := src[nSrc:]
+			if len(run) > len(dst)-nDst {
+				run = run[:len(dst)-nDst]
+			}
+			i := bytes.IndexAny(run, "\r\x00")
+			if i == -1 {
+				i = len(run)
+			}
+			if i > 0 {
+				copy(dst[nDst:], run[:i])
+				nDst += i
+				nSrc += i
+				n.prev = run[i-1]
+				continue
+			}
+		}
 		c := src[nSrc]
 		switch c {
 		case '\r':
@@ -31,6 +71,7 @@ func (n *normalize) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err
 			if n.prev == '\r' {
 				nSrc++
 				n.prev = c
+				n.fixups = append(n.fixups, offsetFixup{at: n.out + int64(nDst), delta: 1})
 				continue
 			}
 			dst[nDst] = '\n'
@@ -38,10 +79,14 @@ func (n *normalize) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err
 			// nb: len(replacementCharacter) == 3
 			if nDst+3 >= len(dst) {
 				err = transform.ErrShortDst
+				n.out += int64(nDst)
+				n.in += int64(nSrc)
 				return
 			}
+			n.nuls = append(n.nuls, n.in+int64(nSrc))
 			copy(dst[nDst:], replacementCharacter[:])
 			nDst += 2
+			n.fixups = append(n.fixups, offsetFixup{at: n.out + int64(nDst) + 1, delta: -2})
 		default:
 			dst[nDst] = c
 		}
@@ -52,9 +97,26 @@ func (n *normalize) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err
 	if nSrc < len(src) {
 		err = transform.ErrShortDst
 	}
+	n.out += int64(nDst)
+	n.in += int64(nSrc)
 	return
 }
 
 func (n *normalize) Reset() {
 	n.prev = 0
+	n.out = 0
+	n.fixups = nil
+	n.delta = 0
+	n.in = 0
+	n.nuls = nil
+}
+
+// sourceOffset converts an offset in the normalized output to an offset in
+// the original input.  Calls must be made with non-decreasing offsets.
+func (n *normalize) sourceOffset(p int64) int64 {
+	for len(n.fixups) > 0 && n.fixups[0].at <= p {
+		n.delta += n.fixups[0].delta
+		n.fixups = n.fixups[1:]
+	}
+	return p + n.delta
 }
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "unicode/utf8"
+
+// The Serialize*CSSOM functions follow the "serialize an identifier",
+// "serialize a string", and "serialize a URL" algorithms of the CSS Object
+// Model specification exactly, so their output matches what browsers give
+// for CSS.escape() and for serialized style values.  The plain Serialize
+// functions instead make the fewest changes needed for the result to
+// tokenize correctly, and may give different (but equivalent) escapes.
+//
+// Invalid UTF-8 in the input is replaced with U+FFFD, as is U+0000.
+
+// SerializeIdentifierCSSOM serializes s as an identifier following the CSSOM
+// specification.  This is the same as CSS.escape() in a browser.
+func SerializeIdentifierCSSOM(s string) string {
+	dst := make([]byte, 0, len(s))
+	for i, c := range s {
+		switch {
+		case c == 0 || c == utf8.RuneError:
+			dst = append(dst, replacementCharacter...)
+		case c <= 0x1F || c == 0x7F:
+			dst = appendCodePointEscape(dst, c)
+		case i == 0 && '0' <= c && c <= '9':
+			dst = appendCodePointEscape(dst, c)
+		case i == 1 && '0' <= c && c <= '9' && s[0] == '-':
+			dst = appendCodePointEscape(dst, c)
+		case i == 0 && c == '-' && len(s) == 1:
+			dst = append(dst, '\\', '-')
+		case c >= 0x80 || c == '-' || c == '_' || '0' <= c && c <= '9' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			dst = appendRune(dst, c)
+		default:
+			dst = append(dst, '\\', byte(c))
+		}
+	}
+	return string(dst)
+}
+
+// SerializeStringCSSOM serializes s as a double-quoted string following the
+// CSSOM specification.
+func SerializeStringCSSOM(s string) string {
+	return string(appendStringCSSOM(make([]byte, 0, len(s)+2), s))
+}
+
+// SerializeURLCSSOM serializes s as a url() function following the CSSOM
+// specification.
+func SerializeURLCSSOM(s string) string {
+	dst := append(make([]byte, 0, len(s)+7), "url("...)
+	dst = appendStringCSSOM(dst, s)
+	return string(append(dst, ')'))
+}
+
+func appendStringCSSOM(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for _, c := range s {
+		switch {
+		case c == 0 || c == utf8.RuneError:
+			dst = append(dst, replacementCharacter...)
+		case c <= 0x1F || c == 0x7F:
+			dst = appendCodePointEscape(dst, c)
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', byte(c))
+		default:
+			dst = appendRune(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
+
+// appendCodePointEscape appends c as a lowercase hex escape followed by a
+// space, as CSSOM's "escape a character as code point".
+func appendCodePointEscape(dst []byte, c rune) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '\\')
+	if c >= 0x10 {
+		dst = append(dst, hexDigits[c>>4&0xF])
+	}
+	return append(dst, hexDigits[c&0xF], ' ')
+}
+
+func appendRune(dst []byte, c rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], c)
+	return append(dst, tmp[:n]...)
+}
@@ -40,10 +40,10 @@ Returned tokens that carry extra information have a non-nil .Extra value.  For
 TokenError, TokenBadEscape, TokenBadString, and TokenBadURI, the
 TokenExtraError type carries an `error` with informative text about the nature
 of the error.  For TokenNumber, TokenPercentage, and TokenDimension, the
-TokenExtraNumeric specifies whether the number is integral, and for
-TokenDimension, contains the unit string (e.g. "px").  For TokenUnicodeRange,
-the TokenExtraUnicodeRange type contains the actual start and end values of the
-range.
+TokenExtraNumeric specifies whether the number is integral and how it was
+written, and for TokenDimension, contains the unit string (e.g. "px").  For
+TokenUnicodeRange, the TokenExtraUnicodeRange type contains the actual start and
+end values of the range.
 
 Note: the tokenizer doesn't perform lexical analysis, it only implements
 Section 4 of the CSS Syntax Level 3 specification.  See Section 5 for the
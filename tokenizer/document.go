@@ -0,0 +1,118 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "sort"
+
+// Document is a tokenized stylesheet that can be edited, re-tokenizing only
+// the region around each edit.  It is intended for editors and language
+// servers that need an up-to-date token stream after every keystroke.
+type Document struct {
+	src    []byte
+	toks   []Token
+	starts []int
+	level  SyntaxLevel
+}
+
+// The tokenizer looks at most this many bytes of source past the end of a
+// token to decide where it ends (3 bytes of lookahead, which can be up to 6
+// source bytes when they are CRLF pairs).
+const documentLookahead = 6
+
+// NewDocument tokenizes src.  The Document takes ownership of src.
+func NewDocument(src []byte) *Document {
+	r := tokenizeRange(src, 0, len(src))
+	return &Document{src: src, toks: r.toks, starts: r.starts}
+}
+
+// NewDocumentLevel is like NewDocument, but tokenizes following the given
+// version of the CSS Syntax specification.  See Tokenizer.Level.
+func NewDocumentLevel(src []byte, level SyntaxLevel) *Document {
+	d := &Document{level: level}
+	d.Edit(0, 0, src)
+	return d
+}
+
+// Source returns the current contents of the document.  The caller must not
+// modify the returned slice.
+func (d *Document) Source() []byte { return d.src }
+
+// Tokens returns the current tokens of the document, not including the final
+// TokenEOF.  The slice is only valid until the next call to Edit.
+func (d *Document) Tokens() []Token { return d.toks }
+
+// Offsets returns the byte offset in Source of each of the Tokens.  The slice
+// is only valid until the next call to Edit.
+func (d *Document) Offsets() []int { return d.starts }
+
+// Edit replaces the removed bytes of the document starting at off with text,
+// and updates the token stream.  The tokens [first, first+oldCount) of the
+// previous stream were replaced by [first, first+newCount) of the new stream;
+// the tokens after them are unchanged apart from their offsets (and the Loc
+// of error tokens).
+//
+// Edit panics if off and removed do not describe a range of the document.
+func (d *Document) Edit(off, removed int, text []byte) (first, oldCount, newCount int) {
+	if off < 0 || removed < 0 || off+removed > len(d.src) {
+		panic("tokenizer: Document.Edit range out of bounds")
+	}
+	src := make([]byte, 0, len(d.src)-removed+len(text))
+	src = append(src, d.src[:off]...)
+	src = append(src, text...)
+	src = append(src, d.src[off+removed:]...)
+	delta := len(text) - removed
+	editEnd := off + len(text) // in the new source
+	oldEditEnd := off + removed
+
+	// Tokens that end far enough before the edit cannot have seen it.
+	first = sort.SearchInts(d.starts, off-documentLookahead+1) - 1
+	if first < 0 {
+		first = 0
+	}
+	from := 0
+	if first < len(d.starts) {
+		from = d.starts[first]
+	}
+
+	// Re-tokenize until reaching a token boundary after the edit that was
+	// also a boundary before it; the rest of the stream is the same from
+	// there on.
+	var toks []Token
+	var starts []int
+	resync := len(d.toks)
+	z := newTokenizerBytes(src[from:])
+	z.Level = d.level
+	for {
+		start := from + z.srcOffset()
+		if start >= editEnd {
+			k := sort.SearchInts(d.starts, start-delta)
+			if k < len(d.starts) && d.starts[k] == start-delta && d.starts[k] >= oldEditEnd {
+				resync = k
+				break
+			}
+		}
+		t := z.Next()
+		if t.Type == TokenEOF || t.Type == TokenError {
+			break
+		}
+		if t.Type.StopToken() {
+			diagnosticError(t, start, from+z.srcOffset())
+		}
+		toks = append(toks, t)
+		starts = append(starts, start)
+	}
+
+	oldCount = resync - first
+	newCount = len(toks)
+	for i := resync; i < len(d.toks); i++ {
+		if pe := tokenParseError(d.toks[i]); pe != nil {
+			pe.Loc += delta
+			pe.End += delta
+		}
+		d.starts[i] += delta
+	}
+	d.toks = append(d.toks[:first], append(toks, d.toks[resync:]...)...)
+	d.starts = append(d.starts[:first], append(starts, d.starts[resync:]...)...)
+	d.src = src
+	return first, oldCount, newCount
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Kane York.
+
+package tokenizer
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocumentEdit(t *testing.T) {
+	base := loadBootstrap(t)[:20000]
+	pieces := []string{"}", "{", "a", " ", "\n", "\r", "\r\n", "\"", "'", "\\", "/*", "*/", "url(", ")", "-", "1", "e", "%", "#", "u+", "<!--", "-->", "\x00", ""}
+	rng := rand.New(rand.NewSource(1))
+	doc := NewDocument(append([]byte(nil), base...))
+	for n := 0; n < 500; n++ {
+		src := doc.Source()
+		off := rng.Intn(len(src) + 1)
+		removed := rng.Intn(4)
+		if off+removed > len(src) {
+			removed = len(src) - off
+		}
+		text := pieces[rng.Intn(len(pieces))]
+		oldLen := len(doc.Tokens())
+		first, oldCount, newCount := doc.Edit(off, removed, []byte(text))
+
+		want := tokenizeRange(doc.Source(), 0, len(doc.Source()))
+		if !reflect.DeepEqual(doc.Tokens(), want.toks) || !reflect.DeepEqual(doc.Offsets(), want.starts) {
+			t.Fatalf("edit %d (%d, %d, %q): token stream differs from a full re-tokenize", n, off, removed, text)
+		}
+		if len(doc.Tokens()) != oldLen-oldCount+newCount || first+newCount > len(doc.Tokens()) {
+			t.Fatalf("edit %d: bad change range %d %d %d", n, first, oldCount, newCount)
+		}
+		if newCount > 50 && !strings.ContainsAny(text, "\"'/*\\") {
+			t.Errorf("edit %d (%q): re-tokenized %d tokens", n, text, newCount)
+		}
+	}
+}
+
+func TestDocumentPositions(t *testing.T) {
+	src := "a {\r\n  content: \"é😀\";\rb: c }\n"
+	doc := NewDocument([]byte(src))
+
+	for _, tc := range []struct {
+		off       int
+		line, col int
+	}{
+		{0, 0, 0},
+		{3, 0, 3},
+		{4, 0, 3}, // between \r and \n
+		{5, 1, 0},
+		{16, 1, 11}, // the quote
+		{17, 1, 12}, // é
+		{19, 1, 13}, // 😀, a surrogate pair
+		{23, 1, 15},
+		{26, 2, 0},
+		{len(src), 3, 0},
+		{len(src) + 10, 3, 0},
+		{-1, 0, 0},
+	} {
+		line, col := doc.Position(tc.off)
+		if line != tc.line || col != tc.col {
+			t.Errorf("Position(%d) = %d:%d, want %d:%d", tc.off, line, col, tc.line, tc.col)
+		}
+		if off := doc.Offset(tc.line, tc.col); tc.off >= 0 && tc.off <= len(src) && tc.off != 4 && off != tc.off {
+			t.Errorf("Offset(%d, %d) = %d, want %d", tc.line, tc.col, off, tc.off)
+		}
+	}
+	if off := doc.Offset(1, 14); off != 19 {
+		t.Errorf("Offset in a surrogate pair = %d, want 19", off)
+	}
+	if off := doc.Offset(0, 100); off != 3 {
+		t.Errorf("Offset past end of line = %d, want 3", off)
+	}
+	if off := doc.Offset(10, 0); off != len(src) {
+		t.Errorf("Offset past last line = %d, want %d", off, len(src))
+	}
+
+	for _, tc := range []struct {
+		off   int
+		index int
+		value string
+	}{
+		{0, 0, "a"},
+		{1, 1, " "},
+		{2, 2, "{"},
+		{8, 4, "content"},
+		{13, 4, "content"},
+		{14, 5, ":"},
+		{18, 7, "é😀"},
+		{len(src) - 1, 16, "\n"},
+		{len(src), -1, ""},
+	} {
+		tok, i := doc.TokenAtOffset(tc.off)
+		if i != tc.index || tok.Value != tc.value {
+			t.Errorf("TokenAtOffset(%d) = %d %v, want %d %q", tc.off, i, tok, tc.index, tc.value)
+		}
+	}
+}
+
+func TestTokenAtOffset(t *testing.T) {
+	src := `a{b:url("c")}`
+	toks, _ := TokenizeAll([]byte(src), nil)
+	for _, tc := range []struct {
+		off   int
+		index int
+	}{
+		{-1, -1},
+		{0, 0},
+		{1, 1},
+		{4, 4},
+		{11, 4},
+		{12, 5},
+		{13, -1},
+	} {
+		tok, i := TokenAtOffset(toks, tc.off)
+		if i != tc.index || (i != -1 && !tok.Equal(toks[i])) || (i == -1 && tok.Type != TokenEOF) {
+			t.Errorf("TokenAtOffset(%d) = %d %v, want %d", tc.off, i, tok, tc.index)
+		}
+		// the same as Document for source that renders unchanged
+		if _, di := NewDocument([]byte(src)).TokenAtOffset(tc.off); di != i {
+			t.Errorf("Document.TokenAtOffset(%d) = %d, TokenAtOffset gave %d", tc.off, di, i)
+		}
+	}
+
+	// offsets in separators belong to the following token
+	toks = []Token{NewIdent("a"), NewIdent("b")}
+	if _, i := TokenAtOffset(toks, 2); i != 1 {
+		t.Errorf("offset in separator: got token %d, want 1", i)
+	}
+}
+
+func TestDocumentLevel(t *testing.T) {
+	doc := NewDocumentLevel([]byte("a { --x: 1 }"), SyntaxLevel4)
+	if tok, _ := doc.TokenAtOffset(4); tok.Type != TokenIdent || tok.Value != "--x" {
+		t.Errorf("Level 4 document: got %v", tok)
+	}
+	doc.Edit(6, 1, []byte("yz"))
+	if tok, _ := doc.TokenAtOffset(4); tok.Type != TokenIdent || tok.Value != "--yz" {
+		t.Errorf("Level 4 document after edit: got %v", tok)
+	}
+}
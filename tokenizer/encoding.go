@@ -0,0 +1,253 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The first bytes of every encoded token stream.  The last byte is the format
+// version, which must be changed whenever the encoding changes.
+const encodingMagic = "CSSTOK\x03"
+
+// ErrBadEncoding is returned by DecodeTokens for input that was not produced
+// by EncodeTokens, or was produced by an incompatible version of it.
+var ErrBadEncoding = errors.New("tokenizer: invalid or unsupported token encoding")
+
+// Kinds of error stored for error tokens.
+const (
+	encNoError = iota
+	encParseError
+	encOtherError
+)
+
+// EncodeTokens returns a compact binary encoding of toks, including their
+// Extra data, which DecodeTokens turns back into an equal token stream.  It
+// is intended for caching tokenization results between runs; the format is
+// versioned, and data written by a different version of this package is
+// rejected rather than misread.
+//
+// Errors other than *ParseError in error tokens are preserved by message only.
+func EncodeTokens(toks []Token) []byte {
+	buf := make([]byte, 0, len(encodingMagic)+len(toks)*4)
+	buf = append(buf, encodingMagic...)
+	buf = appendUvarint(buf, uint64(len(toks)))
+	for i := range toks {
+		t := &toks[i]
+		buf = appendUvarint(buf, uint64(t.Type))
+		buf = appendEncString(buf, t.Value)
+		if TokenExtraTypeLookup[t.Type] == nil {
+			continue
+		}
+		if !encodableExtra(t) {
+			// missing or unexpected Extra: decodes as nil
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		switch e := t.Extra.(type) {
+		case *TokenExtraHash:
+			buf = append(buf, encBool(e != nil && e.IsIdentifier))
+		case *TokenExtraNumeric:
+			if e == nil {
+				e = &TokenExtraNumeric{}
+			}
+			buf = append(buf, numericFlags(e))
+			buf = appendEncString(buf, e.Dimension)
+		case *TokenExtraUnicodeRange:
+			if e == nil {
+				e = &TokenExtraUnicodeRange{}
+			}
+			buf = appendUvarint(buf, uint64(uint32(e.Start)))
+			buf = appendUvarint(buf, uint64(uint32(e.End)))
+		case *TokenExtraError:
+			var err error
+			if e != nil {
+				err = e.Err
+			}
+			if pe, ok := err.(*ParseError); ok && pe != nil {
+				buf = append(buf, encParseError)
+				buf = appendUvarint(buf, uint64(pe.Type))
+				buf = appendUvarint(buf, uint64(pe.Code))
+				buf = appendEncString(buf, pe.Message)
+				buf = appendUvarint(buf, uint64(pe.Loc))
+				buf = appendUvarint(buf, uint64(pe.End))
+			} else if err != nil {
+				buf = append(buf, encOtherError)
+				buf = appendEncString(buf, err.Error())
+			} else {
+				buf = append(buf, encNoError)
+			}
+		}
+	}
+	return buf
+}
+
+// DecodeTokens decodes a token stream encoded by EncodeTokens.  It returns
+// ErrBadEncoding if b is not a complete, valid encoding.
+func DecodeTokens(b []byte) ([]Token, error) {
+	d := decoder{b: b}
+	if len(b) < len(encodingMagic) || string(b[:len(encodingMagic)]) != encodingMagic {
+		return nil, ErrBadEncoding
+	}
+	d.b = d.b[len(encodingMagic):]
+	n := d.uvarint()
+	// each token takes at least 2 bytes
+	if n > uint64(len(d.b)/2) {
+		return nil, ErrBadEncoding
+	}
+	toks := make([]Token, n)
+	for i := range toks {
+		t := &toks[i]
+		t.Type = TokenType(d.uvarint())
+		t.Value = d.string()
+		if d.bad || TokenExtraTypeLookup[t.Type] == nil {
+			continue
+		}
+		if d.byte() == 0 {
+			continue
+		}
+		switch TokenExtraTypeLookup[t.Type].(type) {
+		case *TokenExtraHash:
+			t.Extra = &TokenExtraHash{IsIdentifier: d.byte() != 0}
+		case *TokenExtraNumeric:
+			flags := d.byte()
+			e := &TokenExtraNumeric{
+				NonInteger: flags&numNonInteger != 0,
+				Exponent:   flags&numExponent != 0,
+				PlusSign:   flags&numPlusSign != 0,
+				LeadingDot: flags&numLeadingDot != 0,
+			}
+			e.Dimension = d.string()
+			t.Extra = e
+		case *TokenExtraUnicodeRange:
+			e := &TokenExtraUnicodeRange{}
+			e.Start = rune(uint32(d.uvarint()))
+			e.End = rune(uint32(d.uvarint()))
+			t.Extra = e
+		case *TokenExtraError:
+			switch d.byte() {
+			case encNoError:
+				t.Extra = &TokenExtraError{}
+			case encParseError:
+				pe := &ParseError{Type: TokenType(d.uvarint())}
+				pe.Code = ErrorCode(d.uvarint())
+				pe.Message = d.string()
+				pe.Loc = int(d.uvarint())
+				pe.End = int(d.uvarint())
+				t.Extra = &TokenExtraError{Err: pe}
+				pe.Token = *t
+			case encOtherError:
+				t.Extra = &TokenExtraError{Err: errors.New(d.string())}
+			default:
+				d.bad = true
+			}
+		}
+	}
+	if d.bad || len(d.b) != 0 {
+		return nil, ErrBadEncoding
+	}
+	return toks, nil
+}
+
+// encodableExtra reports whether t.Extra is of the type its token type calls
+// for.
+func encodableExtra(t *Token) bool {
+	switch t.Extra.(type) {
+	case *TokenExtraHash:
+		return t.Type == TokenHash
+	case *TokenExtraNumeric:
+		return t.Type == TokenNumber || t.Type == TokenPercentage || t.Type == TokenDimension
+	case *TokenExtraUnicodeRange:
+		return t.Type == TokenUnicodeRange
+	case *TokenExtraError:
+		return t.Type.StopToken()
+	}
+	return false
+}
+
+func encBool(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Bits of the encoded TokenExtraNumeric flags byte.
+const (
+	numNonInteger = 1 << iota
+	numExponent
+	numPlusSign
+	numLeadingDot
+)
+
+func numericFlags(e *TokenExtraNumeric) byte {
+	var flags byte
+	if e.NonInteger {
+		flags |= numNonInteger
+	}
+	if e.Exponent {
+		flags |= numExponent
+	}
+	if e.PlusSign {
+		flags |= numPlusSign
+	}
+	if e.LeadingDot {
+		flags |= numLeadingDot
+	}
+	return flags
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendEncString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// decoder reads from b, setting bad instead of returning errors.
+type decoder struct {
+	b   []byte
+	bad bool
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.bad = true
+		d.b = nil
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if len(d.b) == 0 {
+		d.bad = true
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.bad = true
+		d.b = nil
+		return ""
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	if s, ok := atoms[string(b)]; ok {
+		return s
+	}
+	return string(b)
+}
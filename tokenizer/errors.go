@@ -0,0 +1,55 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+// ErrorCode identifies the kind of a ParseError.  The values are stable and
+// may be stored or compared across versions of this package.
+type ErrorCode int
+
+const (
+	// No code; used for ParseErrors that are not from the tokenizer.
+	CodeNone ErrorCode = iota
+	// A backslash followed by a newline outside of a string.
+	CodeBadEscape
+	// A newline inside of a string.
+	CodeUnterminatedString
+	// A newline inside of a quoted url().
+	CodeUnterminatedURLString
+	// A quoted url() with something other than whitespace between the
+	// string and the closing parenthesis.
+	CodeURLMissingParen
+	// An unquoted url() with whitespace in the middle.
+	CodeURLWhitespace
+	// An unquoted url() containing a quote, '(' or an unprintable
+	// character.
+	CodeURLIllegalCharacter
+	// An unquoted url() containing a backslash followed by a newline.
+	CodeURLBadEscape
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	CodeNone:                  "none",
+	CodeBadEscape:             "bad-escape",
+	CodeUnterminatedString:    "unterminated-string",
+	CodeUnterminatedURLString: "unterminated-url-string",
+	CodeURLMissingParen:       "url-missing-paren",
+	CodeURLWhitespace:         "url-whitespace",
+	CodeURLIllegalCharacter:   "url-illegal-character",
+	CodeURLBadEscape:          "url-bad-escape",
+}
+
+// String returns a short name for the code, such as "unterminated-string".
+func (c ErrorCode) String() string {
+	if s, ok := errorCodeNames[c]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Targets for errors.Is, matched by ParseError.Is.
+var (
+	ErrBadEscape          = &ParseError{Type: TokenBadEscape, Code: CodeBadEscape, Message: "bad escape"}
+	ErrUnterminatedString = &ParseError{Type: TokenBadString, Code: CodeUnterminatedString, Message: "unterminated string"}
+	// Matches all errors in url() tokens, whatever their Code.
+	ErrBadURL = &ParseError{Type: TokenBadURI, Message: "bad url"}
+)
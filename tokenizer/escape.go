@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// SerializeIdentifier returns s as it would be written in CSS source as an
+// identifier, escaping any characters that would otherwise end the
+// identifier or be read as a different token.  Strings that need no escaping
+// are returned unchanged.
+func SerializeIdentifier(s string) string {
+	return escapeIdentifier(s)
+}
+
+// SerializeString returns s as a double-quoted CSS string.
+func SerializeString(s string) string {
+	return escapeString(s, '"')
+}
+
+// SerializeURL returns a url() token with s as the URL.
+func SerializeURL(s string) string {
+	return "url(" + escapeString(s, '"') + ")"
+}
+
+// IsValidIdentifier reports whether s can be written in CSS source as an
+// identifier without any escaping.
+//
+// Note that, like the tokenizer, this does not accept identifiers beginning
+// with two dashes; see IsValidCustomPropertyName for those.
+func IsValidIdentifier(s string) bool {
+	return s != "" && !identNeedsEscaping(s, 0) && utf8.ValidString(s)
+}
+
+// IsValidCustomPropertyName reports whether s is a custom property name
+// ("--" followed by at least one name character) that can be written without
+// any escaping.
+func IsValidCustomPropertyName(s string) bool {
+	if len(s) < 3 || s[0] != '-' || s[1] != '-' {
+		return false
+	}
+	for i := 2; i < len(s); i++ {
+		if !isNameCode(s[i]) {
+			return false
+		}
+	}
+	return utf8.ValidString(s)
+}
+
+// IdentifierNeedsEscaping reports whether SerializeIdentifier would have to
+// escape any part of s.
+func IdentifierNeedsEscaping(s string) bool {
+	return s != "" && identNeedsEscaping(s, 0)
+}
+
+// DecodeEscapes replaces the CSS escapes in s with the characters they
+// represent, following the "consume an escaped code point" algorithm of the
+// CSS Syntax specification:
+//
+//   - a backslash followed by 1 to 6 hex digits is replaced by that code
+//     point, and a single whitespace character after the digits is removed.
+//     Zero, surrogates, and values above U+10FFFF become U+FFFD.
+//   - a backslash followed by a newline is removed, as in a string.
+//   - a backslash at the end of s becomes U+FFFD.
+//   - a backslash followed by any other character is replaced by that
+//     character.
+func DecodeEscapes(s string) string {
+	i := strings.IndexByte(s, '\\')
+	if i == -1 {
+		return s
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(s))
+	for i != -1 {
+		buf.WriteString(s[:i])
+		s = s[i+1:]
+		switch {
+		case s == "":
+			buf.WriteString(replacementCharacter)
+		case s[0] == '\n' || s[0] == '\f':
+			s = s[1:]
+		case s[0] == '\r':
+			s = s[1:]
+			if s != "" && s[0] == '\n' {
+				s = s[1:]
+			}
+		case isHexDigit(s[0]):
+			var cp rune
+			n := 0
+			for n < len(s) && n < 6 && isHexDigit(s[n]) {
+				cp = cp<<4 | rune(hexValue(s[n]))
+				n++
+			}
+			s = s[n:]
+			if s != "" {
+				switch s[0] {
+				case ' ', '\t', '\n', '\f':
+					s = s[1:]
+				case '\r':
+					s = s[1:]
+					if s != "" && s[0] == '\n' {
+						s = s[1:]
+					}
+				}
+			}
+			if cp == 0 || (cp >= 0xD800 && cp <= 0xDFFF) || cp > utf8.MaxRune {
+				cp = utf8.RuneError
+			}
+			buf.WriteRune(cp)
+		default:
+			_, size := utf8.DecodeRuneInString(s)
+			buf.WriteString(s[:size])
+			s = s[size:]
+		}
+		i = strings.IndexByte(s, '\\')
+	}
+	buf.WriteString(s)
+	return buf.String()
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
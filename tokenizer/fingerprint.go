@@ -0,0 +1,166 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+)
+
+// Fingerprint returns a SHA-256 hash of the token stream of the stylesheet
+// read from r, normalized so that stylesheets differing only in formatting
+// hash the same:
+//
+//   - comments are removed;
+//   - escapes are decoded and strings are compared by content, so "a" and 'a'
+//     are the same;
+//   - runs of whitespace count as a single space, and whitespace at the
+//     start and end of the input and next to the { } ; , tokens is removed;
+//   - whitespace around the colon of a declaration inside a block, such as
+//     "color : red", is removed.
+//
+// Whitespace elsewhere, such as between selector parts, can change the
+// meaning of a stylesheet and is kept, so ".a :b" and ".a:b" hash
+// differently.  The hash is not stable across versions of this package.
+func Fingerprint(r io.Reader) (hash [32]byte, err error) {
+	var f fingerprinter
+	f.h = sha256.New()
+	z := NewTokenizer(r)
+	var prev TokenType = TokenEOF // start of input
+	pendingSpace := false
+	depth := 0
+	decl := declNone
+	for {
+		t := z.Next()
+		switch t.Type {
+		case TokenError:
+			return hash, z.Err()
+		case TokenComment:
+			continue
+		case TokenS:
+			pendingSpace = true
+			continue
+		}
+		space := pendingSpace && !fingerprintTrims(prev) && !fingerprintTrims(t.Type)
+		pendingSpace = false
+		switch {
+		case decl == declName && t.Type == TokenColon:
+			// This may still turn out to be a nested rule, such as
+			// "a :hover {}", where the whitespace matters.
+			f.hold(space)
+		case decl == declColon:
+			f.spaceAfter = space
+		case space:
+			f.writeType(TokenS)
+		}
+		if f.holding && (t.Type == TokenEOF || fingerprintTrims(t.Type)) {
+			f.release(t.Type == TokenOpenBrace)
+		}
+		if t.Type == TokenEOF {
+			break
+		}
+		f.writeToken(t)
+		prev = t.Type
+
+		switch {
+		case t.Type == TokenOpenBrace:
+			depth++
+			decl = declStart
+		case t.Type == TokenCloseBrace:
+			if depth > 0 {
+				depth--
+			}
+			decl = declNone
+		case t.Type == TokenSemicolon && depth > 0:
+			decl = declStart
+		case decl == declStart && t.Type == TokenIdent:
+			decl = declName
+		case decl == declName && t.Type == TokenColon:
+			decl = declColon
+		default:
+			decl = declNone
+		}
+	}
+	f.h.Sum(hash[:0])
+	return hash, nil
+}
+
+// Where Fingerprint is in a possible declaration: at the start of one inside
+// a block, after the property name, or just after the colon.
+const (
+	declNone = iota
+	declStart
+	declName
+	declColon
+)
+
+// fingerprinter feeds encoded tokens to a hash.  From the colon of a
+// possible declaration until the end of it, the input is held back, so that
+// the whitespace around the colon can be dropped if it is a declaration and
+// kept if it turns out to be the selector of a nested rule.
+type fingerprinter struct {
+	h   hash.Hash
+	buf []byte
+
+	holding                 bool
+	spaceBefore, spaceAfter bool
+	held                    []byte // the colon, then everything after it
+	colonLen                int
+}
+
+func (f *fingerprinter) write(b []byte) {
+	if f.holding {
+		f.held = append(f.held, b...)
+		if f.colonLen == 0 {
+			f.colonLen = len(f.held)
+		}
+	} else {
+		f.h.Write(b)
+	}
+}
+
+func (f *fingerprinter) writeType(tt TokenType) {
+	f.buf = appendUvarint(f.buf[:0], uint64(tt))
+	f.write(f.buf)
+}
+
+func (f *fingerprinter) writeToken(t Token) {
+	f.buf = appendUvarint(f.buf[:0], uint64(t.Type))
+	f.buf = appendEncString(f.buf, t.Value)
+	if TokenExtraTypeLookup[t.Type] != nil && t.Extra != nil {
+		f.buf = appendEncString(f.buf, t.Extra.String())
+	}
+	f.write(f.buf)
+}
+
+// hold starts holding back input, before the colon is written.
+func (f *fingerprinter) hold(spaceBefore bool) {
+	f.holding = true
+	f.spaceBefore, f.spaceAfter = spaceBefore, false
+	f.held = f.held[:0]
+	f.colonLen = 0
+}
+
+// release writes the held input, with the whitespace around the colon if
+// it was part of a rule's selector.
+func (f *fingerprinter) release(rule bool) {
+	f.holding = false
+	if rule && f.spaceBefore {
+		f.writeType(TokenS)
+	}
+	f.h.Write(f.held[:f.colonLen])
+	if rule && f.spaceAfter {
+		f.writeType(TokenS)
+	}
+	f.h.Write(f.held[f.colonLen:])
+}
+
+// fingerprintTrims reports whether whitespace next to tt is insignificant.
+func fingerprintTrims(tt TokenType) bool {
+	switch tt {
+	case TokenEOF, TokenOpenBrace, TokenCloseBrace, TokenSemicolon, TokenComma:
+		return true
+	}
+	return false
+}
@@ -6,7 +6,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"reflect"
 )
 
 // Tests should set this to true to suppress fuzzer output except on failure.
@@ -96,7 +95,7 @@ func Fuzz(b []byte) int {
 			panic(fmt.Sprintf("retokenizer gave %v, expected %v (.Value not equal)\n%v", tt, ot, tokens))
 		}
 		if TokenExtraTypeLookup[tt.Type] != nil {
-			if !reflect.DeepEqual(tt, ot) && !tt.Type.StopToken() {
+			if !tt.Equal(ot) && !tt.Type.StopToken() {
 				panic(fmt.Sprintf("retokenizer gave %v, expected %v (.Extra not equal)\n%v", tt, ot, tokens))
 			}
 		}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "reflect"
+
+// IdentEquals reports whether a and b are equal under ASCII case-insensitive
+// comparison, which is how CSS compares keywords, property names, and other
+// identifiers.  Only the letters A-Z and a-z are folded; all other characters,
+// including non-ASCII letters, must match exactly.
+func IdentEquals(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		ca, cb := a[i], b[i]
+		if ca == cb {
+			continue
+		}
+		if 'A' <= ca && ca <= 'Z' {
+			ca += 'a' - 'A'
+		}
+		if 'A' <= cb && cb <= 'Z' {
+			cb += 'a' - 'A'
+		}
+		if ca != cb {
+			return false
+		}
+	}
+	return true
+}
+
+// ToLowerASCII returns s with the letters A-Z lowercased, which is how CSS
+// case-folds identifiers.  Other characters, including non-ASCII letters,
+// are left as they are.
+func ToLowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			b := []byte(s)
+			for ; i < len(b); i++ {
+				if 'A' <= b[i] && b[i] <= 'Z' {
+					b[i] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// MatchesIdent reports whether t is a TokenIdent whose value is equal to
+// keyword under ASCII case-insensitive comparison.
+func (t *Token) MatchesIdent(keyword string) bool {
+	return t.Type == TokenIdent && IdentEquals(t.Value, keyword)
+}
+
+// Equal reports whether t and other have the same Type, Value, and Extra
+// data.  Extra is compared by the contents it points to rather than by
+// pointer.  For error tokens, the ParseError type, code, and message are
+// compared but not its position, so that equal tokens from different
+// positions in the input compare equal.
+func (t *Token) Equal(other Token) bool {
+	return t.Type == other.Type && t.Value == other.Value && extraEqual(t.Extra, other.Extra)
+}
+
+// TokensEqual reports whether a and b have the same length and their tokens
+// are pairwise Equal.
+func TokensEqual(a, b []Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func extraEqual(a, b TokenExtra) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a := a.(type) {
+	case *TokenExtraHash:
+		b, ok := b.(*TokenExtraHash)
+		return ok && (a == b || a != nil && b != nil && *a == *b)
+	case *TokenExtraNumeric:
+		b, ok := b.(*TokenExtraNumeric)
+		return ok && (a == b || a != nil && b != nil && *a == *b)
+	case *TokenExtraUnicodeRange:
+		b, ok := b.(*TokenExtraUnicodeRange)
+		return ok && (a == b || a != nil && b != nil && *a == *b)
+	case *TokenExtraError:
+		b, ok := b.(*TokenExtraError)
+		if !ok || a == nil || b == nil {
+			return ok && a == b
+		}
+		return errorEqual(a.Err, b.Err)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func errorEqual(a, b error) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	pa, ok1 := a.(*ParseError)
+	pb, ok2 := b.(*ParseError)
+	if ok1 && ok2 {
+		return pa.Type == pb.Type && pa.Code == pb.Code && pa.Message == pb.Message
+	}
+	return a.Error() == b.Error()
+}
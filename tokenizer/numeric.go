@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Float returns the numeric value of a TokenNumber, TokenPercentage, or
+// TokenDimension.  For a percentage this is the number before the percent
+// sign, so "50%" gives 50.  ok is false for other token types.
+func (t *Token) Float() (f float64, ok bool) {
+	switch t.Type {
+	case TokenNumber, TokenPercentage, TokenDimension:
+	default:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(t.Value, 64)
+	if err != nil {
+		// out of range values are still returned as ±Inf
+		if ne, isNumErr := err.(*strconv.NumError); !isNumErr || ne.Err != strconv.ErrRange {
+			return 0, false
+		}
+	}
+	return f, true
+}
+
+// Percentage returns the value of a TokenPercentage as a fraction, so "50%"
+// gives 0.5.  ok is false for other token types.
+func (t *Token) Percentage() (f float64, ok bool) {
+	if t.Type != TokenPercentage {
+		return 0, false
+	}
+	f, ok = t.Float()
+	return f / 100, ok
+}
+
+// Int returns the value of a TokenNumber, TokenPercentage, or TokenDimension
+// that was written as an integer.  ok is false for other token types, for
+// numbers with a fractional part or exponent (as recorded by
+// TokenExtraNumeric.NonInteger), and for integers that do not fit in an
+// int64.
+func (t *Token) Int() (i int64, ok bool) {
+	switch t.Type {
+	case TokenNumber, TokenPercentage, TokenDimension:
+	default:
+		return 0, false
+	}
+	if e, isNumeric := t.Extra.(*TokenExtraNumeric); isNumeric && e != nil && e.NonInteger {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(t.Value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// setForm sets the fields of e that describe how the number repr was
+// written.
+func (e *TokenExtraNumeric) setForm(repr string) {
+	if repr[0] == '+' || repr[0] == '-' {
+		e.PlusSign = repr[0] == '+'
+		repr = repr[1:]
+	}
+	e.LeadingDot = repr[0] == '.'
+	e.Exponent = strings.IndexAny(repr, "eE") != -1
+}
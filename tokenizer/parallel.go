@@ -0,0 +1,130 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Inputs are not split into chunks smaller than this.
+var parallelMinChunk = 64 << 10
+
+// TokenizeParallel tokenizes src like TokenizeAll, but splits large inputs
+// into chunks that are tokenized on separate goroutines.  The result is
+// always identical to the result of TokenizeAll.
+//
+// The input is split just after a '}', which in real stylesheets is nearly
+// always the end of a top-level rule.  Each chunk is tokenized speculatively
+// from its split point; when stitching the chunks back together, a chunk is
+// only used from the first token boundary it has in common with the
+// preceding chunk, and is tokenized again from the correct position if the
+// speculation failed (for example, when the split point was inside a string
+// or comment).
+//
+// If chunks is zero or negative, runtime.GOMAXPROCS(0) is used.
+func TokenizeParallel(src []byte, chunks int) ([]Token, []Diagnostic) {
+	if chunks <= 0 {
+		chunks = runtime.GOMAXPROCS(0)
+	}
+	if max := len(src) / parallelMinChunk; chunks > max {
+		chunks = max
+	}
+	if chunks <= 1 {
+		return TokenizeAll(src, nil)
+	}
+
+	// bounds[i] is the start of chunk i, bounds[len-1] is the end of input
+	bounds := []int{0}
+	for i := 1; i < chunks; i++ {
+		at := splitPoint(src, i*len(src)/chunks)
+		if at > bounds[len(bounds)-1] && at < len(src) {
+			bounds = append(bounds, at)
+		}
+	}
+	bounds = append(bounds, len(src))
+
+	results := make([]chunkResult, len(bounds)-1)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = tokenizeRange(src, bounds[i], bounds[i+1])
+		}(i)
+	}
+	wg.Wait()
+
+	toks := results[0].toks
+	diags := results[0].diags
+	end := results[0].end
+	for i := 1; i < len(results); i++ {
+		if end >= bounds[i+1] {
+			// the previous chunk ran over the entirety of this one
+			continue
+		}
+		r := results[i]
+		j := sort.SearchInts(r.starts, end)
+		if j == len(r.starts) || r.starts[j] != end {
+			// speculation failed, tokenize from the real boundary
+			r = tokenizeRange(src, end, bounds[i+1])
+			j = 0
+		}
+		for _, d := range r.diags {
+			if d.Index >= j {
+				d.Index += len(toks) - j
+				diags = append(diags, d)
+			}
+		}
+		toks = append(toks, r.toks[j:]...)
+		end = r.end
+	}
+	return toks, diags
+}
+
+// splitPoint returns the offset just after the first '}' at or after from,
+// or len(src) if there is none.
+func splitPoint(src []byte, from int) int {
+	i := bytes.IndexByte(src[from:], '}')
+	if i == -1 {
+		return len(src)
+	}
+	return from + i + 1
+}
+
+type chunkResult struct {
+	toks []Token
+	// offset in the input of each token
+	starts []int
+	// Index is relative to toks
+	diags []Diagnostic
+	// offset of the first token boundary at or after the chunk limit
+	end int
+}
+
+// tokenizeRange tokenizes src starting at from until reaching a token
+// boundary at or past limit.
+func tokenizeRange(src []byte, from, limit int) chunkResult {
+	var r chunkResult
+	z := newTokenizerBytes(src[from:])
+	for {
+		start := from + z.srcOffset()
+		if start >= limit && limit < len(src) {
+			r.end = start
+			return r
+		}
+		t := z.Next()
+		if t.Type == TokenEOF || t.Type == TokenError {
+			r.end = len(src)
+			return r
+		}
+		if t.Type.StopToken() {
+			pe := diagnosticError(t, start, from+z.srcOffset())
+			r.diags = append(r.diags, Diagnostic{Index: len(r.toks), Err: pe})
+		}
+		r.toks = append(r.toks, t)
+		r.starts = append(r.starts, start)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Kane York.
+
+package tokenizer
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func checkParallel(t *testing.T, name string, src []byte) {
+	wantToks, wantDiags := TokenizeAll(src, nil)
+	for _, chunks := range []int{2, 3, 7, 16} {
+		toks, diags := TokenizeParallel(src, chunks)
+		if !reflect.DeepEqual(toks, wantToks) {
+			for i := range toks {
+				if i >= len(wantToks) || !reflect.DeepEqual(toks[i], wantToks[i]) {
+					t.Errorf("%s, %d chunks: token %d differs", name, chunks, i)
+					break
+				}
+			}
+			t.Errorf("%s, %d chunks: got %d tokens, want %d", name, chunks, len(toks), len(wantToks))
+		}
+		if !reflect.DeepEqual(diags, wantDiags) {
+			t.Errorf("%s, %d chunks: diagnostics differ:\n%v\n%v", name, chunks, diags, wantDiags)
+		}
+	}
+}
+
+func TestTokenizeParallel(t *testing.T) {
+	defer func(old int) { parallelMinChunk = old }(parallelMinChunk)
+	parallelMinChunk = 16
+
+	checkParallel(t, "bootstrap", loadBootstrap(t))
+	checkParallel(t, "utility", utilityCSS())
+
+	// Split points that fall inside strings, comments, and urls
+	checkParallel(t, "string", []byte(`a { content: "} } } } } } } } }" } b { c: d }`))
+	checkParallel(t, "comment", []byte(`a { b: c } /* } } } } } } } } } } */ d { e: f }`))
+	checkParallel(t, "url", []byte(`a { b: url(}}}}}}}}}}}}}}}}}}) } c { d: url("}}}}}}}}}}}" }}}}}}) }`))
+	checkParallel(t, "bad string", []byte("a { b: \"}}}}}}}}}\n}}}}}}}}} \"}}}}}}}}}}}}}}}}}}}}}}\" }"))
+	checkParallel(t, "escape", []byte(`.a\}\}\}\}\}\}\}\}\}\}\} { b: c } .d\}\}\}\}\}\}\}\}\} {}`))
+	checkParallel(t, "crlf", []byte("a {\r\n}\r\n}\r\n}\r\n}\r\n}\r\n}\r\n}\r\n}\r\n\"}\r\n}\r\n}\r\n}\r\n}\r\n}\r\n}\r\n}\x00}"))
+	checkParallel(t, "unterminated", []byte(`a { b: c } /* }}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}`))
+
+	// Random soup of token fragments
+	pieces := []string{"}", "{", "a", " ", "\n", "\r\n", "\"", "'", "\\", "/*", "*/", "url(", ")", "(", "-", "1", ".5e3", "%", "#", "@", "u+", "?", "<!--", "-->", "\x00"}
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		var buf []string
+		for i := 0; i < 200; i++ {
+			buf = append(buf, pieces[rng.Intn(len(pieces))])
+		}
+		checkParallel(t, "random", []byte(strings.Join(buf, "")))
+	}
+}
+
+func BenchmarkTokenizeParallelBootstrap(b *testing.B) {
+	defer func(old int) { parallelMinChunk = old }(parallelMinChunk)
+	parallelMinChunk = 16 << 10
+
+	input := loadBootstrap(b)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		TokenizeParallel(input, 0)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"bytes"
+	"sort"
+	"unicode/utf8"
+)
+
+// TokenAtOffset returns the token of toks covering the byte offset off in
+// the output of RenderTokens(toks), along with its index in toks.  An offset
+// at the boundary between two tokens, or in a separator inserted between
+// them, belongs to the second.  If off is negative, or at or past the end of
+// the output, the returned index is -1.
+//
+// For tokens from TokenizeAll, the rendered output is the original source
+// as long as it has no escapes, single-quoted strings, or unquoted urls,
+// which the renderer writes differently.  Use Document to find tokens by
+// their offsets in any source.
+func TokenAtOffset(toks []Token, off int) (Token, int) {
+	if off >= 0 {
+		var r TokenRenderer
+		var w countWriter
+		for i, t := range toks {
+			r.WriteTokenTo(&w, t)
+			if off < int(w) {
+				return t, i
+			}
+		}
+	}
+	return Token{Type: TokenEOF}, -1
+}
+
+// countWriter counts the bytes written to it.
+type countWriter int
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w += countWriter(len(p))
+	return len(p), nil
+}
+
+// TokenAtOffset returns the token covering the byte offset off in the
+// document's source, along with its index in Tokens.  It is like the
+// TokenAtOffset function, but the offsets are exact for any source.
+func (d *Document) TokenAtOffset(off int) (Token, int) {
+	i := sort.SearchInts(d.starts, off+1) - 1
+	if i < 0 || off >= len(d.src) {
+		return Token{Type: TokenEOF}, -1
+	}
+	return d.toks[i], i
+}
+
+// Position converts a byte offset in the document to a zero-based line
+// number and a column counted in UTF-16 code units, as used by the Language
+// Server Protocol.
+func (d *Document) Position(off int) (line, col int) {
+	return OffsetToUTF16Position(d.src, off)
+}
+
+// Offset converts a line and UTF-16 column in the document to a byte offset.
+func (d *Document) Offset(line, col int) int {
+	return UTF16PositionToOffset(d.src, line, col)
+}
+
+// OffsetToUTF16Position converts the byte offset off in src to a zero-based
+// line number and a column counted in UTF-16 code units.  Lines end at "\n",
+// "\r\n", or "\r".  An offset in the middle of a UTF-8 sequence is treated as
+// the start of that sequence, negative offsets as the start of src, and
+// offsets past the end of src as the end.
+func OffsetToUTF16Position(src []byte, off int) (line, col int) {
+	if off < 0 {
+		off = 0
+	} else if off > len(src) {
+		off = len(src)
+	}
+	lineStart := 0
+	for {
+		i := bytes.IndexAny(src[lineStart:off], "\r\n")
+		if i == -1 {
+			break
+		}
+		i += lineStart
+		if src[i] == '\r' && i+1 < len(src) && src[i+1] == '\n' {
+			if i+1 == off {
+				// between \r and \n: still on this line
+				off = i
+				break
+			}
+			i++
+		}
+		lineStart = i + 1
+		line++
+	}
+	return line, utf16Len(src[lineStart:off])
+}
+
+// UTF16PositionToOffset converts a zero-based line number and UTF-16 column
+// to a byte offset in src.  A column past the end of the line, or in the
+// middle of a surrogate pair, is moved back to the end of the line or the
+// start of the character.  A line past the end of src gives len(src).
+func UTF16PositionToOffset(src []byte, line, col int) int {
+	off := 0
+	for ; line > 0; line-- {
+		i := bytes.IndexAny(src[off:], "\r\n")
+		if i == -1 {
+			return len(src)
+		}
+		off += i
+		if src[off] == '\r' && off+1 < len(src) && src[off+1] == '\n' {
+			off++
+		}
+		off++
+	}
+	for off < len(src) && src[off] != '\n' && src[off] != '\r' {
+		r, size := utf8.DecodeRune(src[off:])
+		n := 1
+		if r >= 0x10000 {
+			n = 2
+		}
+		if col < n {
+			break
+		}
+		col -= n
+		off += size
+	}
+	return off
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode b.
+// Invalid bytes count as one unit, as they would be replaced by U+FFFD.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		if b[0] < utf8.RuneSelf {
+			n++
+			b = b[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+		b = b[size:]
+	}
+	return n
+}
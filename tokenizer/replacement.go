@@ -0,0 +1,68 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+// ReplacementKind is the reason for a replacement recorded by the tokenizer.
+type ReplacementKind int
+
+const (
+	// A NUL byte in the input, replaced during preprocessing.
+	ReplacedNUL ReplacementKind = iota + 1
+	// An escape for a code point that cannot appear in a token: zero, a
+	// surrogate, a value past U+10FFFF, an escaped invalid UTF-8 byte, or a
+	// backslash at the end of the input.
+	ReplacedEscape
+)
+
+// String returns "NUL" or "escape".
+func (k ReplacementKind) String() string {
+	switch k {
+	case ReplacedNUL:
+		return "NUL"
+	case ReplacedEscape:
+		return "escape"
+	}
+	return "unknown"
+}
+
+// Replacement records a place where the tokenizer substituted U+FFFD
+// REPLACEMENT CHARACTER for what was in the input.
+type Replacement struct {
+	// Byte offset in the input of the NUL byte or the escape's backslash.
+	Offset int
+	Kind   ReplacementKind
+}
+
+// Replacements returns the replacements made in the input consumed so far,
+// in input order.  Input that needed replacements is well-formed CSS, but
+// code that checks CSS for dangerous content may see it differently than a
+// browser does, so security-sensitive callers may want to reject it.
+//
+// Invalid UTF-8 outside of escapes is not replaced by the tokenizer, and is
+// not reported.
+func (z *Tokenizer) Replacements() []Replacement {
+	var nuls []int64
+	if z.norm != nil {
+		nuls = z.norm.nuls
+		// the preprocessor may have read ahead of the last token
+		end := int64(z.srcOffset())
+		for len(nuls) > 0 && nuls[len(nuls)-1] >= end {
+			nuls = nuls[:len(nuls)-1]
+		}
+	}
+	if len(nuls) == 0 {
+		return z.replaced
+	}
+	out := make([]Replacement, 0, len(nuls)+len(z.replaced))
+	esc := z.replaced
+	for len(nuls) > 0 || len(esc) > 0 {
+		if len(esc) == 0 || len(nuls) > 0 && nuls[0] < int64(esc[0].Offset) {
+			out = append(out, Replacement{Offset: int(nuls[0]), Kind: ReplacedNUL})
+			nuls = nuls[1:]
+		} else {
+			out = append(out, esc[0])
+			esc = esc[1:]
+		}
+	}
+	return out
+}
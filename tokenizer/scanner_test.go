@@ -6,6 +6,11 @@
 package tokenizer
 
 import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -68,22 +73,23 @@ func TestMatchers(t *testing.T) {
 	checkMatch("##name", TokenDelim, "#", TokenHash, "name", &TokenExtraHash{IsIdentifier: true})
 	checkMatch("#123", TokenHash, "123", &TokenExtraHash{IsIdentifier: false})
 	checkMatch("42''", TokenNumber, "42", &TokenExtraNumeric{}, TokenString, "")
-	checkMatch("+42", TokenNumber, "+42", &TokenExtraNumeric{})
+	checkMatch("+42", TokenNumber, "+42", &TokenExtraNumeric{PlusSign: true})
 	checkMatch("-42", TokenNumber, "-42", &TokenExtraNumeric{})
 	checkMatch("42.", TokenNumber, "42", &TokenExtraNumeric{}, TokenDelim, ".")
 	checkMatch("42.0", TokenNumber, "42.0", &TokenExtraNumeric{NonInteger: true})
 	checkMatch("4.2", TokenNumber, "4.2", &TokenExtraNumeric{NonInteger: true})
-	checkMatch(".42", TokenNumber, ".42", &TokenExtraNumeric{NonInteger: true})
-	checkMatch("+.42", TokenNumber, "+.42", &TokenExtraNumeric{NonInteger: true})
-	checkMatch("-.42", TokenNumber, "-.42", &TokenExtraNumeric{NonInteger: true})
+	checkMatch(".42", TokenNumber, ".42", &TokenExtraNumeric{NonInteger: true, LeadingDot: true})
+	checkMatch("+.42", TokenNumber, "+.42", &TokenExtraNumeric{NonInteger: true, PlusSign: true, LeadingDot: true})
+	checkMatch("-.42", TokenNumber, "-.42", &TokenExtraNumeric{NonInteger: true, LeadingDot: true})
 	checkMatch("42%", TokenPercentage, "42", &TokenExtraNumeric{})
 	checkMatch("4.2%", TokenPercentage, "4.2", &TokenExtraNumeric{NonInteger: true})
-	checkMatch(".42%", TokenPercentage, ".42", &TokenExtraNumeric{NonInteger: true})
+	checkMatch(".42%", TokenPercentage, ".42", &TokenExtraNumeric{NonInteger: true, LeadingDot: true})
 	checkMatch("42px", TokenDimension, "42", &TokenExtraNumeric{Dimension: "px"}) // TODO check the dimension stored in .Extra
 
 	checkMatch("5e", TokenDimension, "5", &TokenExtraNumeric{Dimension: "e"})
 	checkMatch("5e-", TokenDimension, "5", &TokenExtraNumeric{Dimension: "e-"})
-	checkMatch("5e-3", TokenNumber, "5e-3", &TokenExtraNumeric{NonInteger: true})
+	checkMatch("5e-3", TokenNumber, "5e-3", &TokenExtraNumeric{NonInteger: true, Exponent: true})
+	checkMatch("+1E3", TokenNumber, "+1E3", &TokenExtraNumeric{NonInteger: true, Exponent: true, PlusSign: true})
 	checkMatch("5e-\xf1", TokenDimension, "5", &TokenExtraNumeric{Dimension: "e-\xf1"})
 
 	checkMatch("url(http://domain.com)", TokenURI, "http://domain.com")
@@ -109,7 +115,7 @@ func TestMatchers(t *testing.T) {
 	checkMatch("U+??????", TokenUnicodeRange, "U+0000-FFFFFF", &TokenExtraUnicodeRange{Start: 0, End: 0xFFFFFF})
 	checkMatch("<!--", TokenCDO, "<!--")
 	checkMatch("-->", TokenCDC, "-->")
-	checkMatch("   \n   \t   \n", TokenS, "\n") // TODO - whitespace preservation
+	checkMatch("   \n   \t   \n", TokenS, "   \n   \t   \n")
 	checkMatch("/**/", TokenComment, "")
 	checkMatch("/***/", TokenComment, "*")
 	checkMatch("/**", TokenComment, "*")
@@ -159,3 +165,1414 @@ func TestMatchers(t *testing.T) {
 		`#sw_tfbb,#id_d{display:none}.sw_pref{border-style:solid;border-width:7px 0 7px 10px;vertical-align:bottom}#b_tween{margin-top:-28px}#b_tween>span{line-height:30px}#b_tween .ftrH{line-height:30px;height:30px}input{font:inherit;font-size:100%}.b_searchboxForm{font:18px/normal 'Segoe UI',Arial,Helvetica,Sans-Serif}.b_beta{font:11px/normal Arial,Helvetica,Sans-Serif}.b_scopebar,.id_button{line-height:30px}.sa_ec{font:13px Arial,Helvetica,Sans-Serif}#sa_ul .sa_hd{font-size:11px;line-height:16px}#sw_as strong{font-family:'Segoe UI Semibold',Arial,Helvetica,Sans-Serif}#id_h{background-color:transparent!important;position:relativ e!important;float:right;height:35px!important;width:280px!important}.sw_pref{margin:0 15px 3px 0}#id_d{left:auto;right:26px;top:35px!important}.id_avatar{vertical-align:middle;margin:10px 0 10px 10px}`),
 	)
 }
+
+func TestLongTokens(t *testing.T) {
+	// Tokens that span several read buffers
+	long := strings.Repeat("abcdefgh", 2000)
+	for _, tc := range []struct {
+		input string
+		tt    TokenType
+		value string
+	}{
+		{long, TokenIdent, long},
+		{"-" + long, TokenIdent, "-" + long},
+		{`"` + long + `"`, TokenString, long},
+		{`'` + long + `\'` + long + `'`, TokenString, long + "'" + long},
+		{"/*" + long + "*" + long + "*/", TokenComment, long + "*" + long},
+		{"#" + long, TokenHash, long},
+		{"@" + long, TokenAtKeyword, long},
+		{"url(" + long + ")", TokenURI, long},
+		{strings.Repeat(" \t", 5000), TokenS, strings.Repeat(" \t", 5000)},
+		{strings.Repeat("\r\n ", 5000), TokenS, strings.Repeat("\n ", 5000)},
+	} {
+		tz := NewTokenizer(strings.NewReader(tc.input))
+		tok := tz.Next()
+		if tok.Type != tc.tt || tok.Value != tc.value {
+			t.Errorf("long %v: got %v (len %d)", tc.tt, tok.Type, len(tok.Value))
+		}
+		if tok := tz.Next(); tok.Type != TokenEOF {
+			t.Errorf("long %v: missing EOF, got %v", tc.tt, tok)
+		}
+	}
+}
+
+func TestTokenizeAll(t *testing.T) {
+	src := []byte("a {\r\n  c: url(d e) \\\n b: \"x\n}")
+	toks, diags := TokenizeAll(src, nil)
+
+	var want []Token
+	tz := NewTokenizer(strings.NewReader(string(src)))
+	for {
+		tok := tz.Next()
+		if tok.Type == TokenEOF {
+			break
+		}
+		want = append(want, tok)
+	}
+	if len(toks) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(toks), len(want))
+	}
+	for i := range toks {
+		if toks[i].Type != want[i].Type || toks[i].Value != want[i].Value {
+			t.Errorf("token %d: got %v, want %v", i, toks[i], want[i])
+		}
+	}
+
+	wantDiags := []struct {
+		tt  TokenType
+		loc int
+	}{
+		{TokenBadURI, 10},
+		{TokenBadEscape, 19},
+		{TokenBadString, 25},
+	}
+	if len(diags) != len(wantDiags) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(diags), len(wantDiags), diags)
+	}
+	for i, d := range diags {
+		if toks[d.Index].Type != wantDiags[i].tt || d.Err.Type != wantDiags[i].tt {
+			t.Errorf("diagnostic %d: got %v for token %v", i, d.Err.Type, toks[d.Index])
+		}
+		if d.Err.Loc != wantDiags[i].loc {
+			t.Errorf("diagnostic %d: got Loc %d, want %d", i, d.Err.Loc, wantDiags[i].loc)
+		}
+	}
+
+	// Offsets are reported in terms of the original input
+	_, diags = TokenizeAll([]byte("\x00\x00 \"a\n"), nil)
+	if len(diags) != 1 || diags[0].Err.Loc != 3 {
+		t.Errorf("after NUL bytes: got %v", diags)
+	}
+
+	// Reusing the slice must not allocate a new one
+	again, _ := TokenizeAll([]byte("a b"), toks)
+	if &again[0] != &toks[0] {
+		t.Errorf("TokenizeAll did not reuse the provided slice")
+	}
+}
+
+func TestTransformReader(t *testing.T) {
+	transform := func(tok Token) []Token {
+		switch {
+		case tok.Type == TokenURI:
+			tok.Value = "https://cdn.example.com/" + tok.Value
+			return []Token{tok}
+		case tok.Type == TokenS:
+			// drop all whitespace
+			return nil
+		case tok.Type == TokenSemicolon:
+			return []Token{tok, {Type: TokenS, Value: "\n"}}
+		}
+		return []Token{tok}
+	}
+	in := "a b { background: url(img/x.png) no-repeat; color : red }"
+	want := "a/**/b{background:url(\"https://cdn.example.com/img/x.png\")no-repeat;\ncolor:red}"
+
+	out, err := ioutil.ReadAll(NewTransformReader(strings.NewReader(in), transform))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got  %q\nwant %q", out, want)
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	for _, tc := range []struct {
+		fn       func(string) string
+		in, want string
+	}{
+		{SerializeIdentifier, "abc", "abc"},
+		{SerializeIdentifier, "a b", `a\20 b`},
+		{SerializeIdentifier, "1a", `\31 a`},
+		{SerializeIdentifier, "-", `\-`},
+		{SerializeIdentifier, "a\\b", `a\5C b`},
+		{SerializeString, "abc", `"abc"`},
+		{SerializeString, "a\"b\nc", `"a\"b\0A c"`},
+		{SerializeURL, "x.png", `url("x.png")`},
+		{SerializeURL, "a)b", `url("a)b")`},
+	} {
+		if got := tc.fn(tc.in); got != tc.want {
+			t.Errorf("serialize %q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	for _, s := range []string{"abc", "a b", "1a", "-", "--x", "a\\b", "é\x01", "e"} {
+		tz := NewTokenizer(strings.NewReader(SerializeIdentifier(s)))
+		if tok := tz.Next(); tok.Type != TokenIdent || tok.Value != s {
+			t.Errorf("SerializeIdentifier(%q) did not round-trip: %v", s, tok)
+		}
+		if got := DecodeEscapes(SerializeIdentifier(s)); got != s {
+			t.Errorf("DecodeEscapes(SerializeIdentifier(%q)) = %q", s, got)
+		}
+	}
+}
+
+func TestDecodeEscapes(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"abc", "abc"},
+		{`\41`, "A"},
+		{`\41 B`, "AB"},
+		{`\41  B`, "A B"},
+		{"\\41\r\nB", "AB"},
+		{`\000041`, "A"},
+		{`\0000411`, "A1"},
+		{`\0`, "\uFFFD"},
+		{`\D800`, "\uFFFD"},
+		{`\110000`, "\uFFFD"},
+		{`\"\\\.`, `"\.`},
+		{"a\\\nb", "ab"},
+		{`a\`, "a\uFFFD"},
+		{`\é`, "é"},
+	} {
+		if got := DecodeEscapes(tc.in); got != tc.want {
+			t.Errorf("DecodeEscapes(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestIdentifierValidation(t *testing.T) {
+	for _, tc := range []struct {
+		s             string
+		ident, custom bool
+		needsEscaping bool
+	}{
+		{"", false, false, false},
+		{"a", true, false, false},
+		{"-a", true, false, false},
+		{"_a-1", true, false, false},
+		{"é", true, false, false},
+		{"1a", false, false, true},
+		{"-", false, false, true},
+		{"-1", false, false, true},
+		{"a b", false, false, true},
+		{"a.b", false, false, true},
+		{"--", false, false, true},
+		{"--a", false, true, true},
+		{"--1-é", false, true, true},
+		{"--a b", false, false, true},
+		{"\xff", false, false, false},
+	} {
+		if got := IsValidIdentifier(tc.s); got != tc.ident {
+			t.Errorf("IsValidIdentifier(%q) = %v", tc.s, got)
+		}
+		if got := IsValidCustomPropertyName(tc.s); got != tc.custom {
+			t.Errorf("IsValidCustomPropertyName(%q) = %v", tc.s, got)
+		}
+		if got := IdentifierNeedsEscaping(tc.s); got != tc.needsEscaping {
+			t.Errorf("IdentifierNeedsEscaping(%q) = %v", tc.s, got)
+		}
+	}
+}
+
+func TestIdentEquals(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"", "", true},
+		{"important", "IMPORTANT", true},
+		{"Important", "imPortant", true},
+		{"important", "importan", false},
+		{"a-B_1", "A-b_1", true},
+		{"@", "`", false},
+		{"[", "{", false},
+		{"é", "É", false},
+		{"K", "k", false}, // KELVIN SIGN
+	} {
+		if got := IdentEquals(tc.a, tc.b); got != tc.want {
+			t.Errorf("IdentEquals(%q, %q) = %v", tc.a, tc.b, got)
+		}
+	}
+
+	for _, tc := range []struct{ in, want string }{
+		{"", ""},
+		{"nth-CHILD", "nth-child"},
+		{"ÉA", "Éa"},
+		{"\u212A", "\u212A"}, // KELVIN SIGN
+	} {
+		if got := ToLowerASCII(tc.in); got != tc.want {
+			t.Errorf("ToLowerASCII(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	tok := Token{Type: TokenIdent, Value: "!IMPORTANT"[1:]}
+	if !tok.MatchesIdent("important") {
+		t.Errorf("MatchesIdent: IMPORTANT did not match")
+	}
+	tok.Type = TokenString
+	if tok.MatchesIdent("important") {
+		t.Errorf("MatchesIdent: string token matched")
+	}
+}
+
+func TestTokenEqual(t *testing.T) {
+	a, _ := TokenizeAll([]byte(`#a 1.5em U+0-7F "x\`+"\n"+`url(a b)`), nil)
+	b, _ := TokenizeAll([]byte(`#a 1.5em U+0-7F "x\`+"\n"+`url(a b)`), nil)
+	if !TokensEqual(a, b) {
+		t.Errorf("TokensEqual: separately tokenized streams differ")
+	}
+	if TokensEqual(a, b[1:]) {
+		t.Errorf("TokensEqual: streams of different lengths are equal")
+	}
+
+	for _, tc := range []struct {
+		a, b Token
+		want bool
+	}{
+		{Token{Type: TokenIdent, Value: "a"}, Token{Type: TokenIdent, Value: "a"}, true},
+		{Token{Type: TokenIdent, Value: "a"}, Token{Type: TokenFunction, Value: "a"}, false},
+		{Token{Type: TokenIdent, Value: "a"}, Token{Type: TokenIdent, Value: "b"}, false},
+		{
+			Token{Type: TokenHash, Value: "a", Extra: &TokenExtraHash{IsIdentifier: true}},
+			Token{Type: TokenHash, Value: "a", Extra: &TokenExtraHash{IsIdentifier: false}},
+			false,
+		},
+		{
+			Token{Type: TokenDimension, Value: "1", Extra: &TokenExtraNumeric{Dimension: "px"}},
+			Token{Type: TokenDimension, Value: "1", Extra: &TokenExtraNumeric{Dimension: "px"}},
+			true,
+		},
+		{
+			Token{Type: TokenDimension, Value: "1", Extra: &TokenExtraNumeric{Dimension: "px"}},
+			Token{Type: TokenDimension, Value: "1"},
+			false,
+		},
+		{
+			Token{Type: TokenBadString, Value: "a", Extra: &TokenExtraError{Err: &ParseError{Type: TokenBadString, Message: "m", Loc: 1}}},
+			Token{Type: TokenBadString, Value: "a", Extra: &TokenExtraError{Err: &ParseError{Type: TokenBadString, Message: "m", Loc: 7}}},
+			true,
+		},
+	} {
+		if got := tc.a.Equal(tc.b); got != tc.want {
+			t.Errorf("%v.Equal(%v) = %v", tc.a, tc.b, got)
+		}
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	for _, tc := range []struct {
+		src        string
+		r, g, b, a uint8
+		ok         bool
+	}{
+		{"#fff", 0xff, 0xff, 0xff, 0xff, true},
+		{"#0A8", 0x00, 0xaa, 0x88, 0xff, true},
+		{"#0a88", 0x00, 0xaa, 0x88, 0x88, true},
+		{"#123456", 0x12, 0x34, 0x56, 0xff, true},
+		{"#12345678", 0x12, 0x34, 0x56, 0x78, true},
+		{"#DeadBeef", 0xde, 0xad, 0xbe, 0xef, true},
+		{"#ab", 0, 0, 0, 0, false},
+		{"#12345", 0, 0, 0, 0, false},
+		{"#ggg", 0, 0, 0, 0, false},
+		{"#\\66 ff", 0xff, 0xff, 0xff, 0xff, true},
+		{"fff", 0, 0, 0, 0, false},
+	} {
+		toks, _ := TokenizeAll([]byte(tc.src), nil)
+		r, g, b, a, ok := toks[0].HexColor()
+		if r != tc.r || g != tc.g || b != tc.b || a != tc.a || ok != tc.ok {
+			t.Errorf("HexColor(%s) = %d %d %d %d %v, want %d %d %d %d %v",
+				tc.src, r, g, b, a, ok, tc.r, tc.g, tc.b, tc.a, tc.ok)
+		}
+	}
+}
+
+func TestClassifyUnit(t *testing.T) {
+	for _, tc := range []struct {
+		u    string
+		want UnitKind
+	}{
+		{"px", UnitLength},
+		{"PX", UnitLength},
+		{"Rem", UnitLength},
+		{"pxx", UnitUnknown},
+		{"", UnitUnknown},
+		{"dvmin", UnitViewportLength},
+		{"cqi", UnitContainerLength},
+		{"turn", UnitAngle},
+		{"MS", UnitTime},
+		{"kHz", UnitFrequency},
+		{"x", UnitResolution},
+		{"fr", UnitFlex},
+		{"averyveryverylongunit", UnitUnknown},
+	} {
+		if got := ClassifyUnit(tc.u); got != tc.want {
+			t.Errorf("ClassifyUnit(%q) = %v, want %v", tc.u, got, tc.want)
+		}
+	}
+
+	toks, _ := TokenizeAll([]byte("10vh 3pxx"), nil)
+	if k := toks[0].Extra.(*TokenExtraNumeric).UnitKind(); !k.IsLength() {
+		t.Errorf("UnitKind of 10vh = %v", k)
+	}
+	if k := toks[2].Extra.(*TokenExtraNumeric).UnitKind(); k != UnitUnknown {
+		t.Errorf("UnitKind of 3pxx = %v", k)
+	}
+}
+
+func TestUnicodeRangeSet(t *testing.T) {
+	parse := func(src string) UnicodeRangeSet {
+		toks, _ := TokenizeAll([]byte(src), nil)
+		return UnicodeRangeSetFromTokens(toks)
+	}
+
+	latin := parse("U+0000-00FF, U+0131, U+0152-0153, U+02BB-02BC, U+0100-0130")
+	if got, want := latin.String(), "U+0000-0131, U+0152-0153, U+02BB-02BC"; got != want {
+		t.Errorf("latin = %s, want %s", got, want)
+	}
+	if got := latin.Len(); got != 0x132+2+2 {
+		t.Errorf("latin.Len() = %d", got)
+	}
+	for c, want := range map[rune]bool{'a': true, 0x131: true, 0x132: false, 0x153: true, 0x2BA: false, 0x2BC: true, 0x10000: false} {
+		if latin.Contains(c) != want {
+			t.Errorf("latin.Contains(%U) = %v", c, !want)
+		}
+	}
+
+	// invalid ranges are dropped, out of range ends are clamped
+	if got, want := parse("U+20-10, U+110000, U+10FFFE-FFFFFF").String(), "U+10FFFE-10FFFF"; got != want {
+		t.Errorf("clamping: got %s, want %s", got, want)
+	}
+
+	greek := parse("U+0370-03FF, U+1F00-1FFF, U+0100-017F")
+	if got, want := latin.Intersect(greek).String(), "U+0100-0131, U+0152-0153"; got != want {
+		t.Errorf("Intersect = %s, want %s", got, want)
+	}
+	if got, want := latin.Union(greek).String(), "U+0000-017F, U+02BB-02BC, U+0370-03FF, U+1F00-1FFF"; got != want {
+		t.Errorf("Union = %s, want %s", got, want)
+	}
+
+	var s UnicodeRangeSet
+	s.Add(TokenExtraUnicodeRange{Start: 'a', End: 'z'})
+	s.Add(TokenExtraUnicodeRange{Start: 'z', End: 'a'})
+	s.Add(TokenExtraUnicodeRange{Start: 'A', End: 'Z'})
+	if got, want := s.String(), "U+0041-005A, U+0061-007A"; got != want {
+		t.Errorf("Add: got %s, want %s", got, want)
+	}
+	if s.Contains('_') || !s.Contains('Q') {
+		t.Errorf("Contains is wrong for %s", s)
+	}
+
+	// adding to a copy leaves the original alone
+	u := parse("U+10-20, U+30-40, U+100-200")
+	u2 := u
+	u2.Add(TokenExtraUnicodeRange{Start: 0, End: 1})
+	if got, want := u.String(), "U+0010-0020, U+0030-0040, U+0100-0200"; got != want {
+		t.Errorf("original after Add to copy: got %s, want %s", got, want)
+	}
+	if got, want := u2.String(), "U+0000-0001, U+0010-0020, U+0030-0040, U+0100-0200"; got != want {
+		t.Errorf("copy after Add: got %s, want %s", got, want)
+	}
+}
+
+func TestSyntaxLevel4(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want []Token
+	}{
+		{"u+0-7f", []Token{
+			{Type: TokenIdent, Value: "u"},
+			{Type: TokenNumber, Value: "+0", Extra: &TokenExtraNumeric{PlusSign: true}},
+			{Type: TokenDimension, Value: "-7", Extra: &TokenExtraNumeric{Dimension: "f"}},
+		}},
+		{"a|=b", []Token{
+			{Type: TokenIdent, Value: "a"},
+			{Type: TokenDelim, Value: "|"},
+			{Type: TokenDelim, Value: "="},
+			{Type: TokenIdent, Value: "b"},
+		}},
+		{"~=^=$=*=||", []Token{
+			{Type: TokenDelim, Value: "~"}, {Type: TokenDelim, Value: "="},
+			{Type: TokenDelim, Value: "^"}, {Type: TokenDelim, Value: "="},
+			{Type: TokenDelim, Value: "$"}, {Type: TokenDelim, Value: "="},
+			{Type: TokenDelim, Value: "*"}, {Type: TokenDelim, Value: "="},
+			{Type: TokenDelim, Value: "|"}, {Type: TokenDelim, Value: "|"},
+		}},
+		{"--main-color:-->", []Token{
+			{Type: TokenIdent, Value: "--main-color"},
+			{Type: TokenColon, Value: ":"},
+			{Type: TokenCDC, Value: "-->"},
+		}},
+		{"var(--x)", []Token{
+			{Type: TokenFunction, Value: "var"},
+			{Type: TokenIdent, Value: "--x"},
+			{Type: TokenCloseParen, Value: ")"},
+		}},
+	} {
+		z := NewTokenizer(strings.NewReader(tc.src))
+		z.Level = SyntaxLevel4
+		var got []Token
+		for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+			got = append(got, tok)
+		}
+		if !TokensEqual(got, tc.want) {
+			t.Errorf("Level 4 %q:\ngot  %v\nwant %v", tc.src, got, tc.want)
+		}
+
+		// Level 4 token streams must survive rendering
+		var buf bytes.Buffer
+		var wr TokenRenderer
+		for _, tok := range got {
+			wr.WriteTokenTo(&buf, tok)
+		}
+		z = NewTokenizer(strings.NewReader(buf.String()))
+		z.Level = SyntaxLevel4
+		var again []Token
+		for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+			if tok.Type != TokenComment {
+				again = append(again, tok)
+			}
+		}
+		if !TokensEqual(again, tc.want) {
+			t.Errorf("Level 4 %q: rendered as %q, which gives %v", tc.src, buf.String(), again)
+		}
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	for _, tc := range []struct {
+		src, exact, normalized string
+	}{
+		{" ", " ", " "},
+		{"\t\t ", "\t\t ", " "},
+		{"\n  ", "\n  ", "\n"},
+		{"  \r\n\t", "  \n\t", "\n"},
+	} {
+		for _, normalize := range []bool{false, true} {
+			z := NewTokenizer(strings.NewReader(tc.src))
+			z.NormalizeWhitespace = normalize
+			want := tc.exact
+			if normalize {
+				want = tc.normalized
+			}
+			if tok := z.Next(); tok.Type != TokenS || tok.Value != want {
+				t.Errorf("%q (normalize=%v): got %v, want %q", tc.src, normalize, tok, want)
+			}
+		}
+	}
+}
+
+func TestCommentKind(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want CommentKind
+	}{
+		{"/* plain */", CommentOrdinary},
+		{"/**/", CommentOrdinary},
+		{"/*! license */", CommentLicense},
+		{"/*!*/", CommentLicense},
+		{"/*# sourceMappingURL=a.css.map */", CommentSourceMap},
+		{"/*@ sourceMappingURL=a.css.map */", CommentSourceMap},
+		{"/*#sourceMappingURL=a.css.map */", CommentOrdinary},
+		{"/*# sourceURL=a.css */", CommentOrdinary},
+	} {
+		toks, _ := TokenizeAll([]byte(tc.src), nil)
+		if got := toks[0].CommentKind(); got != tc.want {
+			t.Errorf("CommentKind(%s) = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+
+	toks, _ := TokenizeAll([]byte("/*! MIT */a/**/b/*# sourceMappingURL=x.map */"), nil)
+	for _, tc := range []struct {
+		drop CommentKind
+		want string
+	}{
+		{0, "/*! MIT */a/**/b/*# sourceMappingURL=x.map */"},
+		{CommentOrdinary, "/*! MIT */a/**/b/*# sourceMappingURL=x.map */"},
+		{CommentOrdinary | CommentSourceMap, "/*! MIT */a/**/b"},
+		{CommentAll, "a/**/b"},
+	} {
+		var buf bytes.Buffer
+		wr := TokenRenderer{DropComments: tc.drop}
+		for _, tok := range toks {
+			wr.WriteTokenTo(&buf, tok)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("DropComments %v: got %q, want %q", tc.drop, buf.String(), tc.want)
+		}
+	}
+}
+
+func TestNeedsSeparator(t *testing.T) {
+	ident := Token{Type: TokenIdent, Value: "a"}
+	number := Token{Type: TokenNumber, Value: "1", Extra: &TokenExtraNumeric{}}
+	delim := func(s string) Token { return Token{Type: TokenDelim, Value: s} }
+	for _, tc := range []struct {
+		prev, next Token
+		want       bool
+	}{
+		{ident, ident, true},
+		{ident, number, true},
+		{ident, delim("-"), true},
+		{ident, Token{Type: TokenColon, Value: ":"}, false},
+		{ident, Token{Type: TokenS, Value: " "}, false},
+		{delim("-"), number, true},
+		{delim("-"), ident, true},
+		{delim("-"), Token{Type: TokenIdent, Value: "-x"}, false},
+		{delim("-"), Token{Type: TokenFunction, Value: "-x"}, false},
+		{delim("-"), Token{Type: TokenIdent, Value: "-1"}, true},
+		{delim("-"), delim("-"), false},
+		{ident, Token{Type: TokenOpenParen, Value: "("}, true},
+		{number, Token{Type: TokenOpenParen, Value: "("}, false},
+		{delim("#"), ident, true},
+		{delim("/"), delim("*"), true},
+		{delim("|"), delim("="), true},
+		{delim("|"), delim("|"), true},
+		{number, Token{Type: TokenPercentage, Value: "1", Extra: &TokenExtraNumeric{}}, true},
+		{Token{Type: TokenS, Value: " "}, ident, false},
+	} {
+		if got := NeedsSeparator(tc.prev, tc.next); got != tc.want {
+			t.Errorf("NeedsSeparator(%v, %v) = %v", tc.prev, tc.next, got)
+		}
+	}
+
+	toks := []Token{ident, ident, delim("-"), number, delim("/"), delim("*"), ident}
+	for _, tc := range []struct {
+		space bool
+		want  string
+	}{
+		{false, "a/**/a/**/-/**/1//**/*a"},
+		{true, "a a - 1/ *a"},
+	} {
+		var buf bytes.Buffer
+		wr := TokenRenderer{SpaceSeparator: tc.space}
+		for _, tok := range toks {
+			wr.WriteTokenTo(&buf, tok)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("SpaceSeparator=%v: got %q, want %q", tc.space, buf.String(), tc.want)
+		}
+	}
+}
+
+type limitWriter struct {
+	n, writes int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestRenderTokens(t *testing.T) {
+	toks, _ := TokenizeAll([]byte(`a b url(x) "s" 1px`), nil)
+	var buf bytes.Buffer
+	n, err := RenderTokens(&buf, toks)
+	if err != nil || n != int64(buf.Len()) || buf.String() != `a b url("x") "s" 1px` {
+		t.Errorf("RenderTokens = %d, %v: %q", n, err, buf.String())
+	}
+
+	w := &limitWriter{n: 7}
+	n, err = RenderTokens(w, toks)
+	if err != io.ErrShortWrite || n != 7 {
+		t.Errorf("RenderTokens to failing writer = %d, %v", n, err)
+	}
+	if w.writes != 5 {
+		t.Errorf("RenderTokens kept writing after an error: %d writes", w.writes)
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	for _, src := range []string{
+		`:root{--brand:#f00;--gap:calc(1rem + 2px)}a{color:var(--brand);margin:var(--gap,4px)}`,
+		`.btn{--bs-btn-padding-x:0.75rem;padding:var(--bs-btn-padding-y) var(--bs-btn-padding-x)}`,
+		`@media (min-width:640px) and (max-width:1024px){.sm\3A flex{display:flex}}`,
+		`div{width:calc(100% - var(--sidebar-width));--x:-1;--y:--z}`,
+		`a{--empty:;--fn:--my-fn(1)}`,
+	} {
+		for _, level := range []SyntaxLevel{SyntaxLevel3, SyntaxLevel4} {
+			d := NewDocumentLevel([]byte(src), level)
+			toks := d.Tokens()
+			var buf bytes.Buffer
+			RenderTokens(&buf, toks)
+			if buf.String() != src {
+				t.Errorf("level %d: rendering %q gave %q", level, src, buf.String())
+			}
+			again := NewDocumentLevel(buf.Bytes(), level).Tokens()
+			if !TokensEqual(again, toks) {
+				t.Errorf("level %d: %q did not re-tokenize to the same tokens", level, src)
+			}
+		}
+	}
+
+	// Adjacent tokens that would merge still get a separator
+	toks := []Token{
+		{Type: TokenIdent, Value: "and"},
+		{Type: TokenOpenParen, Value: "("},
+		{Type: TokenIdent, Value: "x"},
+		{Type: TokenCloseParen, Value: ")"},
+	}
+	var buf bytes.Buffer
+	RenderTokens(&buf, toks)
+	if buf.String() != "and/**/(x)" {
+		t.Errorf("ident before paren: got %q", buf.String())
+	}
+	if got := NewDocument(buf.Bytes()).Tokens(); got[0].Type != TokenIdent {
+		t.Errorf("ident before paren re-tokenized as %v", got[0])
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	toks, _ := TokenizeAll([]byte("a\\ b @m #1\\ a #x 1e3 1\\65x 1% 'q\"\\\n' url(\"(x\") "+
+		"U+1-2 /*c*/ f( \\\n \"bad\n url(a\"b) url(x y\" ) ~= |= -->"), nil)
+	prefix := []byte("prefix:")
+	for _, tok := range toks {
+		var buf bytes.Buffer
+		tok.WriteTo(&buf)
+		got := tok.AppendTo(prefix[:len(prefix):len(prefix)])
+		if string(got) != string(prefix)+buf.String() {
+			t.Errorf("%v: AppendTo gave %q, WriteTo gave %q", tok, got, buf.String())
+		}
+		if tok.Render() != buf.String() {
+			t.Errorf("%v: Render gave %q, WriteTo gave %q", tok, tok.Render(), buf.String())
+		}
+	}
+}
+
+func TestEncodeTokens(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"a { b: c }",
+		"#a #1 1.5em 10% 3 U+0-7F U+???  U+FF-10FFFF",
+		"\"bad\n url(a b) \\\n /* c */ <!-- -->",
+		string(loadBootstrap(t)),
+	} {
+		toks, _ := TokenizeAll([]byte(src), nil)
+		enc := EncodeTokens(toks)
+		got, err := DecodeTokens(enc)
+		if err != nil {
+			t.Errorf("DecodeTokens(EncodeTokens(%.20q)): %v", src, err)
+			continue
+		}
+		if !TokensEqual(got, toks) {
+			t.Errorf("DecodeTokens(EncodeTokens(%.20q)) differs", src)
+		}
+		for i := range toks {
+			if pe := tokenParseError(toks[i]); pe != nil && tokenParseError(got[i]).Loc != pe.Loc {
+				t.Errorf("%.20q: token %d: Loc not preserved", src, i)
+			}
+		}
+		for i := 0; i < len(enc) && i < 200; i++ {
+			if _, err := DecodeTokens(enc[:i]); err != ErrBadEncoding {
+				t.Errorf("%.20q: truncated to %d bytes: got %v", src, i, err)
+			}
+		}
+	}
+
+	// Extra data of the wrong type, or missing, is dropped
+	odd := []Token{
+		{Type: TokenHash, Value: "a"},
+		{Type: TokenNumber, Value: "1", Extra: &TokenExtraHash{}},
+		{Type: TokenIdent, Value: "a", Extra: &TokenExtraHash{}},
+	}
+	got, err := DecodeTokens(EncodeTokens(odd))
+	if err != nil || len(got) != 3 || got[0].Extra != nil || got[1].Extra != nil || got[2].Extra != nil {
+		t.Errorf("mismatched Extra: got %v, %v", got, err)
+	}
+
+	if _, err := DecodeTokens(append([]byte("CSSTOK\x01"), 0)); err != ErrBadEncoding {
+		t.Errorf("wrong version: got %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fp := func(s string) [32]byte {
+		h, err := Fingerprint(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("Fingerprint(%q): %v", s, err)
+		}
+		return h
+	}
+	for _, group := range [][]string{
+		{
+			"a{color:red;margin:0 auto}",
+			"a { color: red; margin: 0 auto }",
+			"/* header */\n\na {\r\n  color: red;\n  margin: 0   auto\n}\n",
+			"\\61{col\\6f r:r\\65 d;margin:0 auto}",
+		},
+		{
+			`a { content: "x"; background: url(a.png) }`,
+			`a{content:'x';background:url( "a.png" )}`,
+		},
+		{"a b {}"},
+		{"a :hover {}"},
+		{"a:hover {}"},
+		{"a { margin : 0 }", "a{margin:0}", "a {\n  margin:\n    0\n}"},
+		{"a, b {}", "a ,b{}"},
+	} {
+		want := fp(group[0])
+		for _, s := range group[1:] {
+			if fp(s) != want {
+				t.Errorf("Fingerprint(%q) != Fingerprint(%q)", s, group[0])
+			}
+		}
+	}
+	for _, pair := range [][2]string{
+		{"a b {}", "a/**/b {}"},
+		{"a :hover {}", "a:hover {}"},
+		{"a: hover {}", "a:hover {}"},
+		{".a:not(.b) .c {}", ".a:not(.b).c {}"},
+		{"div :first-child {}", "div:first-child {}"},
+		{"div :is(.x) {}", "div:is(.x) {}"},
+		{"a { b :hover {} }", "a { b:hover {} }"},
+		{"a { b: hover {} }", "a { b:hover {} }"},
+		{"a { margin: 0 auto }", "a { margin: 0auto }"},
+		{`a { content: "x" }`, `a { content: x }`},
+	} {
+		if fp(pair[0]) == fp(pair[1]) {
+			t.Errorf("Fingerprint(%q) == Fingerprint(%q)", pair[0], pair[1])
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	long := strings.Repeat("a", 100000)
+	for _, tc := range []struct {
+		name  string
+		input string
+		setup func(z *Tokenizer)
+		ntoks int // tokens returned before the error, or -1 for no error
+	}{
+		{"input size ok", "a { b: c }", func(z *Tokenizer) { z.MaxInputSize = 10 }, -1},
+		{"input size", "a { b: c; }", func(z *Tokenizer) { z.MaxInputSize = 10 }, 10},
+		{"token length ok", "abcd efgh", func(z *Tokenizer) { z.MaxTokenLength = 4 }, -1},
+		{"token length", "abcd efghi", func(z *Tokenizer) { z.MaxTokenLength = 4 }, 2},
+		{"token length mid-input", "abcd efghi j", func(z *Tokenizer) { z.MaxTokenLength = 4 }, 2},
+		{"long string", `"` + long + `"`, func(z *Tokenizer) { z.MaxTokenLength = 1000 }, 0},
+		{"long comment", `/*` + long + `*/`, func(z *Tokenizer) { z.MaxTokenLength = 1000 }, 0},
+		{"long url", `a url(` + long + `)`, func(z *Tokenizer) { z.MaxTokenLength = 1000 }, 2},
+		{"long whitespace", "a" + strings.Repeat(" ", 5000), func(z *Tokenizer) { z.MaxTokenLength = 1000 }, 1},
+		{"nesting ok", "a{b:f((1))}c{}", func(z *Tokenizer) { z.MaxNestingDepth = 3 }, -1},
+		{"nesting", "a{b:f(([1]))}", func(z *Tokenizer) { z.MaxNestingDepth = 3 }, 6},
+		{"deep parens", strings.Repeat("(", 100000), func(z *Tokenizer) { z.MaxNestingDepth = 100 }, 100},
+	} {
+		z := NewTokenizer(strings.NewReader(tc.input))
+		tc.setup(z)
+		n := 0
+		var tok Token
+		for tok = z.Next(); tok.Type != TokenEOF && tok.Type != TokenError; tok = z.Next() {
+			n++
+		}
+		if tc.ntoks == -1 {
+			if tok.Type != TokenEOF {
+				t.Errorf("%s: unexpected error %v", tc.name, z.Err())
+			}
+			continue
+		}
+		if tok.Type != TokenError || z.Err() != ErrLimitExceeded {
+			t.Errorf("%s: got %v after %d tokens, want ErrLimitExceeded", tc.name, tok, n)
+		} else if n != tc.ntoks {
+			t.Errorf("%s: got %d tokens before the error, want %d", tc.name, n, tc.ntoks)
+		}
+		if tok := z.Next(); tok.Type != TokenError {
+			t.Errorf("%s: tokenizer continued after the error: %v", tc.name, tok)
+		}
+	}
+}
+
+func TestErrorModeFatal(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		ntoks int
+		tt    TokenType
+		loc   int
+	}{
+		{"a \"b\nc", 2, TokenBadString, 2},
+		{"a url(b c) d", 2, TokenBadURI, 2},
+		{"a \\\nb", 2, TokenBadEscape, 2},
+	} {
+		z := NewTokenizer(strings.NewReader(tc.input))
+		z.ErrorMode = ErrorModeFatal
+		n := 0
+		var tok Token
+		for tok = z.Next(); tok.Type != TokenEOF && tok.Type != TokenError; tok = z.Next() {
+			n++
+		}
+		pe, ok := z.Err().(*ParseError)
+		if tok.Type != TokenError || !ok {
+			t.Errorf("%q: got %v, err %v; want a ParseError", tc.input, tok, z.Err())
+			continue
+		}
+		if n != tc.ntoks || pe.Type != tc.tt || pe.Loc != tc.loc {
+			t.Errorf("%q: got %d tokens then %v at %d, want %d tokens then %v at %d",
+				tc.input, n, pe.Type, pe.Loc, tc.ntoks, tc.tt, tc.loc)
+		}
+		if tok := z.Next(); tok.Type != TokenError {
+			t.Errorf("%q: tokenizer continued after a fatal error: %v", tc.input, tok)
+		}
+
+		// the default mode keeps going
+		z = NewTokenizer(strings.NewReader(tc.input))
+		for tok = z.Next(); tok.Type != TokenEOF && tok.Type != TokenError; tok = z.Next() {
+		}
+		if tok.Type != TokenEOF {
+			t.Errorf("%q: default error mode stopped with %v", tc.input, tok)
+		}
+	}
+}
+
+func TestDropCDOCDC(t *testing.T) {
+	z := NewTokenizer(strings.NewReader("<!--a{}--><!----> -->b"))
+	z.DropCDOCDC = true
+	var got []string
+	for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+		got = append(got, tok.Value)
+	}
+	if want := []string{"a", "{", "}", " ", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DropCDOCDC: got %q, want %q", got, want)
+	}
+}
+
+func TestIntern(t *testing.T) {
+	intern := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		z := NewTokenizer(strings.NewReader(".foo-bar{color:blue}/* a comment */\n \n" +
+			".a-class-name-longer-than-the-limit{content:'a string that is longer than the limit'}"))
+		z.Intern = intern
+		for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+		}
+	}
+	// "color" and the punctuation come from the atom table
+	// comments and whitespace are not added, and other values only if they
+	// are short
+	want := map[string]string{
+		"foo-bar": "foo-bar", "blue": "blue",
+		"a-class-name-longer-than-the-limit": "a-class-name-longer-than-the-limit",
+	}
+	if !reflect.DeepEqual(intern, want) {
+		t.Errorf("Intern: got %q, want %q", intern, want)
+	}
+}
+
+func TestSerializeCSSOM(t *testing.T) {
+	// from web-platform-tests cssom/escape.html and
+	// cssom/serialize-values.html
+	for _, tc := range []struct{ in, want string }{
+		{"\x00", "�"},
+		{"a\x00", "a�"},
+		{"\x00b", "�b"},
+		{"a\x00b", "a�b"},
+		{"�", "�"},
+		{"a�", "a�"},
+		{"0a", `\30 a`},
+		{"1a", `\31 a`},
+		{"2a", `\32 a`},
+		{"9a", `\39 a`},
+		{"a0b", "a0b"},
+		{"a1b", "a1b"},
+		{"-0a", `-\30 a`},
+		{"-1a", `-\31 a`},
+		{"-9a", `-\39 a`},
+		{"--a", "--a"},
+		{"\x01\x02\x1E\x1F", `\1 \2 \1e \1f `},
+		{"\u0080\x2D\x5F©", "\u0080\x2D\x5F©"},
+		{"\x7F\u0080\u0081", `\7f ` + "\u0080\u0081"},
+		{" ¡¢", " ¡¢"},
+		{"a0123456789b", "a0123456789b"},
+		{"abcdefghijklmnopqrstuvwxyz", "abcdefghijklmnopqrstuvwxyz"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZ", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+		{"\x20\x21\x78\x79", `\ \!xy`},
+		{"\U0001D306", "\U0001D306"},
+		{"-", `\-`},
+		{"-a", "-a"},
+		{"--", "--"},
+		// invalid UTF-8
+		{"a\xffb", "a�b"},
+	} {
+		if got := SerializeIdentifierCSSOM(tc.in); got != tc.want {
+			t.Errorf("SerializeIdentifierCSSOM(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	for _, tc := range []struct{ in, want string }{
+		{"", `""`},
+		{"a", `"a"`},
+		{`"'\`, `"\"'\\"`},
+		{"\x00\x01\n\x7F\u0080", `"` + "�" + `\1 \a \7f ` + "\u0080" + `"`},
+	} {
+		if got := SerializeStringCSSOM(tc.in); got != tc.want {
+			t.Errorf("SerializeStringCSSOM(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	if got, want := SerializeURLCSSOM(`a b")`), `url("a b\")")`; got != want {
+		t.Errorf("SerializeURLCSSOM: got %q, want %q", got, want)
+	}
+}
+
+func TestTokenRendererState(t *testing.T) {
+	ident := Token{Type: TokenIdent, Value: "a"}
+	render := func(r *TokenRenderer, t Token) string {
+		var buf bytes.Buffer
+		r.WriteTokenTo(&buf, t)
+		return buf.String()
+	}
+
+	r := NewTokenRenderer(ident)
+	if got := render(r, ident); got != "/**/a" {
+		t.Errorf("after context token: got %q", got)
+	}
+	if got := r.LastToken(); got != ident {
+		t.Errorf("LastToken: got %v", got)
+	}
+	r.SpaceSeparator = true
+	r.Reset()
+	if got := r.LastToken(); got != (Token{}) {
+		t.Errorf("LastToken after Reset: got %v", got)
+	}
+	if got := render(r, ident); got != "a" {
+		t.Errorf("after Reset: got %q", got)
+	}
+	if got := render(r, ident); got != " a" {
+		t.Errorf("options after Reset: got %q", got)
+	}
+}
+
+func TestTokenRaw(t *testing.T) {
+	toks := []Token{
+		NewIdent("a"),
+		NewRaw("{{ . }}"),
+		NewIdent("b"),
+		Token{Type: TokenColon, Value: ":"},
+		NewRaw(`"\\"`),
+	}
+	var buf bytes.Buffer
+	if _, err := RenderTokens(&buf, toks); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), `a{{ . }}b:"\\"`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := toks[1].Type.String(); got != "RAW" {
+		t.Errorf("TokenRaw.String() = %q", got)
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	src := ".{{ .Name }}-x{color:{{.C}}%s;width:1%s} {{unclosed"
+	z := NewTokenizer(strings.NewReader(src))
+	z.Placeholders = []Placeholder{{Open: "{{", Close: "}}"}, {Open: "%s"}}
+	var got []Token
+	for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+		got = append(got, tok)
+	}
+	want := []Token{
+		{Type: TokenDelim, Value: "."},
+		{Type: TokenPlaceholder, Value: "{{ .Name }}"},
+		{Type: TokenIdent, Value: "-x"},
+		{Type: TokenOpenBrace, Value: "{"},
+		{Type: TokenIdent, Value: "color"},
+		{Type: TokenColon, Value: ":"},
+		{Type: TokenPlaceholder, Value: "{{.C}}"},
+		{Type: TokenPlaceholder, Value: "%s"},
+		{Type: TokenSemicolon, Value: ";"},
+		{Type: TokenIdent, Value: "width"},
+		{Type: TokenColon, Value: ":"},
+		// the percent sign is part of the number
+		{Type: TokenPercentage, Value: "1", Extra: &TokenExtraNumeric{}},
+		{Type: TokenIdent, Value: "s"},
+		{Type: TokenCloseBrace, Value: "}"},
+		{Type: TokenS, Value: " "},
+		{Type: TokenPlaceholder, Value: "{{unclosed"},
+	}
+	if !TokensEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+	var buf bytes.Buffer
+	RenderTokens(&buf, got)
+	if buf.String() != src {
+		t.Errorf("rendered as %q", buf.String())
+	}
+}
+
+func TestDialect(t *testing.T) {
+	for _, tc := range []struct {
+		dialect Dialect
+		src     string
+		want    []Token
+	}{
+		{DialectSCSS, "$a-b:1px;// c\n.x-#{$a}{}[a$=b]", []Token{
+			{Type: TokenVariable, Value: "a-b"},
+			{Type: TokenColon, Value: ":"},
+			{Type: TokenDimension, Value: "1", Extra: &TokenExtraNumeric{Dimension: "px"}},
+			{Type: TokenSemicolon, Value: ";"},
+			{Type: TokenLineComment, Value: " c"},
+			{Type: TokenS, Value: "\n"},
+			{Type: TokenDelim, Value: "."},
+			{Type: TokenIdent, Value: "x-"},
+			{Type: TokenInterpolation, Value: "#{$a}"},
+			{Type: TokenOpenBrace, Value: "{"},
+			{Type: TokenCloseBrace, Value: "}"},
+			{Type: TokenOpenBracket, Value: "["},
+			{Type: TokenIdent, Value: "a"},
+			{Type: TokenSuffixMatch, Value: "$="},
+			{Type: TokenIdent, Value: "b"},
+			{Type: TokenCloseBracket, Value: "]"},
+		}},
+		{DialectSCSS, "#{a{b}c", []Token{
+			{Type: TokenInterpolation, Value: "#{a{b}c"},
+		}},
+		{DialectLess, "@a:url(//x);.@{a}{} //", []Token{
+			{Type: TokenAtKeyword, Value: "a"},
+			{Type: TokenColon, Value: ":"},
+			{Type: TokenURI, Value: "//x"},
+			{Type: TokenSemicolon, Value: ";"},
+			{Type: TokenDelim, Value: "."},
+			{Type: TokenInterpolation, Value: "@{a}"},
+			{Type: TokenOpenBrace, Value: "{"},
+			{Type: TokenCloseBrace, Value: "}"},
+			{Type: TokenS, Value: " "},
+			{Type: TokenLineComment, Value: ""},
+		}},
+		{DialectCSS, "$a//b", []Token{
+			{Type: TokenDelim, Value: "$"},
+			{Type: TokenIdent, Value: "a"},
+			{Type: TokenDelim, Value: "/"},
+			{Type: TokenDelim, Value: "/"},
+			{Type: TokenIdent, Value: "b"},
+		}},
+	} {
+		z := NewTokenizer(strings.NewReader(tc.src))
+		z.Dialect = tc.dialect
+		var got []Token
+		for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+			got = append(got, tok)
+		}
+		if !TokensEqual(got, tc.want) {
+			t.Errorf("%q:\ngot  %v\nwant %v", tc.src, got, tc.want)
+		}
+	}
+
+	// a line comment must be ended even if the newline was dropped
+	toks := []Token{
+		{Type: TokenVariable, Value: "a"},
+		{Type: TokenIdent, Value: "b"},
+		{Type: TokenLineComment, Value: " c"},
+		{Type: TokenIdent, Value: "d"},
+	}
+	var buf bytes.Buffer
+	RenderTokens(&buf, toks)
+	if got, want := buf.String(), "$a/**/b// c\nd"; got != want {
+		t.Errorf("rendered as %q, want %q", got, want)
+	}
+}
+
+func TestTokenWriter(t *testing.T) {
+	var out, copied bytes.Buffer
+	var count int
+	upper := NewFilterWriter(NewRenderWriter(&out), func(t Token) []Token {
+		if t.Type == TokenIdent {
+			t.Value = strings.ToUpper(t.Value)
+		}
+		if t.Type == TokenComment {
+			return nil
+		}
+		return []Token{t}
+	})
+	counter := TokenWriterFunc(func(Token) error { count++; return nil })
+	w := MultiTokenWriter(upper, counter, NewRenderWriter(&copied))
+	src := "a/**/b { c: d }"
+	if err := CopyTokens(w, NewTokenizer(strings.NewReader(src))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "A/**/B { C: D }"; got != want {
+		t.Errorf("filtered: got %q, want %q", got, want)
+	}
+	if got := copied.String(); got != src {
+		t.Errorf("tee: got %q, want %q", got, src)
+	}
+	if count != 12 {
+		t.Errorf("tee: counted %d tokens, want 12", count)
+	}
+
+	err := CopyTokens(NewRenderWriter(&limitWriter{n: 3}), NewTokenizer(strings.NewReader(src)))
+	if err != io.ErrShortWrite {
+		t.Errorf("write error: got %v", err)
+	}
+}
+
+func TestParseErrorCodes(t *testing.T) {
+	for _, tc := range []struct {
+		input      string
+		code       ErrorCode
+		target     *ParseError
+		start, end int
+	}{
+		{"a \\\n", CodeBadEscape, ErrBadEscape, 2, 3},
+		{"a \"bc\n", CodeUnterminatedString, ErrUnterminatedString, 2, 5},
+		{"url('a\n)", CodeUnterminatedURLString, ErrBadURL, 0, 8},
+		{"url('a' b)", CodeURLMissingParen, ErrBadURL, 0, 10},
+		{"url(a b) c", CodeURLWhitespace, ErrBadURL, 0, 8},
+		{"url(a'b)", CodeURLIllegalCharacter, ErrBadURL, 0, 8},
+		{"url(a\x01)", CodeURLIllegalCharacter, ErrBadURL, 0, 7},
+		{"url(a\\\n)", CodeURLBadEscape, ErrBadURL, 0, 8},
+	} {
+		_, diags := TokenizeAll([]byte(tc.input), nil)
+		if len(diags) != 1 {
+			t.Errorf("%q: got %d diagnostics", tc.input, len(diags))
+			continue
+		}
+		pe := diags[0].Err
+		if pe.Code != tc.code || pe.Loc != tc.start || pe.End != tc.end {
+			t.Errorf("%q: got %v at %d-%d, want %v at %d-%d", tc.input, pe.Code, pe.Loc, pe.End, tc.code, tc.start, tc.end)
+		}
+		if !pe.Is(tc.target) {
+			t.Errorf("%q: %v is not %v", tc.input, pe.Code, tc.target.Code)
+		}
+		if pe.Is(ErrBadEscape) != (tc.code == CodeBadEscape) {
+			t.Errorf("%q: Is(ErrBadEscape) is wrong", tc.input)
+		}
+		if pe.Token.Type != pe.Type {
+			t.Errorf("%q: ParseError.Token is %v", tc.input, pe.Token)
+		}
+	}
+	var e error = &TokenExtraError{Err: ErrBadURL}
+	if u, ok := e.(interface {
+		Unwrap() error
+	}); !ok || u.Unwrap() != error(ErrBadURL) {
+		t.Errorf("TokenExtraError does not unwrap")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var buf bytes.Buffer
+	z := NewTokenizer(strings.NewReader("a 1px"))
+	z.Trace = &buf
+	for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+	}
+	for _, want := range []string{
+		"scan at offset 0\n",
+		"dispatch on 'a'\n",
+		"state: ident-like\n",
+		"return {IDENT a <nil>}\n",
+		"scan at offset 2\n",
+		"state: numeric\n",
+		"  consume 'p'\n",
+		"return {EOF  <nil>}\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("trace is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestNumericValues(t *testing.T) {
+	for _, tc := range []struct {
+		src   string
+		f     float64
+		fok   bool
+		pct   float64
+		pctok bool
+		i     int64
+		iok   bool
+	}{
+		{"42", 42, true, 0, false, 42, true},
+		{"+42", 42, true, 0, false, 42, true},
+		{"-7px", -7, true, 0, false, -7, true},
+		{"50%", 50, true, 0.5, true, 50, true},
+		{"12.5%", 12.5, true, 0.125, true, 0, false},
+		{".5", 0.5, true, 0, false, 0, false},
+		{"1e3", 1000, true, 0, false, 0, false},
+		{"-.25e-2", -0.0025, true, 0, false, 0, false},
+		{"99999999999999999999", 1e20, true, 0, false, 0, false},
+		{"1e999", math.Inf(1), true, 0, false, 0, false},
+		{"abc", 0, false, 0, false, 0, false},
+	} {
+		toks, _ := TokenizeAll([]byte(tc.src), nil)
+		tok := toks[0]
+		if f, ok := tok.Float(); f != tc.f || ok != tc.fok {
+			t.Errorf("Float(%s) = %v, %v", tc.src, f, ok)
+		}
+		if f, ok := tok.Percentage(); f != tc.pct || ok != tc.pctok {
+			t.Errorf("Percentage(%s) = %v, %v", tc.src, f, ok)
+		}
+		if i, ok := tok.Int(); i != tc.i || ok != tc.iok {
+			t.Errorf("Int(%s) = %v, %v", tc.src, i, ok)
+		}
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	for _, tc := range []struct {
+		tok Token
+		src string
+	}{
+		{NewIdent("color"), "color"},
+		{NewIdent("1x"), `\31 x`},
+		{NewFunction("rgb"), "rgb("},
+		{NewAtKeyword("media"), "@media"},
+		{NewHash("fff"), "#fff"},
+		{NewHash("123"), "#123"},
+		{NewHash("-1"), "#-1"},
+		{NewHash("a b"), `#a\20 b`},
+		{NewString(`a"b`), `"a\"b"`},
+		{NewURL("a b.png"), `url("a b.png")`},
+		{NewDelim('.'), "."},
+		{NewNumber(42), "42"},
+		{NewNumber(-0.5), "-0.5"},
+		{NewNumber(1e21), "1e+21"},
+		{NewNumber(1e-7), "1e-07"},
+		{NewPercentage(50), "50%"},
+		{NewDimension(1.5, "px"), "1.5px"},
+		{NewDimension(2, "e3"), `2\65 3`},
+		{NewDimension(2, "e-3"), `2\65 -3`},
+		{NewDimension(2, "em"), "2em"},
+		{NewDimension(2, "e-x"), "2e-x"},
+	} {
+		// the token must render to source that tokenizes back into itself
+		src := tc.tok.Render()
+		got, _ := TokenizeAll([]byte(src), nil)
+		if len(got) != 1 || !got[0].Equal(tc.tok) {
+			t.Errorf("%v rendered as %q, which tokenizes as %v", tc.tok, src, got)
+		}
+		if src != tc.src {
+			t.Errorf("%v rendered as %q, want %q", tc.tok, src, tc.src)
+		}
+	}
+
+	for _, fn := range []func(){
+		func() { NewIdent("") },
+		func() { NewHash("") },
+		func() { NewDimension(1, "") },
+		func() { NewNumber(math.Inf(1)) },
+		func() { NewPercentage(math.NaN()) },
+		func() { NewDelim(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("constructor did not panic")
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestAttachTrivia(t *testing.T) {
+	src := "/* head */\na { /* c */ color: red; /* same line */\n  /* next */ b: c }\n/* tail */\n"
+	toks, _ := TokenizeAll([]byte(src), nil)
+	tts := AttachTrivia(toks)
+
+	describe := func(toks []Token) string {
+		var buf bytes.Buffer
+		RenderTokens(&buf, toks)
+		return buf.String()
+	}
+	want := []struct{ leading, tok, trailing string }{
+		{"/* head */\n", "a", " "},
+		{"", "{", " /* c */ "},
+		{"", "color", ""},
+		{"", ":", " "},
+		{"", "red", ""},
+		{"", ";", " /* same line */\n"},
+		{"  /* next */ ", "b", ""},
+		{"", ":", " "},
+		{"", "c", " "},
+		{"", "}", "\n"},
+		{"/* tail */\n", "", ""},
+	}
+	if len(tts) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tts), len(want))
+	}
+	for i, tt := range tts {
+		got := [3]string{describe(tt.Leading), tt.Token.Render(), describe(tt.Trailing)}
+		if w := [3]string{want[i].leading, want[i].tok, want[i].trailing}; got != w {
+			t.Errorf("token %d: got %q, want %q", i, got, w)
+		}
+	}
+	if tts[len(tts)-1].Type != TokenEOF {
+		t.Errorf("last token is %v, want EOF", tts[len(tts)-1])
+	}
+
+	if got := describe(DetachTrivia(tts)); got != src {
+		t.Errorf("DetachTrivia: got %q", got)
+	}
+	if got := AttachTrivia(nil); len(got) != 1 || got[0].Type != TokenEOF {
+		t.Errorf("AttachTrivia(nil) = %v", got)
+	}
+}
+
+func TestTokenizerBufio(t *testing.T) {
+	const src = "a{b:(c}</style>X<style>d)}\"e\n</style>"
+	br := bufio.NewReader(strings.NewReader(src))
+	tokenizeStyle := func(z *Tokenizer) []Token {
+		var toks []Token
+		for {
+			if next, _ := br.Peek(len("</style>")); string(next) == "</style>" {
+				return toks
+			}
+			tok := z.Next()
+			if tok.Type == TokenEOF || tok.Type == TokenError {
+				return toks
+			}
+			toks = append(toks, tok)
+		}
+	}
+
+	z := NewTokenizerBufio(br)
+	z.MaxNestingDepth = 10
+	if got := tokenizeStyle(z); len(got) != 7 {
+		t.Errorf("first chunk: got %v", got)
+	}
+	rest, _ := br.Peek(br.Buffered())
+	if !strings.HasPrefix(string(rest), "</style>X") {
+		t.Fatalf("tokenizer read past the end of the chunk: %q left", rest)
+	}
+	st := z.Save()
+	if st.Offset != 7 || st.Depth != 1 {
+		t.Errorf("Save() = %+v", st)
+	}
+
+	skip := len("</style>X<style>")
+	br.Discard(skip)
+	st.Offset += int64(skip)
+	z = NewTokenizerBufio(br)
+	z.Restore(st)
+	z.MaxNestingDepth = 10
+	z.ErrorMode = ErrorModeFatal
+	if got := tokenizeStyle(z); len(got) != 3 {
+		t.Errorf("second chunk: got %v", got)
+	}
+	pe, ok := z.Err().(*ParseError)
+	if !ok || pe.Loc != 26 {
+		t.Errorf("error %#v, want Loc 26", z.Err())
+	}
+}
+
+func TestReplacements(t *testing.T) {
+	src := "a\x00b \\0 \"\\d800\" \r\n\\110000 url(\\\xff) \x00\\"
+	z := NewTokenizer(strings.NewReader(src))
+	z.Next()
+	// the NUL at 1 is inside the first identifier
+	if got := z.Replacements(); !reflect.DeepEqual(got, []Replacement{{1, ReplacedNUL}}) {
+		t.Errorf("after first token: got %v", got)
+	}
+	for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+	}
+	want := []Replacement{
+		{1, ReplacedNUL},
+		{4, ReplacedEscape},
+		{8, ReplacedEscape},
+		{17, ReplacedEscape},
+		{29, ReplacedEscape},
+		{33, ReplacedNUL},
+		{34, ReplacedEscape},
+	}
+	if got := z.Replacements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+
+	z = NewTokenizer(strings.NewReader("a { b: c }"))
+	for tok := z.Next(); tok.Type != TokenEOF; tok = z.Next() {
+	}
+	if got := z.Replacements(); len(got) != 0 {
+		t.Errorf("clean input: got %v", got)
+	}
+}
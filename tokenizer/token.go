@@ -6,10 +6,10 @@
 package tokenizer
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
@@ -31,9 +31,17 @@ func (t TokenType) StopToken() bool {
 
 // ParseError represents a CSS syntax error.
 type ParseError struct {
-	Type    TokenType
+	Type TokenType
+	// Machine-readable kind of error.  Programs should check this (or use
+	// the Is method) instead of matching Message.
+	Code    ErrorCode
 	Message string
-	Loc     int
+	// Byte offset in the input of the start of the offending token.
+	Loc int
+	// Byte offset in the input just past the end of the offending token.
+	End int
+	// The offending token.
+	Token Token
 }
 
 // implements error
@@ -41,6 +49,21 @@ func (e *ParseError) Error() string {
 	return e.Message
 }
 
+// Is reports whether e is the same kind of error as target, for use with
+// errors.Is.  A target with a Code matches errors with that Code, such as
+// ErrUnterminatedString; a target without one matches all errors of its Type,
+// such as ErrBadURL.
+func (e *ParseError) Is(target error) bool {
+	t, ok := target.(*ParseError)
+	if !ok || t == nil {
+		return false
+	}
+	if t.Code != 0 {
+		return e.Code == t.Code
+	}
+	return e.Type == t.Type
+}
+
 // Token represents a token in the CSS syntax.
 type Token struct {
 	Type TokenType
@@ -103,6 +126,29 @@ const (
 	TokenCloseBrace
 	TokenCDO
 	TokenCDC
+
+	// TokenRaw is never produced by the tokenizer.  Its Value is written
+	// out verbatim when rendered, for splicing pre-rendered CSS into a
+	// token stream.  No separators are inserted before or after it, so the
+	// fragment must be safe to place next to its neighbours.
+	TokenRaw
+	// TokenPlaceholder is a template placeholder, returned only when the
+	// Tokenizer's Placeholders option is set.  Its Value is the placeholder
+	// text including the markers, and it is rendered verbatim.
+	TokenPlaceholder
+
+	// Preprocessor tokens, returned only when the Tokenizer's Dialect option
+	// is set.
+	//
+	// TokenVariable is a SCSS variable; its Value is the name without the
+	// '$'.
+	TokenVariable
+	// TokenInterpolation is a SCSS "#{...}" or Less "@{...}" interpolation.
+	// Its Value is the whole interpolation, which is rendered verbatim.
+	TokenInterpolation
+	// TokenLineComment is a "//" comment.  Its Value is the text after the
+	// slashes, up to but not including the end of the line.
+	TokenLineComment
 )
 
 // backwards compatibility
@@ -145,6 +191,11 @@ var tokenNames = map[TokenType]string{
 	TokenCloseParen:     "RIGHT-PAREN",
 	TokenOpenBrace:      "LEFT-BRACE", // {}
 	TokenCloseBrace:     "RIGHT-BRACE",
+	TokenRaw:            "RAW",
+	TokenPlaceholder:    "PLACEHOLDER",
+	TokenVariable:       "VARIABLE",
+	TokenInterpolation:  "INTERPOLATION",
+	TokenLineComment:    "LINE-COMMENT",
 }
 
 // TokenExtra fills the .Extra field of a token.  Consumers should perform a
@@ -187,6 +238,18 @@ type TokenExtraNumeric struct {
 	// Value float64 // omitted from this implementation
 	NonInteger bool
 	Dimension  string
+
+	// How the number was written.  The token's Value keeps the number
+	// exactly as written; these record the parts of it that do not affect
+	// the value, so that consumers can choose to keep or drop them.
+
+	// Exponent is set if the number used scientific notation ("1e3").
+	Exponent bool
+	// PlusSign is set if the number began with an explicit '+'.
+	PlusSign bool
+	// LeadingDot is set if the number had no digits before the decimal
+	// point (".5").
+	LeadingDot bool
 }
 
 // Returns the Dimension field.
@@ -237,6 +300,11 @@ func (e *TokenExtraError) Cause() error {
 	return e.Err
 }
 
+// Unwrap returns Err, for use with errors.Is and errors.As.
+func (e *TokenExtraError) Unwrap() error {
+	return e.Err
+}
+
 // Returns the ParseError object, if present.
 func (e *TokenExtraError) ParseError() *ParseError {
 	pe, ok := e.Err.(*ParseError)
@@ -250,6 +318,12 @@ func escapeIdentifier(s string) string { return escapeIdent(s, 0) }
 func escapeHashName(s string) string   { return escapeIdent(s, 1) }
 func escapeDimension(s string) string  { return escapeIdent(s, 2) }
 
+// Modes for escapeIdent: 0 is an identifier, 1 the name of an unrestricted
+// hash, 2 the unit of a dimension, and 3 an identifier that may begin with
+// two dashes, like a custom property name.  Mode 3 is used when rendering
+// tokens, so that "--x" is written as-is; the Level 3 tokenizer reads it
+// back as a '-' delim and a "-x" identifier, which renders the same way.
+
 func needsHexEscaping(c byte, mode int) bool {
 	if c < 0x20 {
 		return true
@@ -257,11 +331,6 @@ func needsHexEscaping(c byte, mode int) bool {
 	if c >= utf8.RuneSelf {
 		return false
 	}
-	if mode == 2 {
-		if c == 'e' || c == 'E' {
-			return true
-		}
-	}
 	if c == '\\' {
 		return true
 	}
@@ -271,47 +340,105 @@ func needsHexEscaping(c byte, mode int) bool {
 	return true
 }
 
+// identNeedsEscaping reports whether escapeIdent would make any changes to s.
+func identNeedsEscaping(s string, mode int) bool {
+	i := 0
+	if mode != 1 {
+		switch {
+		case s[0] == 'e' || s[0] == 'E':
+			if mode == 2 && exponentUnit(s) {
+				return true
+			}
+		case s[0] == '-':
+			if len(s) == 1 || !isNameStart(s[1]) && !leadingDashes(s, mode) {
+				return true
+			}
+		case !isNameStart(s[0]):
+			return true
+		}
+		i = 1
+	}
+	for ; i < len(s); i++ {
+		if !isNameCode(s[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingDashes reports whether s begins with two dashes that mode allows to
+// be written unescaped.  A bare "--" is still escaped, so that it cannot run
+// into a following '>' and become a CDC.
+func leadingDashes(s string, mode int) bool {
+	return mode == 3 && len(s) > 2 && s[1] == '-'
+}
+
+// exponentUnit reports whether the dimension unit s would be read back as
+// the exponent of the number before it, as "e3" would in "1e3".  Its 'e' has
+// to be escaped.  Other units starting with 'e', such as em, are safe.
+func exponentUnit(s string) bool {
+	s = s[1:]
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	return s != "" && '0' <= s[0] && s[0] <= '9'
+}
+
+// appendHexEscape appends c as a hex escape followed by a space.
+func appendHexEscape(dst []byte, c byte) []byte {
+	const hexDigits = "0123456789ABCDEF"
+	dst = append(dst, '\\')
+	if c >= 0x10 {
+		dst = append(dst, hexDigits[c>>4])
+	}
+	return append(dst, hexDigits[c&0xF], ' ')
+}
+
 func escapeIdent(s string, mode int) string {
+	if s == "" || !identNeedsEscaping(s, mode) {
+		return s
+	}
+	return string(appendIdent(make([]byte, 0, len(s)+4), s, mode))
+}
+
+// appendIdent appends s to dst, escaped as by escapeIdent.
+func appendIdent(dst []byte, s string, mode int) []byte {
 	if s == "" {
-		return ""
+		return dst
+	}
+	if !identNeedsEscaping(s, mode) {
+		return append(dst, s...)
 	}
-	var buf bytes.Buffer
-	buf.Grow(len(s))
-	anyChanges := false
 
 	var i int
 
 	// Handle first character
 	// dashes allowed at start only for TokenIdent-ish
-	// eE not allowed at start for Dimension
+	// e or E starting a dimension unit is escaped if it would be read as an exponent
 	if mode != 1 {
 		if !isNameStart(s[0]) && s[0] != '-' && s[0] != 'e' && s[0] != 'E' {
-			if needsHexEscaping(s[0], mode) {
-				fmt.Fprintf(&buf, "\\%X ", s[0])
-				anyChanges = true
+			// a digit after a backslash would be read as a hex escape
+			if needsHexEscaping(s[0], mode) || isHexDigit(s[0]) {
+				dst = appendHexEscape(dst, s[0])
 			} else {
-				buf.WriteByte('\\')
-				buf.WriteByte(s[0])
-				anyChanges = true
+				dst = append(dst, '\\', s[0])
 			}
 		} else if s[0] == 'e' || s[0] == 'E' {
-			if mode == 2 {
-				fmt.Fprintf(&buf, "\\%X ", s[0])
-				anyChanges = true
+			if mode == 2 && exponentUnit(s) {
+				dst = appendHexEscape(dst, s[0])
 			} else {
-				buf.WriteByte(s[0])
+				dst = append(dst, s[0])
 			}
 		} else if s[0] == '-' {
 			if len(s) == 1 {
-				return "\\-"
-			} else if isNameStart(s[1]) {
-				buf.WriteByte('-')
+				return append(dst, '\\', '-')
+			} else if isNameStart(s[1]) || leadingDashes(s, mode) {
+				dst = append(dst, '-')
 			} else {
-				buf.WriteString("\\-")
-				anyChanges = true
+				dst = append(dst, '\\', '-')
 			}
 		} else {
-			buf.WriteByte(s[0])
+			dst = append(dst, s[0])
 		}
 		i = 1
 	} else {
@@ -320,155 +447,186 @@ func escapeIdent(s string, mode int) string {
 	// Write the rest of the name
 	for ; i < len(s); i++ {
 		if !isNameCode(s[i]) {
-			fmt.Fprintf(&buf, "\\%X ", s[i])
-			anyChanges = true
+			dst = appendHexEscape(dst, s[i])
 		} else {
-			buf.WriteByte(s[i])
+			dst = append(dst, s[i])
 		}
 	}
+	return dst
+}
 
-	if !anyChanges {
-		return s
+// stringNeedsEscaping reports whether escapeString would change any byte of s.
+func stringNeedsEscaping(s string, delim byte) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', delim, '\n', '\r', '\\':
+			return true
+		}
+		if s[i] < utf8.RuneSelf && isNonPrintable(s[i]) {
+			return true
+		}
 	}
-	return buf.String()
+	return false
 }
 
 func escapeString(s string, delim byte) string {
-	var buf bytes.Buffer
+	if !stringNeedsEscaping(s, delim) {
+		if delim == 0 {
+			return s
+		}
+		return string(delim) + s + string(delim)
+	}
+	return string(appendString(make([]byte, 0, len(s)+4), s, delim))
+}
+
+// appendString appends s to dst, escaped and quoted as by escapeString.
+func appendString(dst []byte, s string, delim byte) []byte {
 	if delim != 0 {
-		buf.WriteByte(delim)
+		dst = append(dst, delim)
 	}
-	for i := 0; i < len(s); i++ {
-		switch s[i] {
-		case '"':
-			buf.WriteString("\\\"")
-			continue
-		case delim:
-			buf.WriteByte('\\')
-			buf.WriteByte(delim)
-			continue
-		case '\n':
-			buf.WriteString("\\0A ")
-			continue
-		case '\r':
-			buf.WriteString("\\0D ")
-			continue
-		case '\\':
-			buf.WriteString("\\\\")
-			continue
-		}
-		if s[i] < utf8.RuneSelf && isNonPrintable(s[i]) {
-			fmt.Fprintf(&buf, "\\%X ", s[i])
-			continue
+	if !stringNeedsEscaping(s, delim) {
+		dst = append(dst, s...)
+	} else {
+		for i := 0; i < len(s); i++ {
+			switch s[i] {
+			case '"':
+				dst = append(dst, '\\', '"')
+				continue
+			case delim:
+				dst = append(dst, '\\', delim)
+				continue
+			case '\n':
+				dst = append(dst, "\\0A "...)
+				continue
+			case '\r':
+				dst = append(dst, "\\0D "...)
+				continue
+			case '\\':
+				dst = append(dst, '\\', '\\')
+				continue
+			}
+			if s[i] < utf8.RuneSelf && isNonPrintable(s[i]) {
+				dst = appendHexEscape(dst, s[i])
+				continue
+			}
+			dst = append(dst, s[i])
 		}
-		buf.WriteByte(s[i])
 	}
 	if delim != 0 {
-		buf.WriteByte(delim)
+		dst = append(dst, delim)
 	}
-	return buf.String()
+	return dst
 }
 
 // Return the CSS source representation of the token.  (Wrapper around
-// WriteTo.)
+// AppendTo.)
 func (t *Token) Render() string {
-	var buf bytes.Buffer
-	_, _ = t.WriteTo(&buf)
-	return buf.String()
+	return string(t.AppendTo(nil))
 }
 
+// stickyWriteString writes s to w unless an earlier write has already
+// failed, and records the first error in *err.
 func stickyWriteString(n *int64, err *error, w io.Writer, s string) {
+	if *err != nil {
+		return
+	}
 	n2, err2 := io.WriteString(w, s)
 	*n += int64(n2)
-	if err2 != nil {
-		if *err != nil {
-			*err = err2
-		}
-	}
+	*err = err2
+}
+
+var renderBufPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
 }
 
 // Write the CSS source representation of the token to the provided writer.  If
 // you are attempting to render a series of tokens, see the TokenRenderer type
-// to handle comment insertion rules.
+// to handle comment insertion rules.  (Wrapper around AppendTo.)
 //
 // Tokens with type TokenError do not write anything.
 func (t *Token) WriteTo(w io.Writer) (n int64, err error) {
+	if t.Type == TokenError || t.Type == TokenEOF {
+		return 0, nil
+	}
+	bp := renderBufPool.Get().(*[]byte)
+	*bp = t.AppendTo((*bp)[:0])
+	n2, err := w.Write(*bp)
+	renderBufPool.Put(bp)
+	return int64(n2), err
+}
+
+// AppendTo appends the CSS source representation of the token to dst and
+// returns the extended slice.  It does not allocate unless dst needs to grow.
+//
+// Tokens with type TokenError do not append anything.
+func (t *Token) AppendTo(dst []byte) []byte {
 	switch t.Type {
 	case TokenError:
-		return
+		return dst
 	case TokenEOF:
-		return
+		return dst
 	case TokenIdent:
-		stickyWriteString(&n, &err, w, escapeIdentifier(t.Value))
-		return
+		return appendIdent(dst, t.Value, 3)
 	case TokenAtKeyword:
-		stickyWriteString(&n, &err, w, "@")
-		stickyWriteString(&n, &err, w, escapeIdentifier(t.Value))
-		return
+		dst = append(dst, '@')
+		return appendIdent(dst, t.Value, 3)
 	case TokenDelim:
 		if t.Value == "\\" {
 			// nb: should not happen, this is actually TokenBadEscape
-			stickyWriteString(&n, &err, w, "\\\n")
-		} else {
-			stickyWriteString(&n, &err, w, t.Value)
+			return append(dst, '\\', '\n')
 		}
-		return
+		return append(dst, t.Value...)
 	case TokenHash:
 		e := t.Extra.(*TokenExtraHash)
-		stickyWriteString(&n, &err, w, "#")
+		dst = append(dst, '#')
 		if e.IsIdentifier {
-			stickyWriteString(&n, &err, w, escapeIdentifier(t.Value))
-		} else {
-			stickyWriteString(&n, &err, w, escapeHashName(t.Value))
+			return appendIdent(dst, t.Value, 3)
 		}
-		return
+		return appendIdent(dst, t.Value, 1)
 	case TokenPercentage:
-		stickyWriteString(&n, &err, w, t.Value)
-		stickyWriteString(&n, &err, w, "%")
-		return
+		dst = append(dst, t.Value...)
+		return append(dst, '%')
 	case TokenDimension:
 		e := t.Extra.(*TokenExtraNumeric)
-		stickyWriteString(&n, &err, w, t.Value)
-		stickyWriteString(&n, &err, w, escapeDimension(e.Dimension))
-		return
+		dst = append(dst, t.Value...)
+		return appendIdent(dst, e.Dimension, 2)
 	case TokenString:
-		stickyWriteString(&n, &err, w, escapeString(t.Value, '"'))
-		return
+		return appendString(dst, t.Value, '"')
 	case TokenURI:
-		stickyWriteString(&n, &err, w, "url(")
-		stickyWriteString(&n, &err, w, escapeString(t.Value, '"'))
-		stickyWriteString(&n, &err, w, ")")
-		return
+		dst = append(dst, "url("...)
+		dst = appendString(dst, t.Value, '"')
+		return append(dst, ')')
 	case TokenUnicodeRange:
-		stickyWriteString(&n, &err, w, t.Extra.String())
-		return
+		return append(dst, t.Extra.String()...)
 	case TokenComment:
-		stickyWriteString(&n, &err, w, "/*")
-		stickyWriteString(&n, &err, w, t.Value)
-		stickyWriteString(&n, &err, w, "*/")
-		return
+		dst = append(dst, "/*"...)
+		dst = append(dst, t.Value...)
+		return append(dst, "*/"...)
+	case TokenVariable:
+		dst = append(dst, '$')
+		return appendIdent(dst, t.Value, 0)
+	case TokenLineComment:
+		dst = append(dst, "//"...)
+		return append(dst, t.Value...)
 	case TokenFunction:
-		stickyWriteString(&n, &err, w, escapeIdentifier(t.Value))
-		stickyWriteString(&n, &err, w, "(")
-		return
+		dst = appendIdent(dst, t.Value, 3)
+		return append(dst, '(')
 	case TokenBadEscape:
-		stickyWriteString(&n, &err, w, "\\\n")
-		return
+		return append(dst, '\\', '\n')
 	case TokenBadString:
-		stickyWriteString(&n, &err, w, "\"")
-		stickyWriteString(&n, &err, w, escapeString(t.Value, 0))
-		stickyWriteString(&n, &err, w, "\n")
-		return
+		dst = append(dst, '"')
+		dst = appendString(dst, t.Value, 0)
+		return append(dst, '\n')
 	case TokenBadURI:
-		stickyWriteString(&n, &err, w, "url(\"")
-		str := escapeString(t.Value, 0)
-		str = strings.TrimSuffix(str, "\"")
-		stickyWriteString(&n, &err, w, str)
-		stickyWriteString(&n, &err, w, "\n)")
-		return
+		dst = append(dst, "url(\""...)
+		start := len(dst)
+		dst = appendString(dst, t.Value, 0)
+		if len(dst) > start && dst[len(dst)-1] == '"' {
+			dst = dst[:len(dst)-1]
+		}
+		return append(dst, '\n', ')')
 	default:
-		stickyWriteString(&n, &err, w, t.Value)
-		return
+		return append(dst, t.Value...)
 	}
 }
 
@@ -477,39 +635,119 @@ func (t *Token) WriteTo(w io.Writer) (n int64, err error) {
 // consumption, but it can be used by consumers that want to re-render a parse
 // stream.
 type TokenRenderer struct {
+	// Comments of these kinds are not written.  Separators are still
+	// inserted as if the dropped comments had never been in the stream.
+	DropComments CommentKind
+	// If SpaceSeparator is set, a single space is used to keep adjacent
+	// tokens apart instead of an empty comment.  The output is shorter and
+	// easier to read, but re-tokenizing it gives an extra TokenS, so it
+	// should only be used where whitespace between the tokens is
+	// insignificant.
+	SpaceSeparator bool
+
 	lastToken Token
 }
 
+// NewTokenRenderer returns a TokenRenderer that renders tokens as if prev
+// had just been written, for resuming output in the middle of a stream.
+func NewTokenRenderer(prev Token) *TokenRenderer {
+	return &TokenRenderer{lastToken: prev}
+}
+
+// LastToken returns the last token written by the renderer, which decides
+// whether the next token needs a separator.  It is the zero Token if
+// nothing has been written since the renderer was created or reset.
+func (r *TokenRenderer) LastToken() Token {
+	return r.lastToken
+}
+
+// Reset forgets the last token written, so the next token is rendered as if
+// it were the first in the stream.  The renderer's options are kept.
+func (r *TokenRenderer) Reset() {
+	r.lastToken = Token{}
+}
+
 // Write a token to the given io.Writer, potentially inserting an empty comment
 // in front based on what the previous token was.
 func (r *TokenRenderer) WriteTokenTo(w io.Writer, t Token) (n int64, err error) {
-	var prevKey, curKey interface{}
-	if r.lastToken.Type == TokenDelim {
-		prevKey = r.lastToken.Value[0]
-	} else {
-		prevKey = r.lastToken.Type
+	if t.Type == TokenComment && r.DropComments&t.CommentKind() != 0 {
+		return 0, nil
 	}
-	if t.Type == TokenDelim {
-		curKey = t.Value[0]
-	} else {
-		curKey = t.Type
-	}
-
-	m1, ok := commentInsertionRules[prevKey]
-	if ok {
-		if m1[curKey] {
+	if r.lastToken.Type == TokenLineComment && !(t.Type == TokenS && strings.HasPrefix(t.Value, "\n")) {
+		// the line comment only ends at a newline
+		stickyWriteString(&n, &err, w, "\n")
+	} else if NeedsSeparator(r.lastToken, t) {
+		if r.SpaceSeparator {
+			stickyWriteString(&n, &err, w, " ")
+		} else {
 			stickyWriteString(&n, &err, w, "/**/")
 		}
 	}
 
-	n2, err2 := t.WriteTo(w)
+	prev := r.lastToken.Type
 	r.lastToken = t
+	if t.Type == TokenS && (prev == TokenBadString || prev == TokenBadEscape) && strings.HasPrefix(t.Value, "\n") {
+		// The previous token was rendered with the newline that ended it,
+		// which the tokenizer leaves at the start of the following
+		// whitespace.
+		t.Value = t.Value[1:]
+	}
+	if err != nil {
+		return n, err
+	}
+	n2, err := t.WriteTo(w)
+	return n + n2, err
+}
+
+// RenderTokens writes the CSS source representation of toks to w, inserting
+// separators between tokens as TokenRenderer does.  Rendering stops at the
+// first write error, which is returned along with the number of bytes
+// written.
+func RenderTokens(w io.Writer, toks []Token) (n int64, err error) {
+	var r TokenRenderer
+	for _, t := range toks {
+		n2, err := r.WriteTokenTo(w, t)
+		n += n2
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// NeedsSeparator reports whether prev and next would run together into
+// different tokens if they were written with nothing in between, following
+// the serialization rules of CSS Syntax Level 3, section 9.  TokenRenderer
+// writes a comment or space between such pairs.
+func NeedsSeparator(prev, next Token) bool {
+	if prev.Type == TokenVariable {
+		// only the end of prev matters, and variable names end like
+		// identifiers
+		prev.Type = TokenIdent
+	}
+	if prev.Type == TokenDelim && prev.Value == "-" && startsWithDashName(next) {
+		// "--x" is read back as the same '-' delim and "-x" identifier, so
+		// custom property names are not split apart
+		return false
+	}
+	m1, ok := commentInsertionRules[separatorKey(prev)]
+	return ok && m1[separatorKey(next)]
+}
+
+// startsWithDashName reports whether t is an identifier or function whose
+// rendering begins with a dash followed by a name-start character.
+func startsWithDashName(t Token) bool {
+	return (t.Type == TokenIdent || t.Type == TokenFunction) &&
+		len(t.Value) > 1 && t.Value[0] == '-' && isNameStart(t.Value[1])
+}
 
-	n += n2
-	if err2 != nil && err == nil {
-		err = err2
+// Delims are keyed by their character (as a rune, to match the untyped
+// constants in the tables) and all other tokens by type.
+func separatorKey(t Token) interface{} {
+	if t.Type == TokenDelim && t.Value != "" {
+		return rune(t.Value[0])
 	}
-	return n, err
+	return t.Type
 }
 
 // CSS Syntax Level 3 - Section 9
@@ -525,7 +763,7 @@ var commentInsertionThruCDC = map[interface{}]bool{
 	TokenUnicodeRange: true,
 	TokenCDC:          true,
 	'-':               true,
-	'(':               false,
+	TokenOpenParen:    false,
 }
 
 var commentInsertionRules = map[interface{}]map[interface{}]bool{
@@ -540,7 +778,7 @@ var commentInsertionRules = map[interface{}]map[interface{}]bool{
 		TokenDimension:    true,
 		TokenUnicodeRange: true,
 		TokenCDC:          true,
-		'(':               true,
+		TokenOpenParen:    true,
 	},
 	TokenAtKeyword: commentInsertionThruCDC,
 	TokenHash:      commentInsertionThruCDC,
@@ -556,7 +794,7 @@ var commentInsertionRules = map[interface{}]map[interface{}]bool{
 		TokenUnicodeRange: true,
 		TokenCDC:          false,
 		'-':               true,
-		'(':               false,
+		TokenOpenParen:    false,
 	},
 	'-': map[interface{}]bool{
 		TokenIdent:        true,
@@ -569,7 +807,7 @@ var commentInsertionRules = map[interface{}]map[interface{}]bool{
 		TokenUnicodeRange: true,
 		TokenCDC:          false,
 		'-':               false,
-		'(':               false,
+		TokenOpenParen:    false,
 	},
 	TokenNumber: map[interface{}]bool{
 		TokenIdent:        true,
@@ -582,7 +820,7 @@ var commentInsertionRules = map[interface{}]map[interface{}]bool{
 		TokenUnicodeRange: true,
 		TokenCDC:          false,
 		'-':               false,
-		'(':               false,
+		TokenOpenParen:    false,
 	},
 	'@': map[interface{}]bool{
 		TokenIdent:        true,
@@ -595,7 +833,7 @@ var commentInsertionRules = map[interface{}]map[interface{}]bool{
 		TokenUnicodeRange: true,
 		TokenCDC:          false,
 		'-':               true,
-		'(':               false,
+		TokenOpenParen:    false,
 	},
 	TokenUnicodeRange: map[interface{}]bool{
 		TokenIdent:        true,
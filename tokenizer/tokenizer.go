@@ -5,6 +5,7 @@ package tokenizer
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -15,35 +16,218 @@ import (
 )
 
 var (
-	errBadEscape = &ParseError{Type: TokenBadEscape, Message: "bad escape (backslash-newline) in input"}
+	errBadEscape = &ParseError{Type: TokenBadEscape, Code: CodeBadEscape, Message: "bad escape (backslash-newline) in input"}
 )
 
+// ErrLimitExceeded is returned by Tokenizer.Err when the input exceeds one of
+// the limits set on the Tokenizer.
+var ErrLimitExceeded = errors.New("tokenizer: input exceeds configured limit")
+
 // Tokenizer scans an input and emits tokens following the CSS Syntax Level 3
 // specification.
 type Tokenizer struct {
 	r    *bufio.Reader
 	err  error
 	peek [3]byte
+	// scratch space for token values, reused between tokens
+	buf []byte
+	// recently seen names, allocated on first use
+	names *nameCache
+	// nil if the input is known to need no normalization
+	norm *normalize
+	// number of normalized bytes consumed
+	pos int64
+
+	// ErrorMode selects how bad strings, bad urls, and bad escapes are
+	// reported.  It must be set before the first call to Scan.
+	ErrorMode int
+
+	// Level selects the version of the CSS Syntax specification to follow.
+	// It must be set before the first call to Scan.
+	Level SyntaxLevel
+
+	// If NormalizeWhitespace is set, TokenS values are collapsed to "\n" if
+	// the whitespace contained a newline, or " " otherwise.  By default,
+	// TokenS holds the whitespace exactly as it appeared in the (normalized)
+	// input.
+	NormalizeWhitespace bool
+
+	// If DropCDOCDC is set, TokenCDO and TokenCDC ("<!--" and "-->") are
+	// not returned.  They are only meaningful in stylesheets embedded in
+	// HTML, and are ignored at the top level of a stylesheet anyway.
+	DropCDOCDC bool
+
+	// Limits for tokenizing untrusted input.  Zero means no limit.  When a
+	// limit is exceeded, the tokenizer stops with a TokenError and Err
+	// returns ErrLimitExceeded.  Sizes are measured in bytes of normalized
+	// input.
+	//
+	// MaxTokenLength is checked while the token is being read, so an
+	// over-long token is not buffered in full.  MaxNestingDepth limits how
+	// deeply parentheses, brackets, braces, and functions may be nested.
+	MaxInputSize    int64
+	MaxTokenLength  int
+	MaxNestingDepth int
+
+	// If Trace is set, a line is written to it for every decision the
+	// tokenizer makes, every byte it consumes, and every token it returns.
+	// This is very verbose and only intended for debugging.
+	Trace io.Writer
+
+	// If Intern is non-nil, names (identifiers, function and at-rule names,
+	// hash names, and units) and other token values of up to
+	// MaxInternedLength bytes are looked up in it before a new string is
+	// allocated, and newly allocated ones are added to it, so that identical
+	// values share storage.  This saves memory for callers that keep the
+	// tokens of large stylesheets around.  Comments, whitespace, and longer
+	// values such as data URLs are rarely repeated and are never added, so
+	// that the map does not grow with them.  The map may be reused between
+	// Tokenizers to share values across stylesheets, but not by several
+	// Tokenizers at once.  It is never pruned.
+	Intern map[string]string
 
-	// ErrorMode int
+	// Placeholders lists the template placeholder syntaxes to recognize, for
+	// tokenizing templates before they are filled in.  Wherever a token
+	// could start, text matching a placeholder is returned as a single
+	// TokenPlaceholder.  Placeholders are not recognized in the middle of
+	// another token, such as inside a string or a url().
+	Placeholders []Placeholder
+
+	// Dialect selects a CSS preprocessor syntax to recognize in addition to
+	// plain CSS.  It must be set before the first call to Scan.
+	Dialect Dialect
+
+	// position past which reading more input exceeds a limit, or 0
+	limit int64
+	// current nesting depth
+	depth int
+	// escapes replaced with U+FFFD, see Replacements
+	replaced []Replacement
 
 	tok Token
 }
 
-/*
+// Placeholder describes the syntax of a template placeholder.
+type Placeholder struct {
+	// Open starts the placeholder, and must not be empty.
+	Open string
+	// Close ends the placeholder.  If it is empty, the placeholder is just
+	// the Open text, such as "%s".  A placeholder that is not closed before
+	// the end of input runs to the end of input.
+	Close string
+}
+
+// Dialect is a CSS preprocessor language.
+type Dialect int
+
 const (
-	// Default error mode - tokenization errors are represented as special tokens in the stream, and I/O errors are TokenError.
+	// Plain CSS, the default.
+	DialectCSS Dialect = iota
+	// SCSS.  "$name" is returned as a TokenVariable, "#{...}" as a
+	// TokenInterpolation, and "//" comments as TokenLineComment.
+	DialectSCSS
+	// Less.  "@{...}" is returned as a TokenInterpolation and "//" comments
+	// as TokenLineComment.  Less variables ("@name") cannot be told apart
+	// from at-rules without parsing, so they are still TokenAtKeyword.
+	DialectLess
+)
+
+// SyntaxLevel is a version of the CSS Syntax specification.
+type SyntaxLevel int
+
+const (
+	// CSS Syntax Level 3, the default.
+	SyntaxLevel3 SyntaxLevel = iota
+	// CSS Syntax Level 4, which differs from Level 3 as follows:
+	//
+	// There is no unicode-range token; "u+" is tokenized as an identifier
+	// followed by whatever comes after the '+', and consumers that want
+	// unicode ranges must reassemble them.
+	//
+	// There are no attribute-matching or column tokens (TokenIncludes,
+	// TokenDashMatch, TokenPrefixMatch, TokenSuffixMatch,
+	// TokenSubstringMatch, TokenColumn); those characters are returned as
+	// TokenDelim instead.
+	//
+	// Identifiers may begin with two dashes, so custom property names such
+	// as "--main-color" are a single TokenIdent.
+	SyntaxLevel4
+)
+
+const (
+	// Default error mode - tokenization errors are represented as special
+	// tokens in the stream (TokenBadString, TokenBadURI, TokenBadEscape),
+	// and tokenization continues after them following the error recovery
+	// rules of the specification.  I/O errors are TokenError.
 	ErrorModeTokens = iota
+	// Tokenization errors are fatal: instead of a bad token, the tokenizer
+	// returns a TokenError, and Err returns a *ParseError describing the
+	// problem.  No further tokens are returned.
 	ErrorModeFatal
 )
-*/
 
 // Construct a Tokenizer from the given input.  Input need not be 'normalized'
 // according to the spec (newlines changed to \n, zero bytes changed to
 // U+FFFD).
 func NewTokenizer(r io.Reader) *Tokenizer {
+	n := new(normalize)
+	return &Tokenizer{
+		r:    bufio.NewReader(transform.NewReader(r, n)),
+		norm: n,
+	}
+}
+
+// NewTokenizerBufio constructs a Tokenizer that reads directly from br,
+// without adding a buffer of its own.  The tokenizer never consumes input
+// past the end of the last token it returned, so a caller sharing br, such
+// as an HTML parser handing over the contents of a <style> element, can
+// stop calling Next at any point and continue reading br from exactly where
+// the tokenizer stopped.
+//
+// Unlike NewTokenizer, the input is not normalized: it must not contain
+// carriage returns or NUL bytes.  Text from an HTML parser has already been
+// normalized this way.
+func NewTokenizerBufio(br *bufio.Reader) *Tokenizer {
+	return &Tokenizer{r: br}
+}
+
+// State is the part of a Tokenizer's state that carries over from one token
+// to the next.
+type State struct {
+	// Offset is the number of bytes of input consumed.
+	Offset int64
+	// Depth is the nesting depth counted for MaxNestingDepth.
+	Depth int
+}
+
+// Save returns the tokenizer's current state.
+func (z *Tokenizer) Save() State {
+	return State{Offset: z.pos, Depth: z.depth}
+}
+
+// Restore sets the tokenizer's state to one returned by Save, usually from
+// a different Tokenizer.  This is used to resume tokenizing a stylesheet
+// that was split up, such as one interrupted by markup in a shared reader,
+// so that offsets in errors and limits continue from the saved position
+// instead of starting over at zero.  The input itself is not moved; the
+// caller must make sure the new tokenizer reads from where the old one
+// stopped, and add any input it skipped in between to Offset.
+//
+// Offsets are only continued correctly for tokenizers that read their input
+// without normalization, from NewTokenizerBufio.
+func (z *Tokenizer) Restore(s State) {
+	z.pos = s.Offset
+	z.depth = s.Depth
+}
+
+// newTokenizerBytes constructs a Tokenizer reading from src, skipping the
+// normalization step when src does not need it.
+func newTokenizerBytes(src []byte) *Tokenizer {
+	if bytes.IndexAny(src, "\r\x00") != -1 {
+		return NewTokenizer(bytes.NewReader(src))
+	}
 	return &Tokenizer{
-		r: bufio.NewReader(transform.NewReader(r, new(normalize))),
+		r: bufio.NewReader(bytes.NewReader(src)),
 	}
 }
 
@@ -62,10 +246,46 @@ func (z *Tokenizer) Scan() {
 		} else if rec != nil {
 			panic(rec)
 		}
+		if z.Trace != nil {
+			z.tracef("return %v", z.tok)
+		}
 	}()
 
 	if z.err == nil {
+		start := z.srcOffset()
+		if z.Trace != nil {
+			z.tracef("scan at offset %d", start)
+		}
+		z.setLimit()
 		z.tok = z.consume()
+		for z.DropCDOCDC && (z.tok.Type == TokenCDO || z.tok.Type == TokenCDC) {
+			start = z.srcOffset()
+			z.setLimit()
+			z.tok = z.consume()
+		}
+		if z.limit > 0 && z.pos > z.limit {
+			panic(ErrLimitExceeded)
+		}
+		if z.MaxNestingDepth > 0 {
+			z.trackNesting()
+		}
+		if z.ErrorMode == ErrorModeFatal && z.tok.Type.StopToken() && z.tok.Type != TokenEOF {
+			pe := diagnosticError(z.tok, start, z.srcOffset())
+			z.err = pe
+			z.tok = Token{
+				Type:  TokenError,
+				Value: pe.Error(),
+				Extra: &TokenExtraError{Err: pe},
+			}
+			return
+		}
+		if e, ok := z.tok.Extra.(*TokenExtraError); ok {
+			if pe := e.ParseError(); pe != nil {
+				pe.Loc = start
+				pe.End = z.srcOffset()
+				pe.Token = z.tok
+			}
+		}
 	} else if z.err == io.EOF {
 		z.tok = Token{
 			Type: TokenEOF,
@@ -79,6 +299,41 @@ func (z *Tokenizer) Scan() {
 	}
 }
 
+// setLimit computes the read limit for the next token.
+func (z *Tokenizer) setLimit() {
+	z.limit = z.MaxInputSize
+	if z.MaxTokenLength > 0 {
+		end := z.pos + int64(z.MaxTokenLength)
+		if z.limit == 0 || end < z.limit {
+			z.limit = end
+		}
+	}
+}
+
+// checkLimit panics with ErrLimitExceeded if the read position is past the
+// limit.  Reading a single byte past the limit is allowed, as the tokenizer
+// sometimes reads a byte after the end of the token and then unreads it;
+// Scan checks the limit exactly once the token is complete.
+func (z *Tokenizer) checkLimit() {
+	if z.limit > 0 && z.pos > z.limit+1 {
+		panic(ErrLimitExceeded)
+	}
+}
+
+func (z *Tokenizer) trackNesting() {
+	switch z.tok.Type {
+	case TokenOpenParen, TokenOpenBracket, TokenOpenBrace, TokenFunction:
+		z.depth++
+		if z.depth > z.MaxNestingDepth {
+			panic(ErrLimitExceeded)
+		}
+	case TokenCloseParen, TokenCloseBracket, TokenCloseBrace:
+		if z.depth > 0 {
+			z.depth--
+		}
+	}
+}
+
 // Get the most recently scanned token.
 func (z *Tokenizer) Token() Token {
 	return z.tok
@@ -128,53 +383,53 @@ func isValidEscape(p []byte) bool {
 	return true
 }
 
+// Byte classes for the table-driven checks below.
+const (
+	classNameStart = 1 << iota
+	classNameCode
+	classHexDigit
+	classWhitespace
+	classNonPrintable
+)
+
+var byteClass [256]uint8
+
+func init() {
+	for i := 0; i < 256; i++ {
+		c := byte(i)
+		var cl uint8
+		switch {
+		case c >= utf8.RuneSelf: // any high code points
+			cl = classNameStart | classNameCode
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+			cl = classNameStart | classNameCode
+		case c == '-', c >= '0' && c <= '9':
+			cl = classNameCode
+		}
+		if (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f') || (c >= '0' && c <= '9') {
+			cl |= classHexDigit
+		}
+		if c == ' ' || c == '\t' || c == '\n' {
+			cl |= classWhitespace
+		}
+		if c <= 0x08 || c == 0x0B || (0x0E <= c && c <= 0x1F) || c == 0x7F {
+			cl |= classNonPrintable
+		}
+		byteClass[i] = cl
+	}
+}
+
 // §4.3.9
 func isNameStart(p byte) bool {
-	if p >= utf8.RuneSelf {
-		return true // any high code points
-	}
-	if p == '_' {
-		return true
-	}
-	if p >= 'A' && p <= 'Z' {
-		return true
-	}
-	if p >= 'a' && p <= 'z' {
-		return true
-	}
-	return false
+	return byteClass[p]&classNameStart != 0
 }
 
 func isNameCode(p byte) bool {
-	if p >= utf8.RuneSelf {
-		return true // any high code points
-	}
-	if p == '_' || p == '-' {
-		return true
-	}
-	if p >= 'A' && p <= 'Z' {
-		return true
-	}
-	if p >= 'a' && p <= 'z' {
-		return true
-	}
-	if p >= '0' && p <= '9' {
-		return true
-	}
-	return false
+	return byteClass[p]&classNameCode != 0
 }
 
 func isHexDigit(p byte) bool {
-	if p >= 'A' && p <= 'F' {
-		return true
-	}
-	if p >= 'a' && p <= 'f' {
-		return true
-	}
-	if p >= '0' && p <= '9' {
-		return true
-	}
-	return false
+	return byteClass[p]&classHexDigit != 0
 }
 
 // up to 3 bytes
@@ -206,7 +461,7 @@ func isStartNumber(p []byte) bool {
 }
 
 func isNonPrintable(by byte) bool {
-	return (0 <= by && by <= 0x08) || (0x0B == by) || (0x0E <= by && by <= 0x1F) || (0x7F == by)
+	return byteClass[by]&classNonPrintable != 0
 }
 
 // repeek must be called before the following:
@@ -216,6 +471,9 @@ func (z *Tokenizer) nextIsEscape() bool {
 }
 
 func (z *Tokenizer) nextStartsIdentifier() bool {
+	if z.Level >= SyntaxLevel4 && z.peek[0] == '-' && z.peek[1] == '-' {
+		return true
+	}
 	return isStartIdentifier(z.peek[:3])
 }
 
@@ -227,7 +485,7 @@ func (z *Tokenizer) nextCompare(vs string) bool {
 	return string(z.peek[:len(vs)]) == vs
 }
 
-var premadeTokens = map[byte]Token{
+var premadeTokens = [256]Token{
 	'$': Token{
 		Type:  TokenSuffixMatch,
 		Value: "$=",
@@ -266,7 +524,15 @@ var premadeTokens = map[byte]Token{
 
 // 4.3.1
 func (z *Tokenizer) consume() Token {
+	if len(z.Placeholders) > 0 {
+		if t, ok := z.consumePlaceholder(); ok {
+			return t
+		}
+	}
 	ch := z.nextByte()
+	if z.Trace != nil {
+		z.tracef("dispatch on %q", ch)
+	}
 
 	switch ch {
 	case 0: // EOF
@@ -277,6 +543,9 @@ func (z *Tokenizer) consume() Token {
 		return z.consumeString(ch)
 	case '#':
 		z.repeek()
+		if z.Dialect == DialectSCSS && z.peek[0] == '{' {
+			return z.consumeInterpolation(ch)
+		}
 		if isNameCode(z.peek[0]) || z.nextIsEscape() {
 			e := &TokenExtraHash{
 				IsIdentifier: z.nextStartsIdentifier(),
@@ -292,17 +561,26 @@ func (z *Tokenizer) consume() Token {
 		return premadeTokens[ch]
 	case '$', '*', '^', '~':
 		z.repeek()
-		if z.peek[0] == '=' {
-			z.r.Discard(1)
+		if ch == '$' && z.Dialect == DialectSCSS && z.nextStartsIdentifier() {
+			return Token{
+				Type:  TokenVariable,
+				Value: z.consumeName(),
+			}
+		}
+		if z.peek[0] == '=' && z.Level < SyntaxLevel4 {
+			z.discard(1)
 			return premadeTokens[ch]
 		}
 	case '|':
 		z.repeek()
+		if z.Level >= SyntaxLevel4 {
+			break
+		}
 		if z.peek[0] == '=' {
-			z.r.Discard(1)
+			z.discard(1)
 			return premadeTokens['A']
 		} else if z.peek[0] == '|' {
-			z.r.Discard(1)
+			z.discard(1)
 			return premadeTokens['B']
 		}
 	case '+':
@@ -318,13 +596,13 @@ func (z *Tokenizer) consume() Token {
 		if z.nextIsNumber() {
 			return z.consumeNumeric()
 		}
-		if z.nextStartsIdentifier() {
-			return z.consumeIdentish()
-		}
 		if z.nextCompare("-->") {
-			z.r.Discard(3)
+			z.discard(3)
 			return premadeTokens['C']
 		}
+		if z.nextStartsIdentifier() {
+			return z.consumeIdentish()
+		}
 		z.nextByte() // re-read, fall down to TokenDelim
 	case '.':
 		z.unreadByte()
@@ -336,17 +614,24 @@ func (z *Tokenizer) consume() Token {
 	case '/':
 		z.repeek()
 		if z.peek[0] == '*' {
-			z.r.Discard(1)
+			z.discard(1)
 			return z.consumeComment()
 		}
+		if z.peek[0] == '/' && z.Dialect != DialectCSS {
+			z.discard(1)
+			return z.consumeLineComment()
+		}
 	case '<':
 		z.repeek()
 		if z.nextCompare("!--") {
-			z.r.Discard(3)
+			z.discard(3)
 			return premadeTokens['O']
 		}
 	case '@':
 		z.repeek()
+		if z.Dialect == DialectLess && z.peek[0] == '{' {
+			return z.consumeInterpolation(ch)
+		}
 		if z.nextStartsIdentifier() {
 			s := z.consumeName()
 			return Token{
@@ -367,8 +652,8 @@ func (z *Tokenizer) consume() Token {
 	case 'U', 'u':
 		z.unreadByte()
 		z.repeek()
-		if z.peek[1] == '+' && (isHexDigit(z.peek[2]) || (z.peek[2] == '?')) {
-			z.r.Discard(2) // (!) only discard the U+
+		if z.Level < SyntaxLevel4 && z.peek[1] == '+' && (isHexDigit(z.peek[2]) || (z.peek[2] == '?')) {
+			z.discard(2) // (!) only discard the U+
 			return z.consumeUnicodeRange()
 		}
 		break
@@ -384,7 +669,7 @@ func (z *Tokenizer) consume() Token {
 	}
 	return Token{
 		Type:  TokenDelim,
-		Value: string(rune(ch)),
+		Value: delimString(ch),
 	}
 }
 
@@ -396,10 +681,18 @@ func (z *Tokenizer) nextByte() byte {
 	by, err := z.r.ReadByte()
 	if err == io.EOF {
 		z.err = io.EOF
+		if z.Trace != nil {
+			z.tracef("  EOF")
+		}
 		return 0
 	} else if err != nil {
 		panic(err)
 	}
+	z.pos++
+	z.checkLimit()
+	if z.Trace != nil {
+		z.tracef("  consume %q", by)
+	}
 	return by
 }
 
@@ -408,52 +701,105 @@ func (z *Tokenizer) unreadByte() {
 		// don't unread after EOF
 		return
 	}
-	z.r.UnreadByte()
+	if z.r.UnreadByte() == nil {
+		z.pos--
+		if z.Trace != nil {
+			z.tracef("  reconsume")
+		}
+	}
+}
+
+// discard skips n bytes that are known to be in the read buffer.
+func (z *Tokenizer) discard(n int) {
+	if z.Trace != nil {
+		buf, _ := z.r.Peek(n)
+		z.tracef("  consume %q", buf)
+	}
+	d, _ := z.r.Discard(n)
+	z.pos += int64(d)
+	z.checkLimit()
+}
+
+// srcOffset returns the offset in the original input of the next byte to be
+// read.
+func (z *Tokenizer) srcOffset() int {
+	if z.norm == nil {
+		return int(z.pos)
+	}
+	return int(z.norm.sourceOffset(z.pos))
 }
 
 func isWhitespace(r rune) bool {
 	return r == ' ' || r == '\t' || r == '\n'
 }
 
+// peekBuffered returns all of the input currently held in the read buffer,
+// filling it first if it is empty.  The returned slice is empty at EOF.
+func (z *Tokenizer) peekBuffered() []byte {
+	if z.r.Buffered() == 0 {
+		_, err := z.r.Peek(1)
+		if err != nil && err != io.EOF {
+			panic(err)
+		}
+	}
+	buf, _ := z.r.Peek(z.r.Buffered())
+	return buf
+}
+
 func isNotWhitespace(r rune) bool {
 	return !isWhitespace(r)
 }
 
 func (z *Tokenizer) consumeWhitespace(ch byte) Token {
-	const wsBufSize = 32
-
+	if z.Trace != nil {
+		z.tracef("state: whitespace")
+	}
 	sawNewline := false
 	if ch == '\n' {
 		sawNewline = true
 	}
+	keep := ch != 0 && !z.NormalizeWhitespace
+	var value []byte
+	if keep {
+		value = append(z.buf[:0], ch)
+	}
 
 	for {
-		// Consume whitespace in chunks of up to wsBufSize
-		buf, err := z.r.Peek(wsBufSize)
-		if err != nil && err != io.EOF {
-			panic(err)
-		}
+		// Consume whitespace a buffer at a time
+		buf := z.peekBuffered()
 		if len(buf) == 0 {
 			break // Reached EOF
 		}
 		// find first non-whitespace char, discard up to there
-		idx := bytes.IndexFunc(buf, isNotWhitespace)
+		idx := 0
+		for idx < len(buf) && byteClass[buf[idx]]&classWhitespace != 0 {
+			idx++
+		}
 		if idx == 0 {
 			break // Nothing to trim
 		}
-		if idx == -1 {
-			idx = len(buf) // Entire buffer is spaces
-		}
-		if /* const */ ch != 0 {
+		if keep {
+			value = append(value, buf[:idx]...)
+		} else if /* const */ ch != 0 {
 			// only check for newlines when we're actually outputting a token
 			nlIdx := bytes.IndexByte(buf[:idx], '\n')
 			if nlIdx != -1 {
 				sawNewline = true
 			}
 		}
-		z.r.Discard(idx)
+		z.discard(idx)
 	}
 
+	if keep {
+		if ws, ok := whitespaceAtom(value); ok {
+			z.buf = value[:0]
+			return Token{Type: TokenS, Value: ws}
+		}
+		return Token{
+			Type:  TokenS,
+			Value: z.plainString(value),
+		}
+	}
 	if sawNewline {
 		return Token{
 			Type:  TokenS,
@@ -468,21 +814,25 @@ func (z *Tokenizer) consumeWhitespace(ch byte) Token {
 
 // 4.3.2
 func (z *Tokenizer) consumeNumeric() Token {
+	if z.Trace != nil {
+		z.tracef("state: numeric")
+	}
 	repr, notInteger := z.consumeNumericInner()
 	e := &TokenExtraNumeric{
 		NonInteger: notInteger,
 	}
 	t := Token{
 		Type:  TokenNumber,
-		Value: string(repr),
+		Value: z.valueString(repr),
 		Extra: e,
 	}
+	e.setForm(t.Value)
 	z.repeek()
 	if z.nextStartsIdentifier() {
 		t.Type = TokenDimension
 		e.Dimension = z.consumeName()
 	} else if z.peek[0] == '%' {
-		z.r.Discard(1)
+		z.discard(1)
 		t.Type = TokenPercentage
 	}
 	return t
@@ -490,10 +840,13 @@ func (z *Tokenizer) consumeNumeric() Token {
 
 // §4.3.3
 func (z *Tokenizer) consumeIdentish() Token {
+	if z.Trace != nil {
+		z.tracef("state: ident-like")
+	}
 	s := z.consumeName()
 	z.repeek()
 	if z.peek[0] == '(' {
-		z.r.Discard(1)
+		z.discard(1)
 		if strings.EqualFold(s, "url") {
 			return z.consumeURL()
 		}
@@ -511,25 +864,43 @@ func (z *Tokenizer) consumeIdentish() Token {
 
 // §4.3.4
 func (z *Tokenizer) consumeString(delim byte) Token {
-	var frag []byte
+	if z.Trace != nil {
+		z.tracef("state: string")
+	}
+	frag := z.buf[:0]
 	var by byte
 	for {
+		// copy everything up to the next interesting byte in one go
+		buf := z.peekBuffered()
+		i := 0
+		for i < len(buf) && buf[i] != delim && buf[i] != '\n' && buf[i] != '\\' {
+			i++
+		}
+		if i > 0 {
+			frag = append(frag, buf[:i]...)
+			z.discard(i)
+			if i == len(buf) {
+				continue
+			}
+		}
+
 		by = z.nextByte()
 		if by == delim || by == 0 {
 			// end of string, EOF
 			return Token{
 				Type:  TokenString,
-				Value: string(frag),
+				Value: z.valueString(frag),
 			}
 		} else if by == '\n' {
 			z.unreadByte()
 			/* z.err = */ er := &ParseError{
 				Type:    TokenBadString,
+				Code:    CodeUnterminatedString,
 				Message: "unterminated string",
 			}
 			return Token{
 				Type:  TokenBadString,
-				Value: string(frag),
+				Value: z.valueString(frag),
 				Extra: &TokenExtraError{Err: er},
 			}
 		} else if by == '\\' {
@@ -559,6 +930,9 @@ func (z *Tokenizer) consumeString(delim byte) Token {
 // §4.3.5
 // reader must be in the "url(" state
 func (z *Tokenizer) consumeURL() Token {
+	if z.Trace != nil {
+		z.tracef("state: url")
+	}
 	z.consumeWhitespace(0)
 	z.repeek()
 	if z.peek[0] == 0 {
@@ -575,6 +949,7 @@ func (z *Tokenizer) consumeURL() Token {
 			t.Value += z.consumeBadURL()
 			/* z.err = */ pe := &ParseError{
 				Type:    TokenBadURI,
+				Code:    CodeUnterminatedURLString,
 				Message: "unterminated string in url()",
 			}
 			t.Extra = &TokenExtraError{
@@ -593,6 +968,7 @@ func (z *Tokenizer) consumeURL() Token {
 		t.Value += z.consumeBadURL()
 		/* z.err = */ pe := &ParseError{
 			Type:    TokenBadURI,
+			Code:    CodeURLMissingParen,
 			Message: "url() with string missing close parenthesis",
 		}
 		t.Extra = &TokenExtraError{
@@ -600,46 +976,52 @@ func (z *Tokenizer) consumeURL() Token {
 		}
 		return t
 	}
-	var frag []byte
+	frag := z.buf[:0]
 	var by byte
 	for {
 		by = z.nextByte()
 		if by == ')' || by == 0 {
-			return Token{Type: TokenURI, Value: string(frag)}
+			return Token{Type: TokenURI, Value: z.valueString(frag)}
 		} else if isWhitespace(rune(by)) {
 			z.consumeWhitespace(0)
 			z.repeek()
 			if z.peek[0] == ')' || z.peek[0] == 0 {
 				z.nextByte() // ')'
-				return Token{Type: TokenURI, Value: string(frag)}
+				return Token{Type: TokenURI, Value: z.valueString(frag)}
 			}
 			/* z.err = */ pe := &ParseError{
 				Type:    TokenBadURI,
+				Code:    CodeURLWhitespace,
 				Message: "bare url() with internal whitespace",
 			}
+			s := z.valueString(frag)
 			return Token{
 				Type:  TokenBadURI,
-				Value: string(frag) + z.consumeBadURL(),
+				Value: s + z.consumeBadURL(),
 				Extra: &TokenExtraError{Err: pe},
 			}
 		} else if by == '\'' || by == '"' || by == '(' {
 			/* z.err = */ pe := &ParseError{
 				Type:    TokenBadURI,
+				Code:    CodeURLIllegalCharacter,
 				Message: fmt.Sprintf("bare url() with illegal character '%c'", by),
 			}
+			s := z.valueString(frag)
 			return Token{
 				Type:  TokenBadURI,
-				Value: string(frag) + z.consumeBadURL(),
+				Value: s + z.consumeBadURL(),
 				Extra: &TokenExtraError{Err: pe},
 			}
 		} else if isNonPrintable(by) {
 			/* z.err = */ pe := &ParseError{
 				Type:    TokenBadURI,
+				Code:    CodeURLIllegalCharacter,
 				Message: fmt.Sprintf("bare url() with unprintable character '%d'", by),
 			}
+			s := z.valueString(frag)
 			return Token{
 				Type:  TokenBadURI,
-				Value: string(frag) + z.consumeBadURL(),
+				Value: s + z.consumeBadURL(),
 				Extra: &TokenExtraError{Err: pe},
 			}
 		} else if by == '\\' {
@@ -654,11 +1036,13 @@ func (z *Tokenizer) consumeURL() Token {
 			} else {
 				/* z.err = */ pe := &ParseError{
 					Type:    TokenBadURI,
+					Code:    CodeURLBadEscape,
 					Message: fmt.Sprintf("bare url() with invalid escape"),
 				}
+				s := z.valueString(frag)
 				return Token{
 					Type:  TokenBadURI,
-					Value: string(frag) + z.consumeBadURL(),
+					Value: s + z.consumeBadURL(),
 					Extra: &TokenExtraError{Err: pe},
 				}
 			}
@@ -670,6 +1054,9 @@ func (z *Tokenizer) consumeURL() Token {
 
 // §4.3.6
 func (z *Tokenizer) consumeUnicodeRange() Token {
+	if z.Trace != nil {
+		z.tracef("state: unicode-range")
+	}
 	var sdigits [6]byte
 	var by byte
 	haveQuestionMarks := false
@@ -745,9 +1132,25 @@ func (z *Tokenizer) consumeUnicodeRange() Token {
 }
 
 func (z *Tokenizer) consumeComment() Token {
-	var frag []byte
+	if z.Trace != nil {
+		z.tracef("state: comment")
+	}
+	frag := z.buf[:0]
 	var by byte
 	for {
+		buf := z.peekBuffered()
+		i := bytes.IndexByte(buf, '*')
+		if i == -1 {
+			i = len(buf)
+		}
+		if i > 0 {
+			frag = append(frag, buf[:i]...)
+			z.discard(i)
+			if i == len(buf) {
+				continue
+			}
+		}
+
 		by = z.nextByte()
 		if by == '*' {
 			z.repeek()
@@ -755,27 +1158,91 @@ func (z *Tokenizer) consumeComment() Token {
 				z.nextByte() // '/'
 				return Token{
 					Type:  TokenComment,
-					Value: string(frag),
+					Value: z.plainString(frag),
 				}
 			}
 		} else if by == 0 {
 			return Token{
 				Type:  TokenComment,
-				Value: string(frag),
+				Value: z.plainString(frag),
 			}
 		}
 		frag = append(frag, by)
 	}
 }
 
+// consumeLineComment consumes a preprocessor "//" comment, after the
+// slashes.  The newline is left for the following whitespace token.
+func (z *Tokenizer) consumeLineComment() Token {
+	if z.Trace != nil {
+		z.tracef("state: line comment")
+	}
+	frag := z.buf[:0]
+	for {
+		buf := z.peekBuffered()
+		if len(buf) == 0 {
+			break
+		}
+		i := bytes.IndexByte(buf, '\n')
+		if i == -1 {
+			i = len(buf)
+		}
+		frag = append(frag, buf[:i]...)
+		z.discard(i)
+		if i < len(buf) {
+			break
+		}
+	}
+	return Token{
+		Type:  TokenLineComment,
+		Value: z.plainString(frag),
+	}
+}
+
+// consumeInterpolation consumes a preprocessor interpolation, whose opening
+// sigil has already been consumed and whose '{' is next.  Nested braces
+// are balanced; the interpolation runs to the end of input if not closed.
+func (z *Tokenizer) consumeInterpolation(sigil byte) Token {
+	if z.Trace != nil {
+		z.tracef("state: interpolation")
+	}
+	frag := append(z.buf[:0], sigil)
+	depth := 0
+	for {
+		by := z.nextByte()
+		if by == 0 {
+			break // EOF
+		}
+		frag = append(frag, by)
+		if by == '{' {
+			depth++
+		} else if by == '}' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	return Token{
+		Type:  TokenInterpolation,
+		Value: z.valueString(frag),
+	}
+}
+
 // §4.3.7
 // after the "\"
 func (z *Tokenizer) consumeEscapedCP() rune {
+	if z.Trace != nil {
+		z.tracef("state: escaped code point")
+	}
+	start := z.srcOffset() - 1
 	by := z.nextByte()
 	if by == 0 {
+		z.replaced = append(z.replaced, Replacement{Offset: start, Kind: ReplacedEscape})
 		return utf8.RuneError
 	} else if isHexDigit(by) {
-		var digits = make([]byte, 6)
+		var digitBuf [6]byte
+		digits := digitBuf[:]
 		digits[0] = by
 		i := 1
 		// (!) weird looping condition so that we UnreadByte() at the end
@@ -795,30 +1262,54 @@ func (z *Tokenizer) consumeEscapedCP() rune {
 		digits = digits[:i]
 		// 16 = hex, 22 = bit width of unicode
 		cpi, err := strconv.ParseInt(string(digits), 16, 32)
-		if err != nil || cpi == 0 || cpi > utf8.MaxRune {
+		if err != nil || cpi == 0 || cpi > utf8.MaxRune || (0xD800 <= cpi && cpi <= 0xDFFF) {
+			z.replaced = append(z.replaced, Replacement{Offset: start, Kind: ReplacedEscape})
 			return utf8.RuneError
 		}
 		return rune(cpi)
 	} else {
 		z.unreadByte()
-		ru, _, err := z.r.ReadRune()
+		ru, size, err := z.r.ReadRune()
+		z.pos += int64(size)
+		if z.Trace != nil && err == nil {
+			z.tracef("  consume %q", ru)
+		}
 		if err == io.EOF {
 			z.err = io.EOF
 			return utf8.RuneError
 		} else if err != nil {
 			z.err = err
 			panic(err)
-		} else {
-			return ru
 		}
+		if ru == utf8.RuneError && size == 1 {
+			z.replaced = append(z.replaced, Replacement{Offset: start, Kind: ReplacedEscape})
+		}
+		return ru
 	}
 }
 
 // §4.3.11
 func (z *Tokenizer) consumeName() string {
-	var frag []byte
+	if z.Trace != nil {
+		z.tracef("state: name")
+	}
+	frag := z.buf[:0]
 	var by byte
 	for {
+		// copy runs of plain name code points straight out of the buffer
+		buf := z.peekBuffered()
+		i := 0
+		for i < len(buf) && byteClass[buf[i]]&classNameCode != 0 {
+			i++
+		}
+		if i > 0 {
+			frag = append(frag, buf[:i]...)
+			z.discard(i)
+			if i == len(buf) {
+				continue
+			}
+		}
+
 		by = z.nextByte()
 		if by == '\\' {
 			z.unreadByte()
@@ -831,20 +1322,21 @@ func (z *Tokenizer) consumeName() string {
 				frag = append(frag, tmp[:n]...)
 				continue
 			} else {
-				return string(frag)
+				return z.nameString(frag)
 			}
 		} else if isNameCode(by) {
 			frag = append(frag, by)
 			continue
 		} else {
 			z.unreadByte()
-			return string(frag)
+			return z.nameString(frag)
 		}
 	}
 }
 
 // §4.3.12
 func (z *Tokenizer) consumeNumericInner() (repr []byte, notInteger bool) {
+	repr = z.buf[:0]
 	by := z.nextByte()
 	if by == '+' || by == '-' {
 		repr = append(repr, by)
@@ -883,7 +1375,7 @@ func (z *Tokenizer) consumeNumericInner() (repr []byte, notInteger bool) {
 		if n != 0 {
 			notInteger = true
 			repr = append(repr, z.peek[:n]...)
-			z.r.Discard(n)
+			z.discard(n)
 			by = z.nextByte()
 			consumeDigits()
 		}
@@ -892,14 +1384,51 @@ func (z *Tokenizer) consumeNumericInner() (repr []byte, notInteger bool) {
 	return repr, notInteger
 }
 
+// consumePlaceholder consumes a placeholder if one starts at the current
+// position.
+func (z *Tokenizer) consumePlaceholder() (Token, bool) {
+	for _, p := range z.Placeholders {
+		if p.Open == "" {
+			continue
+		}
+		buf, err := z.r.Peek(len(p.Open))
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			panic(err)
+		}
+		if string(buf) != p.Open {
+			continue
+		}
+		if z.Trace != nil {
+			z.tracef("state: placeholder")
+		}
+		frag := append(z.buf[:0], p.Open...)
+		z.discard(len(p.Open))
+		for p.Close != "" {
+			if n := len(frag) - len(p.Close); n >= len(p.Open) && string(frag[n:]) == p.Close {
+				break
+			}
+			by := z.nextByte()
+			if by == 0 {
+				break // EOF
+			}
+			frag = append(frag, by)
+		}
+		return Token{Type: TokenPlaceholder, Value: z.valueString(frag)}, true
+	}
+	return Token{}, false
+}
+
 // §4.3.14
 func (z *Tokenizer) consumeBadURL() string {
-	var frag []byte
+	if z.Trace != nil {
+		z.tracef("state: remnants of bad url")
+	}
+	frag := z.buf[:0]
 	var by byte
 	for {
 		by = z.nextByte()
 		if by == ')' || by == 0 {
-			return string(frag)
+			return z.valueString(frag)
 		} else if by == '\\' {
 			z.unreadByte()
 			z.repeek()
@@ -917,3 +1446,67 @@ func (z *Tokenizer) consumeBadURL() string {
 		frag = append(frag, by)
 	}
 }
+
+// valueString converts a token value accumulated in the scratch buffer into a
+// string, keeping the (possibly grown) buffer for the next token.
+func (z *Tokenizer) valueString(b []byte) string {
+	z.buf = b[:0]
+	if len(b) == 0 {
+		return ""
+	}
+	// nb: the compiler does not allocate for map lookups of string(b)
+	if s, ok := atoms[string(b)]; ok {
+		return s
+	}
+	if z.Intern != nil && len(b) <= MaxInternedLength {
+		return z.intern(b)
+	}
+	return string(b)
+}
+
+// plainString is valueString for comments and whitespace, which are not
+// interned.
+func (z *Tokenizer) plainString(b []byte) string {
+	z.buf = b[:0]
+	if s, ok := atoms[string(b)]; ok {
+		return s
+	}
+	return string(b)
+}
+
+// MaxInternedLength is the length of the longest token value, other than a
+// name, that is added to Tokenizer.Intern.
+const MaxInternedLength = 32
+
+func (z *Tokenizer) intern(b []byte) string {
+	if s, ok := z.Intern[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	z.Intern[s] = s
+	return s
+}
+
+// nameString is valueString for names: identifiers, function and at-rule
+// names, hash names, and units.  Short names that are not atoms are looked
+// up in the tokenizer's name cache, so that a name repeated throughout a
+// stylesheet is only allocated once.
+func (z *Tokenizer) nameString(b []byte) string {
+	if len(b) == 0 {
+		return z.valueString(b)
+	}
+	z.buf = b[:0]
+	if s, ok := atoms[string(b)]; ok {
+		return s
+	}
+	if z.Intern != nil {
+		return z.intern(b)
+	}
+	if len(b) > maxCachedName {
+		return string(b)
+	}
+	if z.names == nil {
+		z.names = new(nameCache)
+	}
+	return z.names.lookup(b)
+}
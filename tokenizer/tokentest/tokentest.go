@@ -0,0 +1,297 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package tokentest records token streams to golden files and compares them,
+for snapshot tests of code built on the tokenizer.
+
+The golden file format has one token per line: the token type, the quoted
+value, and then the token's Extra data, if any:
+
+	IDENT "color"
+	COLON ":"
+	HASH "fff" id
+	DIMENSION "1.5" nonint unit "em"
+	BAD-STRING "a" code=unterminated-string @5-7 "unterminated string"
+
+A typical test regenerates its golden files when given a flag:
+
+	var update = flag.Bool("update", false, "update golden files")
+
+	func TestOutput(t *testing.T) {
+		toks, _ := tokenizer.TokenizeAll(process(input), nil)
+		tokentest.Golden(t, "testdata/output.golden", toks, *update)
+	}
+*/
+package tokentest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Format returns the golden file representation of toks.
+func Format(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	for _, t := range toks {
+		buf.WriteString(formatToken(t))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func formatToken(t tokenizer.Token) string {
+	s := t.Type.String() + " " + strconv.Quote(t.Value)
+	switch e := t.Extra.(type) {
+	case *tokenizer.TokenExtraHash:
+		if e != nil {
+			s += " " + e.String()
+		}
+	case *tokenizer.TokenExtraNumeric:
+		if e != nil {
+			if e.NonInteger {
+				s += " nonint"
+			} else {
+				s += " int"
+			}
+			if e.Exponent {
+				s += " exponent"
+			}
+			if e.PlusSign {
+				s += " plus"
+			}
+			if e.LeadingDot {
+				s += " dot"
+			}
+			if e.Dimension != "" {
+				s += " unit " + strconv.Quote(e.Dimension)
+			}
+		}
+	case *tokenizer.TokenExtraUnicodeRange:
+		if e != nil {
+			s += fmt.Sprintf(" %X-%X", e.Start, e.End)
+		}
+	case *tokenizer.TokenExtraError:
+		if e == nil || e.Err == nil {
+			break
+		}
+		if pe := e.ParseError(); pe != nil {
+			s += fmt.Sprintf(" code=%s @%d-%d", pe.Code, pe.Loc, pe.End)
+		}
+		s += " " + strconv.Quote(e.Err.Error())
+	}
+	return s
+}
+
+var (
+	typesByName = make(map[string]tokenizer.TokenType)
+	codesByName = make(map[string]tokenizer.ErrorCode)
+)
+
+func init() {
+	for tt := tokenizer.TokenType(0); tt < 256; tt++ {
+		if name := tt.String(); name != "" {
+			typesByName[name] = tt
+		}
+	}
+	for c := tokenizer.ErrorCode(0); c < 256; c++ {
+		if name := c.String(); name != "unknown" {
+			codesByName[name] = c
+		}
+	}
+}
+
+// Parse reads tokens in the golden file format.  Blank lines are ignored.
+func Parse(s string) ([]tokenizer.Token, error) {
+	var toks []tokenizer.Token
+	for i, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		t, err := parseToken(line)
+		if err != nil {
+			return nil, fmt.Errorf("tokentest: line %d: %v", i+1, err)
+		}
+		toks = append(toks, t)
+	}
+	return toks, nil
+}
+
+func parseToken(line string) (tokenizer.Token, error) {
+	var t tokenizer.Token
+	sp := strings.IndexByte(line, ' ')
+	if sp == -1 {
+		return t, fmt.Errorf("missing value")
+	}
+	tt, ok := typesByName[line[:sp]]
+	if !ok {
+		return t, fmt.Errorf("unknown token type %q", line[:sp])
+	}
+	t.Type = tt
+	v, rest, err := cutQuoted(line[sp+1:])
+	if err != nil {
+		return t, err
+	}
+	t.Value = v
+	rest = strings.TrimLeft(rest, " ")
+	if rest == "" {
+		return t, nil
+	}
+
+	switch tokenizer.TokenExtraTypeLookup[tt].(type) {
+	case *tokenizer.TokenExtraHash:
+		if rest != "id" && rest != "unrestricted" {
+			return t, fmt.Errorf("bad hash type %q", rest)
+		}
+		t.Extra = &tokenizer.TokenExtraHash{IsIdentifier: rest == "id"}
+	case *tokenizer.TokenExtraNumeric:
+		e := &tokenizer.TokenExtraNumeric{}
+		if i := strings.Index(rest, "unit "); i != -1 {
+			unit, tail, err := cutQuoted(rest[i+len("unit "):])
+			if err != nil {
+				return t, err
+			}
+			if tail != "" {
+				return t, fmt.Errorf("unexpected %q after unit", tail)
+			}
+			e.Dimension = unit
+			rest = rest[:i]
+		}
+		for _, f := range strings.Fields(rest) {
+			switch f {
+			case "int":
+			case "nonint":
+				e.NonInteger = true
+			case "exponent":
+				e.Exponent = true
+			case "plus":
+				e.PlusSign = true
+			case "dot":
+				e.LeadingDot = true
+			default:
+				return t, fmt.Errorf("unknown number flag %q", f)
+			}
+		}
+		t.Extra = e
+	case *tokenizer.TokenExtraUnicodeRange:
+		var start, end rune
+		if _, err := fmt.Sscanf(rest, "%X-%X", &start, &end); err != nil {
+			return t, fmt.Errorf("bad unicode range %q", rest)
+		}
+		t.Extra = &tokenizer.TokenExtraUnicodeRange{Start: start, End: end}
+	case *tokenizer.TokenExtraError:
+		e := &tokenizer.TokenExtraError{}
+		if strings.HasPrefix(rest, "code=") {
+			var code string
+			pe := &tokenizer.ParseError{Type: tt}
+			fields := strings.SplitN(rest, " ", 3)
+			if len(fields) != 3 {
+				return t, fmt.Errorf("bad error %q", rest)
+			}
+			code = strings.TrimPrefix(fields[0], "code=")
+			if pe.Code, ok = codesByName[code]; !ok {
+				return t, fmt.Errorf("unknown error code %q", code)
+			}
+			if _, err := fmt.Sscanf(fields[1], "@%d-%d", &pe.Loc, &pe.End); err != nil {
+				return t, fmt.Errorf("bad error position %q", fields[1])
+			}
+			if pe.Message, rest, err = cutQuoted(fields[2]); err != nil {
+				return t, err
+			}
+			pe.Token = t
+			e.Err = pe
+		} else {
+			var msg string
+			if msg, rest, err = cutQuoted(rest); err != nil {
+				return t, err
+			}
+			e.Err = fmt.Errorf("%s", msg)
+		}
+		if rest != "" {
+			return t, fmt.Errorf("unexpected %q after error", rest)
+		}
+		t.Extra = e
+	default:
+		return t, fmt.Errorf("unexpected %q after value", rest)
+	}
+	return t, nil
+}
+
+// cutQuoted unquotes the Go-quoted string at the start of s, and returns it
+// along with the rest of s.
+func cutQuoted(s string) (v, rest string, err error) {
+	if s == "" || s[0] != '"' {
+		return "", "", fmt.Errorf("expected quoted string at %q", s)
+	}
+	i := 1
+	for i < len(s) && s[i] != '"' {
+		if s[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(s) {
+		return "", "", fmt.Errorf("unterminated string %q", s)
+	}
+	v, err = strconv.Unquote(s[:i+1])
+	return v, s[i+1:], err
+}
+
+// Diff compares two token streams.  If they are equal, as reported by
+// tokenizer.TokensEqual, it returns "".  Otherwise it returns a description
+// of the first difference, showing the tokens around it in the golden file
+// format.
+func Diff(got, want []tokenizer.Token) string {
+	if tokenizer.TokensEqual(got, want) {
+		return ""
+	}
+	i := 0
+	for i < len(got) && i < len(want) && got[i].Equal(want[i]) {
+		i++
+	}
+	const context = 3
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "token streams differ at token %d (got %d tokens, want %d):\n", i, len(got), len(want))
+	start := i - context
+	if start < 0 {
+		start = 0
+	}
+	for j := start; j < i; j++ {
+		fmt.Fprintf(&buf, "  %4d %s\n", j, formatToken(want[j]))
+	}
+	for j := i; j < i+context && j < len(want); j++ {
+		fmt.Fprintf(&buf, "- %4d %s\n", j, formatToken(want[j]))
+	}
+	for j := i; j < i+context && j < len(got); j++ {
+		fmt.Fprintf(&buf, "+ %4d %s\n", j, formatToken(got[j]))
+	}
+	return buf.String()
+}
+
+// Golden compares got against the tokens recorded in the golden file at
+// path, and reports any difference as a test error.  If update is set, the
+// file is rewritten with got instead.
+func Golden(t testing.TB, path string, got []tokenizer.Token, update bool) {
+	if update {
+		if err := ioutil.WriteFile(path, []byte(Format(got)), 0644); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file: %v", err)
+	}
+	want, err := Parse(string(data))
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if d := Diff(got, want); d != "" {
+		t.Errorf("%s: %s", path, d)
+	}
+}
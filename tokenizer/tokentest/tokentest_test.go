@@ -0,0 +1,75 @@
+// Copyright 2018 Kane York.
+
+package tokentest
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+const testInput = "a #b.c{ margin: -1.5e2em +.5 50%; u+0-7f } \"s\n url(a b) \\\n"
+
+func TestRoundTrip(t *testing.T) {
+	toks, _ := tokenizer.TokenizeAll([]byte(testInput), nil)
+	text := Format(toks)
+	got, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v\n%s", err, text)
+	}
+	if d := Diff(got, toks); d != "" {
+		t.Errorf("round trip: %s", d)
+	}
+	if again := Format(got); again != text {
+		t.Errorf("Format(Parse(s)) != s:\n%s\n%s", again, text)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	toks, _ := tokenizer.TokenizeAll([]byte(testInput), nil)
+	Golden(t, "testdata/tokens.golden", toks, *update)
+}
+
+func TestDiff(t *testing.T) {
+	want, _ := tokenizer.TokenizeAll([]byte("a b c d e f"), nil)
+	got, _ := tokenizer.TokenizeAll([]byte("a b c d x f"), nil)
+	d := Diff(got, want)
+	for _, s := range []string{
+		"differ at token 8 (got 11 tokens, want 11)",
+		"     7 S \" \"\n",
+		"-    8 IDENT \"e\"\n",
+		"+    8 IDENT \"x\"\n",
+	} {
+		if !strings.Contains(d, s) {
+			t.Errorf("diff does not contain %q:\n%s", s, d)
+		}
+	}
+	if d := Diff(want, want); d != "" {
+		t.Errorf("Diff of equal streams: %q", d)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		`IDENT`,
+		`NOPE "a"`,
+		`IDENT a`,
+		`IDENT "a`,
+		`IDENT "a" id`,
+		`HASH "a" maybe`,
+		`NUMBER "1" int huge`,
+		`DIMENSION "1" int unit px`,
+		`UNICODE-RANGE "" 0-`,
+		`BAD-STRING "a" code=nope @1-2 "x"`,
+		`BAD-STRING "a" code=bad-escape 1-2 "x"`,
+		`BAD-STRING "a" "x" y`,
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%s): no error", s)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "fmt"
+
+// tracef writes a line to z.Trace.  Callers check that z.Trace is non-nil
+// first, so that the arguments are not evaluated when tracing is off.
+func (z *Tokenizer) tracef(format string, args ...interface{}) {
+	fmt.Fprintf(z.Trace, format+"\n", args...)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewTransformReader returns a reader that tokenizes r, passes each token
+// through fn, and renders the tokens fn returns.  Returning nil drops the
+// token, and returning several tokens inserts them all.  Comments are
+// inserted where needed to keep adjacent tokens apart, as in TokenRenderer.
+//
+// The transformation is done on the fly as the returned reader is read from,
+// so the whole input never needs to be held in memory.  Read errors from r
+// are returned as-is.
+func NewTransformReader(r io.Reader, fn func(Token) []Token) io.Reader {
+	return &transformReader{
+		z:  NewTokenizer(r),
+		fn: fn,
+	}
+}
+
+type transformReader struct {
+	z   *Tokenizer
+	fn  func(Token) []Token
+	wr  TokenRenderer
+	buf bytes.Buffer
+	err error
+}
+
+func (t *transformReader) Read(p []byte) (int, error) {
+	for t.buf.Len() == 0 && t.err == nil {
+		tok := t.z.Next()
+		switch tok.Type {
+		case TokenEOF:
+			t.err = io.EOF
+		case TokenError:
+			t.err = t.z.Err()
+		default:
+			for _, out := range t.fn(tok) {
+				t.wr.WriteTokenTo(&t.buf, out)
+			}
+		}
+	}
+	if t.buf.Len() > 0 {
+		return t.buf.Read(p)
+	}
+	return 0, t.err
+}
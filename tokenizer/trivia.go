@@ -0,0 +1,84 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "strings"
+
+// TriviaToken is a significant token together with the whitespace and
+// comments around it.  Attaching the trivia to tokens makes it easy for a
+// transform to move, replace, or delete tokens while keeping the formatting
+// and comments that go with them.
+type TriviaToken struct {
+	Token
+	// Leading trivia is everything between the previous token's trailing
+	// trivia and this token.
+	Leading []Token
+	// Trailing trivia is the whitespace and comments after this token on
+	// the same line, up to and including the newline.
+	Trailing []Token
+}
+
+// IsTrivia reports whether t is whitespace or a comment.
+func IsTrivia(t Token) bool {
+	return t.Type == TokenS || t.Type == TokenComment || t.Type == TokenLineComment
+}
+
+// AttachTrivia groups toks into significant tokens with their trivia.  A
+// whitespace token containing a newline is split after the newline, between
+// the trailing trivia of one token and the leading trivia of the next.  The
+// last element of the result is always a TokenEOF, which holds any trivia
+// at the end of the input as its leading trivia.
+//
+// DetachTrivia reverses the grouping.
+func AttachTrivia(toks []Token) []TriviaToken {
+	var out []TriviaToken
+	var leading []Token
+	i := 0
+	for i < len(toks) {
+		t := toks[i]
+		i++
+		if IsTrivia(t) {
+			leading = append(leading, t)
+			continue
+		}
+		if t.Type == TokenEOF {
+			break
+		}
+		tt := TriviaToken{Token: t, Leading: leading}
+		leading = nil
+		for i < len(toks) && IsTrivia(toks[i]) {
+			t := toks[i]
+			i++
+			if t.Type != TokenS {
+				tt.Trailing = append(tt.Trailing, t)
+				continue
+			}
+			nl := strings.IndexByte(t.Value, '\n')
+			if nl == -1 {
+				tt.Trailing = append(tt.Trailing, t)
+				continue
+			}
+			tt.Trailing = append(tt.Trailing, Token{Type: TokenS, Value: t.Value[:nl+1]})
+			if rest := t.Value[nl+1:]; rest != "" {
+				leading = append(leading, Token{Type: TokenS, Value: rest})
+			}
+			break
+		}
+		out = append(out, tt)
+	}
+	return append(out, TriviaToken{Token: Token{Type: TokenEOF}, Leading: leading})
+}
+
+// DetachTrivia flattens tts back into a token stream, including the trivia.
+// The final TokenEOF is not included.
+func DetachTrivia(tts []TriviaToken) []Token {
+	var out []Token
+	for _, tt := range tts {
+		out = append(out, tt.Leading...)
+		if tt.Type != TokenEOF {
+			out = append(out, tt.Token)
+		}
+		out = append(out, tt.Trailing...)
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import (
+	"bytes"
+	"sort"
+	"unicode/utf8"
+)
+
+// Valid reports whether the range is valid as defined by CSS Fonts: the start
+// must not be after the end, and the start must be a valid code point.  Ranges
+// ending past U+10FFFF are valid, but are clipped by Clamp.
+func (e *TokenExtraUnicodeRange) Valid() bool {
+	return e.Start >= 0 && e.Start <= e.End && e.Start <= utf8.MaxRune
+}
+
+// Clamp returns the range with its end clipped to U+10FFFF.  ok is false if
+// the range is not Valid.
+func (e *TokenExtraUnicodeRange) Clamp() (r TokenExtraUnicodeRange, ok bool) {
+	if !e.Valid() {
+		return TokenExtraUnicodeRange{}, false
+	}
+	r = *e
+	if r.End > utf8.MaxRune {
+		r.End = utf8.MaxRune
+	}
+	return r, true
+}
+
+// UnicodeRangeSet is a set of code points, stored as a sorted list of
+// disjoint ranges.  The zero value is the empty set.
+type UnicodeRangeSet struct {
+	// sorted, non-overlapping, and non-adjacent
+	ranges []TokenExtraUnicodeRange
+}
+
+// UnicodeRangeSetFromTokens returns the set covered by all the
+// TokenUnicodeRange tokens in toks, such as the value of a @font-face
+// unicode-range descriptor.  Other tokens, such as commas and whitespace, are
+// ignored, as are invalid ranges.
+func UnicodeRangeSetFromTokens(toks []Token) UnicodeRangeSet {
+	var s UnicodeRangeSet
+	for _, t := range toks {
+		if t.Type != TokenUnicodeRange {
+			continue
+		}
+		if e, ok := t.Extra.(*TokenExtraUnicodeRange); ok && e != nil {
+			if r, ok := e.Clamp(); ok {
+				s.ranges = append(s.ranges, r)
+			}
+		}
+	}
+	s.normalize()
+	return s
+}
+
+// Add adds the code points in r to the set.  Invalid ranges are ignored.
+//
+// Copies of a set are independent: adding to one does not change the others.
+func (s *UnicodeRangeSet) Add(r TokenExtraUnicodeRange) {
+	r, ok := r.Clamp()
+	if !ok {
+		return
+	}
+	// copy rather than sorting in place, as other copies of the set may
+	// share the slice
+	ranges := make([]TokenExtraUnicodeRange, 0, len(s.ranges)+1)
+	ranges = append(ranges, s.ranges...)
+	s.ranges = append(ranges, r)
+	s.normalize()
+}
+
+// Ranges returns the disjoint ranges making up the set, in ascending order.
+func (s UnicodeRangeSet) Ranges() []TokenExtraUnicodeRange {
+	return append([]TokenExtraUnicodeRange(nil), s.ranges...)
+}
+
+// Len returns the number of code points in the set.
+func (s UnicodeRangeSet) Len() int {
+	n := 0
+	for _, r := range s.ranges {
+		n += int(r.End-r.Start) + 1
+	}
+	return n
+}
+
+// Contains reports whether c is in the set.
+func (s UnicodeRangeSet) Contains(c rune) bool {
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].End >= c
+	})
+	return i < len(s.ranges) && s.ranges[i].Start <= c
+}
+
+// Union returns the set of code points in either s or o.
+func (s UnicodeRangeSet) Union(o UnicodeRangeSet) UnicodeRangeSet {
+	var u UnicodeRangeSet
+	u.ranges = make([]TokenExtraUnicodeRange, 0, len(s.ranges)+len(o.ranges))
+	u.ranges = append(u.ranges, s.ranges...)
+	u.ranges = append(u.ranges, o.ranges...)
+	u.normalize()
+	return u
+}
+
+// Intersect returns the set of code points in both s and o.
+func (s UnicodeRangeSet) Intersect(o UnicodeRangeSet) UnicodeRangeSet {
+	var u UnicodeRangeSet
+	i, j := 0, 0
+	for i < len(s.ranges) && j < len(o.ranges) {
+		a, b := s.ranges[i], o.ranges[j]
+		start, end := a.Start, a.End
+		if b.Start > start {
+			start = b.Start
+		}
+		if b.End < end {
+			end = b.End
+		}
+		if start <= end {
+			u.ranges = append(u.ranges, TokenExtraUnicodeRange{Start: start, End: end})
+		}
+		if a.End < b.End {
+			i++
+		} else {
+			j++
+		}
+	}
+	return u
+}
+
+// String returns the set as a comma-separated list of unicode-range tokens.
+func (s UnicodeRangeSet) String() string {
+	var buf bytes.Buffer
+	for i := range s.ranges {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(s.ranges[i].String())
+	}
+	return buf.String()
+}
+
+type byRangeStart []TokenExtraUnicodeRange
+
+func (r byRangeStart) Len() int           { return len(r) }
+func (r byRangeStart) Less(i, j int) bool { return r[i].Start < r[j].Start }
+func (r byRangeStart) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// normalize sorts the ranges and merges ones that overlap or touch.
+func (s *UnicodeRangeSet) normalize() {
+	if len(s.ranges) < 2 {
+		return
+	}
+	sort.Sort(byRangeStart(s.ranges))
+	out := s.ranges[:1]
+	for _, r := range s.ranges[1:] {
+		last := &out[len(out)-1]
+		if r.Start <= last.End+1 {
+			if r.End > last.End {
+				last.End = r.End
+			}
+		} else {
+			out = append(out, r)
+		}
+	}
+	s.ranges = out
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+// UnitKind is the category of a CSS dimension unit.
+type UnitKind int
+
+// The kinds of units recognized by ClassifyUnit.
+const (
+	UnitUnknown UnitKind = iota
+	// Absolute and font-relative lengths, such as px and em.
+	UnitLength
+	// Viewport-percentage lengths, such as vw and dvh.
+	UnitViewportLength
+	// Container query lengths, such as cqi.
+	UnitContainerLength
+	UnitAngle
+	UnitTime
+	UnitFrequency
+	UnitResolution
+	// The fr unit of CSS Grid.
+	UnitFlex
+)
+
+var unitKindNames = map[UnitKind]string{
+	UnitUnknown:         "unknown",
+	UnitLength:          "length",
+	UnitViewportLength:  "viewport-length",
+	UnitContainerLength: "container-length",
+	UnitAngle:           "angle",
+	UnitTime:            "time",
+	UnitFrequency:       "frequency",
+	UnitResolution:      "resolution",
+	UnitFlex:            "flex",
+}
+
+// String returns a lowercase name for the unit kind.
+func (k UnitKind) String() string {
+	return unitKindNames[k]
+}
+
+// IsLength reports whether k is one of the length kinds.
+func (k UnitKind) IsLength() bool {
+	return k == UnitLength || k == UnitViewportLength || k == UnitContainerLength
+}
+
+var unitKinds = map[string]UnitKind{
+	// absolute lengths
+	"px": UnitLength, "cm": UnitLength, "mm": UnitLength, "q": UnitLength,
+	"in": UnitLength, "pt": UnitLength, "pc": UnitLength,
+	// font-relative lengths
+	"em": UnitLength, "rem": UnitLength, "ex": UnitLength, "rex": UnitLength,
+	"cap": UnitLength, "rcap": UnitLength, "ch": UnitLength, "rch": UnitLength,
+	"ic": UnitLength, "ric": UnitLength, "lh": UnitLength, "rlh": UnitLength,
+
+	"vw": UnitViewportLength, "vh": UnitViewportLength,
+	"vi": UnitViewportLength, "vb": UnitViewportLength,
+	"vmin": UnitViewportLength, "vmax": UnitViewportLength,
+	"svw": UnitViewportLength, "svh": UnitViewportLength,
+	"svi": UnitViewportLength, "svb": UnitViewportLength,
+	"svmin": UnitViewportLength, "svmax": UnitViewportLength,
+	"lvw": UnitViewportLength, "lvh": UnitViewportLength,
+	"lvi": UnitViewportLength, "lvb": UnitViewportLength,
+	"lvmin": UnitViewportLength, "lvmax": UnitViewportLength,
+	"dvw": UnitViewportLength, "dvh": UnitViewportLength,
+	"dvi": UnitViewportLength, "dvb": UnitViewportLength,
+	"dvmin": UnitViewportLength, "dvmax": UnitViewportLength,
+
+	"cqw": UnitContainerLength, "cqh": UnitContainerLength,
+	"cqi": UnitContainerLength, "cqb": UnitContainerLength,
+	"cqmin": UnitContainerLength, "cqmax": UnitContainerLength,
+
+	"deg": UnitAngle, "grad": UnitAngle, "rad": UnitAngle, "turn": UnitAngle,
+
+	"s": UnitTime, "ms": UnitTime,
+
+	"hz": UnitFrequency, "khz": UnitFrequency,
+
+	"dpi": UnitResolution, "dpcm": UnitResolution, "dppx": UnitResolution,
+	"x": UnitResolution,
+
+	"fr": UnitFlex,
+}
+
+// ClassifyUnit returns the kind of the CSS unit u, which is matched ASCII
+// case-insensitively.  Unrecognized units, such as typos like "pxx", return
+// UnitUnknown.
+func ClassifyUnit(u string) UnitKind {
+	if k, ok := unitKinds[u]; ok {
+		return k
+	}
+	var lower [8]byte
+	if len(u) > len(lower) {
+		return UnitUnknown
+	}
+	for i := 0; i < len(u); i++ {
+		c := u[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return unitKinds[string(lower[:len(u)])]
+}
+
+// UnitKind classifies the Dimension of the token with ClassifyUnit.
+func (e *TokenExtraNumeric) UnitKind() UnitKind {
+	if e == nil || e.Dimension == "" {
+		return UnitUnknown
+	}
+	return ClassifyUnit(e.Dimension)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package tokenizer
+
+import "io"
+
+// TokenWriter is the interface implemented by consumers of a token stream.
+// Transformations that take a TokenWriter to send their output to can be
+// chained together, with a RenderWriter at the end to produce CSS source.
+type TokenWriter interface {
+	WriteToken(t Token) error
+}
+
+// TokenWriterFunc adapts an ordinary function to the TokenWriter interface.
+type TokenWriterFunc func(t Token) error
+
+// WriteToken calls f(t).
+func (f TokenWriterFunc) WriteToken(t Token) error {
+	return f(t)
+}
+
+// RenderWriter is a TokenWriter that renders tokens to an io.Writer,
+// inserting separators as needed.  The embedded TokenRenderer's options may
+// be changed before the first token is written.
+type RenderWriter struct {
+	TokenRenderer
+	w io.Writer
+}
+
+// NewRenderWriter returns a RenderWriter that writes to w.
+func NewRenderWriter(w io.Writer) *RenderWriter {
+	return &RenderWriter{w: w}
+}
+
+// WriteToken renders t to the underlying io.Writer.
+func (r *RenderWriter) WriteToken(t Token) error {
+	_, err := r.WriteTokenTo(r.w, t)
+	return err
+}
+
+// NewFilterWriter returns a TokenWriter that passes each token through fn
+// and writes the tokens fn returns to w.  As in NewTransformReader,
+// returning nil drops the token and returning several tokens inserts them
+// all.
+func NewFilterWriter(w TokenWriter, fn func(Token) []Token) TokenWriter {
+	return &filterWriter{w: w, fn: fn}
+}
+
+type filterWriter struct {
+	w  TokenWriter
+	fn func(Token) []Token
+}
+
+func (f *filterWriter) WriteToken(t Token) error {
+	for _, out := range f.fn(t) {
+		if err := f.w.WriteToken(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultiTokenWriter returns a TokenWriter that duplicates each token to all
+// of ws, like io.MultiWriter.  Writing stops at the first error.
+func MultiTokenWriter(ws ...TokenWriter) TokenWriter {
+	all := make([]TokenWriter, len(ws))
+	copy(all, ws)
+	return multiTokenWriter(all)
+}
+
+type multiTokenWriter []TokenWriter
+
+func (m multiTokenWriter) WriteToken(t Token) error {
+	for _, w := range m {
+		if err := w.WriteToken(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyTokens writes every token from z to dst, stopping at the end of the
+// input or at the first error.  The final TokenEOF is not written.  A nil
+// error is returned if the whole input was copied.
+func CopyTokens(dst TokenWriter, z *Tokenizer) error {
+	for {
+		t := z.Next()
+		switch t.Type {
+		case TokenEOF:
+			return nil
+		case TokenError:
+			return z.Err()
+		}
+		if err := dst.WriteToken(t); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// namedColors are the color keywords of CSS Color Level 4, including the
+// system colors and the special keywords transparent and currentcolor.
+var namedColors = map[string]bool{}
+
+// namedColorValues are the hex colors of the named colors that are not
+// system colors or currentcolor.
+var namedColorValues = map[string]string{}
+
+func init() {
+	for _, line := range []string{
+		"aliceblue f0f8ff antiquewhite faebd7 aqua 00ffff aquamarine 7fffd4 azure f0ffff",
+		"beige f5f5dc bisque ffe4c4 black 000000 blanchedalmond ffebcd blue 0000ff",
+		"blueviolet 8a2be2 brown a52a2a burlywood deb887 cadetblue 5f9ea0 chartreuse 7fff00",
+		"chocolate d2691e coral ff7f50 cornflowerblue 6495ed cornsilk fff8dc crimson dc143c",
+		"cyan 00ffff darkblue 00008b darkcyan 008b8b darkgoldenrod b8860b darkgray a9a9a9",
+		"darkgreen 006400 darkgrey a9a9a9 darkkhaki bdb76b darkmagenta 8b008b",
+		"darkolivegreen 556b2f darkorange ff8c00 darkorchid 9932cc darkred 8b0000",
+		"darksalmon e9967a darkseagreen 8fbc8f darkslateblue 483d8b darkslategray 2f4f4f",
+		"darkslategrey 2f4f4f darkturquoise 00ced1 darkviolet 9400d3 deeppink ff1493",
+		"deepskyblue 00bfff dimgray 696969 dimgrey 696969 dodgerblue 1e90ff firebrick b22222",
+		"floralwhite fffaf0 forestgreen 228b22 fuchsia ff00ff gainsboro dcdcdc",
+		"ghostwhite f8f8ff gold ffd700 goldenrod daa520 gray 808080 green 008000",
+		"greenyellow adff2f grey 808080 honeydew f0fff0 hotpink ff69b4 indianred cd5c5c",
+		"indigo 4b0082 ivory fffff0 khaki f0e68c lavender e6e6fa lavenderblush fff0f5",
+		"lawngreen 7cfc00 lemonchiffon fffacd lightblue add8e6 lightcoral f08080",
+		"lightcyan e0ffff lightgoldenrodyellow fafad2 lightgray d3d3d3 lightgreen 90ee90",
+		"lightgrey d3d3d3 lightpink ffb6c1 lightsalmon ffa07a lightseagreen 20b2aa",
+		"lightskyblue 87cefa lightslategray 778899 lightslategrey 778899",
+		"lightsteelblue b0c4de lightyellow ffffe0 lime 00ff00 limegreen 32cd32 linen faf0e6",
+		"magenta ff00ff maroon 800000 mediumaquamarine 66cdaa mediumblue 0000cd",
+		"mediumorchid ba55d3 mediumpurple 9370db mediumseagreen 3cb371",
+		"mediumslateblue 7b68ee mediumspringgreen 00fa9a mediumturquoise 48d1cc",
+		"mediumvioletred c71585 midnightblue 191970 mintcream f5fffa mistyrose ffe4e1",
+		"moccasin ffe4b5 navajowhite ffdead navy 000080 oldlace fdf5e6 olive 808000",
+		"olivedrab 6b8e23 orange ffa500 orangered ff4500 orchid da70d6",
+		"palegoldenrod eee8aa palegreen 98fb98 paleturquoise afeeee palevioletred db7093",
+		"papayawhip ffefd5 peachpuff ffdab9 peru cd853f pink ffc0cb plum dda0dd",
+		"powderblue b0e0e6 purple 800080 rebeccapurple 663399 red ff0000 rosybrown bc8f8f",
+		"royalblue 4169e1 saddlebrown 8b4513 salmon fa8072 sandybrown f4a460",
+		"seagreen 2e8b57 seashell fff5ee sienna a0522d silver c0c0c0 skyblue 87ceeb",
+		"slateblue 6a5acd slategray 708090 slategrey 708090 snow fffafa springgreen 00ff7f",
+		"steelblue 4682b4 tan d2b48c teal 008080 thistle d8bfd8 tomato ff6347",
+		"turquoise 40e0d0 violet ee82ee wheat f5deb3 white ffffff whitesmoke f5f5f5",
+		"yellow ffff00 yellowgreen 9acd32 transparent 00000000",
+	} {
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i += 2 {
+			namedColorValues[fields[i]] = fields[i+1]
+			namedColors[fields[i]] = true
+		}
+	}
+	for _, line := range []string{
+		"currentcolor",
+		"accentcolor accentcolortext activetext buttonborder buttonface buttontext canvas",
+		"canvastext field fieldtext graytext highlight highlighttext linktext mark marktext",
+		"selecteditem selecteditemtext visitedtext",
+	} {
+		for _, name := range strings.Fields(line) {
+			namedColors[name] = true
+		}
+	}
+}
+
+var colorFunctions = map[string]bool{
+	"rgb": true, "rgba": true, "hsl": true, "hsla": true, "hwb": true,
+	"lab": true, "lch": true, "oklab": true, "oklch": true, "color": true,
+	"color-mix": true, "light-dark": true, "contrast-color": true,
+}
+
+// IsColor reports whether cv is a color: a hex color, a color keyword, or a
+// color function.  The arguments of color functions are not checked.
+func IsColor(cv []tokenizer.Token) bool {
+	if len(cv) == 1 && cv[0].Type == tokenizer.TokenHash {
+		_, _, _, _, ok := cv[0].HexColor()
+		return ok
+	}
+	if name, _, ok := function(cv); ok {
+		return colorFunctions[name]
+	}
+	return namedColors[keyword(cv)]
+}
+
+// Color is a color in sRGB, with each of R, G, B, and Alpha from 0 to 1.
+// A color outside the sRGB gamut, such as one given by oklch(), may have
+// channels below 0 or above 1.
+type Color struct {
+	R, G, B, Alpha float64
+}
+
+// channel is a channel of the color functions for a color space.
+type channel struct {
+	// name is the name of the channel, such as "r".
+	name string
+	// number and percent are what a number and a percentage written for
+	// the channel are multiplied by.  A hue takes a number of degrees or
+	// an angle instead.
+	number, percent float64
+	hue             bool
+}
+
+// colorSpace is a space colors are written in by the color functions,
+// such as hsl() for HSL.
+type colorSpace struct {
+	channels [3]channel
+	// toSRGB returns the opaque color with the channels in the space, in
+	// the units of the channels: 0 to 1, or degrees for a hue, and fromSRGB
+	// returns the channels of a color.
+	toSRGB   func(ch [3]float64) Color
+	fromSRGB func(c Color) [3]float64
+}
+
+var alphaChannel = channel{"alpha", 1, .01, false}
+
+var (
+	rgbSpace = &colorSpace{
+		[3]channel{{"r", 1.0 / 255, .01, false}, {"g", 1.0 / 255, .01, false}, {"b", 1.0 / 255, .01, false}},
+		func(ch [3]float64) Color { return Color{ch[0], ch[1], ch[2], 1} },
+		func(c Color) [3]float64 { return [3]float64{c.R, c.G, c.B} },
+	}
+	srgbLinearSpace = &colorSpace{
+		[3]channel{{"r", 1, .01, false}, {"g", 1, .01, false}, {"b", 1, .01, false}},
+		func(ch [3]float64) Color { return Color{gammaEncode(ch[0]), gammaEncode(ch[1]), gammaEncode(ch[2]), 1} },
+		func(c Color) [3]float64 { return [3]float64{gammaDecode(c.R), gammaDecode(c.G), gammaDecode(c.B)} },
+	}
+	hslSpace = &colorSpace{
+		[3]channel{{"h", 0, 0, true}, {"s", .01, .01, false}, {"l", .01, .01, false}},
+		func(ch [3]float64) Color { return hslToColor(ch[0], ch[1], ch[2]) },
+		func(c Color) [3]float64 { return c.hsl() },
+	}
+	hwbSpace = &colorSpace{
+		[3]channel{{"h", 0, 0, true}, {"w", .01, .01, false}, {"b", .01, .01, false}},
+		func(ch [3]float64) Color { return hwbToColor(ch[0], ch[1], ch[2]) },
+		func(c Color) [3]float64 {
+			hsl := c.hsl()
+			return [3]float64{hsl[0], math.Min(c.R, math.Min(c.G, c.B)), 1 - math.Max(c.R, math.Max(c.G, c.B))}
+		},
+	}
+	oklabSpace = &colorSpace{
+		[3]channel{{"l", 1, .01, false}, {"a", 1, .004, false}, {"b", 1, .004, false}},
+		func(ch [3]float64) Color { return oklabToColor(ch[0], ch[1], ch[2]) },
+		func(c Color) [3]float64 {
+			l, a, b := c.oklab()
+			return [3]float64{l, a, b}
+		},
+	}
+	oklchSpace = &colorSpace{
+		[3]channel{{"l", 1, .01, false}, {"c", 1, .004, false}, {"h", 0, 0, true}},
+		func(ch [3]float64) Color {
+			h := ch[2] * math.Pi / 180
+			return oklabToColor(ch[0], ch[1]*math.Cos(h), ch[1]*math.Sin(h))
+		},
+		func(c Color) [3]float64 {
+			l, a, b := c.oklab()
+			return [3]float64{l, math.Hypot(a, b), hueDegrees(math.Atan2(b, a) * 180 / math.Pi)}
+		},
+	}
+)
+
+// colorFunctionSpaces are the spaces of the color functions ParseColor
+// parses.
+var colorFunctionSpaces = map[string]*colorSpace{
+	"rgb": rgbSpace, "rgba": rgbSpace, "hsl": hslSpace, "hsla": hslSpace, "hwb": hwbSpace,
+	"oklab": oklabSpace, "oklch": oklchSpace,
+}
+
+// ParseColor parses a color that does not depend on where it is used: a
+// hex color, a color keyword other than currentcolor and the system
+// colors, or an rgb(), rgba(), hsl(), hsla(), hwb(), oklab(), or oklch()
+// function whose arguments are numbers, percentages, angles, or none.
+// Those functions may use the relative color syntax, and color-mix() is
+// parsed too, as ParseRelativeColor and ParseColorMix parse them, if the
+// colors they use can be parsed and Resolve resolves them.  Other color
+// functions, such as lab(), and colors using var() give errors.
+func ParseColor(toks []tokenizer.Token) (Color, error) {
+	cv, err := single(toks, "color")
+	if err != nil {
+		return Color{}, err
+	}
+	return parseColor(cv)
+}
+
+func parseColor(cv []tokenizer.Token) (Color, error) {
+	if len(cv) == 1 && cv[0].Type == tokenizer.TokenHash {
+		if r, g, b, a, ok := cv[0].HexColor(); ok {
+			return Color{float64(r) / 255, float64(g) / 255, float64(b) / 255, float64(a) / 255}, nil
+		}
+	}
+	if hex, ok := namedColorValues[keyword(cv)]; ok {
+		n, _ := strconv.ParseUint(hex, 16, 32)
+		if len(hex) == 6 {
+			n = n<<8 | 0xff
+		}
+		return Color{float64(n>>24) / 255, float64(n>>16&0xff) / 255, float64(n>>8&0xff) / 255, float64(n&0xff) / 255}, nil
+	}
+	name, args, _ := function(cv)
+	switch {
+	case name == "color-mix":
+		m, err := parseColorMix(args)
+		if err != nil {
+			return Color{}, err
+		}
+		return m.Resolve()
+	case isRelative(args):
+		r, err := parseRelativeColor(name, args)
+		if err != nil {
+			return Color{}, err
+		}
+		return r.Resolve()
+	}
+	space, ok := colorFunctionSpaces[name]
+	if !ok {
+		return Color{}, errorf("%q is not a color that can be parsed", render(cv))
+	}
+	ch, alpha, err := parseChannels(space, args)
+	if err != nil {
+		return Color{}, errorf("bad %s(): %v", name, err)
+	}
+	c := space.toSRGB(ch)
+	c.Alpha = alpha
+	return c, nil
+}
+
+// parseChannels parses the arguments of a color function for space, with
+// commas between them as in rgb(0, 0, 0), or without as in
+// rgb(0 0 0 / 50%).
+func parseChannels(space *colorSpace, args []tokenizer.Token) (ch [3]float64, alpha float64, err error) {
+	var cvs [][]tokenizer.Token
+	if parts := parser.SplitCommas(args); len(parts) > 1 {
+		for _, part := range parts {
+			cv, err := single(part, "channel")
+			if err != nil {
+				return ch, 0, err
+			}
+			cvs = append(cvs, cv)
+		}
+	} else {
+		cvs = parser.ComponentValues(args)
+		switch {
+		case len(cvs) == 5 && cvs[3][0].Type == tokenizer.TokenDelim && cvs[3][0].Value == "/":
+			cvs = append(cvs[:3], cvs[4])
+		case len(cvs) != 3:
+			cvs = nil
+		}
+	}
+	if len(cvs) != 3 && len(cvs) != 4 {
+		return ch, 0, errorf("expected 3 channels and an optional alpha, got %q", render(args))
+	}
+	for i := range ch {
+		if ch[i], err = channelValue(space.channels[i], cvs[i]); err != nil {
+			return ch, 0, err
+		}
+	}
+	alpha = 1
+	if len(cvs) == 4 {
+		if alpha, err = channelValue(alphaChannel, cvs[3]); err != nil {
+			return ch, 0, err
+		}
+	}
+	return ch, math.Max(0, math.Min(1, alpha)), nil
+}
+
+// channelValue returns the value of the channel c written as cv, in the
+// units of colorSpace.toSRGB.  The keyword none is zero.
+func channelValue(c channel, cv []tokenizer.Token) (float64, error) {
+	if keyword(cv) == "none" {
+		return 0, nil
+	}
+	bad := errorf("bad %s channel %q", c.name, render(cv))
+	if len(cv) != 1 {
+		return 0, bad
+	}
+	t := cv[0]
+	f, ok := t.Float()
+	switch {
+	case !ok:
+	case t.Type == tokenizer.TokenNumber && c.hue:
+		return f, nil
+	case t.Type == tokenizer.TokenNumber:
+		return f * c.number, nil
+	case t.Type == tokenizer.TokenPercentage && !c.hue:
+		return f * c.percent, nil
+	case t.Type == tokenizer.TokenDimension && c.hue:
+		if deg, ok := angle(t); ok {
+			return deg, nil
+		}
+	}
+	return 0, bad
+}
+
+// hslToColor returns the color with hue h, in degrees, and saturation and
+// lightness s and l, from 0 to 1.
+func hslToColor(h, s, l float64) Color {
+	h = hueDegrees(h)
+	a := s * math.Min(l, 1-l)
+	f := func(n float64) float64 {
+		k := math.Mod(n+h/30, 12)
+		return l - a*math.Max(-1, math.Min(math.Min(k-3, 9-k), 1))
+	}
+	return Color{f(0), f(8), f(4), 1}
+}
+
+// hsl returns the hue, in degrees, and the saturation and lightness, from
+// 0 to 1, of c.  The hue of a gray is 0.
+func (c Color) hsl() [3]float64 {
+	max := math.Max(c.R, math.Max(c.G, c.B))
+	min := math.Min(c.R, math.Min(c.G, c.B))
+	l := (max + min) / 2
+	d := max - min
+	if d == 0 || l <= 0 || l >= 1 {
+		return [3]float64{0, 0, l}
+	}
+	var h float64
+	switch max {
+	case c.R:
+		h = (c.G-c.B)/d + 6
+	case c.G:
+		h = (c.B-c.R)/d + 2
+	default:
+		h = (c.R-c.G)/d + 4
+	}
+	return [3]float64{hueDegrees(h * 60), d / (1 - math.Abs(2*l-1)), l}
+}
+
+// hueDegrees returns the hue h, in degrees, from 0 to 360.
+func hueDegrees(h float64) float64 {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// hwbToColor returns the color with hue h, in degrees, and whiteness and
+// blackness w and b, from 0 to 1.
+func hwbToColor(h, w, b float64) Color {
+	if w+b >= 1 {
+		gray := w / (w + b)
+		return Color{gray, gray, gray, 1}
+	}
+	c := hslToColor(h, 1, .5)
+	mix := func(v float64) float64 { return v*(1-w-b) + w }
+	return Color{mix(c.R), mix(c.G), mix(c.B), 1}
+}
+
+// oklabToColor returns the color with the OKLab coordinates l, a, and b.
+func oklabToColor(l, a, b float64) Color {
+	lc := cube(l + .3963377774*a + .2158037573*b)
+	mc := cube(l - .1055613458*a - .0638541728*b)
+	sc := cube(l - .0894841775*a - 1.2914855480*b)
+	return Color{
+		gammaEncode(4.0767416621*lc - 3.3077115913*mc + .2309699292*sc),
+		gammaEncode(-1.2684380046*lc + 2.6097574011*mc - .3413193965*sc),
+		gammaEncode(-.0041960863*lc - .7034186147*mc + 1.7076147010*sc),
+		1,
+	}
+}
+
+// oklab returns the OKLab coordinates of c.
+func (c Color) oklab() (l, a, b float64) {
+	r, g, bl := gammaDecode(c.R), gammaDecode(c.G), gammaDecode(c.B)
+	lc := math.Cbrt(.4122214708*r + .5363325363*g + .0514459929*bl)
+	mc := math.Cbrt(.2119034982*r + .6806995451*g + .1073969566*bl)
+	sc := math.Cbrt(.0883024619*r + .2817188376*g + .6299787005*bl)
+	return .2104542553*lc + .7936177850*mc - .0040720468*sc,
+		1.9779984951*lc - 2.4285922050*mc + .4505937099*sc,
+		.0259040371*lc + .7827717662*mc - .8086757660*sc
+}
+
+func cube(x float64) float64 { return x * x * x }
+
+// gammaEncode returns the sRGB channel for the linear-light value v.
+func gammaEncode(v float64) float64 {
+	if math.Abs(v) <= .0031308 {
+		return 12.92 * v
+	}
+	return math.Copysign(1.055*math.Pow(math.Abs(v), 1/2.4)-.055, v)
+}
+
+// gammaDecode returns the linear-light value of the sRGB channel v.
+func gammaDecode(v float64) float64 {
+	if math.Abs(v) <= .04045 {
+		return v / 12.92
+	}
+	return math.Copysign(math.Pow((math.Abs(v)+.055)/1.055, 2.4), v)
+}
+
+// Hex returns c as a hex color, such as "#ff0000", or "#ff000080" if it
+// is not opaque, with its channels clipped to the sRGB gamut.
+func (c Color) Hex() string {
+	byteOf := func(v float64) int {
+		return int(math.Floor(math.Max(0, math.Min(1, v))*255 + .5))
+	}
+	hex := fmt.Sprintf("#%02x%02x%02x", byteOf(c.R), byteOf(c.G), byteOf(c.B))
+	if a := byteOf(c.Alpha); a != 255 {
+		hex += fmt.Sprintf("%02x", a)
+	}
+	return hex
+}
+
+// Luminance returns the relative luminance of c, as WCAG defines it, from
+// 0 for black to 1 for white.  Alpha is ignored.
+func (c Color) Luminance() float64 {
+	lin := func(v float64) float64 { return gammaDecode(math.Max(0, math.Min(1, v))) }
+	return .2126*lin(c.R) + .7152*lin(c.G) + .0722*lin(c.B)
+}
+
+// over returns c composited over the opaque color bg.
+func (c Color) over(bg Color) Color {
+	mix := func(v, b float64) float64 { return v*c.Alpha + b*(1-c.Alpha) }
+	return Color{mix(c.R, bg.R), mix(c.G, bg.G), mix(c.B, bg.B), 1}
+}
+
+// ContrastRatio returns the WCAG contrast ratio of text in the color fg on
+// the background bg, from 1 to 21.  A background that is not opaque is
+// taken to be on white, and text that is not opaque on the background.
+func ContrastRatio(fg, bg Color) float64 {
+	bg = bg.over(Color{1, 1, 1, 1})
+	l1, l2 := fg.over(bg).Luminance(), bg.Luminance()
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + .05) / (l2 + .05)
+}
+
+// DeltaE returns the difference between a and b as ΔEOK of CSS Color
+// Level 4: their distance in OKLab, where a difference of about 0.02 is
+// just noticeable.  Alpha is ignored.
+func DeltaE(a, b Color) float64 {
+	l1, a1, b1 := a.oklab()
+	l2, a2, b2 := b.oklab()
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
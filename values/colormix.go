@@ -0,0 +1,441 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"math"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// ColorMix is a color-mix() function, such as
+// color-mix(in oklch, red 40%, blue).
+type ColorMix struct {
+	// Interpolation holds the keywords of the color interpolation method,
+	// without the "in", such as ["oklch", "longer", "hue"], as in
+	// Gradient.  It is empty if the function gives none, which mixes in
+	// oklab.
+	Interpolation []string
+	// Colors are the two colors mixed.
+	Colors [2]MixColor
+}
+
+// MixColor is a color of a ColorMix.
+type MixColor struct {
+	Color []tokenizer.Token
+	// Percentage is how much of the color is in the mix, as a percentage
+	// or a math function such as calc(), or nil if the function does not
+	// say.
+	Percentage []tokenizer.Token
+}
+
+// RelativeColor is a color function using the relative color syntax, such
+// as rgb(from var(--c) r g b / 0.5), whose channels can use those of the
+// origin color by name.
+type RelativeColor struct {
+	// Function is the lowercased name of the function, such as "rgb".
+	Function string
+	Origin   []tokenizer.Token
+	// Channels are the three channels, and Alpha the alpha, or nil for
+	// that of the origin color.  Each is a number, percentage, or angle, a
+	// keyword such as none or a channel name, or a math function such as
+	// calc(l + 0.1).
+	Channels [3][]tokenizer.Token
+	Alpha    []tokenizer.Token
+}
+
+// interpolationSpaces are the color spaces of color interpolation
+// methods, and whether they are polar, with a hue.
+var interpolationSpaces = map[string]bool{
+	"srgb": false, "srgb-linear": false, "display-p3": false, "a98-rgb": false,
+	"prophoto-rgb": false, "rec2020": false, "lab": false, "oklab": false,
+	"xyz": false, "xyz-d50": false, "xyz-d65": false,
+	"hsl": true, "hwb": true, "lch": true, "oklch": true,
+}
+
+// mixSpaces are the interpolation spaces ColorMix.Resolve can mix in.
+var mixSpaces = map[string]*colorSpace{
+	"srgb": rgbSpace, "srgb-linear": srgbLinearSpace, "hsl": hslSpace, "hwb": hwbSpace,
+	"oklab": oklabSpace, "oklch": oklchSpace,
+}
+
+// ParseColorMix parses a color-mix() function.  The colors are not
+// checked, so they may use var().
+func ParseColorMix(toks []tokenizer.Token) (*ColorMix, error) {
+	cv, err := single(toks, "color")
+	if err != nil {
+		return nil, err
+	}
+	if !isFunction(cv, "color-mix") {
+		return nil, errorf("expected color-mix()")
+	}
+	_, args, _ := function(cv)
+	return parseColorMix(args)
+}
+
+func parseColorMix(args []tokenizer.Token) (*ColorMix, error) {
+	m := &ColorMix{}
+	parts := parser.SplitCommas(args)
+	if len(parts) > 0 && len(parts[0]) > 0 && keyword(parts[0][:1]) == "in" {
+		for _, cv := range parser.ComponentValues(parts[0])[1:] {
+			m.Interpolation = append(m.Interpolation, keyword(cv))
+		}
+		in := m.Interpolation
+		switch polar, ok := interpolationSpaces[first(in)]; {
+		case ok && len(in) == 1:
+		case ok && len(in) == 3 && polar && hueMethods[in[1]] && in[2] == "hue":
+		default:
+			return nil, errorf("bad color interpolation method %q", render(parts[0]))
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 2 {
+		return nil, errorf("expected two colors to mix, got %q", render(args))
+	}
+	for i, part := range parts {
+		for _, cv := range parser.ComponentValues(part) {
+			switch {
+			case isLengthLike(cv) && m.Colors[i].Percentage == nil:
+				f, _ := cv[0].Float()
+				switch cv[0].Type {
+				case tokenizer.TokenFunction:
+				case tokenizer.TokenPercentage:
+					if f < 0 || f > 100 {
+						return nil, errorf("percentage %q out of range", render(cv))
+					}
+				default:
+					return nil, errorf("bad percentage %q", render(cv))
+				}
+				m.Colors[i].Percentage = cv
+			case m.Colors[i].Color == nil:
+				m.Colors[i].Color = cv
+			default:
+				return nil, errorf("expected a color and a percentage, got %q", render(part))
+			}
+		}
+		if m.Colors[i].Color == nil {
+			return nil, errorf("expected a color, got %q", render(part))
+		}
+	}
+	return m, nil
+}
+
+// Resolve returns the color m mixes, if ParseColor can parse both colors
+// and the percentages are percentages, as CSS Color Level 5 mixes them,
+// with premultiplied alpha.  Only the srgb, srgb-linear, hsl, hwb,
+// oklab, and oklch spaces are supported.
+func (m *ColorMix) Resolve() (Color, error) {
+	name, hue := "oklab", "shorter"
+	if len(m.Interpolation) > 0 {
+		name = m.Interpolation[0]
+	}
+	if len(m.Interpolation) == 3 {
+		hue = m.Interpolation[1]
+	}
+	space, ok := mixSpaces[name]
+	if !ok {
+		return Color{}, errorf("cannot mix colors in %s", name)
+	}
+	var colors [2]Color
+	var ps [2]float64
+	var given [2]bool
+	for i, mc := range m.Colors {
+		c, err := ParseColor(mc.Color)
+		if err != nil {
+			return Color{}, err
+		}
+		colors[i] = c
+		if mc.Percentage != nil {
+			f, ok := mc.Percentage[0].Float()
+			if !ok || mc.Percentage[0].Type != tokenizer.TokenPercentage {
+				return Color{}, errorf("percentage %q cannot be resolved", render(mc.Percentage))
+			}
+			ps[i], given[i] = f, true
+		}
+	}
+	switch {
+	case !given[0] && !given[1]:
+		ps = [2]float64{50, 50}
+	case !given[1]:
+		ps[1] = 100 - ps[0]
+	case !given[0]:
+		ps[0] = 100 - ps[1]
+	}
+	sum := ps[0] + ps[1]
+	if sum == 0 {
+		return Color{}, errorf("percentages add up to zero")
+	}
+	t := ps[1] / sum
+
+	ch1, ch2 := space.fromSRGB(colors[0]), space.fromSRGB(colors[1])
+	var ch [3]float64
+	alpha := colors[0].Alpha*(1-t) + colors[1].Alpha*t
+	for i, c := range space.channels {
+		if c.hue {
+			h1, h2 := ch1[i], ch2[i]
+			// The hue of a gray means nothing, so the other is used.
+			switch {
+			case powerless(space, ch1) && powerless(space, ch2):
+				h1, h2 = 0, 0
+			case powerless(space, ch1):
+				h1 = h2
+			case powerless(space, ch2):
+				h2 = h1
+			}
+			h1, h2 = fixupHues(h1, h2, hue)
+			ch[i] = hueDegrees(h1*(1-t) + h2*t)
+			continue
+		}
+		// premultiplied by alpha
+		v := ch1[i]*colors[0].Alpha*(1-t) + ch2[i]*colors[1].Alpha*t
+		if alpha != 0 {
+			v /= alpha
+		}
+		ch[i] = v
+	}
+	c := space.toSRGB(ch)
+	c.Alpha = alpha
+	if sum < 100 {
+		c.Alpha *= sum / 100
+	}
+	return c, nil
+}
+
+// first returns the first of list, or "".
+func first(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0]
+}
+
+// powerless reports whether the hue of the channels ch of space has no
+// effect on the color, as for a gray.
+func powerless(space *colorSpace, ch [3]float64) bool {
+	const epsilon = 1e-4
+	switch space {
+	case hslSpace:
+		return ch[1] < epsilon
+	case hwbSpace:
+		return ch[1]+ch[2] >= 1-epsilon
+	case oklchSpace:
+		return ch[1] < epsilon
+	}
+	return false
+}
+
+// fixupHues adjusts the hues h1 and h2, in degrees from 0 to 360, for
+// interpolating between them with the hue interpolation method.
+func fixupHues(h1, h2 float64, method string) (float64, float64) {
+	d := h2 - h1
+	switch method {
+	case "shorter":
+		if d > 180 {
+			h1 += 360
+		} else if d < -180 {
+			h2 += 360
+		}
+	case "longer":
+		if d > 0 && d < 180 {
+			h1 += 360
+		} else if d > -180 && d <= 0 {
+			h2 += 360
+		}
+	case "increasing":
+		if d < 0 {
+			h2 += 360
+		}
+	case "decreasing":
+		if d > 0 {
+			h1 += 360
+		}
+	}
+	return h1, h2
+}
+
+// ParseRelativeColor parses a color function using the relative color
+// syntax, one of those ParseColor parses.  The origin color is not
+// checked, so it may use var().
+func ParseRelativeColor(toks []tokenizer.Token) (*RelativeColor, error) {
+	cv, err := single(toks, "color")
+	if err != nil {
+		return nil, err
+	}
+	name, args, ok := function(cv)
+	if !ok || !isRelative(args) {
+		return nil, errorf("expected a color function with \"from\"")
+	}
+	return parseRelativeColor(name, args)
+}
+
+// isRelative reports whether args, the arguments of a color function, use
+// the relative color syntax.
+func isRelative(args []tokenizer.Token) bool {
+	cvs := parser.ComponentValues(args)
+	return len(cvs) > 0 && keyword(cvs[0]) == "from"
+}
+
+func parseRelativeColor(name string, args []tokenizer.Token) (*RelativeColor, error) {
+	if colorFunctionSpaces[name] == nil {
+		return nil, errorf("relative %s() is not supported", name)
+	}
+	r := &RelativeColor{Function: name}
+	cvs := parser.ComponentValues(args)
+	switch {
+	case len(cvs) == 7 && cvs[5][0].Type == tokenizer.TokenDelim && cvs[5][0].Value == "/":
+		r.Alpha = cvs[6]
+	case len(cvs) != 5:
+		return nil, errorf("bad %s(): expected an origin color, 3 channels, and an optional alpha, got %q", name, render(args))
+	}
+	r.Origin = cvs[1]
+	copy(r.Channels[:], cvs[2:5])
+	return r, nil
+}
+
+// Resolve returns the color r gives, if ParseColor can parse its origin
+// color.  The math functions in the channels may only use calc() and
+// parentheses, with numbers and channel names.
+func (r *RelativeColor) Resolve() (Color, error) {
+	origin, err := ParseColor(r.Origin)
+	if err != nil {
+		return Color{}, err
+	}
+	space := colorFunctionSpaces[r.Function]
+	// The channel names are numbers, as they would be written for the
+	// channel, such as 255 for an r of 1.
+	names := map[string]float64{"alpha": origin.Alpha}
+	for i, v := range space.fromSRGB(origin) {
+		c := space.channels[i]
+		if !c.hue {
+			v /= c.number
+		}
+		names[c.name] = v
+	}
+	var ch [3]float64
+	for i, cv := range r.Channels {
+		if ch[i], err = relativeChannel(space.channels[i], cv, names); err != nil {
+			return Color{}, errorf("bad %s(): %v", r.Function, err)
+		}
+	}
+	alpha := origin.Alpha
+	if r.Alpha != nil {
+		if alpha, err = relativeChannel(alphaChannel, r.Alpha, names); err != nil {
+			return Color{}, errorf("bad %s(): %v", r.Function, err)
+		}
+	}
+	c := space.toSRGB(ch)
+	c.Alpha = math.Max(0, math.Min(1, alpha))
+	return c, nil
+}
+
+// relativeChannel returns the value of the channel c written as cv, as
+// channelValue does, where cv may also be one of the channel names or
+// calc() using them.
+func relativeChannel(c channel, cv []tokenizer.Token, names map[string]float64) (float64, error) {
+	f, ok := names[keyword(cv)]
+	if !ok && isFunction(cv, "calc") {
+		var err error
+		if f, err = evalCalc(cv, names); err != nil {
+			return 0, err
+		}
+		ok = true
+	}
+	if !ok {
+		return channelValue(c, cv)
+	}
+	if c.hue {
+		return f, nil
+	}
+	return f * c.number, nil
+}
+
+// evalCalc returns the value of the calc() or parenthesized sum cv, whose
+// operands are numbers and the names in names.
+func evalCalc(cv []tokenizer.Token, names map[string]float64) (float64, error) {
+	e := &calcEval{cvs: parser.ComponentValues(cv[1 : len(cv)-1]), names: names}
+	f := e.sum()
+	if e.err == nil && e.i < len(e.cvs) {
+		e.err = errorf("unexpected %q in %q", render(e.cvs[e.i]), render(cv))
+	}
+	return f, e.err
+}
+
+// calcEval evaluates the component values of a math function, keeping the
+// first error.
+type calcEval struct {
+	cvs   [][]tokenizer.Token
+	i     int
+	names map[string]float64
+	err   error
+}
+
+// op returns the operator at the current component value, if it is one of
+// ops.
+func (e *calcEval) op(ops string) string {
+	if e.i < len(e.cvs) {
+		if t := e.cvs[e.i][0]; t.Type == tokenizer.TokenDelim && len(t.Value) == 1 && len(e.cvs[e.i]) == 1 {
+			for _, op := range ops {
+				if t.Value == string(op) {
+					return t.Value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (e *calcEval) sum() float64 {
+	f := e.product()
+	for op := e.op("+-"); op != ""; op = e.op("+-") {
+		e.i++
+		g := e.product()
+		if op == "+" {
+			f += g
+		} else {
+			f -= g
+		}
+	}
+	return f
+}
+
+func (e *calcEval) product() float64 {
+	f := e.value()
+	for op := e.op("*/"); op != ""; op = e.op("*/") {
+		e.i++
+		g := e.value()
+		if op == "*" {
+			f *= g
+		} else {
+			f /= g
+		}
+	}
+	return f
+}
+
+func (e *calcEval) value() float64 {
+	if e.err != nil {
+		return 0
+	}
+	if e.i == len(e.cvs) {
+		e.err = errorf("unexpected end of calc()")
+		return 0
+	}
+	cv := e.cvs[e.i]
+	e.i++
+	if f, ok := e.names[keyword(cv)]; ok {
+		return f
+	}
+	if isFunction(cv, "calc") || len(cv) > 1 && cv[0].Type == tokenizer.TokenOpenParen {
+		f, err := evalCalc(cv, e.names)
+		if err != nil {
+			e.err = err
+		}
+		return f
+	}
+	if f, ok := cv[0].Float(); ok && cv[0].Type == tokenizer.TokenNumber {
+		return f
+	}
+	e.err = errorf("%q cannot be evaluated", render(cv))
+	return 0
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// condensable is a shorthand that CondenseLonghands can write, with its
+// longhands and a function joining their values into its value.
+type condensable struct {
+	shorthand string
+	longhands []string
+	join      func(vals [][]tokenizer.Token) []tokenizer.Token
+}
+
+// condensables are tried in order, so the shorthands for one property of
+// all four sides, such as border-width, win over those for all the
+// properties of one side, such as border-top, which would take four
+// declarations instead of three.
+//
+// The border, background, and font shorthands are left out, as they also
+// reset properties that have no place in their values, such as
+// border-image.
+var condensables = []condensable{
+	{"margin", box("margin"), joinBox},
+	{"padding", box("padding"), joinBox},
+	{"inset", box("inset"), joinBox},
+	{"border-width", box("border-width"), joinBox},
+	{"border-style", box("border-style"), joinBox},
+	{"border-color", box("border-color"), joinBox},
+	{"border-top", borderLonghands("top"), joinBorder},
+	{"border-right", borderLonghands("right"), joinBorder},
+	{"border-bottom", borderLonghands("bottom"), joinBorder},
+	{"border-left", borderLonghands("left"), joinBorder},
+	{"flex", []string{"flex-grow", "flex-shrink", "flex-basis"}, joinFlex},
+	{"flex-flow", []string{"flex-direction", "flex-wrap"}, joinWithout("row", "nowrap")},
+	{"gap", []string{"row-gap", "column-gap"}, joinPair},
+	{"overflow", []string{"overflow-x", "overflow-y"}, joinPair},
+}
+
+func box(shorthand string) []string {
+	sides := boxSides[shorthand]
+	return sides[:]
+}
+
+func borderLonghands(side string) []string {
+	return []string{"border-" + side + "-width", "border-" + side + "-style", "border-" + side + "-color"}
+}
+
+// CondenseLonghands returns the declarations of a block with each complete
+// set of longhands of a shorthand, such as the four margin-* properties,
+// replaced by the shorthand in its shortest form.  The shorthand takes the
+// place of the last of its longhands.
+//
+// A set is only replaced if that gives the same result: its declarations
+// must all be !important or all not, must not use var(), and must not have
+// a declaration of an overlapping property, such as margin-inline, between
+// them.  A CSS-wide keyword is only condensed if every longhand has it.
+func CondenseLonghands(decls []parser.Declaration) []parser.Declaration {
+	out := make([]parser.Declaration, len(decls))
+	copy(out, decls)
+	for _, c := range condensables {
+		out = c.condense(out)
+	}
+	return out
+}
+
+func (c condensable) condense(decls []parser.Declaration) []parser.Declaration {
+	// the last declaration of each longhand
+	pos := make([]int, len(c.longhands))
+	for i, name := range c.longhands {
+		pos[i] = -1
+		for j := len(decls) - 1; j >= 0; j-- {
+			if tokenizer.IdentEquals(decls[j].Name, name) {
+				pos[i] = j
+				break
+			}
+		}
+		if pos[i] < 0 {
+			return decls
+		}
+	}
+	lo, hi := pos[0], pos[0]
+	used := make(map[int]bool)
+	vals := make([][]tokenizer.Token, len(pos))
+	var wide string
+	for i, j := range pos {
+		d := decls[j]
+		vals[i] = trim(d.Value)
+		if d.Important != decls[pos[0]].Important || usesVar(d.Value) {
+			return decls
+		}
+		kw := keyword(vals[i])
+		if !cssWideKeywords[kw] {
+			kw = ""
+		}
+		if i > 0 && kw != wide {
+			return decls
+		}
+		wide = kw
+		if j < lo {
+			lo = j
+		}
+		if j > hi {
+			hi = j
+		}
+		used[j] = true
+	}
+	for j := lo + 1; j < hi; j++ {
+		if c.overlaps(decls[j].Name) {
+			return decls
+		}
+	}
+
+	value := vals[0]
+	if wide == "" {
+		value = c.join(vals)
+	}
+	out := make([]parser.Declaration, 0, len(decls))
+	for j, d := range decls {
+		switch {
+		case j == hi:
+			out = append(out, parser.Declaration{Name: c.shorthand, Value: value, Important: d.Important, Index: d.Index})
+		case !used[j]:
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// overlaps reports whether the named property may set any of the
+// longhands of c, other than being one of them: the shorthands that expand
+// to one of them, and the flow-relative properties of the same family,
+// such as margin-inline for margin.  Earlier declarations of the longhands
+// are overridden by the last ones whether or not the set is condensed.
+func (c condensable) overlaps(name string) bool {
+	name = strings.ToLower(name)
+	if name == c.shorthand {
+		return true
+	}
+	if c.isLonghand(name) {
+		return false
+	}
+	if initial, ok := initialValues[name]; ok {
+		longhands, _ := ExpandShorthand(parser.Declaration{Name: name, Value: initial})
+		for _, d := range longhands {
+			if c.isLonghand(d.Name) {
+				return true
+			}
+		}
+	}
+	family := c.shorthand
+	if i := strings.IndexByte(family, '-'); i >= 0 {
+		family = family[:i]
+	}
+	return strings.HasPrefix(name, family) && (strings.Contains(name, "-inline") || strings.Contains(name, "-block"))
+}
+
+func (c condensable) isLonghand(name string) bool {
+	for _, l := range c.longhands {
+		if name == l {
+			return true
+		}
+	}
+	return false
+}
+
+func usesVar(toks []tokenizer.Token) bool {
+	for _, t := range toks {
+		if t.Type == tokenizer.TokenFunction && tokenizer.IdentEquals(t.Value, "var") {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue reports whether a and b are the same value, ignoring
+// whitespace and comments.
+func sameValue(a, b []tokenizer.Token) bool {
+	ca, cb := parser.ComponentValues(a), parser.ComponentValues(b)
+	if len(ca) != len(cb) {
+		return false
+	}
+	for i := range ca {
+		if render(ca[i]) != render(cb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// joinBox writes the values of the four sides, top, right, bottom, and
+// left, with as few values as the repeating rules allow.
+func joinBox(v [][]tokenizer.Token) []tokenizer.Token {
+	n := 4
+	if sameValue(v[1], v[3]) {
+		n = 3
+		if sameValue(v[0], v[2]) {
+			n = 2
+			if sameValue(v[0], v[1]) {
+				n = 1
+			}
+		}
+	}
+	return joinValues(v[:n])
+}
+
+func joinPair(v [][]tokenizer.Token) []tokenizer.Token {
+	if sameValue(v[0], v[1]) {
+		return v[0]
+	}
+	return joinValues(v)
+}
+
+// joinWithout returns a join function that leaves out the values that are
+// the given initial values, keeping the first value if all are.
+func joinWithout(initial ...string) func([][]tokenizer.Token) []tokenizer.Token {
+	return func(v [][]tokenizer.Token) []tokenizer.Token {
+		var keep [][]tokenizer.Token
+		for i, val := range v {
+			if !strings.EqualFold(render(val), initial[i]) {
+				keep = append(keep, val)
+			}
+		}
+		if keep == nil {
+			keep = v[:1]
+		}
+		return joinValues(keep)
+	}
+}
+
+// joinBorder writes the width, style, and color of a border side, leaving
+// out those that are the initial values.  If all are, it gives none.
+func joinBorder(v [][]tokenizer.Token) []tokenizer.Token {
+	return joinWithout("none", "medium", "currentcolor")([][]tokenizer.Token{v[1], v[0], v[2]})
+}
+
+func joinFlex(v [][]tokenizer.Token) []tokenizer.Token {
+	grow, shrink, basis := render(v[0]), render(v[1]), strings.ToLower(render(v[2]))
+	switch {
+	case grow == "0" && shrink == "0" && basis == "auto":
+		return value("none")
+	case grow == "1" && shrink == "1" && basis == "auto":
+		return value("auto")
+	case shrink == "1" && basis == "0":
+		return v[0]
+	}
+	return joinValues(v)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"math"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// ParseEasing parses an <easing-function>, as used by transition-timing-
+// function and animation-timing-function, and returns it as a function from
+// input progress to output progress.  Inputs outside [0, 1] are
+// extrapolated as the specification describes.
+func ParseEasing(toks []tokenizer.Token) (func(t float64) float64, error) {
+	cv, err := single(toks, "easing function")
+	if err != nil {
+		return nil, err
+	}
+	switch keyword(cv) {
+	case "linear":
+		return func(t float64) float64 { return t }, nil
+	case "ease":
+		return cubicBezier(0.25, 0.1, 0.25, 1), nil
+	case "ease-in":
+		return cubicBezier(0.42, 0, 1, 1), nil
+	case "ease-out":
+		return cubicBezier(0, 0, 0.58, 1), nil
+	case "ease-in-out":
+		return cubicBezier(0.42, 0, 0.58, 1), nil
+	case "step-start":
+		return steps(1, "jump-start"), nil
+	case "step-end":
+		return steps(1, "jump-end"), nil
+	}
+	name, args, ok := function(cv)
+	if !ok {
+		return nil, errorf("expected an easing function, got %q", render(cv))
+	}
+	parts := parser.SplitCommas(args)
+	switch name {
+	case "cubic-bezier":
+		var p [4]float64
+		if len(parts) != 4 {
+			return nil, errorf("cubic-bezier() takes 4 arguments")
+		}
+		for i, part := range parts {
+			if len(part) != 1 || part[0].Type != tokenizer.TokenNumber {
+				return nil, errorf("bad argument %q to cubic-bezier()", render(part))
+			}
+			p[i], _ = part[0].Float()
+		}
+		if p[0] < 0 || p[0] > 1 || p[2] < 0 || p[2] > 1 {
+			return nil, errorf("cubic-bezier() x values must be between 0 and 1")
+		}
+		return cubicBezier(p[0], p[1], p[2], p[3]), nil
+	case "steps":
+		if len(parts) < 1 || len(parts) > 2 {
+			return nil, errorf("steps() takes 1 or 2 arguments")
+		}
+		if len(parts[0]) != 1 || parts[0][0].Type != tokenizer.TokenNumber {
+			return nil, errorf("bad step count %q", render(parts[0]))
+		}
+		n, ok := parts[0][0].Int()
+		if !ok {
+			return nil, errorf("bad step count %q", render(parts[0]))
+		}
+		pos := "jump-end"
+		if len(parts) == 2 {
+			pos = keyword(parts[1])
+			switch pos {
+			case "start":
+				pos = "jump-start"
+			case "end":
+				pos = "jump-end"
+			case "jump-start", "jump-end", "jump-none", "jump-both":
+			default:
+				return nil, errorf("bad step position %q", render(parts[1]))
+			}
+		}
+		if n < 1 || pos == "jump-none" && n < 2 {
+			return nil, errorf("too few steps for %s", pos)
+		}
+		return steps(int(n), pos), nil
+	case "linear":
+		return linearStops(parts)
+	}
+	return nil, errorf("unknown easing function %q", cv[0].Value)
+}
+
+// cubicBezier returns the easing of a cubic Bézier curve from (0, 0) to
+// (1, 1) with the control points (x1, y1) and (x2, y2).
+func cubicBezier(x1, y1, x2, y2 float64) func(float64) float64 {
+	// polynomial coefficients of x(s) and y(s)
+	cx := 3 * x1
+	bx := 3*(x2-x1) - cx
+	ax := 1 - cx - bx
+	cy := 3 * y1
+	by := 3*(y2-y1) - cy
+	ay := 1 - cy - by
+	sampleX := func(s float64) float64 { return ((ax*s+bx)*s + cx) * s }
+	sampleY := func(s float64) float64 { return ((ay*s+by)*s + cy) * s }
+
+	// the slopes of the tangents at the ends, for extrapolation
+	var startSlope, endSlope float64
+	if x1 > 0 {
+		startSlope = y1 / x1
+	} else if y1 == 0 && x2 > 0 {
+		startSlope = y2 / x2
+	}
+	if x2 < 1 {
+		endSlope = (y2 - 1) / (x2 - 1)
+	} else if y2 == 1 && x1 < 1 {
+		endSlope = (y1 - 1) / (x1 - 1)
+	}
+
+	return func(t float64) float64 {
+		if t < 0 {
+			return startSlope * t
+		}
+		if t > 1 {
+			return 1 + endSlope*(t-1)
+		}
+		// Solve x(s) = t.  x is monotonic since x1 and x2 are in [0, 1], so
+		// bisection always works; Newton's method is tried first as it is
+		// usually much faster.
+		s := t
+		for i := 0; i < 8; i++ {
+			dx := (3*ax*s+2*bx)*s + cx
+			if math.Abs(dx) < 1e-6 {
+				break
+			}
+			s -= (sampleX(s) - t) / dx
+		}
+		if s < 0 || s > 1 || math.Abs(sampleX(s)-t) > 1e-7 {
+			lo, hi := 0.0, 1.0
+			s = t
+			for i := 0; i < 60 && math.Abs(sampleX(s)-t) > 1e-7; i++ {
+				if sampleX(s) < t {
+					lo = s
+				} else {
+					hi = s
+				}
+				s = (lo + hi) / 2
+			}
+		}
+		return sampleY(s)
+	}
+}
+
+// steps returns the easing of steps(n, pos), where pos is one of the jump-
+// keywords.
+func steps(n int, pos string) func(float64) float64 {
+	jumps := n
+	switch pos {
+	case "jump-both":
+		jumps++
+	case "jump-none":
+		jumps--
+	}
+	return func(t float64) float64 {
+		step := math.Floor(t * float64(n))
+		if pos == "jump-start" || pos == "jump-both" {
+			step++
+		}
+		if t >= 0 && step < 0 {
+			step = 0
+		}
+		if t <= 1 && step > float64(jumps) {
+			step = float64(jumps)
+		}
+		return step / float64(jumps)
+	}
+}
+
+// linearPoint is a control point of a linear() easing.
+type linearPoint struct {
+	in, out float64
+	hasIn   bool
+}
+
+// linearStops returns the easing of linear() with the arguments parts.
+func linearStops(parts [][]tokenizer.Token) (func(float64) float64, error) {
+	var pts []linearPoint
+	for _, part := range parts {
+		cvs := parser.ComponentValues(part)
+		var out float64
+		var ins []float64
+		haveOut := false
+		for _, cv := range cvs {
+			switch {
+			case len(cv) == 1 && cv[0].Type == tokenizer.TokenNumber && !haveOut:
+				out, _ = cv[0].Float()
+				haveOut = true
+			case len(cv) == 1 && cv[0].Type == tokenizer.TokenPercentage && len(ins) < 2:
+				in, _ := cv[0].Percentage()
+				ins = append(ins, in)
+			default:
+				return nil, errorf("bad linear() stop %q", render(part))
+			}
+		}
+		if !haveOut {
+			return nil, errorf("linear() stop %q has no output value", render(part))
+		}
+		if len(ins) == 0 {
+			pts = append(pts, linearPoint{out: out})
+		}
+		for _, in := range ins {
+			pts = append(pts, linearPoint{in: in, out: out, hasIn: true})
+		}
+	}
+	if len(parts) < 2 {
+		return nil, errorf("linear() needs at least two stops")
+	}
+
+	// Fill in the missing inputs: the ends default to 0 and 1, inputs may
+	// not go backwards, and runs of missing inputs are spread evenly.
+	if !pts[0].hasIn {
+		pts[0].in, pts[0].hasIn = 0, true
+	}
+	if last := &pts[len(pts)-1]; !last.hasIn {
+		last.in, last.hasIn = 1, true
+	}
+	max := pts[0].in
+	for i := range pts {
+		if pts[i].hasIn {
+			if pts[i].in < max {
+				pts[i].in = max
+			}
+			max = pts[i].in
+		}
+	}
+	for i := 1; i < len(pts); i++ {
+		if pts[i].hasIn {
+			continue
+		}
+		j := i
+		for !pts[j].hasIn {
+			j++
+		}
+		from, to := pts[i-1].in, pts[j].in
+		for k := i; k < j; k++ {
+			pts[k].in = from + (to-from)*float64(k-i+1)/float64(j-i+1)
+			pts[k].hasIn = true
+		}
+	}
+
+	return func(t float64) float64 {
+		// the segment to interpolate or extrapolate along
+		a := 0
+		for a+2 < len(pts) && pts[a+1].in <= t {
+			a++
+		}
+		p, q := pts[a], pts[a+1]
+		if p.in == q.in {
+			return q.out
+		}
+		return p.out + (q.out-p.out)*(t-p.in)/(q.in-p.in)
+	}, nil
+}
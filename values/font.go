@@ -0,0 +1,240 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// FontDescription is the value of the font shorthand.
+type FontDescription struct {
+	// System is a system font keyword, such as caption.  If it is set, the
+	// other fields are not.
+	System string
+
+	// Style, Variant, Weight, and Stretch are the values given for those
+	// properties before the font size, in lower case, or "normal".  Style
+	// may be "oblique" followed by an angle, such as "oblique 10deg".  Weight
+	// may be a number from 1 to 1000.  Variant is only ever normal or
+	// small-caps, the values the shorthand allows.
+	Style   string
+	Variant string
+	Weight  string
+	Stretch string
+
+	// Size is the font size: a length, a percentage, a keyword such as
+	// medium, or a math function.
+	Size []tokenizer.Token
+	// LineHeight is the line height given after a '/', or nil if there is
+	// none.
+	LineHeight []tokenizer.Token
+
+	Families []FontFamily
+}
+
+// FontFamily is one entry of a list of font families.
+type FontFamily struct {
+	// Name is the family name.  For an unquoted name made of several
+	// identifiers, they are joined with single spaces.
+	Name string
+	// Quoted is set if the name was given as a string.
+	Quoted bool
+}
+
+var systemFonts = map[string]bool{
+	"caption": true, "icon": true, "menu": true,
+	"message-box": true, "small-caption": true, "status-bar": true,
+}
+
+var fontWeights = map[string]bool{"bold": true, "bolder": true, "lighter": true}
+
+var fontStretches = map[string]bool{
+	"ultra-condensed": true, "extra-condensed": true, "condensed": true, "semi-condensed": true,
+	"semi-expanded": true, "expanded": true, "extra-expanded": true, "ultra-expanded": true,
+}
+
+var fontSizes = map[string]bool{
+	"xx-small": true, "x-small": true, "small": true, "medium": true,
+	"large": true, "x-large": true, "xx-large": true, "xxx-large": true,
+	"larger": true, "smaller": true, "math": true,
+}
+
+var genericFamilies = map[string]bool{
+	"serif": true, "sans-serif": true, "cursive": true, "fantasy": true, "monospace": true,
+	"system-ui": true, "emoji": true, "math": true, "fangsong": true,
+	"ui-serif": true, "ui-sans-serif": true, "ui-monospace": true, "ui-rounded": true,
+}
+
+// IsGeneric reports whether f is a generic family, such as serif, rather
+// than the name of a font.  A quoted name is never generic.
+func (f FontFamily) IsGeneric() bool {
+	return !f.Quoted && genericFamilies[strings.ToLower(f.Name)]
+}
+
+// String returns f as it would be written in a family list.
+func (f FontFamily) String() string {
+	if f.Quoted {
+		return tokenizer.SerializeString(f.Name)
+	}
+	words := strings.Split(f.Name, " ")
+	for i, w := range words {
+		words[i] = tokenizer.SerializeIdentifier(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// ParseFont parses the value of the font shorthand.
+func ParseFont(toks []tokenizer.Token) (*FontDescription, error) {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 1 && systemFonts[keyword(cvs[0])] {
+		return &FontDescription{System: keyword(cvs[0])}, nil
+	}
+	f := &FontDescription{Style: "normal", Variant: "normal", Weight: "normal", Stretch: "normal"}
+
+	// Up to four values for style, variant, weight, and stretch come first,
+	// in any order.  Each "normal" stands for any one of them.
+	i := 0
+	set := make(map[string]bool)
+prefix:
+	for n := 0; n < 4 && i < len(cvs); n++ {
+		kw := keyword(cvs[i])
+		var prop string
+		switch {
+		case kw == "normal":
+			i++
+			continue
+		case kw == "italic" || kw == "oblique":
+			prop, f.Style = "font-style", kw
+			if kw == "oblique" && i+1 < len(cvs) && len(cvs[i+1]) == 1 && cvs[i+1][0].Type == tokenizer.TokenDimension {
+				if a, ok := angle(cvs[i+1][0]); ok && a >= -90 && a <= 90 {
+					f.Style += " " + render(cvs[i+1])
+					i++
+				}
+			}
+		case kw == "small-caps":
+			prop, f.Variant = "font-variant", kw
+		case fontWeights[kw]:
+			prop, f.Weight = "font-weight", kw
+		case fontStretches[kw]:
+			prop, f.Stretch = "font-stretch", kw
+		case len(cvs[i]) == 1 && cvs[i][0].Type == tokenizer.TokenNumber:
+			w, _ := cvs[i][0].Float()
+			if w < 1 || w > 1000 {
+				// not a weight; perhaps a unitless zero size
+				break prefix
+			}
+			prop, f.Weight = "font-weight", cvs[i][0].Value
+		default:
+			break prefix
+		}
+		if set[prop] {
+			return nil, errorf("%s given twice in font shorthand", prop)
+		}
+		set[prop] = true
+		i++
+	}
+
+	if i == len(cvs) || !isFontSize(cvs[i]) {
+		return nil, errorf("expected a font size in font shorthand")
+	}
+	f.Size = cvs[i]
+	i++
+	if i < len(cvs) && cvs[i][0].Type == tokenizer.TokenDelim && cvs[i][0].Value == "/" {
+		i++
+		if i == len(cvs) || !(isLengthLike(cvs[i]) || keyword(cvs[i]) == "normal") {
+			return nil, errorf("expected a line height after '/' in font shorthand")
+		}
+		f.LineHeight = cvs[i]
+		i++
+	}
+
+	var err error
+	f.Families, err = parseFamilies(cvs[i:])
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func isFontSize(cv []tokenizer.Token) bool {
+	if fontSizes[keyword(cv)] {
+		return true
+	}
+	if !isNumeric(cv) {
+		return isLengthLike(cv)
+	}
+	t := cv[0]
+	switch t.Type {
+	case tokenizer.TokenPercentage:
+		return true
+	case tokenizer.TokenNumber:
+		f, _ := t.Float()
+		return f == 0
+	}
+	return tokenizer.ClassifyUnit(unit(t)).IsLength()
+}
+
+// ParseFontFamily parses the value of the font-family property, a list of
+// family names.
+func ParseFontFamily(toks []tokenizer.Token) ([]FontFamily, error) {
+	return parseFamilies(parser.ComponentValues(toks))
+}
+
+func parseFamilies(cvs [][]tokenizer.Token) ([]FontFamily, error) {
+	var families []FontFamily
+	var words []string
+	quoted := false
+	for i := 0; i <= len(cvs); i++ {
+		if i < len(cvs) && cvs[i][0].Type != tokenizer.TokenComma {
+			cv := cvs[i]
+			switch {
+			case cv[0].Type == tokenizer.TokenString && len(words) == 0 && !quoted:
+				words, quoted = []string{cv[0].Value}, true
+			case cv[0].Type == tokenizer.TokenIdent && !quoted:
+				words = append(words, cv[0].Value)
+			default:
+				return nil, errorf("unexpected %q in font family list", render(cv))
+			}
+			continue
+		}
+		if len(words) == 0 {
+			return nil, errorf("empty font family name")
+		}
+		families = append(families, FontFamily{Name: strings.Join(words, " "), Quoted: quoted})
+		words, quoted = nil, false
+	}
+	return families, nil
+}
+
+// String returns f as a value for the font shorthand, leaving out the
+// values that are normal.
+func (f *FontDescription) String() string {
+	if f.System != "" {
+		return f.System
+	}
+	var buf bytes.Buffer
+	for _, v := range []string{f.Style, f.Variant, f.Weight, f.Stretch} {
+		if v != "normal" && v != "" {
+			buf.WriteString(v)
+			buf.WriteByte(' ')
+		}
+	}
+	tokenizer.RenderTokens(&buf, f.Size)
+	if f.LineHeight != nil {
+		buf.WriteByte('/')
+		tokenizer.RenderTokens(&buf, f.LineHeight)
+	}
+	for i, fam := range f.Families {
+		if i == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(fam.String())
+	}
+	return buf.String()
+}
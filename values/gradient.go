@@ -0,0 +1,325 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Gradient is a linear-gradient(), radial-gradient(), or conic-gradient()
+// image, or one of their repeating- variants.
+type Gradient struct {
+	// Type is "linear", "radial", or "conic".
+	Type      string
+	Repeating bool
+
+	// Angle is the direction of a linear gradient, or the starting angle of
+	// a conic gradient, in degrees clockwise from "to top".  A linear
+	// gradient that gives no direction points "to bottom", 180 degrees.
+	Angle float64
+	// Corner is set instead of Angle for a linear gradient towards a corner,
+	// such as "to top right", whose angle depends on the size of the box.
+	// It holds the two keywords, vertical first.
+	Corner string
+
+	// Shape is the ending shape of a radial gradient, "circle" or
+	// "ellipse".  If the gradient does not say, it is worked out from Size
+	// as the specification describes.
+	Shape string
+	// Size is the size of a radial gradient's ending shape: an extent
+	// keyword such as farthest-corner, or one or two lengths or
+	// percentages.  It is empty for the default, farthest-corner.
+	Size [][]tokenizer.Token
+	// Position is the center of a radial or conic gradient, as the
+	// component values of a <position>.  It is empty for the default,
+	// center.
+	Position [][]tokenizer.Token
+
+	// Interpolation holds the keywords of the color interpolation method,
+	// without the "in", such as ["oklch", "longer", "hue"].
+	Interpolation []string
+
+	// Stops holds the color stops and the interpolation hints between them.
+	Stops []ColorStop
+}
+
+// ColorStop is a color stop of a gradient, or an interpolation hint between
+// two color stops.
+type ColorStop struct {
+	// Color is the stop's color.  It is nil for a hint.
+	Color []tokenizer.Token
+	// Positions holds the zero, one, or two positions of a stop, or the one
+	// position of a hint.  Positions are lengths or percentages, or angles
+	// or percentages in a conic gradient, or math functions such as calc().
+	Positions [][]tokenizer.Token
+}
+
+// IsHint reports whether s is an interpolation hint.
+func (s ColorStop) IsHint() bool {
+	return s.Color == nil
+}
+
+var gradientConfigKeywords = map[string]bool{
+	"to": true, "in": true, "at": true, "from": true,
+	"circle": true, "ellipse": true,
+	"closest-side": true, "closest-corner": true, "farthest-side": true, "farthest-corner": true,
+}
+
+var sideAngles = map[string]float64{
+	"top": 0, "right": 90, "bottom": 180, "left": 270,
+}
+
+var hueMethods = map[string]bool{
+	"shorter": true, "longer": true, "increasing": true, "decreasing": true,
+}
+
+var mathFunctions = map[string]bool{
+	"calc": true, "min": true, "max": true, "clamp": true,
+	"round": true, "mod": true, "rem": true, "abs": true, "sign": true,
+}
+
+// isLengthLike reports whether cv is a number, percentage, dimension, or
+// math function.
+func isLengthLike(cv []tokenizer.Token) bool {
+	if name, _, ok := function(cv); ok {
+		return mathFunctions[name]
+	}
+	return isNumeric(cv)
+}
+
+// ParseGradient parses a gradient function.  The vendor-prefixed forms,
+// such as -webkit-linear-gradient(), use a different syntax and are not
+// supported.
+func ParseGradient(toks []tokenizer.Token) (*Gradient, error) {
+	cv, err := single(toks, "gradient")
+	if err != nil {
+		return nil, err
+	}
+	name, args, ok := function(cv)
+	if !ok {
+		return nil, errorf("expected a gradient function")
+	}
+	g := &Gradient{}
+	if strings.HasPrefix(name, "repeating-") {
+		g.Repeating = true
+		name = name[len("repeating-"):]
+	}
+	switch name {
+	case "linear-gradient":
+		g.Type, g.Angle = "linear", 180
+	case "radial-gradient":
+		g.Type = "radial"
+	case "conic-gradient":
+		g.Type = "conic"
+	default:
+		return nil, errorf("unknown gradient function %q", cv[0].Value)
+	}
+
+	parts := parser.SplitCommas(args)
+	if len(parts) > 0 && len(parts[0]) > 0 {
+		first := parser.ComponentValues(parts[0])
+		if isLengthLike(first[0]) || gradientConfigKeywords[keyword(first[0])] {
+			if err := g.parseConfig(first); err != nil {
+				return nil, err
+			}
+			parts = parts[1:]
+		}
+	}
+	if g.Type == "radial" && g.Shape == "" {
+		g.Shape = "ellipse"
+		if len(g.Size) == 1 && isLengthLike(g.Size[0]) {
+			g.Shape = "circle"
+		}
+	}
+	if err := g.parseStops(parts); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// parseConfig parses the first argument of the gradient, which describes
+// its geometry and color interpolation.
+func (g *Gradient) parseConfig(cvs [][]tokenizer.Token) error {
+	seen := make(map[string]bool)
+	once := func(what string) error {
+		if seen[what] {
+			return errorf("%s given twice in %s gradient", what, g.Type)
+		}
+		seen[what] = true
+		return nil
+	}
+	for i := 0; i < len(cvs); {
+		cv := cvs[i]
+		kw := keyword(cv)
+		i++
+		switch {
+		case kw == "in":
+			if err := once("color interpolation"); err != nil {
+				return err
+			}
+			if i == len(cvs) || keyword(cvs[i]) == "" {
+				return errorf("expected a color space after 'in'")
+			}
+			g.Interpolation = append(g.Interpolation, keyword(cvs[i]))
+			i++
+			if i+1 < len(cvs) && hueMethods[keyword(cvs[i])] && keyword(cvs[i+1]) == "hue" {
+				g.Interpolation = append(g.Interpolation, keyword(cvs[i]), "hue")
+				i += 2
+			}
+
+		case g.Type == "linear" && kw == "to":
+			if err := once("direction"); err != nil {
+				return err
+			}
+			var sides []string
+			for i < len(cvs) && len(sides) < 2 {
+				if _, ok := sideAngles[keyword(cvs[i])]; !ok {
+					break
+				}
+				sides = append(sides, keyword(cvs[i]))
+				i++
+			}
+			switch len(sides) {
+			case 0:
+				return errorf("expected a side after 'to'")
+			case 1:
+				g.Angle = sideAngles[sides[0]]
+			case 2:
+				a, b := sideAngles[sides[0]], sideAngles[sides[1]]
+				if (a == 90 || a == 270) == (b == 90 || b == 270) {
+					return errorf("'to %s %s' is not a corner", sides[0], sides[1])
+				}
+				if a == 90 || a == 270 {
+					sides[0], sides[1] = sides[1], sides[0]
+				}
+				g.Corner = sides[0] + " " + sides[1]
+			}
+		case g.Type == "linear" && isLengthLike(cv):
+			if err := once("direction"); err != nil {
+				return err
+			}
+			a, ok := angle(cv[0])
+			if !ok || len(cv) != 1 {
+				return errorf("expected an angle in linear gradient, got %q", render(cv))
+			}
+			g.Angle = a
+
+		case g.Type == "conic" && kw == "from":
+			if err := once("starting angle"); err != nil {
+				return err
+			}
+			if i == len(cvs) || len(cvs[i]) != 1 {
+				return errorf("expected an angle after 'from'")
+			}
+			a, ok := angle(cvs[i][0])
+			if !ok {
+				return errorf("expected an angle after 'from', got %q", render(cvs[i]))
+			}
+			g.Angle = a
+			i++
+
+		case g.Type != "linear" && kw == "at":
+			if err := once("position"); err != nil {
+				return err
+			}
+			start := i
+			for i < len(cvs) && keyword(cvs[i]) != "in" {
+				i++
+			}
+			if i == start || i-start > 4 {
+				return errorf("expected a position after 'at'")
+			}
+			g.Position = cvs[start:i]
+
+		case g.Type == "radial" && (kw == "circle" || kw == "ellipse"):
+			if err := once("shape"); err != nil {
+				return err
+			}
+			g.Shape = kw
+		case g.Type == "radial" && (isLengthLike(cv) || strings.HasPrefix(kw, "closest-") || strings.HasPrefix(kw, "farthest-")):
+			if err := once("size"); err != nil {
+				return err
+			}
+			g.Size = [][]tokenizer.Token{cv}
+			if kw == "" && i < len(cvs) && isLengthLike(cvs[i]) {
+				g.Size = append(g.Size, cvs[i])
+				i++
+			}
+
+		default:
+			return errorf("unexpected %q in %s gradient", render(cv), g.Type)
+		}
+	}
+	if g.Shape == "circle" && len(g.Size) == 2 {
+		return errorf("a circle has only one radius")
+	}
+	if g.Shape == "ellipse" && len(g.Size) == 1 && isLengthLike(g.Size[0]) {
+		return errorf("an ellipse needs two radii")
+	}
+	return nil
+}
+
+func (g *Gradient) parseStops(parts [][]tokenizer.Token) error {
+	colors := 0
+	for _, part := range parts {
+		cvs := parser.ComponentValues(part)
+		if len(cvs) == 0 {
+			return errorf("empty color stop")
+		}
+		var s ColorStop
+		if len(cvs) == 1 && isLengthLike(cvs[0]) {
+			s.Positions = cvs
+			n := len(g.Stops)
+			if n == 0 || g.Stops[n-1].IsHint() {
+				return errorf("interpolation hint %q must follow a color stop", render(cvs[0]))
+			}
+		} else {
+			s.Color, s.Positions = cvs[0], cvs[1:]
+			if isLengthLike(s.Color) {
+				return errorf("color stop must start with a color, got %q", render(s.Color))
+			}
+			if len(s.Positions) > 2 {
+				return errorf("color stop has more than two positions")
+			}
+			colors++
+		}
+		for _, p := range s.Positions {
+			if !g.isPosition(p) {
+				return errorf("%q is not a color stop position in %s gradient", render(p), g.Type)
+			}
+		}
+		g.Stops = append(g.Stops, s)
+	}
+	if colors < 2 {
+		return errorf("gradient needs at least two color stops")
+	}
+	if g.Stops[len(g.Stops)-1].IsHint() {
+		return errorf("interpolation hint must be followed by a color stop")
+	}
+	return nil
+}
+
+// isPosition reports whether cv can be a color stop position: a length or
+// percentage, an angle or percentage in a conic gradient, or a math
+// function.
+func (g *Gradient) isPosition(cv []tokenizer.Token) bool {
+	if !isNumeric(cv) {
+		return isLengthLike(cv)
+	}
+	t := cv[0]
+	switch t.Type {
+	case tokenizer.TokenPercentage:
+		return true
+	case tokenizer.TokenNumber:
+		f, _ := t.Float()
+		return f == 0
+	}
+	if g.Type == "conic" {
+		_, ok := angle(t)
+		return ok
+	}
+	return tokenizer.ClassifyUnit(unit(t)).IsLength()
+}
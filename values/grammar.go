@@ -0,0 +1,449 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Grammar is a value definition in the syntax the CSS specifications use
+// for property values, such as "[ <length> | auto ]{1,4}".
+//
+// All of the syntax is supported: keywords, the literals ',' and '/', data
+// types such as <length> with an optional range such as <length [0,∞]>,
+// references to the grammar of a property such as <'margin-top'>,
+// functions such as fit-content( <length-percentage> ), the combinators
+// juxtaposition, &&, ||, and |, brackets, and the multipliers *, +, ?,
+// {A}, {A,}, {A,B}, #, and !.
+type Grammar struct {
+	src  string
+	root *gnode
+}
+
+type gkind int
+
+const (
+	gKeyword  gkind = iota // name
+	gLiteral               // name is "," or "/"
+	gType                  // name, with an optional range
+	gProperty              // name
+	gFunction              // name, with the arguments in kids[0], or no kids
+	gSeq                   // all kids, in order
+	gAll                   // &&: all kids, in any order
+	gAny                   // ||: one or more kids, in any order
+	gOne                   // |: exactly one kid
+	gRepeat                // kids[0], from min to max times
+	gNonEmpty              // !: kids[0], matching at least one value
+)
+
+type gnode struct {
+	kind gkind
+	name string
+	kids []*gnode
+
+	// the numeric range of a gType, if hasRange is set
+	hasRange bool
+	lo, hi   float64
+
+	// the number of repeats of a gRepeat; max is -1 if unbounded
+	min, max int
+	comma    bool
+}
+
+// ParseGrammar parses a value definition.
+func ParseGrammar(def string) (*Grammar, error) {
+	p := grammarParser{src: def}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.oneOf()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, errorf("unexpected %q in value definition %q", p.toks[p.pos], def)
+	}
+	return &Grammar{src: def, root: root}, nil
+}
+
+// mustParseGrammar is ParseGrammar for the built-in definitions.
+func mustParseGrammar(def string) *Grammar {
+	g, err := ParseGrammar(def)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// String returns the value definition g was parsed from.
+func (g *Grammar) String() string {
+	return g.src
+}
+
+type grammarParser struct {
+	src  string
+	toks []string
+	pos  int
+}
+
+// lex splits the definition into keywords, "name(" function openings,
+// <...> references, and punctuation.
+func (p *grammarParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '<':
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return errorf("unclosed '<' in value definition %q", s)
+			}
+			p.toks = append(p.toks, s[i:i+end+1])
+			i += end + 1
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return errorf("unclosed '{' in value definition %q", s)
+			}
+			p.toks = append(p.toks, s[i:i+end+1])
+			i += end + 1
+		case strings.HasPrefix(s[i:], "||") || strings.HasPrefix(s[i:], "&&"):
+			p.toks = append(p.toks, s[i:i+2])
+			i += 2
+		case strings.IndexByte("[]|*+?#!,/)", c) >= 0:
+			p.toks = append(p.toks, s[i:i+1])
+			i++
+		case c == '-' || c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] == '-' || s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			if j < len(s) && s[j] == '(' {
+				j++
+			}
+			p.toks = append(p.toks, s[i:j])
+			i = j
+		default:
+			return errorf("unexpected %q in value definition %q", s[i:i+1], s)
+		}
+	}
+	return nil
+}
+
+func (p *grammarParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+// oneOf, anyOf, allOf, and seq parse the combinators, from the loosest
+// binding to the tightest.
+func (p *grammarParser) oneOf() (*gnode, error) {
+	return p.combinator("|", gOne, (*grammarParser).anyOf)
+}
+
+func (p *grammarParser) anyOf() (*gnode, error) {
+	return p.combinator("||", gAny, (*grammarParser).allOf)
+}
+
+func (p *grammarParser) allOf() (*gnode, error) {
+	return p.combinator("&&", gAll, (*grammarParser).seq)
+}
+
+func (p *grammarParser) combinator(op string, kind gkind, next func(*grammarParser) (*gnode, error)) (*gnode, error) {
+	n, err := next(p)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != op {
+		return n, nil
+	}
+	n = &gnode{kind: kind, kids: []*gnode{n}}
+	for p.peek() == op {
+		p.pos++
+		kid, err := next(p)
+		if err != nil {
+			return nil, err
+		}
+		n.kids = append(n.kids, kid)
+	}
+	if kind != gOne && len(n.kids) > 30 {
+		return nil, errorf("too many alternatives in value definition %q", p.src)
+	}
+	return n, nil
+}
+
+func (p *grammarParser) seq() (*gnode, error) {
+	n := &gnode{kind: gSeq}
+	for {
+		switch p.peek() {
+		case "", "|", "||", "&&", "]", ")":
+			if len(n.kids) == 0 {
+				return nil, errorf("missing term in value definition %q", p.src)
+			}
+			if len(n.kids) == 1 {
+				return n.kids[0], nil
+			}
+			return n, nil
+		}
+		kid, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		n.kids = append(n.kids, kid)
+	}
+}
+
+// term parses a single component and its multipliers.
+func (p *grammarParser) term() (*gnode, error) {
+	tok := p.peek()
+	p.pos++
+	var n *gnode
+	switch {
+	case tok == "[":
+		inner, err := p.oneOf()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != "]" {
+			return nil, errorf("unclosed '[' in value definition %q", p.src)
+		}
+		p.pos++
+		n = inner
+	case tok == "," || tok == "/":
+		n = &gnode{kind: gLiteral, name: tok}
+	case strings.HasPrefix(tok, "<'") && strings.HasSuffix(tok, "'>"):
+		n = &gnode{kind: gProperty, name: tok[2 : len(tok)-2]}
+	case strings.HasPrefix(tok, "<"):
+		var err error
+		if n, err = p.dataType(tok[1 : len(tok)-1]); err != nil {
+			return nil, err
+		}
+	case strings.HasSuffix(tok, "("):
+		n = &gnode{kind: gFunction, name: tok[:len(tok)-1]}
+		if p.peek() != ")" {
+			args, err := p.oneOf()
+			if err != nil {
+				return nil, err
+			}
+			n.kids = []*gnode{args}
+		}
+		if p.peek() != ")" {
+			return nil, errorf("unclosed %s) in value definition %q", tok, p.src)
+		}
+		p.pos++
+	case tok != "" && strings.IndexByte("]|&)*+?#!{", tok[0]) < 0:
+		n = &gnode{kind: gKeyword, name: tok}
+	default:
+		return nil, errorf("unexpected %q in value definition %q", tok, p.src)
+	}
+
+	for {
+		rep := &gnode{kind: gRepeat, kids: []*gnode{n}, max: -1}
+		switch tok := p.peek(); {
+		case tok == "*":
+		case tok == "+":
+			rep.min = 1
+		case tok == "?":
+			rep.max = 1
+		case tok == "#":
+			rep.min, rep.comma = 1, true
+			if next := p.pos + 1; next < len(p.toks) && strings.HasPrefix(p.toks[next], "{") {
+				p.pos++
+				if err := p.bounds(rep); err != nil {
+					return nil, err
+				}
+			}
+		case strings.HasPrefix(tok, "{"):
+			if err := p.bounds(rep); err != nil {
+				return nil, err
+			}
+		case tok == "!":
+			rep = &gnode{kind: gNonEmpty, kids: []*gnode{n}}
+		default:
+			return n, nil
+		}
+		p.pos++
+		n = rep
+	}
+}
+
+// bounds sets the repeat counts of rep from a {A}, {A,}, or {A,B} token.
+func (p *grammarParser) bounds(rep *gnode) error {
+	tok := p.peek()
+	parts := strings.Split(tok[1:len(tok)-1], ",")
+	var err error
+	if rep.min, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil || len(parts) > 2 {
+		return errorf("bad multiplier %q in value definition %q", tok, p.src)
+	}
+	rep.max = rep.min
+	if len(parts) == 2 {
+		rep.max = -1
+		if b := strings.TrimSpace(parts[1]); b != "" {
+			if rep.max, err = strconv.Atoi(b); err != nil || rep.max < rep.min {
+				return errorf("bad multiplier %q in value definition %q", tok, p.src)
+			}
+		}
+	}
+	return nil
+}
+
+// dataType parses the inside of a <...> data type reference, such as
+// "length [0,∞]".
+func (p *grammarParser) dataType(s string) (*gnode, error) {
+	n := &gnode{kind: gType, name: s}
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		n.name = strings.TrimSpace(s[:i])
+		r := strings.TrimSuffix(strings.TrimSpace(s[i+1:]), "]")
+		parts := strings.Split(r, ",")
+		if len(parts) != 2 {
+			return nil, errorf("bad range in <%s> in value definition %q", s, p.src)
+		}
+		var err error
+		n.hasRange = true
+		if n.lo, err = rangeBound(parts[0]); err == nil {
+			n.hi, err = rangeBound(parts[1])
+		}
+		if err != nil || n.lo > n.hi {
+			return nil, errorf("bad range in <%s> in value definition %q", s, p.src)
+		}
+	}
+	if n.name == "" || strings.ContainsAny(n.name, " '") {
+		return nil, errorf("bad data type <%s> in value definition %q", s, p.src)
+	}
+	return n, nil
+}
+
+func rangeBound(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "∞", "+∞":
+		return math.Inf(1), nil
+	case "-∞", "−∞":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Match reports whether the value toks matches g.  Whitespace and comments
+// between component values are ignored.
+func (g *Grammar) Match(toks []tokenizer.Token) bool {
+	cvs := parser.ComponentValues(toks)
+	return g.root.match(cvs, 0, func(i int) bool { return i == len(cvs) })
+}
+
+// match reports whether n matches cvs from i onwards, in some way for which
+// k accepts the index of the first component value after the match.  The
+// matcher backtracks, so it takes time exponential in the length of the
+// value in the worst case; real values are short.
+func (n *gnode) match(cvs [][]tokenizer.Token, i int, k func(int) bool) bool {
+	switch n.kind {
+	case gKeyword:
+		return i < len(cvs) && len(cvs[i]) == 1 && cvs[i][0].MatchesIdent(n.name) && k(i+1)
+	case gLiteral:
+		if i == len(cvs) || len(cvs[i]) != 1 {
+			return false
+		}
+		t := cvs[i][0]
+		if n.name == "," {
+			return t.Type == tokenizer.TokenComma && k(i+1)
+		}
+		return t.Type == tokenizer.TokenDelim && t.Value == n.name && k(i+1)
+	case gType:
+		if g := typeGrammars[n.name]; g != nil {
+			return g.root.match(cvs, i, k)
+		}
+		return i < len(cvs) && matchesDataType(n.name, cvs[i]) && n.inRange(cvs[i]) && k(i+1)
+	case gProperty:
+		g := PropertyGrammar(n.name)
+		return g != nil && g.root.match(cvs, i, k)
+	case gFunction:
+		if i == len(cvs) || !isFunction(cvs[i], n.name) {
+			return false
+		}
+		_, args, _ := function(cvs[i])
+		argCVs := parser.ComponentValues(args)
+		if n.kids == nil {
+			return len(argCVs) == 0 && k(i+1)
+		}
+		return n.kids[0].match(argCVs, 0, func(j int) bool { return j == len(argCVs) }) && k(i+1)
+	case gSeq:
+		var seq func(kid, i int) bool
+		seq = func(kid, i int) bool {
+			if kid == len(n.kids) {
+				return k(i)
+			}
+			return n.kids[kid].match(cvs, i, func(j int) bool { return seq(kid+1, j) })
+		}
+		return seq(0, i)
+	case gAll, gAny:
+		all := uint32(1)<<uint(len(n.kids)) - 1
+		var some func(used uint32, i int) bool
+		some = func(used uint32, i int) bool {
+			if used == all {
+				return k(i)
+			}
+			if n.kind == gAny && used != 0 && k(i) {
+				return true
+			}
+			for kid := range n.kids {
+				bit := uint32(1) << uint(kid)
+				if used&bit == 0 && n.kids[kid].match(cvs, i, func(j int) bool { return some(used|bit, j) }) {
+					return true
+				}
+			}
+			return false
+		}
+		return some(0, i)
+	case gOne:
+		for _, kid := range n.kids {
+			if kid.match(cvs, i, k) {
+				return true
+			}
+		}
+		return false
+	case gRepeat:
+		var rep func(count, i int) bool
+		rep = func(count, i int) bool {
+			if count >= n.min && k(i) {
+				return true
+			}
+			if n.max >= 0 && count >= n.max {
+				return false
+			}
+			start := i
+			if n.comma && count > 0 {
+				if i == len(cvs) || cvs[i][0].Type != tokenizer.TokenComma {
+					return false
+				}
+				start++
+			}
+			return n.kids[0].match(cvs, start, func(j int) bool {
+				// a repeat that matches nothing gets no further
+				return (j > start || count < n.min) && rep(count+1, j)
+			})
+		}
+		return rep(0, i)
+	case gNonEmpty:
+		return n.kids[0].match(cvs, i, func(j int) bool { return j > i && k(j) })
+	}
+	return false
+}
+
+// inRange reports whether the numeric value of cv is in the range of the
+// data type n.  Math functions are not checked.
+func (n *gnode) inRange(cv []tokenizer.Token) bool {
+	if !n.hasRange || !isNumeric(cv) {
+		return true
+	}
+	f, _ := cv[0].Float()
+	return n.lo <= f && f <= n.hi
+}
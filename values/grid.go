@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// GridAreas is the value of grid-template-areas: a grid of cells, each
+// named or empty, in which the cells of each name form a rectangle.
+type GridAreas struct {
+	// Cells holds the name of each cell, row by row.  Null cells, written
+	// as one or more '.', are "".
+	Cells [][]string
+	// Areas maps each name to the rectangle of cells it covers.
+	Areas map[string]GridArea
+}
+
+// GridArea is a named area of a grid.  Rows and columns are numbered from
+// zero, and the ends are exclusive, so an area of a single cell in the top
+// left corner is {0, 1, 0, 1}.  Grid lines are numbered from one in CSS, so
+// the area's grid-row is RowStart+1 / RowEnd+1.
+type GridArea struct {
+	RowStart, RowEnd       int
+	ColumnStart, ColumnEnd int
+}
+
+// Rows returns the number of rows in g.
+func (g *GridAreas) Rows() int {
+	return len(g.Cells)
+}
+
+// Columns returns the number of columns in g.
+func (g *GridAreas) Columns() int {
+	if len(g.Cells) == 0 {
+		return 0
+	}
+	return len(g.Cells[0])
+}
+
+// ParseGridTemplateAreas parses the value of grid-template-areas, checking
+// that every row has the same number of columns and that every named area
+// is a rectangle.  The value none gives a nil *GridAreas.
+func ParseGridTemplateAreas(toks []tokenizer.Token) (*GridAreas, error) {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 1 && keyword(cvs[0]) == "none" {
+		return nil, nil
+	}
+	if len(cvs) == 0 {
+		return nil, errorf("empty grid-template-areas")
+	}
+	g := &GridAreas{Areas: make(map[string]GridArea)}
+	for row, cv := range cvs {
+		if cv[0].Type != tokenizer.TokenString {
+			return nil, errorf("expected a string in grid-template-areas, got %q", render(cv))
+		}
+		cells, err := gridRow(cv[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		if len(cells) == 0 {
+			return nil, errorf("row %d of grid-template-areas is empty", row+1)
+		}
+		if row > 0 && len(cells) != len(g.Cells[0]) {
+			return nil, errorf("row %d of grid-template-areas has %d columns, not %d", row+1, len(cells), len(g.Cells[0]))
+		}
+		g.Cells = append(g.Cells, cells)
+	}
+
+	counts := make(map[string]int)
+	for row, cells := range g.Cells {
+		for col, name := range cells {
+			if name == "" {
+				continue
+			}
+			a, ok := g.Areas[name]
+			if !ok {
+				a = GridArea{row, row + 1, col, col + 1}
+			}
+			if row+1 > a.RowEnd {
+				a.RowEnd = row + 1
+			}
+			if col < a.ColumnStart {
+				a.ColumnStart = col
+			}
+			if col+1 > a.ColumnEnd {
+				a.ColumnEnd = col + 1
+			}
+			g.Areas[name] = a
+			counts[name]++
+		}
+	}
+	for name, a := range g.Areas {
+		if counts[name] != (a.RowEnd-a.RowStart)*(a.ColumnEnd-a.ColumnStart) {
+			return nil, errorf("grid area %q is not a rectangle", name)
+		}
+	}
+	return g, nil
+}
+
+// gridRow splits a row string of grid-template-areas into cells.
+func gridRow(s string) ([]string, error) {
+	var cells []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case c == '.':
+			for i < len(s) && s[i] == '.' {
+				i++
+			}
+			cells = append(cells, "")
+		case isGridNameByte(c):
+			for i < len(s) && isGridNameByte(s[i]) {
+				i++
+			}
+			cells = append(cells, s[start:i])
+		default:
+			return nil, errorf("unexpected %q in grid-template-areas", c)
+		}
+	}
+	return cells, nil
+}
+
+// isGridNameByte reports whether c is part of an ident code point: an ASCII
+// letter, digit, '-', or '_', or any byte of a non-ASCII character.
+func isGridNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c >= 0x80
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// ImageSetOption is one option of an image-set(): an image and what it is
+// suited for.
+type ImageSetOption struct {
+	// URL is the image's URL, if it is given as a url() or a string.  It is
+	// "" for other images, such as gradients.
+	URL string
+	// Image is the image as written.
+	Image []tokenizer.Token
+	// Resolution is the image's resolution in dppx, or 1 if the option does
+	// not give one.
+	Resolution float64
+	// Type is the MIME type given by type(), or "" if there is none.
+	Type string
+}
+
+var dppxPer = map[string]float64{
+	"x":    1,
+	"dppx": 1,
+	"dpi":  1.0 / 96,
+	"dpcm": 2.54 / 96,
+}
+
+// ParseImageSet parses an image-set() or -webkit-image-set() function.
+func ParseImageSet(toks []tokenizer.Token) ([]ImageSetOption, error) {
+	cv, err := single(toks, "image-set()")
+	if err != nil {
+		return nil, err
+	}
+	name, args, ok := function(cv)
+	if !ok || name != "image-set" && name != "-webkit-image-set" {
+		return nil, errorf("expected image-set(), got %q", render(cv))
+	}
+	var opts []ImageSetOption
+	for _, part := range parser.SplitCommas(args) {
+		cvs := parser.ComponentValues(part)
+		if len(cvs) == 0 {
+			return nil, errorf("empty image-set() option")
+		}
+		o := ImageSetOption{Image: cvs[0], Resolution: 1}
+		if u, ok := imageURL(cvs[0]); ok {
+			o.URL = u
+		} else if cvs[0][0].Type != tokenizer.TokenFunction || isFunction(cvs[0], "type") {
+			return nil, errorf("expected an image in image-set(), got %q", render(cvs[0]))
+		}
+		var haveRes, haveType bool
+		for _, cv := range cvs[1:] {
+			switch {
+			case len(cv) == 1 && cv[0].Type == tokenizer.TokenDimension && !haveRes:
+				f, _ := cv[0].Float()
+				scale, ok := dppxPer[unit(cv[0])]
+				if !ok || f < 0 {
+					return nil, errorf("bad resolution %q in image-set()", render(cv))
+				}
+				o.Resolution, haveRes = f*scale, true
+			case isFunction(cv, "type") && !haveType:
+				_, args, _ := function(cv)
+				arg := onlyToken(args)
+				if arg == nil || arg.Type != tokenizer.TokenString {
+					return nil, errorf("type() takes a string, got %q", render(args))
+				}
+				o.Type, haveType = arg.Value, true
+			default:
+				return nil, errorf("unexpected %q in image-set() option", render(cv))
+			}
+		}
+		opts = append(opts, o)
+	}
+	if len(opts) == 0 {
+		return nil, errorf("image-set() has no options")
+	}
+	return opts, nil
+}
+
+// imageURL returns the URL of cv if it is a url() or a string.
+func imageURL(cv []tokenizer.Token) (string, bool) {
+	switch cv[0].Type {
+	case tokenizer.TokenURI, tokenizer.TokenString:
+		return cv[0].Value, true
+	}
+	if _, args, ok := function(cv); ok && isFunction(cv, "url") {
+		if arg := onlyToken(args); arg != nil && arg.Type == tokenizer.TokenString {
+			return arg.Value, true
+		}
+	}
+	return "", false
+}
+
+// RewriteURLs returns a copy of the value toks with every URL in it passed
+// through fn: url() tokens, url() functions with a quoted URL, and the
+// images of image-set() given as strings, at any depth.
+func RewriteURLs(toks []tokenizer.Token, fn func(url string) string) []tokenizer.Token {
+	out := make([]tokenizer.Token, len(toks))
+	copy(out, toks)
+	rewriteURLs(out, fn)
+	return out
+}
+
+func rewriteURLs(toks []tokenizer.Token, fn func(string) string) {
+	for _, cv := range parser.ComponentValues(toks) {
+		switch {
+		case cv[0].Type == tokenizer.TokenURI:
+			cv[0].Value = fn(cv[0].Value)
+		case isFunction(cv, "url"):
+			_, args, _ := function(cv)
+			if arg := onlyToken(args); arg != nil && arg.Type == tokenizer.TokenString {
+				arg.Value = fn(arg.Value)
+			}
+		case isFunction(cv, "image-set") || isFunction(cv, "-webkit-image-set"):
+			_, args, _ := function(cv)
+			for _, part := range parser.SplitCommas(args) {
+				if len(part) > 0 && part[0].Type == tokenizer.TokenString {
+					part[0].Value = fn(part[0].Value)
+				}
+				rewriteURLs(part, fn)
+			}
+		case cv[0].Type == tokenizer.TokenFunction || len(cv) > 1:
+			rewriteURLs(cv[1:], fn)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// typeDefs are the value definitions of the data types that are made of
+// more than one component value, or are defined in terms of others.  The
+// other data types, such as <length>, are matched by matchesDataType.
+var typeDefs = map[string]string{
+	"alpha-value":  "<number> | <percentage>",
+	"box":          "border-box | padding-box | content-box",
+	"bg-image":     "none | <image>",
+	"bg-size":      "[ <length-percentage [0,∞]> | auto ]{1,2} | cover | contain",
+	"repeat-style": "repeat-x | repeat-y | [ repeat | space | round | no-repeat ]{1,2}",
+	"attachment":   "scroll | fixed | local",
+	"line-style":   "none | hidden | dotted | dashed | solid | double | groove | ridge | inset | outset",
+	"line-width":   "<length [0,∞]> | thin | medium | thick",
+	"ratio":        "<number [0,∞]> [ / <number [0,∞]> ]?",
+	"family-name":  "<string> | <custom-ident>+",
+	"generic-family": "serif | sans-serif | cursive | fantasy | monospace | system-ui | emoji | math | fangsong | " +
+		"ui-serif | ui-sans-serif | ui-monospace | ui-rounded",
+	"position": "[ left | center | right | top | bottom | <length-percentage> ] | " +
+		"[ left | center | right | <length-percentage> ] [ top | center | bottom | <length-percentage> ] | " +
+		"[ center | [ left | right ] <length-percentage>? ] && [ center | [ top | bottom ] <length-percentage>? ]",
+	"single-transition": "[ none | <custom-ident> ] || <time> || <easing-function> || <time> || " +
+		"normal | allow-discrete",
+	"single-animation": "<time> || <easing-function> || <time> || [ infinite | <number [0,∞]> ] || " +
+		"[ normal | reverse | alternate | alternate-reverse ] || [ none | forwards | backwards | both ] || " +
+		"[ running | paused ] || [ none | <custom-ident> | <string> ]",
+}
+
+// propertyDefs are the value definitions of the built-in properties.  The
+// CSS-wide keywords are accepted by every property, and are not listed.
+var propertyDefs = map[string]string{
+	"color":   "<color>",
+	"opacity": "<alpha-value>",
+	"display": "[ block | inline | run-in ] || [ flow | flow-root | table | flex | grid | ruby ] | " +
+		"[ block | inline ]? list-item | contents | none | inline-block | inline-table | inline-flex | inline-grid | " +
+		"table-row-group | table-header-group | table-footer-group | table-row | table-cell | " +
+		"table-column-group | table-column | table-caption",
+	"visibility":            "visible | hidden | collapse",
+	"position":              "static | relative | absolute | sticky | fixed",
+	"float":                 "left | right | inline-start | inline-end | none",
+	"clear":                 "inline-start | inline-end | block-start | block-end | left | right | top | bottom | both | none",
+	"box-sizing":            "content-box | border-box",
+	"overflow":              "[ visible | hidden | clip | scroll | auto ]{1,2}",
+	"z-index":               "auto | <integer>",
+	"width":                 "auto | <length-percentage [0,∞]> | min-content | max-content | fit-content( <length-percentage [0,∞]> )",
+	"height":                "<'width'>",
+	"min-width":             "<'width'>",
+	"min-height":            "<'width'>",
+	"max-width":             "none | <length-percentage [0,∞]> | min-content | max-content | fit-content( <length-percentage [0,∞]> )",
+	"max-height":            "<'max-width'>",
+	"top":                   "auto | <length-percentage>",
+	"right":                 "<'top'>",
+	"bottom":                "<'top'>",
+	"left":                  "<'top'>",
+	"inset":                 "<'top'>{1,4}",
+	"margin-top":            "<length-percentage> | auto",
+	"margin-right":          "<'margin-top'>",
+	"margin-bottom":         "<'margin-top'>",
+	"margin-left":           "<'margin-top'>",
+	"margin":                "<'margin-top'>{1,4}",
+	"padding-top":           "<length-percentage [0,∞]>",
+	"padding-right":         "<'padding-top'>",
+	"padding-bottom":        "<'padding-top'>",
+	"padding-left":          "<'padding-top'>",
+	"padding":               "<'padding-top'>{1,4}",
+	"border-width":          "<line-width>{1,4}",
+	"border-style":          "<line-style>{1,4}",
+	"border-color":          "<color>{1,4}",
+	"border":                "<line-width> || <line-style> || <color>",
+	"border-top":            "<'border'>",
+	"border-right":          "<'border'>",
+	"border-bottom":         "<'border'>",
+	"border-left":           "<'border'>",
+	"border-radius":         "<length-percentage [0,∞]>{1,4} [ / <length-percentage [0,∞]>{1,4} ]?",
+	"outline":               "[ <color> | invert ] || [ auto | <line-style> ] || <line-width>",
+	"background-color":      "<color>",
+	"background-image":      "<bg-image>#",
+	"background-repeat":     "<repeat-style>#",
+	"background-size":       "<bg-size>#",
+	"background-position":   "<position>#",
+	"background-attachment": "<attachment>#",
+	"background-clip":       "<box>#",
+	"background-origin":     "<box>#",
+	"font-family":           "[ <family-name> | <generic-family> ]#",
+	"font-size":             "xx-small | x-small | small | medium | large | x-large | xx-large | xxx-large | larger | smaller | <length-percentage [0,∞]> | math",
+	"font-style":            "normal | italic | oblique <angle [-90,90]>?",
+	"font-weight":           "normal | bold | bolder | lighter | <number [1,1000]>",
+	"line-height":           "normal | <number [0,∞]> | <length-percentage [0,∞]>",
+	"text-align":            "start | end | left | right | center | justify | match-parent | justify-all",
+	"text-decoration-line":  "none | [ underline || overline || line-through || blink ]",
+	"text-transform":        "none | [ capitalize | uppercase | lowercase ] || full-width || full-size-kana",
+	"white-space":           "normal | pre | nowrap | pre-wrap | break-spaces | pre-line",
+	"cursor": "[ <url> [ <number> <number> ]? , ]* [ auto | default | none | context-menu | help | pointer | " +
+		"progress | wait | cell | crosshair | text | vertical-text | alias | copy | move | no-drop | not-allowed | " +
+		"grab | grabbing | e-resize | n-resize | ne-resize | nw-resize | s-resize | se-resize | sw-resize | " +
+		"w-resize | ew-resize | ns-resize | nesw-resize | nwse-resize | col-resize | row-resize | all-scroll | " +
+		"zoom-in | zoom-out ]",
+	"transform":                  "none | <transform-function>+",
+	"transition":                 "<single-transition>#",
+	"transition-duration":        "<time [0,∞]>#",
+	"transition-delay":           "<time>#",
+	"transition-timing-function": "<easing-function>#",
+	"animation":                  "<single-animation>#",
+	"animation-name":             "[ none | <custom-ident> | <string> ]#",
+	"animation-duration":         "[ auto | <time [0,∞]> ]#",
+	"animation-timing-function":  "<easing-function>#",
+	"animation-iteration-count":  "[ infinite | <number [0,∞]> ]#",
+	"flex":                       "none | [ <'flex-grow'> <'flex-shrink'>? || <'flex-basis'> ]",
+	"flex-grow":                  "<number [0,∞]>",
+	"flex-shrink":                "<number [0,∞]>",
+	"flex-basis":                 "content | <'width'>",
+	"flex-direction":             "row | row-reverse | column | column-reverse",
+	"flex-wrap":                  "nowrap | wrap | wrap-reverse",
+	"flex-flow":                  "<'flex-direction'> || <'flex-wrap'>",
+	"order":                      "<integer>",
+	"row-gap":                    "normal | <length-percentage [0,∞]>",
+	"column-gap":                 "<'row-gap'>",
+	"gap":                        "<'row-gap'> <'column-gap'>?",
+	"aspect-ratio":               "auto || <ratio>",
+}
+
+var typeGrammars = make(map[string]*Grammar)
+
+var (
+	propertyMu       sync.RWMutex
+	propertyGrammars = make(map[string]*Grammar)
+)
+
+func init() {
+	for name, def := range typeDefs {
+		typeGrammars[name] = mustParseGrammar(def)
+	}
+	for name, def := range propertyDefs {
+		propertyGrammars[name] = mustParseGrammar(def)
+	}
+}
+
+// PropertyGrammar returns the value definition of the named property, or
+// nil if it is not known.  Only the common properties are built in; others
+// can be added with RegisterProperty.
+func PropertyGrammar(name string) *Grammar {
+	propertyMu.RLock()
+	defer propertyMu.RUnlock()
+	return propertyGrammars[strings.ToLower(name)]
+}
+
+// RegisterProperty sets the value definition of the named property,
+// replacing any built-in one.  The definition may refer to other properties
+// with <'name'>, which are looked up when a value is matched.
+func RegisterProperty(name, def string) error {
+	g, err := ParseGrammar(def)
+	if err != nil {
+		return err
+	}
+	propertyMu.Lock()
+	defer propertyMu.Unlock()
+	propertyGrammars[strings.ToLower(name)] = g
+	return nil
+}
+
+var cssWideKeywords = map[string]bool{
+	"initial": true, "inherit": true, "unset": true, "revert": true, "revert-layer": true,
+}
+
+// ValidateDeclaration checks the value of d against the value definition of
+// its property.  Custom properties, the CSS-wide keywords, and values using
+// var() or attr(), which can only be checked once substituted, are always
+// valid.  A property with no known definition is an error.
+func ValidateDeclaration(d parser.Declaration) error {
+	if strings.HasPrefix(d.Name, "--") {
+		return nil
+	}
+	cvs := parser.ComponentValues(d.Value)
+	if len(cvs) == 1 && cssWideKeywords[keyword(cvs[0])] {
+		return nil
+	}
+	for _, t := range d.Value {
+		if t.Type == tokenizer.TokenFunction && (tokenizer.IdentEquals(t.Value, "var") || tokenizer.IdentEquals(t.Value, "attr")) {
+			return nil
+		}
+	}
+	g := PropertyGrammar(d.Name)
+	if g == nil {
+		return errorf("unknown property %q", d.Name)
+	}
+	if !g.Match(d.Value) {
+		return errorf("invalid value %q for %s", render(d.Value), d.Name)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// reservedIdents are the keywords that a <custom-ident> can never be: the
+// CSS-wide keywords and default.
+var reservedIdents = map[string]bool{
+	"initial": true, "inherit": true, "unset": true, "revert": true, "revert-layer": true,
+	"default": true,
+}
+
+// FamilyNeedsQuotes reports whether the font family name must be quoted to
+// be read back as the same name.  An unquoted family name is a sequence of
+// identifiers separated by single spaces, none of them a CSS-wide keyword or
+// default, and not a generic family name such as serif on its own.
+func FamilyNeedsQuotes(name string) bool {
+	words := strings.Split(name, " ")
+	if len(words) == 1 && genericFamilies[strings.ToLower(name)] {
+		return true
+	}
+	for _, w := range words {
+		if !tokenizer.IsValidIdentifier(w) || reservedIdents[strings.ToLower(w)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalized returns f with the quoting it needs: quoted if the name must
+// be, and unquoted otherwise.  Generic families stay as they are.
+func (f FontFamily) Normalized() FontFamily {
+	if !f.IsGeneric() {
+		f.Quoted = FamilyNeedsQuotes(f.Name)
+	}
+	return f
+}
+
+// NormalizeFontFamily returns the value of font-family, toks, with each
+// family name quoted only where it has to be, so that "Helvetica Neue" and
+// Helvetica  Neue both become Helvetica Neue, and an unquoted name that
+// clashes with a keyword is quoted.  The families are separated by ", ".
+func NormalizeFontFamily(toks []tokenizer.Token) ([]tokenizer.Token, error) {
+	families, err := ParseFontFamily(toks)
+	if err != nil {
+		return nil, err
+	}
+	var out []tokenizer.Token
+	for i, f := range families {
+		if i > 0 {
+			out = append(out, tokenizer.Token{Type: tokenizer.TokenComma, Value: ","}, space)
+		}
+		f = f.Normalized()
+		if f.Quoted {
+			out = append(out, tokenizer.NewString(f.Name))
+			continue
+		}
+		for j, w := range strings.Split(f.Name, " ") {
+			if j > 0 {
+				out = append(out, space)
+			}
+			out = append(out, tokenizer.NewIdent(w))
+		}
+	}
+	return out, nil
+}
+
+var space = tokenizer.Token{Type: tokenizer.TokenS, Value: " "}
+
+// NormalizeKeyframesName returns the keyframes name t, a string or
+// identifier as found in animation-name or the prelude of @keyframes, as an
+// identifier if it can be written as one, and unchanged otherwise.  Strings
+// that would be read as a keyword, such as "none" or "initial", stay
+// strings.
+func NormalizeKeyframesName(t tokenizer.Token) tokenizer.Token {
+	if t.Type != tokenizer.TokenString || !tokenizer.IsValidIdentifier(t.Value) {
+		return t
+	}
+	if lower := strings.ToLower(t.Value); reservedIdents[lower] || lower == "none" {
+		return t
+	}
+	return tokenizer.NewIdent(t.Value)
+}
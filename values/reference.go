@@ -0,0 +1,164 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Env is an env() function, such as env(safe-area-inset-top, 0px).
+type Env struct {
+	// Name is the name of the environment variable, as written.
+	Name string
+	// Indices are the integers after the name, which pick one value of a
+	// variable with several dimensions, such as viewport-segment-width.
+	Indices []int
+	// Fallback is the value after the comma, trimmed of whitespace and
+	// comments.  It is nil if there is no comma, and empty if the fallback
+	// is empty.
+	Fallback []tokenizer.Token
+}
+
+// Attr is an attr() function, such as attr(data-width type(<length>), 0).
+type Attr struct {
+	// Namespace is the namespace prefix of the attribute name, "*" for any
+	// namespace, or "" if none is given.
+	Namespace string
+	// Name is the attribute name, as written.
+	Name string
+	// Type is how the attribute is to be parsed: the syntax given by type(),
+	// such as "<length> | auto", or a keyword such as raw-string, or "" if
+	// the function does not say.
+	Type string
+	// Unit is set instead of Type when the attribute is to be parsed as a
+	// number with a unit, such as px, or "%".
+	Unit string
+	// Fallback is the value after the comma, as for Env.
+	Fallback []tokenizer.Token
+}
+
+// The attr() types, other than units.  Only raw-string and number remain
+// in the current specification; the rest are from earlier drafts.
+var attrTypes = map[string]bool{
+	"raw-string": true, "number": true,
+	"string": true, "url": true, "ident": true, "color": true, "integer": true,
+	"percentage": true, "length": true, "angle": true, "time": true,
+	"frequency": true, "flex": true,
+}
+
+// FindFunctions returns every call to the named function in toks, at any
+// depth, in the order they start.  A call nested in another, such as an
+// env() in the fallback of an env(), is returned as well as the outer one.
+func FindFunctions(toks []tokenizer.Token, name string) [][]tokenizer.Token {
+	var found [][]tokenizer.Token
+	for i, t := range toks {
+		if t.Type == tokenizer.TokenFunction && tokenizer.IdentEquals(t.Value, name) {
+			found = append(found, parser.ComponentValues(toks[i:])[0])
+		}
+	}
+	return found
+}
+
+// cutComma splits toks at the first comma that is not inside a block or
+// function.  after is trimmed of whitespace and comments, and is nil if
+// there is no comma.
+func cutComma(toks []tokenizer.Token) (before, after []tokenizer.Token) {
+	depth := 0
+	for i, t := range toks {
+		switch t.Type {
+		case tokenizer.TokenFunction, tokenizer.TokenOpenParen, tokenizer.TokenOpenBracket, tokenizer.TokenOpenBrace:
+			depth++
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket, tokenizer.TokenCloseBrace:
+			if depth > 0 {
+				depth--
+			}
+		case tokenizer.TokenComma:
+			if depth == 0 {
+				return toks[:i], trim(toks[i+1:])
+			}
+		}
+	}
+	return toks, nil
+}
+
+// ParseEnv parses an env() function.
+func ParseEnv(toks []tokenizer.Token) (*Env, error) {
+	cv, err := single(toks, "env()")
+	if err != nil {
+		return nil, err
+	}
+	name, args, _ := function(cv)
+	if name != "env" {
+		return nil, errorf("expected env(), got %q", render(cv))
+	}
+	before, after := cutComma(args)
+	cvs := parser.ComponentValues(before)
+	if len(cvs) == 0 || cvs[0][0].Type != tokenizer.TokenIdent {
+		return nil, errorf("expected a variable name in env()")
+	}
+	e := &Env{Name: cvs[0][0].Value, Fallback: after}
+	for _, cv := range cvs[1:] {
+		n, ok := cv[0].Int()
+		if len(cv) != 1 || cv[0].Type != tokenizer.TokenNumber || !ok || n < 0 {
+			return nil, errorf("bad index %q in env()", render(cv))
+		}
+		e.Indices = append(e.Indices, int(n))
+	}
+	return e, nil
+}
+
+// ParseAttr parses an attr() function.
+func ParseAttr(toks []tokenizer.Token) (*Attr, error) {
+	cv, err := single(toks, "attr()")
+	if err != nil {
+		return nil, err
+	}
+	name, args, _ := function(cv)
+	if name != "attr" {
+		return nil, errorf("expected attr(), got %q", render(cv))
+	}
+	before, after := cutComma(args)
+	a := &Attr{Fallback: after}
+
+	// The namespace prefix and name are read from the raw tokens, as they
+	// may not have whitespace between them.
+	rest := trim(before)
+	isDelim := func(i int, d string) bool {
+		return i < len(rest) && rest[i].Type == tokenizer.TokenDelim && rest[i].Value == d
+	}
+	switch {
+	case isDelim(0, "|"):
+		rest = rest[1:]
+	case isDelim(1, "|") && (rest[0].Type == tokenizer.TokenIdent || isDelim(0, "*")):
+		a.Namespace = rest[0].Value
+		rest = rest[2:]
+	}
+	if len(rest) == 0 || rest[0].Type != tokenizer.TokenIdent {
+		return nil, errorf("expected an attribute name in attr()")
+	}
+	a.Name = rest[0].Value
+
+	cvs := parser.ComponentValues(rest[1:])
+	switch {
+	case len(cvs) == 0:
+	case len(cvs) > 1:
+		return nil, errorf("unexpected %q in attr()", render(cvs[1]))
+	case isFunction(cvs[0], "type"):
+		_, syntax, _ := function(cvs[0])
+		if a.Type = render(trim(syntax)); a.Type == "" {
+			return nil, errorf("empty type() in attr()")
+		}
+	case attrTypes[keyword(cvs[0])]:
+		a.Type = keyword(cvs[0])
+	case keyword(cvs[0]) != "" && tokenizer.ClassifyUnit(cvs[0][0].Value) != tokenizer.UnitUnknown:
+		a.Unit = keyword(cvs[0])
+	case cvs[0][0].Type == tokenizer.TokenDelim && cvs[0][0].Value == "%":
+		a.Unit = "%"
+	default:
+		return nil, errorf("unknown attr() type %q", strings.TrimSpace(render(cvs[0])))
+	}
+	return a, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"math"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// RoundOptions configures RoundNumbers.
+type RoundOptions struct {
+	// Decimals is the number of digits to keep after the decimal point.
+	Decimals int
+	// KeepPercentages leaves percentages exact.  A token transform cannot
+	// tell which function a token is in, so this covers all percentages,
+	// including the gradient stop positions where rounding shows the most.
+	KeepPercentages bool
+}
+
+// extraDigits are the digits kept beyond RoundOptions.Decimals for units
+// that are much larger than the usual unit of their kind (px, deg, ms, and
+// Hz), so that rounding them loses no more than rounding the usual unit.
+var extraDigits = map[string]int{
+	"in": 2, "cm": 2, "mm": 1, "pt": 1, "pc": 2,
+	"turn": 3, "rad": 2,
+	"s":   3,
+	"khz": 3,
+}
+
+// RoundNumbers returns a token transform, for use with
+// tokenizer.NewTransformReader or csshttp.Handler, that rounds numbers,
+// percentages, and dimensions to opts.Decimals digits after the decimal
+// point.  With 3 decimals, 0.16666667em becomes 0.167em.
+//
+// Numbers written as integers are never changed, and neither are numbers
+// that would round to zero, since a zero can behave differently from a
+// small value (a hairline border would disappear).  Units that are large for
+// their kind, such as turn and s, keep extra digits.  A token is only
+// replaced if that makes it shorter.
+//
+// The transform keeps no state between tokens, so it can be shared.
+func RoundNumbers(opts RoundOptions) func(tokenizer.Token) []tokenizer.Token {
+	return func(t tokenizer.Token) []tokenizer.Token {
+		return []tokenizer.Token{roundToken(t, opts)}
+	}
+}
+
+func roundToken(t tokenizer.Token, opts RoundOptions) tokenizer.Token {
+	e, ok := t.Extra.(*tokenizer.TokenExtraNumeric)
+	if !ok || e == nil || !e.NonInteger {
+		return t
+	}
+	if t.Type == tokenizer.TokenPercentage && opts.KeepPercentages {
+		return t
+	}
+	f, ok := t.Float()
+	if !ok || math.IsInf(f, 0) {
+		return t
+	}
+	digits := opts.Decimals
+	if digits < 0 {
+		digits = 0
+	}
+	digits += extraDigits[unit(t)]
+	r := roundTo(f, digits)
+	if r == 0 {
+		return t
+	}
+	var rounded tokenizer.Token
+	switch t.Type {
+	case tokenizer.TokenNumber:
+		rounded = tokenizer.NewNumber(r)
+	case tokenizer.TokenPercentage:
+		rounded = tokenizer.NewPercentage(r)
+	case tokenizer.TokenDimension:
+		rounded = tokenizer.NewDimension(r, e.Dimension)
+	}
+	if len(rounded.Value) >= len(t.Value) {
+		return t
+	}
+	return rounded
+}
+
+// roundTo rounds f to the given number of digits after the decimal point,
+// with halves rounded away from zero.
+func roundTo(f float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	if f < 0 {
+		return -math.Floor(-f*p+0.5) / p
+	}
+	return math.Floor(f*p+0.5) / p
+}
@@ -0,0 +1,535 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+var comma = tokenizer.Token{Type: tokenizer.TokenComma, Value: ","}
+
+// boxSides are the longhands of the shorthands that take one to four
+// values, in the order the values are given.
+var boxSides = map[string][4]string{
+	"margin":       {"margin-top", "margin-right", "margin-bottom", "margin-left"},
+	"padding":      {"padding-top", "padding-right", "padding-bottom", "padding-left"},
+	"inset":        {"top", "right", "bottom", "left"},
+	"border-width": {"border-top-width", "border-right-width", "border-bottom-width", "border-left-width"},
+	"border-style": {"border-top-style", "border-right-style", "border-bottom-style", "border-left-style"},
+	"border-color": {"border-top-color", "border-right-color", "border-bottom-color", "border-left-color"},
+}
+
+var borderSides = []string{"top", "right", "bottom", "left"}
+
+// ExpandShorthand returns the longhand declarations that the shorthand d
+// sets, each with the importance and index of d.  Parts of the value that
+// are left out give their longhands the initial value.  A declaration that
+// is not a shorthand is returned as it is.
+//
+// The shorthands expanded are margin, padding, inset, border and its
+// parts, background, font, flex, grid, transition, and animation.  The
+// grid shorthand is expanded only in its track list and auto-flow forms;
+// a grid with template areas gives an error.  A value using var() cannot
+// be expanded until it is substituted, and gives an error.
+func ExpandShorthand(d parser.Declaration) ([]parser.Declaration, error) {
+	name := strings.ToLower(d.Name)
+	expand, ok := shorthands[name]
+	if !ok {
+		if sides, isBox := boxSides[name]; isBox {
+			expand, ok = boxShorthand(sides), true
+		} else if strings.HasPrefix(name, "border-") && isBorderSide(name[len("border-"):]) {
+			expand, ok = borderShorthand(name[len("border-"):]), true
+		}
+	}
+	if !ok {
+		return []parser.Declaration{d}, nil
+	}
+	cvs := parser.ComponentValues(d.Value)
+	for _, t := range d.Value {
+		if t.Type == tokenizer.TokenFunction && tokenizer.IdentEquals(t.Value, "var") {
+			return nil, errorf("cannot expand %s with var() in its value", d.Name)
+		}
+	}
+	if len(cvs) == 1 && cssWideKeywords[keyword(cvs[0])] {
+		// every longhand takes the keyword; expand a stand-in value to find
+		// their names
+		longhands, err := expand(initialValues[name])
+		for i := range longhands {
+			longhands[i].Value = cvs[0]
+		}
+		return withSource(longhands, d), err
+	}
+	if g := PropertyGrammar(name); g != nil && !g.Match(d.Value) {
+		return nil, errorf("invalid value %q for %s", render(d.Value), d.Name)
+	}
+	longhands, err := expand(d.Value)
+	if err != nil {
+		return nil, err
+	}
+	return withSource(longhands, d), nil
+}
+
+// initialValues are values of the shorthands that name every longhand, for
+// expanding the CSS-wide keywords.
+var initialValues = map[string][]tokenizer.Token{
+	"margin": value("0"), "padding": value("0"), "inset": value("auto"),
+	"border-width": value("medium"), "border-style": value("none"), "border-color": value("currentcolor"),
+	"border": value("none"), "border-top": value("none"), "border-right": value("none"),
+	"border-bottom": value("none"), "border-left": value("none"),
+	"background": value("none"), "font": value("medium serif"), "flex": value("none"), "grid": value("none"),
+	"transition": value("all"), "animation": value("none"),
+}
+
+func withSource(longhands []parser.Declaration, d parser.Declaration) []parser.Declaration {
+	for i := range longhands {
+		longhands[i].Important = d.Important
+		longhands[i].Index = d.Index
+	}
+	return longhands
+}
+
+func isBorderSide(s string) bool {
+	for _, side := range borderSides {
+		if s == side {
+			return true
+		}
+	}
+	return false
+}
+
+var shorthands = map[string]func([]tokenizer.Token) ([]parser.Declaration, error){
+	"border":     expandBorder,
+	"background": expandBackground,
+	"font":       expandFont,
+	"flex":       expandFlex,
+	"grid":       expandGrid,
+	"transition": expandTransition,
+	"animation":  expandAnimation,
+}
+
+// value tokenizes the CSS source s, for initial values.
+func value(s string) []tokenizer.Token {
+	toks, _ := tokenizer.TokenizeAll([]byte(s), nil)
+	return toks
+}
+
+// joinValues joins component values with spaces.
+func joinValues(cvs [][]tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	for i, cv := range cvs {
+		if i > 0 {
+			out = append(out, space)
+		}
+		out = append(out, cv...)
+	}
+	return out
+}
+
+// joinLayers joins the values of the layers of a list-valued property with
+// commas.
+func joinLayers(layers [][]tokenizer.Token) []tokenizer.Token {
+	var out []tokenizer.Token
+	for i, l := range layers {
+		if i > 0 {
+			out = append(out, comma, space)
+		}
+		out = append(out, l...)
+	}
+	return out
+}
+
+// boxShorthand returns the expansion of a shorthand that takes one to four
+// values for the four sides, which repeat as in "margin: 1px 2px".
+func boxShorthand(sides [4]string) func([]tokenizer.Token) ([]parser.Declaration, error) {
+	return func(toks []tokenizer.Token) ([]parser.Declaration, error) {
+		cvs := parser.ComponentValues(toks)
+		if len(cvs) < 1 || len(cvs) > 4 {
+			return nil, errorf("expected one to four values, got %q", render(toks))
+		}
+		// the value of each side, by the number of values given
+		pick := [][4]int{{0, 0, 0, 0}, {0, 1, 0, 1}, {0, 1, 2, 1}, {0, 1, 2, 3}}[len(cvs)-1]
+		out := make([]parser.Declaration, 4)
+		for i, side := range sides {
+			out[i] = parser.Declaration{Name: side, Value: cvs[pick[i]]}
+		}
+		return out, nil
+	}
+}
+
+// splitBorder returns the width, style, and color of a border value.
+func splitBorder(toks []tokenizer.Token) (width, style, color []tokenizer.Token, err error) {
+	for _, cv := range parser.ComponentValues(toks) {
+		switch {
+		case width == nil && typeGrammars["line-width"].root.match([][]tokenizer.Token{cv}, 0, func(i int) bool { return i == 1 }):
+			width = cv
+		case style == nil && typeGrammars["line-style"].root.match([][]tokenizer.Token{cv}, 0, func(i int) bool { return i == 1 }):
+			style = cv
+		case color == nil && IsColor(cv):
+			color = cv
+		default:
+			return nil, nil, nil, errorf("unexpected %q in border", render(cv))
+		}
+	}
+	if width == nil {
+		width = value("medium")
+	}
+	if style == nil {
+		style = value("none")
+	}
+	if color == nil {
+		color = value("currentcolor")
+	}
+	return width, style, color, nil
+}
+
+func borderShorthand(side string) func([]tokenizer.Token) ([]parser.Declaration, error) {
+	return func(toks []tokenizer.Token) ([]parser.Declaration, error) {
+		width, style, color, err := splitBorder(toks)
+		if err != nil {
+			return nil, err
+		}
+		return []parser.Declaration{
+			{Name: "border-" + side + "-width", Value: width},
+			{Name: "border-" + side + "-style", Value: style},
+			{Name: "border-" + side + "-color", Value: color},
+		}, nil
+	}
+}
+
+// expandBorder sets the width, style, and color of all four sides.  The
+// border shorthand also resets border-image, which is not included.
+func expandBorder(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	width, style, color, err := splitBorder(toks)
+	if err != nil {
+		return nil, err
+	}
+	var out []parser.Declaration
+	for _, part := range []struct {
+		suffix string
+		value  []tokenizer.Token
+	}{{"width", width}, {"style", style}, {"color", color}} {
+		for _, side := range borderSides {
+			out = append(out, parser.Declaration{Name: "border-" + side + "-" + part.suffix, Value: part.value})
+		}
+	}
+	return out, nil
+}
+
+var backgroundLonghands = []string{
+	"background-image", "background-position", "background-size", "background-repeat",
+	"background-attachment", "background-origin", "background-clip",
+}
+
+// expandBackground splits each layer of a background into its parts.  The
+// color can only be given in the last layer.
+func expandBackground(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	layers := parser.SplitCommas(toks)
+	values := make([][][]tokenizer.Token, len(backgroundLonghands))
+	color := value("transparent")
+	for n, layer := range layers {
+		cvs := parser.ComponentValues(layer)
+		var image, position, size, repeat, attachment []tokenizer.Token
+		var boxes [][]tokenizer.Token
+		for i := 0; i < len(cvs); {
+			cv := cvs[i]
+			kw := keyword(cv)
+			switch {
+			case image == nil && typeGrammars["bg-image"].root.match(cvs, i, func(j int) bool { return j == i+1 }):
+				image = cv
+				i++
+			case repeat == nil && typeGrammars["repeat-style"].root.match(cvs, i, func(j int) bool { return j > i }):
+				end := i + 1
+				if end < len(cvs) && typeGrammars["repeat-style"].root.match(cvs, i, func(j int) bool { return j == i+2 }) {
+					end++
+				}
+				repeat = joinValues(cvs[i:end])
+				i = end
+			case attachment == nil && typeGrammars["attachment"].root.match(cvs, i, func(j int) bool { return j == i+1 }):
+				attachment = cv
+				i++
+			case len(boxes) < 2 && typeGrammars["box"].root.match(cvs, i, func(j int) bool { return j == i+1 }):
+				boxes = append(boxes, cv)
+				i++
+			case position == nil && (isLengthLike(cv) || kw == "left" || kw == "right" || kw == "top" || kw == "bottom" || kw == "center"):
+				// the longest run that is a position, then an optional size
+				end := i
+				for j := i + 1; j <= len(cvs) && j <= i+4; j++ {
+					if typeGrammars["position"].root.match(cvs[:j], i, func(k int) bool { return k == j }) {
+						end = j
+					}
+				}
+				if end == i {
+					return nil, errorf("bad background position in %q", render(layer))
+				}
+				position = joinValues(cvs[i:end])
+				i = end
+				if i < len(cvs) && len(cvs[i]) == 1 && cvs[i][0].Type == tokenizer.TokenDelim && cvs[i][0].Value == "/" {
+					i++
+					end := i
+					for j := i + 1; j <= len(cvs) && j <= i+2; j++ {
+						if typeGrammars["bg-size"].root.match(cvs[:j], i, func(k int) bool { return k == j }) {
+							end = j
+						}
+					}
+					if end == i {
+						return nil, errorf("bad background size in %q", render(layer))
+					}
+					size = joinValues(cvs[i:end])
+					i = end
+				}
+			case n == len(layers)-1 && IsColor(cv):
+				color = cv
+				i++
+			default:
+				return nil, errorf("unexpected %q in background", render(cv))
+			}
+		}
+		defaults := []string{"none", "0% 0%", "auto", "repeat", "scroll", "padding-box", "border-box"}
+		parts := [][]tokenizer.Token{image, position, size, repeat, attachment, nil, nil}
+		if len(boxes) > 0 {
+			parts[5], parts[6] = boxes[0], boxes[len(boxes)-1]
+		}
+		for i, p := range parts {
+			if p == nil {
+				p = value(defaults[i])
+			}
+			values[i] = append(values[i], p)
+		}
+	}
+	out := []parser.Declaration{{Name: "background-color", Value: color}}
+	for i, name := range backgroundLonghands {
+		out = append(out, parser.Declaration{Name: name, Value: joinLayers(values[i])})
+	}
+	return out, nil
+}
+
+func expandFont(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	f, err := ParseFont(toks)
+	if err != nil {
+		return nil, err
+	}
+	if f.System != "" {
+		return nil, errorf("cannot expand the system font %s", f.System)
+	}
+	lineHeight := f.LineHeight
+	if lineHeight == nil {
+		lineHeight = value("normal")
+	}
+	var families [][]tokenizer.Token
+	for _, fam := range f.Families {
+		families = append(families, value(fam.String()))
+	}
+	return []parser.Declaration{
+		{Name: "font-style", Value: value(f.Style)},
+		{Name: "font-variant", Value: value(f.Variant)},
+		{Name: "font-weight", Value: value(f.Weight)},
+		{Name: "font-stretch", Value: value(f.Stretch)},
+		{Name: "font-size", Value: f.Size},
+		{Name: "line-height", Value: lineHeight},
+		{Name: "font-family", Value: joinLayers(families)},
+	}, nil
+}
+
+// expandFlex follows the rules of the flex shorthand: a lone number is the
+// grow factor with a basis of 0, and none and auto stand for "0 0 auto" and
+// "1 1 auto".
+func expandFlex(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	cvs := parser.ComponentValues(toks)
+	grow, shrink, basis := value("1"), value("1"), value("0")
+	switch keyword(cvs[0]) {
+	case "none":
+		grow, shrink, basis = value("0"), value("0"), value("auto")
+		cvs = nil
+	case "auto":
+		basis = value("auto")
+		cvs = nil
+	}
+	var numbers [][]tokenizer.Token
+	for i, cv := range cvs {
+		// a unitless number is a factor, unless it is a zero after both
+		// factors; the shrink factor must follow the grow factor
+		if cv[0].Type == tokenizer.TokenNumber && (len(numbers) == 0 || len(numbers) == 1 && cvs[i-1][0].Type == tokenizer.TokenNumber) {
+			numbers = append(numbers, cv)
+		} else {
+			basis = cv
+		}
+	}
+	if len(numbers) > 0 {
+		grow = numbers[0]
+	}
+	if len(numbers) > 1 {
+		shrink = numbers[1]
+	}
+	return []parser.Declaration{
+		{Name: "flex-grow", Value: grow},
+		{Name: "flex-shrink", Value: shrink},
+		{Name: "flex-basis", Value: basis},
+	}, nil
+}
+
+// expandGrid expands the forms of grid that do not use template areas:
+// none, rows / columns, and the auto-flow forms.
+func expandGrid(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	decls := func(rows, columns, autoRows, autoColumns, flow string, r, c, ar, ac []tokenizer.Token) []parser.Declaration {
+		pick := func(toks []tokenizer.Token, def string) []tokenizer.Token {
+			if len(toks) == 0 {
+				return value(def)
+			}
+			return toks
+		}
+		return []parser.Declaration{
+			{Name: "grid-template-rows", Value: pick(r, rows)},
+			{Name: "grid-template-columns", Value: pick(c, columns)},
+			{Name: "grid-template-areas", Value: value("none")},
+			{Name: "grid-auto-rows", Value: pick(ar, autoRows)},
+			{Name: "grid-auto-columns", Value: pick(ac, autoColumns)},
+			{Name: "grid-auto-flow", Value: value(flow)},
+		}
+	}
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 1 && keyword(cvs[0]) == "none" {
+		return decls("none", "none", "auto", "auto", "row", nil, nil, nil, nil), nil
+	}
+	for _, cv := range cvs {
+		if cv[0].Type == tokenizer.TokenString {
+			return nil, errorf("cannot expand grid with template areas")
+		}
+	}
+	slash := -1
+	for i, cv := range cvs {
+		if len(cv) == 1 && cv[0].Type == tokenizer.TokenDelim && cv[0].Value == "/" {
+			if slash >= 0 {
+				return nil, errorf("more than one '/' in grid")
+			}
+			slash = i
+		}
+	}
+	if slash <= 0 || slash == len(cvs)-1 {
+		return nil, errorf("expected rows / columns in grid, got %q", render(toks))
+	}
+	rows, columns := cvs[:slash], cvs[slash+1:]
+	switch {
+	case hasAutoFlow(rows) && hasAutoFlow(columns):
+		return nil, errorf("auto-flow on both sides of grid")
+	case hasAutoFlow(rows):
+		flow, auto := autoFlow(rows)
+		return decls("", "", "auto", "auto", "row"+flow, value("none"), joinValues(columns), joinValues(auto), nil), nil
+	case hasAutoFlow(columns):
+		flow, auto := autoFlow(columns)
+		return decls("", "", "auto", "auto", "column"+flow, joinValues(rows), value("none"), nil, joinValues(auto)), nil
+	}
+	return decls("", "", "auto", "auto", "row", joinValues(rows), joinValues(columns), nil, nil), nil
+}
+
+func hasAutoFlow(cvs [][]tokenizer.Token) bool {
+	for _, cv := range cvs {
+		if keyword(cv) == "auto-flow" {
+			return true
+		}
+	}
+	return false
+}
+
+// autoFlow removes auto-flow and dense from cvs, returning " dense" if it
+// was there and the remaining track sizes.
+func autoFlow(cvs [][]tokenizer.Token) (string, [][]tokenizer.Token) {
+	var flow string
+	var rest [][]tokenizer.Token
+	for _, cv := range cvs {
+		switch keyword(cv) {
+		case "auto-flow":
+		case "dense":
+			flow = " dense"
+		default:
+			rest = append(rest, cv)
+		}
+	}
+	return flow, rest
+}
+
+func expandTransition(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	names := []string{"transition-property", "transition-duration", "transition-timing-function", "transition-delay", "transition-behavior"}
+	defaults := []string{"all", "0s", "ease", "0s", "normal"}
+	return expandLayers(toks, names, defaults, func(cv []tokenizer.Token, set []bool) int {
+		kw := keyword(cv)
+		switch {
+		case matchesDataType("time", cv):
+			if !set[1] {
+				return 1
+			}
+			return 3
+		case matchesDataType("easing-function", cv):
+			return 2
+		case kw == "normal" || kw == "allow-discrete":
+			return 4
+		case kw != "":
+			return 0
+		}
+		return -1
+	})
+}
+
+func expandAnimation(toks []tokenizer.Token) ([]parser.Declaration, error) {
+	names := []string{
+		"animation-duration", "animation-timing-function", "animation-delay", "animation-iteration-count",
+		"animation-direction", "animation-fill-mode", "animation-play-state", "animation-name",
+	}
+	defaults := []string{"0s", "ease", "0s", "1", "normal", "none", "running", "none"}
+	return expandLayers(toks, names, defaults, func(cv []tokenizer.Token, set []bool) int {
+		kw := keyword(cv)
+		// a keyword goes to the first longhand it is valid for that is not
+		// yet set, so the name comes last
+		switch {
+		case matchesDataType("time", cv):
+			if !set[0] {
+				return 0
+			}
+			return 2
+		case matchesDataType("easing-function", cv) && !set[1]:
+			return 1
+		case kw == "infinite" || cv[0].Type == tokenizer.TokenNumber:
+			return 3
+		case (kw == "normal" || kw == "reverse" || kw == "alternate" || kw == "alternate-reverse") && !set[4]:
+			return 4
+		case (kw == "none" || kw == "forwards" || kw == "backwards" || kw == "both") && !set[5]:
+			return 5
+		case (kw == "running" || kw == "paused") && !set[6]:
+			return 6
+		case kw != "" || cv[0].Type == tokenizer.TokenString:
+			return 7
+		}
+		return -1
+	})
+}
+
+// expandLayers expands a comma-separated list of layers, each a set of
+// values in any order.  slot returns the index of the longhand a value
+// belongs to, given the longhands already set in the layer, or -1.
+func expandLayers(toks []tokenizer.Token, names, defaults []string, slot func(cv []tokenizer.Token, set []bool) int) ([]parser.Declaration, error) {
+	values := make([][][]tokenizer.Token, len(names))
+	for _, layer := range parser.SplitCommas(toks) {
+		parts := make([][]tokenizer.Token, len(names))
+		set := make([]bool, len(names))
+		for _, cv := range parser.ComponentValues(layer) {
+			i := slot(cv, set)
+			if i < 0 || set[i] {
+				return nil, errorf("unexpected %q in %q", render(cv), render(layer))
+			}
+			parts[i], set[i] = cv, true
+		}
+		for i, p := range parts {
+			if p == nil {
+				p = value(defaults[i])
+			}
+			values[i] = append(values[i], p)
+		}
+	}
+	out := make([]parser.Declaration, len(names))
+	for i, name := range names {
+		out[i] = parser.Declaration{Name: name, Value: joinLayers(values[i])}
+	}
+	return out, nil
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Syntax is a syntax descriptor of a registered custom property, such as
+// "<length> | auto" or "<color>#", as used by @property.
+type Syntax struct {
+	// Universal is set for the syntax "*", which accepts any value.
+	Universal bool
+	// Alternatives are the components separated by '|', any one of which
+	// the value must match.
+	Alternatives []SyntaxComponent
+}
+
+// SyntaxComponent is one alternative of a syntax descriptor.
+type SyntaxComponent struct {
+	// Type is the name of a data type without the angle brackets, such as
+	// "length".  It is "" if the component is a keyword.
+	Type string
+	// Keyword is the identifier to match if Type is "".
+	Keyword string
+	// Multiplier is '+' for a space-separated list, '#' for a
+	// comma-separated list, or 0 for a single value.
+	Multiplier byte
+}
+
+// syntaxTypes are the data type names a syntax descriptor may use.
+var syntaxTypes = map[string]bool{
+	"length": true, "number": true, "percentage": true, "length-percentage": true,
+	"color": true, "image": true, "url": true, "integer": true, "angle": true,
+	"time": true, "resolution": true, "transform-function": true,
+	"custom-ident": true, "transform-list": true, "string": true,
+}
+
+// ParseSyntax parses a syntax descriptor, given as the contents of the
+// string.  Data type names are case-sensitive, as in the specification.
+func ParseSyntax(s string) (*Syntax, error) {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return &Syntax{Universal: true}, nil
+	}
+	syn := &Syntax{}
+	for _, alt := range strings.Split(s, "|") {
+		alt = strings.Trim(alt, " \t\n\r\f")
+		var c SyntaxComponent
+		if n := len(alt); n > 0 && (alt[n-1] == '+' || alt[n-1] == '#') {
+			c.Multiplier, alt = alt[n-1], alt[:n-1]
+		}
+		if strings.HasPrefix(alt, "<") && strings.HasSuffix(alt, ">") {
+			c.Type = alt[1 : len(alt)-1]
+			if !syntaxTypes[c.Type] {
+				return nil, errorf("unknown data type %q in syntax %q", alt, s)
+			}
+			if c.Type == "transform-list" && c.Multiplier != 0 {
+				return nil, errorf("<transform-list> cannot take a multiplier")
+			}
+		} else {
+			if !tokenizer.IsValidIdentifier(alt) || reservedIdents[strings.ToLower(alt)] {
+				return nil, errorf("bad component %q in syntax %q", alt, s)
+			}
+			c.Keyword = alt
+		}
+		syn.Alternatives = append(syn.Alternatives, c)
+	}
+	return syn, nil
+}
+
+// String returns s as a syntax descriptor, without the quotes.
+func (s *Syntax) String() string {
+	if s.Universal {
+		return "*"
+	}
+	var buf bytes.Buffer
+	for i, c := range s.Alternatives {
+		if i > 0 {
+			buf.WriteString(" | ")
+		}
+		if c.Type != "" {
+			buf.WriteString("<" + c.Type + ">")
+		} else {
+			buf.WriteString(c.Keyword)
+		}
+		if c.Multiplier != 0 {
+			buf.WriteByte(c.Multiplier)
+		}
+	}
+	return buf.String()
+}
+
+// Matches reports whether the value toks matches s.  Math functions such as
+// calc() are accepted wherever a numeric type is, without checking the
+// type of their result.
+func (s *Syntax) Matches(toks []tokenizer.Token) bool {
+	if s.Universal {
+		return len(parser.ComponentValues(toks)) > 0
+	}
+	for _, c := range s.Alternatives {
+		if c.matches(toks) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c SyntaxComponent) matches(toks []tokenizer.Token) bool {
+	if c.Type == "transform-list" {
+		fns, err := ParseTransform(toks)
+		return err == nil && fns != nil
+	}
+	var items [][]tokenizer.Token
+	switch c.Multiplier {
+	case '#':
+		for _, part := range parser.SplitCommas(toks) {
+			cvs := parser.ComponentValues(part)
+			if len(cvs) != 1 {
+				return false
+			}
+			items = append(items, cvs[0])
+		}
+	case '+':
+		items = parser.ComponentValues(toks)
+	default:
+		items = parser.ComponentValues(toks)
+		if len(items) != 1 {
+			return false
+		}
+	}
+	if len(items) == 0 {
+		return false
+	}
+	for _, cv := range items {
+		if !c.matchesOne(cv) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesOne reports whether the single component value cv matches c.
+func (c SyntaxComponent) matchesOne(cv []tokenizer.Token) bool {
+	if c.Type == "" {
+		return len(cv) == 1 && cv[0].Type == tokenizer.TokenIdent && cv[0].Value == c.Keyword
+	}
+	return matchesDataType(c.Type, cv)
+}
+
+// matchesDataType reports whether the single component value cv is of the
+// data type typ, such as "length".  Math functions such as calc() match
+// any numeric type.
+func matchesDataType(typ string, cv []tokenizer.Token) bool {
+	t := cv[0]
+	if name, _, ok := function(cv); ok && mathFunctions[name] {
+		switch typ {
+		case "length", "number", "percentage", "length-percentage", "integer", "angle", "time", "resolution", "flex":
+			return true
+		}
+		return false
+	}
+	kind := tokenizer.ClassifyUnit(unit(t))
+	switch typ {
+	case "length":
+		return t.Type == tokenizer.TokenDimension && kind.IsLength() || isZero(t)
+	case "length-percentage":
+		return t.Type == tokenizer.TokenDimension && kind.IsLength() || isZero(t) || t.Type == tokenizer.TokenPercentage
+	case "number":
+		return t.Type == tokenizer.TokenNumber
+	case "integer":
+		_, ok := t.Int()
+		return t.Type == tokenizer.TokenNumber && ok
+	case "percentage":
+		return t.Type == tokenizer.TokenPercentage
+	case "angle":
+		return t.Type == tokenizer.TokenDimension && kind == tokenizer.UnitAngle || isZero(t)
+	case "time":
+		return t.Type == tokenizer.TokenDimension && kind == tokenizer.UnitTime
+	case "resolution":
+		return t.Type == tokenizer.TokenDimension && kind == tokenizer.UnitResolution
+	case "flex":
+		return t.Type == tokenizer.TokenDimension && kind == tokenizer.UnitFlex
+	case "color":
+		return IsColor(cv)
+	case "url":
+		_, ok := imageURL(cv)
+		return ok && t.Type != tokenizer.TokenString
+	case "image":
+		if _, ok := imageURL(cv); ok && t.Type != tokenizer.TokenString {
+			return true
+		}
+		name, _, _ := function(cv)
+		return strings.HasSuffix(name, "-gradient") || name == "image-set" || name == "-webkit-image-set" ||
+			name == "cross-fade" || name == "image" || name == "element"
+	case "transform-function":
+		_, err := parseTransformFunction(cv)
+		return err == nil
+	case "easing-function":
+		_, err := ParseEasing(cv)
+		return err == nil
+	case "custom-ident":
+		kw := keyword(cv)
+		return kw != "" && !reservedIdents[kw]
+	case "ident":
+		return keyword(cv) != ""
+	case "string":
+		return t.Type == tokenizer.TokenString
+	}
+	return false
+}
+
+// isZero reports whether t is the number 0, which may stand for a length
+// or an angle.
+func isZero(t tokenizer.Token) bool {
+	f, ok := t.Float()
+	return ok && t.Type == tokenizer.TokenNumber && f == 0
+}
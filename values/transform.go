@@ -0,0 +1,308 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+package values
+
+import (
+	"math"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// TransformFunction is one function of a transform value, such as
+// translate(10px, 20%).
+type TransformFunction struct {
+	// Name is the function name in lower case, such as "translatex".
+	Name string
+	// Args are the arguments, each a single number, percentage, or
+	// dimension token, or the keyword none for perspective().
+	Args []tokenizer.Token
+}
+
+// The kinds of transform function arguments.
+const (
+	argNumber      = 'n' // a number
+	argAngle       = 'a' // an angle, or zero
+	argLengthPct   = 'l' // a length or percentage, or zero
+	argLength      = 'L' // a length, or zero
+	argScale       = 's' // a number or percentage
+	argPerspective = 'p' // a length, or none
+)
+
+var transformArgs = map[string]struct {
+	kinds    string
+	optional int
+}{
+	"matrix":      {"nnnnnn", 0},
+	"matrix3d":    {"nnnnnnnnnnnnnnnn", 0},
+	"translate":   {"ll", 1},
+	"translatex":  {"l", 0},
+	"translatey":  {"l", 0},
+	"translatez":  {"L", 0},
+	"translate3d": {"llL", 0},
+	"scale":       {"ss", 1},
+	"scalex":      {"s", 0},
+	"scaley":      {"s", 0},
+	"scalez":      {"s", 0},
+	"scale3d":     {"sss", 0},
+	"rotate":      {"a", 0},
+	"rotatex":     {"a", 0},
+	"rotatey":     {"a", 0},
+	"rotatez":     {"a", 0},
+	"rotate3d":    {"nnna", 0},
+	"skew":        {"aa", 1},
+	"skewx":       {"a", 0},
+	"skewy":       {"a", 0},
+	"perspective": {"p", 0},
+}
+
+// ParseTransform parses the value of the transform property.  The value
+// none gives no functions.
+func ParseTransform(toks []tokenizer.Token) ([]TransformFunction, error) {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) == 0 {
+		return nil, errorf("empty transform")
+	}
+	if len(cvs) == 1 && keyword(cvs[0]) == "none" {
+		return nil, nil
+	}
+	fns := make([]TransformFunction, 0, len(cvs))
+	for _, cv := range cvs {
+		f, err := parseTransformFunction(cv)
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, f)
+	}
+	return fns, nil
+}
+
+func parseTransformFunction(cv []tokenizer.Token) (TransformFunction, error) {
+	name, args, ok := function(cv)
+	if !ok {
+		return TransformFunction{}, errorf("expected a transform function, got %q", render(cv))
+	}
+	spec, ok := transformArgs[name]
+	if !ok {
+		return TransformFunction{}, errorf("unknown transform function %q", cv[0].Value)
+	}
+	f := TransformFunction{Name: name}
+	parts := parser.SplitCommas(args)
+	if len(parts) < len(spec.kinds)-spec.optional || len(parts) > len(spec.kinds) {
+		return f, errorf("wrong number of arguments to %s()", name)
+	}
+	for i, part := range parts {
+		if len(part) != 1 || !transformArgOK(part[0], spec.kinds[i]) {
+			return f, errorf("bad argument %q to %s()", render(part), name)
+		}
+		f.Args = append(f.Args, part[0])
+	}
+	return f, nil
+}
+
+func transformArgOK(t tokenizer.Token, kind byte) bool {
+	switch kind {
+	case argNumber:
+		return t.Type == tokenizer.TokenNumber
+	case argAngle:
+		_, ok := angle(t)
+		return ok
+	case argScale:
+		return t.Type == tokenizer.TokenNumber || t.Type == tokenizer.TokenPercentage
+	case argLengthPct:
+		if t.Type == tokenizer.TokenPercentage {
+			return true
+		}
+	case argPerspective:
+		if t.MatchesIdent("none") {
+			return true
+		}
+	}
+	if t.Type == tokenizer.TokenNumber {
+		f, _ := t.Float()
+		return f == 0
+	}
+	return t.Type == tokenizer.TokenDimension && tokenizer.ClassifyUnit(unit(t)).IsLength()
+}
+
+// Matrix is a 4x4 transformation matrix.  Its elements are in the order of
+// the arguments of matrix3d(), column by column, so the translation is in
+// elements 12, 13, and 14.
+type Matrix [16]float64
+
+// IdentityMatrix returns the matrix of a transform that does nothing.
+func IdentityMatrix() Matrix {
+	return Matrix{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+// Multiply returns m × n, the transform that applies n and then m.  This is
+// the order the functions of a transform value are composed in: the
+// transform "f g" is the matrix of f multiplied by the matrix of g.
+func (m Matrix) Multiply(n Matrix) Matrix {
+	var r Matrix
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += m[k*4+row] * n[col*4+k]
+			}
+			r[col*4+row] = sum
+		}
+	}
+	return r
+}
+
+// Is2D reports whether m could be written with matrix(): it leaves the z
+// axis alone and has no perspective.
+func (m Matrix) Is2D() bool {
+	for _, i := range []int{2, 3, 6, 7, 8, 9, 11, 14} {
+		if m[i] != 0 {
+			return false
+		}
+	}
+	return m[10] == 1 && m[15] == 1
+}
+
+// ComposeTransform returns the matrix of the whole transform fns.
+func ComposeTransform(fns []TransformFunction) (Matrix, error) {
+	m := IdentityMatrix()
+	for _, f := range fns {
+		fm, err := f.Matrix()
+		if err != nil {
+			return Matrix{}, err
+		}
+		m = m.Multiply(fm)
+	}
+	return m, nil
+}
+
+// Matrix returns the transformation matrix of f, with lengths in CSS
+// pixels.  Percentages and relative lengths, such as em, depend on the
+// element and cannot be converted; they give an error.
+func (f TransformFunction) Matrix() (Matrix, error) {
+	v := make([]float64, len(f.Args))
+	spec := transformArgs[f.Name]
+	for i, t := range f.Args {
+		var ok bool
+		switch spec.kinds[i] {
+		case argNumber:
+			v[i], ok = t.Float()
+		case argAngle:
+			v[i], ok = angle(t)
+			v[i] *= math.Pi / 180
+		case argScale:
+			v[i], ok = t.Float()
+			if t.Type == tokenizer.TokenPercentage {
+				v[i] /= 100
+			}
+		case argPerspective:
+			if t.MatchesIdent("none") {
+				return IdentityMatrix(), nil
+			}
+			fallthrough
+		default:
+			v[i], ok = pixels(t)
+		}
+		if !ok {
+			return Matrix{}, errorf("cannot convert %q in %s() without a box", render(f.Args[i:i+1]), f.Name)
+		}
+	}
+
+	m := IdentityMatrix()
+	switch f.Name {
+	case "matrix":
+		m[0], m[1], m[4], m[5], m[12], m[13] = v[0], v[1], v[2], v[3], v[4], v[5]
+	case "matrix3d":
+		copy(m[:], v)
+	case "translate":
+		m[12] = v[0]
+		if len(v) == 2 {
+			m[13] = v[1]
+		}
+	case "translatex":
+		m[12] = v[0]
+	case "translatey":
+		m[13] = v[0]
+	case "translatez":
+		m[14] = v[0]
+	case "translate3d":
+		m[12], m[13], m[14] = v[0], v[1], v[2]
+	case "scale":
+		m[0], m[5] = v[0], v[0]
+		if len(v) == 2 {
+			m[5] = v[1]
+		}
+	case "scalex":
+		m[0] = v[0]
+	case "scaley":
+		m[5] = v[0]
+	case "scalez":
+		m[10] = v[0]
+	case "scale3d":
+		m[0], m[5], m[10] = v[0], v[1], v[2]
+	case "rotate", "rotatez":
+		return rotation(0, 0, 1, v[0]), nil
+	case "rotatex":
+		return rotation(1, 0, 0, v[0]), nil
+	case "rotatey":
+		return rotation(0, 1, 0, v[0]), nil
+	case "rotate3d":
+		return rotation(v[0], v[1], v[2], v[3]), nil
+	case "skew":
+		m[4] = math.Tan(v[0])
+		if len(v) == 2 {
+			m[1] = math.Tan(v[1])
+		}
+	case "skewx":
+		m[4] = math.Tan(v[0])
+	case "skewy":
+		m[1] = math.Tan(v[0])
+	case "perspective":
+		// depths below 1px are clamped, as for the perspective property
+		m[11] = -1 / math.Max(v[0], 1)
+	}
+	return m, nil
+}
+
+// rotation returns the matrix of a rotation by a radians, clockwise as seen
+// looking along the axis (x, y, z) towards the origin.  An axis of zero
+// length gives no rotation.
+func rotation(x, y, z, a float64) Matrix {
+	l := math.Sqrt(x*x + y*y + z*z)
+	if l == 0 {
+		return IdentityMatrix()
+	}
+	x, y, z = x/l, y/l, z/l
+	s, c := math.Sin(a), math.Cos(a)
+	t := 1 - c
+	return Matrix{
+		c + x*x*t, y*x*t + z*s, z*x*t - y*s, 0,
+		x*y*t - z*s, c + y*y*t, z*y*t + x*s, 0,
+		x*z*t + y*s, y*z*t - x*s, c + z*z*t, 0,
+		0, 0, 0, 1,
+	}
+}
+
+var pixelsPer = map[string]float64{
+	"px": 1,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"q":  96 / 101.6,
+	"pt": 96.0 / 72,
+	"pc": 16,
+}
+
+// pixels returns the value in pixels of an absolute length, or of a
+// unitless zero.  Relative lengths, such as em, cannot be converted.
+func pixels(t tokenizer.Token) (float64, bool) {
+	f, ok := t.Float()
+	if !ok {
+		return 0, false
+	}
+	if t.Type == tokenizer.TokenNumber {
+		return 0, f == 0
+	}
+	scale, ok := pixelsPer[unit(t)]
+	return f * scale, ok
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2018 Kane York. Licensed under 2-Clause BSD.
+
+/*
+Package values interprets the values of individual CSS properties and
+functions, such as gradients, transforms, and the font shorthand.
+
+The parsing functions take the tokens of a value, such as the Value of a
+parser.Declaration, and check them against the grammar of the property or
+function:
+
+	_, rules, _ := parser.ParseBlockContents(toks)
+	...
+	g, err := values.ParseGradient(decl.Value)
+	if err != nil {
+		// not a gradient, or an invalid one
+	}
+	for _, stop := range g.Stops {
+		...
+	}
+
+Parts of a value that are left uninterpreted, such as colors, are returned
+as slices of the input holding a single component value: one token, or a
+function or block together with everything in it.  Keywords are returned in
+lower case.  Values using var(), calc(), and other math functions can only
+be interpreted where the result type is not needed, and give errors
+elsewhere.  ParseColor interprets one of those colors, for measuring the
+contrast and differences between colors.  ParseColorMix and ParseRelativeColor
+break color-mix() and relative colors into their parts, even where they
+use var(), and resolve them where they can be.
+
+ValidateDeclaration checks a whole declaration against the value definition
+of its property, written in the grammar of the specifications.  The
+definitions of the common properties are built in, and others can be added
+with RegisterProperty.
+*/
+package values
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("values: "+format, args...)
+}
+
+// render returns toks as CSS source, for error messages.
+func render(toks []tokenizer.Token) string {
+	var buf bytes.Buffer
+	tokenizer.RenderTokens(&buf, toks)
+	return buf.String()
+}
+
+// single returns the one component value of toks.
+func single(toks []tokenizer.Token, what string) ([]tokenizer.Token, error) {
+	cvs := parser.ComponentValues(toks)
+	if len(cvs) != 1 {
+		return nil, errorf("expected a single %s", what)
+	}
+	return cvs[0], nil
+}
+
+// trim returns toks without the whitespace and comments at either end.
+func trim(toks []tokenizer.Token) []tokenizer.Token {
+	for len(toks) > 0 && tokenizer.IsTrivia(toks[0]) {
+		toks = toks[1:]
+	}
+	for len(toks) > 0 && tokenizer.IsTrivia(toks[len(toks)-1]) {
+		toks = toks[:len(toks)-1]
+	}
+	return toks
+}
+
+// onlyToken returns a pointer to the one token in toks that is not
+// whitespace or a comment, or nil if there is not exactly one.
+func onlyToken(toks []tokenizer.Token) *tokenizer.Token {
+	var only *tokenizer.Token
+	for i := range toks {
+		if tokenizer.IsTrivia(toks[i]) {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = &toks[i]
+	}
+	return only
+}
+
+// function returns the lowercased name and the arguments of the function
+// component value cv.
+func function(cv []tokenizer.Token) (name string, args []tokenizer.Token, ok bool) {
+	if len(cv) == 0 || cv[0].Type != tokenizer.TokenFunction {
+		return "", nil, false
+	}
+	args = cv[1:]
+	if n := len(args); n > 0 && args[n-1].Type == tokenizer.TokenCloseParen {
+		args = args[:n-1]
+	}
+	return strings.ToLower(cv[0].Value), args, true
+}
+
+// isFunction reports whether cv is a call to the named function.
+func isFunction(cv []tokenizer.Token, name string) bool {
+	return len(cv) > 0 && cv[0].Type == tokenizer.TokenFunction && tokenizer.IdentEquals(cv[0].Value, name)
+}
+
+// keyword returns the lowercased value of cv if it is a single identifier.
+func keyword(cv []tokenizer.Token) string {
+	if len(cv) != 1 || cv[0].Type != tokenizer.TokenIdent {
+		return ""
+	}
+	return strings.ToLower(cv[0].Value)
+}
+
+func isNumeric(cv []tokenizer.Token) bool {
+	if len(cv) != 1 {
+		return false
+	}
+	switch cv[0].Type {
+	case tokenizer.TokenNumber, tokenizer.TokenPercentage, tokenizer.TokenDimension:
+		return true
+	}
+	return false
+}
+
+// unit returns the lowercased unit of a TokenDimension.
+func unit(t tokenizer.Token) string {
+	if e, ok := t.Extra.(*tokenizer.TokenExtraNumeric); ok && e != nil && t.Type == tokenizer.TokenDimension {
+		return strings.ToLower(e.Dimension)
+	}
+	return ""
+}
+
+var degreesPer = map[string]float64{
+	"deg":  1,
+	"grad": 360.0 / 400,
+	"rad":  180 / math.Pi,
+	"turn": 360,
+}
+
+// angle returns the value in degrees of an angle, or of a unitless zero.
+func angle(t tokenizer.Token) (float64, bool) {
+	f, ok := t.Float()
+	if !ok {
+		return 0, false
+	}
+	if t.Type == tokenizer.TokenNumber {
+		return 0, f == 0
+	}
+	scale, ok := degreesPer[unit(t)]
+	return f * scale, ok
+}
@@ -0,0 +1,909 @@
+// Copyright 2018 Kane York.
+
+package values
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/riking/cssparse/parser"
+	"github.com/riking/cssparse/tokenizer"
+)
+
+func tokenize(src string) []tokenizer.Token {
+	toks, _ := tokenizer.TokenizeAll([]byte(src), nil)
+	return toks
+}
+
+func renderAll(cvs [][]tokenizer.Token) string {
+	var parts []string
+	for _, cv := range cvs {
+		parts = append(parts, render(cv))
+	}
+	return strings.Join(parts, " ")
+}
+
+func describeGradient(g *Gradient) string {
+	s := g.Type
+	if g.Repeating {
+		s = "repeating " + s
+	}
+	switch {
+	case g.Corner != "":
+		s += " to " + g.Corner
+	case g.Type != "radial":
+		s += fmt.Sprintf(" %gdeg", g.Angle)
+	}
+	if g.Shape != "" {
+		s += " " + g.Shape
+	}
+	if g.Size != nil {
+		s += " size=" + renderAll(g.Size)
+	}
+	if g.Position != nil {
+		s += " at=" + renderAll(g.Position)
+	}
+	if g.Interpolation != nil {
+		s += " in=" + strings.Join(g.Interpolation, " ")
+	}
+	for _, stop := range g.Stops {
+		if stop.IsHint() {
+			s += " | hint " + renderAll(stop.Positions)
+		} else {
+			s += " | " + render(stop.Color)
+			if len(stop.Positions) > 0 {
+				s += " " + renderAll(stop.Positions)
+			}
+		}
+	}
+	return s
+}
+
+func TestParseGradient(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{`linear-gradient(red, blue)`, `linear 180deg | red | blue`},
+		{`Linear-Gradient(To Left, red 10%, 30%, rgb(0, 0, 255) 50% 60%)`, `linear 270deg | red 10% | hint 30% | rgb(0, 0, 255) 50% 60%`},
+		{`linear-gradient(0.25turn in oklch longer hue, red, blue)`, `linear 90deg in=oklch longer hue | red | blue`},
+		{`linear-gradient(in srgb to right bottom, red, blue)`, `linear to bottom right in=srgb | red | blue`},
+		{`repeating-linear-gradient(0, red 0 10px, blue calc(10px + 1vw))`, `repeating linear 0deg | red 0 10px | blue calc(10px + 1vw)`},
+		{`radial-gradient(red, blue)`, `radial ellipse | red | blue`},
+		{`radial-gradient(10px at left 10% top, red, blue)`, `radial circle size=10px at=left 10% top | red | blue`},
+		{`radial-gradient(closest-side circle, red, blue)`, `radial circle size=closest-side | red | blue`},
+		{`radial-gradient(10px 20%, red, blue)`, `radial ellipse size=10px 20% | red | blue`},
+		{`conic-gradient(from 90deg at 0 0, red, blue 50%, green 1turn)`, `conic 90deg at=0 0 | red | blue 50% | green 1turn`},
+	} {
+		g, err := ParseGradient(tokenize(tc.src))
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		if got := describeGradient(g); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+	}
+	for _, src := range []string{
+		`red`,
+		`linear-gradient(red)`,
+		`linear-gradient(red, 10%)`,
+		`linear-gradient(10%, red, blue)`,
+		`linear-gradient(red, 10%, 20%, blue)`,
+		`linear-gradient(to top bottom, red, blue)`,
+		`linear-gradient(45px, red, blue)`,
+		`linear-gradient(to left 45deg, red, blue)`,
+		`linear-gradient(red 1 2, blue)`,
+		`linear-gradient(red 1px 2px 3px, blue)`,
+		`conic-gradient(red 10px, blue)`,
+		`radial-gradient(circle 10px 20px, red, blue)`,
+		`radial-gradient(ellipse 10px, red, blue)`,
+		`radial-gradient(at, red, blue)`,
+		`-webkit-linear-gradient(left, red, blue)`,
+		`linear-gradient(red, blue) x`,
+	} {
+		if g, err := ParseGradient(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error, got %s", src, describeGradient(g))
+		}
+	}
+}
+
+func TestParseTransform(t *testing.T) {
+	fns, err := ParseTransform(tokenize(`translate(10px, 50%) ROTATE(0.25turn) scale3d(1, 2, 50%) perspective(none)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range fns {
+		got = append(got, fmt.Sprintf("%s%d", f.Name, len(f.Args)))
+	}
+	if s := strings.Join(got, " "); s != "translate2 rotate1 scale3d3 perspective1" {
+		t.Errorf("got %s", s)
+	}
+	if fns, err := ParseTransform(tokenize(`none`)); fns != nil || err != nil {
+		t.Errorf("none: got %v, %v", fns, err)
+	}
+	for _, src := range []string{
+		``,
+		`translate()`,
+		`translate(1px, 2px, 3px)`,
+		`translate(1px 2px)`,
+		`translateZ(10%)`,
+		`rotate(10px)`,
+		`rotate(10)`,
+		`scale(1px)`,
+		`matrix(1, 0, 0, 1, 0)`,
+		`spin(1turn)`,
+		`translate(calc(1px + 2px))`,
+		`none none`,
+	} {
+		if _, err := ParseTransform(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func matrixClose(a, b Matrix) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestComposeTransform(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want Matrix
+	}{
+		{`none`, IdentityMatrix()},
+		{`translate(1in, 2px) scale(2, 50%)`, Matrix{2, 0, 0, 0, 0, 0.5, 0, 0, 0, 0, 1, 0, 96, 2, 0, 1}},
+		// the translation is rotated, since it is applied first
+		{`rotate(90deg) translateX(10px)`, Matrix{0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1, 0, 0, 10, 0, 1}},
+		{`rotate3d(0, 0, 2, 90deg)`, Matrix{0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}},
+		{`rotateX(90deg)`, Matrix{1, 0, 0, 0, 0, 0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1}},
+		{`matrix(1, 2, 3, 4, 5, 6)`, Matrix{1, 2, 0, 0, 3, 4, 0, 0, 0, 0, 1, 0, 5, 6, 0, 1}},
+		{`skewX(45deg)`, Matrix{1, 0, 0, 0, 1, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}},
+		{`perspective(100px) translateZ(0)`, Matrix{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, -0.01, 0, 0, 0, 1}},
+	} {
+		fns, err := ParseTransform(tokenize(tc.src))
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		m, err := ComposeTransform(fns)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+		} else if !matrixClose(m, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.src, m, tc.want)
+		}
+	}
+	if m, _ := ComposeTransform(nil); !m.Is2D() {
+		t.Errorf("identity is not 2D")
+	}
+	fns, _ := ParseTransform(tokenize(`rotateY(10deg)`))
+	if m, _ := ComposeTransform(fns); m.Is2D() {
+		t.Errorf("rotateY is 2D")
+	}
+	for _, src := range []string{`translate(50%)`, `translateX(1em)`} {
+		fns, _ := ParseTransform(tokenize(src))
+		if _, err := ComposeTransform(fns); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestParseFont(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{`12px serif`, `12px serif`},
+		{`Italic BOLD 12px/30px Georgia, serif`, `italic bold 12px/30px Georgia, serif`},
+		{`normal normal 400 condensed 80%/1.2 "Helvetica Neue", Times  New Roman`, `400 condensed 80%/1.2 "Helvetica Neue", Times New Roman`},
+		{`small-caps normal oblique 10deg larger a`, `oblique 10deg small-caps larger a`},
+		{`0 a`, `0 a`},
+		{`1000 0 a`, `1000 0 a`},
+		{`caption`, `caption`},
+		{`x-large/calc(1px + 2px) a`, `x-large/calc(1px + 2px) a`},
+	} {
+		f, err := ParseFont(tokenize(tc.src))
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		if got := f.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+		// the serialized value must parse to the same description
+		f2, err := ParseFont(tokenize(f.String()))
+		if err != nil || f2.String() != f.String() {
+			t.Errorf("%s: reparsing gave %v, %v", tc.src, f2, err)
+		}
+	}
+
+	f, _ := ParseFont(tokenize(`bold 12px "Serif", serif`))
+	if f.Weight != "bold" || f.Style != "normal" || len(f.Families) != 2 || f.Families[0].IsGeneric() || !f.Families[1].IsGeneric() {
+		t.Errorf("got %+v", f)
+	}
+
+	for _, src := range []string{
+		``,
+		`serif`,
+		`12px`,
+		`bold bold 12px serif`,
+		`italic oblique 12px serif`,
+		`normal normal normal normal normal 12px serif`,
+		`12px/ serif`,
+		`12px serif,`,
+		`12px a "b"`,
+		`12px 1`,
+		`10deg serif`,
+		`caption serif`,
+		`1001 12px serif`,
+	} {
+		if _, err := ParseFont(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestParseGridTemplateAreas(t *testing.T) {
+	g, err := ParseGridTemplateAreas(tokenize(`"head head" "nav  main" ". main" "foot\20 foot"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Rows() != 4 || g.Columns() != 2 {
+		t.Errorf("got %dx%d grid", g.Rows(), g.Columns())
+	}
+	want := map[string]GridArea{
+		"head": {0, 1, 0, 2},
+		"nav":  {1, 2, 0, 1},
+		"main": {1, 3, 1, 2},
+		"foot": {3, 4, 0, 2},
+	}
+	if fmt.Sprint(g.Areas) != fmt.Sprint(want) {
+		t.Errorf("got areas %v, want %v", g.Areas, want)
+	}
+	if g.Cells[2][0] != "" {
+		t.Errorf("got %q for a null cell", g.Cells[2][0])
+	}
+	if g, err := ParseGridTemplateAreas(tokenize(`none`)); g != nil || err != nil {
+		t.Errorf("none: got %v, %v", g, err)
+	}
+	if g, err := ParseGridTemplateAreas(tokenize(`"a...b 1é"`)); err != nil || len(g.Cells[0]) != 4 {
+		t.Errorf("got %v, %v", g, err)
+	}
+
+	for _, src := range []string{
+		``,
+		`a`,
+		`"a" b`,
+		`"a b" "c"`,
+		`""`,
+		`"a b a"`,
+		`"a a" "a ."`,
+		`"a b" "b a"`,
+		`"a #"`,
+	} {
+		if _, err := ParseGridTemplateAreas(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestParseEasing(t *testing.T) {
+	for _, tc := range []struct {
+		src     string
+		in, out []float64
+	}{
+		{`linear`, []float64{-1, 0, 0.3, 2}, []float64{-1, 0, 0.3, 2}},
+		{`ease`, []float64{0, 0.25, 0.5, 1}, []float64{0, 0.4085106, 0.8024033, 1}},
+		{`cubic-bezier(0, 0, 1, 1)`, []float64{0.2, 0.7}, []float64{0.2, 0.7}},
+		// y values outside [0, 1], and extrapolation along the end tangents
+		{`cubic-bezier(0.5, -1, 0.5, 2)`, []float64{0.5, -1, 2}, []float64{0.5, 2, -1}},
+		{`steps(4)`, []float64{0, 0.24, 0.25, 0.99, 1}, []float64{0, 0, 0.25, 0.75, 1}},
+		{`steps(4, jump-start)`, []float64{0, 0.25, 0.99, 1}, []float64{0.25, 0.5, 1, 1}},
+		{`steps(2, jump-both)`, []float64{0, 0.5, 1}, []float64{1.0 / 3, 2.0 / 3, 1}},
+		{`steps(3, jump-none)`, []float64{0, 0.34, 0.67, 1}, []float64{0, 0.5, 1, 1}},
+		{`step-end`, []float64{0.5, 1}, []float64{0, 1}},
+		{`linear(0, 0.25, 1)`, []float64{0.25, 0.5, 0.75}, []float64{0.125, 0.25, 0.625}},
+		{`linear(0, 0.5 25% 75%, 1)`, []float64{0.1, 0.5, 0.9}, []float64{0.2, 0.5, 0.8}},
+		// inputs never go backwards, and the ends extrapolate
+		{`linear(0 50%, 1 20%)`, []float64{0.5, 0, 1}, []float64{1, 1, 1}},
+		{`linear(0, 1)`, []float64{-0.5, 1.5}, []float64{-0.5, 1.5}},
+	} {
+		fn, err := ParseEasing(tokenize(tc.src))
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		for i, in := range tc.in {
+			if got := fn(in); math.Abs(got-tc.out[i]) > 1e-6 {
+				t.Errorf("%s at %g: got %g, want %g", tc.src, in, got, tc.out[i])
+			}
+		}
+	}
+	for _, src := range []string{
+		``,
+		`bounce`,
+		`cubic-bezier(1.1, 0, 0, 1)`,
+		`cubic-bezier(0, 0, 1)`,
+		`steps(0)`,
+		`steps(1.5)`,
+		`steps(1, jump-none)`,
+		`steps(2, middle)`,
+		`steps(, end)`,
+		`linear(0)`,
+		`linear(0, 50%)`,
+		`linear(0, 1 2)`,
+		`spring(1)`,
+	} {
+		if _, err := ParseEasing(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestParseImageSet(t *testing.T) {
+	opts, err := ParseImageSet(tokenize(`image-set("a.png" 1x, url(b.png) 2dppx type("image/avif"), ` +
+		`url("c.png") 192DPI, linear-gradient(red, blue) type('x') 3x)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range opts {
+		got = append(got, fmt.Sprintf("%s %g %s %s", o.URL, o.Resolution, o.Type, render(o.Image)))
+	}
+	want := `a.png 1  "a.png"|b.png 2 image/avif url("b.png")|c.png 2  url("c.png")|` +
+		` 3 x linear-gradient(red, blue)`
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("got  %s\nwant %s", s, want)
+	}
+	if opts, err := ParseImageSet(tokenize(`-webkit-image-set(url(a.png))`)); err != nil || opts[0].Resolution != 1 {
+		t.Errorf("got %v, %v", opts, err)
+	}
+	for _, src := range []string{
+		``,
+		`url(a.png)`,
+		`image-set()`,
+		`image-set("a.png" 1x,)`,
+		`image-set("a.png" 1x 2x)`,
+		`image-set("a.png" 1px)`,
+		`image-set("a.png" type(image/png))`,
+		`image-set(1x)`,
+		`image-set(type("x"))`,
+	} {
+		if _, err := ParseImageSet(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestRewriteURLs(t *testing.T) {
+	src := `url(a) url( "b" ) image-set("c" 1x, url(d) 2x) f(url(e), "f")`
+	toks := tokenize(src)
+	got := render(RewriteURLs(toks, func(u string) string { return "/cdn/" + u }))
+	want := `url("/cdn/a") url("/cdn/b") image-set("/cdn/c" 1x, url("/cdn/d") 2x) f(url("/cdn/e"), "f")`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if !tokenizer.TokensEqual(toks, tokenize(src)) {
+		t.Errorf("input was modified: %s", render(toks))
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	value := tokenize(`calc(env(safe-area-inset-top, env(titlebar-area-height, 0px)) + 1px) env(viewport-segment-width 1 0)`)
+	var got []string
+	for _, cv := range FindFunctions(value, "ENV") {
+		e, err := ParseEnv(cv)
+		if err != nil {
+			t.Fatalf("%s: %v", render(cv), err)
+		}
+		got = append(got, fmt.Sprintf("%s %v [%s] %v", e.Name, e.Indices, render(e.Fallback), e.Fallback != nil))
+	}
+	want := "safe-area-inset-top [] [env(titlebar-area-height, 0px)] true|" +
+		"titlebar-area-height [] [0px] true|" +
+		"viewport-segment-width [1 0] [] false"
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("got  %s\nwant %s", s, want)
+	}
+	if e, err := ParseEnv(tokenize(`env(x,)`)); err != nil || e.Fallback == nil || len(e.Fallback) != 0 {
+		t.Errorf("empty fallback: got %v, %v", e, err)
+	}
+	for _, src := range []string{`env()`, `env(1)`, `env(x -1)`, `env(x 1.5)`, `var(--x)`, `env(x) env(y)`} {
+		if _, err := ParseEnv(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestParseAttr(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{`attr(data-x)`, ` data-x   <nil>`},
+		{`attr(data-x type(<length> | auto), 10px)`, ` data-x <length> | auto  10px`},
+		{`attr(svg|href raw-string)`, `svg href raw-string  <nil>`},
+		{`attr(*|w PX, 1px, 2px)`, `* w  px 1px, 2px`},
+		{`attr(|w %)`, ` w  % <nil>`},
+		{`attr(title string,)`, ` title string  `},
+	} {
+		a, err := ParseAttr(tokenize(tc.src))
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		fallback := "<nil>"
+		if a.Fallback != nil {
+			fallback = render(a.Fallback)
+		}
+		if got := fmt.Sprintf("%s %s %s %s %s", a.Namespace, a.Name, a.Type, a.Unit, fallback); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.src, got, tc.want)
+		}
+	}
+	for _, src := range []string{`attr()`, `attr(1)`, `attr(a b c)`, `attr(a bogus)`, `attr(a type())`, `attr(a|)`} {
+		if _, err := ParseAttr(tokenize(src)); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestRoundNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		opts    RoundOptions
+		in, out string
+	}{
+		{RoundOptions{Decimals: 3}, `0.16666667em`, `0.167em`},
+		{RoundOptions{Decimals: 2}, `a{width:33.333333%;opacity:.66666;top:-1.0051px}`, `a{width:33.33%;opacity:0.67;top:-1.01px}`},
+		// integers, values that would become zero, and values that are
+		// already short enough are left alone
+		{RoundOptions{Decimals: 2}, `10 1e3 0.001px 1.5 1.50`, `10 1e3 0.001px 1.5 1.5`},
+		// large units keep extra digits
+		{RoundOptions{Decimals: 1}, `0.123456turn 0.123456s 0.123456ms`, `0.1235turn 0.1235s 0.1ms`},
+		{RoundOptions{Decimals: 1, KeepPercentages: true}, `linear-gradient(red 33.3333%, blue 66.6666%) 1.2345`, `linear-gradient(red 33.3333%, blue 66.6666%) 1.2`},
+		{RoundOptions{Decimals: 0}, `2.5 -2.5`, `3 -3`},
+	} {
+		r := tokenizer.NewTransformReader(bytes.NewReader([]byte(tc.in)), RoundNumbers(tc.opts))
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.out {
+			t.Errorf("%+v %s:\ngot  %s\nwant %s", tc.opts, tc.in, got, tc.out)
+		}
+	}
+}
+
+func TestNormalizeFontFamily(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{`"Helvetica Neue", Helvetica  Neue, 'Arial'`, `Helvetica Neue, Helvetica Neue, Arial`},
+		{`"serif", serif, "Serif Pro", "Sans-Serif"`, `"serif", serif, Serif Pro, "Sans-Serif"`},
+		{`"initial", Foo Default, "Inherit Sans", "inheritance"`, `"initial", "Foo Default", "Inherit Sans", inheritance`},
+		{`"3M", "a  b", " x", "a,b", "x\\y"`, `"3M", "a  b", " x", "a,b", "x\\y"`},
+		{`"Noto Sans CJK JP", "日本語"`, `Noto Sans CJK JP, 日本語`},
+	} {
+		toks, err := NormalizeFontFamily(tokenize(tc.in))
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if got := render(toks); got != tc.out {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.in, got, tc.out)
+		}
+		// the result must name the same families
+		before, _ := ParseFontFamily(tokenize(tc.in))
+		after, _ := ParseFontFamily(tokenize(render(toks)))
+		for i := range before {
+			if before[i].Name != after[i].Name || before[i].IsGeneric() != after[i].IsGeneric() {
+				t.Errorf("%s: family %d changed from %+v to %+v", tc.in, i, before[i], after[i])
+			}
+		}
+	}
+	if _, err := NormalizeFontFamily(tokenize(`a, , b`)); err == nil {
+		t.Errorf("expected an error for an empty family")
+	}
+}
+
+func TestNormalizeKeyframesName(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{`"slide-in"`, `slide-in`},
+		{`slide-in`, `slide-in`},
+		{`"none"`, `"none"`},
+		{`"Initial"`, `"Initial"`},
+		{`"1st"`, `"1st"`},
+		{`"a b"`, `"a b"`},
+	} {
+		got := NormalizeKeyframesName(tokenize(tc.in)[0])
+		if s := render([]tokenizer.Token{got}); s != tc.out {
+			t.Errorf("%s: got %s, want %s", tc.in, s, tc.out)
+		}
+	}
+}
+
+func TestSyntax(t *testing.T) {
+	tests := []struct {
+		syntax string
+		match  []string
+		reject []string
+	}{
+		{"*", []string{"anything at all", "{a}"}, []string{""}},
+		{"<length> | auto", []string{"10px", "0", "2em", "calc(1px + 2em)", "auto"}, []string{"Auto", "10%", "10px 2px", "5"}},
+		{"<color>#", []string{"red", "#fff, rgb(0 0 0), CurrentColor"}, []string{"#ggg", "red blue", "red,", "bogus"}},
+		{"<length-percentage>+", []string{"1px 50% 0"}, []string{"1px, 2px", "1deg"}},
+		{"<integer> | <angle>", []string{"3", "-2", "0.5turn"}, []string{"1.5", "3px"}},
+		{"<custom-ident>", []string{"foo", "none"}, []string{"inherit", "default", "'foo'"}},
+		{"<transform-list>", []string{"rotate(1deg) scale(2)"}, []string{"none", "rotate(1px)"}},
+		{"<image> | <url>", []string{"url(a.png)", "linear-gradient(red, blue)"}, []string{"'a.png'"}},
+		{" <time>|<resolution># ", []string{"1s", "2x, 96dpi"}, []string{"1px"}},
+	}
+	for _, tt := range tests {
+		syn, err := ParseSyntax(tt.syntax)
+		if err != nil {
+			t.Errorf("%q: %v", tt.syntax, err)
+			continue
+		}
+		for _, v := range tt.match {
+			if !syn.Matches(tokenize(v)) {
+				t.Errorf("%q: expected %q to match", tt.syntax, v)
+			}
+		}
+		for _, v := range tt.reject {
+			if syn.Matches(tokenize(v)) {
+				t.Errorf("%q: expected %q not to match", tt.syntax, v)
+			}
+		}
+	}
+
+	syn, _ := ParseSyntax("<length>+|auto |<color>#")
+	if got := syn.String(); got != "<length>+ | auto | <color>#" {
+		t.Errorf("got %s", got)
+	}
+	for _, bad := range []string{"", "<length", "<bogus>", "inherit", "<transform-list>#", "a b", "<length> +", "*|auto"} {
+		if _, err := ParseSyntax(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestGrammar(t *testing.T) {
+	tests := []struct {
+		def    string
+		match  []string
+		reject []string
+	}{
+		{"[ <length> | auto ]{1,4}", []string{"1px", "auto 0 2em auto"}, []string{"", "1px 2px 3px 4px 5px", "none"}},
+		{"a && b && c", []string{"a b c", "c a b"}, []string{"a b", "a b c a"}},
+		{"a || b || c", []string{"a", "c a", "b c a"}, []string{"", "a a"}},
+		{"a b? c", []string{"a c", "a b c"}, []string{"a c b"}},
+		{"<number>#{2,3}", []string{"1, 2", "1,2,3"}, []string{"1", "1 2", "1, 2,", "1,2,3,4"}},
+		{"[ a? b? ]!", []string{"a", "b", "a b"}, []string{""}},
+		{"<length [0,∞]>", []string{"0", "5px"}, []string{"-5px"}},
+		{"foo( <integer> , <integer> ) | bar()", []string{"foo(1, 2)", "FOO(1,2)", "bar()"}, []string{"foo(1)", "bar(1)", "foo(1, 2) x"}},
+		{"<ratio>", []string{"16/9", "16 / 9", "2"}, []string{"16/", "-1"}},
+		{"<'margin'> / <'padding'>", []string{"1px auto / 0 2px"}, []string{"auto / auto"}},
+	}
+	for _, tt := range tests {
+		g, err := ParseGrammar(tt.def)
+		if err != nil {
+			t.Errorf("%q: %v", tt.def, err)
+			continue
+		}
+		for _, v := range tt.match {
+			if !g.Match(tokenize(v)) {
+				t.Errorf("%q: expected %q to match", tt.def, v)
+			}
+		}
+		for _, v := range tt.reject {
+			if g.Match(tokenize(v)) {
+				t.Errorf("%q: expected %q not to match", tt.def, v)
+			}
+		}
+	}
+	for _, bad := range []string{"", "a |", "[ a", "<length", "a{2,1}", "<length [1]>", "f( a", "a && && b"} {
+		if _, err := ParseGrammar(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestValidateDeclaration(t *testing.T) {
+	tests := []struct {
+		decl string
+		err  string
+	}{
+		{"margin: 0 auto", ""},
+		{"MARGIN: 1px 2px 3px 4px 5px", `values: invalid value "1px 2px 3px 4px 5px" for MARGIN`},
+		{"border: 1px solid red", ""},
+		{"border: solid solid", `values: invalid value "solid solid" for border`},
+		{"background-position: left 10px top, center", ""},
+		{"background-image: url(a.png), linear-gradient(red, blue)", ""},
+		{"font-family: Open Sans, 'Helvetica', sans-serif", ""},
+		{"transition: opacity 1s ease-in, transform 2s", ""},
+		{"animation: spin 1s linear infinite", ""},
+		{"flex: 1 1 0", ""},
+		{"flex: auto auto", `values: invalid value "auto auto" for flex`},
+		{"padding: -1px", `values: invalid value "-1px" for padding`},
+		{"width: calc(100% - 10px)", ""},
+		{"width: var(--w)", ""},
+		{"color: inherit", ""},
+		{"--anything: { whatever }", ""},
+		{"colour: red", `values: unknown property "colour"`},
+	}
+	for _, tt := range tests {
+		d, err := parser.ParseDeclaration(tokenize(tt.decl))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ValidateDeclaration(d)
+		if got := fmt.Sprint(err); err == nil && tt.err != "" || err != nil && got != tt.err {
+			t.Errorf("%s: got %v, want %q", tt.decl, err, tt.err)
+		}
+	}
+
+	if err := RegisterProperty("x-ratio", "<ratio> | none"); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := parser.ParseDeclaration(tokenize("x-ratio: 4/3"))
+	if err := ValidateDeclaration(d); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExpandShorthand(t *testing.T) {
+	tests := []struct{ decl, want string }{
+		{"margin: 1px 2px !important", "margin-top: 1px !important; margin-right: 2px !important; " +
+			"margin-bottom: 1px !important; margin-left: 2px !important"},
+		{"padding: 1px 2px 3px", "padding-top: 1px; padding-right: 2px; padding-bottom: 3px; padding-left: 2px"},
+		{"inset: auto", "top: auto; right: auto; bottom: auto; left: auto"},
+		{"border-top: red 2px", "border-top-width: 2px; border-top-style: none; border-top-color: red"},
+		{"border: dashed", "border-top-width: medium; border-right-width: medium; border-bottom-width: medium; " +
+			"border-left-width: medium; border-top-style: dashed; border-right-style: dashed; " +
+			"border-bottom-style: dashed; border-left-style: dashed; border-top-color: currentcolor; " +
+			"border-right-color: currentcolor; border-bottom-color: currentcolor; border-left-color: currentcolor"},
+		{"background: url(a.png) no-repeat left 10px top / cover, content-box red",
+			`background-color: red; background-image: url("a.png"), none; background-position: left 10px top, 0% 0%; ` +
+				"background-size: cover, auto; background-repeat: no-repeat, repeat; background-attachment: scroll, scroll; " +
+				"background-origin: padding-box, content-box; background-clip: border-box, content-box"},
+		{"font: italic bold 12px/1.5 'Open Sans', serif", `font-style: italic; font-variant: normal; font-weight: bold; ` +
+			`font-stretch: normal; font-size: 12px; line-height: 1.5; font-family: "Open Sans", serif`},
+		{"flex: 2", "flex-grow: 2; flex-shrink: 1; flex-basis: 0"},
+		{"flex: 10px 2", "flex-grow: 2; flex-shrink: 1; flex-basis: 10px"},
+		{"flex: 1 0 0", "flex-grow: 1; flex-shrink: 0; flex-basis: 0"},
+		{"flex: none", "flex-grow: 0; flex-shrink: 0; flex-basis: auto"},
+		{"grid: 100px 1fr / repeat(3, 1fr)", "grid-template-rows: 100px 1fr; grid-template-columns: repeat(3, 1fr); " +
+			"grid-template-areas: none; grid-auto-rows: auto; grid-auto-columns: auto; grid-auto-flow: row"},
+		{"grid: auto-flow dense 50px / 1fr 1fr", "grid-template-rows: none; grid-template-columns: 1fr 1fr; " +
+			"grid-template-areas: none; grid-auto-rows: 50px; grid-auto-columns: auto; grid-auto-flow: row dense"},
+		{"transition: opacity 1s ease-in 2s, transform 3s", "transition-property: opacity, transform; " +
+			"transition-duration: 1s, 3s; transition-timing-function: ease-in, ease; transition-delay: 2s, 0s; " +
+			"transition-behavior: normal, normal"},
+		{"animation: none 1s spin infinite alternate", "animation-duration: 1s; animation-timing-function: ease; " +
+			"animation-delay: 0s; animation-iteration-count: infinite; animation-direction: alternate; " +
+			"animation-fill-mode: none; animation-play-state: running; animation-name: spin"},
+		{"flex: inherit", "flex-grow: inherit; flex-shrink: inherit; flex-basis: inherit"},
+		{"color: red", "color: red"},
+	}
+	for _, tt := range tests {
+		d, err := parser.ParseDeclaration(tokenize(tt.decl))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decls, err := ExpandShorthand(d)
+		if err != nil {
+			t.Errorf("%s: %v", tt.decl, err)
+			continue
+		}
+		var parts []string
+		for _, d := range decls {
+			s := d.Name + ": " + render(d.Value)
+			if d.Important {
+				s += " !important"
+			}
+			parts = append(parts, s)
+		}
+		if got := strings.Join(parts, "; "); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.decl, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"margin: 1px 2px 3px 4px 5px",
+		"margin: var(--m)",
+		"font: caption",
+		"grid: 'a b' 1fr / 1fr 1fr",
+		"grid: 1fr",
+		"border: solid solid",
+		"transition: 1s 2s 3s",
+	} {
+		d, _ := parser.ParseDeclaration(tokenize(bad))
+		if decls, err := ExpandShorthand(d); err == nil {
+			t.Errorf("%s: expected an error, got %v", bad, decls)
+		}
+	}
+}
+
+func TestCondenseLonghands(t *testing.T) {
+	tests := []struct{ block, want string }{
+		{"margin-top: 1px; margin-right: 2px; margin-bottom: 1px; margin-left: 2px", "margin: 1px 2px"},
+		{"padding-top: 0; padding-left: 0; color: red; padding-right: 0; padding-bottom: 0", "color: red; padding: 0"},
+		{"top: 1px; right: 2px; bottom: 3px; left: 2px", "inset: 1px 2px 3px"},
+		{"margin-top: 1px !important; margin-right: 1px; margin-bottom: 1px; margin-left: 1px",
+			"margin-top: 1px !important; margin-right: 1px; margin-bottom: 1px; margin-left: 1px"},
+		{"margin-top: 1px; margin-right: 1px; margin-inline-start: 0; margin-bottom: 1px; margin-left: 1px",
+			"margin-top: 1px; margin-right: 1px; margin-inline-start: 0; margin-bottom: 1px; margin-left: 1px"},
+		{"margin-top: 1px; margin-right: var(--m); margin-bottom: 1px; margin-left: 1px",
+			"margin-top: 1px; margin-right: var(--m); margin-bottom: 1px; margin-left: 1px"},
+		{"margin-top: inherit; margin-right: inherit; margin-bottom: inherit; margin-left: inherit", "margin: inherit"},
+		{"margin-top: inherit; margin-right: 0; margin-bottom: 0; margin-left: 0",
+			"margin-top: inherit; margin-right: 0; margin-bottom: 0; margin-left: 0"},
+		{"margin-top: 5px; margin-top: 1px; margin-right: 1px; margin-bottom: 1px; margin-left: 1px",
+			"margin-top: 5px; margin: 1px"},
+		{"border-top-width: 1px; border-top-style: solid; border-top-color: red", "border-top: solid 1px red"},
+		{"border-left-width: medium; border-left-style: none; border-left-color: currentcolor", "border-left: none"},
+		{"flex-grow: 2; flex-shrink: 1; flex-basis: 0", "flex: 2"},
+		{"flex-grow: 1; flex-shrink: 1; flex-basis: auto", "flex: auto"},
+		{"flex-grow: 1; flex-shrink: 0; flex-basis: 10px", "flex: 1 0 10px"},
+		{"flex-direction: column; flex-wrap: nowrap", "flex-flow: column"},
+		{"row-gap: 1em; column-gap: 1em; overflow-x: auto; overflow-y: hidden", "gap: 1em; overflow: auto hidden"},
+	}
+	for _, tt := range tests {
+		decls, _, errs := parser.ParseBlockContents(tokenize(tt.block))
+		if len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		var parts []string
+		for _, d := range CondenseLonghands(decls) {
+			s := d.Name + ": " + render(d.Value)
+			if d.Important {
+				s += " !important"
+			}
+			parts = append(parts, s)
+		}
+		if got := strings.Join(parts, "; "); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.block, got, tt.want)
+		}
+	}
+
+	// all four sides of each border property
+	var sides []string
+	for _, side := range borderSides {
+		sides = append(sides, "border-"+side+"-width: 1px", "border-"+side+"-style: solid", "border-"+side+"-color: red")
+	}
+	decls, _, _ := parser.ParseBlockContents(tokenize(strings.Join(sides, "; ")))
+	var names []string
+	for _, d := range CondenseLonghands(decls) {
+		names = append(names, d.Name+": "+render(d.Value))
+	}
+	if got, want := strings.Join(names, "; "), "border-width: 1px; border-style: solid; border-color: red"; got != want {
+		t.Errorf("border sides:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, tt := range []struct{ src, want string }{
+		{`#f00`, `#ff0000`},
+		{`RebeccaPurple`, `#663399`},
+		{`transparent`, `#00000000`},
+		{`rgb(255, 0, 0)`, `#ff0000`},
+		{`rgba(0,0,255,.5)`, `#0000ff80`},
+		{`rgb(100% 50% none / 25%)`, `#ff800040`},
+		{`hsl(120deg 100% 25%)`, `#008000`},
+		{`hsla(.5turn, 100%, 50%, 1)`, `#00ffff`},
+		{`hwb(0 0% 0%)`, `#ff0000`},
+		{`hwb(0 60% 60%)`, `#808080`},
+		{`oklab(1 0 0)`, `#ffffff`},
+		{`oklch(62.8% 0.2577 29.23)`, `#ff0000`},
+	} {
+		c, err := ParseColor(tokenize(tt.src))
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got := c.Hex(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+	for _, src := range []string{`currentcolor`, `Canvas`, `lab(50% 0 0)`, `rgb(1 2 3 4)`, `rgb(1, 2)`, `rgb(var(--x))`, `hsl(10% 1 1)`, `red blue`} {
+		if _, err := ParseColor(tokenize(src)); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+
+	color := func(src string) Color {
+		c, err := ParseColor(tokenize(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	for _, tt := range []struct {
+		fg, bg string
+		want   string
+	}{
+		{`black`, `white`, `21.00`},
+		{`white`, `#fff`, `1.00`},
+		{`#777`, `white`, `4.48`},
+		{`rgb(0 0 0 / 50%)`, `white`, `3.98`},
+	} {
+		if got := fmt.Sprintf("%.2f", ContrastRatio(color(tt.fg), color(tt.bg))); got != tt.want {
+			t.Errorf("%s on %s: got %s, want %s", tt.fg, tt.bg, got, tt.want)
+		}
+	}
+	if d := DeltaE(color(`red`), color(`#fe0000`)); d <= 0 || d > .02 {
+		t.Errorf("red and #fe0000 differ by %g", d)
+	}
+	if d := DeltaE(color(`red`), color(`blue`)); d < .5 {
+		t.Errorf("red and blue differ by %g", d)
+	}
+}
+
+func TestColorMix(t *testing.T) {
+	m, err := ParseColorMix(tokenize(`color-mix(in oklch longer hue, 40% red, var(--x))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%q %s %s %s %v", m.Interpolation, render(m.Colors[0].Color), render(m.Colors[0].Percentage),
+		render(m.Colors[1].Color), m.Colors[1].Percentage); got != `["oklch" "longer" "hue"] red 40% var(--x) []` {
+		t.Errorf("got %s", got)
+	}
+	if _, err := m.Resolve(); err == nil {
+		t.Errorf("var() resolved")
+	}
+	r, err := ParseRelativeColor(tokenize(`rgb(from var(--c) r g calc(b * 2) / 0.5)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s %s %s %s %s %s", r.Function, render(r.Origin), render(r.Channels[0]), render(r.Channels[1]),
+		render(r.Channels[2]), render(r.Alpha)); got != `rgb var(--c) r g calc(b * 2) 0.5` {
+		t.Errorf("got %s", got)
+	}
+
+	for _, tt := range []struct{ src, want string }{
+		{`color-mix(in srgb, red, blue)`, `#800080`},
+		{`color-mix(in srgb, red 25%, blue)`, `#4000bf`},
+		{`color-mix(in srgb, 20% red, blue 20%)`, `#80008066`},
+		{`color-mix(in srgb, red, transparent)`, `#ff000080`},
+		{`color-mix(in srgb-linear, black, white)`, `#bcbcbc`},
+		{`color-mix(in hsl, red, blue)`, `#ff00ff`},
+		{`color-mix(in hsl longer hue, red, blue)`, `#00ff00`},
+		{`color-mix(in hsl, white, blue)`, `#9f9fdf`},
+		{`color-mix(in oklch, red 100%, blue 0%)`, `#ff0000`},
+		{`color-mix(red, red)`, `#ff0000`},
+		{`rgb(from red r g b / 0.5)`, `#ff000080`},
+		{`rgb(from #336699 b g r)`, `#996633`},
+		{`rgb(from #336699 calc(r * 2) 0 none)`, `#660000`},
+		{`hsl(from red calc(h + 120) s l)`, `#00ff00`},
+		{`hsl(from red h s calc(l - 25))`, `#800000`},
+		{`hwb(from gray h w b)`, `#808080`},
+		{`oklch(from blue l c h)`, `#0000ff`},
+		{`rgb(from rgb(from red r g b / 50%) r g b)`, `#ff000080`},
+		{`rgb(from color-mix(in srgb, red, blue) r g b)`, `#800080`},
+	} {
+		c, err := ParseColor(tokenize(tt.src))
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got := c.Hex(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+	for _, src := range []string{
+		`color-mix(in lab, red, blue)`, `color-mix(in srgb longer hue, red, blue)`, `color-mix(in srgb, red)`,
+		`color-mix(in srgb, red 120%, blue)`, `color-mix(in srgb, red 0%, blue 0%)`, `color-mix(in srgb, red 2px, blue)`,
+		`rgb(from red r g)`, `rgb(from red r g x)`, `rgb(from red calc(r + 1px) g b)`, `lab(from red l a b)`,
+	} {
+		if _, err := ParseColor(tokenize(src)); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}